@@ -3,6 +3,8 @@ package bedrock
 import (
 	"context"
 	"encoding/json"
+	"slices"
+	"time"
 
 	"github.com/Abraxas-365/kbservice/llm"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
@@ -24,9 +26,58 @@ const (
 	LLama2_13B_Chat LLMModelID = "meta.llama2-13b-chat-v1"
 )
 
+// DefaultStreamIdleTimeout is how long ChatStream waits for the next event
+// before giving up, unless set with WithStreamIdleTimeout
+const DefaultStreamIdleTimeout = 2 * time.Minute
+
 type BedrockLLM struct {
-	client *bedrockruntime.Client
-	model  LLMModelID
+	client            *bedrockruntime.Client
+	model             LLMModelID
+	functionStrategy  llm.FunctionMessageStrategy
+	streamIdleTimeout time.Duration
+	preprocessors     []func([]llm.Message) []llm.Message
+	postprocessors    []func(*llm.Message)
+}
+
+// LLMOption is a function type to modify BedrockLLM
+type LLMOption func(*BedrockLLM)
+
+// WithFunctionMessageStrategy sets how function results are sent to models
+// without a function role. Defaults to llm.InlineAsUser.
+func WithFunctionMessageStrategy(strategy llm.FunctionMessageStrategy) LLMOption {
+	return func(b *BedrockLLM) {
+		b.functionStrategy = strategy
+	}
+}
+
+// WithStreamIdleTimeout sets how long ChatStream waits between events before
+// ending the stream with an error wrapping llm.ErrStreamIdleTimeout. Zero or
+// less waits for as long as the context allows.
+func WithStreamIdleTimeout(timeout time.Duration) LLMOption {
+	return func(b *BedrockLLM) {
+		b.streamIdleTimeout = timeout
+	}
+}
+
+// WithMessagePreprocessor rewrites the messages of every Chat and ChatStream
+// call before they are converted for the model, e.g. to redact PII or add
+// guardrail instructions. Preprocessors run in the order they are added and
+// receive a copy of the caller's slice.
+func WithMessagePreprocessor(preprocess func([]llm.Message) []llm.Message) LLMOption {
+	return func(b *BedrockLLM) {
+		b.preprocessors = append(b.preprocessors, preprocess)
+	}
+}
+
+// WithResponsePostprocessor modifies the message Chat returns, e.g. to strip
+// boilerplate or normalize the assistant's output. In ChatStream it runs on
+// the final message, which carries the stop reason and model; the deltas
+// streamed before it don't pass through it. Postprocessors run in the order
+// they are added.
+func WithResponsePostprocessor(postprocess func(*llm.Message)) LLMOption {
+	return func(b *BedrockLLM) {
+		b.postprocessors = append(b.postprocessors, postprocess)
+	}
 }
 
 type anthropicMessage struct {
@@ -53,25 +104,47 @@ type anthropicResponse struct {
 	Model      string `json:"model,omitempty"`
 }
 
-func NewBedrockLLM(client *bedrockruntime.Client, model LLMModelID) *BedrockLLM {
+func NewBedrockLLM(client *bedrockruntime.Client, model LLMModelID, opts ...LLMOption) *BedrockLLM {
 	if model == "" {
 		model = Claude2
 	}
-	return &BedrockLLM{
-		client: client,
-		model:  model,
+	b := &BedrockLLM{
+		client:            client,
+		model:             model,
+		functionStrategy:  llm.InlineAsUser,
+		streamIdleTimeout: DefaultStreamIdleTimeout,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// preprocess applies the message preprocessors to a copy of messages
+func (b *BedrockLLM) preprocess(messages []llm.Message) []llm.Message {
+	if len(b.preprocessors) == 0 {
+		return messages
+	}
+	messages = slices.Clone(messages)
+	for _, preprocess := range b.preprocessors {
+		messages = preprocess(messages)
+	}
+	return messages
+}
+
+// postprocess applies the response postprocessors to message
+func (b *BedrockLLM) postprocess(message *llm.Message) {
+	for _, postprocess := range b.postprocessors {
+		postprocess(message)
 	}
 }
 
-func convertToAnthropicMessages(messages []llm.Message) []anthropicMessage {
+func convertToAnthropicMessages(messages []llm.Message, strategy llm.FunctionMessageStrategy) []anthropicMessage {
+	messages = llm.ConvertFunctionMessages(messages, strategy)
 	anthropicMsgs := make([]anthropicMessage, len(messages))
 	for i, msg := range messages {
-		role := msg.Role
-		if role == llm.RoleFunction {
-			role = "assistant"
-		}
 		anthropicMsgs[i] = anthropicMessage{
-			Role:    role,
+			Role:    msg.Role,
 			Content: msg.Content,
 		}
 	}
@@ -87,14 +160,16 @@ func (b *BedrockLLM) Chat(ctx context.Context, messages []llm.Message, opts ...l
 		opt(options)
 	}
 
+	model := LLMModelID(options.ModelOr(string(b.model)))
+
 	var requestBody []byte
 	var err error
 
-	switch b.model {
+	switch model {
 	case Claude2, Claude2Instant, Claude3:
 		anthropicReq := anthropicRequest{
-			Messages:         convertToAnthropicMessages(messages),
-			MaxTokens:        options.MaxTokens,
+			Messages:         convertToAnthropicMessages(b.preprocess(messages), b.functionStrategy),
+			MaxTokens:        options.MaxTokensFor(string(model)),
 			Temperature:      options.Temperature,
 			TopP:             options.TopP,
 			StopSequences:    options.Stop,
@@ -116,7 +191,7 @@ func (b *BedrockLLM) Chat(ctx context.Context, messages []llm.Message, opts ...l
 	}
 
 	output, err := b.client.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
-		ModelId:     ptr.String(string(b.model)),
+		ModelId:     ptr.String(string(model)),
 		Body:        requestBody,
 		ContentType: ptr.String("application/json"),
 	})
@@ -124,6 +199,10 @@ func (b *BedrockLLM) Chat(ctx context.Context, messages []llm.Message, opts ...l
 		return nil, handleBedrockError("Chat", err)
 	}
 
+	if options.RawResponse != nil {
+		*options.RawResponse = append((*options.RawResponse)[:0], output.Body...)
+	}
+
 	var resp anthropicResponse
 	if err := json.Unmarshal(output.Body, &resp); err != nil {
 		return nil, &llm.LLMError{
@@ -138,10 +217,15 @@ func (b *BedrockLLM) Chat(ctx context.Context, messages []llm.Message, opts ...l
 		content = resp.Completion // fallback for older API versions
 	}
 
-	return &llm.Message{
-		Role:    llm.RoleAssistant,
-		Content: content,
-	}, nil
+	message := &llm.Message{
+		Role:       llm.RoleAssistant,
+		Content:    content,
+		StopReason: stopReason(resp.StopReason),
+	}
+	message.SetFinishReason(resp.StopReason)
+	message.SetModel(servedModel(model, resp.Model))
+	b.postprocess(message)
+	return message, nil
 }
 
 func (b *BedrockLLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
@@ -154,16 +238,16 @@ func (b *BedrockLLM) ChatStream(ctx context.Context, messages []llm.Message, opt
 		opt(options)
 	}
 
-	responseChan := make(chan llm.StreamResponse)
+	model := LLMModelID(options.ModelOr(string(b.model)))
 
 	var requestBody []byte
 	var err error
 
-	switch b.model {
+	switch model {
 	case Claude2, Claude2Instant, Claude3:
 		anthropicReq := anthropicRequest{
-			Messages:         convertToAnthropicMessages(messages),
-			MaxTokens:        options.MaxTokens,
+			Messages:         convertToAnthropicMessages(b.preprocess(messages), b.functionStrategy),
+			MaxTokens:        options.MaxTokensFor(string(model)),
 			Temperature:      options.Temperature,
 			TopP:             options.TopP,
 			StopSequences:    options.Stop,
@@ -171,13 +255,23 @@ func (b *BedrockLLM) ChatStream(ctx context.Context, messages []llm.Message, opt
 			Stream:           true,
 		}
 		requestBody, err = json.Marshal(anthropicReq)
-		if err != nil {
-			return nil, &llm.LLMError{
-				Op:      "ChatStream",
-				Message: "failed to marshal request",
-				Err:     err,
-			}
-		}
+	case Titan:
+		requestBody, err = json.Marshal(titanRequest{
+			InputText: titanPrompt(b.preprocess(messages), b.functionStrategy),
+			TextGenerationConfig: titanTextGenerationConfig{
+				MaxTokenCount: options.MaxTokensFor(string(model)),
+				Temperature:   options.Temperature,
+				TopP:          options.TopP,
+				StopSequences: options.Stop,
+			},
+		})
+	case LLama2_70B, LLama2_13B, LLama2_70B_Chat, LLama2_13B_Chat:
+		requestBody, err = json.Marshal(llamaRequest{
+			Prompt:      llamaPrompt(b.preprocess(messages), b.functionStrategy),
+			MaxGenLen:   options.MaxTokensFor(string(model)),
+			Temperature: options.Temperature,
+			TopP:        options.TopP,
+		})
 	default:
 		return nil, &llm.LLMError{
 			Op:      "ChatStream",
@@ -185,8 +279,16 @@ func (b *BedrockLLM) ChatStream(ctx context.Context, messages []llm.Message, opt
 		}
 	}
 
+	if err != nil {
+		return nil, &llm.LLMError{
+			Op:      "ChatStream",
+			Message: "failed to marshal request",
+			Err:     err,
+		}
+	}
+
 	output, err := b.client.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
-		ModelId:     ptr.String(string(b.model)),
+		ModelId:     ptr.String(string(model)),
 		Body:        requestBody,
 		ContentType: ptr.String("application/json"),
 	})
@@ -194,74 +296,116 @@ func (b *BedrockLLM) ChatStream(ctx context.Context, messages []llm.Message, opt
 		return nil, handleBedrockError("ChatStream", err)
 	}
 
-	go func() {
-		defer close(responseChan)
+	writer, responseChan := llm.NewStreamWriter(ctx, options)
+	go b.readStream(ctx, model, output.GetStream(), writer)
 
-		stream := output.GetStream()
-		defer stream.Close()
+	return responseChan, nil
+}
+
+// eventStream is the part of the Bedrock response stream ChatStream reads
+type eventStream interface {
+	Events() <-chan types.ResponseStream
+	Close() error
+	Err() error
+}
 
-		for event := range stream.Events() {
-			select {
-			case <-ctx.Done():
-				responseChan <- llm.StreamResponse{
+// readStream sends the chunks of requested's stream to writer until the model
+// stops, the stream fails or goes idle, or ctx is done. It closes the stream,
+// which releases the connection, and the writer in every case.
+func (b *BedrockLLM) readStream(ctx context.Context, requested LLMModelID, stream eventStream, writer *llm.StreamWriter) {
+	defer writer.Close()
+	defer stream.Close()
+
+	var idle <-chan time.Time
+	var timer *time.Timer
+	if b.streamIdleTimeout > 0 {
+		timer = time.NewTimer(b.streamIdleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	var model string
+	events := stream.Events()
+	for {
+		select {
+		case <-ctx.Done():
+			writer.Send(llm.StreamResponse{
+				Error: &llm.LLMError{
+					Op:      "ChatStream",
+					Message: "context cancelled",
+					Err:     ctx.Err(),
+				},
+				Done: true,
+			})
+			return
+		case <-idle:
+			writer.Send(llm.StreamResponse{
+				Error: &llm.LLMError{
+					Op:      "ChatStream",
+					Message: "no event received within " + b.streamIdleTimeout.String(),
+					Err:     llm.ErrStreamIdleTimeout,
+				},
+				Done: true,
+			})
+			return
+		case event, ok := <-events:
+			if !ok {
+				if err := stream.Err(); err != nil {
+					writer.Send(llm.StreamResponse{
+						Error: &llm.LLMError{
+							Op:      "ChatStream",
+							Message: "stream error",
+							Err:     err,
+						},
+						Done: true,
+					})
+				}
+				return
+			}
+			if timer != nil {
+				timer.Reset(b.streamIdleTimeout)
+			}
+
+			chunk, ok := event.(*types.ResponseStreamMemberChunk)
+			if !ok {
+				continue
+			}
+			resp, err := decodeStreamChunk(requested, chunk.Value.Bytes)
+			if err != nil {
+				writer.Send(llm.StreamResponse{
 					Error: &llm.LLMError{
 						Op:      "ChatStream",
-						Message: "context cancelled",
-						Err:     ctx.Err(),
+						Message: "failed to unmarshal chunk",
+						Err:     err,
 					},
 					Done: true,
-				}
+				})
 				return
-			default:
-				if chunk, ok := event.(*types.ResponseStreamMemberChunk); ok {
-					var resp anthropicResponse
-					if err := json.Unmarshal(chunk.Value.Bytes, &resp); err != nil {
-						responseChan <- llm.StreamResponse{
-							Error: &llm.LLMError{
-								Op:      "ChatStream",
-								Message: "failed to unmarshal chunk",
-								Err:     err,
-							},
-							Done: true,
-						}
-						return
-					}
-
-					content := resp.Content
-					if content == "" {
-						content = resp.Completion // fallback for older API versions
-					}
-
-					responseChan <- llm.StreamResponse{
-						Message: llm.Message{
-							Role:    llm.RoleAssistant,
-							Content: content,
-						},
-						Done: false,
-					}
-
-					if resp.StopReason != "" {
-						responseChan <- llm.StreamResponse{Done: true}
-						return
-					}
-				}
 			}
-		}
 
-		if err := stream.Err(); err != nil {
-			responseChan <- llm.StreamResponse{
-				Error: &llm.LLMError{
-					Op:      "ChatStream",
-					Message: "stream error",
-					Err:     err,
+			if !writer.Send(llm.StreamResponse{
+				Message: llm.Message{
+					Role:    llm.RoleAssistant,
+					Content: resp.Content,
 				},
-				Done: true,
+				Done: false,
+			}) {
+				return
 			}
-			return
-		}
-	}()
 
-	return responseChan, nil
+			if resp.Model != "" {
+				model = resp.Model
+			}
+			if resp.StopReason != "" {
+				message := llm.Message{StopReason: stopReason(resp.StopReason)}
+				message.SetFinishReason(resp.StopReason)
+				message.SetModel(servedModel(requested, model))
+				b.postprocess(&message)
+				writer.Send(llm.StreamResponse{Message: message, Done: true})
+				return
+			}
+		}
+	}
 }
 
 func (b *BedrockLLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
@@ -280,6 +424,31 @@ func (b *BedrockLLM) Complete(ctx context.Context, prompt string, opts ...llm.Op
 	return resp.Content, nil
 }
 
+// servedModel returns the model a response names, or the requested model for
+// responses that don't name one
+func servedModel(requested LLMModelID, model string) string {
+	if model == "" {
+		return string(requested)
+	}
+	return model
+}
+
+// stopReason normalizes an Anthropic, Titan or Llama stop reason
+func stopReason(reason string) llm.StopReason {
+	switch reason {
+	case "end_turn", "stop_sequence", "FINISH", "STOP_CRITERIA_MET", "stop":
+		return llm.StopReasonStop
+	case "max_tokens", "LENGTH", "length":
+		return llm.StopReasonLength
+	case "CONTENT_FILTERED":
+		return llm.StopReasonContentFilter
+	case "tool_use":
+		return llm.StopReasonToolCalls
+	default:
+		return ""
+	}
+}
+
 func handleBedrockError(op string, err error) error {
 	if err == nil {
 		return nil
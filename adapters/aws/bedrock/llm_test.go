@@ -0,0 +1,431 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+func TestConvertToAnthropicMessages(t *testing.T) {
+	messages := []llm.Message{
+		{Role: llm.RoleUser, Content: "What's the weather in Lima?"},
+		{Role: llm.RoleFunction, Name: "get_weather", Content: `{"temp":22}`},
+	}
+
+	tests := []struct {
+		name     string
+		opts     []LLMOption
+		wantRole []string
+	}{
+		{
+			name:     "Defaults to inlining as user",
+			wantRole: []string{"user", "user"},
+		},
+		{
+			name:     "Labeled assistant",
+			opts:     []LLMOption{WithFunctionMessageStrategy(llm.InlineAsAssistantWithLabel)},
+			wantRole: []string{"user", "assistant"},
+		},
+		{
+			name:     "Dropped",
+			opts:     []LLMOption{WithFunctionMessageStrategy(llm.DropFunctionMessages)},
+			wantRole: []string{"user"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBedrockLLM(nil, Claude3, tt.opts...)
+			got := convertToAnthropicMessages(messages, b.functionStrategy)
+			if len(got) != len(tt.wantRole) {
+				t.Fatalf("convertToAnthropicMessages() returned %d messages, want %d", len(got), len(tt.wantRole))
+			}
+			for i, role := range tt.wantRole {
+				if got[i].Role != role {
+					t.Errorf("message %d role = %q, want %q", i, got[i].Role, role)
+				}
+			}
+		})
+	}
+}
+
+func TestBedrockLLM_ChatCapturesRawResponse(t *testing.T) {
+	const body = `{"type":"message","content":"hi","stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+
+	var raw json.RawMessage
+	message, err := NewBedrockLLM(client, Claude3).Chat(context.Background(),
+		[]llm.Message{{Role: llm.RoleUser, Content: "hello"}},
+		llm.WithCaptureRaw(&raw),
+	)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if message.Content != "hi" {
+		t.Errorf("Chat() content = %q, want %q", message.Content, "hi")
+	}
+	if message.FinishReason() != "end_turn" || message.Model() != string(Claude3) {
+		t.Errorf("Chat() finish reason = %q, model = %q, want end_turn from %s", message.FinishReason(), message.Model(), Claude3)
+	}
+	if string(raw) != body {
+		t.Errorf("captured raw response = %s, want %s", raw, body)
+	}
+}
+
+func TestBedrockLLM_ChatWithModel(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":"hi","stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	client := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+	b := NewBedrockLLM(client, Claude2)
+	messages := []llm.Message{{Role: llm.RoleUser, Content: "hello"}}
+
+	message, err := b.Chat(context.Background(), messages, llm.WithModel(string(Claude3)))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if !strings.Contains(path, string(Claude3)) {
+		t.Errorf("Chat() invoked %s, want model %s", path, Claude3)
+	}
+	if message.Model() != string(Claude3) {
+		t.Errorf("Chat() model = %q, want %q", message.Model(), Claude3)
+	}
+
+	path = ""
+	if _, err := b.Chat(context.Background(), messages, llm.WithModel("unknown.model-v1")); err == nil {
+		t.Error("Chat() with an unknown model succeeded, want an unsupported model error")
+	}
+	if path != "" {
+		t.Errorf("Chat() with an unknown model invoked %s", path)
+	}
+}
+
+// stalledStream is an event stream that sends the given events, then nothing
+// until it is closed
+type stalledStream struct {
+	events chan types.ResponseStream
+	closed chan struct{}
+}
+
+func newStalledStream(chunks ...string) *stalledStream {
+	s := &stalledStream{
+		events: make(chan types.ResponseStream, len(chunks)),
+		closed: make(chan struct{}),
+	}
+	for _, chunk := range chunks {
+		s.events <- &types.ResponseStreamMemberChunk{Value: types.PayloadPart{Bytes: []byte(chunk)}}
+	}
+	return s
+}
+
+func (s *stalledStream) Events() <-chan types.ResponseStream { return s.events }
+func (s *stalledStream) Err() error                          { return nil }
+
+func (s *stalledStream) Close() error {
+	close(s.closed)
+	return nil
+}
+
+// collectWithin collects the stream, failing the test if it isn't closed in time
+func collectWithin(t *testing.T, responses <-chan llm.StreamResponse, timeout time.Duration) []llm.StreamResponse {
+	t.Helper()
+	var got []llm.StreamResponse
+	deadline := time.After(timeout)
+	for {
+		select {
+		case resp, ok := <-responses:
+			if !ok {
+				return got
+			}
+			got = append(got, resp)
+		case <-deadline:
+			t.Fatalf("stream not closed within %v, got %v", timeout, got)
+		}
+	}
+}
+
+func TestBedrockLLM_ReadStreamStalled(t *testing.T) {
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		cancelAfter time.Duration
+		wantErr     error
+	}{
+		{
+			name:        "Cancellation while waiting for an event",
+			idleTimeout: 0,
+			cancelAfter: 20 * time.Millisecond,
+			wantErr:     context.Canceled,
+		},
+		{
+			name:        "Idle timeout",
+			idleTimeout: 20 * time.Millisecond,
+			wantErr:     llm.ErrStreamIdleTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelAfter > 0 {
+				time.AfterFunc(tt.cancelAfter, cancel)
+			}
+
+			b := NewBedrockLLM(nil, Claude3, WithStreamIdleTimeout(tt.idleTimeout))
+			stream := newStalledStream(`{"type":"content_block_delta","content":"hel"}`)
+			writer, responses := llm.NewStreamWriter(ctx, &llm.ChatOptions{})
+			go b.readStream(ctx, b.model, stream, writer)
+
+			got := collectWithin(t, responses, time.Second)
+			if len(got) != 2 || got[0].Message.Content != "hel" {
+				t.Fatalf("responses = %v, want the chunk then an error", got)
+			}
+			if err := got[1].Error; !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			var llmErr *llm.LLMError
+			if !errors.As(got[1].Error, &llmErr) || !got[1].Done {
+				t.Errorf("last response = %+v, want a final *llm.LLMError", got[1])
+			}
+
+			select {
+			case <-stream.closed:
+			default:
+				t.Error("event stream not closed")
+			}
+		})
+	}
+}
+
+func TestBedrockLLM_MessagePreprocessor(t *testing.T) {
+	var sent []anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		sent = append(sent, req)
+		if req.Stream {
+			// Only the request matters; fail the stream before it starts
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":"ok","stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	client := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+		RetryMaxAttempts: 1,
+	})
+	redact := WithMessagePreprocessor(func(messages []llm.Message) []llm.Message {
+		for i := range messages {
+			messages[i].Content = strings.ReplaceAll(messages[i].Content, "555-0100", "[PHONE]")
+		}
+		return messages
+	})
+	b := NewBedrockLLM(client, Claude3, redact)
+
+	messages := []llm.Message{{Role: llm.RoleUser, Content: "Call me at 555-0100"}}
+	if _, err := b.Chat(context.Background(), messages); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	b.ChatStream(context.Background(), messages)
+
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	for i, req := range sent {
+		if len(req.Messages) != 1 || req.Messages[0].Content != "Call me at [PHONE]" {
+			t.Errorf("request %d messages = %+v, want the redacted message", i, req.Messages)
+		}
+	}
+	if messages[0].Content != "Call me at 555-0100" {
+		t.Errorf("caller's message = %q, want it unchanged", messages[0].Content)
+	}
+}
+
+func TestBedrockLLM_ResponsePostprocessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type":"message","content":"As an AI model, the answer is 42.","stop_reason":"end_turn"}`))
+	}))
+	defer server.Close()
+
+	client := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+	stripBoilerplate := WithResponsePostprocessor(func(m *llm.Message) {
+		m.Content = strings.TrimPrefix(m.Content, "As an AI model, ")
+	})
+	mark := WithResponsePostprocessor(func(m *llm.Message) {
+		m.Metadata = map[string]interface{}{"postprocessed": true}
+	})
+	b := NewBedrockLLM(client, Claude3, stripBoilerplate, mark)
+
+	message, err := b.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if message.Content != "the answer is 42." || message.Metadata["postprocessed"] != true {
+		t.Errorf("Chat() = %q, metadata %v, want the postprocessed message", message.Content, message.Metadata)
+	}
+
+	writer, responses := llm.NewStreamWriter(context.Background(), &llm.ChatOptions{})
+	go b.readStream(context.Background(), b.model, newStalledStream(
+		`{"type":"content_block_delta","content":"42"}`,
+		`{"type":"message_delta","stop_reason":"end_turn"}`,
+	), writer)
+	got := collectWithin(t, responses, time.Second)
+	last := got[len(got)-1]
+	if !last.Done || last.Message.Metadata["postprocessed"] != true {
+		t.Errorf("final response = %+v, want the postprocessed final message", last)
+	}
+	if got[0].Message.Metadata != nil {
+		t.Errorf("delta metadata = %v, want deltas left alone", got[0].Message.Metadata)
+	}
+}
+
+func TestBedrockLLM_ReadStreamModelChunks(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      LLMModelID
+		chunks     []string
+		wantStop   llm.StopReason
+		wantFinish string
+	}{
+		{
+			name:  "Titan",
+			model: Titan,
+			chunks: []string{
+				`{"outputText":"The sky","index":0,"totalOutputTextTokenCount":2,"completionReason":null,"inputTextTokenCount":5}`,
+				`{"outputText":" is blue.","index":0,"totalOutputTextTokenCount":5,"completionReason":"FINISH"}`,
+			},
+			wantStop:   llm.StopReasonStop,
+			wantFinish: "FINISH",
+		},
+		{
+			name:  "Llama",
+			model: LLama2_13B_Chat,
+			chunks: []string{
+				`{"generation":"The sky","prompt_token_count":12,"generation_token_count":2,"stop_reason":null}`,
+				`{"generation":" is blue.","prompt_token_count":null,"generation_token_count":5,"stop_reason":"length"}`,
+			},
+			wantStop:   llm.StopReasonLength,
+			wantFinish: "length",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBedrockLLM(nil, tt.model)
+			writer, responses := llm.NewStreamWriter(context.Background(), &llm.ChatOptions{})
+			go b.readStream(context.Background(), b.model, newStalledStream(tt.chunks...), writer)
+
+			got := collectWithin(t, responses, time.Second)
+			if len(got) != 3 {
+				t.Fatalf("responses = %+v, want two deltas and the final message", got)
+			}
+			if content := got[0].Message.Content + got[1].Message.Content; content != "The sky is blue." {
+				t.Errorf("streamed content = %q, want %q", content, "The sky is blue.")
+			}
+			last := got[2]
+			if !last.Done || last.Error != nil || last.Message.StopReason != tt.wantStop {
+				t.Errorf("final response = %+v, want stop reason %q", last, tt.wantStop)
+			}
+			if last.Message.FinishReason() != tt.wantFinish || last.Message.Model() != string(tt.model) {
+				t.Errorf("finish reason = %q, model = %q, want %q from %s", last.Message.FinishReason(), last.Message.Model(), tt.wantFinish, tt.model)
+			}
+		})
+	}
+}
+
+func TestBedrockLLM_ChatStreamRequests(t *testing.T) {
+	var sent []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		sent = append(sent, req)
+		// Only the request matters; fail the stream before it starts
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := bedrockruntime.New(bedrockruntime.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+		RetryMaxAttempts: 1,
+	})
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "Hi"},
+		{Role: llm.RoleAssistant, Content: "Hello!"},
+		{Role: llm.RoleUser, Content: "What color is the sky?"},
+	}
+
+	NewBedrockLLM(client, Titan).ChatStream(context.Background(), messages, llm.WithMaxTokens(100))
+	NewBedrockLLM(client, LLama2_70B_Chat).ChatStream(context.Background(), messages, llm.WithMaxTokens(100))
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+
+	wantTitan := "Be brief.\n\nUser: Hi\nBot: Hello!\nUser: What color is the sky?\nBot:"
+	config, _ := sent[0]["textGenerationConfig"].(map[string]any)
+	if sent[0]["inputText"] != wantTitan || config["maxTokenCount"] != float64(100) {
+		t.Errorf("Titan request = %v, want inputText %q and maxTokenCount 100", sent[0], wantTitan)
+	}
+
+	wantLlama := "<s>[INST] <<SYS>>\nBe brief.\n<</SYS>>\n\nHi [/INST] Hello! </s><s>[INST] What color is the sky? [/INST]"
+	if sent[1]["prompt"] != wantLlama || sent[1]["max_gen_len"] != float64(100) {
+		t.Errorf("Llama request = %v, want prompt %q and max_gen_len 100", sent[1], wantLlama)
+	}
+}
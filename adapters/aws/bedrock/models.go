@@ -0,0 +1,135 @@
+package bedrock
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+type titanTextGenerationConfig struct {
+	MaxTokenCount int      `json:"maxTokenCount"`
+	Temperature   float32  `json:"temperature"`
+	TopP          float32  `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type titanRequest struct {
+	InputText            string                    `json:"inputText"`
+	TextGenerationConfig titanTextGenerationConfig `json:"textGenerationConfig"`
+}
+
+// titanStreamChunk is a chunk of a Titan response stream
+type titanStreamChunk struct {
+	OutputText       string `json:"outputText"`
+	CompletionReason string `json:"completionReason,omitempty"`
+}
+
+type llamaRequest struct {
+	Prompt      string  `json:"prompt"`
+	MaxGenLen   int     `json:"max_gen_len"`
+	Temperature float32 `json:"temperature"`
+	TopP        float32 `json:"top_p,omitempty"`
+}
+
+// llamaStreamChunk is a chunk of a Llama response stream
+type llamaStreamChunk struct {
+	Generation string `json:"generation"`
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// titanPrompt renders messages as the User/Bot transcript Titan text models
+// are tuned on, ending with the turn for the model to complete
+func titanPrompt(messages []llm.Message, strategy llm.FunctionMessageStrategy) string {
+	var prompt strings.Builder
+	for _, msg := range llm.ConvertFunctionMessages(messages, strategy) {
+		switch msg.Role {
+		case llm.RoleSystem:
+			prompt.WriteString(msg.Content + "\n\n")
+		case llm.RoleAssistant:
+			prompt.WriteString("Bot: " + msg.Content + "\n")
+		default:
+			prompt.WriteString("User: " + msg.Content + "\n")
+		}
+	}
+	prompt.WriteString("Bot:")
+	return prompt.String()
+}
+
+// llamaPrompt renders messages in the [INST] format of Llama 2 chat models,
+// with system messages in a <<SYS>> block of the first instruction
+func llamaPrompt(messages []llm.Message, strategy llm.FunctionMessageStrategy) string {
+	var system []string
+	var turns []llm.Message
+	for _, msg := range llm.ConvertFunctionMessages(messages, strategy) {
+		if msg.Role == llm.RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		turns = append(turns, msg)
+	}
+
+	var prompt strings.Builder
+	open := false
+	for _, msg := range turns {
+		if msg.Role == llm.RoleAssistant {
+			if open {
+				prompt.WriteString(" [/INST] ")
+				open = false
+			}
+			prompt.WriteString(msg.Content + " </s>")
+			continue
+		}
+
+		if open {
+			prompt.WriteString("\n\n" + msg.Content)
+			continue
+		}
+		prompt.WriteString("<s>[INST] ")
+		if len(system) > 0 {
+			prompt.WriteString("<<SYS>>\n" + strings.Join(system, "\n") + "\n<</SYS>>\n\n")
+			system = nil
+		}
+		prompt.WriteString(msg.Content)
+		open = true
+	}
+	if open {
+		prompt.WriteString(" [/INST]")
+	}
+	return prompt.String()
+}
+
+// streamChunk is a chunk of a response stream of any supported model
+type streamChunk struct {
+	Content    string
+	StopReason string // Empty until the last chunk
+	Model      string // Only sent by some models
+}
+
+// decodeStreamChunk decodes a chunk of model's response stream
+func decodeStreamChunk(model LLMModelID, data []byte) (streamChunk, error) {
+	switch model {
+	case Titan:
+		var resp titanStreamChunk
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return streamChunk{}, err
+		}
+		return streamChunk{Content: resp.OutputText, StopReason: resp.CompletionReason}, nil
+	case LLama2_70B, LLama2_13B, LLama2_70B_Chat, LLama2_13B_Chat:
+		var resp llamaStreamChunk
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return streamChunk{}, err
+		}
+		return streamChunk{Content: resp.Generation, StopReason: resp.StopReason}, nil
+	default:
+		var resp anthropicResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return streamChunk{}, err
+		}
+		content := resp.Content
+		if content == "" {
+			content = resp.Completion // fallback for older API versions
+		}
+		return streamChunk{Content: content, StopReason: resp.StopReason, Model: resp.Model}, nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"path/filepath"
+	"strings"
 
 	"github.com/Abraxas-365/kbservice/datasource"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -69,13 +70,18 @@ func (s *S3Source) Load(ctx context.Context, opts ...datasource.Option) ([]datas
 				"etag":          *obj.ETag,
 			}
 
+			options.ApplyStaticMetadata(metadata)
+
 			if options.Filter != nil && !options.Filter(metadata) {
 				continue
 			}
 
-			content, err := s.getObjectContent(ctx, *obj.Key)
-			if err != nil {
-				return nil, err
+			var content string
+			if !options.SkipContent {
+				content, err = s.getObjectContent(ctx, *obj.Key)
+				if err != nil {
+					return nil, err
+				}
 			}
 
 			doc := datasource.Document{
@@ -92,46 +98,70 @@ func (s *S3Source) Load(ctx context.Context, opts ...datasource.Option) ([]datas
 }
 
 func (s *S3Source) getObjectContent(ctx context.Context, key string) (string, error) {
-	input := &s3.GetObjectInput{
-		Bucket: &s.bucket,
-		Key:    &key,
+	body, err := s.openObject(ctx, "getObjectContent", key)
+	if err != nil {
+		return "", err
 	}
+	defer body.Close()
 
-	result, err := s.client.GetObject(ctx, input)
+	content, err := io.ReadAll(body)
 	if err != nil {
 		return "", &datasource.DataSourceError{
 			Source:  "s3",
 			Op:      "getObjectContent",
 			Err:     err,
 			Code:    datasource.ErrCodeInternal,
-			Message: "failed to get object content",
+			Message: "failed to read object content",
 		}
 	}
-	defer result.Body.Close()
 
-	content, err := io.ReadAll(result.Body)
+	return string(content), nil
+}
+
+func (s *S3Source) openObject(ctx context.Context, op string, key string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	}
+
+	result, err := s.client.GetObject(ctx, input)
 	if err != nil {
-		return "", &datasource.DataSourceError{
+		return nil, &datasource.DataSourceError{
 			Source:  "s3",
-			Op:      "getObjectContent",
+			Op:      op,
 			Err:     err,
 			Code:    datasource.ErrCodeInternal,
-			Message: "failed to read object content",
+			Message: "failed to get object content",
 		}
 	}
 
-	return string(content), nil
+	return result.Body, nil
 }
 
-func (s *S3Source) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
-	docChan := make(chan datasource.Document)
-	errChan := make(chan error, 1) // buffered channel for error
+// StreamContent opens the object behind a document source of the form s3://bucket/key
+func (s *S3Source) StreamContent(ctx context.Context, source string) (io.ReadCloser, error) {
+	prefix := "s3://" + s.bucket + "/"
+	if !strings.HasPrefix(source, prefix) {
+		return nil, &datasource.DataSourceError{
+			Source:  "s3",
+			Op:      "StreamContent",
+			Code:    datasource.ErrCodeInvalidSource,
+			Message: "source does not belong to bucket " + s.bucket + ": " + source,
+		}
+	}
+
+	return s.openObject(ctx, "StreamContent", strings.TrimPrefix(source, prefix))
+}
 
+func (s *S3Source) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
 	options := &datasource.LoadOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	docChan := make(chan datasource.Document, options.StreamBuffer)
+	errChan := make(chan error, 1) // buffered channel for error
+
 	go func() {
 		defer close(docChan)
 		defer close(errChan)
@@ -184,14 +214,19 @@ func (s *S3Source) Stream(ctx context.Context, opts ...datasource.Option) (<-cha
 					"etag":          *obj.ETag,
 				}
 
+				options.ApplyStaticMetadata(metadata)
+
 				if options.Filter != nil && !options.Filter(metadata) {
 					continue
 				}
 
-				content, err := s.getObjectContent(ctx, *obj.Key)
-				if err != nil {
-					errChan <- err
-					return
+				var content string
+				if !options.SkipContent {
+					content, err = s.getObjectContent(ctx, *obj.Key)
+					if err != nil {
+						errChan <- err
+						return
+					}
 				}
 
 				doc := datasource.Document{
@@ -0,0 +1,83 @@
+package s3source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newTestSource returns an S3Source over a stub S3 endpoint holding two
+// objects under docs, whose content is their key
+func newTestSource(t *testing.T) *S3Source {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<ListBucketResult>` +
+				`<Contents><Key>docs/a.txt</Key><LastModified>2024-01-01T00:00:00Z</LastModified><ETag>"a"</ETag><Size>10</Size></Contents>` +
+				`<Contents><Key>docs/b.txt</Key><LastModified>2024-01-01T00:00:00Z</LastModified><ETag>"b"</ETag><Size>10</Size></Contents>` +
+				`<IsTruncated>false</IsTruncated></ListBucketResult>`))
+			return
+		}
+		w.Write([]byte(strings.TrimPrefix(r.URL.Path, "/test-bucket/")))
+	}))
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	return NewS3Source(client, "test-bucket", "docs")
+}
+
+func TestS3Source_StreamStaticMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		override bool
+		wantETag bool
+	}{
+		{name: "Source keys take precedence", wantETag: true},
+		{name: "Override", override: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestSource(t)
+
+			docChan, errChan := source.Stream(context.Background(),
+				datasource.WithStaticMetadata(map[string]interface{}{"team": "docs", "etag": "static"}),
+				datasource.WithStaticMetadataOverride(tt.override),
+			)
+
+			count := 0
+			for doc := range docChan {
+				count++
+				if doc.Content != doc.Metadata["key"] {
+					t.Errorf("document %s content = %q", doc.Source, doc.Content)
+				}
+				if doc.Metadata["team"] != "docs" {
+					t.Errorf("document %s metadata = %v, want team docs", doc.Source, doc.Metadata)
+				}
+				if got := doc.Metadata["etag"] != "static"; got != tt.wantETag {
+					t.Errorf("document %s etag = %v, want the object's etag %v", doc.Source, doc.Metadata["etag"], tt.wantETag)
+				}
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if count != 2 {
+				t.Errorf("Stream() = %d documents, want 2", count)
+			}
+		})
+	}
+}
@@ -1,15 +1,24 @@
 package s3
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/Abraxas-365/kbservice/storage"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
 )
 
 type S3Store struct {
@@ -32,6 +41,21 @@ func (s *S3Store) Put(ctx context.Context, key string, data io.Reader, options .
 		opt(opts)
 	}
 
+	// Sniff before compressing, so the type describes the original content
+	data, err := opts.ResolveContentType(key, data)
+	if err != nil {
+		return err
+	}
+
+	if opts.Gzip {
+		compressed, err := compressBody(opts, key, data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+		opts.ContentEncoding = gzipEncoding
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
@@ -58,8 +82,28 @@ func (s *S3Store) Put(ctx context.Context, key string, data io.Reader, options .
 		input.Metadata = opts.Metadata
 	}
 
-	_, err := s.client.PutObject(ctx, input)
+	if opts.SSEKMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+	}
+
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+
+	if opts.ContentMD5 != nil {
+		input.ContentMD5 = aws.String(base64.StdEncoding.EncodeToString(opts.ContentMD5))
+	}
+
+	if opts.ChecksumSHA256 != "" {
+		input.ChecksumSHA256 = aws.String(opts.ChecksumSHA256)
+	}
+
+	_, err = s.client.PutObject(ctx, input)
 	if err != nil {
+		if isChecksumMismatch(err) {
+			return storage.NewStorageError("Put", key, err, storage.ErrCodeIntegrity, "checksum mismatch")
+		}
 		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to put object")
 	}
 
@@ -67,37 +111,225 @@ func (s *S3Store) Put(ctx context.Context, key string, data io.Reader, options .
 }
 
 func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.getObject(ctx, "Get", key, "")
+}
+
+// GetVersion returns a specific version of the object. An empty versionID gets
+// the latest version.
+func (s *S3Store) GetVersion(ctx context.Context, key, versionID string) (io.ReadCloser, error) {
+	return s.getObject(ctx, "GetVersion", key, versionID)
+}
+
+func (s *S3Store) getObject(ctx context.Context, op, key, versionID string) (io.ReadCloser, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
 	result, err := s.client.GetObject(ctx, input)
 	if err != nil {
-		var nsk *types.NoSuchKey
-		if err != nil && errors.As(err, &nsk) {
-			return nil, storage.NewStorageError("Get", key, err, storage.ErrCodeNotFound, "object not found")
+		if isNotFound(err) {
+			return nil, storage.NewStorageError(op, key, err, storage.ErrCodeNotFound, "object not found")
 		}
-		return nil, storage.NewStorageError("Get", key, err, storage.ErrCodeInternal, "failed to get object")
+		return nil, storage.NewStorageError(op, key, err, storage.ErrCodeInternal, "failed to get object")
+	}
+
+	if aws.ToString(result.ContentEncoding) == gzipEncoding {
+		gz, err := gzip.NewReader(result.Body)
+		if err != nil {
+			result.Body.Close()
+			return nil, storage.NewStorageError(op, key, err, storage.ErrCodeInternal, "failed to decompress object")
+		}
+		return &gzipReadCloser{Reader: gz, body: result.Body}, nil
 	}
 
 	return result.Body, nil
 }
 
+// gzipEncoding is the Content-Encoding of objects stored with storage.WithGzip
+const gzipEncoding = "gzip"
+
+// compressBody gzips data into memory so the SDK gets a seekable body with a known length.
+// Caller checksums describe the uncompressed data, so they are verified here and
+// replaced with checksums of the compressed body for S3 to verify.
+func compressBody(opts *storage.PutOptions, key string, data io.Reader) (io.ReadSeeker, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	if opts.ContentMD5 != nil || opts.ChecksumSHA256 != "" {
+		if err := opts.VerifyChecksums("Put", key, io.TeeReader(data, gz)); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.Copy(gz, data); err != nil {
+		return nil, storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to compress object")
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to compress object")
+	}
+
+	if opts.ContentMD5 != nil {
+		sum := md5.Sum(buf.Bytes())
+		opts.ContentMD5 = sum[:]
+	}
+	if opts.ChecksumSHA256 != "" {
+		sum := sha256.Sum256(buf.Bytes())
+		opts.ChecksumSHA256 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
+
+// gzipReadCloser decompresses an object body and closes it along with the reader
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	gzErr := r.Reader.Close()
+	if err := r.body.Close(); err != nil {
+		return err
+	}
+	return gzErr
+}
+
 func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return s.deleteObject(ctx, "Delete", key, "")
+}
+
+// DeleteVersion permanently removes a specific version of the object. An empty
+// versionID deletes the latest version, which in a versioned bucket only adds a
+// delete marker.
+func (s *S3Store) DeleteVersion(ctx context.Context, key, versionID string) error {
+	return s.deleteObject(ctx, "DeleteVersion", key, versionID)
+}
+
+func (s *S3Store) deleteObject(ctx context.Context, op, key, versionID string) error {
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
 	_, err := s.client.DeleteObject(ctx, input)
 	if err != nil {
-		return storage.NewStorageError("Delete", key, err, storage.ErrCodeInternal, "failed to delete object")
+		return storage.NewStorageError(op, key, err, storage.ErrCodeInternal, "failed to delete object")
 	}
 
 	return nil
 }
 
+// maxDeleteBatch is the most keys S3 accepts in a single DeleteObjects call
+const maxDeleteBatch = 1000
+
+func (s *S3Store) DeleteMany(ctx context.Context, keys []string) error {
+	var failed []*storage.StorageError
+	for i := 0; i < len(keys); i += maxDeleteBatch {
+		if err := ctx.Err(); err != nil {
+			return storage.NewStorageError("DeleteMany", "", err, storage.ErrCodeInternal, "delete canceled")
+		}
+
+		end := i + maxDeleteBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		_, batchErrs, err := s.deleteBatch(ctx, "DeleteMany", keys[i:end])
+		if err != nil {
+			return err
+		}
+		failed = append(failed, batchErrs...)
+	}
+
+	if len(failed) > 0 {
+		return &storage.MultiDeleteError{Op: "DeleteMany", Errors: failed}
+	}
+
+	return nil
+}
+
+func (s *S3Store) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	deleted := 0
+	var failed []*storage.StorageError
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+	for paginator.HasMorePages() {
+		if err := ctx.Err(); err != nil {
+			return deleted, storage.NewStorageError("DeletePrefix", prefix, err, storage.ErrCodeInternal, "delete canceled")
+		}
+
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, storage.NewStorageError("DeletePrefix", prefix, err, storage.ErrCodeInternal, "failed to list objects")
+		}
+
+		keys := make([]string, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			keys = append(keys, *obj.Key)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		n, batchErrs, err := s.deleteBatch(ctx, "DeletePrefix", keys)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+		failed = append(failed, batchErrs...)
+	}
+
+	if len(failed) > 0 {
+		return deleted, &storage.MultiDeleteError{Op: "DeletePrefix", Errors: failed}
+	}
+
+	return deleted, nil
+}
+
+// deleteBatch removes up to maxDeleteBatch keys in one DeleteObjects call, returning
+// how many were deleted and the per-key failures reported by S3
+func (s *S3Store) deleteBatch(ctx context.Context, op string, keys []string) (int, []*storage.StorageError, error) {
+	objects := make([]types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	output, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return 0, nil, storage.NewStorageError(op, "", err, storage.ErrCodeInternal, "failed to delete objects")
+	}
+
+	failed := make([]*storage.StorageError, 0, len(output.Errors))
+	for _, e := range output.Errors {
+		code := storage.ErrCodeInternal
+		if aws.ToString(e.Code) == "AccessDenied" {
+			code = storage.ErrCodePermissionDenied
+		}
+		failed = append(failed, storage.NewStorageError(op, aws.ToString(e.Key), nil, code, aws.ToString(e.Message)))
+	}
+
+	return len(keys) - len(failed), failed, nil
+}
+
 func (s *S3Store) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(s.bucket),
@@ -127,6 +359,40 @@ func (s *S3Store) List(ctx context.Context, prefix string) ([]storage.ObjectInfo
 	return objects, nil
 }
 
+// ListVersions returns every version of the objects under prefix, newest first
+// for each key. Delete markers are not included.
+func (s *S3Store) ListVersions(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+
+	var objects []storage.ObjectInfo
+	for {
+		page, err := s.client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return nil, storage.NewStorageError("ListVersions", prefix, err, storage.ErrCodeInternal, "failed to list object versions")
+		}
+
+		for _, version := range page.Versions {
+			objects = append(objects, storage.ObjectInfo{
+				Key:          aws.ToString(version.Key),
+				Size:         aws.ToInt64(version.Size),
+				LastModified: aws.ToTime(version.LastModified),
+				ETag:         aws.ToString(version.ETag),
+				VersionID:    aws.ToString(version.VersionId),
+				IsLatest:     aws.ToBool(version.IsLatest),
+			})
+		}
+
+		if !aws.ToBool(page.IsTruncated) {
+			return objects, nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+}
+
 func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
 	input := &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -135,8 +401,7 @@ func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
 
 	_, err := s.client.HeadObject(ctx, input)
 	if err != nil {
-		var nsk *types.NoSuchKey
-		if errors.As(err, &nsk) {
+		if isNotFound(err) {
 			return false, nil
 		}
 		return false, storage.NewStorageError("Exists", key, err, storage.ErrCodeInternal, "failed to check object existence")
@@ -150,6 +415,10 @@ func (s *S3Store) GetPresignedPutURL(ctx context.Context, key string, expires ti
 	for _, opt := range options {
 		opt(opts)
 	}
+	if err := opts.EnforceAllowedExtensions("GetPresignedPutURL", key); err != nil {
+		return storage.PresignedURL{}, err
+	}
+	opts.ResolveContentType(key)
 
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -180,8 +449,20 @@ func (s *S3Store) GetPresignedPutURL(ctx context.Context, key string, expires ti
 		input.Metadata = opts.Metadata
 	}
 
-	presignedReq, err := s.presignClient.PresignPutObject(ctx, input,
-		s3.WithPresignExpires(expires))
+	if opts.SSEKMSKeyID != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+	}
+
+	if opts.StorageClass != "" {
+		input.StorageClass = types.StorageClass(opts.StorageClass)
+	}
+
+	presignOpts := []func(*s3.PresignOptions){s3.WithPresignExpires(expires)}
+	if opts.ContentType != "" {
+		presignOpts = append(presignOpts, signContentType)
+	}
+	presignedReq, err := s.presignClient.PresignPutObject(ctx, input, presignOpts...)
 	if err != nil {
 		return storage.PresignedURL{}, storage.NewStorageError("GetPresignedPutURL", key, err, storage.ErrCodeInternal, "failed to generate presigned URL")
 	}
@@ -201,6 +482,18 @@ func (s *S3Store) GetPresignedPutURL(ctx context.Context, key string, expires ti
 	}, nil
 }
 
+// signContentType keeps Content-Type in a presigned PUT. The SDK drops it
+// from requests without a content length, leaving uploads free to use any
+// content type.
+func signContentType(o *s3.PresignOptions) {
+	o.ClientOptions = append(o.ClientOptions, func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			_, err := stack.Build.Remove("RemoveContentTypeHeader")
+			return err
+		})
+	})
+}
+
 func (s *S3Store) GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (storage.PresignedURL, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -227,3 +520,46 @@ func (s *S3Store) GetPresignedGetURL(ctx context.Context, key string, expires ti
 		Headers: headers,
 	}, nil
 }
+
+// isNotFound reports whether err means the object does not exist. HeadObject
+// responses have no body, so S3 reports a missing key as a bare 404 "NotFound"
+// rather than the NoSuchKey error returned by GetObject.
+func isNotFound(err error) bool {
+	var nsk *types.NoSuchKey
+	if errors.As(err, &nsk) {
+		return true
+	}
+
+	var nf *types.NotFound
+	if errors.As(err, &nf) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey", "NoSuchVersion":
+			return true
+		}
+	}
+
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return true
+	}
+
+	return false
+}
+
+// isChecksumMismatch reports whether S3 rejected an upload because its content
+// didn't match the digest or checksum sent with it
+func isChecksumMismatch(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "BadDigest", "InvalidDigest", "XAmzContentChecksumMismatch", "XAmzContentSHA256Mismatch":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,665 @@
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newTestStore returns an S3Store backed by a stub S3 endpoint
+func newTestStore(t *testing.T, handler http.HandlerFunc) *S3Store {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	return NewS3Store(client, "test-bucket")
+}
+
+func TestS3Store_Exists(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantExists bool
+		wantErr    bool
+	}{
+		{
+			name:       "Present key",
+			status:     http.StatusOK,
+			wantExists: true,
+			wantErr:    false,
+		},
+		{
+			name:       "Missing key",
+			status:     http.StatusNotFound,
+			wantExists: false,
+			wantErr:    false,
+		},
+		{
+			name:       "Access denied",
+			status:     http.StatusForbidden,
+			wantExists: false,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead {
+					t.Errorf("unexpected method %s", r.Method)
+				}
+				// HeadObject responses never carry an error body
+				w.WriteHeader(tt.status)
+			})
+
+			exists, err := store.Exists(context.Background(), "docs/file.txt")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Exists() error = nil, wantErr true")
+				}
+				var storageErr *storage.StorageError
+				if !errors.As(err, &storageErr) {
+					t.Errorf("Exists() error = %T, want *storage.StorageError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exists() unexpected error = %v", err)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("Exists() = %v, want %v", exists, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestS3Store_Get(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode string
+	}{
+		{
+			name:     "NoSuchKey error body",
+			status:   http.StatusNotFound,
+			body:     `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`,
+			wantCode: storage.ErrCodeNotFound,
+		},
+		{
+			name:     "Bare 404",
+			status:   http.StatusNotFound,
+			wantCode: storage.ErrCodeNotFound,
+		},
+		{
+			name:     "Access denied",
+			status:   http.StatusForbidden,
+			body:     `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`,
+			wantCode: storage.ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := store.Get(context.Background(), "docs/file.txt")
+			if err == nil {
+				t.Fatal("Get() error = nil, want error")
+			}
+			var storageErr *storage.StorageError
+			if !errors.As(err, &storageErr) {
+				t.Fatalf("Get() error = %T, want *storage.StorageError", err)
+			}
+			if storageErr.Code != tt.wantCode {
+				t.Errorf("Get() error code = %v, want %v", storageErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestS3Store_PutEncryptionAndStorageClass(t *testing.T) {
+	var got http.Header
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	err := store.Put(context.Background(), "archive/file.txt", strings.NewReader("data"),
+		storage.WithSSE("arn:aws:kms:us-east-1:111122223333:key/test"),
+		storage.WithStorageClass("STANDARD_IA"),
+	)
+	if err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+
+	wantHeaders := map[string]string{
+		"X-Amz-Server-Side-Encryption":                "aws:kms",
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "arn:aws:kms:us-east-1:111122223333:key/test",
+		"X-Amz-Storage-Class":                         "STANDARD_IA",
+	}
+	for k, v := range wantHeaders {
+		if got.Get(k) != v {
+			t.Errorf("Put() header %s = %q, want %q", k, got.Get(k), v)
+		}
+	}
+}
+
+func TestS3Store_PutAutoContentType(t *testing.T) {
+	tests := map[string]string{
+		"site/index.html":  "text/html",
+		"data/report.json": "application/json",
+		"images/logo.png":  "image/png",
+	}
+
+	for key, want := range tests {
+		t.Run(key, func(t *testing.T) {
+			var got string
+			store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("Content-Type")
+				w.WriteHeader(http.StatusOK)
+			})
+
+			if err := store.Put(context.Background(), key, strings.NewReader("data"), storage.WithAutoContentType()); err != nil {
+				t.Fatalf("Put() unexpected error = %v", err)
+			}
+			// Parameters such as charset depend on the system's MIME tables
+			if !strings.HasPrefix(got, want) {
+				t.Errorf("Put() Content-Type = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestS3Store_PutChecksums(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode string
+	}{
+		{
+			name:   "Accepted upload",
+			status: http.StatusOK,
+		},
+		{
+			name:     "Bad digest",
+			status:   http.StatusBadRequest,
+			body:     `<?xml version="1.0" encoding="UTF-8"?><Error><Code>BadDigest</Code><Message>The Content-MD5 you specified did not match what we received.</Message></Error>`,
+			wantCode: storage.ErrCodeIntegrity,
+		},
+		{
+			name:     "Other failure",
+			status:   http.StatusInternalServerError,
+			body:     `<?xml version="1.0" encoding="UTF-8"?><Error><Code>InternalError</Code><Message>oops</Message></Error>`,
+			wantCode: storage.ErrCodeInternal,
+		},
+	}
+
+	sum := md5.Sum([]byte("data"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			store.client = s3.New(store.client.Options(), func(o *s3.Options) {
+				o.RetryMaxAttempts = 1
+			})
+
+			err := store.Put(context.Background(), "docs/file.txt", strings.NewReader("data"),
+				storage.WithContentMD5(sum[:]),
+				storage.WithChecksumSHA256("Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc="),
+			)
+
+			if got.Get("Content-Md5") != "jXd/OF09/siBXSD3SWAm3A==" {
+				t.Errorf("Put() Content-MD5 = %q", got.Get("Content-Md5"))
+			}
+			if got.Get("X-Amz-Checksum-Sha256") != "Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=" {
+				t.Errorf("Put() X-Amz-Checksum-Sha256 = %q", got.Get("X-Amz-Checksum-Sha256"))
+			}
+
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Put() unexpected error = %v", err)
+				}
+				return
+			}
+			var storageErr *storage.StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+				t.Errorf("Put() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestS3Store_PutGzipRoundTrip(t *testing.T) {
+	var stored []byte
+	var storedEncoding string
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			storedEncoding = r.Header.Get("Content-Encoding")
+			stored, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			w.Header().Set("Content-Encoding", storedEncoding)
+			w.WriteHeader(http.StatusOK)
+			w.Write(stored)
+		default:
+			t.Errorf("unexpected method %s", r.Method)
+		}
+	})
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+	err := store.Put(context.Background(), "docs/file.txt", strings.NewReader(text), storage.WithGzip())
+	if err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+
+	if storedEncoding != "gzip" {
+		t.Errorf("Put() Content-Encoding = %q, want gzip", storedEncoding)
+	}
+	if len(stored) >= len(text) {
+		t.Errorf("stored %d bytes, want fewer than the %d uncompressed bytes", len(stored), len(text))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("stored object is not gzip: %v", err)
+	}
+	if raw, _ := io.ReadAll(gz); string(raw) != text {
+		t.Error("stored object does not decompress to the original text")
+	}
+
+	body, err := store.Get(context.Background(), "docs/file.txt")
+	if err != nil {
+		t.Fatalf("Get() unexpected error = %v", err)
+	}
+	defer body.Close()
+
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if string(got) != text {
+		t.Errorf("Get() returned %d bytes, want the %d original bytes", len(got), len(text))
+	}
+}
+
+func TestS3Store_PutGzipVerifiesUncompressedChecksum(t *testing.T) {
+	var got http.Header
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	sum := md5.Sum([]byte("data"))
+	err := store.Put(context.Background(), "docs/file.txt", strings.NewReader("data"),
+		storage.WithGzip(),
+		storage.WithContentMD5(sum[:]),
+	)
+	if err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+	if got.Get("Content-Md5") == "jXd/OF09/siBXSD3SWAm3A==" {
+		t.Error("Put() sent the uncompressed digest, want the digest of the compressed body")
+	}
+
+	got = nil
+	err = store.Put(context.Background(), "docs/file.txt", strings.NewReader("tampered"),
+		storage.WithGzip(),
+		storage.WithContentMD5(sum[:]),
+	)
+	var storageErr *storage.StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != storage.ErrCodeIntegrity {
+		t.Errorf("Put() error = %v, want code %s", err, storage.ErrCodeIntegrity)
+	}
+	if got != nil {
+		t.Error("Put() uploaded data that failed verification")
+	}
+}
+
+func TestS3Store_GetPresignedPutURLSignsEncryptionHeaders(t *testing.T) {
+	client := s3.New(s3.Options{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+	store := NewS3Store(client, "test-bucket")
+
+	presigned, err := store.GetPresignedPutURL(context.Background(), "uploads/file.pdf", 15*time.Minute,
+		storage.WithPresignedSSE("kms-key-id"),
+		storage.WithPresignedStorageClass("STANDARD_IA"),
+	)
+	if err != nil {
+		t.Fatalf("GetPresignedPutURL() unexpected error = %v", err)
+	}
+
+	wantHeaders := map[string]string{
+		"X-Amz-Server-Side-Encryption":                "aws:kms",
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "kms-key-id",
+		"X-Amz-Storage-Class":                         "STANDARD_IA",
+	}
+	for k, v := range wantHeaders {
+		if presigned.Headers[k] != v {
+			t.Errorf("GetPresignedPutURL() Headers[%s] = %q, want %q", k, presigned.Headers[k], v)
+		}
+	}
+
+	presignedURL, err := url.Parse(presigned.URL)
+	if err != nil {
+		t.Fatalf("failed to parse presigned URL: %v", err)
+	}
+	signed := presignedURL.Query().Get("X-Amz-SignedHeaders")
+	for _, h := range []string{"x-amz-server-side-encryption", "x-amz-server-side-encryption-aws-kms-key-id", "x-amz-storage-class"} {
+		if !strings.Contains(signed, h) {
+			t.Errorf("X-Amz-SignedHeaders = %q, missing %s", signed, h)
+		}
+	}
+}
+
+func TestS3Store_GetPresignedPutURLAllowedExtensions(t *testing.T) {
+	client := s3.New(s3.Options{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	})
+	store := NewS3Store(client, "test-bucket")
+	allowed := storage.WithPresignedAllowedExtensions([]string{"pdf", "png"})
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "Allowed", key: "uploads/report.pdf"},
+		{name: "Disallowed", key: "uploads/page.html", wantErr: true},
+		{name: "Extension-less", key: "uploads/report", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			presigned, err := store.GetPresignedPutURL(context.Background(), tt.key, 15*time.Minute, allowed)
+			if tt.wantErr {
+				var storageErr *storage.StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != storage.ErrCodeInvalidArgument {
+					t.Errorf("GetPresignedPutURL() error = %v, want code %s", err, storage.ErrCodeInvalidArgument)
+				}
+				if presigned.URL != "" {
+					t.Errorf("GetPresignedPutURL() = %q, want no URL", presigned.URL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPresignedPutURL() unexpected error = %v", err)
+			}
+
+			// The content type implied by the extension is part of the signature
+			if presigned.Headers["Content-Type"] != "application/pdf" {
+				t.Errorf("GetPresignedPutURL() Headers[Content-Type] = %q, want application/pdf", presigned.Headers["Content-Type"])
+			}
+			presignedURL, err := url.Parse(presigned.URL)
+			if err != nil {
+				t.Fatalf("failed to parse presigned URL: %v", err)
+			}
+			if signed := presignedURL.Query().Get("X-Amz-SignedHeaders"); !strings.Contains(signed, "content-type") {
+				t.Errorf("X-Amz-SignedHeaders = %q, missing content-type", signed)
+			}
+		})
+	}
+}
+
+// deleteRequest is the body of a DeleteObjects call
+type deleteRequest struct {
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+func TestS3Store_DeleteMany(t *testing.T) {
+	var batchSizes []int
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("delete") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var req deleteRequest
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode delete request: %v", err)
+		}
+		batchSizes = append(batchSizes, len(req.Objects))
+
+		// Fail the first key of every batch
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><DeleteResult><Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error></DeleteResult>`, req.Objects[0].Key)
+	})
+
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("tenant/%04d", i)
+	}
+
+	err := store.DeleteMany(context.Background(), keys)
+
+	if want := []int{1000, 1000, 500}; fmt.Sprint(batchSizes) != fmt.Sprint(want) {
+		t.Errorf("DeleteMany() batch sizes = %v, want %v", batchSizes, want)
+	}
+
+	var multiErr *storage.MultiDeleteError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("DeleteMany() error = %v, want *storage.MultiDeleteError", err)
+	}
+	if len(multiErr.Errors) != 3 {
+		t.Fatalf("DeleteMany() reported %d failures, want 3", len(multiErr.Errors))
+	}
+	for i, key := range []string{"tenant/0000", "tenant/1000", "tenant/2000"} {
+		if multiErr.Errors[i].Key != key || multiErr.Errors[i].Code != storage.ErrCodePermissionDenied {
+			t.Errorf("failure %d = %s (%s), want %s (%s)", i, multiErr.Errors[i].Key, multiErr.Errors[i].Code, key, storage.ErrCodePermissionDenied)
+		}
+	}
+}
+
+func TestS3Store_DeletePrefix(t *testing.T) {
+	pages := map[string]string{
+		"":      `<ListBucketResult><Contents><Key>tenant/a</Key></Contents><Contents><Key>tenant/b</Key></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>page2</NextContinuationToken></ListBucketResult>`,
+		"page2": `<ListBucketResult><Contents><Key>tenant/c</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`,
+	}
+
+	var deleted []string
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		query := r.URL.Query()
+		switch {
+		case query.Has("delete"):
+			var req deleteRequest
+			if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("failed to decode delete request: %v", err)
+			}
+			for _, obj := range req.Objects {
+				deleted = append(deleted, obj.Key)
+			}
+			fmt.Fprint(w, `<DeleteResult></DeleteResult>`)
+		case query.Get("list-type") == "2":
+			if query.Get("prefix") != "tenant/" {
+				t.Errorf("list prefix = %q, want tenant/", query.Get("prefix"))
+			}
+			fmt.Fprint(w, pages[query.Get("continuation-token")])
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	})
+
+	count, err := store.DeletePrefix(context.Background(), "tenant/")
+	if err != nil {
+		t.Fatalf("DeletePrefix() unexpected error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("DeletePrefix() = %d, want 3", count)
+	}
+	if want := "[tenant/a tenant/b tenant/c]"; fmt.Sprint(deleted) != want {
+		t.Errorf("DeletePrefix() deleted %v, want %s", deleted, want)
+	}
+}
+
+func TestS3Store_DeletePrefixCanceled(t *testing.T) {
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	count, err := store.DeletePrefix(ctx, "tenant/")
+	if err == nil {
+		t.Fatal("DeletePrefix() error = nil, want cancellation error")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DeletePrefix() error = %v, want context.Canceled", err)
+	}
+	if count != 0 {
+		t.Errorf("DeletePrefix() = %d, want 0", count)
+	}
+}
+
+func TestS3Store_GetVersion(t *testing.T) {
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("versionId") {
+		case "v1":
+			w.Header().Set("x-amz-version-id", "v1")
+			fmt.Fprint(w, "first")
+		default:
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchVersion</Code><Message>The specified version does not exist.</Message></Error>`)
+		}
+	})
+
+	body, err := store.GetVersion(context.Background(), "docs/file.txt", "v1")
+	if err != nil {
+		t.Fatalf("GetVersion() unexpected error = %v", err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if string(data) != "first" {
+		t.Errorf("GetVersion() = %q, want %q", data, "first")
+	}
+
+	_, err = store.GetVersion(context.Background(), "docs/file.txt", "missing")
+	var storageErr *storage.StorageError
+	if !errors.As(err, &storageErr) {
+		t.Fatalf("GetVersion() error = %v, want *storage.StorageError", err)
+	}
+	if storageErr.Code != storage.ErrCodeNotFound {
+		t.Errorf("GetVersion() error code = %v, want %v", storageErr.Code, storage.ErrCodeNotFound)
+	}
+}
+
+func TestS3Store_DeleteVersion(t *testing.T) {
+	var gotMethod, gotVersion string
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotVersion = r.URL.Query().Get("versionId")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := store.DeleteVersion(context.Background(), "docs/file.txt", "v2"); err != nil {
+		t.Fatalf("DeleteVersion() unexpected error = %v", err)
+	}
+	if gotMethod != http.MethodDelete {
+		t.Errorf("DeleteVersion() method = %s, want DELETE", gotMethod)
+	}
+	if gotVersion != "v2" {
+		t.Errorf("DeleteVersion() versionId = %q, want v2", gotVersion)
+	}
+}
+
+func TestS3Store_ListVersions(t *testing.T) {
+	pages := map[string]string{
+		"": `<ListVersionsResult>
+			<Version><Key>docs/a</Key><VersionId>a2</VersionId><IsLatest>true</IsLatest><LastModified>2024-05-02T10:00:00.000Z</LastModified><ETag>"e2"</ETag><Size>20</Size></Version>
+			<Version><Key>docs/a</Key><VersionId>a1</VersionId><IsLatest>false</IsLatest><LastModified>2024-05-01T10:00:00.000Z</LastModified><ETag>"e1"</ETag><Size>10</Size></Version>
+			<IsTruncated>true</IsTruncated><NextKeyMarker>docs/a</NextKeyMarker><NextVersionIdMarker>a1</NextVersionIdMarker>
+		</ListVersionsResult>`,
+		"docs/a|a1": `<ListVersionsResult>
+			<DeleteMarker><Key>docs/b</Key><VersionId>b2</VersionId><IsLatest>true</IsLatest><LastModified>2024-05-04T10:00:00.000Z</LastModified></DeleteMarker>
+			<Version><Key>docs/b</Key><VersionId>b1</VersionId><IsLatest>false</IsLatest><LastModified>2024-05-03T10:00:00.000Z</LastModified><ETag>"e3"</ETag><Size>30</Size></Version>
+			<IsTruncated>false</IsTruncated>
+		</ListVersionsResult>`,
+	}
+
+	store := newTestStore(t, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !query.Has("versions") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		if query.Get("prefix") != "docs/" {
+			t.Errorf("list prefix = %q, want docs/", query.Get("prefix"))
+		}
+		marker := ""
+		if query.Has("key-marker") {
+			marker = query.Get("key-marker") + "|" + query.Get("version-id-marker")
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, pages[marker])
+	})
+
+	objects, err := store.ListVersions(context.Background(), "docs/")
+	if err != nil {
+		t.Fatalf("ListVersions() unexpected error = %v", err)
+	}
+
+	want := []storage.ObjectInfo{
+		{Key: "docs/a", VersionID: "a2", IsLatest: true, Size: 20, ETag: `"e2"`},
+		{Key: "docs/a", VersionID: "a1", IsLatest: false, Size: 10, ETag: `"e1"`},
+		{Key: "docs/b", VersionID: "b1", IsLatest: false, Size: 30, ETag: `"e3"`},
+	}
+	if len(objects) != len(want) {
+		t.Fatalf("ListVersions() returned %d objects, want %d: %+v", len(objects), len(want), objects)
+	}
+	for i, w := range want {
+		got := objects[i]
+		if got.Key != w.Key || got.VersionID != w.VersionID || got.IsLatest != w.IsLatest || got.Size != w.Size || got.ETag != w.ETag {
+			t.Errorf("ListVersions()[%d] = %+v, want %+v", i, got, w)
+		}
+		if got.LastModified.IsZero() {
+			t.Errorf("ListVersions()[%d] LastModified is zero", i)
+		}
+	}
+}
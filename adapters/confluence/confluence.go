@@ -0,0 +1,268 @@
+// Package confluence is a datasource.DataSource for the pages of a
+// Confluence space, read through the Confluence REST API
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+)
+
+const defaultPageSize = 25
+
+// ConfluenceSource loads the pages of one Confluence space, one document per
+// page with its storage-format body converted to text. Documents carry the
+// page's ID, version number and last modification time under "page_id",
+// "version" and "last_modified", so Sync re-indexes only edited pages.
+type ConfluenceSource struct {
+	baseURL  string
+	spaceKey string
+	token    string
+	email    string
+	client   *http.Client
+	pageSize int
+}
+
+// SourceOption configures a ConfluenceSource
+type SourceOption func(*ConfluenceSource)
+
+// WithHTTPClient sets the HTTP client requests are sent with
+func WithHTTPClient(client *http.Client) SourceOption {
+	return func(s *ConfluenceSource) {
+		s.client = client
+	}
+}
+
+// WithBasicAuth authenticates as email with the API token, as Confluence
+// Cloud expects. Without it the token is sent as a bearer token, as for the
+// personal access tokens of Confluence Server and Data Center.
+func WithBasicAuth(email string) SourceOption {
+	return func(s *ConfluenceSource) {
+		s.email = email
+	}
+}
+
+// WithPageSize sets how many pages each API request lists (25 by default)
+func WithPageSize(size int) SourceOption {
+	return func(s *ConfluenceSource) {
+		s.pageSize = size
+	}
+}
+
+// NewConfluenceSource creates a ConfluenceSource for the space spaceKey of
+// the site at baseURL, such as "https://example.atlassian.net/wiki"
+func NewConfluenceSource(baseURL, spaceKey, apiToken string, opts ...SourceOption) *ConfluenceSource {
+	s := &ConfluenceSource{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		spaceKey: spaceKey,
+		token:    apiToken,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		pageSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// contentPage is a page of the content listing
+type contentPage struct {
+	Results []struct {
+		ID      string `json:"id"`
+		Title   string `json:"title"`
+		Version struct {
+			Number int    `json:"number"`
+			When   string `json:"when"`
+		} `json:"version"`
+		Body struct {
+			Storage struct {
+				Value string `json:"value"`
+			} `json:"storage"`
+		} `json:"body"`
+	} `json:"results"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+func (s *ConfluenceSource) Load(ctx context.Context, opts ...datasource.Option) ([]datasource.Document, error) {
+	var documents []datasource.Document
+	err := s.eachPage(ctx, opts, func(doc datasource.Document) error {
+		documents = append(documents, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+func (s *ConfluenceSource) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
+	options := &datasource.LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	docChan := make(chan datasource.Document, options.StreamBuffer)
+	errChan := make(chan error, 1) // buffered channel for error
+
+	go func() {
+		defer close(docChan)
+		defer close(errChan)
+
+		err := s.eachPage(ctx, opts, func(doc datasource.Document) error {
+			select {
+			case docChan <- doc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// eachPage lists the pages of the space and calls fn with the document of
+// each page the options keep, until MaxItems were kept
+func (s *ConfluenceSource) eachPage(ctx context.Context, opts []datasource.Option, fn func(datasource.Document) error) error {
+	options := &datasource.LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	expand := "version"
+	if !options.SkipContent {
+		expand += ",body.storage"
+	}
+	query := url.Values{
+		"spaceKey": {s.spaceKey},
+		"type":     {"page"},
+		"expand":   {expand},
+		"limit":    {strconv.Itoa(s.pageSize)},
+	}
+	next := "/rest/api/content?" + query.Encode()
+
+	count := 0
+	for next != "" {
+		var listing contentPage
+		if err := s.get(ctx, next, &listing); err != nil {
+			return err
+		}
+
+		for _, page := range listing.Results {
+			metadata := map[string]interface{}{
+				"page_id": page.ID,
+				"title":   page.Title,
+				"space":   s.spaceKey,
+				"version": page.Version.Number,
+			}
+			if modified, err := time.Parse(time.RFC3339, page.Version.When); err == nil {
+				metadata["last_modified"] = modified
+			}
+			options.ApplyStaticMetadata(metadata)
+
+			if options.Filter != nil && !options.Filter(metadata) {
+				continue
+			}
+
+			doc := datasource.Document{
+				Metadata: metadata,
+				Source:   s.pageURL(page.ID),
+			}
+			if !options.SkipContent {
+				doc.Content = storageToText(page.Body.Storage.Value)
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+			count++
+			if options.MaxItems > 0 && count >= options.MaxItems {
+				return nil
+			}
+		}
+		next = listing.Links.Next
+	}
+	return nil
+}
+
+// pageURL is the source of a page's document. Unlike the page's web UI
+// link, it doesn't change when the page is renamed.
+func (s *ConfluenceSource) pageURL(id string) string {
+	return s.baseURL + "/pages/viewpage.action?pageId=" + url.QueryEscape(id)
+}
+
+// get decodes the JSON response to a GET of path, relative to the base URL
+func (s *ConfluenceSource) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+	if err != nil {
+		return &datasource.DataSourceError{
+			Source:  "confluence",
+			Op:      "Load",
+			Err:     err,
+			Code:    datasource.ErrCodeInvalidSource,
+			Message: "invalid base URL",
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if s.email != "" {
+		req.SetBasicAuth(s.email, s.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &datasource.DataSourceError{
+			Source:  "confluence",
+			Op:      "Load",
+			Err:     err,
+			Code:    datasource.ErrCodeInternal,
+			Message: "failed to list pages",
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &datasource.DataSourceError{
+			Source:  "confluence",
+			Op:      "Load",
+			Code:    statusCode(resp.StatusCode),
+			Message: "failed to list pages: " + resp.Status,
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &datasource.DataSourceError{
+			Source:  "confluence",
+			Op:      "Load",
+			Err:     err,
+			Code:    datasource.ErrCodeInvalidFormat,
+			Message: fmt.Sprintf("invalid response from %s", path),
+		}
+	}
+	return nil
+}
+
+// statusCode maps an HTTP error status to a datasource error code
+func statusCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return datasource.ErrCodeAccessDenied
+	case http.StatusNotFound:
+		return datasource.ErrCodeNotFound
+	case http.StatusTooManyRequests:
+		return datasource.ErrCodeRateLimitExceeded
+	default:
+		return datasource.ErrCodeInternal
+	}
+}
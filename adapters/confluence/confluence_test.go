@@ -0,0 +1,151 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+)
+
+// newConfluenceServer stubs the content API of a space with three pages,
+// listed two per response, recording the query of every request
+func newConfluenceServer(t *testing.T, queries *[]string) *httptest.Server {
+	t.Helper()
+	responses := map[string]string{
+		"": `{"results":[
+			{"id":"1","title":"Home","version":{"number":3,"when":"2024-05-01T10:00:00.000Z"},"body":{"storage":{"value":"<h1>Welcome</h1><p>Read the <strong>guide</strong> &amp; FAQ.</p>"}}},
+			{"id":"2","title":"Guide","version":{"number":1,"when":"2024-05-02T10:00:00.000Z"},"body":{"storage":{"value":"<p>Step one</p><p>Step two</p>"}}}
+		],"_links":{"next":"/rest/api/content?spaceKey=DOCS&start=2"}}`,
+		"2": `{"results":[
+			{"id":"3","title":"FAQ","version":{"number":7,"when":"2024-05-03T10:00:00.000Z"},"body":{"storage":{"value":"<p>Ask us</p>"}}}
+		],"_links":{}}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		if r.URL.Path != "/wiki/rest/api/content" || r.URL.Query().Get("spaceKey") != "DOCS" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(responses[r.URL.Query().Get("start")]))
+	}))
+}
+
+func TestConfluenceSource_Load(t *testing.T) {
+	var queries []string
+	server := newConfluenceServer(t, &queries)
+	defer server.Close()
+
+	source := NewConfluenceSource(server.URL+"/wiki/", "DOCS", "secret")
+	docs, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(docs) != 3 || len(queries) != 2 {
+		t.Fatalf("Load() = %d documents in %d requests, want 3 in 2", len(docs), len(queries))
+	}
+
+	home := docs[0]
+	if home.Content != "Welcome\nRead the guide & FAQ." {
+		t.Errorf("content = %q, want the page as text", home.Content)
+	}
+	if home.Source != server.URL+"/wiki/pages/viewpage.action?pageId=1" {
+		t.Errorf("source = %q, want the page's URL", home.Source)
+	}
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if home.Metadata["page_id"] != "1" || home.Metadata["version"] != 3 || home.Metadata["last_modified"] != modified {
+		t.Errorf("metadata = %v, want the page ID, version and modification time", home.Metadata)
+	}
+	if docs[2].Metadata["page_id"] != "3" || docs[2].Content != "Ask us" {
+		t.Errorf("last document = %+v, want the page of the second response", docs[2])
+	}
+	if !strings.Contains(queries[0], "body.storage") {
+		t.Errorf("query = %q, want the page bodies expanded", queries[0])
+	}
+}
+
+func TestConfluenceSource_Options(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []datasource.Option
+		wantIDs  []string
+		requests int
+	}{
+		{name: "MaxItems stops listing", opts: []datasource.Option{datasource.WithMaxItems(2)}, wantIDs: []string{"1", "2"}, requests: 1},
+		{name: "MaxItems counts kept pages", opts: []datasource.Option{
+			datasource.WithMaxItems(2),
+			datasource.WithFilter(func(metadata map[string]interface{}) bool { return metadata["page_id"] != "1" }),
+		}, wantIDs: []string{"2", "3"}, requests: 2},
+		{name: "Static metadata", opts: []datasource.Option{datasource.WithStaticMetadata(map[string]interface{}{"team": "docs"})}, wantIDs: []string{"1", "2", "3"}, requests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			server := newConfluenceServer(t, &queries)
+			defer server.Close()
+
+			source := NewConfluenceSource(server.URL+"/wiki", "DOCS", "secret")
+			docChan, errChan := source.Stream(context.Background(), tt.opts...)
+			var ids []string
+			for doc := range docChan {
+				ids = append(ids, doc.Metadata["page_id"].(string))
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") || len(queries) != tt.requests {
+				t.Errorf("Stream() = pages %v in %d requests, want %v in %d", ids, len(queries), tt.wantIDs, tt.requests)
+			}
+		})
+	}
+}
+
+func TestConfluenceSource_SkipContent(t *testing.T) {
+	var queries []string
+	server := newConfluenceServer(t, &queries)
+	defer server.Close()
+
+	docs, err := NewConfluenceSource(server.URL+"/wiki", "DOCS", "secret").Load(context.Background(), datasource.WithSkipContent(true))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if docs[0].Content != "" || strings.Contains(queries[0], "body.storage") {
+		t.Errorf("content = %q, query %q, want no bodies requested", docs[0].Content, queries[0])
+	}
+}
+
+func TestConfluenceSource_Errors(t *testing.T) {
+	var queries []string
+	server := newConfluenceServer(t, &queries)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		source   *ConfluenceSource
+		wantCode string
+	}{
+		{name: "Wrong token", source: NewConfluenceSource(server.URL+"/wiki", "DOCS", "wrong"), wantCode: datasource.ErrCodeAccessDenied},
+		{name: "Basic auth rejected", source: NewConfluenceSource(server.URL+"/wiki", "DOCS", "secret", WithBasicAuth("me@example.com")), wantCode: datasource.ErrCodeAccessDenied},
+		{name: "Unknown space", source: NewConfluenceSource(server.URL+"/wiki", "NOPE", "secret"), wantCode: datasource.ErrCodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.source.Load(context.Background())
+			var sourceErr *datasource.DataSourceError
+			if !errors.As(err, &sourceErr) || sourceErr.Code != tt.wantCode {
+				t.Errorf("Load() error = %v, want %s", err, tt.wantCode)
+			}
+		})
+	}
+}
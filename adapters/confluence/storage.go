@@ -0,0 +1,49 @@
+package confluence
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// cdata wraps the code of code macros
+	cdata = regexp.MustCompile(`(?s)<!\[CDATA\[(.*?)\]\]>`)
+	// macroParameters configure macros, such as the language of a code macro
+	macroParameters = regexp.MustCompile(`(?s)<ac:parameter[^>]*>.*?</ac:parameter>`)
+	// lineBreaks are the tags that end a line of text
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|h[1-6]|li|tr|div|pre|blockquote|ac:structured-macro)>`)
+	// cellBreaks separate the cells of a table row
+	cellBreaks = regexp.MustCompile(`(?i)</t[dh]>`)
+	tags       = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// storageToText converts a page body in the Confluence storage format, the
+// XHTML pages are stored in, to plain text. Block elements end lines, table
+// cells are separated by tabs and the code of code macros is kept, without
+// the macros' parameters.
+func storageToText(storage string) string {
+	// Code is set apart so its markup characters survive the tag stripping
+	var code []string
+	text := cdata.ReplaceAllStringFunc(storage, func(match string) string {
+		code = append(code, cdata.FindStringSubmatch(match)[1])
+		return "\x00"
+	})
+
+	text = macroParameters.ReplaceAllString(text, "")
+	text = lineBreaks.ReplaceAllString(text, "$0\n")
+	text = cellBreaks.ReplaceAllString(text, "$0\t")
+	text = tags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	for _, block := range code {
+		text = strings.Replace(text, "\x00", block, 1)
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,30 @@
+package confluence
+
+import "testing"
+
+func TestStorageToText(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage string
+		want    string
+	}{
+		{name: "Paragraphs", storage: "<p>One</p><p>Two<br/>Three</p>", want: "One\nTwo\nThree"},
+		{name: "Entities", storage: "<p>Q&amp;A &lt;tags&gt; caf&eacute;</p>", want: "Q&A <tags> café"},
+		{name: "Lists", storage: "<ul><li>a</li><li>b</li></ul>", want: "a\nb"},
+		{name: "Tables", storage: "<table><tbody><tr><th>Name</th><th>Role</th></tr><tr><td>Ana</td><td>Dev</td></tr></tbody></table>", want: "Name\tRole\nAna\tDev"},
+		{
+			name:    "Code macro",
+			storage: `<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go</ac:parameter><ac:plain-text-body><![CDATA[if a < b && c > d {}]]></ac:plain-text-body></ac:structured-macro>`,
+			want:    "if a < b && c > d {}",
+		},
+		{name: "Blank lines collapsed", storage: "<p>a</p><p></p><p></p><p>b</p>", want: "a\n\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storageToText(tt.storage); got != tt.want {
+				t.Errorf("storageToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+// FileStore implements storage.DataStore on top of a local directory.
+// Object keys are slash-separated paths relative to the root directory.
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) *FileStore {
+	return &FileStore{
+		root: filepath.Clean(root),
+	}
+}
+
+// path resolves a key to a file under the root, rejecting keys that escape it
+func (f *FileStore) path(op, key string) (string, error) {
+	p := filepath.Join(f.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, f.root+string(os.PathSeparator)) {
+		return "", storage.NewStorageError(op, key, nil, storage.ErrCodeInvalidArgument, "key resolves outside the store root")
+	}
+	return p, nil
+}
+
+func (f *FileStore) Put(ctx context.Context, key string, data io.Reader, options ...storage.PutOption) error {
+	opts := &storage.PutOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	p, err := f.path("Put", key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to create directory")
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to create file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to write file")
+	}
+	if err := tmp.Close(); err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to write file")
+	}
+
+	// Verify what actually landed on disk before making it visible
+	if err := f.verify(key, tmp.Name(), opts); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to write file")
+	}
+
+	return nil
+}
+
+// verify checks the written file against the checksums requested in opts
+func (f *FileStore) verify(key, name string, opts *storage.PutOptions) error {
+	if opts.ContentMD5 == nil && opts.ChecksumSHA256 == "" {
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to open file for verification")
+	}
+	defer file.Close()
+
+	return opts.VerifyChecksums("Put", key, file)
+}
+
+func (f *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := f.path("Get", key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, storage.NewStorageError("Get", key, err, storage.ErrCodeNotFound, "object not found")
+		}
+		return nil, storage.NewStorageError("Get", key, err, storage.ErrCodeInternal, "failed to open file")
+	}
+
+	return file, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, key string) error {
+	p, err := f.path("Delete", key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return storage.NewStorageError("Delete", key, err, storage.ErrCodeInternal, "failed to delete file")
+	}
+
+	return nil
+}
+
+func (f *FileStore) DeleteMany(ctx context.Context, keys []string) error {
+	var failed []*storage.StorageError
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return storage.NewStorageError("DeleteMany", "", err, storage.ErrCodeInternal, "delete canceled")
+		}
+
+		if err := f.Delete(ctx, key); err != nil {
+			var storageErr *storage.StorageError
+			if errors.As(err, &storageErr) {
+				storageErr.Op = "DeleteMany"
+				failed = append(failed, storageErr)
+				continue
+			}
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		return &storage.MultiDeleteError{Op: "DeleteMany", Errors: failed}
+	}
+
+	return nil
+}
+
+func (f *FileStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	objects, err := f.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	var failed []*storage.StorageError
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return deleted, storage.NewStorageError("DeletePrefix", prefix, err, storage.ErrCodeInternal, "delete canceled")
+		}
+
+		if err := f.Delete(ctx, obj.Key); err != nil {
+			var storageErr *storage.StorageError
+			if errors.As(err, &storageErr) {
+				storageErr.Op = "DeletePrefix"
+				failed = append(failed, storageErr)
+				continue
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+
+	if len(failed) > 0 {
+		return deleted, &storage.MultiDeleteError{Op: "DeletePrefix", Errors: failed}
+	}
+
+	return deleted, nil
+}
+
+func (f *FileStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+
+	err := filepath.WalkDir(f.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, storage.ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, storage.NewStorageError("List", prefix, err, storage.ErrCodeInternal, "failed to list files")
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+func (f *FileStore) Exists(ctx context.Context, key string) (bool, error) {
+	p, err := f.path("Exists", key)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, storage.NewStorageError("Exists", key, err, storage.ErrCodeInternal, "failed to check file existence")
+	}
+
+	return !info.IsDir(), nil
+}
+
+func (f *FileStore) GetPresignedPutURL(ctx context.Context, key string, expires time.Duration, options ...storage.PresignedPutOption) (storage.PresignedURL, error) {
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedPutURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the filesystem store")
+}
+
+func (f *FileStore) GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (storage.PresignedURL, error) {
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedGetURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the filesystem store")
+}
@@ -0,0 +1,148 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+func TestFileStore_BulkDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+	for _, key := range []string{"tenant/a", "tenant/b", "tenant/c/d", "other/a"} {
+		if err := store.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if err := store.DeleteMany(ctx, []string{"tenant/a", "missing"}); err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+
+	count, err := store.DeletePrefix(ctx, "tenant/")
+	if err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("DeletePrefix() = %d, want 2", count)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "other/a" {
+		t.Errorf("List() = %v, want only other/a", objects)
+	}
+}
+
+func TestFileStore_DeleteManyReportsInvalidKeys(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+
+	err := store.DeleteMany(context.Background(), []string{"ok", "../escape"})
+
+	var multiErr *storage.MultiDeleteError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("DeleteMany() error = %v, want *storage.MultiDeleteError", err)
+	}
+	if len(multiErr.Errors) != 1 || multiErr.Errors[0].Key != "../escape" {
+		t.Errorf("DeleteMany() failures = %v, want ../escape", multiErr.Errors)
+	}
+	if multiErr.Errors[0].Code != storage.ErrCodeInvalidArgument {
+		t.Errorf("failure code = %s, want %s", multiErr.Errors[0].Code, storage.ErrCodeInvalidArgument)
+	}
+}
+
+func TestFileStore_DeletePrefixCanceled(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+	if err := store.Put(ctx, "tenant/a", strings.NewReader("a")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	count, err := store.DeletePrefix(canceled, "tenant/")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DeletePrefix() error = %v, want context.Canceled", err)
+	}
+	if count != 0 {
+		t.Errorf("DeletePrefix() = %d, want 0", count)
+	}
+}
+
+func TestFileStore_PutVerifiesChecksums(t *testing.T) {
+	sum := md5.Sum([]byte("payload"))
+
+	tests := []struct {
+		name     string
+		options  []storage.PutOption
+		wantCode string
+	}{
+		{
+			name:    "Matching MD5",
+			options: []storage.PutOption{storage.WithContentMD5(sum[:])},
+		},
+		{
+			name:     "Mismatching MD5",
+			options:  []storage.PutOption{storage.WithContentMD5(make([]byte, md5.Size))},
+			wantCode: storage.ErrCodeIntegrity,
+		},
+		{
+			name:     "Mismatching SHA-256",
+			options:  []storage.PutOption{storage.WithChecksumSHA256("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")},
+			wantCode: storage.ErrCodeIntegrity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewFileStore(t.TempDir())
+
+			err := store.Put(ctx, "docs/file.txt", strings.NewReader("payload"), tt.options...)
+			exists, _ := store.Exists(ctx, "docs/file.txt")
+
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Put() unexpected error = %v", err)
+				}
+				if !exists {
+					t.Error("Put() did not store the object")
+				}
+				return
+			}
+
+			var storageErr *storage.StorageError
+			if !errors.As(err, &storageErr) || storageErr.Code != tt.wantCode {
+				t.Fatalf("Put() error = %v, want code %s", err, tt.wantCode)
+			}
+			if exists {
+				t.Error("Put() stored an object that failed verification")
+			}
+		})
+	}
+}
+
+func TestPutVerified(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileStore(t.TempDir())
+
+	data := strings.NewReader("payload")
+	if err := storage.PutVerified(ctx, store, "docs/file.txt", data); err != nil {
+		t.Fatalf("PutVerified() unexpected error = %v", err)
+	}
+
+	objects, err := store.List(ctx, "docs/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 1 || objects[0].Size != int64(len("payload")) {
+		t.Errorf("List() = %v, want one object of %d bytes", objects, len("payload"))
+	}
+}
@@ -0,0 +1,112 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+	kbservicev1 "github.com/Abraxas-365/kbservice/proto/kbservice/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChatHistoryServer implements kbservicev1.ChatHistoryServiceServer on top of a Memory
+type ChatHistoryServer struct {
+	kbservicev1.UnimplementedChatHistoryServiceServer
+
+	mem *chathistory.Memory
+}
+
+// NewChatHistoryServer creates a ChatHistoryServer
+func NewChatHistoryServer(mem *chathistory.Memory) *ChatHistoryServer {
+	return &ChatHistoryServer{mem: mem}
+}
+
+func (s *ChatHistoryServer) CreateConversation(ctx context.Context, req *kbservicev1.CreateConversationRequest) (*kbservicev1.Conversation, error) {
+	conv, err := s.mem.CreateConversation(ctx, fromStruct(req.GetMetadata()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return s.conversation(conv)
+}
+
+func (s *ChatHistoryServer) GetConversation(ctx context.Context, req *kbservicev1.GetConversationRequest) (*kbservicev1.Conversation, error) {
+	conv, err := s.mem.GetConversation(ctx, req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return s.conversation(conv)
+}
+
+func (s *ChatHistoryServer) ListConversations(ctx context.Context, req *kbservicev1.ListConversationsRequest) (*kbservicev1.ListConversationsResponse, error) {
+	if req.GetLimit() < 0 || req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit and offset must not be negative")
+	}
+
+	convs, err := s.mem.ListConversations(ctx, chathistory.Filter{}, int(req.GetLimit()), int(req.GetOffset()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &kbservicev1.ListConversationsResponse{}
+	for i := range convs {
+		conv, err := s.conversation(&convs[i])
+		if err != nil {
+			return nil, err
+		}
+		resp.Conversations = append(resp.Conversations, conv)
+	}
+	return resp, nil
+}
+
+func (s *ChatHistoryServer) UpdateConversationMetadata(ctx context.Context, req *kbservicev1.UpdateConversationMetadataRequest) (*kbservicev1.UpdateConversationMetadataResponse, error) {
+	if err := s.mem.UpdateConversationMetadata(ctx, req.GetId(), fromStruct(req.GetMetadata())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.UpdateConversationMetadataResponse{}, nil
+}
+
+func (s *ChatHistoryServer) DeleteConversation(ctx context.Context, req *kbservicev1.DeleteConversationRequest) (*kbservicev1.DeleteConversationResponse, error) {
+	if err := s.mem.DeleteConversation(ctx, req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.DeleteConversationResponse{}, nil
+}
+
+func (s *ChatHistoryServer) AddMessage(ctx context.Context, req *kbservicev1.AddMessageRequest) (*kbservicev1.AddMessageResponse, error) {
+	if req.GetMessage() == nil {
+		return nil, status.Error(codes.InvalidArgument, "message is required")
+	}
+
+	msg := fromProtoMessage(req.GetMessage())
+	if msg.Role == "" {
+		msg.Role = llm.RoleUser
+	}
+	if err := s.mem.AddMessage(ctx, req.GetConversationId(), msg); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.AddMessageResponse{}, nil
+}
+
+func (s *ChatHistoryServer) GetMessages(ctx context.Context, req *kbservicev1.GetMessagesRequest) (*kbservicev1.GetMessagesResponse, error) {
+	messages, err := s.mem.GetMessages(ctx, req.GetConversationId(), int(req.GetLimit()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.GetMessagesResponse{Messages: toProtoMessages(messages)}, nil
+}
+
+func (s *ChatHistoryServer) ClearHistory(ctx context.Context, req *kbservicev1.ClearHistoryRequest) (*kbservicev1.ClearHistoryResponse, error) {
+	if err := s.mem.ClearHistory(ctx, req.GetConversationId()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.ClearHistoryResponse{}, nil
+}
+
+func (s *ChatHistoryServer) conversation(conv *chathistory.Conversation) (*kbservicev1.Conversation, error) {
+	out, err := toProtoConversation(conv)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode conversation metadata: %v", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package grpcserver
+
+import (
+	"encoding/json"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+	kbservicev1 "github.com/Abraxas-365/kbservice/proto/kbservice/v1"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// toStruct converts metadata to a protobuf Struct. Values go through JSON, so
+// types such as time.Time arrive the way the HTTP server would encode them.
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func fromStruct(s *structpb.Struct) map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.AsMap()
+}
+
+func toProtoDocuments(docs []vectorstore.Document) ([]*kbservicev1.Document, error) {
+	out := make([]*kbservicev1.Document, len(docs))
+	for i, doc := range docs {
+		metadata, err := toStruct(doc.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = &kbservicev1.Document{
+			PageContent: doc.PageContent,
+			Metadata:    metadata,
+			Score:       doc.Score,
+		}
+	}
+	return out, nil
+}
+
+func toProtoMessage(msg llm.Message) *kbservicev1.Message {
+	out := &kbservicev1.Message{
+		Role:       msg.Role,
+		Content:    msg.Content,
+		Name:       msg.Name,
+		ToolCallId: msg.ToolCallID,
+		StopReason: string(msg.StopReason),
+	}
+	for _, tc := range msg.ToolCalls {
+		out.ToolCalls = append(out.ToolCalls, &kbservicev1.ToolCall{
+			Id:   tc.ID,
+			Type: tc.Type,
+			Function: &kbservicev1.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+	return out
+}
+
+func toProtoMessages(messages []llm.Message) []*kbservicev1.Message {
+	out := make([]*kbservicev1.Message, len(messages))
+	for i, msg := range messages {
+		out[i] = toProtoMessage(msg)
+	}
+	return out
+}
+
+func fromProtoMessage(msg *kbservicev1.Message) llm.Message {
+	out := llm.Message{
+		Role:       msg.GetRole(),
+		Content:    msg.GetContent(),
+		Name:       msg.GetName(),
+		ToolCallID: msg.GetToolCallId(),
+		StopReason: llm.StopReason(msg.GetStopReason()),
+	}
+	for _, tc := range msg.GetToolCalls() {
+		out.ToolCalls = append(out.ToolCalls, llm.ToolCall{
+			ID:   tc.GetId(),
+			Type: tc.GetType(),
+			Function: llm.FunctionCall{
+				Name:      tc.GetFunction().GetName(),
+				Arguments: tc.GetFunction().GetArguments(),
+			},
+		})
+	}
+	return out
+}
+
+func toProtoConversation(conv *chathistory.Conversation) (*kbservicev1.Conversation, error) {
+	metadata, err := toStruct(conv.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return &kbservicev1.Conversation{
+		Id:        conv.ID,
+		Messages:  toProtoMessages(conv.Messages),
+		Metadata:  metadata,
+		CreatedAt: timestamppb.New(conv.CreatedAt),
+		UpdatedAt: timestamppb.New(conv.UpdatedAt),
+	}, nil
+}
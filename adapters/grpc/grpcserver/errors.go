@@ -0,0 +1,97 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus converts an error to a gRPC status error. Only the messages of typed
+// errors are exposed; anything else is reported as an internal error.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	if errors.Is(err, chathistory.ErrConversationNotFound) {
+		return status.Error(codes.NotFound, "conversation not found")
+	}
+
+	var noContextErr *kb.NoContextError
+	if errors.As(err, &noContextErr) {
+		return status.Error(codes.FailedPrecondition, noContextErr.Error())
+	}
+
+	var vsErr *vectorstore.VectorStoreError
+	if errors.As(err, &vsErr) {
+		code := codes.Internal
+		switch vsErr.Code {
+		case vectorstore.ErrCodeInvalidFilter, vectorstore.ErrCodeInvalidDimensions:
+			code = codes.InvalidArgument
+		case vectorstore.ErrCodeNotSupported:
+			code = codes.Unimplemented
+		case vectorstore.ErrCodeTimeout:
+			code = codes.DeadlineExceeded
+		case vectorstore.ErrCodeEmbeddingFailed:
+			code = codes.Unavailable
+		}
+		return status.Errorf(code, "%s: %s", vsErr.Code, vsErr.Message)
+	}
+
+	var embeddingErr *embedding.EmbeddingError
+	if errors.As(err, &embeddingErr) {
+		code := codes.Unavailable
+		switch embeddingErr.Code {
+		case embedding.ErrCodeInvalidInput, embedding.ErrCodeEmptyInput, embedding.ErrCodeTokenLimitExceeded:
+			code = codes.InvalidArgument
+		case embedding.ErrCodeRateLimitExceeded:
+			code = codes.ResourceExhausted
+		case embedding.ErrCodeContextCanceled:
+			code = codes.Canceled
+		case embedding.ErrCodeInternal:
+			code = codes.Internal
+		}
+		return status.Errorf(code, "%s: %s", embeddingErr.Code, embeddingErr.Message)
+	}
+
+	var dsErr *datasource.DataSourceError
+	if errors.As(err, &dsErr) {
+		code := codes.Internal
+		switch dsErr.Code {
+		case datasource.ErrCodeNotFound:
+			code = codes.NotFound
+		case datasource.ErrCodeInvalidSource, datasource.ErrCodeInvalidFormat:
+			code = codes.InvalidArgument
+		case datasource.ErrCodeAccessDenied:
+			code = codes.PermissionDenied
+		case datasource.ErrCodeRateLimitExceeded:
+			code = codes.ResourceExhausted
+		}
+		return status.Errorf(code, "%s: %s", dsErr.Code, dsErr.Message)
+	}
+
+	var llmErr *llm.LLMError
+	if errors.As(err, &llmErr) {
+		return status.Error(codes.Unavailable, llmErr.Message)
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "request timed out")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	}
+
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,184 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	kbservicev1 "github.com/Abraxas-365/kbservice/proto/kbservice/v1"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// KnowledgeBaseServer implements kbservicev1.KnowledgeBaseServiceServer on top of
+// a KnowledgeBase
+type KnowledgeBaseServer struct {
+	kbservicev1.UnimplementedKnowledgeBaseServiceServer
+
+	kb   *kb.KnowledgeBase
+	llm  llm.LLM
+	mem  *chathistory.Memory
+	opts *Options
+}
+
+// NewKnowledgeBaseServer creates a KnowledgeBaseServer. Query needs model, and
+// queries with a conversation ID need mem; either may be nil otherwise.
+func NewKnowledgeBaseServer(knowledgeBase *kb.KnowledgeBase, model llm.LLM, mem *chathistory.Memory, opts ...Option) *KnowledgeBaseServer {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &KnowledgeBaseServer{
+		kb:   knowledgeBase,
+		llm:  model,
+		mem:  mem,
+		opts: options,
+	}
+}
+
+func (s *KnowledgeBaseServer) Search(ctx context.Context, req *kbservicev1.SearchRequest) (*kbservicev1.SearchResponse, error) {
+	if req.GetQuery() == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+
+	docs, err := s.search(ctx, req.GetQuery(), req.GetLimit(), req.GetFilter())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return s.searchResponse(docs)
+}
+
+func (s *KnowledgeBaseServer) Query(req *kbservicev1.QueryRequest, stream kbservicev1.KnowledgeBaseService_QueryServer) error {
+	ctx := stream.Context()
+
+	if req.GetQuery() == "" {
+		return status.Error(codes.InvalidArgument, "query is required")
+	}
+	if s.llm == nil {
+		return status.Error(codes.Unimplemented, "no LLM configured")
+	}
+	if req.GetConversationId() != "" && s.mem == nil {
+		return status.Error(codes.InvalidArgument, "conversations are not enabled")
+	}
+
+	docs, err := s.kb.Retrieve(ctx, req.GetQuery(), s.limit(req.GetLimit()), vectorstore.Filter(fromStruct(req.GetFilter())))
+	if err != nil {
+		return toStatus(err)
+	}
+
+	var history []llm.Message
+	if req.GetConversationId() != "" {
+		history, err = s.mem.GetMessages(ctx, req.GetConversationId(), 0)
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+
+	sources, err := s.searchResponse(docs)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&kbservicev1.QueryResponse{Event: &kbservicev1.QueryResponse_Sources{Sources: sources}}); err != nil {
+		return err
+	}
+
+	deltas, err := s.llm.ChatStream(ctx, kb.RAGMessages(s.opts.RAGPrompt, docs, history, req.GetQuery()))
+	if err != nil {
+		return toStatus(err)
+	}
+
+	// Deltas are forwarded as they arrive and collected for the final answer
+	collected := make(chan llm.StreamResponse)
+	result := make(chan collectResult, 1)
+	go func() {
+		answer, err := llm.CollectStream(collected)
+		result <- collectResult{answer, err}
+	}()
+
+	for resp := range deltas {
+		collected <- resp
+		if resp.Error != nil || (resp.Message.Content == "" && len(resp.Message.ToolCalls) == 0) {
+			continue
+		}
+		if err := stream.Send(&kbservicev1.QueryResponse{Event: &kbservicev1.QueryResponse_Delta{Delta: toProtoMessage(resp.Message)}}); err != nil {
+			close(collected)
+			// Let the adapter finish sending so its goroutine can exit
+			go func() {
+				for range deltas {
+				}
+			}()
+			return err
+		}
+	}
+	close(collected)
+
+	res := <-result
+	if res.err != nil {
+		return toStatus(res.err)
+	}
+
+	if conversationID := req.GetConversationId(); conversationID != "" {
+		if err := s.mem.AddMessage(ctx, conversationID, llm.Message{Role: llm.RoleUser, Content: req.GetQuery()}); err != nil {
+			return toStatus(err)
+		}
+		if err := s.mem.AddMessage(ctx, conversationID, *res.answer); err != nil {
+			return toStatus(err)
+		}
+	}
+
+	return stream.Send(&kbservicev1.QueryResponse{Event: &kbservicev1.QueryResponse_Answer{Answer: toProtoMessage(*res.answer)}})
+}
+
+func (s *KnowledgeBaseServer) Ingest(ctx context.Context, req *kbservicev1.IngestRequest) (*kbservicev1.IngestResponse, error) {
+	if req.GetSource() == "" {
+		return nil, status.Error(codes.InvalidArgument, "source is required")
+	}
+	if req.GetText() == "" {
+		return nil, status.Error(codes.InvalidArgument, "text is required")
+	}
+
+	if err := s.kb.AddText(ctx, req.GetSource(), req.GetText(), fromStruct(req.GetMetadata())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.IngestResponse{}, nil
+}
+
+func (s *KnowledgeBaseServer) DeleteSource(ctx context.Context, req *kbservicev1.DeleteSourceRequest) (*kbservicev1.DeleteSourceResponse, error) {
+	if req.GetSource() == "" {
+		return nil, status.Error(codes.InvalidArgument, "source is required")
+	}
+
+	if err := s.kb.DeleteSource(ctx, req.GetSource()); err != nil {
+		return nil, toStatus(err)
+	}
+	return &kbservicev1.DeleteSourceResponse{}, nil
+}
+
+func (s *KnowledgeBaseServer) search(ctx context.Context, query string, limit int32, filter *structpb.Struct) ([]vectorstore.Document, error) {
+	return s.kb.SimilaritySearch(ctx, query, s.limit(limit), vectorstore.Filter(fromStruct(filter)))
+}
+
+// limit returns the requested number of results, or the default for none
+func (s *KnowledgeBaseServer) limit(limit int32) int {
+	if limit <= 0 {
+		return s.opts.SearchLimit
+	}
+	return int(limit)
+}
+
+func (s *KnowledgeBaseServer) searchResponse(docs []vectorstore.Document) (*kbservicev1.SearchResponse, error) {
+	protoDocs, err := toProtoDocuments(docs)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode document metadata: %v", err)
+	}
+	return &kbservicev1.SearchResponse{Documents: protoDocs}, nil
+}
+
+type collectResult struct {
+	answer *llm.Message
+	err    error
+}
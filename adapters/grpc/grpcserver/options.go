@@ -0,0 +1,33 @@
+package grpcserver
+
+import "github.com/Abraxas-365/kbservice/kb"
+
+// Options contains configuration for KnowledgeBaseServer
+type Options struct {
+	SearchLimit int    // Number of documents retrieved when a request sets no limit
+	RAGPrompt   string // System prompt the retrieved documents are appended to
+}
+
+// Option is a function type to modify Options
+type Option func(*Options)
+
+func defaultOptions() *Options {
+	return &Options{
+		SearchLimit: 4,
+		RAGPrompt:   kb.DefaultRAGPrompt,
+	}
+}
+
+// WithSearchLimit sets the number of documents retrieved when a request sets no limit
+func WithSearchLimit(limit int) Option {
+	return func(o *Options) {
+		o.SearchLimit = limit
+	}
+}
+
+// WithRAGPrompt sets the system prompt the retrieved documents are appended to
+func WithRAGPrompt(prompt string) Option {
+	return func(o *Options) {
+		o.RAGPrompt = prompt
+	}
+}
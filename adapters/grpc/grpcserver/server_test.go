@@ -0,0 +1,291 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/mocks"
+	kbservicev1 "github.com/Abraxas-365/kbservice/proto/kbservice/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// rateLimitedEmbedder is a mocks.Embedder whose queries for "rate limited"
+// fail with ErrCodeRateLimitExceeded
+func rateLimitedEmbedder() *mocks.Embedder {
+	embedder := mocks.NewEmbedder(mocks.DefaultDimension)
+	embedder.EmbedQueryFunc = func(ctx context.Context, text string) ([]float32, error) {
+		if text == "rate limited" {
+			return nil, &embedding.EmbeddingError{Op: "EmbedQuery", Code: embedding.ErrCodeRateLimitExceeded, Message: "slow down"}
+		}
+		return mocks.HashVector(text, mocks.DefaultDimension), nil
+	}
+	return embedder
+}
+
+// failStreamAfterFirstWord makes model's streams fail with err after their first delta
+func failStreamAfterFirstWord(model *mocks.LLM, err error) {
+	model.ChatStreamFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+		stream := make(chan llm.StreamResponse, 2)
+		stream <- llm.StreamResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: "Paris "}}
+		stream <- llm.StreamResponse{Error: err, Done: true}
+		close(stream)
+		return stream, nil
+	}
+}
+
+type testClients struct {
+	kb   kbservicev1.KnowledgeBaseServiceClient
+	chat kbservicev1.ChatHistoryServiceClient
+	mem  *chathistory.Memory
+	llm  *mocks.LLM
+}
+
+// newTestClients serves both services over an in-memory connection
+func newTestClients(t *testing.T) *testClients {
+	t.Helper()
+
+	knowledgeBase, err := kb.New(rateLimitedEmbedder(), mocks.NewStore(), document.NewCharacterSplitter(1000, 0, ""))
+	if err != nil {
+		t.Fatalf("kb.New() error = %v", err)
+	}
+	mem := chathistory.New(mocks.NewChatHistoryRepository())
+	model := mocks.NewLLM("Paris is the capital")
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	kbservicev1.RegisterKnowledgeBaseServiceServer(server, NewKnowledgeBaseServer(knowledgeBase, model, mem))
+	kbservicev1.RegisterChatHistoryServiceServer(server, NewChatHistoryServer(mem))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &testClients{
+		kb:   kbservicev1.NewKnowledgeBaseServiceClient(conn),
+		chat: kbservicev1.NewChatHistoryServiceClient(conn),
+		mem:  mem,
+		llm:  model,
+	}
+}
+
+func TestKnowledgeBaseServer_IngestSearchDelete(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClients(t)
+
+	metadata, _ := structpb.NewStruct(map[string]interface{}{"lang": "en"})
+	if _, err := c.kb.Ingest(ctx, &kbservicev1.IngestRequest{Source: "docs/france.md", Text: "Paris is the capital of France", Metadata: metadata}); err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+
+	resp, err := c.kb.Search(ctx, &kbservicev1.SearchRequest{Query: "capital"})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(resp.GetDocuments()) != 1 {
+		t.Fatalf("Search() returned %d documents, want 1", len(resp.GetDocuments()))
+	}
+	fields := resp.GetDocuments()[0].GetMetadata().GetFields()
+	if fields["source"].GetStringValue() != "docs/france.md" || fields["lang"].GetStringValue() != "en" {
+		t.Errorf("document metadata = %v, want source and lang", fields)
+	}
+
+	if _, err := c.kb.DeleteSource(ctx, &kbservicev1.DeleteSourceRequest{Source: "docs/france.md"}); err != nil {
+		t.Fatalf("DeleteSource() error = %v", err)
+	}
+	resp, err = c.kb.Search(ctx, &kbservicev1.SearchRequest{Query: "capital"})
+	if err != nil || len(resp.GetDocuments()) != 0 {
+		t.Errorf("Search() after delete = %v, %v, want no documents", resp.GetDocuments(), err)
+	}
+}
+
+func TestKnowledgeBaseServer_Query(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClients(t)
+
+	if _, err := c.kb.Ingest(ctx, &kbservicev1.IngestRequest{Source: "docs/france.md", Text: "Paris is the capital of France"}); err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	conv, err := c.chat.CreateConversation(ctx, &kbservicev1.CreateConversationRequest{})
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+
+	stream, err := c.kb.Query(ctx, &kbservicev1.QueryRequest{Query: "What is the capital of France?", ConversationId: conv.GetId()})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var events []string
+	var deltas strings.Builder
+	var answer *kbservicev1.Message
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		switch event := resp.GetEvent().(type) {
+		case *kbservicev1.QueryResponse_Sources:
+			events = append(events, "sources")
+		case *kbservicev1.QueryResponse_Delta:
+			events = append(events, "delta")
+			deltas.WriteString(event.Delta.GetContent())
+		case *kbservicev1.QueryResponse_Answer:
+			events = append(events, "answer")
+			answer = event.Answer
+		}
+	}
+
+	if got := strings.Join(events, ","); got != "sources,delta,delta,delta,delta,answer" {
+		t.Errorf("events = %s", got)
+	}
+	if deltas.String() != "Paris is the capital" || answer.GetContent() != "Paris is the capital" || answer.GetStopReason() != "stop" {
+		t.Errorf("deltas = %q, answer = %v", deltas.String(), answer)
+	}
+
+	messages, err := c.chat.GetMessages(ctx, &kbservicev1.GetMessagesRequest{ConversationId: conv.GetId()})
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(messages.GetMessages()) != 2 {
+		t.Errorf("conversation has %d messages, want question and answer", len(messages.GetMessages()))
+	}
+}
+
+func TestKnowledgeBaseServer_QueryLLMError(t *testing.T) {
+	c := newTestClients(t)
+	failStreamAfterFirstWord(c.llm, &llm.LLMError{Op: "ChatStream", Message: "stream error"})
+
+	stream, err := c.kb.Query(context.Background(), &kbservicev1.QueryRequest{Query: "q"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	for {
+		_, err = stream.Recv()
+		if err != nil {
+			break
+		}
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv() error = %v, want %s", err, codes.Unavailable)
+	}
+}
+
+func TestChatHistoryServer(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClients(t)
+
+	metadata, _ := structpb.NewStruct(map[string]interface{}{"user": "u1"})
+	conv, err := c.chat.CreateConversation(ctx, &kbservicev1.CreateConversationRequest{Metadata: metadata})
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+
+	if _, err := c.chat.AddMessage(ctx, &kbservicev1.AddMessageRequest{ConversationId: conv.GetId(), Message: &kbservicev1.Message{Content: "hello"}}); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+
+	got, err := c.chat.GetConversation(ctx, &kbservicev1.GetConversationRequest{Id: conv.GetId()})
+	if err != nil {
+		t.Fatalf("GetConversation() error = %v", err)
+	}
+	if len(got.GetMessages()) != 1 || got.GetMessages()[0].GetRole() != llm.RoleUser {
+		t.Errorf("GetConversation() messages = %v, want one user message", got.GetMessages())
+	}
+
+	updated, _ := structpb.NewStruct(map[string]interface{}{"user": "u2"})
+	if _, err := c.chat.UpdateConversationMetadata(ctx, &kbservicev1.UpdateConversationMetadataRequest{Id: conv.GetId(), Metadata: updated}); err != nil {
+		t.Fatalf("UpdateConversationMetadata() error = %v", err)
+	}
+
+	list, err := c.chat.ListConversations(ctx, &kbservicev1.ListConversationsRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListConversations() error = %v", err)
+	}
+	if len(list.GetConversations()) != 1 || list.GetConversations()[0].GetMetadata().GetFields()["user"].GetStringValue() != "u2" {
+		t.Errorf("ListConversations() = %v", list.GetConversations())
+	}
+
+	if _, err := c.chat.ClearHistory(ctx, &kbservicev1.ClearHistoryRequest{ConversationId: conv.GetId()}); err != nil {
+		t.Fatalf("ClearHistory() error = %v", err)
+	}
+	if _, err := c.chat.DeleteConversation(ctx, &kbservicev1.DeleteConversationRequest{Id: conv.GetId()}); err != nil {
+		t.Fatalf("DeleteConversation() error = %v", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClients(t)
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{
+			name: "Unknown conversation",
+			call: func() error {
+				_, err := c.chat.GetConversation(ctx, &kbservicev1.GetConversationRequest{Id: "missing"})
+				return err
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "Missing query",
+			call: func() error {
+				_, err := c.kb.Search(ctx, &kbservicev1.SearchRequest{})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "Embedding rate limit",
+			call: func() error {
+				_, err := c.kb.Search(ctx, &kbservicev1.SearchRequest{Query: "rate limited"})
+				return err
+			},
+			want: codes.ResourceExhausted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != tt.want {
+				t.Errorf("status code = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToStatus_HidesUntypedErrors(t *testing.T) {
+	err := toStatus(errors.New("dial tcp 10.0.0.1: password rejected"))
+	if status.Code(err) != codes.Internal || strings.Contains(err.Error(), "password") {
+		t.Errorf("toStatus() = %v, want an internal error without details", err)
+	}
+}
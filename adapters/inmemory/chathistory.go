@@ -3,7 +3,9 @@ package inmemory
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,15 +16,46 @@ import (
 
 // InMemoryRepository implements ChatHistoryRepository using in-memory storage
 type InMemoryRepository struct {
-	conversations map[string]chathistory.Conversation
-	mu            sync.RWMutex
+	conversations  map[string]chathistory.Conversation
+	mu             sync.RWMutex
+	excludeExpired bool
+}
+
+// RepositoryOption configures an InMemoryRepository
+type RepositoryOption func(*InMemoryRepository)
+
+// WithExcludeExpired makes reads treat conversations past their expiry as
+// deleted until PurgeExpired removes them, like the Postgres option
+func WithExcludeExpired() RepositoryOption {
+	return func(r *InMemoryRepository) {
+		r.excludeExpired = true
+	}
 }
 
 // NewInMemoryRepository creates a new in-memory repository
-func NewInMemoryRepository() *InMemoryRepository {
-	return &InMemoryRepository{
+func NewInMemoryRepository(opts ...RepositoryOption) *InMemoryRepository {
+	r := &InMemoryRepository{
 		conversations: make(map[string]chathistory.Conversation),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// readConversation returns the conversation for a read, which doesn't see
+// expired conversations when they are excluded
+func (r *InMemoryRepository) readConversation(conversationID string) (chathistory.Conversation, bool) {
+	conv, exists := r.conversations[conversationID]
+	if !exists || (r.excludeExpired && expired(conv, time.Now())) {
+		return chathistory.Conversation{}, false
+	}
+	return conv, true
+}
+
+// expired reports whether conv expired at or before now
+func expired(conv chathistory.Conversation, now time.Time) bool {
+	return conv.ExpiresAt != nil && !conv.ExpiresAt.After(now)
 }
 
 func (r *InMemoryRepository) AddMessage(ctx context.Context, conversationID string, message llm.Message) error {
@@ -31,23 +64,49 @@ func (r *InMemoryRepository) AddMessage(ctx context.Context, conversationID stri
 
 	conv, exists := r.conversations[conversationID]
 	if !exists {
-		return fmt.Errorf("conversation not found: %s", conversationID)
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
-	conv.Messages = append(conv.Messages, message)
 	conv.UpdatedAt = time.Now()
+	conv.Messages = append(conv.Messages, stampMessage(message, conv.UpdatedAt))
 	r.conversations[conversationID] = conv
 
 	return nil
 }
 
+// stampMessage returns message with CreatedAt set to now when it is zero, as
+// the Postgres repository does
+func stampMessage(message llm.Message, now time.Time) llm.Message {
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = now
+	}
+	return message
+}
+
+// AddMessageAutoCreate creates conv if its ID is unknown and appends message under a single lock
+func (r *InMemoryRepository) AddMessageAutoCreate(ctx context.Context, conv chathistory.Conversation, message llm.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.conversations[conv.ID]
+	if !exists {
+		existing = conv
+	}
+
+	existing.UpdatedAt = time.Now()
+	existing.Messages = append(existing.Messages, stampMessage(message, existing.UpdatedAt))
+	r.conversations[conv.ID] = existing
+
+	return nil
+}
+
 func (r *InMemoryRepository) GetMessages(ctx context.Context, conversationID string, limit int) ([]llm.Message, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	conv, exists := r.conversations[conversationID]
+	conv, exists := r.readConversation(conversationID)
 	if !exists {
-		return nil, fmt.Errorf("conversation not found: %s", conversationID)
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	if limit <= 0 || limit > len(conv.Messages) {
@@ -66,9 +125,9 @@ func (r *InMemoryRepository) GetMessagesByFilter(ctx context.Context, conversati
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	conv, exists := r.conversations[conversationID]
+	conv, exists := r.readConversation(conversationID)
 	if !exists {
-		return nil, fmt.Errorf("conversation not found: %s", conversationID)
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	var filtered []llm.Message
@@ -90,13 +149,45 @@ func (r *InMemoryRepository) GetMessagesByFilter(ctx context.Context, conversati
 	return filtered[start:], nil
 }
 
+// GetMessagesPage returns up to limit messages after cursor, which is the
+// number of messages already read
+func (r *InMemoryRepository) GetMessagesPage(ctx context.Context, conversationID, cursor string, limit int) ([]llm.Message, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conv, exists := r.readConversation(conversationID)
+	if !exists {
+		return nil, "", fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	offset := 0
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+	if offset > len(conv.Messages) {
+		offset = len(conv.Messages)
+	}
+
+	end := len(conv.Messages)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	page := make([]llm.Message, end-offset)
+	copy(page, conv.Messages[offset:end])
+	return page, strconv.Itoa(end), nil
+}
+
 func (r *InMemoryRepository) DeleteMessages(ctx context.Context, conversationID string, filter chathistory.Filter) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	conv, exists := r.conversations[conversationID]
 	if !exists {
-		return fmt.Errorf("conversation not found: %s", conversationID)
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	var remaining []llm.Message
@@ -119,7 +210,7 @@ func (r *InMemoryRepository) ClearHistory(ctx context.Context, conversationID st
 
 	conv, exists := r.conversations[conversationID]
 	if !exists {
-		return fmt.Errorf("conversation not found: %s", conversationID)
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	conv.Messages = []llm.Message{}
@@ -134,7 +225,7 @@ func (r *InMemoryRepository) DeleteConversation(ctx context.Context, conversatio
 	defer r.mu.Unlock()
 
 	if _, exists := r.conversations[conversationID]; !exists {
-		return fmt.Errorf("conversation not found: %s", conversationID)
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	delete(r.conversations, conversationID)
@@ -157,9 +248,9 @@ func (r *InMemoryRepository) GetConversation(ctx context.Context, conversationID
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	conv, exists := r.conversations[conversationID]
+	conv, exists := r.readConversation(conversationID)
 	if !exists {
-		return nil, fmt.Errorf("conversation not found: %s", conversationID)
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	return &conv, nil
@@ -169,8 +260,12 @@ func (r *InMemoryRepository) ListConversations(ctx context.Context, filter chath
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	now := time.Now()
 	var conversations []chathistory.Conversation
 	for _, conv := range r.conversations {
+		if r.excludeExpired && expired(conv, now) {
+			continue
+		}
 		if r.conversationMatchesFilter(conv, filter) {
 			conversations = append(conversations, conv)
 		}
@@ -199,7 +294,7 @@ func (r *InMemoryRepository) UpdateConversationMetadata(ctx context.Context, con
 
 	conv, exists := r.conversations[conversationID]
 	if !exists {
-		return fmt.Errorf("conversation not found: %s", conversationID)
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	conv.Metadata = metadata
@@ -209,13 +304,95 @@ func (r *InMemoryRepository) UpdateConversationMetadata(ctx context.Context, con
 	return nil
 }
 
+// ReplaceMessages replaces the messages and metadata of a conversation under a single lock
+func (r *InMemoryRepository) ReplaceMessages(ctx context.Context, conversationID string, messages []llm.Message, metadata map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	conv.Messages = append([]llm.Message{}, messages...)
+	conv.Metadata = metadata
+	conv.UpdatedAt = time.Now()
+	r.conversations[conversationID] = conv
+
+	return nil
+}
+
+// SetConversationExpiry sets when the conversation expires, or clears its
+// expiry when expiresAt is nil
+func (r *InMemoryRepository) SetConversationExpiry(ctx context.Context, conversationID string, expiresAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	conv.ExpiresAt = expiresAt
+	r.conversations[conversationID] = conv
+	return nil
+}
+
+// PurgeExpired deletes the conversations that expired at or before now
+func (r *InMemoryRepository) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, conv := range r.conversations {
+		if expired(conv, now) {
+			delete(r.conversations, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// GetFirstMessage returns the oldest message of the conversation with one of roles
+func (r *InMemoryRepository) GetFirstMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	return r.findMessage(conversationID, roles, false)
+}
+
+// GetLastMessage returns the newest message of the conversation with one of roles
+func (r *InMemoryRepository) GetLastMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	return r.findMessage(conversationID, roles, true)
+}
+
+// findMessage scans the conversation from the start, or from the end when last is set
+func (r *InMemoryRepository) findMessage(conversationID string, roles []string, last bool) (*llm.Message, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conv, exists := r.readConversation(conversationID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	filter := chathistory.Filter{Roles: roles}
+	for i := range conv.Messages {
+		if last {
+			i = len(conv.Messages) - 1 - i
+		}
+		if r.messageMatchesFilter(conv.Messages[i], filter) {
+			msg := conv.Messages[i]
+			return &msg, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", chathistory.ErrMessageNotFound, conversationID)
+}
+
 func (r *InMemoryRepository) GetMessageCount(ctx context.Context, conversationID string, filter chathistory.Filter) (int, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	conv, exists := r.conversations[conversationID]
+	conv, exists := r.readConversation(conversationID)
 	if !exists {
-		return 0, fmt.Errorf("conversation not found: %s", conversationID)
+		return 0, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
 	}
 
 	if filter.IsEmpty() {
@@ -233,20 +410,12 @@ func (r *InMemoryRepository) GetMessageCount(ctx context.Context, conversationID
 }
 
 func (r *InMemoryRepository) messageMatchesFilter(msg llm.Message, filter chathistory.Filter) bool {
-	if filter.StartTime != nil && msg.Metadata != nil {
-		if timestamp, ok := msg.Metadata["timestamp"].(time.Time); ok {
-			if timestamp.Before(*filter.StartTime) {
-				return false
-			}
-		}
+	if filter.StartTime != nil && msg.CreatedAt.Before(*filter.StartTime) {
+		return false
 	}
 
-	if filter.EndTime != nil && msg.Metadata != nil {
-		if timestamp, ok := msg.Metadata["timestamp"].(time.Time); ok {
-			if timestamp.After(*filter.EndTime) {
-				return false
-			}
-		}
+	if filter.EndTime != nil && msg.CreatedAt.After(*filter.EndTime) {
+		return false
 	}
 
 	if len(filter.Roles) > 0 {
@@ -268,7 +437,7 @@ func (r *InMemoryRepository) messageMatchesFilter(msg llm.Message, filter chathi
 		}
 	}
 
-	return true
+	return metadataMatches(msg.Metadata, filter.Metadata)
 }
 
 func (r *InMemoryRepository) conversationMatchesFilter(conv chathistory.Conversation, filter chathistory.Filter) bool {
@@ -280,13 +449,57 @@ func (r *InMemoryRepository) conversationMatchesFilter(conv chathistory.Conversa
 		return false
 	}
 
-	if filter.Metadata != nil {
-		for k, v := range filter.Metadata {
-			if convValue, exists := conv.Metadata[k]; !exists || convValue != v {
-				return false
+	return metadataMatches(conv.Metadata, filter.Metadata)
+}
+
+// metadataMatches reports whether metadata has every key of want with an equal
+// value. Values are compared deeply, since message metadata can hold maps.
+func metadataMatches(metadata, want map[string]any) bool {
+	for k, v := range want {
+		if value, exists := metadata[k]; !exists || !reflect.DeepEqual(value, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *InMemoryRepository) SearchConversations(ctx context.Context, query string, limit, offset int) ([]chathistory.ConversationMatch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	filter := chathistory.Filter{Search: query}
+	now := time.Now()
+	var matches []chathistory.ConversationMatch
+	for _, conv := range r.conversations {
+		if r.excludeExpired && expired(conv, now) {
+			continue
+		}
+
+		match := chathistory.ConversationMatch{}
+		for _, msg := range conv.Messages {
+			if !r.messageMatchesFilter(msg, filter) {
+				continue
 			}
+			match.Matches++
+			if match.Matches == 1 || !msg.CreatedAt.Before(match.LastMatchAt) {
+				match.Snippet = chathistory.MatchSnippet(msg.Content, query)
+				match.LastMatchAt = msg.CreatedAt
+			}
+		}
+		if match.Matches > 0 {
+			match.Conversation = conv
+			match.Conversation.Messages = nil
+			matches = append(matches, match)
 		}
 	}
 
-	return true
+	chathistory.SortConversationMatches(matches)
+	if offset >= len(matches) {
+		return []chathistory.ConversationMatch{}, nil
+	}
+	matches = matches[offset:]
+	if limit > 0 && limit < len(matches) {
+		matches = matches[:limit]
+	}
+	return matches, nil
 }
@@ -0,0 +1,84 @@
+package inmemory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/chathistory/repotest"
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func TestInMemoryRepository_Conformance(t *testing.T) {
+	repotest.RunConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_MessagePagerConformance(t *testing.T) {
+	repotest.RunMessagePagerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_MessageReplacerConformance(t *testing.T) {
+	repotest.RunMessageReplacerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_MessageFinderConformance(t *testing.T) {
+	repotest.RunMessageFinderConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_ConversationSearcherConformance(t *testing.T) {
+	repotest.RunConversationSearcherConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_ConversationExpirerConformance(t *testing.T) {
+	repotest.RunConversationExpirerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository()
+	})
+}
+
+func TestInMemoryRepository_ExcludeExpiredConformance(t *testing.T) {
+	repotest.RunExcludeExpiredConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		return NewInMemoryRepository(WithExcludeExpired())
+	})
+}
+
+func TestInMemoryRepository_AddMessageAutoCreate(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	conv := chathistory.Conversation{
+		ID:        "conv-1",
+		Metadata:  map[string]any{"user": "u1"},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if err := repo.AddMessageAutoCreate(ctx, conv, llm.Message{Role: llm.UserRole, Content: "first"}); err != nil {
+		t.Fatalf("AddMessageAutoCreate() error = %v", err)
+	}
+
+	conv.Metadata = map[string]any{"user": "u2"}
+	if err := repo.AddMessageAutoCreate(ctx, conv, llm.Message{Role: llm.AssistantRole, Content: "second"}); err != nil {
+		t.Fatalf("AddMessageAutoCreate() error = %v", err)
+	}
+
+	got, err := repo.GetConversation(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("GetConversation() error = %v", err)
+	}
+	if got.Metadata["user"] != "u1" {
+		t.Errorf("Metadata = %v, want the metadata from creation", got.Metadata)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Content != "first" || got.Messages[1].Content != "second" {
+		t.Errorf("Messages = %v, want first then second", got.Messages)
+	}
+}
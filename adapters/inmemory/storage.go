@@ -0,0 +1,160 @@
+package inmemory
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+type memoryObject struct {
+	data []byte
+	info storage.ObjectInfo
+}
+
+// InMemoryDataStore implements storage.DataStore in memory, mainly for tests
+type InMemoryDataStore struct {
+	objects map[string]memoryObject
+	mu      sync.RWMutex
+}
+
+// NewInMemoryDataStore creates a new in-memory data store
+func NewInMemoryDataStore() *InMemoryDataStore {
+	return &InMemoryDataStore{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+func (s *InMemoryDataStore) Put(ctx context.Context, key string, data io.Reader, options ...storage.PutOption) error {
+	opts := &storage.PutOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	data, err := opts.ResolveContentType(key, data)
+	if err != nil {
+		return err
+	}
+
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to read data")
+	}
+
+	if err := opts.VerifyChecksums("Put", key, bytes.NewReader(content)); err != nil {
+		return err
+	}
+
+	sum := md5.Sum(content)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = memoryObject{
+		data: content,
+		info: storage.ObjectInfo{
+			Key:          key,
+			Size:         int64(len(content)),
+			LastModified: time.Now(),
+			ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+			ContentType:  opts.ContentType,
+			Metadata:     opts.Metadata,
+		},
+	}
+
+	return nil
+}
+
+func (s *InMemoryDataStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, exists := s.objects[key]
+	if !exists {
+		return nil, storage.NewStorageError("Get", key, nil, storage.ErrCodeNotFound, "object not found")
+	}
+
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *InMemoryDataStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *InMemoryDataStore) DeleteMany(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return storage.NewStorageError("DeleteMany", "", err, storage.ErrCodeInternal, "delete canceled")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.objects, key)
+	}
+	return nil
+}
+
+func (s *InMemoryDataStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, storage.NewStorageError("DeletePrefix", prefix, err, storage.ErrCodeInternal, "delete canceled")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.objects, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *InMemoryDataStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []storage.ObjectInfo
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info)
+		}
+	}
+
+	// Match S3, which lists keys in lexicographical order
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
+
+func (s *InMemoryDataStore) Exists(ctx context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.objects[key]
+	return exists, nil
+}
+
+func (s *InMemoryDataStore) GetPresignedPutURL(ctx context.Context, key string, expires time.Duration, options ...storage.PresignedPutOption) (storage.PresignedURL, error) {
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedPutURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the in-memory store")
+}
+
+func (s *InMemoryDataStore) GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (storage.PresignedURL, error) {
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedGetURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the in-memory store")
+}
@@ -0,0 +1,87 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+func TestInMemoryDataStore_BulkDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryDataStore()
+	for _, key := range []string{"tenant/a", "tenant/b", "tenant/c/d", "other/a"} {
+		if err := store.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	if err := store.DeleteMany(ctx, []string{"tenant/a", "missing"}); err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+
+	count, err := store.DeletePrefix(ctx, "tenant/")
+	if err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("DeletePrefix() = %d, want 2", count)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "other/a" {
+		t.Errorf("List() = %v, want only other/a", objects)
+	}
+}
+
+func TestInMemoryDataStore_DeletePrefixCanceled(t *testing.T) {
+	store := NewInMemoryDataStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.DeletePrefix(ctx, "tenant/"); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeletePrefix() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestInMemoryDataStore_PutAutoContentType(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryDataStore()
+
+	if err := store.Put(ctx, "images/logo.png", strings.NewReader("png"), storage.WithAutoContentType()); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, "pages/home", strings.NewReader("<html><body>hi</body></html>"), storage.WithAutoContentType()); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	want := map[string]string{
+		"images/logo.png": "image/png",
+		"pages/home":      "text/html; charset=utf-8",
+	}
+	for _, obj := range objects {
+		if obj.ContentType != want[obj.Key] {
+			t.Errorf("ContentType of %s = %q, want %q", obj.Key, obj.ContentType, want[obj.Key])
+		}
+	}
+
+	content, err := store.Get(ctx, "pages/home")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(content)
+	if string(data) != "<html><body>hi</body></html>" {
+		t.Errorf("Get() = %q, sniffing lost data", data)
+	}
+}
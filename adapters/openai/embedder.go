@@ -3,7 +3,11 @@ package openai
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/Abraxas-365/kbservice/document"
 	"github.com/Abraxas-365/kbservice/embedding"
 	"github.com/sashabaranov/go-openai"
 )
@@ -11,6 +15,11 @@ import (
 type OpenAIEmbedder struct {
 	client  *openai.Client
 	options *embedding.EmbeddingOptions
+
+	// The model's tokenizer, loaded for MaxTokensPerBatch on first use
+	tokenizerOnce sync.Once
+	tokenizer     *document.TiktokenTokenizer
+	tokenizerErr  error
 }
 
 // DefaultOptions returns the default options for OpenAI embeddings
@@ -23,35 +32,104 @@ func DefaultOptions() *embedding.EmbeddingOptions {
 	}
 }
 
+// clientOption changes the client config of an OpenAIEmbedder
+type clientOption func(*openai.ClientConfig)
+
+// WithBaseURL sends the embedder's requests to baseURL, such as a gateway in
+// front of the OpenAI API, instead of the public endpoint
+func WithBaseURL(baseURL string) embedding.Option {
+	return embedding.WithProviderOption(clientOption(func(config *openai.ClientConfig) {
+		config.BaseURL = baseURL
+	}))
+}
+
+// WithHTTPClient sends the embedder's requests with client, e.g. one with its
+// own transport or timeout
+func WithHTTPClient(client *http.Client) embedding.Option {
+	return embedding.WithProviderOption(clientOption(func(config *openai.ClientConfig) {
+		config.HTTPClient = client
+	}))
+}
+
+// WithAzureDeployment sends the embedder's requests to an Azure OpenAI
+// deployment, authenticated with the API key given to the embedder. endpoint
+// is the resource's endpoint, such as https://my-resource.openai.azure.com,
+// and every model is served by the deployment.
+func WithAzureDeployment(endpoint, deployment, apiVersion string) embedding.Option {
+	return embedding.WithProviderOption(clientOption(func(config *openai.ClientConfig) {
+		config.APIType = openai.APITypeAzure
+		config.BaseURL = endpoint
+		config.APIVersion = apiVersion
+		config.AzureModelMapperFunc = func(model string) string {
+			return deployment
+		}
+	}))
+}
+
 // NewOpenAIEmbedder creates a new OpenAI embedder with the given API key and options
 func NewOpenAIEmbedder(apiKey string, opts ...embedding.Option) *OpenAIEmbedder {
+	return NewOpenAIEmbedderWithConfig(openai.DefaultConfig(apiKey), opts...)
+}
+
+// NewOpenAIEmbedderWithConfig creates an OpenAIEmbedder from a client config,
+// e.g. for Azure OpenAI, a custom base URL or an HTTP client with its own
+// transport. Options such as WithBaseURL are applied on top of config.
+func NewOpenAIEmbedderWithConfig(config openai.ClientConfig, opts ...embedding.Option) *OpenAIEmbedder {
 	options := DefaultOptions()
 	for _, opt := range opts {
 		opt(options)
 	}
-
-	client := openai.NewClient(apiKey)
+	for _, opt := range options.ProviderOptions {
+		if apply, ok := opt.(clientOption); ok {
+			apply(&config)
+		}
+	}
 
 	return &OpenAIEmbedder{
-		client:  client,
+		client:  openai.NewClientWithConfig(config),
 		options: options,
 	}
 }
 
+// Model returns the embedding model used by the embedder
+func (e *OpenAIEmbedder) Model() string {
+	return e.options.Model
+}
+
+// Dimension returns the vector size set with embedding.WithDimensions, or 0
+// when the model's default size is used
+func (e *OpenAIEmbedder) Dimension() int {
+	return e.options.Dimensions
+}
+
 // EmbedDocuments implements the Embedder interface
 func (e *OpenAIEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
 	if len(documents) == 0 {
 		return nil, embedding.ErrEmptyInput("EmbedDocuments")
 	}
 
+	if e.options.MaxTokensPerBatch > 0 {
+		return e.embedInTokenBatches(ctx, documents)
+	}
+
+	if e.options.IsolateFailures {
+		return embedding.EmbedIsolated(ctx, documents, e.options.BatchSize, e.createEmbeddings)
+	}
+
 	// Process in batches if needed
 	if len(documents) > e.options.BatchSize {
 		return e.embedInBatches(ctx, documents)
 	}
 
+	return e.createEmbeddings(ctx, documents)
+}
+
+// createEmbeddings embeds documents in a single request
+func (e *OpenAIEmbedder) createEmbeddings(ctx context.Context, documents []string) ([][]float32, error) {
 	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Input: documents,
-		Model: openai.EmbeddingModel(e.options.Model),
+		Input:      documents,
+		Model:      openai.EmbeddingModel(e.options.Model),
+		Dimensions: e.options.Dimensions,
 	})
 
 	if err != nil {
@@ -76,8 +154,9 @@ func (e *OpenAIEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32
 	}
 
 	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Input: []string{text},
-		Model: openai.EmbeddingModel(e.options.Model),
+		Input:      []string{text},
+		Model:      openai.EmbeddingModel(e.options.Model),
+		Dimensions: e.options.Dimensions,
 	})
 
 	if err != nil {
@@ -119,6 +198,38 @@ func (e *OpenAIEmbedder) embedInBatches(ctx context.Context, documents []string)
 	return allEmbeddings, nil
 }
 
+// embedInTokenBatches packs documents into requests by token count as well as
+// BatchSize, splitting requests the API rejects for exceeding its token limit
+func (e *OpenAIEmbedder) embedInTokenBatches(ctx context.Context, documents []string) ([][]float32, error) {
+	countTokens, err := e.tokenCounter()
+	if err != nil {
+		return nil, err
+	}
+
+	ends := embedding.TokenBatches(documents, e.options.BatchSize, e.options.MaxTokensPerBatch, countTokens)
+	if e.options.IsolateFailures {
+		return embedding.EmbedIsolatedBatches(ctx, documents, ends, e.createEmbeddings)
+	}
+	return embedding.EmbedBatches(ctx, documents, ends, e.createEmbeddings)
+}
+
+// tokenCounter returns the configured TokenCounter, or the tiktoken encoding
+// of the model
+func (e *OpenAIEmbedder) tokenCounter() (func(text string) int, error) {
+	if e.options.TokenCounter != nil {
+		return e.options.TokenCounter, nil
+	}
+
+	e.tokenizerOnce.Do(func() {
+		e.tokenizer, e.tokenizerErr = document.NewTiktokenTokenizer(e.options.Model)
+	})
+	if e.tokenizerErr != nil {
+		return nil, embedding.NewEmbeddingError("EmbedDocuments", e.tokenizerErr, embedding.ErrCodeInternal,
+			"failed to load tokenizer for batching by tokens")
+	}
+	return e.tokenizer.CountTokens, nil
+}
+
 // handleError converts OpenAI API errors to embedding errors
 func (e *OpenAIEmbedder) handleError(op string, err error) error {
 	if err == nil {
@@ -129,6 +240,9 @@ func (e *OpenAIEmbedder) handleError(op string, err error) error {
 	case *openai.APIError:
 		switch apiErr.HTTPStatusCode {
 		case 400:
+			if isTokenLimitMessage(apiErr.Message) {
+				return embedding.ErrTokenLimitExceeded(op, err)
+			}
 			return embedding.ErrInvalidInput(op, err, apiErr.Message)
 		case 401:
 			return embedding.NewEmbeddingError(op, err, "Unauthorized", "invalid API key")
@@ -147,6 +261,16 @@ func (e *OpenAIEmbedder) handleError(op string, err error) error {
 	}
 }
 
+// isTokenLimitMessage reports whether an API error message is about an input
+// or a request having too many tokens, such as "This model's maximum context
+// length is 8192 tokens" or "Requested 310000 tokens, max 300000 tokens per
+// request"
+func isTokenLimitMessage(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "maximum context length") ||
+		strings.Contains(message, "tokens per request")
+}
+
 // normalizeVector normalizes a vector to unit length
 func normalizeVector(vector []float32) {
 	var sum float32
@@ -0,0 +1,323 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/testing/vcr"
+	"github.com/sashabaranov/go-openai"
+)
+
+// newRecordedEmbedder returns an OpenAIEmbedder whose requests are replayed
+// from testdata/fixtures/<fixture>.json, see package vcr for recording them
+func newRecordedEmbedder(t *testing.T, fixture, apiKey string, opts ...embedding.Option) (*OpenAIEmbedder, *vcr.Recorder) {
+	t.Helper()
+	rec := vcr.New(t, fixture)
+	if apiKey == "" {
+		apiKey = rec.Credential("OPENAI_API_KEY")
+	}
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = rec.Client()
+	return NewOpenAIEmbedderWithConfig(config, opts...), rec
+}
+
+// recordedEmbeddings returns the vectors in the i-th response of rec
+func recordedEmbeddings(t *testing.T, rec *vcr.Recorder, i int) [][]float32 {
+	t.Helper()
+	var resp openai.EmbeddingResponse
+	if err := json.Unmarshal([]byte(rec.Interactions()[i].Response.Body), &resp); err != nil {
+		t.Fatalf("failed to decode recorded response: %v", err)
+	}
+	vectors := make([][]float32, len(resp.Data))
+	for _, item := range resp.Data {
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors
+}
+
+func TestOpenAIEmbedder_Embed(t *testing.T) {
+	ctx := context.Background()
+	embedder, rec := newRecordedEmbedder(t, "embeddings", "",
+		embedding.WithModel(string(openai.SmallEmbedding3)),
+		embedding.WithNormalization(false),
+	)
+
+	documents, err := embedder.EmbedDocuments(ctx, []string{"The sky is blue.", "Grass is green."})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if len(documents) != 2 || len(documents[0]) == 0 || len(documents[0]) != len(documents[1]) {
+		t.Fatalf("EmbedDocuments() = %d vectors, want 2 of the same dimension", len(documents))
+	}
+	if want := recordedEmbeddings(t, rec, 0); !reflect.DeepEqual(documents, want) {
+		t.Error("EmbedDocuments() vectors differ from the API response")
+	}
+
+	query, err := embedder.EmbedQuery(ctx, "What color is the sky?")
+	if err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if want := recordedEmbeddings(t, rec, 1); !reflect.DeepEqual(query, want[0]) {
+		t.Error("EmbedQuery() vector differs from the API response")
+	}
+	if len(query) != len(documents[0]) {
+		t.Errorf("EmbedQuery() dimension = %d, want %d", len(query), len(documents[0]))
+	}
+}
+
+func TestOpenAIEmbedder_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		apiKey   string
+		input    []string
+		wantCode string
+	}{
+		{name: "Invalid API key", fixture: "embeddings_invalid_key", apiKey: "sk-invalid", input: []string{"hello"}, wantCode: "Unauthorized"},
+		{name: "Invalid input", fixture: "embeddings_invalid_input", input: []string{""}, wantCode: embedding.ErrCodeInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder, _ := newRecordedEmbedder(t, tt.fixture, tt.apiKey, embedding.WithModel(string(openai.SmallEmbedding3)))
+
+			_, err := embedder.EmbedDocuments(context.Background(), tt.input)
+			var embErr *embedding.EmbeddingError
+			if !errors.As(err, &embErr) || embErr.Op != "EmbedDocuments" || embErr.Code != tt.wantCode {
+				t.Fatalf("EmbedDocuments() error = %v, want EmbeddingError %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+// newTokenLimitedServer serves embeddings of each input's word count and
+// rejects requests of more than limit words like OpenAI's per-request token
+// limit. The number of inputs of every request is appended to requests.
+func newTokenLimitedServer(t *testing.T, limit int, requests *[]int) *OpenAIEmbedder {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		*requests = append(*requests, len(req.Input))
+
+		resp := openai.EmbeddingResponse{}
+		total := 0
+		for i, input := range req.Input {
+			words := len(strings.Fields(input))
+			total += words
+			resp.Data = append(resp.Data, openai.Embedding{Index: i, Embedding: []float32{float32(words)}})
+		}
+		if total > limit {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":{"message":"Requested %d tokens, max %d tokens per request","type":"invalid_request_error"}}`, total, limit)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	return NewOpenAIEmbedderWithConfig(config,
+		embedding.WithNormalization(false),
+		embedding.WithMaxTokensPerBatch(limit),
+		embedding.WithTokenCounter(func(text string) int { return len(strings.Fields(text)) }),
+	)
+}
+
+func TestOpenAIEmbedder_MaxTokensPerBatch(t *testing.T) {
+	ctx := context.Background()
+	long, short := strings.Repeat("word ", 8), "word"
+
+	t.Run("Packs by tokens", func(t *testing.T) {
+		var requests []int
+		embedder := newTokenLimitedServer(t, 10, &requests)
+
+		documents := []string{long, short, short, long, short, short, short, short}
+		vectors, err := embedder.EmbedDocuments(ctx, documents)
+		if err != nil {
+			t.Fatalf("EmbedDocuments() error = %v", err)
+		}
+		for i, doc := range documents {
+			if vectors[i][0] != float32(len(strings.Fields(doc))) {
+				t.Fatalf("vector %d = %v, want the vectors in document order", i, vectors[i])
+			}
+		}
+		if !reflect.DeepEqual(requests, []int{3, 3, 2}) {
+			t.Errorf("request sizes = %v, want [3 3 2]", requests)
+		}
+	})
+
+	t.Run("Splits batches the API rejects", func(t *testing.T) {
+		var requests []int
+		embedder := newTokenLimitedServer(t, 10, &requests)
+		// Counting too few tokens packs batches over the real limit
+		embedder.options.TokenCounter = func(text string) int { return 1 }
+
+		documents := []string{long, short, long, short}
+		vectors, err := embedder.EmbedDocuments(ctx, documents)
+		if err != nil {
+			t.Fatalf("EmbedDocuments() error = %v", err)
+		}
+		want := [][]float32{{8}, {1}, {8}, {1}}
+		if !reflect.DeepEqual(vectors, want) {
+			t.Errorf("EmbedDocuments() = %v, want %v", vectors, want)
+		}
+		if !reflect.DeepEqual(requests, []int{4, 2, 2}) {
+			t.Errorf("request sizes = %v, want the rejected batch bisected", requests)
+		}
+	})
+
+	t.Run("Single document over the limit", func(t *testing.T) {
+		var requests []int
+		embedder := newTokenLimitedServer(t, 10, &requests)
+
+		_, err := embedder.EmbedDocuments(ctx, []string{short, long + long})
+		var embErr *embedding.EmbeddingError
+		if !errors.As(err, &embErr) || embErr.Code != embedding.ErrCodeTokenLimitExceeded {
+			t.Fatalf("EmbedDocuments() error = %v, want ErrCodeTokenLimitExceeded", err)
+		}
+	})
+}
+
+func TestOpenAIEmbedder_Dimensions(t *testing.T) {
+	var dimensions []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.EmbeddingRequestStrings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		dimensions = append(dimensions, req.Dimensions)
+		resp := openai.EmbeddingResponse{Data: []openai.Embedding{{Embedding: make([]float32, req.Dimensions)}}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	embedder := NewOpenAIEmbedderWithConfig(config,
+		embedding.WithModel(string(openai.SmallEmbedding3)),
+		embedding.WithDimensions(256),
+		embedding.WithNormalization(false),
+	)
+	if got, ok := embedding.Dimension(embedder); !ok || got != 256 {
+		t.Errorf("embedding.Dimension() = %d, %v, want the configured 256", got, ok)
+	}
+
+	if _, err := embedder.EmbedDocuments(context.Background(), []string{"a"}); err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if _, err := embedder.EmbedQuery(context.Background(), "b"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if !reflect.DeepEqual(dimensions, []int{256, 256}) {
+		t.Errorf("requested dimensions = %v, want 256 for documents and queries", dimensions)
+	}
+}
+
+func TestOpenAIEmbedder_AzureDeployment(t *testing.T) {
+	ctx := context.Background()
+	var requests []*http.Request
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if rateLimited {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"code":"429","message":"Requests to the embeddings operation have exceeded the rate limit"}}`)
+			return
+		}
+		var req openai.EmbeddingRequestStrings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		var resp openai.EmbeddingResponse
+		for i := range req.Input {
+			resp.Data = append(resp.Data, openai.Embedding{Index: i, Embedding: []float32{float32(i)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+
+	embedder := NewOpenAIEmbedder("azure-key",
+		WithAzureDeployment(server.URL, "embeddings-prod", "2024-02-01"),
+		embedding.WithBatchSize(2),
+		embedding.WithNormalization(false),
+	)
+
+	vectors, err := embedder.EmbedDocuments(ctx, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if !reflect.DeepEqual(vectors, [][]float32{{0}, {1}, {0}}) {
+		t.Errorf("EmbedDocuments() = %v, want the batches' vectors in order", vectors)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2 batches", len(requests))
+	}
+	for _, r := range requests {
+		if r.URL.Path != "/openai/deployments/embeddings-prod/embeddings" {
+			t.Errorf("request path = %q, want the deployment's embeddings path", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-02-01" {
+			t.Errorf("api-version = %q, want 2024-02-01", got)
+		}
+		if got := r.Header.Get(openai.AzureAPIKeyHeader); got != "azure-key" {
+			t.Errorf("%s header = %q, want the API key", openai.AzureAPIKeyHeader, got)
+		}
+	}
+
+	rateLimited = true
+	_, err = embedder.EmbedQuery(ctx, "d")
+	var embErr *embedding.EmbeddingError
+	if !errors.As(err, &embErr) || embErr.Code != embedding.ErrCodeRateLimitExceeded {
+		t.Errorf("EmbedQuery() error = %v, want ErrCodeRateLimitExceeded", err)
+	}
+}
+
+func TestOpenAIEmbedder_BaseURLAndHTTPClient(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewEncoder(w).Encode(openai.EmbeddingResponse{Data: []openai.Embedding{{Embedding: []float32{1}}}})
+	}))
+	t.Cleanup(server.Close)
+
+	transport := &countingTransport{next: http.DefaultTransport}
+	embedder := NewOpenAIEmbedder("test-key",
+		WithBaseURL(server.URL+"/gateway/v1"),
+		WithHTTPClient(&http.Client{Transport: transport}),
+	)
+
+	if _, err := embedder.EmbedQuery(context.Background(), "hello"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	if path != "/gateway/v1/embeddings" {
+		t.Errorf("request path = %q, want it under the base URL", path)
+	}
+	if transport.requests != 1 {
+		t.Errorf("transport saw %d requests, want the request sent with the given client", transport.requests)
+	}
+}
+
+// countingTransport counts the requests it sends
+type countingTransport struct {
+	next     http.RoundTripper
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.next.RoundTrip(r)
+}
@@ -5,24 +5,99 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"slices"
+	"strings"
 
 	"github.com/Abraxas-365/kbservice/llm"
 	"github.com/sashabaranov/go-openai"
 )
 
 type OpenAILLM struct {
-	client *openai.Client
-	model  string
+	client         *openai.Client
+	model          string
+	preprocessors  []func([]llm.Message) []llm.Message
+	postprocessors []func(*llm.Message)
+	fallbacks      map[string]string
 }
 
-func NewOpenAILLM(apiKey string, model string) *OpenAILLM {
+// LLMOption is a function type to modify OpenAILLM
+type LLMOption func(*OpenAILLM)
+
+// WithMessagePreprocessor rewrites the messages of every Chat and ChatStream
+// call before they are sent, e.g. to redact PII or add guardrail
+// instructions. Preprocessors run in the order they are added and receive a
+// copy of the caller's slice.
+func WithMessagePreprocessor(preprocess func([]llm.Message) []llm.Message) LLMOption {
+	return func(o *OpenAILLM) {
+		o.preprocessors = append(o.preprocessors, preprocess)
+	}
+}
+
+// WithResponsePostprocessor modifies the message Chat returns, e.g. to strip
+// boilerplate or normalize the assistant's output. In ChatStream it runs on
+// the final message, which carries the stop reason, model and usage; the
+// deltas streamed before it don't pass through it. Postprocessors run in the
+// order they are added.
+func WithResponsePostprocessor(postprocess func(*llm.Message)) LLMOption {
+	return func(o *OpenAILLM) {
+		o.postprocessors = append(o.postprocessors, postprocess)
+	}
+}
+
+// WithModelFallbackOnContextOverflow retries Chat and ChatStream requests
+// that exceed a model's context window with the larger-context model
+// fallbacks maps it to, such as "gpt-4" to "gpt-4-32k". Fallbacks chain, so
+// a request can move on to the fallback's own fallback, but each model is
+// tried once. The response's Model reports the model that served it.
+func WithModelFallbackOnContextOverflow(fallbacks map[string]string) LLMOption {
+	return func(o *OpenAILLM) {
+		if o.fallbacks == nil {
+			o.fallbacks = make(map[string]string, len(fallbacks))
+		}
+		for model, fallback := range fallbacks {
+			o.fallbacks[model] = fallback
+		}
+	}
+}
+
+func NewOpenAILLM(apiKey string, model string, opts ...LLMOption) *OpenAILLM {
+	return newOpenAILLMWithConfig(openai.DefaultConfig(apiKey), model, opts...)
+}
+
+// newOpenAILLMWithConfig creates an OpenAILLM from a client config, whose
+// HTTP client is wrapped to capture raw responses
+func newOpenAILLMWithConfig(config openai.ClientConfig, model string, opts ...LLMOption) *OpenAILLM {
 	if model == "" {
 		model = openai.GPT4TurboPreview
 	}
-	return &OpenAILLM{
-		client: openai.NewClient(apiKey),
+	config.HTTPClient = &rawCapturingDoer{doer: config.HTTPClient}
+	o := &OpenAILLM{
+		client: openai.NewClientWithConfig(config),
 		model:  model,
 	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// preprocess applies the message preprocessors to a copy of messages
+func (o *OpenAILLM) preprocess(messages []llm.Message) []llm.Message {
+	if len(o.preprocessors) == 0 {
+		return messages
+	}
+	messages = slices.Clone(messages)
+	for _, preprocess := range o.preprocessors {
+		messages = preprocess(messages)
+	}
+	return messages
+}
+
+// postprocess applies the response postprocessors to message
+func (o *OpenAILLM) postprocess(message *llm.Message) {
+	for _, postprocess := range o.postprocessors {
+		postprocess(message)
+	}
 }
 
 func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
@@ -32,45 +107,18 @@ func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...ll
 	for _, opt := range opts {
 		opt(options)
 	}
+	messages = o.preprocess(messages)
 
 	// Convert messages to OpenAI format
-	openAIMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openAIMessage := openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-			Name:    msg.Name,
-		}
-
-		// Handle tool calls in the message (if your Message struct has ToolCalls)
-		if len(msg.ToolCalls) > 0 {
-			toolCalls := make([]openai.ToolCall, len(msg.ToolCalls))
-			for j, tc := range msg.ToolCalls {
-				toolCalls[j] = openai.ToolCall{
-					ID:   tc.ID,
-					Type: openai.ToolType(tc.Type),
-					Function: openai.FunctionCall{
-						Name:      tc.Function.Name,
-						Arguments: tc.Function.Arguments,
-					},
-				}
-			}
-			openAIMessage.ToolCalls = toolCalls
-		}
-		if msg.ToolCallID != "" {
-			openAIMessage.ToolCallID = msg.ToolCallID
-		}
-
-		openAIMessages[i] = openAIMessage
-	}
+	openAIMessages := toOpenAIMessages(messages)
 
 	// Create request
 	req := openai.ChatCompletionRequest{
-		Model:            o.model,
+		Model:            options.ModelOr(o.model),
 		Messages:         openAIMessages,
 		Temperature:      float32(options.Temperature),
 		TopP:             float32(options.TopP),
-		MaxTokens:        options.MaxTokens,
+		MaxTokens:        options.MaxTokensFor(options.ModelOr(o.model)),
 		Stop:             options.Stop,
 		PresencePenalty:  float32(options.PresencePenalty),
 		FrequencyPenalty: float32(options.FrequencyPenalty),
@@ -96,35 +144,18 @@ func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...ll
 		}
 	}
 
-	// Add tools if functions are provided
-	if len(options.Functions) > 0 {
-		tools := make([]openai.Tool, len(options.Functions))
-		for i, f := range options.Functions {
-			tools[i] = openai.Tool{
-				Type: openai.ToolTypeFunction,
-				Function: &openai.FunctionDefinition{
-					Name:        f.Name,
-					Description: f.Description,
-					Parameters:  f.Parameters,
-				},
-			}
-		}
-		req.Tools = tools
-
-		// Set tool choice
-		if options.FunctionCall != "" {
-			req.ToolChoice = &openai.ToolChoice{
-				Type: openai.ToolTypeFunction,
-				Function: openai.ToolFunction{
-					Name: options.FunctionCall,
-				},
-			}
-		} else {
-			req.ToolChoice = "auto"
-		}
+	req.Tools, req.ToolChoice = openAITools(options)
+
+	if options.RawResponse != nil {
+		ctx = context.WithValue(ctx, rawCaptureKey{}, options.RawResponse)
 	}
 
-	resp, err := o.client.CreateChatCompletion(ctx, req)
+	var resp openai.ChatCompletionResponse
+	err := o.withContextFallback(&req, options, func() error {
+		var err error
+		resp, err = o.client.CreateChatCompletion(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, handleOpenAIError("Chat", err)
 	}
@@ -138,9 +169,10 @@ func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...ll
 
 	// Convert response to Message
 	message := &llm.Message{
-		Role:    resp.Choices[0].Message.Role,
-		Content: resp.Choices[0].Message.Content,
-		Name:    resp.Choices[0].Message.Name,
+		Role:       resp.Choices[0].Message.Role,
+		Content:    resp.Choices[0].Message.Content,
+		Name:       resp.Choices[0].Message.Name,
+		StopReason: stopReason(resp.Choices[0].FinishReason),
 	}
 
 	// Set usage information using the new Usage struct and helper method
@@ -150,6 +182,8 @@ func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...ll
 		TotalTokens:      resp.Usage.TotalTokens,
 	}
 	message.SetUsage(usage)
+	message.SetFinishReason(string(resp.Choices[0].FinishReason))
+	message.SetModel(resp.Model)
 
 	// Handle tool calls in response - UPDATED to support multiple tool calls
 	if len(resp.Choices[0].Message.ToolCalls) > 0 {
@@ -173,10 +207,10 @@ func (o *OpenAILLM) Chat(ctx context.Context, messages []llm.Message, opts ...ll
 		}
 	}
 
+	o.postprocess(message)
 	return message, nil
 }
 
-// TODO: Fix tool calling in streaming
 func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
 	options := &llm.ChatOptions{
 		Temperature: 0.1,
@@ -184,22 +218,16 @@ func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts
 	for _, opt := range opts {
 		opt(options)
 	}
+	messages = o.preprocess(messages)
 
-	openAIMessages := make([]openai.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		openAIMessages[i] = openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-			Name:    msg.Name,
-		}
-	}
+	openAIMessages := toOpenAIMessages(messages)
 
 	req := openai.ChatCompletionRequest{
-		Model:            o.model,
+		Model:            options.ModelOr(o.model),
 		Messages:         openAIMessages,
 		Temperature:      float32(options.Temperature),
 		TopP:             float32(options.TopP),
-		MaxTokens:        options.MaxTokens,
+		MaxTokens:        options.MaxTokensFor(options.ModelOr(o.model)),
 		Stop:             options.Stop,
 		Stream:           true,
 		PresencePenalty:  float32(options.PresencePenalty),
@@ -226,45 +254,46 @@ func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts
 		}
 	}
 
-	// Add tools if functions are provided
-	if len(options.Functions) > 0 {
-		tools := make([]openai.Tool, len(options.Functions))
-		for i, f := range options.Functions {
-			tools[i] = openai.Tool{
-				Type: openai.ToolTypeFunction,
-				Function: &openai.FunctionDefinition{
-					Name:        f.Name,
-					Description: f.Description,
-					Parameters:  f.Parameters,
-				},
-			}
-		}
-		req.Tools = tools
+	req.Tools, req.ToolChoice = openAITools(options)
 
-		if options.FunctionCall != "" {
-			req.ToolChoice = &openai.ToolChoice{
-				Type: openai.ToolTypeFunction,
-				Function: openai.ToolFunction{
-					Name: options.FunctionCall,
-				},
-			}
-		} else {
-			req.ToolChoice = "auto"
-		}
-	}
-
-	stream, err := o.client.CreateChatCompletionStream(ctx, req)
+	var stream *openai.ChatCompletionStream
+	err := o.withContextFallback(&req, options, func() error {
+		var err error
+		stream, err = o.client.CreateChatCompletionStream(ctx, req)
+		return err
+	})
 	if err != nil {
 		return nil, handleOpenAIError("ChatStream", err)
 	}
 
-	responseChan := make(chan llm.StreamResponse)
+	writer, responseChan := llm.NewStreamWriter(ctx, options)
 
 	go func() {
-		defer close(responseChan)
+		defer writer.Close()
+		// Closing the stream releases the HTTP connection when the consumer
+		// cancels the context and Send gives up
 		defer stream.Close()
 
 		usage := &llm.Usage{}
+		var finishReason openai.FinishReason
+		var model string
+		var toolCalls streamedToolCalls
+
+		// final is the last message of the stream, with usage statistics and
+		// the complete tool calls
+		final := func(reason llm.StopReason) llm.StreamResponse {
+			message := llm.Message{StopReason: reason}
+			if len(toolCalls) > 0 {
+				message.ToolCalls = toolCalls
+				// Keep backward compatibility with single FuncCall
+				message.FuncCall = &toolCalls[0].Function
+			}
+			message.SetUsage(usage)
+			message.SetFinishReason(string(finishReason))
+			message.SetModel(model)
+			o.postprocess(&message)
+			return llm.StreamResponse{Message: message, Done: true, ToolCalls: toolCalls.functionCalls()}
+		}
 
 		// Estimate prompt tokens from input messages
 		for _, msg := range messages {
@@ -276,23 +305,21 @@ func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts
 		for {
 			response, err := stream.Recv()
 			if errors.Is(err, io.EOF) {
-				// Send final message with usage statistics
-				finalMessage := &llm.Message{}
-				finalMessage.SetUsage(usage)
-				responseChan <- llm.StreamResponse{
-					Message: *finalMessage,
-					Done:    true,
-				}
+				writer.Send(final(stopReason(finishReason)))
 				return
 			}
 			if err != nil {
-				responseChan <- llm.StreamResponse{
+				writer.Send(llm.StreamResponse{
 					Error: handleOpenAIError("ChatStream", err),
 					Done:  true,
-				}
+				})
 				return
 			}
 
+			if response.Model != "" {
+				model = response.Model
+			}
+
 			if len(response.Choices) > 0 {
 				choice := response.Choices[0]
 				if choice.Delta.Content != "" || choice.Delta.Role != "" {
@@ -308,41 +335,40 @@ func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts
 					}
 					message.SetUsage(usage)
 
-					responseChan <- llm.StreamResponse{
+					if !writer.Send(llm.StreamResponse{
 						Message: *message,
 						Done:    false,
+					}) {
+						return
 					}
 				}
 
-				// Handle tool calls in streaming response
-				if len(choice.Delta.ToolCalls) > 0 {
-					toolCall := choice.Delta.ToolCalls[0]
+				// Tool calls arrive in fragments, the first with the call's ID
+				// and name; they are relayed as deltas and assembled for the
+				// final message
+				for _, toolCall := range choice.Delta.ToolCalls {
 					// Increment tokens for function calls
 					usage.CompletionTokens += (len(toolCall.Function.Name) + len(toolCall.Function.Arguments)) / 4
 					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 
-					message := &llm.Message{
-						Role: choice.Delta.Role,
-						FuncCall: &llm.FunctionCall{
-							Name:      toolCall.Function.Name,
-							Arguments: toolCall.Function.Arguments,
-						},
-					}
+					delta := toolCalls.add(toolCall)
+					message := &llm.Message{Role: choice.Delta.Role}
 					message.SetUsage(usage)
 
-					responseChan <- llm.StreamResponse{
-						Message: *message,
-						Done:    false,
+					if !writer.Send(llm.StreamResponse{
+						Message:       *message,
+						ToolCallDelta: delta,
+					}) {
+						return
 					}
 				}
 
-				if choice.FinishReason == "stop" {
-					finalMessage := &llm.Message{}
-					finalMessage.SetUsage(usage)
-					responseChan <- llm.StreamResponse{
-						Message: *finalMessage,
-						Done:    true,
-					}
+				if choice.FinishReason != "" {
+					finishReason = choice.FinishReason
+				}
+
+				if choice.FinishReason == openai.FinishReasonStop {
+					writer.Send(final(llm.StopReasonStop))
 					return
 				}
 			}
@@ -352,6 +378,114 @@ func (o *OpenAILLM) ChatStream(ctx context.Context, messages []llm.Message, opts
 	return responseChan, nil
 }
 
+// withContextFallback calls send, and while req overflows the context window
+// of its model, sends it again with the model's fallback
+func (o *OpenAILLM) withContextFallback(req *openai.ChatCompletionRequest, options *llm.ChatOptions, send func() error) error {
+	tried := map[string]bool{req.Model: true}
+	for {
+		err := send()
+		fallback, ok := o.fallbacks[req.Model]
+		if err == nil || !ok || tried[fallback] || !isContextOverflow(err) {
+			return err
+		}
+		tried[fallback] = true
+		req.Model = fallback
+		req.MaxTokens = options.MaxTokensFor(fallback)
+	}
+}
+
+// isContextOverflow reports whether err is the API rejecting a request for
+// exceeding the model's context window, by its code or, for compatible APIs
+// that leave it out, its message
+func isContextOverflow(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if code, ok := apiErr.Code.(string); ok && code == "context_length_exceeded" {
+		return true
+	}
+	return apiErr.HTTPStatusCode == 400 && strings.Contains(strings.ToLower(apiErr.Message), "maximum context length")
+}
+
+// toOpenAIMessages converts messages to the OpenAI format, with the tool
+// calls of assistant messages and the call IDs of tool results
+func toOpenAIMessages(messages []llm.Message) []openai.ChatCompletionMessage {
+	openAIMessages := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		openAIMessage := openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+			Name:    msg.Name,
+		}
+
+		if len(msg.ToolCalls) > 0 {
+			toolCalls := make([]openai.ToolCall, len(msg.ToolCalls))
+			for j, tc := range msg.ToolCalls {
+				toolCalls[j] = openai.ToolCall{
+					ID:   tc.ID,
+					Type: openai.ToolType(tc.Type),
+					Function: openai.FunctionCall{
+						Name:      tc.Function.Name,
+						Arguments: tc.Function.Arguments,
+					},
+				}
+			}
+			openAIMessage.ToolCalls = toolCalls
+		}
+		if msg.ToolCallID != "" {
+			openAIMessage.ToolCallID = msg.ToolCallID
+		}
+
+		openAIMessages[i] = openAIMessage
+	}
+	return openAIMessages
+}
+
+// streamedToolCalls assembles the tool calls of a stream from their fragments
+type streamedToolCalls []llm.ToolCall
+
+// add appends a fragment to its call and returns it as a delta. Fragments
+// without an index belong to the first call.
+func (calls *streamedToolCalls) add(fragment openai.ToolCall) *llm.FunctionCallDelta {
+	index := 0
+	if fragment.Index != nil {
+		index = *fragment.Index
+	}
+	for len(*calls) <= index {
+		*calls = append(*calls, llm.ToolCall{Type: string(llm.ToolTypeFunction)})
+	}
+
+	call := &(*calls)[index]
+	if fragment.ID != "" {
+		call.ID = fragment.ID
+	}
+	if fragment.Type != "" {
+		call.Type = string(fragment.Type)
+	}
+	call.Function.Name += fragment.Function.Name
+	call.Function.Arguments += fragment.Function.Arguments
+
+	return &llm.FunctionCallDelta{
+		Index:     index,
+		ID:        fragment.ID,
+		Name:      fragment.Function.Name,
+		Arguments: fragment.Function.Arguments,
+	}
+}
+
+// functionCalls returns the function of each call
+func (calls streamedToolCalls) functionCalls() []llm.FunctionCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	functions := make([]llm.FunctionCall, len(calls))
+	for i, call := range calls {
+		functions[i] = call.Function
+	}
+	return functions
+}
+
 func (o *OpenAILLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
 	messages := []llm.Message{
 		{
@@ -368,6 +502,52 @@ func (o *OpenAILLM) Complete(ctx context.Context, prompt string, opts ...llm.Opt
 	return resp.Content, nil
 }
 
+// openAITools converts the requested tools and tool choice. The choice is nil
+// when none was requested, leaving it to the API default.
+func openAITools(options *llm.ChatOptions) ([]openai.Tool, any) {
+	tools, choice := options.ResolveTools()
+
+	var converted []openai.Tool
+	for _, tool := range tools {
+		openAITool := openai.Tool{Type: openai.ToolType(tool.Type)}
+		if tool.Function != nil {
+			openAITool.Function = &openai.FunctionDefinition{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			}
+		}
+		converted = append(converted, openAITool)
+	}
+
+	if choice == nil {
+		return converted, nil
+	}
+	if choice.Mode == llm.ToolChoiceFunction {
+		return converted, &openai.ToolChoice{
+			Type:     openai.ToolTypeFunction,
+			Function: openai.ToolFunction{Name: choice.Name},
+		}
+	}
+	return converted, string(choice.Mode)
+}
+
+// stopReason normalizes an OpenAI finish reason
+func stopReason(reason openai.FinishReason) llm.StopReason {
+	switch reason {
+	case openai.FinishReasonStop:
+		return llm.StopReasonStop
+	case openai.FinishReasonLength:
+		return llm.StopReasonLength
+	case openai.FinishReasonToolCalls, openai.FinishReasonFunctionCall:
+		return llm.StopReasonToolCalls
+	case openai.FinishReasonContentFilter:
+		return llm.StopReasonContentFilter
+	default:
+		return ""
+	}
+}
+
 func handleOpenAIError(op string, err error) error {
 	if err == nil {
 		return nil
@@ -377,6 +557,13 @@ func handleOpenAIError(op string, err error) error {
 	if errors.As(err, &apiErr) {
 		switch apiErr.HTTPStatusCode {
 		case 400:
+			if isContextOverflow(err) {
+				return &llm.LLMError{
+					Op:      op,
+					Message: "context length exceeded",
+					Err:     err,
+				}
+			}
 			return &llm.LLMError{
 				Op:      op,
 				Message: "invalid request",
@@ -0,0 +1,643 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/testing/vcr"
+	"github.com/sashabaranov/go-openai"
+)
+
+// newRecordedLLM returns an OpenAILLM whose requests are replayed from
+// testdata/fixtures/<fixture>.json, see package vcr for recording them
+func newRecordedLLM(t *testing.T, fixture, model string) (*OpenAILLM, *vcr.Recorder) {
+	t.Helper()
+	rec := vcr.New(t, fixture)
+	config := openai.DefaultConfig(rec.Credential("OPENAI_API_KEY"))
+	config.HTTPClient = rec.Client()
+	return newOpenAILLMWithConfig(config, model), rec
+}
+
+func TestOpenAILLM_Chat(t *testing.T) {
+	client, rec := newRecordedLLM(t, "chat", "gpt-4o-mini")
+
+	var raw json.RawMessage
+	message, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "Say hello in one word."}}, llm.WithCaptureRaw(&raw))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if body := rec.Interactions()[0].Response.Body; string(raw) != body {
+		t.Errorf("captured raw response = %s, want %s", raw, body)
+	}
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("failed to decode raw response: %v", err)
+	}
+	if message.Role != llm.RoleAssistant || message.Content == "" || message.Content != resp.Choices[0].Message.Content {
+		t.Errorf("Chat() = %s %q, want the assistant reply %q", message.Role, message.Content, resp.Choices[0].Message.Content)
+	}
+	if message.StopReason != llm.StopReasonStop || message.FinishReason() != "stop" {
+		t.Errorf("Chat() stop reason = %q, finish reason = %q, want stop", message.StopReason, message.FinishReason())
+	}
+	if !strings.HasPrefix(message.Model(), "gpt-4o-mini") {
+		t.Errorf("Chat() model = %q, want the gpt-4o-mini snapshot that served the request", message.Model())
+	}
+	if usage := message.GetUsage(); usage == nil || usage.PromptTokens == 0 || usage.TotalTokens != usage.PromptTokens+usage.CompletionTokens {
+		t.Errorf("Chat() usage = %+v, want the usage reported by the API", usage)
+	}
+	if !strings.Contains(string(raw), `"system_fingerprint"`) {
+		t.Error("captured raw response is missing unmodeled fields")
+	}
+
+	// Calls without the option capture nothing
+	raw = nil
+	if _, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "Say goodbye in one word."}}); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if raw != nil {
+		t.Errorf("raw response captured without WithCaptureRaw: %s", raw)
+	}
+}
+
+func TestOpenAILLM_ChatErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		fixture     string
+		apiKey      string
+		model       string
+		opts        []llm.Option
+		wantMessage string
+		wantStatus  int
+	}{
+		{name: "Invalid API key", fixture: "chat_invalid_key", apiKey: "sk-invalid", model: "gpt-4o-mini", wantMessage: "invalid API key", wantStatus: 401},
+		{name: "Invalid request", fixture: "chat_invalid_request", model: "gpt-4o-mini", opts: []llm.Option{llm.WithTemperature(5)}, wantMessage: "invalid request", wantStatus: 400},
+		{name: "Unknown model", fixture: "chat_unknown_model", model: "gpt-does-not-exist", wantMessage: "unexpected error", wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := vcr.New(t, tt.fixture)
+			apiKey := tt.apiKey
+			if apiKey == "" {
+				apiKey = rec.Credential("OPENAI_API_KEY")
+			}
+			config := openai.DefaultConfig(apiKey)
+			config.HTTPClient = rec.Client()
+			client := newOpenAILLMWithConfig(config, tt.model)
+
+			_, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}}, tt.opts...)
+			var llmErr *llm.LLMError
+			if !errors.As(err, &llmErr) || llmErr.Op != "Chat" || llmErr.Message != tt.wantMessage {
+				t.Fatalf("Chat() error = %v, want LLMError %q", err, tt.wantMessage)
+			}
+			var apiErr *openai.APIError
+			if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != tt.wantStatus {
+				t.Errorf("Chat() error = %v, want it to wrap the %d API error", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOpenAILLM_ChatStopReason(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		want         llm.StopReason
+	}{
+		{finishReason: "stop", want: llm.StopReasonStop},
+		{finishReason: "length", want: llm.StopReasonLength},
+		{finishReason: "tool_calls", want: llm.StopReasonToolCalls},
+		{finishReason: "function_call", want: llm.StopReasonToolCalls},
+		{finishReason: "content_filter", want: llm.StopReasonContentFilter},
+		{finishReason: "null", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.finishReason, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"model":"gpt-4o-2024-08-06","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"` + tt.finishReason + `"}]}`))
+			}))
+			defer server.Close()
+
+			config := openai.DefaultConfig("test-key")
+			config.BaseURL = server.URL + "/v1"
+			client := newOpenAILLMWithConfig(config, "gpt-4o")
+
+			message, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}})
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if message.StopReason != tt.want {
+				t.Errorf("Chat() stop reason = %q, want %q", message.StopReason, tt.want)
+			}
+			if message.FinishReason() != tt.finishReason {
+				t.Errorf("Chat() finish reason = %q, want %q", message.FinishReason(), tt.finishReason)
+			}
+			if message.Model() != "gpt-4o-2024-08-06" {
+				t.Errorf("Chat() model = %q, want the model that served the request", message.Model())
+			}
+		})
+	}
+}
+
+func TestOpenAILLM_ChatStream(t *testing.T) {
+	client, _ := newRecordedLLM(t, "chat_stream", "gpt-4o-mini")
+
+	stream, err := client.ChatStream(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "Count from one to twenty in words."}}, llm.WithMaxTokens(5))
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	message, err := llm.CollectStream(stream)
+	if err != nil {
+		t.Fatalf("CollectStream() error = %v", err)
+	}
+	if message.Content == "" {
+		t.Error("streamed content is empty")
+	}
+	if message.StopReason != llm.StopReasonLength || message.FinishReason() != "length" {
+		t.Errorf("stop reason = %q, finish reason = %q, want length", message.StopReason, message.FinishReason())
+	}
+	if !strings.HasPrefix(message.Model(), "gpt-4o-mini") {
+		t.Errorf("model = %q, want the gpt-4o-mini snapshot that served the request", message.Model())
+	}
+}
+
+func TestOpenAILLM_ChatStreamClosesAbandonedStream(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	closed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		w.Header().Set("Content-Type", "text/event-stream")
+		// Stream until the client goes away
+		for r.Context().Err() == nil {
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"token \"}}]}\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	client := newOpenAILLMWithConfig(config, "gpt-4o")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.ChatStream(ctx, []llm.Message{{Role: llm.RoleUser, Content: "hello"}}, llm.WithStreamBuffer(4))
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	<-stream
+	// Stop reading without draining the stream
+	cancel()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("provider stream was not closed after the consumer cancelled")
+	}
+
+	// The adapter goroutine must exit even though nobody drains the stream
+	server.Close()
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d after the stream was abandoned, want %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOpenAILLM_ChatStreamToolCalls(t *testing.T) {
+	var sent []openai.ChatCompletionMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		sent = req.Messages
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Saving "}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"send_user_data","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"your data."}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"name\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"ask_human","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Ana\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		} {
+			w.Write([]byte("data: " + chunk + "\n\n"))
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	client := newOpenAILLMWithConfig(config, "gpt-4o")
+
+	messages := []llm.Message{
+		{Role: llm.RoleUser, Content: "I'm Ana"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "call_0", Type: "function", Function: llm.FunctionCall{Name: "ask_human", Arguments: "{}"}}}},
+		{Role: llm.RoleTool, Content: "asked", ToolCallID: "call_0"},
+	}
+	stream, err := client.ChatStream(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	var content string
+	var deltas []llm.FunctionCallDelta
+	var last llm.StreamResponse
+	for resp := range stream {
+		content += resp.Message.Content
+		if resp.ToolCallDelta != nil {
+			deltas = append(deltas, *resp.ToolCallDelta)
+		}
+		last = resp
+	}
+
+	if len(sent) != 3 || len(sent[1].ToolCalls) != 1 || sent[1].ToolCalls[0].ID != "call_0" || sent[2].ToolCallID != "call_0" {
+		t.Errorf("sent messages = %+v, want the tool call and its result linked by ID", sent)
+	}
+	if content != "Saving your data." {
+		t.Errorf("content = %q, want the content around the tool calls", content)
+	}
+	wantDeltas := []llm.FunctionCallDelta{
+		{Index: 0, ID: "call_1", Name: "send_user_data"},
+		{Index: 0, Arguments: `{"name":`},
+		{Index: 1, ID: "call_2", Name: "ask_human", Arguments: "{}"},
+		{Index: 0, Arguments: `"Ana"}`},
+	}
+	if !reflect.DeepEqual(deltas, wantDeltas) {
+		t.Errorf("tool call deltas = %+v, want %+v", deltas, wantDeltas)
+	}
+
+	wantCalls := []llm.FunctionCall{
+		{Name: "send_user_data", Arguments: `{"name":"Ana"}`},
+		{Name: "ask_human", Arguments: "{}"},
+	}
+	if !last.Done || last.Message.StopReason != llm.StopReasonToolCalls || !reflect.DeepEqual(last.ToolCalls, wantCalls) {
+		t.Fatalf("final response = %+v, want the assembled calls %+v", last, wantCalls)
+	}
+	if len(last.Message.ToolCalls) != 2 || last.Message.ToolCalls[0].ID != "call_1" || last.Message.ToolCalls[1].ID != "call_2" {
+		t.Errorf("final message tool calls = %+v, want both calls with their IDs", last.Message.ToolCalls)
+	}
+	if last.Message.FuncCall == nil || last.Message.FuncCall.Name != "send_user_data" {
+		t.Errorf("FuncCall = %+v, want the first call", last.Message.FuncCall)
+	}
+}
+
+func TestOpenAILLM_ChatSendsTools(t *testing.T) {
+	weather := llm.Function{Name: "get_weather", Description: "Current weather", Parameters: map[string]any{"type": "object"}}
+
+	tests := []struct {
+		name       string
+		opts       []llm.Option
+		wantChoice string
+	}{
+		{
+			name:       "Required",
+			opts:       []llm.Option{llm.WithTools(llm.FunctionTool(weather)), llm.WithToolChoice(&llm.ToolChoice{Mode: llm.ToolChoiceRequired})},
+			wantChoice: `"required"`,
+		},
+		{
+			name:       "None",
+			opts:       []llm.Option{llm.WithTools(llm.FunctionTool(weather)), llm.WithToolChoice(&llm.ToolChoice{Mode: llm.ToolChoiceNone})},
+			wantChoice: `"none"`,
+		},
+		{
+			name:       "Specific function through the deprecated options",
+			opts:       []llm.Option{llm.WithFunctions([]llm.Function{weather}), llm.WithFunctionCall("get_weather")},
+			wantChoice: `{"type":"function","function":{"name":"get_weather"}}`,
+		},
+		{
+			name: "Provider default",
+			opts: []llm.Option{llm.WithTools(llm.FunctionTool(weather))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req struct {
+				Tools      []openai.Tool   `json:"tools"`
+				ToolChoice json.RawMessage `json:"tool_choice"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+			}))
+			defer server.Close()
+
+			config := openai.DefaultConfig("test-key")
+			config.BaseURL = server.URL + "/v1"
+			client := newOpenAILLMWithConfig(config, "gpt-4o")
+
+			if _, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "weather?"}}, tt.opts...); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+
+			if len(req.Tools) != 1 || req.Tools[0].Type != openai.ToolTypeFunction || req.Tools[0].Function.Name != "get_weather" {
+				t.Errorf("tools = %+v, want the get_weather function", req.Tools)
+			}
+			if string(req.ToolChoice) != tt.wantChoice {
+				t.Errorf("tool_choice = %s, want %s", req.ToolChoice, tt.wantChoice)
+			}
+		})
+	}
+}
+
+func TestOpenAILLM_ChatModelClamp(t *testing.T) {
+	tests := []struct {
+		name          string
+		model         string
+		opts          []llm.Option
+		wantModel     string
+		wantMaxTokens int
+	}{
+		{
+			name:          "Known model is clamped",
+			model:         "gpt-4",
+			opts:          []llm.Option{llm.WithMaxTokens(100000), llm.WithModelClamp()},
+			wantMaxTokens: 8192,
+		},
+		{
+			name:          "Limit within the model's maximum",
+			model:         "gpt-4",
+			opts:          []llm.Option{llm.WithMaxTokens(500), llm.WithModelClamp()},
+			wantMaxTokens: 500,
+		},
+		{
+			name:          "Unknown model passes through",
+			model:         "my-fine-tune",
+			opts:          []llm.Option{llm.WithMaxTokens(100000), llm.WithModelClamp()},
+			wantMaxTokens: 100000,
+		},
+		{
+			name:          "Clamp disabled",
+			model:         "gpt-4",
+			opts:          []llm.Option{llm.WithMaxTokens(100000)},
+			wantMaxTokens: 100000,
+		},
+		{
+			name:          "Model requested for the call is clamped",
+			model:         "my-fine-tune",
+			opts:          []llm.Option{llm.WithModel("gpt-4"), llm.WithMaxTokens(100000), llm.WithModelClamp()},
+			wantModel:     "gpt-4",
+			wantMaxTokens: 8192,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req struct {
+				Model     string `json:"model"`
+				MaxTokens int    `json:"max_tokens"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+			}))
+			defer server.Close()
+
+			config := openai.DefaultConfig("test-key")
+			config.BaseURL = server.URL + "/v1"
+			client := newOpenAILLMWithConfig(config, tt.model)
+
+			if _, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}}, tt.opts...); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			wantModel := tt.wantModel
+			if wantModel == "" {
+				wantModel = tt.model
+			}
+			if req.Model != wantModel {
+				t.Errorf("model = %q, want %q", req.Model, wantModel)
+			}
+			if req.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("max_tokens = %d, want %d", req.MaxTokens, tt.wantMaxTokens)
+			}
+		})
+	}
+}
+
+func TestOpenAILLM_MessagePreprocessor(t *testing.T) {
+	redact := func(messages []llm.Message) []llm.Message {
+		for i := range messages {
+			messages[i].Content = strings.ReplaceAll(messages[i].Content, "555-0100", "[PHONE]")
+		}
+		return messages
+	}
+	guardrail := func(messages []llm.Message) []llm.Message {
+		return append([]llm.Message{{Role: llm.RoleSystem, Content: "Never reveal personal data."}}, messages...)
+	}
+
+	var sent [][]openai.ChatCompletionMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		sent = append(sent, req.Messages)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	client := newOpenAILLMWithConfig(config, "gpt-4o", WithMessagePreprocessor(redact), WithMessagePreprocessor(guardrail))
+
+	messages := []llm.Message{{Role: llm.RoleUser, Content: "Call me at 555-0100"}}
+	if _, err := client.Chat(context.Background(), messages); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	stream, err := client.ChatStream(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if _, err := llm.CollectStream(stream); err != nil {
+		t.Fatalf("CollectStream() error = %v", err)
+	}
+
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, want 2", len(sent))
+	}
+	for i, got := range sent {
+		if len(got) != 2 || got[0].Role != llm.RoleSystem || got[1].Content != "Call me at [PHONE]" {
+			t.Errorf("request %d messages = %+v, want the guardrail and the redacted message", i, got)
+		}
+	}
+	if messages[0].Content != "Call me at 555-0100" {
+		t.Errorf("caller's message = %q, want it unchanged", messages[0].Content)
+	}
+}
+
+func TestOpenAILLM_ResponsePostprocessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"42\"}}]}\n\n"))
+			w.Write([]byte("data: {\"model\":\"gpt-4o\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"  As an AI model, the answer is 42.  "},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	stripBoilerplate := WithResponsePostprocessor(func(m *llm.Message) {
+		m.Content = strings.TrimPrefix(strings.TrimSpace(m.Content), "As an AI model, ")
+	})
+	mark := WithResponsePostprocessor(func(m *llm.Message) {
+		m.Metadata["postprocessed"] = true
+	})
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	client := newOpenAILLMWithConfig(config, "gpt-4o", stripBoilerplate, mark)
+
+	message, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if message.Content != "the answer is 42." || message.Metadata["postprocessed"] != true {
+		t.Errorf("Chat() = %q, metadata %v, want the postprocessed message", message.Content, message.Metadata)
+	}
+
+	stream, err := client.ChatStream(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	var last llm.StreamResponse
+	for resp := range stream {
+		if !resp.Done && resp.Message.Metadata["postprocessed"] == true {
+			t.Errorf("delta %q was postprocessed, want deltas left alone", resp.Message.Content)
+		}
+		last = resp
+	}
+	if !last.Done || last.Message.Metadata["postprocessed"] != true {
+		t.Errorf("final response = %+v, want the postprocessed final message", last)
+	}
+}
+
+// contextOverflowServer rejects requests with a context length error unless
+// windows gives their model a context window of at least 10000 tokens,
+// recording the model of every request
+func contextOverflowServer(t *testing.T, windows map[string]int, models *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		*models = append(*models, req.Model)
+		if windows[req.Model] < 10000 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"This model's maximum context length is 8192 tokens. However, your messages resulted in 12000 tokens.","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`))
+			return
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"model\":\"" + req.Model + "\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok\"},\"finish_reason\":\"stop\"}]}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"` + req.Model + `","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+}
+
+func TestOpenAILLM_ModelFallbackOnContextOverflow(t *testing.T) {
+	windows := map[string]int{"gpt-4": 8192, "gpt-4-16k": 8192, "gpt-4-32k": 32768}
+
+	tests := []struct {
+		name       string
+		fallbacks  map[string]string
+		wantModels []string
+		wantErr    bool
+	}{
+		{name: "Retried with the fallback", fallbacks: map[string]string{"gpt-4": "gpt-4-32k"}, wantModels: []string{"gpt-4", "gpt-4-32k"}},
+		{name: "Fallbacks chain", fallbacks: map[string]string{"gpt-4": "gpt-4-16k", "gpt-4-16k": "gpt-4-32k"}, wantModels: []string{"gpt-4", "gpt-4-16k", "gpt-4-32k"}},
+		{name: "No fallback", fallbacks: map[string]string{"gpt-3.5-turbo": "gpt-4-32k"}, wantModels: []string{"gpt-4"}, wantErr: true},
+		{name: "Each model tried once", fallbacks: map[string]string{"gpt-4": "gpt-4-16k", "gpt-4-16k": "gpt-4"}, wantModels: []string{"gpt-4", "gpt-4-16k"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var models []string
+			server := contextOverflowServer(t, windows, &models)
+			defer server.Close()
+
+			config := openai.DefaultConfig("test-key")
+			config.BaseURL = server.URL + "/v1"
+			client := newOpenAILLMWithConfig(config, "gpt-4", WithModelFallbackOnContextOverflow(tt.fallbacks))
+
+			message, err := client.Chat(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "a long prompt"}})
+			if !reflect.DeepEqual(models, tt.wantModels) {
+				t.Errorf("requested models = %v, want %v", models, tt.wantModels)
+			}
+			if tt.wantErr {
+				var llmErr *llm.LLMError
+				if !errors.As(err, &llmErr) || llmErr.Message != "context length exceeded" {
+					t.Errorf("Chat() error = %v, want the context length error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if want := tt.wantModels[len(tt.wantModels)-1]; message.Model() != want {
+				t.Errorf("Chat() model = %q, want %q", message.Model(), want)
+			}
+		})
+	}
+}
+
+func TestOpenAILLM_ChatStreamModelFallbackOnContextOverflow(t *testing.T) {
+	var models []string
+	server := contextOverflowServer(t, map[string]int{"gpt-4-32k": 32768}, &models)
+	defer server.Close()
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	client := newOpenAILLMWithConfig(config, "gpt-4", WithModelFallbackOnContextOverflow(map[string]string{"gpt-4": "gpt-4-32k"}))
+
+	stream, err := client.ChatStream(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "a long prompt"}})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	message, err := llm.CollectStream(stream)
+	if err != nil {
+		t.Fatalf("CollectStream() error = %v", err)
+	}
+	if message.Content != "ok" || message.Model() != "gpt-4-32k" {
+		t.Errorf("ChatStream() = %q from %q, want the fallback's answer", message.Content, message.Model())
+	}
+	if !reflect.DeepEqual(models, []string{"gpt-4", "gpt-4-32k"}) {
+		t.Errorf("requested models = %v, want the fallback after gpt-4", models)
+	}
+}
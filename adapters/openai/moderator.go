@@ -0,0 +1,66 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Abraxas-365/kbservice/moderation"
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAIModerator checks text with the OpenAI moderation endpoint
+type OpenAIModerator struct {
+	client *openai.Client
+	model  string
+}
+
+func NewOpenAIModerator(apiKey string, model string) *OpenAIModerator {
+	return NewOpenAIModeratorWithConfig(openai.DefaultConfig(apiKey), model)
+}
+
+// NewOpenAIModeratorWithConfig creates an OpenAIModerator from a client config,
+// e.g. for a custom base URL
+func NewOpenAIModeratorWithConfig(config openai.ClientConfig, model string) *OpenAIModerator {
+	if model == "" {
+		model = openai.ModerationOmniLatest
+	}
+	return &OpenAIModerator{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+func (o *OpenAIModerator) Check(ctx context.Context, text string) (moderation.Result, error) {
+	resp, err := o.client.Moderations(ctx, openai.ModerationRequest{
+		Input: text,
+		Model: o.model,
+	})
+	if err != nil {
+		return moderation.Result{}, fmt.Errorf("openai moderation: %w", err)
+	}
+	if len(resp.Results) == 0 {
+		return moderation.Result{}, fmt.Errorf("openai moderation: response has no results")
+	}
+
+	result := resp.Results[0]
+	moderated := moderation.Result{Flagged: result.Flagged}
+
+	// The client models categories as struct fields; their JSON names are the API's category names
+	if err := remarshal(result.Categories, &moderated.Categories); err != nil {
+		return moderation.Result{}, fmt.Errorf("openai moderation: %w", err)
+	}
+	if err := remarshal(result.CategoryScores, &moderated.CategoryScores); err != nil {
+		return moderation.Result{}, fmt.Errorf("openai moderation: %w", err)
+	}
+
+	return moderated, nil
+}
+
+func remarshal(src, dst any) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
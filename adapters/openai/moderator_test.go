@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func newTestModerator(t *testing.T, handler http.HandlerFunc) *OpenAIModerator {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	config := openai.DefaultConfig("test-key")
+	config.BaseURL = server.URL + "/v1"
+	return NewOpenAIModeratorWithConfig(config, "")
+}
+
+func TestOpenAIModerator_Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantFlagged bool
+		wantFlags   []string
+		wantScore   float64
+	}{
+		{
+			name:        "Flagged",
+			body:        `{"id":"modr-1","model":"omni-moderation-latest","results":[{"flagged":true,"categories":{"violence":true,"hate":false},"category_scores":{"violence":0.97,"hate":0.02}}]}`,
+			wantFlagged: true,
+			wantFlags:   []string{"violence"},
+			wantScore:   0.97,
+		},
+		{
+			name:      "Clean",
+			body:      `{"id":"modr-2","model":"omni-moderation-latest","results":[{"flagged":false,"categories":{"violence":false},"category_scores":{"violence":0.001}}]}`,
+			wantScore: 0.001,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req openai.ModerationRequest
+			moderator := newTestModerator(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/moderations" {
+					t.Errorf("request path = %s, want /v1/moderations", r.URL.Path)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			})
+
+			result, err := moderator.Check(context.Background(), "some text")
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if req.Input != "some text" || req.Model != openai.ModerationOmniLatest {
+				t.Errorf("request = %+v, want the text and the default model", req)
+			}
+			if result.Flagged != tt.wantFlagged {
+				t.Errorf("Flagged = %v, want %v", result.Flagged, tt.wantFlagged)
+			}
+			if got := result.FlaggedCategories(); len(got) != len(tt.wantFlags) || (len(got) > 0 && got[0] != tt.wantFlags[0]) {
+				t.Errorf("FlaggedCategories() = %v, want %v", got, tt.wantFlags)
+			}
+			if got := result.CategoryScores["violence"]; got < tt.wantScore-1e-6 || got > tt.wantScore+1e-6 {
+				t.Errorf("CategoryScores[violence] = %v, want %v", got, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestOpenAIModerator_CheckAPIFailure(t *testing.T) {
+	moderator := newTestModerator(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"message":"server error","type":"server_error"}}`))
+	})
+
+	if _, err := moderator.Check(context.Background(), "some text"); err == nil {
+		t.Fatal("Check() error = nil, want API error")
+	}
+}
@@ -0,0 +1,46 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// rawCaptureKey marks a request context whose response body should be captured
+type rawCaptureKey struct{}
+
+// rawCapturingDoer copies the response body into the *json.RawMessage stored in
+// the request context, since the OpenAI client only exposes the parsed response
+type rawCapturingDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d *rawCapturingDoer) Do(req *http.Request) (*http.Response, error) {
+	doer := d.doer
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+
+	resp, err := doer.Do(req)
+	if err != nil {
+		return resp, err
+	}
+
+	dst, ok := req.Context().Value(rawCaptureKey{}).(*json.RawMessage)
+	if !ok {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	*dst = append((*dst)[:0], body...)
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
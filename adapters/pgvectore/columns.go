@@ -0,0 +1,131 @@
+package pgvectore
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// defaultColumn is the column of the default vectors
+const defaultColumn = "embedding"
+
+// VectorSpec describes a named vector column
+type VectorSpec struct {
+	Dimension int
+	Distance  Distance // Defaults to Cosine
+}
+
+// columnNamePattern matches the names allowed for vector columns, which are
+// used unquoted in SQL
+var columnNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// reservedColumns are the columns every documents table has
+var reservedColumns = map[string]bool{
+	"id": true, "content": true, "metadata": true, defaultColumn: true,
+	"created_at": true, "updated_at": true, "deleted_at": true,
+}
+
+// vectorColumns validates the named vector columns of Options, returning them
+// with their defaults applied and their names in order
+func vectorColumns(specs map[string]VectorSpec) (map[string]VectorSpec, []string, error) {
+	vectors := make(map[string]VectorSpec, len(specs))
+	names := make([]string, 0, len(specs))
+	for name, spec := range specs {
+		if !columnNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid vector column name %q", name)
+		}
+		if reservedColumns[name] {
+			return nil, nil, fmt.Errorf("vector column %q is reserved", name)
+		}
+		if spec.Dimension <= 0 {
+			return nil, nil, fmt.Errorf("vector column %s needs a positive dimension", name)
+		}
+		if spec.Distance == "" {
+			spec.Distance = Cosine
+		}
+		if !spec.Distance.IsValid() {
+			return nil, nil, fmt.Errorf("invalid distance metric for vector column %s: %s", name, spec.Distance)
+		}
+		vectors[name] = spec
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return vectors, names, nil
+}
+
+// columnIndex returns the name of the vector index of a named column
+func columnIndex(table, column string) string {
+	return fmt.Sprintf("%s_%s_embedding_idx", table, column)
+}
+
+// AddDocumentsWithVectors adds docs with vectors for the default column,
+// keyed by vectorstore.DefaultVectorColumn, and for any of the columns in
+// Options.Vectors. Columns left out are NULL. Like AddDocuments, it inserts
+// docs in one transaction.
+func (p *PGVectorStore) AddDocumentsWithVectors(ctx context.Context, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	if err := p.validateColumns(docs, vectors); err != nil {
+		return err
+	}
+	return p.withRetry(ctx, retryUnsent, func() error {
+		return p.addDocuments(ctx, docs, vectors)
+	})
+}
+
+// ReplaceSourceWithVectors is ReplaceSource with vectors as in
+// AddDocumentsWithVectors
+func (p *PGVectorStore) ReplaceSourceWithVectors(ctx context.Context, source string, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	if err := p.validateColumns(docs, vectors); err != nil {
+		return err
+	}
+	return p.withRetry(ctx, retryConnErrors, func() error {
+		return p.replaceSource(ctx, source, docs, vectors)
+	})
+}
+
+// SimilaritySearchWithOptions searches the vector column selected by opts
+// with its own distance metric. Rows without a vector in the column are never
+// returned. With opts.ReturnVectors, the column's vectors are selected and
+// parsed into each document's Vector.
+func (p *PGVectorStore) SimilaritySearchWithOptions(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter, opts vectorstore.SearchOptions) ([]vectorstore.Document, error) {
+	column, spec := defaultColumn, VectorSpec{Dimension: p.dimension, Distance: p.distance}
+	if opts.Column != vectorstore.DefaultVectorColumn {
+		var ok bool
+		if spec, ok = p.vectors[opts.Column]; !ok {
+			return nil, vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("unknown vector column %q", opts.Column))
+		}
+		column = opts.Column
+	}
+	return p.similaritySearch(ctx, column, spec, vector, limit, filter, opts.ReturnVectors)
+}
+
+// validateColumns checks that vectors has the default column and only
+// configured ones, each with a vector of the column's dimension per document
+func (p *PGVectorStore) validateColumns(docs []vectorstore.Document, vectors map[string][][]float32) error {
+	if _, ok := vectors[vectorstore.DefaultVectorColumn]; !ok {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("missing vectors for the default column"))
+	}
+
+	for column, columnVectors := range vectors {
+		dimension := p.dimension
+		if column != vectorstore.DefaultVectorColumn {
+			spec, ok := p.vectors[column]
+			if !ok {
+				return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("unknown vector column %q", column))
+			}
+			dimension = spec.Dimension
+		}
+		if len(columnVectors) != len(docs) {
+			return vectorstore.NewAddFailedError("pgvector",
+				fmt.Errorf("%d vectors for column %q but %d documents", len(columnVectors), column, len(docs)))
+		}
+		for _, vec := range columnVectors {
+			if len(vec) != dimension {
+				return vectorstore.NewInvalidDimensionsError("pgvector", dimension, len(vec))
+			}
+		}
+	}
+	return nil
+}
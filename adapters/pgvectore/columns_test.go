@@ -0,0 +1,204 @@
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestNewPGVectorStore_InvalidVectorColumns(t *testing.T) {
+	tests := map[string]map[string]VectorSpec{
+		"Invalid name":     {"Code-Vec": {Dimension: 3}},
+		"Reserved name":    {"embedding": {Dimension: 3}},
+		"No dimension":     {"code": {}},
+		"Invalid distance": {"code": {Dimension: 3, Distance: "manhattan"}},
+	}
+
+	for name, vectors := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewPGVectorStore(context.Background(), "postgres://localhost/test", Options{
+				TableName: "docs",
+				Dimension: 3,
+				Vectors:   vectors,
+			})
+			var vsErr *vectorstore.VectorStoreError
+			if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeInitFailed {
+				t.Errorf("NewPGVectorStore() error = %v, want ErrCodeInitFailed", err)
+			}
+		})
+	}
+}
+
+func TestVectorColumns_Defaults(t *testing.T) {
+	vectors, names, err := vectorColumns(map[string]VectorSpec{
+		"summary": {Dimension: 4, Distance: Euclidean},
+		"code":    {Dimension: 8},
+	})
+	if err != nil {
+		t.Fatalf("vectorColumns() error = %v", err)
+	}
+	if len(names) != 2 || names[0] != "code" || names[1] != "summary" {
+		t.Errorf("names = %v, want them sorted", names)
+	}
+	if vectors["code"].Distance != Cosine || vectors["summary"].Distance != Euclidean {
+		t.Errorf("vectors = %+v, want Cosine by default", vectors)
+	}
+}
+
+func TestScoreExpression_Column(t *testing.T) {
+	store := &PGVectorStore{distance: Cosine}
+	if got := store.scoreExpression("code", InnerProduct, "<#>"); got != "(code <#> $1::vector) * -1" {
+		t.Errorf("scoreExpression() = %q", got)
+	}
+	if got := store.buildScoreExpression("<=>"); got != "1 - (embedding <=> $1::vector)" {
+		t.Errorf("buildScoreExpression() = %q, want the default column unchanged", got)
+	}
+}
+
+func TestPGVectorStore_ValidateColumns(t *testing.T) {
+	store := &PGVectorStore{dimension: 3, vectors: map[string]VectorSpec{"code": {Dimension: 2, Distance: Cosine}}}
+	docs := []vectorstore.Document{{PageContent: "a"}}
+
+	tests := []struct {
+		name     string
+		vectors  map[string][][]float32
+		wantCode vectorstore.ErrorCode
+	}{
+		{name: "Valid", vectors: map[string][][]float32{"": {{1, 0, 0}}, "code": {{1, 0}}}},
+		{name: "Default only", vectors: map[string][][]float32{"": {{1, 0, 0}}}},
+		{name: "Missing default", vectors: map[string][][]float32{"code": {{1, 0}}}, wantCode: vectorstore.ErrCodeAddFailed},
+		{name: "Unknown column", vectors: map[string][][]float32{"": {{1, 0, 0}}, "text": {{1, 0}}}, wantCode: vectorstore.ErrCodeAddFailed},
+		{name: "Missing vectors", vectors: map[string][][]float32{"": {{1, 0, 0}}, "code": nil}, wantCode: vectorstore.ErrCodeAddFailed},
+		{name: "Wrong dimension", vectors: map[string][][]float32{"": {{1, 0, 0}}, "code": {{1, 0, 0}}}, wantCode: vectorstore.ErrCodeInvalidDimensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.validateColumns(docs, tt.vectors)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("validateColumns() error = %v", err)
+				}
+				return
+			}
+			var vsErr *vectorstore.VectorStoreError
+			if !errors.As(err, &vsErr) || vsErr.Code != tt.wantCode {
+				t.Errorf("validateColumns() error = %v, want %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSearchQuery_ReturnVectors(t *testing.T) {
+	store := &PGVectorStore{tableName: "docs", dimension: 3, distance: Cosine}
+	spec := VectorSpec{Dimension: 2, Distance: Euclidean}
+
+	query, _, err := store.searchQuery("code", spec, []float32{1, 0}, 5, nil, true)
+	if err != nil {
+		t.Fatalf("searchQuery() error = %v", err)
+	}
+	if !strings.Contains(query, "code::text as vector") {
+		t.Errorf("query = %s, want the searched column's vectors selected", query)
+	}
+
+	query, _, err = store.searchQuery(defaultColumn, VectorSpec{Dimension: 3, Distance: Cosine}, []float32{1, 0, 0}, 5, nil, false)
+	if err != nil {
+		t.Fatalf("searchQuery() error = %v", err)
+	}
+	if strings.Contains(query, "embedding::text") {
+		t.Errorf("query = %s, want no vectors selected by default", query)
+	}
+}
+
+// columnPool holds the vectors of each column by row ID, in their text form,
+// serving RenormalizeVectors' selects and applying its updates
+type columnPool struct {
+	dbPool
+	columns map[string]map[int]string
+}
+
+func (c *columnPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	column := strings.TrimSpace(sql[strings.Index(sql, "SELECT id,")+len("SELECT id,") : strings.Index(sql, "::text")])
+	rows := &columnRows{}
+	for id, text := range c.columns[column] {
+		if id > args[0].(int) {
+			rows.ids = append(rows.ids, id)
+			rows.texts = append(rows.texts, text)
+		}
+	}
+	return rows, nil
+}
+
+func (c *columnPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	for _, q := range b.QueuedQueries {
+		column := strings.Fields(q.SQL[strings.Index(q.SQL, " SET ")+len(" SET "):])[0]
+		c.columns[column][q.Arguments[0].(int)] = q.Arguments[1].(string)
+	}
+	return &fakeBatchResults{}
+}
+
+// columnRows returns rows of ID and vector text
+type columnRows struct {
+	pgx.Rows
+	ids   []int
+	texts []string
+	next  int
+}
+
+func (r *columnRows) Next() bool {
+	r.next++
+	return r.next <= len(r.ids)
+}
+
+func (r *columnRows) Scan(dest ...any) error {
+	*dest[0].(*int) = r.ids[r.next-1]
+	*dest[1].(*string) = r.texts[r.next-1]
+	return nil
+}
+
+func (r *columnRows) Err() error { return nil }
+func (r *columnRows) Close()     {}
+
+func TestPGVectorStore_RenormalizeVectorsColumns(t *testing.T) {
+	pool := &columnPool{columns: map[string]map[int]string{
+		"embedding": {1: "[3,4]"},
+		"code":      {1: "[0,2]", 2: "[6,8]"},
+	}}
+	store := &PGVectorStore{
+		pool:          pool,
+		tableName:     "docs",
+		vectors:       map[string]VectorSpec{"code": {Dimension: 2, Distance: Cosine}},
+		vectorColumns: []string{"code"},
+	}
+
+	updated, err := store.RenormalizeVectors(context.Background())
+	if err != nil {
+		t.Fatalf("RenormalizeVectors() error = %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("RenormalizeVectors() = %d, want 3 vectors", updated)
+	}
+	want := map[string]map[int][]float32{
+		"embedding": {1: {0.6, 0.8}},
+		"code":      {1: {0, 1}, 2: {0.6, 0.8}},
+	}
+	for column, rows := range want {
+		for id, vector := range rows {
+			got, err := parseVectorFromPG(pool.columns[column][id])
+			if err != nil {
+				t.Fatalf("parseVectorFromPG() error = %v", err)
+			}
+			for i := range vector {
+				if math.Abs(float64(got[i]-vector[i])) > 1e-6 {
+					t.Errorf("%s of row %d = %v, want %v", column, id, got, vector)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package pgvectore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// Metadata keys under which documents read from the table carry the
+// timestamps of their row. They start with an underscore, like the filter
+// keys, so metadata indexed under "created_at" and the like is kept.
+const (
+	CreatedAtMetadataKey = "_created_at" // When the document was first indexed
+	UpdatedAtMetadataKey = "_updated_at" // When the document was last indexed or re-embedded
+	DeletedAtMetadataKey = "_deleted_at" // When the document was soft-deleted, only set if it was
+)
+
+// Filter keys that match row timestamps and soft deletion instead of
+// metadata. The time keys take a time.Time.
+const (
+	// CreatedAfterKey keeps documents created at or after the time
+	CreatedAfterKey = "_created_after"
+	// CreatedBeforeKey keeps documents created before the time
+	CreatedBeforeKey = "_created_before"
+	// UpdatedAfterKey keeps documents updated at or after the time
+	UpdatedAfterKey = "_updated_after"
+	// IncludeDeletedKey set to true makes SimilaritySearch return
+	// soft-deleted documents, which it otherwise leaves out
+	IncludeDeletedKey = "_include_deleted"
+)
+
+// timeConditions are the SQL conditions of the time filter keys
+var timeConditions = map[string]string{
+	CreatedAfterKey:  "created_at >= $%d",
+	CreatedBeforeKey: "created_at < $%d",
+	UpdatedAfterKey:  "updated_at >= $%d",
+}
+
+// filterConditions returns the SQL conditions of filter, in key order, with
+// their arguments numbered from first, and whether IncludeDeletedKey is set
+func filterConditions(filter vectorstore.Filter, first int) ([]string, []interface{}, bool) {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conditions []string
+	var args []interface{}
+	includeDeleted := false
+	for _, key := range keys {
+		value := filter[key]
+		if key == IncludeDeletedKey {
+			includeDeleted = value == true
+			continue
+		}
+		if condition, ok := timeConditions[key]; ok {
+			conditions = append(conditions, fmt.Sprintf(condition, first+len(args)))
+		} else if cond, ok := value.(vectorstore.Condition); ok {
+			condConditions, condArgs := conditionSQL(key, cond, first+len(args))
+			conditions = append(conditions, condConditions...)
+			args = append(args, condArgs...)
+			continue
+		} else {
+			conditions = append(conditions, fmt.Sprintf("metadata->>'%s' = $%d", key, first+len(args)))
+		}
+		args = append(args, value)
+	}
+	return conditions, args, includeDeleted
+}
+
+// conditionOperators are the SQL operators of the vectorstore.Condition
+// operators comparing with a single value
+var conditionOperators = map[string]string{
+	vectorstore.OpEq:  "=",
+	vectorstore.OpNe:  "IS DISTINCT FROM",
+	vectorstore.OpGt:  ">",
+	vectorstore.OpGte: ">=",
+	vectorstore.OpLt:  "<",
+	vectorstore.OpLte: "<=",
+}
+
+// conditionSQL returns the SQL conditions of the Condition of key, in
+// operator order, with their arguments numbered from first. Metadata is
+// compared as text, like plain filter values, except that ordering compares
+// it as a timestamp with a time.Time and as a number with a number. Rows
+// whose value can't be ordered that way don't match, instead of failing the
+// query.
+func conditionSQL(key string, cond vectorstore.Condition, first int) ([]string, []interface{}) {
+	ops := make([]string, 0, len(cond))
+	for op := range cond {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	var conditions []string
+	var args []interface{}
+	for _, op := range ops {
+		value := cond[op]
+		placeholder := first + len(args)
+		switch op {
+		case vectorstore.OpIn:
+			conditions = append(conditions, fmt.Sprintf("metadata->>'%s' = ANY($%d)", key, placeholder))
+			args = append(args, textValues(value))
+		case vectorstore.OpEq, vectorstore.OpNe:
+			conditions = append(conditions, fmt.Sprintf("metadata->>'%s' %s $%d", key, conditionOperators[op], placeholder))
+			args = append(args, value)
+		default:
+			conditions = append(conditions, fmt.Sprintf("%s %s $%d", orderedField(key, value), conditionOperators[op], placeholder))
+			args = append(args, value)
+		}
+	}
+	return conditions, args
+}
+
+// orderedField is the metadata field of key cast to the type value is
+// ordered as. The cast is guarded so values of another type are NULL: only
+// JSON numbers are ordered as numbers, and only strings shaped like an
+// RFC 3339 time as timestamps.
+func orderedField(key string, value interface{}) string {
+	switch value.(type) {
+	case time.Time:
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(metadata->'%[1]s') = 'string' AND metadata->>'%[1]s' ~ '%[2]s' "+
+			"THEN (metadata->>'%[1]s')::timestamptz END)", key, timestampPattern)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(metadata->'%[1]s') = 'number' THEN (metadata->>'%[1]s')::numeric END)", key)
+	default:
+		return fmt.Sprintf("metadata->>'%s'", key)
+	}
+}
+
+// timestampPattern matches the RFC 3339 times time.Time is stored as in
+// metadata
+const timestampPattern = `^\d{4}-(0[1-9]|1[0-2])-(0[1-9]|[12]\d|3[01])[T ]([01]\d|2[0-3]):[0-5]\d:[0-5]\d(\.\d+)?(Z|[+-]\d{2}:\d{2})$`
+
+// textValues returns the elements of the slice values as text, or values
+// itself if it isn't one
+func textValues(values interface{}) []string {
+	v := reflect.ValueOf(values)
+	if kind := v.Kind(); kind != reflect.Slice && kind != reflect.Array {
+		return []string{fmt.Sprint(values)}
+	}
+	texts := make([]string, v.Len())
+	for i := range texts {
+		texts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return texts
+}
+
+// validateConditions checks that the conditions of filter use known
+// operators, with a slice for OpIn
+func validateConditions(filter vectorstore.Filter) error {
+	for key, value := range filter {
+		cond, ok := value.(vectorstore.Condition)
+		if !ok {
+			continue
+		}
+		if len(cond) == 0 {
+			return fmt.Errorf("empty condition for key %s", key)
+		}
+		for op, operand := range cond {
+			if operand == nil {
+				return fmt.Errorf("nil value for %s of key %s", op, key)
+			}
+			if op == vectorstore.OpIn {
+				if kind := reflect.ValueOf(operand).Kind(); kind != reflect.Slice && kind != reflect.Array {
+					return fmt.Errorf("%s of key %s must be a slice, got %T", op, key, operand)
+				}
+				continue
+			}
+			if _, known := conditionOperators[op]; !known {
+				return fmt.Errorf("unknown operator %s for key %s", op, key)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTimeFilter checks that the time filter keys are set to times
+func validateTimeFilter(filter vectorstore.Filter) error {
+	for key := range timeConditions {
+		if value, ok := filter[key]; ok {
+			if _, isTime := value.(time.Time); !isTime {
+				return fmt.Errorf("%s must be a time.Time, got %T", key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// validateDeleteFilter checks a filter of a delete. An empty filter deletes
+// every document, but one whose only keys select no rows, such as
+// IncludeDeletedKey alone, is rejected rather than taken as empty.
+func validateDeleteFilter(filter vectorstore.Filter) error {
+	if err := validateTimeFilter(filter); err != nil {
+		return err
+	}
+	if err := validateConditions(filter); err != nil {
+		return err
+	}
+	if conditions, _, _ := filterConditions(filter, 1); len(filter) > 0 && len(conditions) == 0 {
+		return fmt.Errorf("filter has no conditions besides %s", IncludeDeletedKey)
+	}
+	return nil
+}
+
+// setTimestamps adds the timestamps of a row to the metadata of doc
+func setTimestamps(doc *vectorstore.Document, createdAt, updatedAt, deletedAt *time.Time) {
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]interface{})
+	}
+	if createdAt != nil {
+		doc.Metadata[CreatedAtMetadataKey] = *createdAt
+	}
+	if updatedAt != nil {
+		doc.Metadata[UpdatedAtMetadataKey] = *updatedAt
+	}
+	if deletedAt != nil {
+		doc.Metadata[DeletedAtMetadataKey] = *deletedAt
+	}
+}
+
+// DeleteOption configures DeleteWithOptions
+type DeleteOption func(*deleteOptions)
+
+type deleteOptions struct {
+	soft bool
+}
+
+// WithSoftDelete marks documents as deleted instead of removing them, so they
+// can be reviewed before PurgeDeleted removes them. Soft-deleted documents
+// are left out of searches, ListSources and DocumentExists, but still
+// removed by Delete and ReplaceSource.
+func WithSoftDelete() DeleteOption {
+	return func(o *deleteOptions) {
+		o.soft = true
+	}
+}
+
+// DeleteWithOptions is DeleteCount with opts. Soft-deleting documents that
+// already are leaves them as they were and doesn't count them.
+func (p *PGVectorStore) DeleteWithOptions(ctx context.Context, filter vectorstore.Filter, opts ...DeleteOption) (int, error) {
+	options := &deleteOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if !options.soft {
+		return p.DeleteCount(ctx, filter)
+	}
+	if err := validateDeleteFilter(filter); err != nil {
+		return 0, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+	}
+
+	conditions, args, _ := filterConditions(filter, 1)
+	conditions = append(conditions, "deleted_at IS NULL")
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = CURRENT_TIMESTAMP WHERE %s", p.tableName, strings.Join(conditions, " AND "))
+
+	var deleted int
+	err := p.withRetry(ctx, retryConnErrors, func() error {
+		tag, err := p.pool.Exec(ctx, query, args...)
+		deleted = int(tag.RowsAffected())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// PurgeDeleted removes the documents soft-deleted at least olderThan ago and
+// returns how many it removed
+func (p *PGVectorStore) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int, error) {
+	query := fmt.Sprintf("DELETE FROM %s WHERE deleted_at <= $1", p.tableName)
+	cutoff := time.Now().Add(-olderThan)
+
+	var purged int
+	err := p.withRetry(ctx, retryConnErrors, func() error {
+		tag, err := p.pool.Exec(ctx, query, cutoff)
+		purged = int(tag.RowsAffected())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// migrateColumns adds the columns introduced after a documents table was
+// created, keeping its rows. Rows that predate updated_at get their
+// creation time.
+func (p *PGVectorStore) migrateColumns(ctx context.Context, e execer, table string) error {
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE", table),
+		fmt.Sprintf("UPDATE %s SET updated_at = created_at WHERE updated_at IS NULL", table),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN updated_at SET DEFAULT CURRENT_TIMESTAMP", table),
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE", table),
+	}
+	for _, statement := range statements {
+		if _, err := e.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate table columns: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/jackc/pgx/v5"
+)
+
+// defaultMigrationSuffix is appended to the table name to name the target
+// of a migration when none is given
+const defaultMigrationSuffix = "_migration"
+
+// indexSuffixes returns the suffixes appended to a table's name to name its
+// indexes, including those of the named vector columns
+func (p *PGVectorStore) indexSuffixes() []string {
+	suffixes := []string{"_embedding_idx", "_metadata_source_lastmod_idx", "_metadata_gin_idx", "_deleted_at_idx"}
+	for _, name := range p.vectorColumns {
+		suffixes = append(suffixes, columnIndex("", name))
+	}
+	return suffixes
+}
+
+// ListDocuments pages through the table in row ID order. Cursors are row IDs.
+// Soft-deleted documents are listed too, flagged with DeletedAtMetadataKey,
+// so migrations keep them.
+func (p *PGVectorStore) ListDocuments(ctx context.Context, cursor string, limit int) ([]vectorstore.StoredDocument, string, error) {
+	var after int64
+	if cursor != "" {
+		var err error
+		if after, err = strconv.ParseInt(cursor, 10, 64); err != nil {
+			return nil, "", vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("invalid cursor %q", cursor))
+		}
+	}
+
+	// A NULL limit returns every row
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	query := fmt.Sprintf(`
+        SELECT id, content, metadata, created_at, updated_at, deleted_at
+        FROM %s
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2`, p.tableName)
+
+	rows, err := p.pool.Query(ctx, query, after, limitArg)
+	if err != nil {
+		return nil, "", vectorstore.NewSearchFailedError("pgvector", err)
+	}
+	defer rows.Close()
+
+	var docs []vectorstore.StoredDocument
+	for rows.Next() {
+		var id int64
+		var doc vectorstore.Document
+		var createdAt, updatedAt, deletedAt *time.Time
+		if err := rows.Scan(&id, &doc.PageContent, &doc.Metadata, &createdAt, &updatedAt, &deletedAt); err != nil {
+			return nil, "", vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("failed to scan row: %w", err))
+		}
+		setTimestamps(&doc, createdAt, updatedAt, deletedAt)
+		docs = append(docs, vectorstore.StoredDocument{ID: strconv.FormatInt(id, 10), Document: doc})
+		cursor = strconv.FormatInt(id, 10)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", vectorstore.NewSearchFailedError("pgvector", err)
+	}
+
+	return docs, cursor, nil
+}
+
+// migrationTable returns the target table of a migration, defaulting to the
+// table name with defaultMigrationSuffix
+func (p *PGVectorStore) migrationTable(op, target string) (string, error) {
+	if target == "" {
+		return p.tableName + defaultMigrationSuffix, nil
+	}
+	if target == p.tableName {
+		return "", &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeUpdateFailed,
+			Op:      op,
+			Store:   "pgvector",
+			Message: "migration target must differ from the table " + p.tableName,
+		}
+	}
+	return target, nil
+}
+
+// PrepareMigration creates the target table for vectors of dimension,
+// dropping it first unless resuming. Its indexes are only built by
+// SwitchMigration, once it holds every row. A table a resumed migration
+// can't continue, such as the old table left by a finished migration or one
+// for another dimension, is dropped too.
+func (p *PGVectorStore) PrepareMigration(ctx context.Context, target string, dimension int, resume bool) error {
+	target, err := p.migrationTable("PrepareMigration", target)
+	if err != nil {
+		return err
+	}
+
+	// WriteVectors copies columns the table may predate
+	if err := p.migrateColumns(ctx, p.pool, p.tableName); err != nil {
+		return p.migrationError("PrepareMigration", err)
+	}
+	if resume {
+		if resume, err = p.resumableTable(ctx, target, dimension); err != nil {
+			return p.migrationError("PrepareMigration", err)
+		}
+	}
+	if !resume {
+		if _, err := p.pool.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", target)); err != nil {
+			return p.migrationError("PrepareMigration", fmt.Errorf("failed to drop table %s: %w", target, err))
+		}
+	}
+	if err := p.createTable(ctx, target, dimension); err != nil {
+		return p.migrationError("PrepareMigration", err)
+	}
+	return nil
+}
+
+// resumableTable reports whether target can be resumed into: it is missing,
+// or it holds vectors of dimension and has no indexes yet. Indexes are only
+// built by SwitchMigration, so a target with them is the old table a
+// finished migration swapped out.
+func (p *PGVectorStore) resumableTable(ctx context.Context, target string, dimension int) (bool, error) {
+	var typmod, indexes int
+	err := p.pool.QueryRow(ctx, `
+        SELECT a.atttypmod,
+               (SELECT COUNT(*) FROM pg_index i WHERE i.indrelid = a.attrelid AND NOT i.indisprimary)
+        FROM pg_attribute a
+        WHERE a.attrelid = to_regclass($1) AND a.attname = 'embedding' AND NOT a.attisdropped`,
+		target).Scan(&typmod, &indexes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", target, err)
+	}
+	resumable := typmod == dimension && indexes == 0
+	if !resumable {
+		p.logger.Warn("pgvector: dropping migration target that can't be resumed",
+			"table", target,
+			"dimension", typmod,
+			"want_dimension", dimension,
+			"indexes", indexes,
+		)
+	}
+	return resumable, nil
+}
+
+// WriteVectors copies the rows with ids into the target table with vectors.
+// Their content and metadata are copied within the database, keeping their
+// IDs, creation and deletion times and the vectors of named columns; their
+// update time becomes now.
+func (p *PGVectorStore) WriteVectors(ctx context.Context, target string, ids []string, vectors [][]float32) error {
+	target, err := p.migrationTable("WriteVectors", target)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(vectors) {
+		return p.migrationError("WriteVectors", fmt.Errorf("%d ids but %d vectors", len(ids), len(vectors)))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var columns string
+	for _, name := range p.vectorColumns {
+		columns += ", " + name
+	}
+
+	copySQL := fmt.Sprintf(`
+        INSERT INTO %s (id, content, metadata, embedding, created_at, updated_at, deleted_at%s)
+        SELECT id, content, metadata, $2::vector, created_at, CURRENT_TIMESTAMP, deleted_at%s
+        FROM %s
+        WHERE id = $1
+        ON CONFLICT (id) DO UPDATE SET embedding = EXCLUDED.embedding, updated_at = EXCLUDED.updated_at`, target, columns, columns, p.tableName)
+
+	batch := &pgx.Batch{}
+	for i, id := range ids {
+		rowID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return p.migrationError("WriteVectors", fmt.Errorf("invalid document ID %q", id))
+		}
+		batch.Queue(copySQL, rowID, formatVectorForPG(p.prepareVector(vectors[i])))
+	}
+
+	// Rows are upserted, so writing them again after a connection failure is safe
+	err = p.withRetry(ctx, retryConnErrors, func() error {
+		return p.pool.SendBatch(ctx, batch).Close()
+	})
+	if err != nil {
+		return p.migrationError("WriteVectors", err)
+	}
+	return nil
+}
+
+// SwitchMigration indexes the target table and swaps its name with the
+// store's table in one transaction, so searches see either every old vector
+// or every new one. Indexes are renamed along with their tables.
+func (p *PGVectorStore) SwitchMigration(ctx context.Context, target string, dimension int) error {
+	target, err := p.migrationTable("SwitchMigration", target)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return p.migrationError("SwitchMigration", fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback(ctx)
+
+	if err := p.createIndexes(ctx, tx, target); err != nil {
+		return p.migrationError("SwitchMigration", err)
+	}
+
+	// Rows were copied with their IDs, so new rows must be numbered after them
+	sequenceSQL := fmt.Sprintf(`
+        SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL)
+        FROM %s`, target, target)
+	if _, err := tx.Exec(ctx, sequenceSQL); err != nil {
+		return p.migrationError("SwitchMigration", fmt.Errorf("failed to advance id sequence: %w", err))
+	}
+
+	swap := target + "_swap"
+	for _, rename := range [][2]string{{p.tableName, swap}, {target, p.tableName}, {swap, target}} {
+		if err := p.renameTable(ctx, tx, rename[0], rename[1]); err != nil {
+			return p.migrationError("SwitchMigration", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return p.migrationError("SwitchMigration", fmt.Errorf("failed to commit transaction: %w", err))
+	}
+
+	p.dimension = dimension
+	return nil
+}
+
+// renameTable renames a documents table and its indexes
+func (p *PGVectorStore) renameTable(ctx context.Context, e execer, from, to string) error {
+	if _, err := e.Exec(ctx, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", from, to)); err != nil {
+		return fmt.Errorf("failed to rename table %s to %s: %w", from, to, err)
+	}
+	for _, suffix := range p.indexSuffixes() {
+		sql := fmt.Sprintf("ALTER INDEX IF EXISTS %s%s RENAME TO %s%s", from, suffix, to, suffix)
+		if _, err := e.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to rename index %s%s: %w", from, suffix, err)
+		}
+	}
+	return nil
+}
+
+func (p *PGVectorStore) migrationError(op string, err error) error {
+	return vectorstore.NewUpdateFailedError("pgvector", op, err)
+}
@@ -0,0 +1,96 @@
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// defaultRetryBackoff is the delay before the first retry when Options.RetryBackoff is unset
+const defaultRetryBackoff = 100 * time.Millisecond
+
+// dbPool is the part of *pgxpool.Pool the store uses
+type dbPool interface {
+	querier
+	batchSender
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Close()
+}
+
+// retryMode says which failures an operation may be retried after
+type retryMode int
+
+const (
+	// retryConnErrors retries any connection failure, for operations that can
+	// safely run twice
+	retryConnErrors retryMode = iota
+	// retryUnsent only retries failures that happened before the statement
+	// reached the server, for operations that must not run twice
+	retryUnsent
+)
+
+// withRetry runs fn, running it again on a fresh pool connection after
+// connection failures, up to QueryRetries times. Errors reported by the
+// server for the query itself are returned right away.
+func (p *PGVectorStore) withRetry(ctx context.Context, mode retryMode, fn func() error) error {
+	backoff := p.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.queryRetries || !isRetryableConnError(err, mode) || ctx.Err() != nil {
+			return err
+		}
+
+		p.logger.Warn("pgvector: retrying after connection error",
+			"table", p.tableName,
+			"attempt", attempt+1,
+			"error", err,
+		)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryableConnError reports whether err means the connection, rather than
+// the query, failed
+func isRetryableConnError(err error, mode retryMode) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	if mode == retryUnsent {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exceptions; 57P01-57P03 are sent when the
+		// server shuts down or restarts, as in a failover
+		return strings.HasPrefix(pgErr.Code, "08") ||
+			pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
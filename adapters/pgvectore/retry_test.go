@@ -0,0 +1,245 @@
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// unsentError is a connection failure pgx reports before the statement was sent
+type unsentError struct{}
+
+func (unsentError) Error() string     { return "failed to acquire connection" }
+func (unsentError) SafeToRetry() bool { return true }
+
+// flakyPool fails the first calls of each kind with errs, then succeeds
+type flakyPool struct {
+	dbPool
+	errs  []error
+	calls int
+	tx    *fakeTx // The last transaction begun
+}
+
+func (f *flakyPool) fail() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyPool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	return &fakeRows{docs: []vectorstore.Document{{PageContent: "alpha", Score: 0.9}}}, nil
+}
+
+func (f *flakyPool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if err := f.fail(); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return pgconn.NewCommandTag("DELETE 2"), nil
+}
+
+func (f *flakyPool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return &fakeBatchResults{err: f.fail()}
+}
+
+func (f *flakyPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	f.tx = &fakeTx{pool: f}
+	return f.tx, nil
+}
+
+// fakeTx sends batches through its pool and records how it ended
+type fakeTx struct {
+	pgx.Tx
+	pool       *flakyPool
+	committed  bool
+	rolledBack bool
+}
+
+func (t *fakeTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return t.pool.SendBatch(ctx, b)
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	if !t.committed {
+		t.rolledBack = true
+	}
+	return nil
+}
+
+// fakeRows returns docs as rows of content, metadata and score
+type fakeRows struct {
+	pgx.Rows
+	docs []vectorstore.Document
+	next int
+}
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next <= len(r.docs)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	doc := r.docs[r.next-1]
+	*dest[0].(*string) = doc.PageContent
+	*dest[1].(*map[string]interface{}) = doc.Metadata
+	*dest[2].(*float32) = doc.Score
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+func (r *fakeRows) Close()     {}
+
+type fakeBatchResults struct {
+	pgx.BatchResults
+	err error
+}
+
+func (b *fakeBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.NewCommandTag("INSERT 0 1"), b.err
+}
+
+func (b *fakeBatchResults) Close() error { return nil }
+
+func newFlakyStore(retries int, errs ...error) (*PGVectorStore, *flakyPool) {
+	pool := &flakyPool{errs: errs}
+	return &PGVectorStore{
+		pool:         pool,
+		tableName:    "docs",
+		dimension:    3,
+		distance:     Cosine,
+		queryRetries: retries,
+		retryBackoff: time.Millisecond,
+		logger:       logging.Discard(),
+	}, pool
+}
+
+func TestPGVectorStore_RetriesConnectionErrors(t *testing.T) {
+	ctx := context.Background()
+	connErr := &pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"}
+
+	t.Run("SimilaritySearch", func(t *testing.T) {
+		store, pool := newFlakyStore(1, connErr)
+		docs, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 1, nil)
+		if err != nil {
+			t.Fatalf("SimilaritySearch() error = %v", err)
+		}
+		if len(docs) != 1 || docs[0].PageContent != "alpha" {
+			t.Errorf("SimilaritySearch() = %v, want alpha", docs)
+		}
+		if pool.calls != 2 {
+			t.Errorf("queries = %d, want 2", pool.calls)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store, pool := newFlakyStore(1, io.ErrUnexpectedEOF)
+		removed, err := store.DeleteCount(ctx, vectorstore.Filter{"source": "a.txt"})
+		if err != nil {
+			t.Fatalf("DeleteCount() error = %v", err)
+		}
+		if removed != 2 || pool.calls != 2 {
+			t.Errorf("DeleteCount() = %d after %d calls, want 2 after 2", removed, pool.calls)
+		}
+	})
+
+	t.Run("AddDocuments before sending", func(t *testing.T) {
+		store, pool := newFlakyStore(1, unsentError{})
+		err := store.AddDocuments(ctx, []vectorstore.Document{{PageContent: "alpha"}}, [][]float32{{1, 0, 0}})
+		if err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		if pool.calls != 2 {
+			t.Errorf("batches = %d, want 2", pool.calls)
+		}
+	})
+}
+
+func TestPGVectorStore_DoesNotRetry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		retries int
+		err     error
+		call    func(store *PGVectorStore) error
+	}{
+		{
+			name:    "query error",
+			retries: 3,
+			err:     &pgconn.PgError{Code: "42P01", Message: `relation "docs" does not exist`},
+			call: func(store *PGVectorStore) error {
+				_, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 1, nil)
+				return err
+			},
+		},
+		{
+			name:    "insert that may have reached the server",
+			retries: 3,
+			err:     io.ErrUnexpectedEOF,
+			call: func(store *PGVectorStore) error {
+				return store.AddDocuments(ctx, []vectorstore.Document{{PageContent: "alpha"}}, [][]float32{{1, 0, 0}})
+			},
+		},
+		{
+			name:    "retries disabled",
+			retries: 0,
+			err:     io.ErrUnexpectedEOF,
+			call: func(store *PGVectorStore) error {
+				return store.Delete(ctx, vectorstore.Filter{"source": "a.txt"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, pool := newFlakyStore(tt.retries, tt.err)
+			if err := tt.call(store); !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+			if pool.calls != 1 {
+				t.Errorf("calls = %d, want 1", pool.calls)
+			}
+		})
+	}
+}
+
+func TestPGVectorStore_AddDocumentsInTransaction(t *testing.T) {
+	ctx := context.Background()
+	docs := []vectorstore.Document{{PageContent: "alpha"}, {PageContent: "beta"}}
+	vectors := [][]float32{{1, 0, 0}, {0, 1, 0}}
+
+	store, pool := newFlakyStore(0)
+	if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+	if pool.tx == nil || !pool.tx.committed {
+		t.Error("AddDocuments() did not commit a transaction")
+	}
+
+	insertErr := &pgconn.PgError{Code: "23514", Message: "check constraint violated"}
+	store, pool = newFlakyStore(0, insertErr)
+	if err := store.AddDocuments(ctx, docs, vectors); !errors.Is(err, insertErr) {
+		t.Fatalf("AddDocuments() error = %v, want %v", err, insertErr)
+	}
+	if pool.tx == nil || pool.tx.committed || !pool.tx.rolledBack {
+		t.Error("AddDocuments() did not roll back the transaction of a failed insert")
+	}
+}
@@ -2,13 +2,18 @@ package pgvectore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Abraxas-365/kbservice/document"
 	"github.com/Abraxas-365/kbservice/vectorstore"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
 )
@@ -32,22 +37,79 @@ func (d Distance) IsValid() bool {
 	}
 }
 
+// PGVectorStore is a vectorstore.Store backed by a pgvector table. It
+// implements every optional interface: ReplaceSource, ListSources, DeleteCount,
+// Dimension, ListDocuments, Migrate and VectorColumns.
 type PGVectorStore struct {
-	pool      *pgxpool.Pool
-	tableName string
-	dimension int
-	distance  Distance
+	pool               dbPool
+	tableName          string
+	dimension          int
+	distance           Distance
+	vectors            map[string]VectorSpec
+	vectorColumns      []string // Names of vectors, in order
+	statementTimeout   time.Duration
+	slowQueryThreshold time.Duration
+	normalize          bool
+	normalizeScores    bool
+	queryRetries       int
+	retryBackoff       time.Duration
+	logger             *slog.Logger
 }
 
 type Options struct {
 	TableName string
 	Dimension int
 	Distance  Distance
+	// Vectors adds named vector columns next to the default one, each with
+	// its own dimension and distance metric and indexed by InitDB, so
+	// documents can be searched by vectors from different embedders. Names
+	// must be lowercase SQL identifiers. See AddDocumentsWithVectors and
+	// SimilaritySearchWithOptions.
+	Vectors map[string]VectorSpec
+	// StatementTimeout is applied with SET LOCAL statement_timeout to every
+	// similarity search (0 disables it)
+	StatementTimeout time.Duration
+	// SlowQueryThreshold logs similarity searches that take longer than this (0 disables it)
+	SlowQueryThreshold time.Duration
+	// Logger receives slow query reports, defaults to slog.Default()
+	Logger *slog.Logger
+	// NormalizeVectors scales stored and query vectors to unit length, so scores
+	// don't depend on whether the embedder normalized them. Run
+	// RenormalizeVectors once when enabling it on a table with existing rows.
+	NormalizeVectors bool
+	// ScoreNormalization maps the distance of every metric to the same 0..1
+	// similarity, so a score threshold means the same whichever metric the
+	// table uses. Without it scores are 1 - cosine distance (-1..1) for Cosine,
+	// 1/(1+d) for Euclidean and the raw inner product for InnerProduct. See
+	// normalizedScore for the mapping.
+	ScoreNormalization bool
+	// QueryRetries is how many times SimilaritySearch, AddDocuments, Delete and
+	// ReplaceSource are retried on a new connection after a connection failure,
+	// such as during a database failover. Errors in the query itself are never
+	// retried, and AddDocuments is only retried when its statement never
+	// reached the server, so documents are not inserted twice.
+	QueryRetries int
+	// RetryBackoff is the delay before the first retry, doubled on every
+	// further retry (defaults to 100ms)
+	RetryBackoff time.Duration
 }
 
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// pgQueryCanceled is the SQLSTATE reported when statement_timeout cancels a query
+const pgQueryCanceled = "57014"
+
 // getOperatorAndFunction returns the appropriate operator and index operator class based on distance metric
 func (p *PGVectorStore) getOperatorAndFunction() (string, string) {
-	switch p.distance {
+	return operatorAndOpClass(p.distance)
+}
+
+// operatorAndOpClass returns the operator and index operator class of a distance metric
+func operatorAndOpClass(distance Distance) (string, string) {
+	switch distance {
 	case Euclidean:
 		return "<->", "vector_l2_ops"
 	case InnerProduct:
@@ -71,6 +133,16 @@ func NewPGVectorStore(ctx context.Context, connString string, opts Options) (*PG
 		}
 	}
 
+	vectors, vectorColumns, err := vectorColumns(opts.Vectors)
+	if err != nil {
+		return nil, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeInitFailed,
+			Op:      "NewPGVectorStore",
+			Store:   "pgvector",
+			Message: err.Error(),
+		}
+	}
+
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, &vectorstore.VectorStoreError{
@@ -93,16 +165,41 @@ func NewPGVectorStore(ctx context.Context, connString string, opts Options) (*PG
 		}
 	}
 
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultRetryBackoff
+	}
+
 	store := &PGVectorStore{
-		pool:      pool,
-		tableName: opts.TableName,
-		dimension: opts.Dimension,
-		distance:  opts.Distance,
+		pool:               pool,
+		tableName:          opts.TableName,
+		dimension:          opts.Dimension,
+		distance:           opts.Distance,
+		vectors:            vectors,
+		vectorColumns:      vectorColumns,
+		statementTimeout:   opts.StatementTimeout,
+		slowQueryThreshold: opts.SlowQueryThreshold,
+		normalize:          opts.NormalizeVectors,
+		normalizeScores:    opts.ScoreNormalization,
+		queryRetries:       opts.QueryRetries,
+		retryBackoff:       opts.RetryBackoff,
+		logger:             opts.Logger,
 	}
 
 	return store, nil
 }
 
+// MatchesConditions marks that filters with vectorstore.Conditions are
+// matched by every method taking a filter
+func (p *PGVectorStore) MatchesConditions() {}
+
+// Dimension returns the vector dimension of the store
+func (p *PGVectorStore) Dimension() int {
+	return p.dimension
+}
+
 func (p *PGVectorStore) InitDB(ctx context.Context, forceRecreate bool) error {
 	// Check if table exists
 	if !forceRecreate {
@@ -111,6 +208,13 @@ func (p *PGVectorStore) InitDB(ctx context.Context, forceRecreate bool) error {
 			"SELECT EXISTS (SELECT FROM information_schema.tables WHERE table_name = $1)",
 			p.tableName).Scan(&exists)
 		if err == nil && exists {
+			// Bring tables created by earlier versions up to date
+			if err := p.migrateColumns(ctx, p.pool, p.tableName); err != nil {
+				return vectorstore.NewInitFailedError("pgvector", err)
+			}
+			if err := p.createIndexes(ctx, p.pool, p.tableName); err != nil {
+				return vectorstore.NewInitFailedError("pgvector", err)
+			}
 			return vectorstore.NewDBExistsError("pgvector", nil)
 		}
 	}
@@ -129,22 +233,50 @@ func (p *PGVectorStore) InitDB(ctx context.Context, forceRecreate bool) error {
 		}
 	}
 
-	// Create table
+	if err := p.createTable(ctx, p.tableName, p.dimension); err != nil {
+		return vectorstore.NewInitFailedError("pgvector", err)
+	}
+	if err := p.createIndexes(ctx, p.pool, p.tableName); err != nil {
+		return vectorstore.NewInitFailedError("pgvector", err)
+	}
+
+	return nil
+}
+
+// execer is satisfied by both the pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// createTable creates a documents table for vectors of dimension, with the
+// named vector columns of Options.Vectors
+func (p *PGVectorStore) createTable(ctx context.Context, table string, dimension int) error {
+	var columns strings.Builder
+	for _, name := range p.vectorColumns {
+		fmt.Fprintf(&columns, ",\n            %s vector(%d)", name, p.vectors[name].Dimension)
+	}
+
 	createTableSQL := fmt.Sprintf(`
         CREATE TABLE IF NOT EXISTS %s (
             id SERIAL PRIMARY KEY,
             content TEXT NOT NULL,
             metadata JSONB,
             embedding vector(%d),
-            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+            deleted_at TIMESTAMP WITH TIME ZONE%s
         )
-    `, p.tableName, p.dimension)
+    `, table, dimension, columns.String())
 
-	_, err = p.pool.Exec(ctx, createTableSQL)
-	if err != nil {
-		return vectorstore.NewInitFailedError("pgvector", fmt.Errorf("failed to create table: %w", err))
+	if _, err := p.pool.Exec(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
 	}
+	return nil
+}
 
+// createIndexes creates the vector and metadata indexes of a documents table,
+// named after it as listed by indexSuffixes
+func (p *PGVectorStore) createIndexes(ctx context.Context, e execer, table string) error {
 	// Create vector similarity index
 	_, opClass := p.getOperatorAndFunction()
 	vectorIndexSQL := fmt.Sprintf(`
@@ -152,58 +284,183 @@ func (p *PGVectorStore) InitDB(ctx context.Context, forceRecreate bool) error {
         ON %s 
         USING ivfflat (embedding %s)
         WITH (lists = 100)
-    `, p.tableName, p.tableName, opClass)
+    `, table, table, opClass)
 
-	_, err = p.pool.Exec(ctx, vectorIndexSQL)
-	if err != nil {
-		return vectorstore.NewInitFailedError("pgvector", fmt.Errorf("failed to create vector index: %w", err))
+	if _, err := e.Exec(ctx, vectorIndexSQL); err != nil {
+		return fmt.Errorf("failed to create vector index: %w", err)
+	}
+
+	// Create a similarity index per named vector column
+	for _, name := range p.vectorColumns {
+		_, opClass := operatorAndOpClass(p.vectors[name].Distance)
+		columnIndexSQL := fmt.Sprintf(`
+        CREATE INDEX IF NOT EXISTS %s 
+        ON %s 
+        USING ivfflat (%s %s)
+        WITH (lists = 100)
+    `, columnIndex(table, name), table, name, opClass)
+
+		if _, err := e.Exec(ctx, columnIndexSQL); err != nil {
+			return fmt.Errorf("failed to create vector index of column %s: %w", name, err)
+		}
 	}
 
 	// Create index for source and last_modified lookups
 	metadataIndexSQL := fmt.Sprintf(`
         CREATE INDEX IF NOT EXISTS %s_metadata_source_lastmod_idx 
         ON %s ((metadata->>'source'), (metadata->>'last_modified'))
-    `, p.tableName, p.tableName)
+    `, table, table)
 
-	_, err = p.pool.Exec(ctx, metadataIndexSQL)
-	if err != nil {
-		return vectorstore.NewInitFailedError("pgvector", fmt.Errorf("failed to create metadata index: %w", err))
+	if _, err := e.Exec(ctx, metadataIndexSQL); err != nil {
+		return fmt.Errorf("failed to create metadata index: %w", err)
 	}
 
 	// Create index for general metadata filters
 	filterIndexSQL := fmt.Sprintf(`
         CREATE INDEX IF NOT EXISTS %s_metadata_gin_idx 
         ON %s USING GIN (metadata)
-    `, p.tableName, p.tableName)
+    `, table, table)
 
-	_, err = p.pool.Exec(ctx, filterIndexSQL)
-	if err != nil {
-		return vectorstore.NewInitFailedError("pgvector", fmt.Errorf("failed to create metadata GIN index: %w", err))
+	if _, err := e.Exec(ctx, filterIndexSQL); err != nil {
+		return fmt.Errorf("failed to create metadata GIN index: %w", err)
+	}
+
+	// Create index for PurgeDeleted
+	deletedIndexSQL := fmt.Sprintf(`
+        CREATE INDEX IF NOT EXISTS %s_deleted_at_idx 
+        ON %s (deleted_at) WHERE deleted_at IS NOT NULL
+    `, table, table)
+
+	if _, err := e.Exec(ctx, deletedIndexSQL); err != nil {
+		return fmt.Errorf("failed to create deleted_at index: %w", err)
 	}
 
 	return nil
 }
 
+// batchSender is satisfied by both the pool and a transaction
+type batchSender interface {
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// AddDocuments inserts docs in one transaction, so a failing insert leaves
+// none of them stored
 func (p *PGVectorStore) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
-	// Validate vector dimensions
+	if err := p.validateVectors(vectors); err != nil {
+		return err
+	}
+	return p.withRetry(ctx, retryUnsent, func() error {
+		return p.addDocuments(ctx, docs, map[string][][]float32{vectorstore.DefaultVectorColumn: vectors})
+	})
+}
+
+// addDocuments runs insertDocuments in a transaction of its own
+func (p *PGVectorStore) addDocuments(ctx context.Context, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback(ctx)
+
+	if err := p.insertDocuments(ctx, tx, docs, vectors, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to commit transaction: %w", err))
+	}
+	return nil
+}
+
+// ReplaceSource deletes the chunks of source and inserts docs in one
+// transaction, so searches never see the source half replaced. The new
+// chunks keep the creation time of the source's earliest chunk, so only
+// their update time says when the source was last indexed.
+func (p *PGVectorStore) ReplaceSource(ctx context.Context, source string, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := p.validateVectors(vectors); err != nil {
+		return err
+	}
+
+	// Replacing is idempotent, so it is retried even if the commit may have happened
+	return p.withRetry(ctx, retryConnErrors, func() error {
+		return p.replaceSource(ctx, source, docs, map[string][][]float32{vectorstore.DefaultVectorColumn: vectors})
+	})
+}
+
+func (p *PGVectorStore) replaceSource(ctx context.Context, source string, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback(ctx)
+
+	var createdAt *time.Time
+	createdSQL := fmt.Sprintf("SELECT MIN(created_at) FROM %s WHERE metadata->>'source' = $1", p.tableName)
+	if err := tx.QueryRow(ctx, createdSQL, source).Scan(&createdAt); err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to read source %s: %w", source, err))
+	}
+
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE metadata->>'source' = $1", p.tableName)
+	if _, err := tx.Exec(ctx, deleteSQL, source); err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to delete source %s: %w", source, err))
+	}
+
+	if err := p.insertDocuments(ctx, tx, docs, vectors, createdAt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return vectorstore.NewAddFailedError("pgvector", fmt.Errorf("failed to commit transaction: %w", err))
+	}
+	return nil
+}
+
+func (p *PGVectorStore) validateVectors(vectors [][]float32) error {
 	for _, vec := range vectors {
 		if len(vec) != p.dimension {
 			return vectorstore.NewInvalidDimensionsError("pgvector", p.dimension, len(vec))
 		}
 	}
+	return nil
+}
+
+// insertDocuments inserts docs with vectors keyed by column, as in
+// AddDocumentsWithVectors, created at createdAt or, when nil, now
+func (p *PGVectorStore) insertDocuments(ctx context.Context, b batchSender, docs []vectorstore.Document, vectors map[string][][]float32, createdAt *time.Time) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	keys := []string{vectorstore.DefaultVectorColumn}
+	columns := []string{defaultColumn}
+	placeholders := []string{"$4::vector"}
+	for _, name := range p.vectorColumns {
+		if _, ok := vectors[name]; ok {
+			keys = append(keys, name)
+			columns = append(columns, name)
+			placeholders = append(placeholders, fmt.Sprintf("$%d::vector", len(placeholders)+4))
+		}
+	}
 
 	batch := &pgx.Batch{}
 	insertSQL := fmt.Sprintf(`
-        INSERT INTO %s (content, metadata, embedding)
-        VALUES ($1, $2, $3::vector)
-    `, p.tableName)
+        INSERT INTO %s (content, metadata, created_at, %s)
+        VALUES ($1, $2, COALESCE($3::timestamptz, CURRENT_TIMESTAMP), %s)
+    `, p.tableName, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
 
 	for i, doc := range docs {
-		vectorStr := formatVectorForPG(vectors[i])
-		batch.Queue(insertSQL, doc.PageContent, doc.Metadata, vectorStr)
+		args := []interface{}{doc.PageContent, doc.Metadata, createdAt}
+		for _, key := range keys {
+			args = append(args, formatVectorForPG(p.prepareVector(vectors[key][i])))
+		}
+		batch.Queue(insertSQL, args...)
 	}
 
-	results := p.pool.SendBatch(ctx, batch)
+	results := b.SendBatch(ctx, batch)
 	defer results.Close()
 
 	for i := 0; i < len(docs); i++ {
@@ -217,86 +474,293 @@ func (p *PGVectorStore) AddDocuments(ctx context.Context, docs []vectorstore.Doc
 }
 
 func (p *PGVectorStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	return p.similaritySearch(ctx, defaultColumn, VectorSpec{Dimension: p.dimension, Distance: p.distance}, vector, limit, filter, false)
+}
+
+// similaritySearch searches the vector column described by spec. Rows with no
+// vector in a named column are skipped. With returnVectors, each document
+// carries its vector in the column.
+func (p *PGVectorStore) similaritySearch(ctx context.Context, column string, spec VectorSpec, vector []float32, limit int, filter vectorstore.Filter, returnVectors bool) ([]vectorstore.Document, error) {
+	query, args, err := p.searchQuery(column, spec, vector, limit, filter, returnVectors)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var docs []vectorstore.Document
+	err = p.withRetry(ctx, retryConnErrors, func() error {
+		var err error
+		docs, err = p.search(ctx, query, args...)
+		return err
+	})
+	p.logSlowQuery("SimilaritySearch", time.Since(start), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.normalizeScores {
+		for i := range docs {
+			docs[i].Score = normalizedScore(spec.Distance, float64(docs[i].Score))
+		}
+	}
+
+	return docs, nil
+}
+
+// searchQuery validates a similarity search and returns its SQL and
+// arguments. The vectors of column are only selected with returnVectors.
+func (p *PGVectorStore) searchQuery(column string, spec VectorSpec, vector []float32, limit int, filter vectorstore.Filter, returnVectors bool) (string, []interface{}, error) {
 	// Validate vector dimension
-	if len(vector) != p.dimension {
-		return nil, vectorstore.NewInvalidDimensionsError("pgvector", p.dimension, len(vector))
+	if len(vector) != spec.Dimension {
+		return "", nil, vectorstore.NewInvalidDimensionsError("pgvector", spec.Dimension, len(vector))
 	}
 
 	// Validate filter
 	if err := p.validateFilter(filter); err != nil {
-		return nil, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+		return "", nil, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+	}
+	if err := validateTimeFilter(filter); err != nil {
+		return "", nil, vectorstore.NewInvalidFilterError("pgvector", err.Error())
 	}
 
-	operator, _ := p.getOperatorAndFunction()
-	vectorStr := formatVectorForPG(vector)
+	operator, _ := operatorAndOpClass(spec.Distance)
+	vectorStr := formatVectorForPG(p.prepareVector(vector))
 
 	// Build query with filters
 	whereClause, args := p.buildWhereClause(filter)
 	args = append([]interface{}{vectorStr, limit}, args...)
+	if column != defaultColumn {
+		if whereClause == "" {
+			whereClause = "WHERE " + column + " IS NOT NULL"
+		} else {
+			whereClause += " AND " + column + " IS NOT NULL"
+		}
+	}
 
-	scoreExpr := p.buildScoreExpression(operator)
+	scoreExpr := p.scoreExpression(column, spec.Distance, operator)
+	vectorExpr := "NULL::text"
+	if returnVectors {
+		vectorExpr = column + "::text"
+	}
 	query := fmt.Sprintf(`
         SELECT 
             content,
             metadata,
-            %s as similarity
+            %s as similarity,
+            created_at,
+            updated_at,
+            deleted_at,
+            %s as vector
         FROM %s
         %s
-        ORDER BY embedding %s $1::vector
+        ORDER BY %s %s $1::vector
         LIMIT $2
-    `, scoreExpr, p.tableName, whereClause, operator)
+    `, scoreExpr, vectorExpr, p.tableName, whereClause, column, operator)
+	return query, args, nil
+}
+
+// search runs a similarity query, bounding it with the configured statement timeout
+func (p *PGVectorStore) search(ctx context.Context, query string, args ...interface{}) ([]vectorstore.Document, error) {
+	if p.statementTimeout <= 0 {
+		return p.scanDocuments(ctx, p.pool, query, args...)
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, p.classifySearchError(err)
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := p.pool.Query(ctx, query, args...)
+	// SET does not accept bind parameters, the value is always an integer
+	_, err = tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", p.statementTimeout.Milliseconds()))
 	if err != nil {
-		return nil, vectorstore.NewSearchFailedError("pgvector", err)
+		return nil, p.classifySearchError(fmt.Errorf("failed to set statement timeout: %w", err))
+	}
+
+	docs, err := p.scanDocuments(ctx, tx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, p.classifySearchError(err)
+	}
+
+	return docs, nil
+}
+
+func (p *PGVectorStore) scanDocuments(ctx context.Context, q querier, query string, args ...interface{}) ([]vectorstore.Document, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, p.classifySearchError(err)
 	}
 	defer rows.Close()
 
 	var docs []vectorstore.Document
 	for rows.Next() {
-		var doc vectorstore.Document
-		err := rows.Scan(&doc.PageContent, &doc.Metadata, &doc.Score)
+		doc, err := scanDocument(rows)
 		if err != nil {
-			return nil, vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("failed to scan row: %w", err))
+			return nil, err
 		}
 		docs = append(docs, doc)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, vectorstore.NewSearchFailedError("pgvector", err)
+		return nil, p.classifySearchError(err)
 	}
 
 	return docs, nil
 }
 
-func (p *PGVectorStore) buildDeleteWhereClause(filter vectorstore.Filter) (string, []interface{}) {
-	if len(filter) == 0 {
-		return "", nil
+// scanDocument scans a row of a search query into a document. The last
+// column is the row's vector as text, or NULL when it wasn't requested.
+func scanDocument(rows pgx.Rows) (vectorstore.Document, error) {
+	var doc vectorstore.Document
+	var createdAt, updatedAt, deletedAt *time.Time
+	var vectorText *string
+	err := rows.Scan(&doc.PageContent, &doc.Metadata, &doc.Score, &createdAt, &updatedAt, &deletedAt, &vectorText)
+	if err != nil {
+		return vectorstore.Document{}, vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("failed to scan row: %w", err))
 	}
+	if vectorText != nil {
+		if doc.Vector, err = parseVectorFromPG(*vectorText); err != nil {
+			return vectorstore.Document{}, vectorstore.NewSearchFailedError("pgvector", fmt.Errorf("failed to parse vector: %w", err))
+		}
+	}
+	setTimestamps(&doc, createdAt, updatedAt, deletedAt)
+	return doc, nil
+}
 
-	conditions := make([]string, 0)
-	args := make([]interface{}, 0)
-	i := 1 // Start from 1 for delete operations
+// classifySearchError reports statement timeouts and expired contexts as timeout errors
+func (p *PGVectorStore) classifySearchError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled {
+		return vectorstore.NewTimeoutError("pgvector", "SimilaritySearch", err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return vectorstore.NewTimeoutError("pgvector", "SimilaritySearch", err)
+	}
+	return vectorstore.NewSearchFailedError("pgvector", err)
+}
 
-	for key, value := range filter {
-		args = append(args, value)
-		conditions = append(conditions, fmt.Sprintf("metadata->>'%s' = $%d", key, i))
-		i++
+// logSlowQuery reports queries that exceeded the slow query threshold
+func (p *PGVectorStore) logSlowQuery(op string, elapsed time.Duration, limit int) {
+	if p.slowQueryThreshold <= 0 || elapsed < p.slowQueryThreshold {
+		return
+	}
+	p.logger.Warn("pgvector: slow query",
+		slog.String("op", op),
+		slog.String("table", p.tableName),
+		slog.Duration("duration", elapsed),
+		slog.Duration("threshold", p.slowQueryThreshold),
+		slog.Int("limit", limit),
+	)
+}
+
+// buildDeleteWhereClause returns the WHERE clause of filter for Delete, which
+// removes soft-deleted documents too
+func (p *PGVectorStore) buildDeleteWhereClause(filter vectorstore.Filter) (string, []interface{}) {
+	conditions, args, _ := filterConditions(filter, 1) // Start from 1 for delete operations
+	if len(conditions) == 0 {
+		return "", nil
 	}
 
 	return "WHERE " + strings.Join(conditions, " AND "), args
 }
 
 func (p *PGVectorStore) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	_, err := p.DeleteCount(ctx, filter)
+	return err
+}
+
+// DeleteCount removes the documents matching filter and returns how many were removed
+func (p *PGVectorStore) DeleteCount(ctx context.Context, filter vectorstore.Filter) (int, error) {
+	if err := validateDeleteFilter(filter); err != nil {
+		return 0, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+	}
 	whereClause, args := p.buildDeleteWhereClause(filter)
 	query := fmt.Sprintf("DELETE FROM %s %s", p.tableName, whereClause)
 
-	_, err := p.pool.Exec(ctx, query, args...)
-	if err != nil {
+	var removed int
+	err := p.withRetry(ctx, retryConnErrors, func() error {
+		tag, err := p.pool.Exec(ctx, query, args...)
+		removed = int(tag.RowsAffected())
 		return err
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return removed, nil
+}
+
+// ListSources returns the distinct document sources in the table
+func (p *PGVectorStore) ListSources(ctx context.Context) ([]string, error) {
+	query := fmt.Sprintf(`
+        SELECT DISTINCT metadata->>'source'
+        FROM %s
+        WHERE metadata ? 'source' AND deleted_at IS NULL
+        ORDER BY 1`, p.tableName)
+
+	rows, err := p.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []string
+	for rows.Next() {
+		var source string
+		if err := rows.Scan(&source); err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, rows.Err()
+}
+
+// GetDocuments returns up to limit documents matching filter in row order,
+// leaving out soft-deleted documents unless the filter sets IncludeDeletedKey
+func (p *PGVectorStore) GetDocuments(ctx context.Context, filter vectorstore.Filter, limit int) ([]vectorstore.Document, error) {
+	if err := p.validateFilter(filter); err != nil {
+		return nil, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+	}
+	if err := validateTimeFilter(filter); err != nil {
+		return nil, vectorstore.NewInvalidFilterError("pgvector", err.Error())
+	}
+
+	// $1 is the limit, a NULL limit returns every match
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+	conditions, args, includeDeleted := filterConditions(filter, 2)
+	if !includeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	query := fmt.Sprintf(`
+        SELECT content, metadata, 0::real, created_at, updated_at, deleted_at, NULL::text
+        FROM %s
+        %s
+        ORDER BY id
+        LIMIT $1`, p.tableName, whereClause)
+	args = append([]interface{}{limitArg}, args...)
+
+	var docs []vectorstore.Document
+	err := p.withRetry(ctx, retryConnErrors, func() error {
+		var err error
+		docs, err = p.scanDocuments(ctx, p.pool, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
 }
 
 // Helper methods
@@ -314,38 +778,193 @@ func (p *PGVectorStore) validateFilter(filter vectorstore.Filter) error {
 			return fmt.Errorf("nil value for key %s", key)
 		}
 	}
-	return nil
+	return validateConditions(filter)
 }
 
+// buildWhereClause returns the WHERE clause of filter for searches, leaving
+// out soft-deleted documents unless the filter sets IncludeDeletedKey
 func (p *PGVectorStore) buildWhereClause(filter vectorstore.Filter) (string, []interface{}) {
-	if len(filter) == 0 {
-		return "", nil
-	}
-
-	conditions := make([]string, 0)
-	args := make([]interface{}, 0)
-	i := 3 // Starting from 3 because $1 and $2 are used for vector and limit
-
-	for key, value := range filter {
-		args = append(args, value)
-		conditions = append(conditions, fmt.Sprintf("metadata->>'%s' = $%d", key, i))
-		i++
+	// Starting from 3 because $1 and $2 are used for vector and limit
+	conditions, args, includeDeleted := filterConditions(filter, 3)
+	if !includeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
 	}
 
 	return "WHERE " + strings.Join(conditions, " AND "), args
 }
 
+// buildScoreExpression returns the SQL for a row's score. With
+// ScoreNormalization it is the raw distance, mapped by normalizedScore once read.
 func (p *PGVectorStore) buildScoreExpression(operator string) string {
-	switch p.distance {
+	return p.scoreExpression(defaultColumn, p.distance, operator)
+}
+
+// scoreExpression is buildScoreExpression for a vector column and its metric
+func (p *PGVectorStore) scoreExpression(column string, distance Distance, operator string) string {
+	if p.normalizeScores {
+		return fmt.Sprintf("%s %s $1::vector", column, operator)
+	}
+
+	switch distance {
 	case Cosine:
-		return fmt.Sprintf("1 - (embedding %s $1::vector)", operator)
+		return fmt.Sprintf("1 - (%s %s $1::vector)", column, operator)
 	case InnerProduct:
-		return fmt.Sprintf("(embedding %s $1::vector) * -1", operator)
+		return fmt.Sprintf("(%s %s $1::vector) * -1", column, operator)
 	case Euclidean:
-		return fmt.Sprintf("1 / (1 + (embedding %s $1::vector))", operator)
+		return fmt.Sprintf("1 / (1 + (%s %s $1::vector))", column, operator)
 	default:
-		return fmt.Sprintf("1 - (embedding %s $1::vector)", operator)
+		return fmt.Sprintf("1 - (%s %s $1::vector)", column, operator)
+	}
+}
+
+// normalizedScore maps a distance as returned by the metric's operator to a
+// 0..1 similarity. For unit-length vectors, such as with NormalizeVectors,
+// every metric gives the same pair of vectors the same score, (1 + cos θ)/2:
+//
+//   - Cosine: 1 - d/2, for the cosine distance d in 0..2
+//   - Euclidean: 1 - d²/4, since d² = 2 - 2cos θ for unit vectors
+//   - InnerProduct: (1 + ip)/2, where the <#> operator returns -ip
+//
+// Euclidean and inner product scores of vectors that aren't unit length are
+// clamped to 0..1; their ranking is unaffected.
+func normalizedScore(distance Distance, d float64) float32 {
+	var score float64
+	switch distance {
+	case Euclidean:
+		score = 1 - d*d/4
+	case InnerProduct:
+		score = (1 - d) / 2
+	default: // Cosine
+		score = 1 - d/2
+	}
+	return float32(math.Min(1, math.Max(0, score)))
+}
+
+// prepareVector returns the vector as it is stored or searched with
+func (p *PGVectorStore) prepareVector(vector []float32) []float32 {
+	if !p.normalize {
+		return vector
+	}
+	return normalizeL2(vector)
+}
+
+// normalizeL2 returns a copy of vector scaled to unit length. Zero vectors are
+// returned unchanged.
+func normalizeL2(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+
+	normalized := make([]float32, len(vector))
+	copy(normalized, vector)
+	if sum == 0 {
+		return normalized
+	}
+
+	norm := math.Sqrt(sum)
+	for i := range normalized {
+		normalized[i] = float32(float64(normalized[i]) / norm)
+	}
+	return normalized
+}
+
+// renormalizeBatchSize is how many rows RenormalizeVectors updates per transaction
+const renormalizeBatchSize = 500
+
+// RenormalizeVectors scales every stored vector to unit length, those of the
+// named columns of Options.Vectors too, migrating a table indexed without
+// NormalizeVectors so its scores match vectors added with it. It is safe to
+// run more than once and returns the number of vectors it updated.
+func (p *PGVectorStore) RenormalizeVectors(ctx context.Context) (int64, error) {
+	var updated int64
+	for _, column := range append([]string{defaultColumn}, p.vectorColumns...) {
+		count, err := p.renormalizeColumn(ctx, column)
+		updated += count
+		if err != nil {
+			return updated, p.renormalizeError(fmt.Errorf("column %s: %w", column, err))
+		}
+	}
+	return updated, nil
+}
+
+// renormalizeColumn scales the vectors of one column to unit length, in
+// batches of renormalizeBatchSize rows
+func (p *PGVectorStore) renormalizeColumn(ctx context.Context, column string) (int64, error) {
+	selectSQL := fmt.Sprintf(`
+        SELECT id, %[2]s::text
+        FROM %[1]s
+        WHERE id > $1 AND %[2]s IS NOT NULL
+        ORDER BY id
+        LIMIT $2`, p.tableName, column)
+	updateSQL := fmt.Sprintf("UPDATE %s SET %s = $2::vector WHERE id = $1", p.tableName, column)
+
+	var updated int64
+	lastID := 0
+	for {
+		rows, err := p.pool.Query(ctx, selectSQL, lastID, renormalizeBatchSize)
+		if err != nil {
+			return updated, err
+		}
+
+		batch := &pgx.Batch{}
+		count := 0
+		for rows.Next() {
+			var id int
+			var text string
+			if err := rows.Scan(&id, &text); err != nil {
+				rows.Close()
+				return updated, err
+			}
+			vector, err := parseVectorFromPG(text)
+			if err != nil {
+				rows.Close()
+				return updated, fmt.Errorf("row %d: %w", id, err)
+			}
+			batch.Queue(updateSQL, id, formatVectorForPG(normalizeL2(vector)))
+			lastID = id
+			count++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, err
+		}
+		if count == 0 {
+			return updated, nil
+		}
+
+		if err := p.pool.SendBatch(ctx, batch).Close(); err != nil {
+			return updated, err
+		}
+		updated += int64(count)
+	}
+}
+
+func (p *PGVectorStore) renormalizeError(err error) error {
+	return vectorstore.NewUpdateFailedError("pgvector", "RenormalizeVectors", err)
+}
+
+// parseVectorFromPG parses the text form of a vector, such as [1,2.5,3]
+func parseVectorFromPG(text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("invalid vector %q", text)
+	}
+	text = strings.TrimSpace(text[1 : len(text)-1])
+	if text == "" {
+		return []float32{}, nil
+	}
+
+	fields := strings.Split(text, ",")
+	vector := make([]float32, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector element %q: %w", field, err)
+		}
+		vector[i] = float32(v)
 	}
+	return vector, nil
 }
 
 // formatVectorForPG converts a float32 slice to a PostgreSQL vector format
@@ -371,6 +990,7 @@ func (p *PGVectorStore) DocumentExists(ctx context.Context, docs []document.Docu
             SELECT 1 FROM %s 
             WHERE metadata->>'source' = $1 
             AND metadata->>'last_modified' = $2
+            AND deleted_at IS NULL
         )
     `, p.tableName)
 
@@ -0,0 +1,619 @@
+//go:build integration
+
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/internal/testutil"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/Abraxas-365/kbservice/vectorstore/storetest"
+)
+
+func TestPGVectorStore_Integration(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+
+	for _, distance := range []Distance{Cosine, Euclidean, InnerProduct} {
+		t.Run(string(distance), func(t *testing.T) {
+			ctx := context.Background()
+			store, err := NewPGVectorStore(ctx, connString, Options{
+				TableName: fmt.Sprintf("docs_%s", distance),
+				Dimension: 3,
+				Distance:  distance,
+			})
+			if err != nil {
+				t.Fatalf("NewPGVectorStore() error = %v", err)
+			}
+			t.Cleanup(store.pool.Close)
+
+			if err := store.InitDB(ctx, true); err != nil {
+				t.Fatalf("InitDB() error = %v", err)
+			}
+			err = store.InitDB(ctx, false)
+			var vsErr *vectorstore.VectorStoreError
+			if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeDBExists {
+				t.Errorf("InitDB() on existing table error = %v, want %v", err, vectorstore.ErrCodeDBExists)
+			}
+
+			docs := []vectorstore.Document{
+				{PageContent: "alpha", Metadata: map[string]interface{}{"source": "a.txt", "last_modified": "2024-01-01T00:00:00Z"}},
+				{PageContent: "beta", Metadata: map[string]interface{}{"source": "b.txt", "last_modified": "2024-01-02T00:00:00Z"}},
+				{PageContent: "alpha-ish", Metadata: map[string]interface{}{"source": "a.txt", "last_modified": "2024-01-01T00:00:00Z"}},
+			}
+			vectors := [][]float32{{1, 0, 0}, {0, 1, 0}, {0.9, 0.1, 0}}
+			if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+				t.Fatalf("AddDocuments() error = %v", err)
+			}
+
+			results, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 2, nil)
+			if err != nil {
+				t.Fatalf("SimilaritySearch() error = %v", err)
+			}
+			assertPageContents(t, results, "alpha", "alpha-ish")
+			if results[0].Score < results[1].Score {
+				t.Errorf("scores = %v, %v, want descending", results[0].Score, results[1].Score)
+			}
+
+			filtered, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, vectorstore.Filter{"source": "b.txt"})
+			if err != nil {
+				t.Fatalf("SimilaritySearch() with filter error = %v", err)
+			}
+			assertPageContents(t, filtered, "beta")
+
+			exists, err := store.DocumentExists(ctx, []document.Document{docs[0].ToDocument(), {Metadata: map[string]interface{}{"source": "c.txt"}}})
+			if err != nil {
+				t.Fatalf("DocumentExists() error = %v", err)
+			}
+			if !exists[0] || exists[1] {
+				t.Errorf("DocumentExists() = %v, want [true false]", exists)
+			}
+
+			sources, err := store.ListSources(ctx)
+			if err != nil {
+				t.Fatalf("ListSources() error = %v", err)
+			}
+			if len(sources) != 2 || sources[0] != "a.txt" || sources[1] != "b.txt" {
+				t.Errorf("ListSources() = %v, want [a.txt b.txt]", sources)
+			}
+
+			if err := store.Delete(ctx, vectorstore.Filter{"source": "a.txt"}); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			remaining, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, nil)
+			if err != nil {
+				t.Fatalf("SimilaritySearch() after delete error = %v", err)
+			}
+			assertPageContents(t, remaining, "beta")
+		})
+	}
+}
+
+func assertPageContents(t *testing.T, docs []vectorstore.Document, want ...string) {
+	t.Helper()
+	if len(docs) != len(want) {
+		t.Fatalf("got %d documents, want %d (%v)", len(docs), len(want), want)
+	}
+	for i, doc := range docs {
+		if doc.PageContent != want[i] {
+			t.Errorf("document %d = %q, want %q", i, doc.PageContent, want[i])
+		}
+	}
+}
+
+func TestPGVectorStore_RenormalizeVectors(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+
+	docs := []vectorstore.Document{{PageContent: "alpha"}, {PageContent: "beta"}}
+	vectors := [][]float32{{3, 4, 0}, {0, 0.5, 0.5}}
+	query := []float32{2, 1, 0}
+
+	// The same corpus indexed with and without normalization
+	var scores [][]float32
+	for _, normalize := range []bool{false, true} {
+		table := fmt.Sprintf("docs_normalize_%t", normalize)
+		store, err := NewPGVectorStore(ctx, connString, Options{
+			TableName:        table,
+			Dimension:        3,
+			Distance:         InnerProduct,
+			NormalizeVectors: normalize,
+		})
+		if err != nil {
+			t.Fatalf("NewPGVectorStore() error = %v", err)
+		}
+		if err := store.InitDB(ctx, true); err != nil {
+			t.Fatalf("InitDB() error = %v", err)
+		}
+		if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		store.pool.Close()
+
+		// Reopen with normalization on and migrate
+		store, err = NewPGVectorStore(ctx, connString, Options{
+			TableName:        table,
+			Dimension:        3,
+			Distance:         InnerProduct,
+			NormalizeVectors: true,
+		})
+		if err != nil {
+			t.Fatalf("NewPGVectorStore() error = %v", err)
+		}
+		t.Cleanup(store.pool.Close)
+
+		updated, err := store.RenormalizeVectors(ctx)
+		if err != nil {
+			t.Fatalf("RenormalizeVectors() error = %v", err)
+		}
+		if updated != int64(len(docs)) {
+			t.Errorf("RenormalizeVectors() = %d, want %d", updated, len(docs))
+		}
+
+		results, err := store.SimilaritySearch(ctx, query, 2, nil)
+		if err != nil {
+			t.Fatalf("SimilaritySearch() error = %v", err)
+		}
+		assertPageContents(t, results, "alpha", "beta")
+		scores = append(scores, []float32{results[0].Score, results[1].Score})
+	}
+
+	for i := range scores[0] {
+		if diff := scores[0][i] - scores[1][i]; diff > 1e-5 || diff < -1e-5 {
+			t.Errorf("score %d = %v after migration, %v when indexed normalized", i, scores[0][i], scores[1][i])
+		}
+	}
+}
+
+func TestPGVectorStore_Migration(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store := newEmptyStore(t, connString, "docs_migration")
+
+	docs := []vectorstore.Document{
+		{PageContent: "alpha", Metadata: map[string]interface{}{"source": "a.txt"}},
+		{PageContent: "beta", Metadata: map[string]interface{}{"source": "b.txt"}},
+		{PageContent: "gamma", Metadata: map[string]interface{}{"source": "c.txt"}},
+	}
+	if err := store.AddDocuments(ctx, docs, [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	// Re-embed into 2 dimensions, a page of two documents at a time
+	if err := store.PrepareMigration(ctx, "", 2, false); err != nil {
+		t.Fatalf("PrepareMigration() error = %v", err)
+	}
+	newVectors := map[string][]float32{"alpha": {1, 0}, "beta": {0, 1}, "gamma": {0.7, 0.7}}
+	var listed []vectorstore.Document
+	cursor := ""
+	for {
+		page, next, err := store.ListDocuments(ctx, cursor, 2)
+		if err != nil {
+			t.Fatalf("ListDocuments() error = %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		var ids []string
+		var vectors [][]float32
+		for _, doc := range page {
+			listed = append(listed, doc.Document)
+			ids = append(ids, doc.ID)
+			vectors = append(vectors, newVectors[doc.PageContent])
+		}
+		if err := store.WriteVectors(ctx, "", ids, vectors); err != nil {
+			t.Fatalf("WriteVectors() error = %v", err)
+		}
+		cursor = next
+	}
+	assertPageContents(t, listed, "alpha", "beta", "gamma")
+
+	// Searches use the old vectors until the switch
+	if _, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 1, nil); err != nil {
+		t.Fatalf("SimilaritySearch() before the switch error = %v", err)
+	}
+	if err := store.SwitchMigration(ctx, "", 2); err != nil {
+		t.Fatalf("SwitchMigration() error = %v", err)
+	}
+	if store.Dimension() != 2 {
+		t.Errorf("Dimension() = %d after the switch, want 2", store.Dimension())
+	}
+	// The switched-in index was built on three rows; search exactly instead
+	if _, err := store.pool.Exec(ctx, "DROP INDEX docs_migration_embedding_idx"); err != nil {
+		t.Fatalf("failed to drop vector index: %v", err)
+	}
+
+	results, err := store.SimilaritySearch(ctx, []float32{0, 1}, 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	assertPageContents(t, results, "beta")
+	if results[0].Metadata["source"] != "b.txt" {
+		t.Errorf("metadata = %v, want it copied", results[0].Metadata)
+	}
+
+	// New rows are numbered after the copied ones
+	if err := store.AddDocuments(ctx, docs[:1], [][]float32{{1, 0}}); err != nil {
+		t.Fatalf("AddDocuments() after the switch error = %v", err)
+	}
+
+	// The old vectors are kept under the target's name
+	var old int
+	if err := store.pool.QueryRow(ctx, "SELECT COUNT(*) FROM docs_migration_migration").Scan(&old); err != nil || old != 3 {
+		t.Errorf("previous table rows = %d (%v), want 3", old, err)
+	}
+
+	// Resuming into it starts over instead of keeping the old vectors
+	if err := store.PrepareMigration(ctx, "", 2, true); err != nil {
+		t.Fatalf("PrepareMigration() resuming into the previous table error = %v", err)
+	}
+	if err := store.pool.QueryRow(ctx, "SELECT COUNT(*) FROM docs_migration_migration").Scan(&old); err != nil || old != 0 {
+		t.Errorf("rows after resuming = %d (%v), want the previous table dropped", old, err)
+	}
+}
+
+func TestPGVectorStore_Conformance(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+
+	tables := 0
+	storetest.RunConformance(t, func(t *testing.T) vectorstore.Store {
+		tables++
+		return newEmptyStore(t, connString, fmt.Sprintf("docs_conformance_%d", tables))
+	})
+}
+
+func TestPGVectorStore_ReplaceSourceConformance(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+
+	tables := 0
+	testutil.RunReplaceSourceConformance(t, func(t *testing.T) vectorstore.Store {
+		tables++
+		return newEmptyStore(t, connString, fmt.Sprintf("docs_replace_%d", tables))
+	})
+}
+
+// newEmptyStore creates a table of 3-dimensional vectors searched exactly
+func newEmptyStore(t *testing.T, connString, table string) *PGVectorStore {
+	t.Helper()
+	ctx := context.Background()
+	store, err := NewPGVectorStore(ctx, connString, Options{
+		TableName: table,
+		Dimension: 3,
+	})
+	if err != nil {
+		t.Fatalf("NewPGVectorStore() error = %v", err)
+	}
+	t.Cleanup(store.pool.Close)
+
+	if err := store.InitDB(ctx, true); err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+	// An ivfflat index built on an empty table can miss rows; search exactly instead
+	if _, err := store.pool.Exec(ctx, fmt.Sprintf("DROP INDEX %s_embedding_idx", store.tableName)); err != nil {
+		t.Fatalf("failed to drop vector index: %v", err)
+	}
+	return store
+}
+
+func TestPGVectorStore_VectorColumns(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store, err := NewPGVectorStore(ctx, connString, Options{
+		TableName: "docs_columns",
+		Dimension: 3,
+		Vectors:   map[string]VectorSpec{"code": {Dimension: 2, Distance: Euclidean}},
+	})
+	if err != nil {
+		t.Fatalf("NewPGVectorStore() error = %v", err)
+	}
+	t.Cleanup(store.pool.Close)
+	if err := store.InitDB(ctx, true); err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+	// Indexes built on an empty table can miss rows; search exactly instead
+	for _, index := range []string{"docs_columns_embedding_idx", "docs_columns_code_embedding_idx"} {
+		if _, err := store.pool.Exec(ctx, "DROP INDEX "+index); err != nil {
+			t.Fatalf("failed to drop index %s: %v", index, err)
+		}
+	}
+
+	docs := []vectorstore.Document{
+		{PageContent: "prose", Metadata: map[string]interface{}{"source": "a.md"}},
+		{PageContent: "code", Metadata: map[string]interface{}{"source": "a.go"}},
+	}
+	err = store.AddDocumentsWithVectors(ctx, docs, map[string][][]float32{
+		vectorstore.DefaultVectorColumn: {{1, 0, 0}, {0, 1, 0}},
+		"code":                          {{0, 1}, {1, 0}},
+	})
+	if err != nil {
+		t.Fatalf("AddDocumentsWithVectors() error = %v", err)
+	}
+	// A row without a code vector is only found by the default column
+	if err := store.AddDocuments(ctx, docs[:1], [][]float32{{0.9, 0.1, 0}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	results, err := store.SimilaritySearch(ctx, []float32{0, 1, 0}, 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	assertPageContents(t, results, "code")
+
+	results, err = store.SimilaritySearchWithOptions(ctx, []float32{0, 1}, 3, nil, vectorstore.SearchOptions{Column: "code"})
+	if err != nil {
+		t.Fatalf("SimilaritySearchWithOptions() error = %v", err)
+	}
+	assertPageContents(t, results, "prose", "code")
+
+	results, err = store.SimilaritySearchWithOptions(ctx, []float32{1, 0}, 3, vectorstore.Filter{"source": "a.go"}, vectorstore.SearchOptions{Column: "code"})
+	if err != nil {
+		t.Fatalf("filtered SimilaritySearchWithOptions() error = %v", err)
+	}
+	assertPageContents(t, results, "code")
+
+	// Vectors come back only when requested, from the searched column
+	if results[0].Vector != nil {
+		t.Errorf("Vector = %v without ReturnVectors, want nil", results[0].Vector)
+	}
+	results, err = store.SimilaritySearchWithOptions(ctx, []float32{0, 1, 0}, 3, nil, vectorstore.SearchOptions{ReturnVectors: true})
+	if err != nil {
+		t.Fatalf("SimilaritySearchWithOptions() with vectors error = %v", err)
+	}
+	for _, doc := range results {
+		if len(doc.Vector) != 3 {
+			t.Errorf("%s Vector = %v, want 3 dimensions", doc.PageContent, doc.Vector)
+		}
+	}
+	results, err = store.SimilaritySearchWithOptions(ctx, []float32{1, 0}, 1, nil, vectorstore.SearchOptions{Column: "code", ReturnVectors: true})
+	if err != nil {
+		t.Fatalf("SimilaritySearchWithOptions() of code vectors error = %v", err)
+	}
+	if len(results) != 1 || len(results[0].Vector) != 2 || results[0].Vector[0] != 1 {
+		t.Errorf("code search = %+v, want the code vector [1 0]", results)
+	}
+
+	err = store.ReplaceSourceWithVectors(ctx, "a.go", docs[1:], map[string][][]float32{
+		vectorstore.DefaultVectorColumn: {{0, 0, 1}},
+		"code":                          {{0.6, 0.8}},
+	})
+	if err != nil {
+		t.Fatalf("ReplaceSourceWithVectors() error = %v", err)
+	}
+	results, err = store.SimilaritySearch(ctx, []float32{0, 0, 1}, 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() after replace error = %v", err)
+	}
+	assertPageContents(t, results, "code")
+}
+
+func TestPGVectorStore_UpgradesExistingTable(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store, err := NewPGVectorStore(ctx, connString, Options{TableName: "docs_upgrade", Dimension: 3})
+	if err != nil {
+		t.Fatalf("NewPGVectorStore() error = %v", err)
+	}
+	t.Cleanup(store.pool.Close)
+
+	// A table as created before updated_at and deleted_at were added
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, sql := range []string{
+		`CREATE TABLE docs_upgrade (
+            id SERIAL PRIMARY KEY,
+            content TEXT NOT NULL,
+            metadata JSONB,
+            embedding vector(3),
+            created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+        )`,
+		`INSERT INTO docs_upgrade (content, metadata, embedding, created_at)
+            VALUES ('old', '{"source": "old.txt"}', '[1,0,0]', '2024-01-01T00:00:00Z')`,
+	} {
+		if _, err := store.pool.Exec(ctx, sql); err != nil {
+			t.Fatalf("failed to create the old table: %v", err)
+		}
+	}
+
+	err = store.InitDB(ctx, false)
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeDBExists {
+		t.Fatalf("InitDB() error = %v, want %v", err, vectorstore.ErrCodeDBExists)
+	}
+
+	results, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	assertPageContents(t, results, "old")
+	for _, key := range []string{CreatedAtMetadataKey, UpdatedAtMetadataKey} {
+		if at, ok := results[0].Metadata[key].(time.Time); !ok || !at.Equal(created) {
+			t.Errorf("metadata[%s] = %v, want the row's creation time", key, results[0].Metadata[key])
+		}
+	}
+	if err := store.AddDocuments(ctx, []vectorstore.Document{{PageContent: "new"}}, [][]float32{{0, 1, 0}}); err != nil {
+		t.Fatalf("AddDocuments() after the upgrade error = %v", err)
+	}
+}
+
+func TestPGVectorStore_SoftDelete(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store := newEmptyStore(t, connString, "docs_soft_delete")
+
+	docs := []vectorstore.Document{
+		{PageContent: "alpha", Metadata: map[string]interface{}{"source": "a.txt", "last_modified": "1"}},
+		{PageContent: "beta", Metadata: map[string]interface{}{"source": "b.txt", "last_modified": "1"}},
+	}
+	if err := store.AddDocuments(ctx, docs, [][]float32{{1, 0, 0}, {0, 1, 0}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	deleted, err := store.DeleteWithOptions(ctx, vectorstore.Filter{"source": "a.txt"}, WithSoftDelete())
+	if err != nil || deleted != 1 {
+		t.Fatalf("DeleteWithOptions() = %d, %v, want 1", deleted, err)
+	}
+
+	results, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	assertPageContents(t, results, "beta")
+	if sources, err := store.ListSources(ctx); err != nil || len(sources) != 1 {
+		t.Errorf("ListSources() = %v, %v, want only b.txt", sources, err)
+	}
+	if exists, err := store.DocumentExists(ctx, []document.Document{docs[0].ToDocument()}); err != nil || exists[0] {
+		t.Errorf("DocumentExists() = %v, %v, want the soft-deleted document missing", exists, err)
+	}
+
+	results, err = store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, vectorstore.Filter{IncludeDeletedKey: true})
+	if err != nil {
+		t.Fatalf("SimilaritySearch() including deleted error = %v", err)
+	}
+	assertPageContents(t, results, "alpha", "beta")
+	if _, ok := results[0].Metadata[DeletedAtMetadataKey].(time.Time); !ok {
+		t.Errorf("metadata = %v, want the deletion time", results[0].Metadata)
+	}
+
+	// Time filters see the rows' timestamps
+	future := vectorstore.Filter{CreatedAfterKey: time.Now().Add(time.Hour)}
+	if results, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, future); err != nil || len(results) != 0 {
+		t.Errorf("SimilaritySearch() of future documents = %v, %v, want none", results, err)
+	}
+
+	if purged, err := store.PurgeDeleted(ctx, time.Hour); err != nil || purged != 0 {
+		t.Errorf("PurgeDeleted(1h) = %d, %v, want 0", purged, err)
+	}
+	if purged, err := store.PurgeDeleted(ctx, 0); err != nil || purged != 1 {
+		t.Errorf("PurgeDeleted(0) = %d, %v, want 1", purged, err)
+	}
+	results, err = store.SimilaritySearch(ctx, []float32{1, 0, 0}, 10, vectorstore.Filter{IncludeDeletedKey: true})
+	if err != nil {
+		t.Fatalf("SimilaritySearch() after purge error = %v", err)
+	}
+	assertPageContents(t, results, "beta")
+}
+
+func TestPGVectorStore_ReplaceSourceKeepsCreationTime(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store := newEmptyStore(t, connString, "docs_timestamps")
+
+	doc := []vectorstore.Document{{PageContent: "v1", Metadata: map[string]interface{}{"source": "a.txt", "created_at": "2020-01-01"}}}
+	if err := store.AddDocuments(ctx, doc, [][]float32{{1, 0, 0}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+	first, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	doc[0].PageContent = "v2"
+	if err := store.ReplaceSource(ctx, "a.txt", doc, [][]float32{{1, 0, 0}}); err != nil {
+		t.Fatalf("ReplaceSource() error = %v", err)
+	}
+	second, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	created := first[0].Metadata[CreatedAtMetadataKey].(time.Time)
+	if got := second[0].Metadata[CreatedAtMetadataKey].(time.Time); !got.Equal(created) {
+		t.Errorf("created_at = %v after replacing, want %v kept", got, created)
+	}
+	if updated := second[0].Metadata[UpdatedAtMetadataKey].(time.Time); !updated.After(created) {
+		t.Errorf("updated_at = %v, want it after %v", updated, created)
+	}
+	if second[0].Metadata["created_at"] != "2020-01-01" {
+		t.Errorf("metadata = %v, want the indexed created_at kept", second[0].Metadata)
+	}
+}
+
+func TestPGVectorStore_GetDocuments(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	ctx := context.Background()
+	store := newEmptyStore(t, connString, "docs_get")
+
+	docs := []vectorstore.Document{
+		{PageContent: "first", Metadata: map[string]interface{}{"source": "a.txt", "chunk_index": 0}},
+		{PageContent: "second", Metadata: map[string]interface{}{"source": "a.txt", "chunk_index": 1}},
+		{PageContent: "other", Metadata: map[string]interface{}{"source": "b.txt", "chunk_index": 0}},
+		{PageContent: "unnumbered", Metadata: map[string]interface{}{"source": "c.txt", "chunk_index": "n/a"}},
+	}
+	if err := store.AddDocuments(ctx, docs, [][]float32{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, 1, 0}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	got, err := store.GetDocuments(ctx, vectorstore.Filter{"source": "a.txt"}, 0)
+	if err != nil {
+		t.Fatalf("GetDocuments() error = %v", err)
+	}
+	assertPageContents(t, got, "first", "second")
+
+	got, err = store.GetDocuments(ctx, vectorstore.Filter{"source": "a.txt", "chunk_index": "1"}, 1)
+	if err != nil {
+		t.Fatalf("GetDocuments() by chunk index error = %v", err)
+	}
+	assertPageContents(t, got, "second")
+
+	filter := vectorstore.NewFilter().In("source", []string{"a.txt", "b.txt"}).Gte("chunk_index", 1).Build()
+	got, err = store.GetDocuments(ctx, filter, 0)
+	if err != nil {
+		t.Fatalf("GetDocuments() with conditions error = %v", err)
+	}
+	assertPageContents(t, got, "second")
+
+	got, err = store.GetDocuments(ctx, vectorstore.NewFilter().Gte("chunk_index", 1).Build(), 0)
+	if err != nil {
+		t.Fatalf("GetDocuments() over a value that isn't a number error = %v", err)
+	}
+	assertPageContents(t, got, "second")
+
+	if _, err := store.DeleteWithOptions(ctx, vectorstore.Filter{"source": "b.txt"}, WithSoftDelete()); err != nil {
+		t.Fatalf("DeleteWithOptions() error = %v", err)
+	}
+	if got, err := store.GetDocuments(ctx, vectorstore.Filter{"source": "b.txt"}, 0); err != nil || len(got) != 0 {
+		t.Errorf("GetDocuments() of soft-deleted documents = %v, %v, want none", got, err)
+	}
+}
+
+func TestPGVectorStore_SimilaritySearchStream(t *testing.T) {
+	connString := testutil.StartPGVector(t)
+	store := newEmptyStore(t, connString, "docs_stream")
+
+	var docs []vectorstore.Document
+	var vectors [][]float32
+	for i := 0; i < 50; i++ {
+		docs = append(docs, vectorstore.Document{PageContent: strconv.Itoa(i), Metadata: map[string]interface{}{"source": "a.txt"}})
+		vectors = append(vectors, []float32{1, float32(i) / 50, 0})
+	}
+	if err := store.AddDocuments(context.Background(), docs, vectors); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	docChan, errChan := store.SimilaritySearchStream(context.Background(), []float32{1, 0, 0}, 100, nil)
+	count := 0
+	for doc := range docChan {
+		if doc.PageContent != strconv.Itoa(count) {
+			t.Errorf("document %d = %q, want the results best first", count, doc.PageContent)
+		}
+		count++
+	}
+	if err := <-errChan; err != nil || count != 50 {
+		t.Errorf("SimilaritySearchStream() = %d documents, %v, want all 50", count, err)
+	}
+
+	// Canceling stops the scan
+	ctx, cancel := context.WithCancel(context.Background())
+	docChan, errChan = store.SimilaritySearchStream(ctx, []float32{1, 0, 0}, 100, nil)
+	<-docChan
+	cancel()
+	for range docChan {
+	}
+	if err := <-errChan; !errors.Is(err, context.Canceled) {
+		t.Errorf("SimilaritySearchStream() after cancel error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,340 @@
+package pgvectore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// testConnString returns the database used by integration tests, skipping when unset
+func testConnString(t *testing.T) string {
+	t.Helper()
+	connString := os.Getenv("PGVECTOR_TEST_DATABASE_URL")
+	if connString == "" {
+		t.Skip("PGVECTOR_TEST_DATABASE_URL not set")
+	}
+	return connString
+}
+
+func TestPGVectorStore_Capabilities(t *testing.T) {
+	want := vectorstore.CapabilitySet{
+		ReplaceSource: true, ListSources: true, DeleteCount: true, Dimension: true, ListDocuments: true, Migrate: true,
+		VectorColumns: true, GetDocuments: true, SearchStream: true, Conditions: true,
+	}
+	if got := vectorstore.Capabilities(&PGVectorStore{}); got != want {
+		t.Errorf("Capabilities() = %+v, want %+v", got, want)
+	}
+}
+
+func TestClassifySearchError(t *testing.T) {
+	store := &PGVectorStore{}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode vectorstore.ErrorCode
+	}{
+		{
+			name:     "Statement timeout",
+			err:      &pgconn.PgError{Code: pgQueryCanceled, Message: "canceling statement due to statement timeout"},
+			wantCode: vectorstore.ErrCodeTimeout,
+		},
+		{
+			name:     "Context deadline",
+			err:      fmt.Errorf("query: %w", context.DeadlineExceeded),
+			wantCode: vectorstore.ErrCodeTimeout,
+		},
+		{
+			name:     "Other database error",
+			err:      &pgconn.PgError{Code: "42P01", Message: "relation does not exist"},
+			wantCode: vectorstore.ErrCodeSearchFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.classifySearchError(tt.err)
+			var vsErr *vectorstore.VectorStoreError
+			if !errors.As(err, &vsErr) {
+				t.Fatalf("classifySearchError() = %T, want *vectorstore.VectorStoreError", err)
+			}
+			if vsErr.Code != tt.wantCode {
+				t.Errorf("classifySearchError() code = %v, want %v", vsErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPGVectorStore_StatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewPGVectorStore(ctx, testConnString(t), Options{
+		TableName:        "pgvector_timeout_test",
+		Dimension:        3,
+		StatementTimeout: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewPGVectorStore() error = %v", err)
+	}
+	defer store.pool.Close()
+
+	_, err = store.search(ctx, "SELECT ''::text, '{}'::jsonb, 0::real FROM pg_sleep(1)")
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) {
+		t.Fatalf("search() error = %v, want *vectorstore.VectorStoreError", err)
+	}
+	if vsErr.Code != vectorstore.ErrCodeTimeout {
+		t.Errorf("search() error code = %v, want %v", vsErr.Code, vectorstore.ErrCodeTimeout)
+	}
+}
+
+func TestNormalizeL2(t *testing.T) {
+	vector := []float32{3, 4}
+	got := normalizeL2(vector)
+	if math.Abs(float64(got[0])-0.6) > 1e-6 || math.Abs(float64(got[1])-0.8) > 1e-6 {
+		t.Errorf("normalizeL2() = %v, want [0.6 0.8]", got)
+	}
+	if vector[0] != 3 {
+		t.Errorf("normalizeL2() modified its input: %v", vector)
+	}
+	if zero := normalizeL2([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("normalizeL2() of zero vector = %v", zero)
+	}
+}
+
+func TestPrepareVector(t *testing.T) {
+	vector := []float32{0, 2}
+	if got := (&PGVectorStore{}).prepareVector(vector); got[1] != 2 {
+		t.Errorf("prepareVector() without normalization = %v, want %v", got, vector)
+	}
+	if got := (&PGVectorStore{normalize: true}).prepareVector(vector); got[1] != 1 {
+		t.Errorf("prepareVector() with normalization = %v, want [0 1]", got)
+	}
+}
+
+func TestParseVectorFromPG(t *testing.T) {
+	vector := []float32{0.25, -1.5, 3}
+	got, err := parseVectorFromPG(formatVectorForPG(vector))
+	if err != nil {
+		t.Fatalf("parseVectorFromPG() error = %v", err)
+	}
+	if len(got) != len(vector) {
+		t.Fatalf("parseVectorFromPG() = %v, want %v", got, vector)
+	}
+	for i := range vector {
+		if got[i] != vector[i] {
+			t.Errorf("parseVectorFromPG()[%d] = %v, want %v", i, got[i], vector[i])
+		}
+	}
+
+	for _, text := range []string{"1,2", "[1,x]"} {
+		if _, err := parseVectorFromPG(text); err == nil {
+			t.Errorf("parseVectorFromPG(%q) error = nil", text)
+		}
+	}
+}
+
+// rawDistance computes what pgvector's operator for the metric returns
+func rawDistance(distance Distance, a, b []float32) float64 {
+	var dot, normA, normB, sq float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+		diff := float64(a[i]) - float64(b[i])
+		sq += diff * diff
+	}
+	switch distance {
+	case Euclidean:
+		return math.Sqrt(sq)
+	case InnerProduct:
+		return -dot
+	default:
+		return 1 - dot/math.Sqrt(normA*normB)
+	}
+}
+
+func TestNormalizedScore_ThresholdConsistentAcrossMetrics(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomVector := func() []float32 {
+		vector := make([]float32, 16)
+		for i := range vector {
+			vector[i] = float32(rng.NormFloat64())
+		}
+		return normalizeL2(vector)
+	}
+
+	query := randomVector()
+	docs := make([][]float32, 200)
+	for i := range docs {
+		docs[i] = randomVector()
+		// Pull half of the documents towards the query so scores spread out
+		if i%2 == 0 {
+			for j := range docs[i] {
+				docs[i][j] += query[j]
+			}
+			docs[i] = normalizeL2(docs[i])
+		}
+	}
+
+	for _, threshold := range []float32{0.5, 0.6, 0.75, 0.9} {
+		var want []int
+		for _, distance := range []Distance{Cosine, Euclidean, InnerProduct} {
+			var kept []int
+			for i, doc := range docs {
+				score := normalizedScore(distance, rawDistance(distance, query, doc))
+				if score < 0 || score > 1 {
+					t.Fatalf("%s score = %v, want within 0..1", distance, score)
+				}
+				if score >= threshold+1e-4 {
+					kept = append(kept, i)
+				}
+			}
+			if want == nil {
+				want = kept
+				continue
+			}
+			if !reflect.DeepEqual(kept, want) {
+				t.Errorf("threshold %v keeps %d documents with %s, %d with cosine", threshold, len(kept), distance, len(want))
+			}
+		}
+	}
+}
+
+func TestNormalizedScore_ClampsNonUnitVectors(t *testing.T) {
+	a, b := []float32{3, 0}, []float32{-4, 0}
+	for _, distance := range []Distance{Cosine, Euclidean, InnerProduct} {
+		if score := normalizedScore(distance, rawDistance(distance, a, b)); score != 0 {
+			t.Errorf("%s score of opposite vectors = %v, want 0", distance, score)
+		}
+		if score := normalizedScore(distance, rawDistance(distance, a, a)); score != 1 {
+			t.Errorf("%s score of identical vectors = %v, want 1", distance, score)
+		}
+	}
+}
+
+func TestBuildScoreExpression(t *testing.T) {
+	store := &PGVectorStore{distance: Euclidean}
+	if got := store.buildScoreExpression("<->"); got != "1 / (1 + (embedding <-> $1::vector))" {
+		t.Errorf("buildScoreExpression() = %q", got)
+	}
+	store.normalizeScores = true
+	if got := store.buildScoreExpression("<->"); got != "embedding <-> $1::vector" {
+		t.Errorf("buildScoreExpression() with ScoreNormalization = %q", got)
+	}
+}
+
+func TestBuildWhereClause(t *testing.T) {
+	store := &PGVectorStore{}
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filter   vectorstore.Filter
+		want     string
+		wantArgs []interface{}
+	}{
+		{name: "No filter", want: "WHERE deleted_at IS NULL"},
+		{
+			name:     "Metadata and time",
+			filter:   vectorstore.Filter{"source": "a.txt", CreatedAfterKey: since},
+			want:     "WHERE created_at >= $3 AND metadata->>'source' = $4 AND deleted_at IS NULL",
+			wantArgs: []interface{}{since, "a.txt"},
+		},
+		{
+			name: "Conditions",
+			filter: vectorstore.NewFilter().
+				Eq("tag", "x").
+				In("type", []interface{}{"guide", 2}).
+				Gte("date", since).
+				Lt("views", 100).
+				Ne("lang", "en").
+				Build(),
+			want: "WHERE (CASE WHEN jsonb_typeof(metadata->'date') = 'string' AND metadata->>'date' ~ '" + timestampPattern + "' " +
+				"THEN (metadata->>'date')::timestamptz END) >= $3 AND metadata->>'lang' IS DISTINCT FROM $4 AND " +
+				"metadata->>'tag' = $5 AND metadata->>'type' = ANY($6) AND " +
+				"(CASE WHEN jsonb_typeof(metadata->'views') = 'number' THEN (metadata->>'views')::numeric END) < $7 AND deleted_at IS NULL",
+			wantArgs: []interface{}{since, "en", "x", []string{"guide", "2"}, 100},
+		},
+		{
+			name:     "Including deleted",
+			filter:   vectorstore.Filter{"source": "a.txt", IncludeDeletedKey: true},
+			want:     "WHERE metadata->>'source' = $3",
+			wantArgs: []interface{}{"a.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := store.buildWhereClause(tt.filter)
+			if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("buildWhereClause() = %q, %v, want %q, %v", got, args, tt.want, tt.wantArgs)
+			}
+		})
+	}
+
+	// Delete removes soft-deleted documents too
+	got, args := store.buildDeleteWhereClause(vectorstore.Filter{UpdatedAfterKey: since, IncludeDeletedKey: true})
+	if got != "WHERE updated_at >= $1" || !reflect.DeepEqual(args, []interface{}{since}) {
+		t.Errorf("buildDeleteWhereClause() = %q, %v", got, args)
+	}
+}
+
+func TestValidateFilter_Conditions(t *testing.T) {
+	store := &PGVectorStore{}
+	valid := vectorstore.NewFilter().In("type", []string{"a"}).Gte("views", 1).Ne("lang", "en").Build()
+	if err := store.validateFilter(valid); err != nil {
+		t.Errorf("validateFilter() error = %v", err)
+	}
+
+	for name, filter := range map[string]vectorstore.Filter{
+		"Unknown operator": {"views": vectorstore.Condition{"$like": "a%"}},
+		"In without slice": {"type": vectorstore.Condition{vectorstore.OpIn: "a"}},
+		"Nil operand":      {"views": vectorstore.Condition{vectorstore.OpGt: nil}},
+		"Empty condition":  {"views": vectorstore.Condition{}},
+	} {
+		if err := store.validateFilter(filter); err == nil {
+			t.Errorf("validateFilter() accepted %s", name)
+		}
+	}
+}
+
+func TestValidateDeleteFilter(t *testing.T) {
+	for name, filter := range map[string]vectorstore.Filter{
+		"Empty":      {},
+		"Metadata":   {"source": "a.txt", IncludeDeletedKey: true},
+		"Time":       {CreatedBeforeKey: time.Now()},
+		"Conditions": vectorstore.NewFilter().Gte("views", 1).Build(),
+	} {
+		if err := validateDeleteFilter(filter); err != nil {
+			t.Errorf("validateDeleteFilter() rejected %s: %v", name, err)
+		}
+	}
+
+	for name, filter := range map[string]vectorstore.Filter{
+		"Only IncludeDeletedKey": {IncludeDeletedKey: true},
+		"String time":            {CreatedAfterKey: "2024-06-01"},
+		"Unknown operator":       {"views": vectorstore.Condition{"$like": "a%"}},
+	} {
+		if err := validateDeleteFilter(filter); err == nil {
+			t.Errorf("validateDeleteFilter() accepted %s", name)
+		}
+	}
+}
+
+func TestValidateTimeFilter(t *testing.T) {
+	if err := validateTimeFilter(vectorstore.Filter{CreatedBeforeKey: time.Now(), "source": "a.txt"}); err != nil {
+		t.Errorf("validateTimeFilter() error = %v", err)
+	}
+	if err := validateTimeFilter(vectorstore.Filter{CreatedAfterKey: "2024-06-01"}); err == nil {
+		t.Error("validateTimeFilter() accepted a string time")
+	}
+}
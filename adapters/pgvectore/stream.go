@@ -0,0 +1,103 @@
+package pgvectore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// SimilaritySearchStream is SimilaritySearch sending each document as its row
+// is scanned, so large limits needn't be held in memory. Partial results
+// can't be taken back, so the query isn't retried on connection errors.
+// Canceling ctx stops the scan and closes the query.
+func (p *PGVectorStore) SimilaritySearchStream(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) (<-chan vectorstore.Document, <-chan error) {
+	docChan := make(chan vectorstore.Document)
+	errChan := make(chan error, 1) // buffered channel for error
+
+	go func() {
+		defer close(docChan)
+		defer close(errChan)
+
+		spec := VectorSpec{Dimension: p.dimension, Distance: p.distance}
+		query, args, err := p.searchQuery(defaultColumn, spec, vector, limit, filter, false)
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		start := time.Now()
+		err = p.streamSearch(ctx, query, args, func(doc vectorstore.Document) error {
+			if p.normalizeScores {
+				doc.Score = normalizedScore(spec.Distance, float64(doc.Score))
+			}
+			select {
+			case docChan <- doc:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		p.logSlowQuery("SimilaritySearchStream", time.Since(start), limit)
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// streamSearch runs a similarity query, calling fn with each document as it
+// is scanned until fn fails. Like search, it bounds the query with the
+// configured statement timeout.
+func (p *PGVectorStore) streamSearch(ctx context.Context, query string, args []interface{}, fn func(vectorstore.Document) error) error {
+	if p.statementTimeout <= 0 {
+		return p.streamRows(ctx, p.pool, query, args, fn)
+	}
+
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return p.classifySearchError(err)
+	}
+	defer tx.Rollback(ctx)
+
+	// SET does not accept bind parameters, the value is always an integer
+	_, err = tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", p.statementTimeout.Milliseconds()))
+	if err != nil {
+		return p.classifySearchError(fmt.Errorf("failed to set statement timeout: %w", err))
+	}
+
+	if err := p.streamRows(ctx, tx, query, args, fn); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return p.classifySearchError(err)
+	}
+	return nil
+}
+
+// streamRows calls fn with the document of each row of query, closing the
+// rows as soon as fn fails
+func (p *PGVectorStore) streamRows(ctx context.Context, q querier, query string, args []interface{}, fn func(vectorstore.Document) error) error {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return p.classifySearchError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return p.classifySearchError(err)
+	}
+	return nil
+}
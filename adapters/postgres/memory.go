@@ -15,14 +15,31 @@ import (
 )
 
 type PostgresRepository struct {
-	db *sql.DB
+	db             *sql.DB
+	excludeExpired bool
 }
 
-func NewPostgresRepository(db *sql.DB) (*PostgresRepository, error) {
+// RepositoryOption configures a PostgresRepository
+type RepositoryOption func(*PostgresRepository)
+
+// WithExcludeExpired makes reads treat conversations past their expiry as
+// deleted until PurgeExpired removes them: GetConversation and
+// ListConversations skip them and message reads return none of theirs
+func WithExcludeExpired() RepositoryOption {
+	return func(r *PostgresRepository) {
+		r.excludeExpired = true
+	}
+}
+
+func NewPostgresRepository(db *sql.DB, opts ...RepositoryOption) (*PostgresRepository, error) {
 	if db == nil {
 		return nil, errors.New("database connection is required")
 	}
-	return &PostgresRepository{db: db}, nil
+	r := &PostgresRepository{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
 // Required database schema
@@ -31,9 +48,13 @@ CREATE TABLE IF NOT EXISTS conversations (
     id TEXT PRIMARY KEY,
     metadata JSONB,
     created_at TIMESTAMP WITH TIME ZONE NOT NULL,
-    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE
 );
 
+-- Added after the first release; a no-op for tables created above
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+
 CREATE TABLE IF NOT EXISTS messages (
     id SERIAL PRIMARY KEY,
     conversation_id TEXT REFERENCES conversations(id) ON DELETE CASCADE,
@@ -52,7 +73,9 @@ CREATE TABLE IF NOT EXISTS messages (
 CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
 CREATE INDEX IF NOT EXISTS idx_messages_role ON messages(role);
 CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_order ON messages(conversation_id, created_at, id);
 CREATE INDEX IF NOT EXISTS idx_conversations_created_at ON conversations(created_at);
+CREATE INDEX IF NOT EXISTS idx_conversations_expires_at ON conversations(expires_at) WHERE expires_at IS NOT NULL;
 `
 
 func (r *PostgresRepository) InitSchema(ctx context.Context) error {
@@ -67,10 +90,10 @@ func (r *PostgresRepository) CreateConversation(ctx context.Context, conv chathi
 	}
 
 	query := `
-		INSERT INTO conversations (id, metadata, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO conversations (id, metadata, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err = r.db.ExecContext(ctx, query, conv.ID, metadata, conv.CreatedAt, conv.UpdatedAt)
+	_, err = r.db.ExecContext(ctx, query, conv.ID, metadata, conv.CreatedAt, conv.UpdatedAt, conv.ExpiresAt)
 	return err
 }
 
@@ -95,7 +118,7 @@ func (r *PostgresRepository) AddMessage(ctx context.Context, conversationID stri
 		message.Content,
 		message.Name,
 		functionCall,
-		time.Now(),
+		messageTime(message, time.Now()),
 		metadata,
 	)
 
@@ -109,12 +132,70 @@ func (r *PostgresRepository) AddMessage(ctx context.Context, conversationID stri
 	return err
 }
 
+// AddMessageAutoCreate inserts conv if its ID is unknown and appends message in one transaction
+func (r *PostgresRepository) AddMessageAutoCreate(ctx context.Context, conv chathistory.Conversation, message llm.Message) error {
+	convMetadata, err := json.Marshal(conv.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	functionCall, err := json.Marshal(message.FuncCall)
+	if err != nil {
+		return fmt.Errorf("failed to marshal function call: %w", err)
+	}
+
+	metadata, err := json.Marshal(message.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	convQuery := `
+		INSERT INTO conversations (id, metadata, created_at, updated_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING
+	`
+	_, err = tx.ExecContext(ctx, convQuery, conv.ID, convMetadata, conv.CreatedAt, conv.UpdatedAt, conv.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	query := `
+		INSERT INTO messages (conversation_id, role, content, name, function_call, created_at, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.ExecContext(ctx, query,
+		conv.ID,
+		message.Role,
+		message.Content,
+		message.Name,
+		functionCall,
+		messageTime(message, time.Now()),
+		metadata,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	updateQuery := `UPDATE conversations SET updated_at = NOW() WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, updateQuery, conv.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (r *PostgresRepository) GetMessages(ctx context.Context, conversationID string, limit int) ([]llm.Message, error) {
 	query := `
 		SELECT role, content, name, function_call, created_at, metadata
 		FROM messages
-		WHERE conversation_id = $1
-		ORDER BY created_at DESC
+		WHERE conversation_id = $1 AND ` + r.liveMessages() + `
+		ORDER BY created_at DESC, id DESC
 		LIMIT $2
 	`
 	rows, err := r.db.QueryContext(ctx, query, conversationID, limit)
@@ -127,14 +208,13 @@ func (r *PostgresRepository) GetMessages(ctx context.Context, conversationID str
 	for rows.Next() {
 		var msg llm.Message
 		var functionCallJSON, metadataJSON []byte
-		var createdAt time.Time // Add this variable
 
 		err := rows.Scan(
 			&msg.Role,
 			&msg.Content,
 			&msg.Name,
 			&functionCallJSON,
-			&createdAt, // Add created_at
+			&msg.CreatedAt,
 			&metadataJSON,
 		)
 		if err != nil {
@@ -165,8 +245,103 @@ func (r *PostgresRepository) GetMessages(ctx context.Context, conversationID str
 	return messages, nil
 }
 
+// GetMessagesPage returns up to limit messages after cursor using keyset
+// pagination on (created_at, id), so every page costs the same however deep
+// into the conversation it is
+func (r *PostgresRepository) GetMessagesPage(ctx context.Context, conversationID, cursor string, limit int) ([]llm.Message, string, error) {
+	conditions := []string{"conversation_id = $1", r.liveMessages()}
+	params := []interface{}{conversationID}
+	if cursor != "" {
+		after, afterID, err := parseMessageCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, "(created_at, id) > ($2, $3)")
+		params = append(params, after, afterID)
+	}
+	params = append(params, limit)
+
+	query := fmt.Sprintf(`
+		SELECT id, role, content, name, function_call, created_at, metadata
+		FROM messages
+		WHERE %s
+		ORDER BY created_at ASC, id ASC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(params))
+
+	rows, err := r.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	next := cursor
+	var messages []llm.Message
+	for rows.Next() {
+		var msg llm.Message
+		var id int64
+		var functionCallJSON, metadataJSON []byte
+
+		err := rows.Scan(
+			&id,
+			&msg.Role,
+			&msg.Content,
+			&msg.Name,
+			&functionCallJSON,
+			&msg.CreatedAt,
+			&metadataJSON,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(functionCallJSON) > 0 {
+			if err := json.Unmarshal(functionCallJSON, &msg.FuncCall); err != nil {
+				return nil, "", err
+			}
+		}
+
+		if len(metadataJSON) > 0 {
+			if err := json.Unmarshal(metadataJSON, &msg.Metadata); err != nil {
+				return nil, "", err
+			}
+		}
+
+		messages = append(messages, msg)
+		next = formatMessageCursor(msg.CreatedAt, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return messages, next, nil
+}
+
+// messageTime returns the CreatedAt of message, or now when it has none
+func messageTime(message llm.Message, now time.Time) time.Time {
+	if message.CreatedAt.IsZero() {
+		return now
+	}
+	return message.CreatedAt
+}
+
+// formatMessageCursor encodes the position of a message as its created_at in
+// microseconds, the precision Postgres stores, and its id
+func formatMessageCursor(createdAt time.Time, id int64) string {
+	return fmt.Sprintf("%d:%d", createdAt.UnixMicro(), id)
+}
+
+// parseMessageCursor decodes a cursor from formatMessageCursor
+func parseMessageCursor(cursor string) (time.Time, int64, error) {
+	var micros, id int64
+	if _, err := fmt.Sscanf(cursor, "%d:%d", &micros, &id); err != nil {
+		return time.Time{}, 0, fmt.Errorf("invalid cursor %q: %w", cursor, err)
+	}
+	return time.UnixMicro(micros), id, nil
+}
+
 func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversationID string, filter chathistory.Filter, limit int) ([]llm.Message, error) {
-	conditions := []string{"conversation_id = $1"}
+	conditions := []string{"conversation_id = $1", r.liveMessages()}
 	params := []interface{}{conversationID}
 	paramCount := 2
 
@@ -189,8 +364,18 @@ func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversati
 	}
 
 	if filter.Search != "" {
-		conditions = append(conditions, fmt.Sprintf("content ILIKE $%d", paramCount))
-		params = append(params, "%"+filter.Search+"%")
+		conditions = append(conditions, fmt.Sprintf(`content ILIKE $%d ESCAPE '\'`, paramCount))
+		params = append(params, containsPattern(filter.Search))
+		paramCount++
+	}
+
+	if len(filter.Metadata) > 0 {
+		condition, metadata, err := metadataCondition(filter.Metadata, paramCount)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, metadata)
 		paramCount++
 	}
 
@@ -198,7 +383,7 @@ func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversati
 		SELECT role, content, name, function_call, created_at, metadata
 		FROM messages
 		WHERE %s
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT $%d
 	`, strings.Join(conditions, " AND "), paramCount)
 
@@ -210,7 +395,6 @@ func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversati
 	defer rows.Close()
 
 	var messages []llm.Message
-	var createdAt time.Time // Add this variable
 	for rows.Next() {
 		var msg llm.Message
 		var functionCallJSON, metadataJSON []byte
@@ -220,7 +404,7 @@ func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversati
 			&msg.Content,
 			&msg.Name,
 			&functionCallJSON,
-			&createdAt, // Add created_at
+			&msg.CreatedAt,
 			&metadataJSON,
 		)
 		if err != nil {
@@ -242,6 +426,12 @@ func (r *PostgresRepository) GetMessagesByFilter(ctx context.Context, conversati
 		messages = append(messages, msg)
 	}
 
+	// Reverse the order to get chronological order
+	for i := 0; i < len(messages)/2; i++ {
+		j := len(messages) - i - 1
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
 	return messages, nil
 }
 
@@ -268,6 +458,16 @@ func (r *PostgresRepository) DeleteMessages(ctx context.Context, conversationID
 		paramCount++
 	}
 
+	if len(filter.Metadata) > 0 {
+		condition, metadata, err := metadataCondition(filter.Metadata, paramCount)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, metadata)
+		paramCount++
+	}
+
 	query := fmt.Sprintf(`
 		DELETE FROM messages
 		WHERE %s
@@ -292,9 +492,9 @@ func (r *PostgresRepository) DeleteConversation(ctx context.Context, conversatio
 func (r *PostgresRepository) GetConversation(ctx context.Context, conversationID string) (*chathistory.Conversation, error) {
 	// First get the conversation details
 	query := `
-		SELECT id, metadata, created_at, updated_at
+		SELECT id, metadata, created_at, updated_at, expires_at
 		FROM conversations
-		WHERE id = $1
+		WHERE id = $1 AND ` + r.liveConversations() + `
 	`
 	var conv chathistory.Conversation
 	var metadataJSON []byte
@@ -303,6 +503,7 @@ func (r *PostgresRepository) GetConversation(ctx context.Context, conversationID
 		&metadataJSON,
 		&conv.CreatedAt,
 		&conv.UpdatedAt,
+		&conv.ExpiresAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -322,7 +523,7 @@ func (r *PostgresRepository) GetConversation(ctx context.Context, conversationID
 		SELECT role, content, name, function_call, created_at, metadata
 		FROM messages
 		WHERE conversation_id = $1
-		ORDER BY created_at ASC
+		ORDER BY created_at ASC, id ASC
 	`
 	rows, err := r.db.QueryContext(ctx, messagesQuery, conversationID)
 	if err != nil {
@@ -334,14 +535,13 @@ func (r *PostgresRepository) GetConversation(ctx context.Context, conversationID
 	for rows.Next() {
 		var msg llm.Message
 		var functionCallJSON, metadataJSON []byte
-		var createdAt time.Time
 
 		err := rows.Scan(
 			&msg.Role,
 			&msg.Content,
 			&msg.Name,
 			&functionCallJSON,
-			&createdAt,
+			&msg.CreatedAt,
 			&metadataJSON,
 		)
 		if err != nil {
@@ -372,7 +572,7 @@ func (r *PostgresRepository) GetConversation(ctx context.Context, conversationID
 }
 
 func (r *PostgresRepository) ListConversations(ctx context.Context, filter chathistory.Filter, limit, offset int) ([]chathistory.Conversation, error) {
-	conditions := []string{"1=1"}
+	conditions := []string{r.liveConversations()}
 	params := []interface{}{}
 	paramCount := 1
 
@@ -388,8 +588,18 @@ func (r *PostgresRepository) ListConversations(ctx context.Context, filter chath
 		paramCount++
 	}
 
+	if len(filter.Metadata) > 0 {
+		condition, metadata, err := metadataCondition(filter.Metadata, paramCount)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, metadata)
+		paramCount++
+	}
+
 	query := fmt.Sprintf(`
-		SELECT id, metadata, created_at, updated_at
+		SELECT id, metadata, created_at, updated_at, expires_at
 		FROM conversations
 		WHERE %s
 		ORDER BY created_at DESC
@@ -412,6 +622,7 @@ func (r *PostgresRepository) ListConversations(ctx context.Context, filter chath
 			&metadataJSON,
 			&conv.CreatedAt,
 			&conv.UpdatedAt,
+			&conv.ExpiresAt,
 		)
 		if err != nil {
 			return nil, err
@@ -444,8 +655,202 @@ func (r *PostgresRepository) UpdateConversationMetadata(ctx context.Context, con
 	return err
 }
 
+// ReplaceMessages replaces the messages and metadata of a conversation in one
+// transaction. Messages keep their CreatedAt; those without one share a
+// timestamp and keep their order by ID.
+func (r *PostgresRepository) ReplaceMessages(ctx context.Context, conversationID string, messages []llm.Message, metadata map[string]any) error {
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	updateQuery := `
+		UPDATE conversations
+		SET metadata = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+	result, err := tx.ExecContext(ctx, updateQuery, metadataJSON, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE conversation_id = $1`, conversationID); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+
+	query := `
+		INSERT INTO messages (conversation_id, role, content, name, function_call, created_at, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	now := time.Now()
+	for _, message := range messages {
+		functionCall, err := json.Marshal(message.FuncCall)
+		if err != nil {
+			return fmt.Errorf("failed to marshal function call: %w", err)
+		}
+		messageMetadata, err := json.Marshal(message.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, query,
+			conversationID,
+			message.Role,
+			message.Content,
+			message.Name,
+			functionCall,
+			messageTime(message, now),
+			messageMetadata,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert message: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetFirstMessage returns the oldest message of the conversation with one of roles
+func (r *PostgresRepository) GetFirstMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	return r.findMessage(ctx, conversationID, roles, "ASC")
+}
+
+// GetLastMessage returns the newest message of the conversation with one of roles
+func (r *PostgresRepository) GetLastMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	return r.findMessage(ctx, conversationID, roles, "DESC")
+}
+
+// findMessage reads the first message of the conversation in the given order
+// of (created_at, id), with a role predicate when roles are given
+func (r *PostgresRepository) findMessage(ctx context.Context, conversationID string, roles []string, order string) (*llm.Message, error) {
+	conditions := []string{"conversation_id = $1", r.liveMessages()}
+	params := []interface{}{conversationID}
+	if len(roles) > 0 {
+		conditions = append(conditions, "role = ANY($2)")
+		params = append(params, pq.Array(roles))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT role, content, name, function_call, created_at, metadata
+		FROM messages
+		WHERE %s
+		ORDER BY created_at %s, id %s
+		LIMIT 1
+	`, strings.Join(conditions, " AND "), order, order)
+
+	var msg llm.Message
+	var functionCallJSON, metadataJSON []byte
+	err := r.db.QueryRowContext(ctx, query, params...).Scan(
+		&msg.Role,
+		&msg.Content,
+		&msg.Name,
+		&functionCallJSON,
+		&msg.CreatedAt,
+		&metadataJSON,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1 AND `+r.liveConversations()+`)`, conversationID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+		}
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrMessageNotFound, conversationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(functionCallJSON) > 0 {
+		if err := json.Unmarshal(functionCallJSON, &msg.FuncCall); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &msg.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	return &msg, nil
+}
+
+// SearchConversations finds the conversations with messages containing
+// query with ILIKE, like Filter.Search, in a single query
+func (r *PostgresRepository) SearchConversations(ctx context.Context, query string, limit, offset int) ([]chathistory.ConversationMatch, error) {
+	// A NULL limit returns every match
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	sqlQuery := `
+		SELECT c.id, c.metadata, c.created_at, c.updated_at, c.expires_at, m.matches, m.content, m.created_at
+		FROM (
+			SELECT DISTINCT ON (conversation_id)
+				conversation_id, content, created_at,
+				COUNT(*) OVER (PARTITION BY conversation_id) AS matches
+			FROM messages
+			WHERE content ILIKE $1 ESCAPE '\' AND ` + r.liveMessages() + `
+			ORDER BY conversation_id, created_at DESC, id DESC
+		) m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE ` + r.liveConversations() + `
+		ORDER BY m.created_at DESC, c.id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, sqlQuery, containsPattern(query), limitArg, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []chathistory.ConversationMatch{}
+	for rows.Next() {
+		var match chathistory.ConversationMatch
+		var metadataJSON []byte
+		var content string
+		err := rows.Scan(
+			&match.Conversation.ID,
+			&metadataJSON,
+			&match.Conversation.CreatedAt,
+			&match.Conversation.UpdatedAt,
+			&match.Conversation.ExpiresAt,
+			&match.Matches,
+			&content,
+			&match.LastMatchAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(metadataJSON) > 0 {
+			if err := json.Unmarshal(metadataJSON, &match.Conversation.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		match.Snippet = chathistory.MatchSnippet(content, query)
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
 func (r *PostgresRepository) GetMessageCount(ctx context.Context, conversationID string, filter chathistory.Filter) (int, error) {
-	conditions := []string{"conversation_id = $1"}
+	conditions := []string{"conversation_id = $1", r.liveMessages()}
 	params := []interface{}{conversationID}
 	paramCount := 2
 
@@ -467,6 +872,16 @@ func (r *PostgresRepository) GetMessageCount(ctx context.Context, conversationID
 		paramCount++
 	}
 
+	if len(filter.Metadata) > 0 {
+		condition, metadata, err := metadataCondition(filter.Metadata, paramCount)
+		if err != nil {
+			return 0, err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, metadata)
+		paramCount++
+	}
+
 	query := fmt.Sprintf(`
 		SELECT COUNT(*)
 		FROM messages
@@ -477,3 +892,169 @@ func (r *PostgresRepository) GetMessageCount(ctx context.Context, conversationID
 	err := r.db.QueryRowContext(ctx, query, params...).Scan(&count)
 	return count, err
 }
+
+// GetUsageSummary sums the token usage stored in message metadata with a single
+// aggregate query grouped by role and model
+func (r *PostgresRepository) GetUsageSummary(ctx context.Context, conversationID string, filter chathistory.Filter) (*chathistory.UsageSummary, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1 AND `+r.liveConversations()+`)`, conversationID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+
+	conditions := []string{"conversation_id = $1", r.liveMessages()}
+	params := []interface{}{conversationID}
+	paramCount := 2
+
+	if filter.StartTime != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", paramCount))
+		params = append(params, filter.StartTime)
+		paramCount++
+	}
+
+	if filter.EndTime != nil {
+		conditions = append(conditions, fmt.Sprintf("created_at <= $%d", paramCount))
+		params = append(params, filter.EndTime)
+		paramCount++
+	}
+
+	if len(filter.Roles) > 0 {
+		conditions = append(conditions, fmt.Sprintf("role = ANY($%d)", paramCount))
+		params = append(params, pq.Array(filter.Roles))
+		paramCount++
+	}
+
+	if filter.Search != "" {
+		conditions = append(conditions, fmt.Sprintf(`content ILIKE $%d ESCAPE '\'`, paramCount))
+		params = append(params, containsPattern(filter.Search))
+		paramCount++
+	}
+
+	if len(filter.Metadata) > 0 {
+		condition, metadata, err := metadataCondition(filter.Metadata, paramCount)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+		params = append(params, metadata)
+		paramCount++
+	}
+
+	query := fmt.Sprintf(`
+		SELECT
+			role,
+			COALESCE(metadata->>'%s', '') AS model,
+			COUNT(*),
+			COUNT(metadata->'usage'),
+			COALESCE(SUM((metadata->'usage'->>'prompt_tokens')::bigint), 0),
+			COALESCE(SUM((metadata->'usage'->>'completion_tokens')::bigint), 0),
+			COALESCE(SUM((metadata->'usage'->>'total_tokens')::bigint), 0)
+		FROM messages
+		WHERE %s
+		GROUP BY role, model
+	`, chathistory.ModelMetadataKey, strings.Join(conditions, " AND "))
+
+	rows, err := r.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := chathistory.NewUsageSummary(conversationID)
+	for rows.Next() {
+		var role, model string
+		var messages, withUsage int
+		var usage llm.Usage
+		err := rows.Scan(
+			&role,
+			&model,
+			&messages,
+			&withUsage,
+			&usage.PromptTokens,
+			&usage.CompletionTokens,
+			&usage.TotalTokens,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.Messages += messages
+		if withUsage == 0 {
+			continue
+		}
+		summary.MessagesWithUsage += withUsage
+		summary.Add(role, model, usage)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// SetConversationExpiry sets when the conversation expires, or clears its
+// expiry when expiresAt is nil
+func (r *PostgresRepository) SetConversationExpiry(ctx context.Context, conversationID string, expiresAt *time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE conversations SET expires_at = $1 WHERE id = $2`, expiresAt, conversationID)
+	if err != nil {
+		return fmt.Errorf("failed to set conversation expiry: %w", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+	return nil
+}
+
+// PurgeExpired deletes the conversations that expired at or before now, and
+// their messages through the foreign key cascade
+func (r *PostgresRepository) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM conversations WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired conversations: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
+
+// metadataCondition returns the condition matching rows whose metadata
+// contains metadata, with its argument numbered n, and the argument
+func metadataCondition(metadata map[string]any, n int) (string, string, error) {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("metadata @> $%d::jsonb", n), string(encoded), nil
+}
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern is the LIKE pattern, used with ESCAPE '\', matching text
+// containing search literally
+func containsPattern(search string) string {
+	return "%" + likeEscaper.Replace(search) + "%"
+}
+
+// liveConversations is the condition on the conversations table that skips
+// expired conversations when the repository excludes them
+func (r *PostgresRepository) liveConversations() string {
+	if !r.excludeExpired {
+		return "TRUE"
+	}
+	return "(expires_at IS NULL OR expires_at > NOW())"
+}
+
+// liveMessages is the condition on the messages table that skips the
+// messages of expired conversations when the repository excludes them
+func (r *PostgresRepository) liveMessages() string {
+	if !r.excludeExpired {
+		return "TRUE"
+	}
+	return "conversation_id NOT IN (SELECT id FROM conversations WHERE expires_at <= NOW())"
+}
@@ -0,0 +1,117 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/chathistory/repotest"
+	"github.com/Abraxas-365/kbservice/internal/testutil"
+)
+
+func TestPostgresRepository_Conformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_MessagePagerConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunMessagePagerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_MessageReplacerConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunMessageReplacerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_MessageFinderConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunMessageFinderConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_ConversationSearcherConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunConversationSearcherConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_ConversationExpirerConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunConversationExpirerConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db)
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
+
+func TestPostgresRepository_ExcludeExpiredConformance(t *testing.T) {
+	db := testutil.PostgresDB(t, schema)
+
+	repotest.RunExcludeExpiredConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+		if _, err := db.ExecContext(context.Background(), "TRUNCATE conversations, messages"); err != nil {
+			t.Fatalf("failed to truncate tables: %v", err)
+		}
+		repo, err := NewPostgresRepository(db, WithExcludeExpired())
+		if err != nil {
+			t.Fatalf("NewPostgresRepository() error = %v", err)
+		}
+		return repo
+	})
+}
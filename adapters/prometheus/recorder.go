@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"github.com/Abraxas-365/kbservice/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder implements metrics.Recorder on top of the Prometheus client.
+// Every metric in metrics.Definitions is registered up front; observations
+// for unknown metrics are dropped.
+type Recorder struct {
+	counters   map[string]*prom.CounterVec
+	histograms map[string]*prom.HistogramVec
+	gauges     map[string]*prom.GaugeVec
+	labels     map[string][]string
+}
+
+// NewRecorder registers the library's metrics with registerer
+func NewRecorder(registerer prom.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		counters:   make(map[string]*prom.CounterVec),
+		histograms: make(map[string]*prom.HistogramVec),
+		gauges:     make(map[string]*prom.GaugeVec),
+		labels:     make(map[string][]string),
+	}
+
+	for _, def := range metrics.Definitions {
+		var collector prom.Collector
+		switch def.Type {
+		case metrics.TypeCounter:
+			vec := prom.NewCounterVec(prom.CounterOpts{Name: def.Name, Help: def.Help}, def.Labels)
+			r.counters[def.Name] = vec
+			collector = vec
+		case metrics.TypeHistogram:
+			vec := prom.NewHistogramVec(prom.HistogramOpts{Name: def.Name, Help: def.Help, Buckets: buckets(def.Name)}, def.Labels)
+			r.histograms[def.Name] = vec
+			collector = vec
+		case metrics.TypeGauge:
+			vec := prom.NewGaugeVec(prom.GaugeOpts{Name: def.Name, Help: def.Help}, def.Labels)
+			r.gauges[def.Name] = vec
+			collector = vec
+		}
+
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+		r.labels[def.Name] = def.Labels
+	}
+
+	return r, nil
+}
+
+// buckets returns histogram buckets suited to the metric
+func buckets(name string) []float64 {
+	if name == metrics.EmbeddingBatchSize {
+		return prom.ExponentialBuckets(1, 2, 12)
+	}
+	return prom.DefBuckets
+}
+
+func (r *Recorder) Counter(name string, value float64, labels metrics.Labels) {
+	if vec, ok := r.counters[name]; ok {
+		vec.WithLabelValues(r.values(name, labels)...).Add(value)
+	}
+}
+
+func (r *Recorder) Histogram(name string, value float64, labels metrics.Labels) {
+	if vec, ok := r.histograms[name]; ok {
+		vec.WithLabelValues(r.values(name, labels)...).Observe(value)
+	}
+}
+
+func (r *Recorder) Gauge(name string, value float64, labels metrics.Labels) {
+	if vec, ok := r.gauges[name]; ok {
+		vec.WithLabelValues(r.values(name, labels)...).Set(value)
+	}
+}
+
+// values orders label values as declared in the metric definition
+func (r *Recorder) values(name string, labels metrics.Labels) []string {
+	names := r.labels[name]
+	values := make([]string, len(names))
+	for i, label := range names {
+		values[i] = labels[label]
+	}
+	return values
+}
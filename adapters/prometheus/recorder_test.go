@@ -0,0 +1,40 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/metrics"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder(t *testing.T) {
+	registry := prom.NewRegistry()
+	recorder, err := NewRecorder(registry)
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+
+	labels := metrics.Labels{"provider": "openai", "model": "gpt-4o", "operation": "chat", "status": metrics.StatusOK}
+	recorder.Counter(metrics.LLMRequests, 1, labels)
+	recorder.Counter(metrics.LLMRequests, 1, labels)
+	recorder.Histogram(metrics.LLMLatency, 0.5, labels)
+	recorder.Gauge(metrics.SyncInProgress, 2, nil)
+	recorder.Counter("unknown_metric", 1, nil)
+
+	requests := recorder.counters[metrics.LLMRequests].WithLabelValues("openai", "gpt-4o", "chat", metrics.StatusOK)
+	if got := testutil.ToFloat64(requests); got != 2 {
+		t.Errorf("%s = %v, want 2", metrics.LLMRequests, got)
+	}
+	if got := testutil.ToFloat64(recorder.gauges[metrics.SyncInProgress].WithLabelValues()); got != 2 {
+		t.Errorf("%s = %v, want 2", metrics.SyncInProgress, got)
+	}
+	if got := testutil.CollectAndCount(recorder.histograms[metrics.LLMLatency]); got != 1 {
+		t.Errorf("%s series = %d, want 1", metrics.LLMLatency, got)
+	}
+
+	// Registering twice with the same registry fails
+	if _, err := NewRecorder(registry); err == nil {
+		t.Error("NewRecorder() on a used registry error = nil, want error")
+	}
+}
@@ -42,13 +42,19 @@ func (w *WebSource) Load(ctx context.Context, opts ...datasource.Option) ([]data
 			"url": url,
 		}
 
+		options.ApplyStaticMetadata(metadata)
+
 		if options.Filter != nil && !options.Filter(metadata) {
 			continue
 		}
 
-		content, err := w.fetchURL(ctx, url)
-		if err != nil {
-			return nil, err
+		var content string
+		if !options.SkipContent {
+			var err error
+			content, err = w.fetchURL(ctx, url)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		doc := datasource.Document{
@@ -64,12 +70,33 @@ func (w *WebSource) Load(ctx context.Context, opts ...datasource.Option) ([]data
 }
 
 func (w *WebSource) fetchURL(ctx context.Context, url string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	body, err := w.openURL(ctx, "fetchURL", url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
 	if err != nil {
 		return "", &datasource.DataSourceError{
 			Source:  "web",
 			Op:      "fetchURL",
 			Err:     err,
+			Code:    datasource.ErrCodeInternal,
+			Message: "failed to read response body",
+		}
+	}
+
+	return string(content), nil
+}
+
+func (w *WebSource) openURL(ctx context.Context, op string, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, &datasource.DataSourceError{
+			Source:  "web",
+			Op:      op,
+			Err:     err,
 			Code:    datasource.ErrCodeInvalidSource,
 			Message: "invalid URL",
 		}
@@ -77,48 +104,42 @@ func (w *WebSource) fetchURL(ctx context.Context, url string) (string, error) {
 
 	resp, err := w.client.Do(req)
 	if err != nil {
-		return "", &datasource.DataSourceError{
+		return nil, &datasource.DataSourceError{
 			Source:  "web",
-			Op:      "fetchURL",
+			Op:      op,
 			Err:     err,
 			Code:    datasource.ErrCodeInternal,
 			Message: "failed to fetch URL",
 		}
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", &datasource.DataSourceError{
+		resp.Body.Close()
+		return nil, &datasource.DataSourceError{
 			Source:  "web",
-			Op:      "fetchURL",
+			Op:      op,
 			Code:    datasource.ErrCodeNotFound,
 			Message: "failed to fetch URL: " + resp.Status,
 		}
 	}
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", &datasource.DataSourceError{
-			Source:  "web",
-			Op:      "fetchURL",
-			Err:     err,
-			Code:    datasource.ErrCodeInternal,
-			Message: "failed to read response body",
-		}
-	}
+	return resp.Body, nil
+}
 
-	return string(content), nil
+// StreamContent opens the response body for a document source URL
+func (w *WebSource) StreamContent(ctx context.Context, source string) (io.ReadCloser, error) {
+	return w.openURL(ctx, "StreamContent", source)
 }
 
 func (w *WebSource) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
-	docChan := make(chan datasource.Document)
-	errChan := make(chan error, 1) // buffered channel for error
-
 	options := &datasource.LoadOptions{}
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	docChan := make(chan datasource.Document, options.StreamBuffer)
+	errChan := make(chan error, 1) // buffered channel for error
+
 	go func() {
 		defer close(docChan)
 		defer close(errChan)
@@ -140,14 +161,20 @@ func (w *WebSource) Stream(ctx context.Context, opts ...datasource.Option) (<-ch
 				"url": url,
 			}
 
+			options.ApplyStaticMetadata(metadata)
+
 			if options.Filter != nil && !options.Filter(metadata) {
 				continue
 			}
 
-			content, err := w.fetchURL(ctx, url)
-			if err != nil {
-				errChan <- err
-				return
+			var content string
+			if !options.SkipContent {
+				var err error
+				content, err = w.fetchURL(ctx, url)
+				if err != nil {
+					errChan <- err
+					return
+				}
 			}
 
 			doc := datasource.Document{
@@ -0,0 +1,105 @@
+package websource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+)
+
+func TestWebSource_StreamStaticMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		override bool
+		wantURL  bool
+	}{
+		{name: "Source keys take precedence", wantURL: true},
+		{name: "Override", override: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewWebSource([]string{server.URL + "/a", server.URL + "/b"}, 5*time.Second)
+
+			docChan, errChan := source.Stream(context.Background(),
+				datasource.WithStaticMetadata(map[string]interface{}{"team": "docs", "url": "static"}),
+				datasource.WithStaticMetadataOverride(tt.override),
+			)
+
+			count := 0
+			for doc := range docChan {
+				count++
+				if doc.Content == "" {
+					t.Errorf("document %s has no content", doc.Source)
+				}
+				if doc.Metadata["team"] != "docs" {
+					t.Errorf("document %s metadata = %v, want team docs", doc.Source, doc.Metadata)
+				}
+				if got := doc.Metadata["url"] == doc.Source; got != tt.wantURL {
+					t.Errorf("document %s url = %v, want the page URL %v", doc.Source, doc.Metadata["url"], tt.wantURL)
+				}
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if count != 2 {
+				t.Errorf("Stream() = %d documents, want 2", count)
+			}
+		})
+	}
+}
+
+func TestWebSource_StreamBuffer(t *testing.T) {
+	var fetched atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		w.Write([]byte("page " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	urls := make([]string, 6)
+	for i := range urls {
+		urls[i] = server.URL + "/" + strconv.Itoa(i)
+	}
+
+	for _, buffer := range []int{0, 3} {
+		t.Run(strconv.Itoa(buffer), func(t *testing.T) {
+			fetched.Store(0)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			docChan, _ := NewWebSource(urls, 5*time.Second).Stream(ctx, datasource.WithStreamBuffer(buffer))
+
+			// While the consumer is stuck on the first document, the source
+			// fetches until the buffer is full and one more document waits
+			// to be sent
+			<-docChan
+			want := int32(buffer + 2)
+			deadline := time.Now().Add(2 * time.Second)
+			for fetched.Load() < want && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+			if got := fetched.Load(); got != want {
+				t.Errorf("fetched %d pages with one received, want %d", got, want)
+			}
+
+			count := 1
+			for range docChan {
+				count++
+			}
+			if count != len(urls) {
+				t.Errorf("Stream() = %d documents, want %d", count, len(urls))
+			}
+		})
+	}
+}
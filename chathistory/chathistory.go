@@ -2,11 +2,22 @@ package chathistory
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/Abraxas-365/kbservice/llm"
 )
 
+// ErrConversationNotFound is returned by repositories for unknown conversation IDs
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrMessageNotFound is returned when a conversation has no message to return
+var ErrMessageNotFound = errors.New("message not found")
+
+// ErrExpiryNotSupported is returned by Memory's expiry methods when the
+// repository doesn't implement ConversationExpirer
+var ErrExpiryNotSupported = errors.New("repository does not support conversation expiry")
+
 // Conversation represents a chat conversation
 type Conversation struct {
 	ID        string         `json:"id"`
@@ -14,9 +25,12 @@ type Conversation struct {
 	Metadata  map[string]any `json:"metadata,omitempty"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"` // Nil for conversations that don't expire
 }
 
-// Filter represents query filters for chat history
+// Filter represents query filters for chat history. Metadata matches the
+// metadata of conversations in ListConversations and of messages everywhere
+// else; every key in it must be present with an equal value.
 type Filter struct {
 	StartTime *time.Time
 	EndTime   *time.Time
@@ -68,3 +82,80 @@ type ChatHistoryRepository interface {
 	// GetMessageCount returns the total number of messages in a conversation
 	GetMessageCount(ctx context.Context, conversationID string, filter Filter) (int, error)
 }
+
+// AutoCreator is implemented by repositories that can create a missing conversation
+// and append a message to it in a single atomic step
+type AutoCreator interface {
+	AddMessageAutoCreate(ctx context.Context, conv Conversation, message llm.Message) error
+}
+
+// UsageAggregator is implemented by repositories that can sum token usage
+// without loading every message of the conversation
+type UsageAggregator interface {
+	GetUsageSummary(ctx context.Context, conversationID string, filter Filter) (*UsageSummary, error)
+}
+
+// MessagePager is implemented by repositories that can page through the
+// messages of a conversation without loading all of them
+type MessagePager interface {
+	// GetMessagesPage returns up to limit messages of the conversation that
+	// come after cursor, oldest first, and the cursor of the last one. An empty
+	// cursor starts at the first message. Cursors are opaque to callers.
+	GetMessagesPage(ctx context.Context, conversationID, cursor string, limit int) ([]llm.Message, string, error)
+}
+
+// MessageReplacer is implemented by repositories that can replace every
+// message and the metadata of a conversation in a single atomic step
+type MessageReplacer interface {
+	// ReplaceMessages replaces the messages of the conversation with messages,
+	// in order, and its metadata with metadata
+	ReplaceMessages(ctx context.Context, conversationID string, messages []llm.Message, metadata map[string]any) error
+}
+
+// MessageFinder is implemented by repositories that can fetch the first or
+// last message of a conversation without loading the others. Both return
+// ErrMessageNotFound when no message has one of roles, or when the
+// conversation is empty if roles is empty.
+type MessageFinder interface {
+	// GetFirstMessage returns the oldest message of the conversation with one
+	// of roles, or of any role when roles is empty
+	GetFirstMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error)
+
+	// GetLastMessage returns the newest message of the conversation with one
+	// of roles, or of any role when roles is empty
+	GetLastMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error)
+}
+
+// ConversationExpirer is implemented by repositories that can expire
+// conversations. Expired conversations are kept until PurgeExpired deletes
+// them; repositories may offer to hide them from reads until then.
+type ConversationExpirer interface {
+	// SetConversationExpiry sets when the conversation expires, or clears
+	// its expiry when expiresAt is nil
+	SetConversationExpiry(ctx context.Context, conversationID string, expiresAt *time.Time) error
+
+	// PurgeExpired deletes the conversations that expired at or before now,
+	// with their messages, and returns how many it deleted
+	PurgeExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+// ConversationMatch is a conversation whose messages contain a search query
+type ConversationMatch struct {
+	Conversation Conversation // The conversation, without its messages
+	Matches      int          // How many of its messages contain the query
+	// Snippet is the text around the query in the newest matching message,
+	// see MatchSnippet
+	Snippet string
+	// LastMatchAt is when the newest matching message was created
+	LastMatchAt time.Time
+}
+
+// ConversationSearcher is implemented by repositories that can search the
+// messages of every conversation at once
+type ConversationSearcher interface {
+	// SearchConversations returns the conversations with messages whose
+	// content contains query, ignoring case like Filter.Search, newest match
+	// first. limit and offset page through the matches, a limit of 0 or
+	// less returns all of them.
+	SearchConversations(ctx context.Context, query string, limit, offset int) ([]ConversationMatch, error)
+}
@@ -0,0 +1,252 @@
+package chathistory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+const (
+	// FactsMetadataKey is the conversation metadata key Compact merges the
+	// extracted facts into
+	FactsMetadataKey = "facts"
+	// CompactedMetadataKey is set on the summary message Compact inserts, to
+	// the number of messages it replaces
+	CompactedMetadataKey = "compacted_messages"
+)
+
+// compactPrompt asks the model for a summary and the facts worth keeping
+const compactPrompt = `You compact chat transcripts. Summarize the transcript the user sends, keeping decisions, open questions and anything later messages may refer to. Extract stable facts about the user and the task as short key/value pairs.
+
+Reply with a JSON object only: {"summary": "<summary>", "facts": {"<key>": "<value>"}}`
+
+// CompactOptions contains configuration for Compact
+type CompactOptions struct {
+	KeepHead         int // Messages kept verbatim at the start of the conversation
+	KeepTail         int // Messages kept verbatim at the end of the conversation
+	SummaryMaxTokens int // Token budget of the summary request
+}
+
+// CompactOption is a function type to modify CompactOptions
+type CompactOption func(*CompactOptions)
+
+// WithKeepHead sets how many of the first messages Compact keeps
+func WithKeepHead(n int) CompactOption {
+	return func(o *CompactOptions) {
+		o.KeepHead = n
+	}
+}
+
+// WithKeepTail sets how many of the last messages Compact keeps
+func WithKeepTail(n int) CompactOption {
+	return func(o *CompactOptions) {
+		o.KeepTail = n
+	}
+}
+
+// WithSummaryMaxTokens sets the token budget of the summary
+func WithSummaryMaxTokens(tokens int) CompactOption {
+	return func(o *CompactOptions) {
+		o.SummaryMaxTokens = tokens
+	}
+}
+
+// DefaultCompactOptions returns the default Compact configuration
+func DefaultCompactOptions() *CompactOptions {
+	return &CompactOptions{
+		KeepHead:         2,
+		KeepTail:         6,
+		SummaryMaxTokens: 512,
+	}
+}
+
+// CompactionResult describes what Compact did to a conversation
+type CompactionResult struct {
+	Summary string         // Summary that replaced the middle of the conversation
+	Facts   map[string]any // Facts extracted from the replaced messages
+	Removed int            // Number of messages replaced by the summary
+	Kept    int            // Number of messages kept verbatim
+}
+
+// Compact replaces the middle of a long conversation with a summary written
+// by model. The first KeepHead and last KeepTail messages are kept verbatim,
+// and the rest is replaced by a single system message holding the summary.
+// Facts the model extracts are merged into the conversation metadata under
+// FactsMetadataKey.
+//
+// Function and tool results are never separated from the call before them, so
+// the kept ranges grow as needed. A conversation with fewer than two messages
+// between them is left as is and Compact returns a result with Removed zero.
+//
+// The rewrite is atomic when the repository implements MessageReplacer.
+// Otherwise the history is cleared and added back message by message, so a
+// failure partway can lose messages. Messages added while Compact runs are
+// lost either way, so it is meant for conversations that are not in use.
+func Compact(ctx context.Context, mem *Memory, conversationID string, model llm.LLM, opts ...CompactOption) (*CompactionResult, error) {
+	options := DefaultCompactOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	conv, err := mem.repo.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+
+	messages := conv.Messages
+	head, tail := compactBounds(messages, options.KeepHead, options.KeepTail)
+	if tail-head < 2 {
+		return &CompactionResult{Kept: len(messages)}, nil
+	}
+	middle := messages[head:tail]
+
+	summary, facts, err := summarize(ctx, model, middle, options.SummaryMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	compacted := make([]llm.Message, 0, head+1+len(messages)-tail)
+	compacted = append(compacted, messages[:head]...)
+	compacted = append(compacted, llm.Message{
+		Role:     llm.RoleSystem,
+		Content:  "Summary of earlier messages: " + summary,
+		Metadata: map[string]interface{}{CompactedMetadataKey: len(middle)},
+		// Dated like the last message it replaces, to keep the history in order
+		CreatedAt: middle[len(middle)-1].CreatedAt,
+	})
+	compacted = append(compacted, messages[tail:]...)
+
+	metadata := mergeFacts(conv.Metadata, facts)
+	if err := replaceMessages(ctx, mem.repo, conversationID, compacted, metadata); err != nil {
+		mem.Opts.Logger.ErrorContext(ctx, "compact conversation failed", "conversation_id", conversationID, "error", err)
+		return nil, err
+	}
+
+	mem.Opts.Logger.DebugContext(ctx, "compacted conversation",
+		"conversation_id", conversationID,
+		"removed", len(middle),
+		"kept", len(messages)-len(middle),
+		"facts", len(facts),
+	)
+	return &CompactionResult{
+		Summary: summary,
+		Facts:   facts,
+		Removed: len(middle),
+		Kept:    len(messages) - len(middle),
+	}, nil
+}
+
+// compactBounds returns the range [head, tail) of messages to summarize. A
+// bound never falls right before a function or tool result, which would part
+// it from its call.
+func compactBounds(messages []llm.Message, keepHead, keepTail int) (int, int) {
+	head := min(max(keepHead, 0), len(messages))
+	for head < len(messages) && isCallResult(messages[head]) {
+		head++
+	}
+	tail := max(len(messages)-max(keepTail, 0), head)
+	for tail > head && tail < len(messages) && isCallResult(messages[tail]) {
+		tail--
+	}
+	return head, tail
+}
+
+// isCallResult reports whether msg answers a function or tool call
+func isCallResult(msg llm.Message) bool {
+	return msg.Role == llm.RoleFunction || msg.Role == llm.RoleTool || msg.ToolCallID != ""
+}
+
+// summarize asks model for a summary of messages and the facts they hold
+func summarize(ctx context.Context, model llm.LLM, messages []llm.Message, maxTokens int) (string, map[string]any, error) {
+	reply, err := model.Chat(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: compactPrompt},
+		{Role: llm.RoleUser, Content: transcript(messages)},
+	}, llm.WithMaxTokens(maxTokens), llm.WithJSONObjectFormat())
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+
+	content := strings.TrimSpace(reply.Content)
+	var parsed struct {
+		Summary string         `json:"summary"`
+		Facts   map[string]any `json:"facts"`
+	}
+	// Models that ignore the JSON format still leave a usable summary
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start || json.Unmarshal([]byte(content[start:end+1]), &parsed) != nil {
+		parsed.Summary, parsed.Facts = content, nil
+	}
+	if strings.TrimSpace(parsed.Summary) == "" {
+		return "", nil, fmt.Errorf("failed to summarize conversation: empty summary")
+	}
+	return strings.TrimSpace(parsed.Summary), parsed.Facts, nil
+}
+
+// transcript renders messages for the summary request, including the function
+// calls and results MessagesToString leaves out
+func transcript(messages []llm.Message) string {
+	var sb strings.Builder
+	for _, msg := range messages {
+		sb.WriteString(msg.Role)
+		if msg.Name != "" {
+			sb.WriteString(" (" + msg.Name + ")")
+		}
+		sb.WriteString(": ")
+		sb.WriteString(msg.Content)
+		if msg.FuncCall != nil {
+			fmt.Fprintf(&sb, "[calls %s(%s)]", msg.FuncCall.Name, msg.FuncCall.Arguments)
+		}
+		for _, call := range msg.ToolCalls {
+			fmt.Fprintf(&sb, "[calls %s(%s)]", call.Function.Name, call.Function.Arguments)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// mergeFacts returns a copy of metadata with facts merged into its facts
+func mergeFacts(metadata map[string]any, facts map[string]any) map[string]any {
+	merged := make(map[string]any, len(metadata)+1)
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	if len(facts) == 0 {
+		return merged
+	}
+
+	all := make(map[string]any, len(facts))
+	if existing, ok := merged[FactsMetadataKey].(map[string]any); ok {
+		for k, v := range existing {
+			all[k] = v
+		}
+	}
+	for k, v := range facts {
+		all[k] = v
+	}
+	merged[FactsMetadataKey] = all
+	return merged
+}
+
+// replaceMessages rewrites the conversation, atomically if repo is a
+// MessageReplacer
+func replaceMessages(ctx context.Context, repo ChatHistoryRepository, conversationID string, messages []llm.Message, metadata map[string]any) error {
+	if replacer, ok := repo.(MessageReplacer); ok {
+		return replacer.ReplaceMessages(ctx, conversationID, messages, metadata)
+	}
+
+	if err := repo.ClearHistory(ctx, conversationID); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if err := repo.AddMessage(ctx, conversationID, msg); err != nil {
+			return err
+		}
+	}
+	return repo.UpdateConversationMetadata(ctx, conversationID, metadata)
+}
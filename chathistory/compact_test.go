@@ -0,0 +1,212 @@
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func (r *fakeRepository) ClearHistory(ctx context.Context, conversationID string) error {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	conv.Messages = nil
+	return nil
+}
+
+func (r *fakeRepository) UpdateConversationMetadata(ctx context.Context, conversationID string, metadata map[string]any) error {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	conv.Metadata = metadata
+	return nil
+}
+
+// replacingRepository adds MessageReplacer support on top of fakeRepository
+type replacingRepository struct {
+	*fakeRepository
+	replaces int
+}
+
+func (r *replacingRepository) ReplaceMessages(ctx context.Context, conversationID string, messages []llm.Message, metadata map[string]any) error {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	r.replaces++
+	conv.Messages = messages
+	conv.Metadata = metadata
+	return nil
+}
+
+// summaryLLM answers every Chat with reply and records the request
+type summaryLLM struct {
+	reply    string
+	calls    int
+	messages []llm.Message
+	options  llm.ChatOptions
+}
+
+func (m *summaryLLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	m.calls++
+	m.messages = messages
+	for _, opt := range opts {
+		opt(&m.options)
+	}
+	return &llm.Message{Role: llm.RoleAssistant, Content: m.reply}, nil
+}
+
+func (m *summaryLLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *summaryLLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+// toolConversation has a function call and a tool call, with their results at
+// indexes 4 and 10, where the cut points of TestCompact fall
+func toolConversation() []llm.Message {
+	return []llm.Message{
+		{Role: llm.RoleUser, Content: "I'm planning a trip to Lima"},
+		{Role: llm.RoleAssistant, Content: "When are you going?"},
+		{Role: llm.RoleUser, Content: "In March, what's the weather like?"},
+		{Role: llm.RoleAssistant, FuncCall: &llm.FunctionCall{Name: "weather", Arguments: `{"city":"Lima"}`}},
+		{Role: llm.RoleFunction, Name: "weather", Content: "26C, sunny"},
+		{Role: llm.RoleAssistant, Content: "Warm and sunny"},
+		{Role: llm.RoleUser, Content: "Great, I'm vegetarian by the way"},
+		{Role: llm.RoleAssistant, Content: "Noted"},
+		{Role: llm.RoleUser, Content: "Find me a restaurant"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "call_1", Type: "function", Function: llm.FunctionCall{Name: "restaurants", Arguments: `{"diet":"vegetarian"}`}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "Tierra Viva"},
+		{Role: llm.RoleAssistant, Content: "Try Tierra Viva"},
+	}
+}
+
+func seedConversation(t *testing.T, repo *fakeRepository, messages []llm.Message) {
+	t.Helper()
+	conv := Conversation{ID: "conv-1", Metadata: map[string]any{"user": "u1", FactsMetadataKey: map[string]any{"name": "Ana"}}}
+	if err := repo.CreateConversation(context.Background(), conv); err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	repo.conversations["conv-1"].Messages = messages
+}
+
+// assertNoOrphans fails unless every function or tool result directly follows
+// its call or another result
+func assertNoOrphans(t *testing.T, messages []llm.Message) {
+	t.Helper()
+	for i, msg := range messages {
+		if !isCallResult(msg) {
+			continue
+		}
+		if i == 0 {
+			t.Fatalf("message 0 is an orphaned result: %+v", msg)
+		}
+		prev := messages[i-1]
+		if prev.FuncCall == nil && len(prev.ToolCalls) == 0 && !isCallResult(prev) {
+			t.Errorf("result %d follows %+v instead of its call", i, prev)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	reply := `{"summary": "Ana travels to Lima in March and is vegetarian.", "facts": {"diet": "vegetarian", "destination": "Lima"}}`
+
+	for name, atomic := range map[string]bool{"MessageReplacer": true, "fallback": false} {
+		t.Run(name, func(t *testing.T) {
+			fake := newFakeRepository()
+			seedConversation(t, fake, toolConversation())
+			var repo ChatHistoryRepository = fake
+			replacer := &replacingRepository{fakeRepository: fake}
+			if atomic {
+				repo = replacer
+			}
+			model := &summaryLLM{reply: reply}
+
+			// Cutting after 4 and before the last 2 messages would split both
+			// calls from their results
+			result, err := Compact(ctx, New(repo), "conv-1", model, WithKeepHead(4), WithKeepTail(2), WithSummaryMaxTokens(100))
+			if err != nil {
+				t.Fatalf("Compact() error = %v", err)
+			}
+
+			if result.Removed != 4 || result.Kept != 8 {
+				t.Errorf("Removed, Kept = %d, %d, want 4, 8", result.Removed, result.Kept)
+			}
+			if atomic && replacer.replaces != 1 {
+				t.Errorf("ReplaceMessages calls = %d, want 1", replacer.replaces)
+			}
+			if model.calls != 1 || model.options.MaxTokens != 100 {
+				t.Errorf("summary calls = %d with MaxTokens %d, want 1 with 100", model.calls, model.options.MaxTokens)
+			}
+			if got := model.messages[1].Content; !strings.Contains(got, "Find me a restaurant") || strings.Contains(got, "26C") {
+				t.Errorf("transcript = %q, want only the middle messages", got)
+			}
+
+			conv := fake.conversations["conv-1"]
+			if len(conv.Messages) != 9 {
+				t.Fatalf("messages after = %d, want 9 (%v)", len(conv.Messages), conv.Messages)
+			}
+			assertNoOrphans(t, conv.Messages)
+			summary := conv.Messages[5]
+			if summary.Role != llm.RoleSystem || !strings.Contains(summary.Content, result.Summary) || summary.Metadata[CompactedMetadataKey] != 4 {
+				t.Errorf("summary message = %+v, want the summary of 4 messages", summary)
+			}
+			if conv.Messages[4].Content != "26C, sunny" || len(conv.Messages[6].ToolCalls) != 1 {
+				t.Errorf("messages around the summary = %+v, %+v, want the function result and the tool call", conv.Messages[4], conv.Messages[6])
+			}
+
+			facts, _ := conv.Metadata[FactsMetadataKey].(map[string]any)
+			if conv.Metadata["user"] != "u1" || facts["name"] != "Ana" || facts["diet"] != "vegetarian" || facts["destination"] != "Lima" {
+				t.Errorf("metadata = %v, want the new facts merged into the old", conv.Metadata)
+			}
+		})
+	}
+}
+
+func TestCompact_ShortConversation(t *testing.T) {
+	repo := newFakeRepository()
+	seedConversation(t, repo, toolConversation()[:6])
+	model := &summaryLLM{reply: `{"summary": "unused"}`}
+
+	result, err := Compact(context.Background(), New(repo), "conv-1", model, WithKeepHead(2), WithKeepTail(3))
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if result.Removed != 0 || result.Kept != 6 || model.calls != 0 {
+		t.Errorf("Compact() = %+v after %d summary calls, want nothing compacted", result, model.calls)
+	}
+	if got := len(repo.conversations["conv-1"].Messages); got != 6 {
+		t.Errorf("messages after = %d, want 6", got)
+	}
+}
+
+func TestCompact_PlainTextSummary(t *testing.T) {
+	repo := newFakeRepository()
+	seedConversation(t, repo, toolConversation())
+	model := &summaryLLM{reply: "The user plans a trip to Lima."}
+
+	result, err := Compact(context.Background(), New(repo), "conv-1", model)
+	if err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if result.Summary != model.reply || len(result.Facts) != 0 {
+		t.Errorf("Compact() = %+v, want the reply as the summary and no facts", result)
+	}
+	assertNoOrphans(t, repo.conversations["conv-1"].Messages)
+}
+
+func TestCompact_UnknownConversation(t *testing.T) {
+	_, err := Compact(context.Background(), New(newFakeRepository()), "missing", &summaryLLM{})
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Compact() error = %v, want ErrConversationNotFound", err)
+	}
+}
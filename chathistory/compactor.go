@@ -0,0 +1,365 @@
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// compactionLockStripes is how many locks conversations share, by a hash of
+// their ID, to serialize compaction with adds
+const compactionLockStripes = 64
+
+// errCompactionDeferred is returned by compactConversation for a
+// conversation it can't rewrite yet, because a tool call of its last round
+// is unanswered or messages were added while it was compacted
+var errCompactionDeferred = errors.New("compaction deferred")
+
+// compactionState is the compaction state of a Memory
+type compactionState struct {
+	locks [compactionLockStripes]sync.RWMutex
+
+	mu sync.Mutex
+	// checked holds the message count of conversations left at or above the
+	// threshold by their last compaction, so they are only loaded again
+	// once that many more messages were added
+	checked map[string]int
+}
+
+func newCompactionState() *compactionState {
+	return &compactionState{checked: make(map[string]int)}
+}
+
+// lock returns the lock of the conversation. Adds hold it for reading and
+// compaction for writing, so messages added by this Memory are never lost to
+// a rewrite.
+func (c *compactionState) lock(conversationID string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(conversationID))
+	return &c.locks[h.Sum32()%compactionLockStripes]
+}
+
+// due reports whether a conversation of count messages should be loaded to
+// be compacted
+func (c *compactionState) due(conversationID string, count, threshold int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count < threshold {
+		delete(c.checked, conversationID)
+		return false
+	}
+	checked, ok := c.checked[conversationID]
+	return !ok || count >= checked+threshold
+}
+
+// record remembers that a conversation was left with count messages
+func (c *compactionState) record(conversationID string, count, threshold int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if count < threshold {
+		delete(c.checked, conversationID)
+		return
+	}
+	c.checked[conversationID] = count
+}
+
+// listPageSize is how many conversations are listed at a time by passes over
+// every conversation, such as compaction and search
+const listPageSize = 100
+
+// CompactionPolicy returns the messages a conversation is rewritten to when
+// it is compacted. It must not modify messages. A result no shorter than
+// messages leaves the conversation untouched.
+type CompactionPolicy func(messages []llm.Message) []llm.Message
+
+// StripToolChatter is the default CompactionPolicy. It drops function and
+// tool results and the calls that asked for them, keeping the text of calls
+// that had any, then merges adjacent user or assistant messages from the
+// same speaker into one. Merged messages keep the metadata and CreatedAt of
+// the first. System messages are kept as they are.
+func StripToolChatter(messages []llm.Message) []llm.Message {
+	stripped := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		if isCallResult(msg) {
+			continue
+		}
+		if msg.FuncCall != nil || len(msg.ToolCalls) > 0 {
+			if strings.TrimSpace(msg.Content) == "" {
+				continue
+			}
+			msg.FuncCall, msg.ToolCalls = nil, nil
+		}
+
+		if n := len(stripped); n > 0 && msg.Role != llm.RoleSystem {
+			last := &stripped[n-1]
+			if last.Role == msg.Role && last.Name == msg.Name {
+				switch {
+				case last.Content == "":
+					last.Content = msg.Content
+				case msg.Content != "":
+					last.Content += "\n\n" + msg.Content
+				}
+				continue
+			}
+		}
+		stripped = append(stripped, msg)
+	}
+	return stripped
+}
+
+// CompactorOption configures a Compactor
+type CompactorOption func(*Compactor)
+
+// WithCompactionPolicy sets how conversations are rewritten, StripToolChatter
+// by default
+func WithCompactionPolicy(policy CompactionPolicy) CompactorOption {
+	return func(c *Compactor) {
+		c.policy = policy
+	}
+}
+
+// WithCompactionThreshold makes the Compactor skip conversations with fewer
+// than n messages
+func WithCompactionThreshold(n int) CompactorOption {
+	return func(c *Compactor) {
+		c.threshold = n
+	}
+}
+
+// WithCompactionInterval compacts every conversation of the Memory every
+// interval in the background, until the Compactor is closed
+func WithCompactionInterval(interval time.Duration) CompactorOption {
+	return func(c *Compactor) {
+		c.interval = interval
+	}
+}
+
+// Compactor rewrites conversations with a CompactionPolicy, on demand or on
+// a schedule set by WithCompactionInterval. Unlike Compact, it needs no
+// model: the default policy only drops function and tool noise, leaving a
+// readable transcript of the user and assistant turns.
+//
+// Conversations are rewritten like Compact does, atomically when the
+// repository implements MessageReplacer and by clearing the history and
+// adding the messages back otherwise.
+type Compactor struct {
+	mem       *Memory
+	policy    CompactionPolicy
+	threshold int
+	interval  time.Duration
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCompactor creates a Compactor for the conversations of mem
+func NewCompactor(mem *Memory, opts ...CompactorOption) *Compactor {
+	c := &Compactor{
+		mem:    mem,
+		policy: StripToolChatter,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.interval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.run()
+	}
+	return c
+}
+
+// CompactConversation rewrites one conversation with the policy and returns
+// how many messages it removed, 0 when the conversation is under the
+// threshold or the policy didn't shorten it. A conversation waiting on the
+// result of a tool call, or that messages were added to while it was read,
+// is left for a later pass.
+func (c *Compactor) CompactConversation(ctx context.Context, conversationID string) (int, error) {
+	removed, err := compactConversation(ctx, c.mem, conversationID, c.policy, c.threshold)
+	if errors.Is(err, errCompactionDeferred) {
+		return 0, nil
+	}
+	return removed, err
+}
+
+// CompactAll compacts every conversation of the Memory and returns how many
+// it rewrote. It stops at the first error.
+func (c *Compactor) CompactAll(ctx context.Context) (int, error) {
+	// Rewriting a conversation can move it in the listing, so every ID is
+	// listed before any is compacted
+	var ids []string
+	for offset := 0; ; offset += listPageSize {
+		conversations, err := c.mem.repo.ListConversations(ctx, Filter{}, listPageSize, offset)
+		if err != nil {
+			return 0, err
+		}
+		for _, conv := range conversations {
+			ids = append(ids, conv.ID)
+		}
+		if len(conversations) < listPageSize {
+			break
+		}
+	}
+
+	compacted := 0
+	for _, id := range ids {
+		removed, err := c.CompactConversation(ctx, id)
+		if err != nil {
+			return compacted, err
+		}
+		if removed > 0 {
+			compacted++
+		}
+	}
+	return compacted, nil
+}
+
+// Close stops the background compaction, canceling a pass in progress and
+// waiting for it to return. The Compactor stays usable on demand.
+func (c *Compactor) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			<-c.done
+		}
+	})
+	return nil
+}
+
+// run compacts every conversation every interval until Close
+func (c *Compactor) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			compacted, err := c.CompactAll(ctx)
+			if err != nil {
+				c.mem.Opts.Logger.ErrorContext(ctx, "scheduled conversation compaction failed", "compacted", compacted, "error", err)
+				continue
+			}
+			c.mem.Opts.Logger.DebugContext(ctx, "scheduled conversation compaction", "compacted", compacted)
+		}
+	}
+}
+
+// compactIfDue compacts the conversation once it reaches the threshold set by
+// WithConversationCompaction. A conversation the policy leaves at or above
+// the threshold is only loaded again once another threshold of messages was
+// added. The message that triggered it is already stored, so failures are
+// only logged.
+func (m *Memory) compactIfDue(ctx context.Context, conversationID string) {
+	if m.Opts.CompactionPolicy == nil {
+		return
+	}
+	threshold := m.Opts.CompactionThreshold
+	count, err := m.repo.GetMessageCount(ctx, conversationID, Filter{})
+	if err == nil && m.compaction.due(conversationID, count, threshold) {
+		var removed int
+		removed, err = compactConversation(ctx, m, conversationID, m.Opts.CompactionPolicy, threshold)
+		switch {
+		case errors.Is(err, errCompactionDeferred):
+			err = nil
+		case err == nil:
+			m.compaction.record(conversationID, count-removed, threshold)
+		}
+	}
+	if err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "compact conversation failed", "conversation_id", conversationID, "error", err)
+	}
+}
+
+// compactConversation rewrites the conversation with policy if it has at
+// least threshold messages and policy shortens it, returning how many
+// messages were removed
+func compactConversation(ctx context.Context, mem *Memory, conversationID string, policy CompactionPolicy, threshold int) (int, error) {
+	lock := mem.compaction.lock(conversationID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	conv, err := mem.repo.GetConversation(ctx, conversationID)
+	if err != nil {
+		return 0, err
+	}
+	if conv == nil {
+		return 0, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	if len(conv.Messages) < threshold {
+		return 0, nil
+	}
+	// The next message answers the calls, and would be orphaned by dropping them
+	if hasPendingCalls(conv.Messages) {
+		return 0, errCompactionDeferred
+	}
+
+	compacted := policy(conv.Messages)
+	removed := len(conv.Messages) - len(compacted)
+	if removed <= 0 {
+		return 0, nil
+	}
+
+	// Messages added by another Memory since the conversation was read would
+	// be lost by the rewrite
+	count, err := mem.repo.GetMessageCount(ctx, conversationID, Filter{})
+	if err != nil {
+		return 0, err
+	}
+	if count != len(conv.Messages) {
+		return 0, errCompactionDeferred
+	}
+	if err := replaceMessages(ctx, mem.repo, conversationID, compacted, conv.Metadata); err != nil {
+		return 0, err
+	}
+
+	mem.Opts.Logger.DebugContext(ctx, "compacted conversation",
+		"conversation_id", conversationID,
+		"removed", removed,
+		"kept", len(compacted),
+	)
+	return removed, nil
+}
+
+// hasPendingCalls reports whether the last function or tool calls of
+// messages wait on a result, because no result follows them for one of
+// their calls
+func hasPendingCalls(messages []llm.Message) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if isCallResult(msg) {
+			continue
+		}
+		results := messages[i+1:]
+		for _, call := range msg.ToolCalls {
+			if !slices.ContainsFunc(results, func(result llm.Message) bool { return result.ToolCallID == call.ID }) {
+				return true
+			}
+		}
+		if msg.FuncCall != nil {
+			return !slices.ContainsFunc(results, func(result llm.Message) bool { return result.Role == llm.RoleFunction })
+		}
+		return false
+	}
+	return false
+}
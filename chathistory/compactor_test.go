@@ -0,0 +1,222 @@
+package chathistory
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func (r *fakeRepository) GetMessageCount(ctx context.Context, conversationID string, filter Filter) (int, error) {
+	messages, err := r.GetMessagesByFilter(ctx, conversationID, filter, 0)
+	return len(messages), err
+}
+
+func (r *fakeRepository) ListConversations(ctx context.Context, filter Filter, limit, offset int) ([]Conversation, error) {
+	ids := make([]string, 0, len(r.conversations))
+	for id := range r.conversations {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	var conversations []Conversation
+	for _, id := range ids[min(offset, len(ids)):min(offset+limit, len(ids))] {
+		conversations = append(conversations, *r.conversations[id])
+	}
+	return conversations, nil
+}
+
+func TestStripToolChatter(t *testing.T) {
+	messages := append(toolConversation(),
+		llm.Message{Role: llm.RoleAssistant, Content: "Booking it", ToolCalls: []llm.ToolCall{{ID: "call_2", Function: llm.FunctionCall{Name: "book"}}}},
+		llm.Message{Role: "tool", ToolCallID: "call_2", Content: "booked"},
+		llm.Message{Role: llm.RoleAssistant, Content: "Done, table for one at 8"},
+	)
+
+	got := StripToolChatter(messages)
+	want := []string{
+		"I'm planning a trip to Lima",
+		"When are you going?",
+		"In March, what's the weather like?",
+		"Warm and sunny",
+		"Great, I'm vegetarian by the way",
+		"Noted",
+		"Find me a restaurant",
+		"Try Tierra Viva\n\nBooking it\n\nDone, table for one at 8",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("StripToolChatter() = %d messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i, msg := range got {
+		wantRole := llm.RoleUser
+		if i%2 == 1 {
+			wantRole = llm.RoleAssistant
+		}
+		if msg.Role != wantRole || msg.Content != want[i] || msg.FuncCall != nil || len(msg.ToolCalls) != 0 {
+			t.Errorf("message %d = %+v, want %s %q without calls", i, msg, wantRole, want[i])
+		}
+	}
+	if len(messages[12].ToolCalls) != 1 || messages[11].Content != "Try Tierra Viva" {
+		t.Error("StripToolChatter() modified its input")
+	}
+}
+
+func TestCompactor_CompactConversation(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	seedConversation(t, repo, toolConversation())
+
+	removed, err := NewCompactor(New(repo), WithCompactionThreshold(13)).CompactConversation(ctx, "conv-1")
+	if err != nil || removed != 0 {
+		t.Fatalf("CompactConversation() under the threshold = %d, %v, want nothing removed", removed, err)
+	}
+
+	removed, err = NewCompactor(New(repo), WithCompactionThreshold(12)).CompactConversation(ctx, "conv-1")
+	if err != nil {
+		t.Fatalf("CompactConversation() error = %v", err)
+	}
+	conv := repo.conversations["conv-1"]
+	if removed != 4 || len(conv.Messages) != 8 {
+		t.Errorf("CompactConversation() removed %d leaving %d messages, want 4 and 8", removed, len(conv.Messages))
+	}
+	for _, msg := range conv.Messages {
+		if msg.Role != llm.RoleUser && msg.Role != llm.RoleAssistant {
+			t.Errorf("message %+v kept, want only user and assistant turns", msg)
+		}
+	}
+	if conv.Metadata["user"] != "u1" {
+		t.Errorf("metadata = %v, want it kept", conv.Metadata)
+	}
+}
+
+func TestCompactor_Policy(t *testing.T) {
+	repo := &replacingRepository{fakeRepository: newFakeRepository()}
+	seedConversation(t, repo.fakeRepository, toolConversation())
+	lastTwo := func(messages []llm.Message) []llm.Message { return messages[len(messages)-2:] }
+
+	removed, err := NewCompactor(New(repo), WithCompactionPolicy(lastTwo)).CompactConversation(context.Background(), "conv-1")
+	if err != nil {
+		t.Fatalf("CompactConversation() error = %v", err)
+	}
+	if removed != 10 || repo.replaces != 1 || repo.conversations["conv-1"].Messages[1].Content != "Try Tierra Viva" {
+		t.Errorf("CompactConversation() removed %d with %d replaces, want the policy's messages written at once", removed, repo.replaces)
+	}
+}
+
+func TestCompactor_Interval(t *testing.T) {
+	repo := &replacingRepository{fakeRepository: newFakeRepository()}
+	seedConversation(t, repo.fakeRepository, toolConversation())
+	compactor := NewCompactor(New(repo), WithCompactionInterval(5*time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	compactor.Close() // Waits for a pass in progress
+
+	if repo.replaces != 1 {
+		t.Fatalf("ReplaceMessages calls = %d, want the conversation compacted once in the background", repo.replaces)
+	}
+	if got := len(repo.conversations["conv-1"].Messages); got != 8 {
+		t.Errorf("messages after = %d, want 8", got)
+	}
+}
+
+func TestMemory_ConversationCompaction(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	memory := New(repo, WithConversationCompaction(nil, 4))
+	if _, err := memory.CreateConversationWithID(ctx, nil, "conv-1"); err != nil {
+		t.Fatalf("CreateConversationWithID() error = %v", err)
+	}
+
+	messages := toolConversation()[2:6]
+	for _, msg := range messages[:3] {
+		if err := memory.AddMessage(ctx, "conv-1", msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	if got := len(repo.conversations["conv-1"].Messages); got != 3 {
+		t.Fatalf("messages under the threshold = %d, want 3 kept", got)
+	}
+
+	if err := memory.AddMessage(ctx, "conv-1", messages[3]); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	got := repo.conversations["conv-1"].Messages
+	if len(got) != 2 || got[0].Role != llm.RoleUser || got[1].Content != "Warm and sunny" {
+		t.Errorf("messages at the threshold = %+v, want the user question and the answer", got)
+	}
+}
+
+func TestCompactor_PendingToolCalls(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	messages := toolConversation()
+	seedConversation(t, repo, messages[:len(messages)-2]) // Ends with an unanswered call
+
+	removed, err := NewCompactor(New(repo)).CompactConversation(ctx, "conv-1")
+	if err != nil || removed != 0 || len(repo.conversations["conv-1"].Messages) != 10 {
+		t.Fatalf("CompactConversation() = %d, %v, want the conversation left until the call is answered", removed, err)
+	}
+
+	repo.conversations["conv-1"].Messages = messages[:len(messages)-1]
+	if removed, err := NewCompactor(New(repo)).CompactConversation(ctx, "conv-1"); err != nil || removed == 0 {
+		t.Errorf("CompactConversation() after the result = %d, %v, want it compacted", removed, err)
+	}
+}
+
+// growingRepository reports one more message than GetConversation returned,
+// like a repository another process added a message to meanwhile
+type growingRepository struct {
+	*replacingRepository
+}
+
+func (r *growingRepository) GetMessageCount(ctx context.Context, conversationID string, filter Filter) (int, error) {
+	count, err := r.replacingRepository.GetMessageCount(ctx, conversationID, filter)
+	return count + 1, err
+}
+
+func TestCompactor_ConversationChanged(t *testing.T) {
+	repo := &growingRepository{&replacingRepository{fakeRepository: newFakeRepository()}}
+	seedConversation(t, repo.fakeRepository, toolConversation())
+
+	removed, err := NewCompactor(New(repo)).CompactConversation(context.Background(), "conv-1")
+	if err != nil || removed != 0 || repo.replaces != 0 {
+		t.Errorf("CompactConversation() = %d, %v with %d replaces, want the changed conversation left alone", removed, err, repo.replaces)
+	}
+}
+
+// loadCountingRepository counts how often conversations are loaded
+type loadCountingRepository struct {
+	*fakeRepository
+	loads int
+}
+
+func (r *loadCountingRepository) GetConversation(ctx context.Context, conversationID string) (*Conversation, error) {
+	r.loads++
+	return r.fakeRepository.GetConversation(ctx, conversationID)
+}
+
+func TestMemory_ConversationCompactionChecksOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := &loadCountingRepository{fakeRepository: newFakeRepository()}
+	keep := func(messages []llm.Message) []llm.Message { return messages }
+	memory := New(repo, WithConversationCompaction(keep, 3))
+	if _, err := memory.CreateConversationWithID(ctx, nil, "conv-1"); err != nil {
+		t.Fatalf("CreateConversationWithID() error = %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: "hi"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	if repo.loads != 1 {
+		t.Errorf("conversation loaded %d times, want once until another threshold of messages", repo.loads)
+	}
+	if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: "hi"}); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if repo.loads != 2 {
+		t.Errorf("conversation loaded %d times, want it checked again at 6 messages", repo.loads)
+	}
+}
@@ -0,0 +1,49 @@
+package chathistory
+
+import (
+	"context"
+	"time"
+)
+
+// SetConversationTTL makes the conversation expire ttl from now, or never
+// when ttl is 0 or less. It fails with ErrExpiryNotSupported unless the
+// repository implements ConversationExpirer.
+func (m *Memory) SetConversationTTL(ctx context.Context, conversationID string, ttl time.Duration) error {
+	expirer, ok := m.repo.(ConversationExpirer)
+	if !ok {
+		return ErrExpiryNotSupported
+	}
+
+	var expiresAt *time.Time
+	if ttl > 0 {
+		at := time.Now().Add(ttl)
+		expiresAt = &at
+	}
+	if err := expirer.SetConversationExpiry(ctx, conversationID, expiresAt); err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "set conversation expiry failed", "conversation_id", conversationID, "error", err)
+		return err
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "set conversation expiry", "conversation_id", conversationID, "ttl", ttl)
+	return nil
+}
+
+// PurgeExpired deletes every conversation past its expiry with its messages
+// and returns how many it deleted. Run it periodically to enforce retention.
+// It fails with ErrExpiryNotSupported unless the repository implements
+// ConversationExpirer.
+func (m *Memory) PurgeExpired(ctx context.Context) (int, error) {
+	expirer, ok := m.repo.(ConversationExpirer)
+	if !ok {
+		return 0, ErrExpiryNotSupported
+	}
+
+	purged, err := expirer.PurgeExpired(ctx, time.Now())
+	if err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "purge expired conversations failed", "error", err)
+		return purged, err
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "purged expired conversations", "purged", purged)
+	return purged, nil
+}
@@ -0,0 +1,91 @@
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// expirerRepository adds ConversationExpirer support on top of fakeRepository
+type expirerRepository struct {
+	*fakeRepository
+}
+
+func (r *expirerRepository) SetConversationExpiry(ctx context.Context, conversationID string, expiresAt *time.Time) error {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	conv.ExpiresAt = expiresAt
+	return nil
+}
+
+func (r *expirerRepository) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	purged := 0
+	for id, conv := range r.conversations {
+		if conv.ExpiresAt != nil && !conv.ExpiresAt.After(now) {
+			delete(r.conversations, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func TestMemory_ConversationTTL(t *testing.T) {
+	ctx := context.Background()
+	repo := &expirerRepository{fakeRepository: newFakeRepository()}
+	memory := New(repo, WithConversationTTL(time.Hour))
+
+	before := time.Now()
+	conv, err := memory.CreateConversation(ctx, nil)
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	if conv.ExpiresAt == nil || conv.ExpiresAt.Before(before.Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want an hour from now", conv.ExpiresAt)
+	}
+	if err := memory.AddMessageAutoCreate(ctx, "auto", nil, llm.Message{Role: llm.RoleUser, Content: "hello"}); err != nil {
+		t.Fatalf("AddMessageAutoCreate() error = %v", err)
+	}
+	if repo.conversations["auto"].ExpiresAt == nil {
+		t.Error("auto-created conversation has no ExpiresAt, want the TTL applied")
+	}
+
+	if err := memory.SetConversationTTL(ctx, conv.ID, 0); err != nil {
+		t.Fatalf("SetConversationTTL() error = %v", err)
+	}
+	if repo.conversations[conv.ID].ExpiresAt != nil {
+		t.Errorf("ExpiresAt = %v after a TTL of 0, want nil", repo.conversations[conv.ID].ExpiresAt)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := repo.SetConversationExpiry(ctx, "auto", &past); err != nil {
+		t.Fatalf("SetConversationExpiry() error = %v", err)
+	}
+	purged, err := memory.PurgeExpired(ctx)
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeExpired() = %d, %v, want 1", purged, err)
+	}
+	if _, exists := repo.conversations["auto"]; exists {
+		t.Error("expired conversation was not purged")
+	}
+	if _, exists := repo.conversations[conv.ID]; !exists {
+		t.Error("conversation without expiry was purged")
+	}
+}
+
+func TestMemory_ExpiryNotSupported(t *testing.T) {
+	ctx := context.Background()
+	memory := New(newFakeRepository())
+
+	if err := memory.SetConversationTTL(ctx, "conv-1", time.Hour); !errors.Is(err, ErrExpiryNotSupported) {
+		t.Errorf("SetConversationTTL() error = %v, want ErrExpiryNotSupported", err)
+	}
+	if _, err := memory.PurgeExpired(ctx); !errors.Is(err, ErrExpiryNotSupported) {
+		t.Errorf("PurgeExpired() error = %v, want ErrExpiryNotSupported", err)
+	}
+}
@@ -0,0 +1,73 @@
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// errFound stops IterateMessages once GetFirstMessage has its message
+var errFound = errors.New("found")
+
+// GetFirstMessage returns the oldest stored message of the conversation with
+// one of roles, or of any role when roles is empty, such as the original
+// system prompt. It returns ErrMessageNotFound when none matches and
+// ErrConversationNotFound for unknown conversations. Repositories
+// implementing MessageFinder look it up themselves; others are read from the
+// start with IterateMessages. The system prompt option is not applied.
+func (m *Memory) GetFirstMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	if finder, ok := m.repo.(MessageFinder); ok {
+		return finder.GetFirstMessage(ctx, conversationID, roles...)
+	}
+
+	var first *llm.Message
+	err := m.IterateMessages(ctx, conversationID, func(msg llm.Message) error {
+		if len(roles) > 0 && !slices.Contains(roles, msg.Role) {
+			return nil
+		}
+		first = &msg
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return nil, err
+	}
+	if first == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, conversationID)
+	}
+	return first, nil
+}
+
+// GetLastMessage returns the newest stored message of the conversation with
+// one of roles, or of any role when roles is empty, such as the last
+// assistant reply to preview. It returns ErrMessageNotFound when none
+// matches and ErrConversationNotFound for unknown conversations.
+// Repositories implementing MessageFinder look it up themselves; others are
+// asked for the latest message matching a role filter. The system prompt
+// option is not applied.
+func (m *Memory) GetLastMessage(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error) {
+	if finder, ok := m.repo.(MessageFinder); ok {
+		return finder.GetLastMessage(ctx, conversationID, roles...)
+	}
+
+	messages, err := m.repo.GetMessagesByFilter(ctx, conversationID, Filter{Roles: roles}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 {
+		last := messages[len(messages)-1]
+		return &last, nil
+	}
+
+	// Some repositories return no messages for unknown conversations
+	conv, err := m.repo.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, conversationID)
+}
@@ -0,0 +1,68 @@
+package chathistory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// iteratePageSize is how many messages IterateMessages reads at a time
+const iteratePageSize = 500
+
+// IterateMessages calls f with every stored message of the conversation, oldest
+// first, stopping at the first error f returns and returning it. Repositories
+// implementing MessagePager are read a page at a time, so the conversation is
+// never held in memory in full; others have it loaded with GetConversation.
+// The system prompt option is not applied.
+func (m *Memory) IterateMessages(ctx context.Context, conversationID string, f func(llm.Message) error) error {
+	pager, ok := m.repo.(MessagePager)
+	if !ok {
+		conv, err := m.repo.GetConversation(ctx, conversationID)
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+		}
+		for _, msg := range conv.Messages {
+			if err := f(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cursor := ""
+	for first := true; ; first = false {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, next, err := pager.GetMessagesPage(ctx, conversationID, cursor, iteratePageSize)
+		if err != nil {
+			return err
+		}
+		// An empty conversation and an unknown one both have no first page
+		if first && len(page) == 0 {
+			conv, err := m.repo.GetConversation(ctx, conversationID)
+			if err != nil {
+				return err
+			}
+			if conv == nil {
+				return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+			}
+			return nil
+		}
+
+		for _, msg := range page {
+			if err := f(msg); err != nil {
+				return err
+			}
+		}
+		if len(page) < iteratePageSize {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -2,14 +2,21 @@ package chathistory
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/logging"
 )
 
 type Memory struct {
 	repo ChatHistoryRepository
 	Opts *Options
+
+	// compaction serializes compaction with adds and remembers which
+	// conversations were checked
+	compaction *compactionState
 }
 
 func New(repo ChatHistoryRepository, opts ...Option) *Memory {
@@ -19,19 +26,15 @@ func New(repo ChatHistoryRepository, opts ...Option) *Memory {
 	}
 
 	return &Memory{
-		repo: repo,
-		Opts: options,
+		repo:       repo,
+		Opts:       options,
+		compaction: newCompactionState(),
 	}
 }
 
 // CreateConversation creates a new conversation
 func (m *Memory) CreateConversation(ctx context.Context, metadata map[string]any) (*Conversation, error) {
-	conv := Conversation{
-		ID:        m.Opts.GenerateID(),
-		Metadata:  metadata,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
+	conv := m.newConversation(m.Opts.GenerateID(), metadata)
 
 	err := m.repo.CreateConversation(ctx, conv)
 	if err != nil {
@@ -41,13 +44,25 @@ func (m *Memory) CreateConversation(ctx context.Context, metadata map[string]any
 	return &conv, nil
 }
 
-func (m *Memory) CreateConversationWithID(ctx context.Context, metadata map[string]any, id string) (*Conversation, error) {
+// newConversation returns a conversation created now, expiring after the
+// ConversationTTL when one is set
+func (m *Memory) newConversation(id string, metadata map[string]any) Conversation {
+	now := time.Now()
 	conv := Conversation{
 		ID:        id,
 		Metadata:  metadata,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if m.Opts.ConversationTTL > 0 {
+		expiresAt := now.Add(m.Opts.ConversationTTL)
+		conv.ExpiresAt = &expiresAt
 	}
+	return conv
+}
+
+func (m *Memory) CreateConversationWithID(ctx context.Context, metadata map[string]any, id string) (*Conversation, error) {
+	conv := m.newConversation(id, metadata)
 	err := m.repo.CreateConversation(ctx, conv)
 	if err != nil {
 		return nil, err
@@ -55,9 +70,122 @@ func (m *Memory) CreateConversationWithID(ctx context.Context, metadata map[stri
 	return &conv, nil
 }
 
-// AddMessage adds a message to a specific conversation
+// AddMessage runs the message hooks and adds the message to a specific
+// conversation, stamping its CreatedAt with the current time when zero
 func (m *Memory) AddMessage(ctx context.Context, conversationID string, msg llm.Message) error {
-	return m.repo.AddMessage(ctx, conversationID, msg)
+	stampMessage(&msg)
+	if err := m.runHooks(ctx, conversationID, &msg); err != nil {
+		return err
+	}
+	if err := m.addMessage(ctx, conversationID, msg); err != nil {
+		return err
+	}
+	m.compactIfDue(ctx, conversationID)
+	return nil
+}
+
+// stampMessage sets the CreatedAt of a message being added when it is zero
+func stampMessage(msg *llm.Message) {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+}
+
+// runHooks applies the configured message hooks to msg
+func (m *Memory) runHooks(ctx context.Context, conversationID string, msg *llm.Message) error {
+	for _, hook := range m.Opts.MessageHooks {
+		if err := hook(ctx, conversationID, msg); err != nil {
+			m.Opts.Logger.DebugContext(ctx, "message rejected by hook", "conversation_id", conversationID, "role", msg.Role, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) addMessage(ctx context.Context, conversationID string, msg llm.Message) error {
+	lock := m.compaction.lock(conversationID)
+	lock.RLock()
+	err := m.repo.AddMessage(ctx, conversationID, msg)
+	lock.RUnlock()
+	if err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "add message failed", "conversation_id", conversationID, "error", err)
+		return err
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "add message",
+		"conversation_id", conversationID,
+		"role", msg.Role,
+		"content", logging.Redact(m.Opts.Redactor, msg.Content),
+	)
+	return nil
+}
+
+// AddMessageAutoCreate adds a message to a conversation, creating the conversation
+// with the given ID and metadata first if it does not exist. Metadata is ignored for
+// existing conversations. Repositories implementing AutoCreator do both in one step,
+// others fall back to a lookup followed by create and add. Like AddMessage, it
+// stamps a zero CreatedAt.
+func (m *Memory) AddMessageAutoCreate(ctx context.Context, conversationID string, metadata map[string]any, msg llm.Message) error {
+	stampMessage(&msg)
+	// Hooks run first so a rejected message doesn't leave an empty conversation behind
+	if err := m.runHooks(ctx, conversationID, &msg); err != nil {
+		return err
+	}
+
+	creator, ok := m.repo.(AutoCreator)
+	if !ok {
+		if err := m.ensureConversation(ctx, conversationID, metadata); err != nil {
+			m.Opts.Logger.ErrorContext(ctx, "create conversation failed", "conversation_id", conversationID, "error", err)
+			return err
+		}
+		if err := m.addMessage(ctx, conversationID, msg); err != nil {
+			return err
+		}
+		m.compactIfDue(ctx, conversationID)
+		return nil
+	}
+
+	conv := m.newConversation(conversationID, metadata)
+	lock := m.compaction.lock(conversationID)
+	lock.RLock()
+	err := creator.AddMessageAutoCreate(ctx, conv, msg)
+	lock.RUnlock()
+	if err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "add message failed", "conversation_id", conversationID, "error", err)
+		return err
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "add message",
+		"conversation_id", conversationID,
+		"role", msg.Role,
+		"content", logging.Redact(m.Opts.Redactor, msg.Content),
+		"auto_create", true,
+	)
+	m.compactIfDue(ctx, conversationID)
+	return nil
+}
+
+// ensureConversation creates the conversation if the repository does not know it.
+// Repositories report unknown IDs either with ErrConversationNotFound or a nil conversation.
+func (m *Memory) ensureConversation(ctx context.Context, conversationID string, metadata map[string]any) error {
+	conv, err := m.repo.GetConversation(ctx, conversationID)
+	if err != nil && !errors.Is(err, ErrConversationNotFound) {
+		return err
+	}
+	if err == nil && conv != nil {
+		return nil
+	}
+
+	_, err = m.CreateConversationWithID(ctx, metadata, conversationID)
+	if err == nil {
+		return nil
+	}
+
+	// Another writer may have created it between the lookup and the create
+	if existing, getErr := m.repo.GetConversation(ctx, conversationID); getErr == nil && existing != nil {
+		return nil
+	}
+	return err
 }
 
 // GetMessages retrieves messages from a specific conversation
@@ -67,14 +195,28 @@ func (m *Memory) GetMessages(ctx context.Context, conversationID string, limit i
 	}
 	messages, err := m.repo.GetMessages(ctx, conversationID, limit)
 	if err != nil {
+		m.Opts.Logger.ErrorContext(ctx, "get messages failed", "conversation_id", conversationID, "error", err)
 		return nil, err
 	}
+	stored := len(messages)
 	if m.Opts.SystemPrompt != "" {
 		messages = append([]llm.Message{{
 			Role:    llm.RoleSystem,
 			Content: m.Opts.SystemPrompt,
 		}}, messages...)
 	}
+	if m.Opts.MergeRoles {
+		messages = llm.NormalizeAlternation(messages)
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "get messages",
+		"conversation_id", conversationID,
+		"limit", limit,
+		"stored", stored,
+		"returned", len(messages),
+		"system_prompt", m.Opts.SystemPrompt != "",
+		"merge_roles", m.Opts.MergeRoles,
+	)
 	return messages, nil
 
 }
@@ -85,6 +227,9 @@ func (m *Memory) GetConversation(ctx context.Context, conversationID string) (*C
 	if err != nil {
 		return nil, err
 	}
+	if cov == nil {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
 	if m.Opts.SystemPrompt != "" {
 		cov.Messages = append([]llm.Message{{
 			Role:    llm.RoleSystem,
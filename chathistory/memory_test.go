@@ -0,0 +1,270 @@
+package chathistory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// fakeRepository is a minimal map-backed repository without AutoCreator support
+type fakeRepository struct {
+	ChatHistoryRepository
+	conversations map[string]*Conversation
+	creates       int
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{conversations: make(map[string]*Conversation)}
+}
+
+func (r *fakeRepository) CreateConversation(ctx context.Context, conv Conversation) error {
+	if _, exists := r.conversations[conv.ID]; exists {
+		return fmt.Errorf("conversation already exists: %s", conv.ID)
+	}
+	r.creates++
+	r.conversations[conv.ID] = &conv
+	return nil
+}
+
+func (r *fakeRepository) GetConversation(ctx context.Context, conversationID string) (*Conversation, error) {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	return conv, nil
+}
+
+func (r *fakeRepository) AddMessage(ctx context.Context, conversationID string, message llm.Message) error {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	conv.Messages = append(conv.Messages, message)
+	return nil
+}
+
+func (r *fakeRepository) GetMessagesByFilter(ctx context.Context, conversationID string, filter Filter, limit int) ([]llm.Message, error) {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrConversationNotFound, conversationID)
+	}
+	var filtered []llm.Message
+	for _, msg := range conv.Messages {
+		if len(filter.Roles) > 0 && !slices.Contains(filter.Roles, msg.Role) {
+			continue
+		}
+		if filter.Search != "" && !strings.Contains(strings.ToLower(msg.Content), strings.ToLower(filter.Search)) {
+			continue
+		}
+		filtered = append(filtered, msg)
+	}
+	if limit > 0 && limit < len(filtered) {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered, nil
+}
+
+// autoCreateRepository adds AutoCreator support on top of fakeRepository
+type autoCreateRepository struct {
+	*fakeRepository
+	calls int
+}
+
+func (r *autoCreateRepository) AddMessageAutoCreate(ctx context.Context, conv Conversation, message llm.Message) error {
+	r.calls++
+	if _, exists := r.conversations[conv.ID]; !exists {
+		r.creates++
+		r.conversations[conv.ID] = &conv
+	}
+	return r.AddMessage(ctx, conv.ID, message)
+}
+
+func TestMemory_AddMessageStampsCreatedAt(t *testing.T) {
+	ctx := context.Background()
+	repo := &autoCreateRepository{fakeRepository: newFakeRepository()}
+	memory := New(repo)
+	if _, err := memory.CreateConversationWithID(ctx, nil, "conv-1"); err != nil {
+		t.Fatalf("CreateConversationWithID() error = %v", err)
+	}
+
+	before := time.Now()
+	imported := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: "new"}); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: "imported", CreatedAt: imported}); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := memory.AddMessageAutoCreate(ctx, "conv-2", nil, llm.Message{Role: llm.RoleUser, Content: "created"}); err != nil {
+		t.Fatalf("AddMessageAutoCreate() error = %v", err)
+	}
+
+	messages := repo.conversations["conv-1"].Messages
+	if messages[0].CreatedAt.Before(before) {
+		t.Errorf("CreatedAt = %v, want the time the message was added", messages[0].CreatedAt)
+	}
+	if !messages[1].CreatedAt.Equal(imported) {
+		t.Errorf("CreatedAt = %v, want the given %v kept", messages[1].CreatedAt, imported)
+	}
+	if got := repo.conversations["conv-2"].Messages[0].CreatedAt; got.Before(before) {
+		t.Errorf("auto-created conversation message CreatedAt = %v, want it stamped", got)
+	}
+}
+
+func TestMemory_AddMessageAutoCreate(t *testing.T) {
+	ctx := context.Background()
+	msg := llm.Message{Role: llm.UserRole, Content: "hello"}
+
+	t.Run("New conversation is created with metadata", func(t *testing.T) {
+		repo := newFakeRepository()
+		mem := New(repo)
+
+		if err := mem.AddMessageAutoCreate(ctx, "conv-1", map[string]any{"user": "u1"}, msg); err != nil {
+			t.Fatalf("AddMessageAutoCreate() error = %v", err)
+		}
+
+		conv := repo.conversations["conv-1"]
+		if conv == nil {
+			t.Fatal("conversation was not created")
+		}
+		if conv.Metadata["user"] != "u1" {
+			t.Errorf("Metadata = %v, want user=u1", conv.Metadata)
+		}
+		if len(conv.Messages) != 1 || conv.Messages[0].Content != "hello" {
+			t.Errorf("Messages = %v, want the added message", conv.Messages)
+		}
+	})
+
+	t.Run("Existing conversation keeps its metadata", func(t *testing.T) {
+		repo := newFakeRepository()
+		mem := New(repo)
+		if _, err := mem.CreateConversationWithID(ctx, map[string]any{"user": "u1"}, "conv-1"); err != nil {
+			t.Fatalf("CreateConversationWithID() error = %v", err)
+		}
+
+		if err := mem.AddMessageAutoCreate(ctx, "conv-1", map[string]any{"user": "u2"}, msg); err != nil {
+			t.Fatalf("AddMessageAutoCreate() error = %v", err)
+		}
+
+		conv := repo.conversations["conv-1"]
+		if repo.creates != 1 {
+			t.Errorf("creates = %d, want 1", repo.creates)
+		}
+		if conv.Metadata["user"] != "u1" {
+			t.Errorf("Metadata = %v, want user=u1", conv.Metadata)
+		}
+		if len(conv.Messages) != 1 {
+			t.Errorf("len(Messages) = %d, want 1", len(conv.Messages))
+		}
+	})
+
+	t.Run("AutoCreator repositories handle both steps", func(t *testing.T) {
+		repo := &autoCreateRepository{fakeRepository: newFakeRepository()}
+		mem := New(repo)
+
+		for i := 0; i < 2; i++ {
+			if err := mem.AddMessageAutoCreate(ctx, "conv-1", nil, msg); err != nil {
+				t.Fatalf("AddMessageAutoCreate() error = %v", err)
+			}
+		}
+
+		if repo.calls != 2 {
+			t.Errorf("AddMessageAutoCreate calls = %d, want 2", repo.calls)
+		}
+		if repo.creates != 1 {
+			t.Errorf("creates = %d, want 1", repo.creates)
+		}
+		if got := len(repo.conversations["conv-1"].Messages); got != 2 {
+			t.Errorf("len(Messages) = %d, want 2", got)
+		}
+	})
+}
+
+func TestMemory_IterateMessagesWithoutPager(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	mem := New(repo, WithSystemPrompt("be brief"))
+	if err := repo.CreateConversation(ctx, Conversation{ID: "conv-1"}); err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	for _, content := range []string{"first", "second", "third"} {
+		if err := mem.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: content}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+
+	errStop := errors.New("stop")
+	var got []string
+	err := mem.IterateMessages(ctx, "conv-1", func(msg llm.Message) error {
+		got = append(got, msg.Content)
+		if len(got) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("IterateMessages() error = %v, want %v", err, errStop)
+	}
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("iterated %v, want the stored messages up to the error", got)
+	}
+
+	err = mem.IterateMessages(ctx, "missing", func(llm.Message) error { return nil })
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("IterateMessages() of unknown conversation error = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestMemory_FindMessagesWithoutFinder(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	mem := New(repo, WithSystemPrompt("be brief"))
+	for _, id := range []string{"conv-1", "empty"} {
+		if err := repo.CreateConversation(ctx, Conversation{ID: id}); err != nil {
+			t.Fatalf("CreateConversation() error = %v", err)
+		}
+	}
+	for _, msg := range []llm.Message{
+		{Role: llm.RoleUser, Content: "hello"},
+		{Role: llm.RoleAssistant, Content: "hi there"},
+		{Role: llm.RoleUser, Content: "how are you"},
+		{Role: llm.RoleAssistant, Content: "fine"},
+		{Role: llm.RoleUser, Content: "bye"},
+	} {
+		if err := mem.AddMessage(ctx, "conv-1", msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+
+	last, err := mem.GetLastMessage(ctx, "conv-1", llm.RoleAssistant)
+	if err != nil || last.Content != "fine" {
+		t.Errorf("GetLastMessage(assistant) = %v, %v, want fine", last, err)
+	}
+	first, err := mem.GetFirstMessage(ctx, "conv-1")
+	if err != nil || first.Content != "hello" {
+		t.Errorf("GetFirstMessage() = %v, %v, want hello, not the system prompt", first, err)
+	}
+	first, err = mem.GetFirstMessage(ctx, "conv-1", llm.RoleAssistant)
+	if err != nil || first.Content != "hi there" {
+		t.Errorf("GetFirstMessage(assistant) = %v, %v, want hi there", first, err)
+	}
+
+	if _, err := mem.GetLastMessage(ctx, "empty"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("GetLastMessage() of an empty conversation error = %v, want ErrMessageNotFound", err)
+	}
+	if _, err := mem.GetFirstMessage(ctx, "conv-1", llm.RoleSystem); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("GetFirstMessage(system) error = %v, want ErrMessageNotFound", err)
+	}
+	if _, err := mem.GetLastMessage(ctx, "missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("GetLastMessage() of unknown conversation error = %v, want ErrConversationNotFound", err)
+	}
+	if _, err := mem.GetFirstMessage(ctx, "missing"); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("GetFirstMessage() of unknown conversation error = %v, want ErrConversationNotFound", err)
+	}
+}
@@ -0,0 +1,255 @@
+package chathistory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// ImportedFromMetadataKey is the conversation metadata key recording where an
+// imported conversation came from, "openai" for ChatGPT exports
+const ImportedFromMetadataKey = "imported_from"
+
+// openAIConversation is a conversation of a ChatGPT export. Its messages are
+// the nodes of a tree, since editing a message or regenerating a response
+// starts a new branch.
+type openAIConversation struct {
+	ID             string                `json:"id"`
+	ConversationID string                `json:"conversation_id"`
+	Title          string                `json:"title"`
+	CreateTime     float64               `json:"create_time"`
+	UpdateTime     float64               `json:"update_time"`
+	CurrentNode    string                `json:"current_node"`
+	Mapping        map[string]openAINode `json:"mapping"`
+}
+
+type openAINode struct {
+	ID       string         `json:"id"`
+	Message  *openAIMessage `json:"message"`
+	Parent   string         `json:"parent"`
+	Children []string       `json:"children"`
+}
+
+type openAIMessage struct {
+	ID     string `json:"id"`
+	Author struct {
+		Role string `json:"role"`
+		Name string `json:"name"`
+	} `json:"author"`
+	CreateTime float64 `json:"create_time"`
+	Content    struct {
+		ContentType string `json:"content_type"`
+		Parts       []any  `json:"parts"`
+		Text        string `json:"text"`
+		Result      string `json:"result"`
+	} `json:"content"`
+	Recipient string         `json:"recipient"`
+	Metadata  map[string]any `json:"metadata"`
+}
+
+// ParseOpenAIExport parses the conversations.json of a ChatGPT data export.
+// Each conversation keeps its ID and creation and update times, with its
+// title in the "title" metadata. Its messages are the branch that was shown
+// last, leaving out responses that were regenerated and messages hidden from
+// the user, such as empty system prompts.
+//
+// An assistant message addressed to a tool, such as "python" or "browser",
+// becomes a tool call of that name with the message's text as arguments, and
+// the tool's reply a RoleTool message answering it.
+func ParseOpenAIExport(r io.Reader) ([]Conversation, error) {
+	var exported []openAIConversation
+	if err := json.NewDecoder(r).Decode(&exported); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAI export: %w", err)
+	}
+
+	conversations := make([]Conversation, 0, len(exported))
+	for i, conv := range exported {
+		id := conv.ConversationID
+		if id == "" {
+			id = conv.ID
+		}
+		if id == "" {
+			return nil, fmt.Errorf("conversation %d of OpenAI export has no ID", i)
+		}
+		conversations = append(conversations, Conversation{
+			ID:        id,
+			Messages:  conv.messages(),
+			Metadata:  map[string]any{"title": conv.Title, ImportedFromMetadataKey: "openai"},
+			CreatedAt: exportTime(conv.CreateTime),
+			UpdatedAt: exportTime(conv.UpdateTime),
+		})
+	}
+	return conversations, nil
+}
+
+// ImportOpenAIExport parses a ChatGPT export like ParseOpenAIExport and
+// stores every conversation in the repository, returning them. Messages are
+// stored as exported, without running the message hooks. It stops at the
+// first conversation that fails to store, such as one imported before.
+func (m *Memory) ImportOpenAIExport(ctx context.Context, r io.Reader) ([]Conversation, error) {
+	conversations, err := ParseOpenAIExport(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, conv := range conversations {
+		if err := m.importConversation(ctx, conv); err != nil {
+			m.Opts.Logger.ErrorContext(ctx, "import conversation failed", "conversation_id", conv.ID, "error", err)
+			return conversations[:i], fmt.Errorf("failed to import conversation %s: %w", conv.ID, err)
+		}
+	}
+
+	m.Opts.Logger.DebugContext(ctx, "imported OpenAI export", "conversations", len(conversations))
+	return conversations, nil
+}
+
+// importConversation creates the conversation and adds its messages. Like a
+// new conversation, it expires ConversationTTL from now when one is set.
+func (m *Memory) importConversation(ctx context.Context, conv Conversation) error {
+	messages := conv.Messages
+	conv.Messages = nil
+	now := time.Now()
+	if conv.CreatedAt.IsZero() {
+		conv.CreatedAt = now
+	}
+	if conv.UpdatedAt.IsZero() {
+		conv.UpdatedAt = conv.CreatedAt
+	}
+	if conv.ExpiresAt == nil && m.Opts.ConversationTTL > 0 {
+		expiresAt := now.Add(m.Opts.ConversationTTL)
+		conv.ExpiresAt = &expiresAt
+	}
+
+	if err := m.repo.CreateConversation(ctx, conv); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = conv.CreatedAt
+		}
+		if err := m.repo.AddMessage(ctx, conv.ID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messages returns the messages of the branch ending at the current node,
+// oldest first
+func (c openAIConversation) messages() []llm.Message {
+	var branch []*openAIMessage
+	visited := make(map[string]bool)
+	for id := c.lastNode(); id != "" && !visited[id]; id = c.Mapping[id].Parent {
+		visited[id] = true
+		node, ok := c.Mapping[id]
+		if !ok {
+			break
+		}
+		if node.Message != nil {
+			branch = append(branch, node.Message)
+		}
+	}
+
+	var messages []llm.Message
+	pending := make(map[string]string) // Tool name to the ID of its unanswered call
+	lastCall := ""
+	for i := len(branch) - 1; i >= 0; i-- {
+		exported := branch[i]
+		if hidden, _ := exported.Metadata["is_visually_hidden_from_conversation"].(bool); hidden {
+			continue
+		}
+
+		msg := llm.Message{
+			Role:      exported.Author.Role,
+			CreatedAt: exportTime(exported.CreateTime),
+		}
+		if model, ok := exported.Metadata["model_slug"].(string); ok && model != "" {
+			msg.Metadata = map[string]any{"model": model}
+		}
+		text := exported.text()
+
+		switch {
+		case msg.Role == llm.RoleAssistant && exported.Recipient != "" && exported.Recipient != "all":
+			msg.ToolCalls = []llm.ToolCall{{
+				ID:       exported.ID,
+				Type:     "function",
+				Function: llm.FunctionCall{Name: exported.Recipient, Arguments: text},
+			}}
+			pending[exported.Recipient] = exported.ID
+			lastCall = exported.ID
+		case msg.Role == llm.RoleTool:
+			msg.Content = text
+			msg.Name = exported.Author.Name
+			if id, ok := pending[msg.Name]; ok {
+				msg.ToolCallID = id
+				delete(pending, msg.Name)
+			} else {
+				msg.ToolCallID = lastCall
+			}
+		default:
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			msg.Content = text
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// lastNode is the current node, or the leaf reached by following the last
+// child from the root in exports that don't record one
+func (c openAIConversation) lastNode() string {
+	if _, ok := c.Mapping[c.CurrentNode]; ok {
+		return c.CurrentNode
+	}
+	for id, node := range c.Mapping {
+		if node.Parent != "" {
+			continue
+		}
+		for len(node.Children) > 0 {
+			id = node.Children[len(node.Children)-1]
+			next, ok := c.Mapping[id]
+			if !ok {
+				break
+			}
+			node = next
+		}
+		return id
+	}
+	return ""
+}
+
+// text returns the text of the message. Text parts are joined with newlines
+// and others, such as images, left out.
+func (m *openAIMessage) text() string {
+	var parts []string
+	for _, part := range m.Content.Parts {
+		if text, ok := part.(string); ok && text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, "\n")
+	}
+	if m.Content.Text != "" {
+		return m.Content.Text
+	}
+	return m.Content.Result
+}
+
+// exportTime converts a time of the export, in fractional seconds since the
+// epoch, zero when it wasn't recorded
+func exportTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,122 @@
+package chathistory
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func TestMemory_ImportOpenAIExport(t *testing.T) {
+	export, err := os.Open("testdata/openai_export.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Close()
+
+	repo := newFakeRepository()
+	imported, err := New(repo).ImportOpenAIExport(context.Background(), export)
+	if err != nil {
+		t.Fatalf("ImportOpenAIExport() error = %v", err)
+	}
+	if len(imported) != 2 || len(repo.conversations) != 2 {
+		t.Fatalf("ImportOpenAIExport() = %d conversations with %d stored, want 2", len(imported), len(repo.conversations))
+	}
+
+	conv := repo.conversations["conv-python"]
+	if conv == nil {
+		t.Fatal("conversation conv-python not stored")
+	}
+	if conv.Metadata["title"] != "Average of a list" || conv.Metadata[ImportedFromMetadataKey] != "openai" {
+		t.Errorf("metadata = %v, want the title and where it came from", conv.Metadata)
+	}
+	if want := time.Date(2024, 6, 1, 10, 0, 0, 500_000_000, time.UTC); !conv.CreatedAt.Equal(want) {
+		t.Errorf("CreatedAt = %v, want %v", conv.CreatedAt, want)
+	}
+
+	// The hidden system prompt and the regenerated answer are left out
+	want := []llm.Message{
+		{Role: llm.RoleUser, Content: "What is the average of 3, 5 and 10?"},
+		{Role: llm.RoleAssistant, ToolCalls: []llm.ToolCall{{ID: "n3", Type: "function", Function: llm.FunctionCall{Name: "python", Arguments: "print((3 + 5 + 10) / 3)"}}}},
+		{Role: llm.RoleTool, Name: "python", ToolCallID: "n3", Content: "6.0"},
+		{Role: llm.RoleAssistant, Content: "The average is 6."},
+		{Role: llm.RoleUser, Content: "Thanks!"},
+	}
+	assertImported(t, conv.Messages, want)
+	if conv.Messages[3].Metadata["model"] != "gpt-4o" {
+		t.Errorf("assistant metadata = %v, want the model", conv.Messages[3].Metadata)
+	}
+	if !conv.Messages[0].CreatedAt.Equal(time.Date(2024, 6, 1, 10, 0, 1, 250_000_000, time.UTC)) {
+		t.Errorf("message CreatedAt = %v, want the exported time", conv.Messages[0].CreatedAt)
+	}
+
+	// Without a current node the last branch is followed, and image parts are
+	// left out of the text
+	assertImported(t, repo.conversations["conv-photo"].Messages, []llm.Message{
+		{Role: llm.RoleUser, Content: "What is in this photo?"},
+		{Role: llm.RoleAssistant, Content: "A cat on a sofa."},
+	})
+}
+
+func TestMemory_ImportOpenAIExport_ConversationTTL(t *testing.T) {
+	export, err := os.Open("testdata/openai_export.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer export.Close()
+
+	repo := newFakeRepository()
+	before := time.Now()
+	if _, err := New(repo, WithConversationTTL(time.Hour)).ImportOpenAIExport(context.Background(), export); err != nil {
+		t.Fatalf("ImportOpenAIExport() error = %v", err)
+	}
+
+	// The exported conversations are old, so the TTL counts from the import
+	for id, conv := range repo.conversations {
+		if conv.ExpiresAt == nil || conv.ExpiresAt.Before(before.Add(time.Hour)) {
+			t.Errorf("conversation %s ExpiresAt = %v, want an hour from now", id, conv.ExpiresAt)
+		}
+	}
+}
+
+func TestMemory_ImportOpenAIExport_Errors(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	memory := New(repo)
+
+	if _, err := memory.ImportOpenAIExport(ctx, strings.NewReader(`{"title": "not a list"}`)); err == nil {
+		t.Error("ImportOpenAIExport() accepted an object")
+	}
+	if _, err := memory.ImportOpenAIExport(ctx, strings.NewReader(`[{"title": "no ID", "mapping": {}}]`)); err == nil {
+		t.Error("ImportOpenAIExport() accepted a conversation without an ID")
+	}
+
+	export := `[{"id": "a", "mapping": {}}, {"id": "b", "mapping": {}}]`
+	if _, err := memory.CreateConversationWithID(ctx, nil, "b"); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := memory.ImportOpenAIExport(ctx, strings.NewReader(export))
+	if err == nil || len(imported) != 1 || imported[0].ID != "a" {
+		t.Errorf("ImportOpenAIExport() = %v, %v, want the conversation imported before the existing one failed", imported, err)
+	}
+}
+
+// assertImported compares the messages without their times and metadata
+func assertImported(t *testing.T, got, want []llm.Message) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("imported %d messages, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range got {
+		msg := got[i]
+		msg.CreatedAt, msg.Metadata = time.Time{}, nil
+		if msg.Role != want[i].Role || msg.Content != want[i].Content || msg.Name != want[i].Name ||
+			msg.ToolCallID != want[i].ToolCallID || len(msg.ToolCalls) != len(want[i].ToolCalls) ||
+			(len(msg.ToolCalls) == 1 && msg.ToolCalls[0] != want[i].ToolCalls[0]) {
+			t.Errorf("message %d = %+v, want %+v", i, msg, want[i])
+		}
+	}
+}
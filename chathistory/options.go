@@ -1,17 +1,44 @@
 package chathistory
 
-import "github.com/google/uuid"
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/llm/pricing"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/google/uuid"
+)
 
 type IDGenerator func() string
 
+// MessageHook is called with every message before Memory stores it. It may
+// modify the message; an error stops the message from being stored.
+type MessageHook func(ctx context.Context, conversationID string, msg *llm.Message) error
+
 // Options contains configuration for chat history memory
 type Options struct {
-	MaxMessages  int         // Maximum number of messages to keep in history
-	ReturnLimit  int         // Default limit for GetMessages
-	IncludeRoles []string    // Specific roles to include (empty means all)
-	ExcludeRoles []string    // Specific roles to exclude
-	SystemPrompt string      // System prompt to always include at the start
-	GenerateID   IDGenerator // Function to generate conversation IDs
+	MaxMessages  int              // Maximum number of messages to keep in history
+	ReturnLimit  int              // Default limit for GetMessages
+	IncludeRoles []string         // Specific roles to include (empty means all)
+	ExcludeRoles []string         // Specific roles to exclude
+	SystemPrompt string           // System prompt to always include at the start
+	GenerateID   IDGenerator      // Function to generate conversation IDs
+	MergeRoles   bool             // Merge consecutive same-role messages returned by GetMessages
+	Logger       *slog.Logger     // Receives debug logs for history reads and writes
+	Redactor     logging.Redactor // Rewrites message content before it is logged
+	PriceTable   *pricing.Table   // Adds estimated cost to usage summaries when set
+	MessageHooks []MessageHook    // Run in order on every message before it is stored
+
+	// ConversationTTL makes new conversations expire after it, for
+	// repositories implementing ConversationExpirer (0 never expires them)
+	ConversationTTL time.Duration
+
+	// CompactionPolicy rewrites conversations that reach CompactionThreshold
+	// messages as messages are added (nil never compacts them)
+	CompactionPolicy    CompactionPolicy
+	CompactionThreshold int
 }
 
 // Option is a function type to modify Options
@@ -52,11 +79,75 @@ func WithSystemPrompt(prompt string) Option {
 	}
 }
 
+// WithMergeRoles makes GetMessages return strictly alternating user/assistant turns,
+// for providers that reject consecutive messages with the same role
+func WithMergeRoles(merge bool) Option {
+	return func(o *Options) {
+		o.MergeRoles = merge
+	}
+}
+
+// WithLogger sets the logger for history reads and writes. A nil logger discards the records.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		if logger == nil {
+			logger = logging.Discard()
+		}
+		o.Logger = logger
+	}
+}
+
+// WithRedactor sets how message content is rewritten before it is logged
+func WithRedactor(redactor logging.Redactor) Option {
+	return func(o *Options) {
+		o.Redactor = redactor
+	}
+}
+
+// WithPriceTable makes usage summaries include an estimated cost. Pass an empty
+// Table to use only the built-in prices.
+func WithPriceTable(table *pricing.Table) Option {
+	return func(o *Options) {
+		o.PriceTable = table
+	}
+}
+
+// WithMessageHook adds a hook run on every message before it is stored
+func WithMessageHook(hook MessageHook) Option {
+	return func(o *Options) {
+		o.MessageHooks = append(o.MessageHooks, hook)
+	}
+}
+
 // DefaultIDGenerator generates a UUID string
 func DefaultIDGenerator() string {
 	return uuid.New().String()
 }
 
+// WithConversationTTL makes conversations created by Memory expire ttl after
+// their creation. Expired conversations are deleted by PurgeExpired.
+func WithConversationTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.ConversationTTL = ttl
+	}
+}
+
+// WithConversationCompaction makes AddMessage and AddMessageAutoCreate
+// rewrite a conversation with policy, StripToolChatter when nil, once it has
+// threshold messages. It waits for the results of a round of tool calls,
+// and a conversation the policy leaves with threshold messages or more is
+// checked again once another threshold of messages was added. Use a
+// Compactor to compact on a schedule instead.
+func WithConversationCompaction(policy CompactionPolicy, threshold int) Option {
+	return func(o *Options) {
+		if policy == nil {
+			policy = StripToolChatter
+		}
+		o.CompactionPolicy = policy
+		o.CompactionThreshold = threshold
+	}
+}
+
 // WithGenerateID sets the ID generation function
 func WithGenerateID(generator IDGenerator) Option {
 	return func(o *Options) {
@@ -72,5 +163,6 @@ func DefaultOptions() *Options {
 		IncludeRoles: []string{},         // Include all roles by default
 		ExcludeRoles: []string{},         // Exclude none by default
 		GenerateID:   DefaultIDGenerator, // Default ID generator
+		Logger:       logging.Discard(),  // Silent by default
 	}
 }
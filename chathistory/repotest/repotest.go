@@ -0,0 +1,1130 @@
+// Package repotest checks chathistory.ChatHistoryRepository implementations
+// against the behavior chathistory.Memory relies on, so adapter authors can
+// run the same suites as the built-in repositories:
+//
+//	func TestConformance(t *testing.T) {
+//		repotest.RunConformance(t, func(t *testing.T) chathistory.ChatHistoryRepository {
+//			return newEmptyRepository(t)
+//		})
+//	}
+//
+// Optional capabilities such as chathistory.MessagePager have suites of their
+// own.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// RepositoryFactory returns an empty repository for a single conformance test
+type RepositoryFactory func(t *testing.T) chathistory.ChatHistoryRepository
+
+// RunConformance checks that a ChatHistoryRepository behaves the way
+// chathistory.Memory expects. newRepo must return an empty repository and is
+// called once per subtest.
+func RunConformance(t *testing.T, newRepo RepositoryFactory) {
+	t.Run("Create and get conversation", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", map[string]any{"user": "u1"})
+
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if conv == nil || conv.ID != "conv-1" {
+			t.Fatalf("GetConversation() = %v, want conv-1", conv)
+		}
+		if conv.Metadata["user"] != "u1" {
+			t.Errorf("Metadata = %v, want user=u1", conv.Metadata)
+		}
+		if len(conv.Messages) != 0 {
+			t.Errorf("len(Messages) = %d, want 0", len(conv.Messages))
+		}
+	})
+
+	t.Run("Unknown conversation is not found", func(t *testing.T) {
+		repo := newRepo(t)
+		conv, err := repo.GetConversation(context.Background(), "missing")
+		assertNotFound(t, conv, err)
+	})
+
+	t.Run("Messages are returned in chronological order", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		addMessages(t, repo, "conv-1")
+
+		messages, err := repo.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, messages, "hello", "hi there", "how are you", "fine")
+
+		messages, err = repo.GetMessages(ctx, "conv-1", 2)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, messages, "how are you", "fine")
+
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		assertContents(t, conv.Messages, "hello", "hi there", "how are you", "fine")
+	})
+
+	t.Run("Filter and count messages", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		addMessages(t, repo, "conv-1")
+
+		byRole, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{Roles: []string{llm.AssistantRole}}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, byRole, "hi there", "fine")
+
+		bySearch, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{Search: "HOW"}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, bySearch, "how are you")
+
+		assertCount(t, repo, "conv-1", chathistory.Filter{}, 4)
+		assertCount(t, repo, "conv-1", chathistory.Filter{Roles: []string{llm.UserRole}}, 2)
+	})
+
+	t.Run("Filter messages by creation time", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		base := time.Now().Add(-time.Hour).Truncate(time.Second)
+		messages := []llm.Message{
+			{Role: llm.UserRole, Content: "first", CreatedAt: base},
+			{Role: llm.AssistantRole, Content: "second", CreatedAt: base},
+			{Role: llm.UserRole, Content: "third", CreatedAt: base},
+			{Role: llm.AssistantRole, Content: "later", CreatedAt: base.Add(time.Minute)},
+			{Role: llm.UserRole, Content: "latest", CreatedAt: base.Add(2 * time.Minute)},
+		}
+		for _, msg := range messages {
+			if err := repo.AddMessage(ctx, "conv-1", msg); err != nil {
+				t.Fatalf("AddMessage() error = %v", err)
+			}
+		}
+
+		start := base.Add(30 * time.Second)
+		recent, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{StartTime: &start}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, recent, "later", "latest")
+
+		end := base
+		early, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{EndTime: &end}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, early, "first", "second", "third")
+		for _, msg := range early {
+			if !msg.CreatedAt.Equal(base) {
+				t.Errorf("CreatedAt of %q = %v, want %v", msg.Content, msg.CreatedAt, base)
+			}
+		}
+
+		assertCount(t, repo, "conv-1", chathistory.Filter{StartTime: &start}, 2)
+		if err := repo.DeleteMessages(ctx, "conv-1", chathistory.Filter{EndTime: &end}); err != nil {
+			t.Fatalf("DeleteMessages() error = %v", err)
+		}
+		remaining, err := repo.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, remaining, "later", "latest")
+	})
+
+	t.Run("Filter messages by metadata", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", map[string]any{"tool": "search"})
+		messages := []llm.Message{
+			{Role: llm.UserRole, Content: "find the docs"},
+			{Role: llm.AssistantRole, Content: "searching", Metadata: map[string]any{"tool": "search", "step": "1"}},
+			{Role: llm.AssistantRole, Content: "calculating", Metadata: map[string]any{"tool": "calculator"}},
+			{Role: llm.AssistantRole, Content: "found them", Metadata: map[string]any{"tool": "search", "step": "2"}},
+		}
+		for _, msg := range messages {
+			if err := repo.AddMessage(ctx, "conv-1", msg); err != nil {
+				t.Fatalf("AddMessage() error = %v", err)
+			}
+		}
+
+		// The conversation's own metadata doesn't make its messages match
+		byTool, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{Metadata: map[string]any{"tool": "search"}}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, byTool, "searching", "found them")
+
+		byTag, err := repo.GetMessagesByFilter(ctx, "conv-1", chathistory.Filter{Metadata: map[string]any{"tool": "search", "step": "2"}}, 10)
+		if err != nil {
+			t.Fatalf("GetMessagesByFilter() error = %v", err)
+		}
+		assertContents(t, byTag, "found them")
+
+		assertCount(t, repo, "conv-1", chathistory.Filter{Metadata: map[string]any{"tool": "search"}}, 2)
+		assertCount(t, repo, "conv-1", chathistory.Filter{Metadata: map[string]any{"tool": "unknown"}}, 0)
+
+		if err := repo.DeleteMessages(ctx, "conv-1", chathistory.Filter{Metadata: map[string]any{"tool": "calculator"}}); err != nil {
+			t.Fatalf("DeleteMessages() error = %v", err)
+		}
+		remaining, err := repo.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, remaining, "find the docs", "searching", "found them")
+	})
+
+	t.Run("Delete messages and clear history", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		addMessages(t, repo, "conv-1")
+
+		if err := repo.DeleteMessages(ctx, "conv-1", chathistory.Filter{Roles: []string{llm.AssistantRole}}); err != nil {
+			t.Fatalf("DeleteMessages() error = %v", err)
+		}
+		messages, err := repo.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, messages, "hello", "how are you")
+
+		if err := repo.ClearHistory(ctx, "conv-1"); err != nil {
+			t.Fatalf("ClearHistory() error = %v", err)
+		}
+		assertCount(t, repo, "conv-1", chathistory.Filter{}, 0)
+	})
+
+	t.Run("Update conversation metadata", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", map[string]any{"user": "u1"})
+
+		if err := repo.UpdateConversationMetadata(ctx, "conv-1", map[string]any{"user": "u2"}); err != nil {
+			t.Fatalf("UpdateConversationMetadata() error = %v", err)
+		}
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if conv.Metadata["user"] != "u2" {
+			t.Errorf("Metadata = %v, want user=u2", conv.Metadata)
+		}
+	})
+
+	t.Run("List conversations with limit and offset", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		for _, id := range []string{"conv-1", "conv-2", "conv-3"} {
+			createConversation(t, repo, id, nil)
+		}
+
+		tests := []struct {
+			limit, offset, want int
+		}{
+			{limit: 10, offset: 0, want: 3},
+			{limit: 2, offset: 0, want: 2},
+			{limit: 2, offset: 2, want: 1},
+			{limit: 2, offset: 5, want: 0},
+		}
+		for _, tt := range tests {
+			convs, err := repo.ListConversations(ctx, chathistory.Filter{}, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("ListConversations() error = %v", err)
+			}
+			if len(convs) != tt.want {
+				t.Errorf("ListConversations(limit=%d, offset=%d) returned %d, want %d", tt.limit, tt.offset, len(convs), tt.want)
+			}
+		}
+	})
+
+	t.Run("List conversations filtered by metadata", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", map[string]any{"user": "u1", "channel": "web"})
+		createConversation(t, repo, "conv-2", map[string]any{"user": "u1", "channel": "slack"})
+		createConversation(t, repo, "conv-3", map[string]any{"user": "u2", "channel": "web"})
+
+		tests := []struct {
+			metadata map[string]any
+			want     []string
+		}{
+			{metadata: map[string]any{"user": "u1"}, want: []string{"conv-1", "conv-2"}},
+			{metadata: map[string]any{"user": "u1", "channel": "web"}, want: []string{"conv-1"}},
+			{metadata: map[string]any{"user": "u3"}, want: nil},
+		}
+		for _, tt := range tests {
+			convs, err := repo.ListConversations(ctx, chathistory.Filter{Metadata: tt.metadata}, 10, 0)
+			if err != nil {
+				t.Fatalf("ListConversations() error = %v", err)
+			}
+			assertIDs(t, convs, tt.want...)
+		}
+	})
+
+	t.Run("List conversations filtered by creation time", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, id := range []string{"conv-1", "conv-2", "conv-3"} {
+			created := start.AddDate(0, 0, i)
+			conv := chathistory.Conversation{ID: id, CreatedAt: created, UpdatedAt: created}
+			if err := repo.CreateConversation(ctx, conv); err != nil {
+				t.Fatalf("CreateConversation(%s) error = %v", id, err)
+			}
+		}
+
+		from, to := start.AddDate(0, 0, 1), start.AddDate(0, 0, 2)
+		convs, err := repo.ListConversations(ctx, chathistory.Filter{StartTime: &from}, 10, 0)
+		if err != nil {
+			t.Fatalf("ListConversations() error = %v", err)
+		}
+		assertIDs(t, convs, "conv-2", "conv-3")
+
+		convs, err = repo.ListConversations(ctx, chathistory.Filter{StartTime: &from, EndTime: &from}, 10, 0)
+		if err != nil {
+			t.Fatalf("ListConversations() error = %v", err)
+		}
+		assertIDs(t, convs, "conv-2")
+
+		convs, err = repo.ListConversations(ctx, chathistory.Filter{EndTime: &to}, 10, 0)
+		if err != nil {
+			t.Fatalf("ListConversations() error = %v", err)
+		}
+		assertIDs(t, convs, "conv-1", "conv-2", "conv-3")
+	})
+
+	t.Run("Conversation timestamps are kept", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		conv := chathistory.Conversation{ID: "conv-1", CreatedAt: created, UpdatedAt: created}
+		if err := repo.CreateConversation(ctx, conv); err != nil {
+			t.Fatalf("CreateConversation() error = %v", err)
+		}
+
+		got, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if !got.CreatedAt.Equal(created) {
+			t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, created)
+		}
+		if got.UpdatedAt.Before(created) {
+			t.Errorf("UpdatedAt = %v, want no earlier than %v", got.UpdatedAt, created)
+		}
+	})
+
+	t.Run("Message fields and metadata round trip", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		msg := llm.Message{
+			Role:      llm.AssistantRole,
+			Content:   "calling",
+			Name:      "helper",
+			FuncCall:  &llm.FunctionCall{Name: "lookup", Arguments: `{"q":"x"}`},
+			Metadata:  map[string]any{"source": "a.txt", "nested": map[string]any{"page": "2"}},
+			CreatedAt: time.Now().Add(-time.Minute).Truncate(time.Second),
+		}
+		if err := repo.AddMessage(ctx, "conv-1", msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+
+		messages, err := repo.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, messages, "calling")
+		got := messages[0]
+		if got.Role != msg.Role || got.Name != msg.Name {
+			t.Errorf("Role, Name = %q, %q, want %q, %q", got.Role, got.Name, msg.Role, msg.Name)
+		}
+		if got.FuncCall == nil || *got.FuncCall != *msg.FuncCall {
+			t.Errorf("FuncCall = %+v, want %+v", got.FuncCall, msg.FuncCall)
+		}
+		if got.Metadata["source"] != "a.txt" {
+			t.Errorf("Metadata[source] = %v, want a.txt", got.Metadata["source"])
+		}
+		if !got.CreatedAt.Equal(msg.CreatedAt) {
+			t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, msg.CreatedAt)
+		}
+		if nested, _ := got.Metadata["nested"].(map[string]any); nested["page"] != "2" {
+			t.Errorf("Metadata[nested] = %v, want page=2", got.Metadata["nested"])
+		}
+	})
+
+	t.Run("Conversations are isolated", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		createConversation(t, repo, "conv-2", nil)
+		addMessages(t, repo, "conv-1")
+		if err := repo.AddMessage(ctx, "conv-2", llm.Message{Role: llm.UserRole, Content: "other"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+
+		if err := repo.ClearHistory(ctx, "conv-2"); err != nil {
+			t.Fatalf("ClearHistory() error = %v", err)
+		}
+		assertCount(t, repo, "conv-1", chathistory.Filter{}, 4)
+		if err := repo.DeleteConversation(ctx, "conv-1"); err != nil {
+			t.Fatalf("DeleteConversation() error = %v", err)
+		}
+		if conv, err := repo.GetConversation(ctx, "conv-2"); err != nil || conv == nil {
+			t.Errorf("GetConversation(conv-2) = %v, %v, want it kept", conv, err)
+		}
+	})
+
+	t.Run("Delete conversation", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		addMessages(t, repo, "conv-1")
+
+		if err := repo.DeleteConversation(ctx, "conv-1"); err != nil {
+			t.Fatalf("DeleteConversation() error = %v", err)
+		}
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		assertNotFound(t, conv, err)
+	})
+
+	t.Run("Auto create conversation", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		creator, ok := repo.(chathistory.AutoCreator)
+		if !ok {
+			t.Skip("repository does not implement chathistory.AutoCreator")
+		}
+
+		now := time.Now()
+		first := chathistory.Conversation{ID: "conv-1", Metadata: map[string]any{"user": "u1"}, CreatedAt: now, UpdatedAt: now}
+		if err := creator.AddMessageAutoCreate(ctx, first, llm.Message{Role: llm.UserRole, Content: "hello"}); err != nil {
+			t.Fatalf("AddMessageAutoCreate() error = %v", err)
+		}
+		second := chathistory.Conversation{ID: "conv-1", Metadata: map[string]any{"user": "u2"}, CreatedAt: now, UpdatedAt: now}
+		if err := creator.AddMessageAutoCreate(ctx, second, llm.Message{Role: llm.AssistantRole, Content: "hi there"}); err != nil {
+			t.Fatalf("AddMessageAutoCreate() error = %v", err)
+		}
+
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if conv.Metadata["user"] != "u1" {
+			t.Errorf("Metadata = %v, want the metadata from creation", conv.Metadata)
+		}
+		assertContents(t, conv.Messages, "hello", "hi there")
+	})
+
+	t.Run("Usage summary", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		addUsageMessages(t, repo, "conv-1")
+		memory := chathistory.New(repo)
+
+		summary, err := memory.GetUsageSummary(ctx, "conv-1", chathistory.Filter{})
+		if err != nil {
+			t.Fatalf("GetUsageSummary() error = %v", err)
+		}
+		if summary.Messages != 4 || summary.MessagesWithUsage != 2 {
+			t.Errorf("Messages = %d, MessagesWithUsage = %d, want 4 and 2", summary.Messages, summary.MessagesWithUsage)
+		}
+		if want := (llm.Usage{PromptTokens: 30, CompletionTokens: 7, TotalTokens: 37}); summary.Total != want {
+			t.Errorf("Total = %+v, want %+v", summary.Total, want)
+		}
+		if got := summary.ByRole[llm.AssistantRole]; got != summary.Total {
+			t.Errorf("ByRole[assistant] = %+v, want %+v", got, summary.Total)
+		}
+		if got, ok := summary.ByRole[llm.UserRole]; ok && got != (llm.Usage{}) {
+			t.Errorf("ByRole[user] = %+v, want no usage", got)
+		}
+		if want := (llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}); summary.ByModel["gpt-4o"] != want {
+			t.Errorf("ByModel[gpt-4o] = %+v, want %+v", summary.ByModel["gpt-4o"], want)
+		}
+		if len(summary.ByModel) != 1 {
+			t.Errorf("ByModel = %v, want only gpt-4o", summary.ByModel)
+		}
+
+		summary, err = memory.GetUsageSummary(ctx, "conv-1", chathistory.Filter{Roles: []string{llm.UserRole}})
+		if err != nil {
+			t.Fatalf("GetUsageSummary() error = %v", err)
+		}
+		if summary.Messages != 2 || summary.MessagesWithUsage != 0 || summary.Total != (llm.Usage{}) {
+			t.Errorf("user-only summary = %+v, want 2 messages without usage", summary)
+		}
+
+		if _, err := memory.GetUsageSummary(ctx, "missing", chathistory.Filter{}); !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("GetUsageSummary(missing) error = %v, want ErrConversationNotFound", err)
+		}
+	})
+
+	t.Run("List conversations with usage", func(t *testing.T) {
+		ctx := context.Background()
+		repo := newRepo(t)
+		createConversation(t, repo, "conv-1", nil)
+		createConversation(t, repo, "conv-2", nil)
+		addUsageMessages(t, repo, "conv-1")
+		addMessages(t, repo, "conv-2")
+
+		results, err := chathistory.New(repo).ListConversationsWithUsage(ctx, chathistory.Filter{}, 10, 0)
+		if err != nil {
+			t.Fatalf("ListConversationsWithUsage() error = %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("ListConversationsWithUsage() returned %d results, want 2", len(results))
+		}
+		for _, result := range results {
+			var want int
+			if result.Conversation.ID == "conv-1" {
+				want = 37
+			}
+			if result.Usage.Total.TotalTokens != want {
+				t.Errorf("%s TotalTokens = %d, want %d", result.Conversation.ID, result.Usage.Total.TotalTokens, want)
+			}
+			if result.Usage.Messages != 4 {
+				t.Errorf("%s Messages = %d, want 4", result.Conversation.ID, result.Usage.Messages)
+			}
+		}
+	})
+}
+
+func createConversation(t *testing.T, repo chathistory.ChatHistoryRepository, id string, metadata map[string]any) {
+	t.Helper()
+	now := time.Now()
+	conv := chathistory.Conversation{ID: id, Metadata: metadata, CreatedAt: now, UpdatedAt: now}
+	if err := repo.CreateConversation(context.Background(), conv); err != nil {
+		t.Fatalf("CreateConversation(%s) error = %v", id, err)
+	}
+}
+
+func addMessages(t *testing.T, repo chathistory.ChatHistoryRepository, conversationID string) {
+	t.Helper()
+	// Messages created within the same second must still keep their order
+	createdAt := time.Now().Truncate(time.Second)
+	messages := []llm.Message{
+		{Role: llm.UserRole, Content: "hello", CreatedAt: createdAt},
+		{Role: llm.AssistantRole, Content: "hi there", CreatedAt: createdAt},
+		{Role: llm.UserRole, Content: "how are you", CreatedAt: createdAt},
+		{Role: llm.AssistantRole, Content: "fine", CreatedAt: createdAt},
+	}
+	for _, msg := range messages {
+		if err := repo.AddMessage(context.Background(), conversationID, msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+}
+
+// addUsageMessages adds two user messages without usage and two assistant
+// replies with usage, only the first of which names its model
+func addUsageMessages(t *testing.T, repo chathistory.ChatHistoryRepository, conversationID string) {
+	t.Helper()
+	first := llm.Message{Role: llm.AssistantRole, Content: "hi there", Metadata: map[string]any{chathistory.ModelMetadataKey: "gpt-4o"}}
+	first.SetUsage(&llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+	second := llm.Message{Role: llm.AssistantRole, Content: "fine"}
+	second.SetUsage(&llm.Usage{PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22})
+
+	messages := []llm.Message{
+		{Role: llm.UserRole, Content: "hello"},
+		first,
+		{Role: llm.UserRole, Content: "how are you"},
+		second,
+	}
+	for _, msg := range messages {
+		if err := repo.AddMessage(context.Background(), conversationID, msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+}
+
+// assertNotFound accepts both conventions repositories use for unknown IDs
+func assertNotFound(t *testing.T, conv *chathistory.Conversation, err error) {
+	t.Helper()
+	if err != nil && !errors.Is(err, chathistory.ErrConversationNotFound) {
+		t.Fatalf("GetConversation() error = %v, want ErrConversationNotFound", err)
+	}
+	if err == nil && conv != nil {
+		t.Errorf("GetConversation() = %v, want not found", conv)
+	}
+}
+
+func assertContents(t *testing.T, messages []llm.Message, want ...string) {
+	t.Helper()
+	if len(messages) != len(want) {
+		t.Fatalf("got %d messages, want %d (%v)", len(messages), len(want), want)
+	}
+	for i, msg := range messages {
+		if msg.Content != want[i] {
+			t.Errorf("message %d = %q, want %q", i, msg.Content, want[i])
+		}
+	}
+}
+
+// assertIDs checks the IDs of convs, in any order
+func assertIDs(t *testing.T, convs []chathistory.Conversation, want ...string) {
+	t.Helper()
+	got := make([]string, len(convs))
+	for i, conv := range convs {
+		got[i] = conv.ID
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("conversations = %v, want %v", got, want)
+	}
+}
+
+func assertCount(t *testing.T, repo chathistory.ChatHistoryRepository, conversationID string, filter chathistory.Filter, want int) {
+	t.Helper()
+	count, err := repo.GetMessageCount(context.Background(), conversationID, filter)
+	if err != nil {
+		t.Fatalf("GetMessageCount() error = %v", err)
+	}
+	if count != want {
+		t.Errorf("GetMessageCount() = %d, want %d", count, want)
+	}
+}
+
+// largeConversation is how many messages the pager conformance tests seed,
+// enough for several pages of chathistory.Memory.IterateMessages
+const largeConversation = 1234
+
+// RunMessagePagerConformance checks that a repository's MessagePager returns
+// every message of a large conversation once and in order. newRepo must
+// return a chathistory.MessagePager.
+func RunMessagePagerConformance(t *testing.T, newRepo RepositoryFactory) {
+	seeded := func(t *testing.T) (chathistory.ChatHistoryRepository, chathistory.MessagePager) {
+		t.Helper()
+		repo := newRepo(t)
+		pager, ok := repo.(chathistory.MessagePager)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.MessagePager", repo)
+		}
+		createConversation(t, repo, "conv-1", nil)
+		createConversation(t, repo, "conv-2", nil)
+		// Every message shares a timestamp, so the order rests on the tiebreak
+		createdAt := time.Now().Truncate(time.Second)
+		for i := 0; i < largeConversation; i++ {
+			msg := llm.Message{Role: llm.UserRole, Content: fmt.Sprintf("message %d", i), CreatedAt: createdAt}
+			if err := repo.AddMessage(context.Background(), "conv-1", msg); err != nil {
+				t.Fatalf("AddMessage() error = %v", err)
+			}
+		}
+		addMessages(t, repo, "conv-2")
+		return repo, pager
+	}
+
+	t.Run("Pages cover the conversation in order", func(t *testing.T) {
+		ctx := context.Background()
+		_, pager := seeded(t)
+
+		var cursor string
+		var got []llm.Message
+		for pages := 0; ; pages++ {
+			if pages > largeConversation {
+				t.Fatal("GetMessagesPage() never reached the end")
+			}
+			page, next, err := pager.GetMessagesPage(ctx, "conv-1", cursor, 100)
+			if err != nil {
+				t.Fatalf("GetMessagesPage() error = %v", err)
+			}
+			if len(page) > 100 {
+				t.Fatalf("GetMessagesPage() returned %d messages, want at most 100", len(page))
+			}
+			if len(page) == 0 {
+				break
+			}
+			got = append(got, page...)
+			cursor = next
+		}
+		assertSequence(t, got)
+	})
+
+	t.Run("IterateMessages visits every message in order", func(t *testing.T) {
+		repo, _ := seeded(t)
+		memory := chathistory.New(repo)
+
+		var got []llm.Message
+		err := memory.IterateMessages(context.Background(), "conv-1", func(msg llm.Message) error {
+			got = append(got, msg)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("IterateMessages() error = %v", err)
+		}
+		assertSequence(t, got)
+	})
+
+	t.Run("IterateMessages stops at the first callback error", func(t *testing.T) {
+		repo, _ := seeded(t)
+		memory := chathistory.New(repo)
+		errStop := errors.New("stop")
+
+		calls := 0
+		err := memory.IterateMessages(context.Background(), "conv-1", func(msg llm.Message) error {
+			calls++
+			if calls == 700 {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("IterateMessages() error = %v, want %v", err, errStop)
+		}
+		if calls != 700 {
+			t.Errorf("callback called %d times, want 700", calls)
+		}
+	})
+
+	t.Run("IterateMessages of an unknown conversation", func(t *testing.T) {
+		repo, _ := seeded(t)
+		err := chathistory.New(repo).IterateMessages(context.Background(), "missing", func(llm.Message) error {
+			t.Error("callback called for an unknown conversation")
+			return nil
+		})
+		if !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("IterateMessages() error = %v, want ErrConversationNotFound", err)
+		}
+	})
+}
+
+// assertSequence checks that messages are the seeded large conversation
+func assertSequence(t *testing.T, messages []llm.Message) {
+	t.Helper()
+	if len(messages) != largeConversation {
+		t.Fatalf("got %d messages, want %d", len(messages), largeConversation)
+	}
+	for i, msg := range messages {
+		if want := fmt.Sprintf("message %d", i); msg.Content != want {
+			t.Fatalf("message %d = %q, want %q", i, msg.Content, want)
+		}
+	}
+}
+
+// RunMessageReplacerConformance checks that a repository's MessageReplacer
+// swaps the messages and metadata of one conversation only. newRepo must
+// return a chathistory.MessageReplacer.
+func RunMessageReplacerConformance(t *testing.T, newRepo RepositoryFactory) {
+	seeded := func(t *testing.T) (chathistory.ChatHistoryRepository, chathistory.MessageReplacer) {
+		t.Helper()
+		repo := newRepo(t)
+		replacer, ok := repo.(chathistory.MessageReplacer)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.MessageReplacer", repo)
+		}
+		createConversation(t, repo, "conv-1", map[string]any{"topic": "greetings"})
+		createConversation(t, repo, "conv-2", nil)
+		addMessages(t, repo, "conv-1")
+		addMessages(t, repo, "conv-2")
+		return repo, replacer
+	}
+
+	t.Run("Replaces messages and metadata", func(t *testing.T) {
+		ctx := context.Background()
+		repo, replacer := seeded(t)
+
+		messages := []llm.Message{
+			{Role: llm.UserRole, Content: "hello"},
+			{Role: llm.SystemRole, Content: "summary", Metadata: map[string]any{"compacted_messages": float64(2)}},
+			{Role: llm.AssistantRole, Content: "fine"},
+		}
+		metadata := map[string]any{"topic": "greetings", "facts": map[string]any{"mood": "fine"}}
+		if err := replacer.ReplaceMessages(ctx, "conv-1", messages, metadata); err != nil {
+			t.Fatalf("ReplaceMessages() error = %v", err)
+		}
+
+		conv, err := repo.GetConversation(ctx, "conv-1")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		assertContents(t, conv.Messages, "hello", "summary", "fine")
+		if got := conv.Messages[1].Metadata["compacted_messages"]; got != float64(2) {
+			t.Errorf("message metadata = %v, want compacted_messages 2", conv.Messages[1].Metadata)
+		}
+		facts, _ := conv.Metadata["facts"].(map[string]any)
+		if conv.Metadata["topic"] != "greetings" || facts["mood"] != "fine" {
+			t.Errorf("metadata = %v, want %v", conv.Metadata, metadata)
+		}
+
+		latest, err := repo.GetMessages(ctx, "conv-1", 2)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, latest, "summary", "fine")
+
+		other, err := repo.GetMessages(ctx, "conv-2", 0)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		assertContents(t, other, "hello", "hi there", "how are you", "fine")
+	})
+
+	t.Run("Unknown conversation", func(t *testing.T) {
+		_, replacer := seeded(t)
+		err := replacer.ReplaceMessages(context.Background(), "missing", []llm.Message{{Role: llm.UserRole, Content: "hello"}}, nil)
+		if !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("ReplaceMessages() error = %v, want ErrConversationNotFound", err)
+		}
+	})
+}
+
+// RunMessageFinderConformance checks that a repository's MessageFinder
+// returns the first and last messages by role. newRepo must return a
+// chathistory.MessageFinder.
+func RunMessageFinderConformance(t *testing.T, newRepo RepositoryFactory) {
+	seeded := func(t *testing.T) chathistory.MessageFinder {
+		t.Helper()
+		repo := newRepo(t)
+		finder, ok := repo.(chathistory.MessageFinder)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.MessageFinder", repo)
+		}
+		createConversation(t, repo, "conv-1", nil)
+		createConversation(t, repo, "empty", nil)
+		if err := repo.AddMessage(context.Background(), "conv-1", llm.Message{Role: llm.SystemRole, Content: "be brief"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+		addMessages(t, repo, "conv-1")
+		if err := repo.AddMessage(context.Background(), "conv-1", llm.Message{Role: llm.UserRole, Content: "bye"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+		return finder
+	}
+
+	t.Run("Finds messages by role", func(t *testing.T) {
+		ctx := context.Background()
+		finder := seeded(t)
+
+		for _, test := range []struct {
+			name  string
+			find  func(ctx context.Context, conversationID string, roles ...string) (*llm.Message, error)
+			roles []string
+			want  string
+		}{
+			{name: "Last", find: finder.GetLastMessage, want: "bye"},
+			{name: "Last assistant", find: finder.GetLastMessage, roles: []string{llm.AssistantRole}, want: "fine"},
+			{name: "Last of several roles", find: finder.GetLastMessage, roles: []string{llm.SystemRole, llm.AssistantRole}, want: "fine"},
+			{name: "First", find: finder.GetFirstMessage, want: "be brief"},
+			{name: "First user", find: finder.GetFirstMessage, roles: []string{llm.UserRole}, want: "hello"},
+			{name: "First assistant", find: finder.GetFirstMessage, roles: []string{llm.AssistantRole}, want: "hi there"},
+		} {
+			msg, err := test.find(ctx, "conv-1", test.roles...)
+			if err != nil {
+				t.Fatalf("%s error = %v", test.name, err)
+			}
+			if msg.Content != test.want {
+				t.Errorf("%s = %q, want %q", test.name, msg.Content, test.want)
+			}
+		}
+	})
+
+	t.Run("No matching message", func(t *testing.T) {
+		ctx := context.Background()
+		finder := seeded(t)
+
+		if _, err := finder.GetLastMessage(ctx, "empty"); !errors.Is(err, chathistory.ErrMessageNotFound) {
+			t.Errorf("GetLastMessage() of an empty conversation error = %v, want ErrMessageNotFound", err)
+		}
+		if _, err := finder.GetFirstMessage(ctx, "conv-1", llm.FunctionRole); !errors.Is(err, chathistory.ErrMessageNotFound) {
+			t.Errorf("GetFirstMessage() of a missing role error = %v, want ErrMessageNotFound", err)
+		}
+	})
+
+	t.Run("Unknown conversation", func(t *testing.T) {
+		ctx := context.Background()
+		finder := seeded(t)
+
+		if _, err := finder.GetLastMessage(ctx, "missing"); !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("GetLastMessage() error = %v, want ErrConversationNotFound", err)
+		}
+		if _, err := finder.GetFirstMessage(ctx, "missing"); !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("GetFirstMessage() error = %v, want ErrConversationNotFound", err)
+		}
+	})
+}
+
+// RunConversationSearcherConformance checks that a repository's
+// ConversationSearcher finds conversations by the content of their messages,
+// ignoring case, newest match first. newRepo must return a
+// chathistory.ConversationSearcher.
+func RunConversationSearcherConformance(t *testing.T, newRepo RepositoryFactory) {
+	seeded := func(t *testing.T) chathistory.ConversationSearcher {
+		t.Helper()
+		repo := newRepo(t)
+		searcher, ok := repo.(chathistory.ConversationSearcher)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.ConversationSearcher", repo)
+		}
+
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for i, conv := range []struct {
+			id       string
+			messages []string
+		}{
+			{id: "lima", messages: []string{"I'm planning a trip to Lima", "When are you going?", "Is LIMA warm in March?"}},
+			{id: "cusco", messages: []string{"How high is Cusco?", "About 3400 meters"}},
+			{id: "recipes", messages: []string{"A recipe for lima beans, please"}},
+		} {
+			createConversation(t, repo, conv.id, map[string]any{"topic": conv.id})
+			for j, content := range conv.messages {
+				msg := llm.Message{Role: llm.UserRole, Content: content, CreatedAt: start.Add(time.Duration(i*10+j) * time.Minute)}
+				if err := repo.AddMessage(context.Background(), conv.id, msg); err != nil {
+					t.Fatalf("AddMessage() error = %v", err)
+				}
+			}
+		}
+		return searcher
+	}
+
+	t.Run("Finds conversations newest match first", func(t *testing.T) {
+		searcher := seeded(t)
+
+		matches, err := searcher.SearchConversations(context.Background(), "lima", 0, 0)
+		if err != nil {
+			t.Fatalf("SearchConversations() error = %v", err)
+		}
+		if len(matches) != 2 {
+			t.Fatalf("SearchConversations() = %d matches, want 2: %+v", len(matches), matches)
+		}
+		for i, want := range []struct {
+			id      string
+			matches int
+			snippet string
+		}{
+			{id: "recipes", matches: 1, snippet: "A recipe for lima beans, please"},
+			{id: "lima", matches: 2, snippet: "Is LIMA warm in March?"},
+		} {
+			got := matches[i]
+			if got.Conversation.ID != want.id || got.Matches != want.matches || got.Snippet != want.snippet {
+				t.Errorf("match %d = %s with %d matches and snippet %q, want %s with %d and %q",
+					i, got.Conversation.ID, got.Matches, got.Snippet, want.id, want.matches, want.snippet)
+			}
+			if got.Conversation.Metadata["topic"] != want.id || len(got.Conversation.Messages) != 0 {
+				t.Errorf("match %d conversation = %+v, want its metadata without messages", i, got.Conversation)
+			}
+			if got.LastMatchAt.IsZero() {
+				t.Errorf("match %d LastMatchAt is zero", i)
+			}
+		}
+	})
+
+	t.Run("Pages through matches", func(t *testing.T) {
+		searcher := seeded(t)
+
+		page, err := searcher.SearchConversations(context.Background(), "lima", 1, 1)
+		if err != nil {
+			t.Fatalf("SearchConversations() error = %v", err)
+		}
+		if len(page) != 1 || page[0].Conversation.ID != "lima" {
+			t.Errorf("second page = %+v, want lima", page)
+		}
+		if rest, err := searcher.SearchConversations(context.Background(), "lima", 1, 2); err != nil || len(rest) != 0 {
+			t.Errorf("page past the matches = %+v, %v, want none", rest, err)
+		}
+	})
+
+	t.Run("No match", func(t *testing.T) {
+		searcher := seeded(t)
+
+		matches, err := searcher.SearchConversations(context.Background(), "quito", 10, 0)
+		if err != nil || len(matches) != 0 {
+			t.Errorf("SearchConversations() = %+v, %v, want no matches", matches, err)
+		}
+	})
+
+	t.Run("Wildcards match literally", func(t *testing.T) {
+		repo := newRepo(t)
+		searcher, ok := repo.(chathistory.ConversationSearcher)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.ConversationSearcher", repo)
+		}
+		for id, content := range map[string]string{"sale": `50% off today`, "discount": `500 off`, "path": `C:\temp`} {
+			createConversation(t, repo, id, nil)
+			if err := repo.AddMessage(context.Background(), id, llm.Message{Role: llm.UserRole, Content: content}); err != nil {
+				t.Fatalf("AddMessage() error = %v", err)
+			}
+		}
+
+		for query, want := range map[string][]string{`50%`: {"sale"}, `t_day`: nil, `:\`: {"path"}} {
+			matches, err := searcher.SearchConversations(context.Background(), query, 0, 0)
+			if err != nil {
+				t.Fatalf("SearchConversations(%q) error = %v", query, err)
+			}
+			var ids []string
+			for _, match := range matches {
+				ids = append(ids, match.Conversation.ID)
+			}
+			if !reflect.DeepEqual(ids, want) {
+				t.Errorf("SearchConversations(%q) = %v, want %v", query, ids, want)
+			}
+		}
+	})
+}
+
+// RunConversationExpirerConformance checks that a repository's
+// ConversationExpirer stores expiry times and purges expired conversations
+// with their messages. newRepo must return a chathistory.ConversationExpirer.
+func RunConversationExpirerConformance(t *testing.T, newRepo RepositoryFactory) {
+	// seeded holds an expired, a live and a non-expiring conversation
+	seeded := func(t *testing.T) (chathistory.ChatHistoryRepository, chathistory.ConversationExpirer) {
+		t.Helper()
+		repo := newRepo(t)
+		expirer, ok := repo.(chathistory.ConversationExpirer)
+		if !ok {
+			t.Fatalf("%T does not implement chathistory.ConversationExpirer", repo)
+		}
+		now := time.Now().Truncate(time.Second)
+		past, future := now.Add(-time.Hour), now.Add(time.Hour)
+		for _, conv := range []chathistory.Conversation{
+			{ID: "expired", CreatedAt: now, UpdatedAt: now, ExpiresAt: &past},
+			{ID: "live", CreatedAt: now, UpdatedAt: now, ExpiresAt: &future},
+			{ID: "forever", CreatedAt: now, UpdatedAt: now},
+		} {
+			if err := repo.CreateConversation(context.Background(), conv); err != nil {
+				t.Fatalf("CreateConversation(%s) error = %v", conv.ID, err)
+			}
+			addMessages(t, repo, conv.ID)
+		}
+		return repo, expirer
+	}
+
+	t.Run("Expiry is stored", func(t *testing.T) {
+		ctx := context.Background()
+		repo, expirer := seeded(t)
+
+		conv, err := repo.GetConversation(ctx, "live")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if conv.ExpiresAt == nil || !conv.ExpiresAt.Equal(conv.CreatedAt.Add(time.Hour)) {
+			t.Errorf("ExpiresAt = %v, want an hour after %v", conv.ExpiresAt, conv.CreatedAt)
+		}
+
+		if err := expirer.SetConversationExpiry(ctx, "live", nil); err != nil {
+			t.Fatalf("SetConversationExpiry() error = %v", err)
+		}
+		conv, err = repo.GetConversation(ctx, "live")
+		if err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+		if conv.ExpiresAt != nil {
+			t.Errorf("ExpiresAt = %v after clearing it, want nil", conv.ExpiresAt)
+		}
+	})
+
+	t.Run("Purges expired conversations", func(t *testing.T) {
+		ctx := context.Background()
+		repo, expirer := seeded(t)
+
+		purged, err := expirer.PurgeExpired(ctx, time.Now())
+		if err != nil {
+			t.Fatalf("PurgeExpired() error = %v", err)
+		}
+		if purged != 1 {
+			t.Errorf("PurgeExpired() = %d, want 1", purged)
+		}
+		conv, err := repo.GetConversation(ctx, "expired")
+		assertNotFound(t, conv, err)
+		if messages, err := repo.GetMessages(ctx, "expired", 0); err == nil && len(messages) > 0 {
+			t.Errorf("GetMessages() = %d messages of a purged conversation, want none", len(messages))
+		}
+
+		remaining, err := repo.ListConversations(ctx, chathistory.Filter{}, 10, 0)
+		if err != nil {
+			t.Fatalf("ListConversations() error = %v", err)
+		}
+		assertIDs(t, remaining, "forever", "live")
+
+		// Once the live conversation's expiry passes it is purged too
+		purged, err = expirer.PurgeExpired(ctx, time.Now().Add(2*time.Hour))
+		if err != nil || purged != 1 {
+			t.Errorf("PurgeExpired() = %d, %v, want 1", purged, err)
+		}
+	})
+
+	t.Run("Expire a conversation", func(t *testing.T) {
+		ctx := context.Background()
+		repo, expirer := seeded(t)
+
+		past := time.Now().Add(-time.Minute)
+		if err := expirer.SetConversationExpiry(ctx, "forever", &past); err != nil {
+			t.Fatalf("SetConversationExpiry() error = %v", err)
+		}
+		if purged, err := expirer.PurgeExpired(ctx, time.Now()); err != nil || purged != 2 {
+			t.Errorf("PurgeExpired() = %d, %v, want 2", purged, err)
+		}
+		conv, err := repo.GetConversation(ctx, "forever")
+		assertNotFound(t, conv, err)
+	})
+
+	t.Run("Unknown conversation", func(t *testing.T) {
+		_, expirer := seeded(t)
+		expiresAt := time.Now()
+		if err := expirer.SetConversationExpiry(context.Background(), "missing", &expiresAt); !errors.Is(err, chathistory.ErrConversationNotFound) {
+			t.Errorf("SetConversationExpiry() error = %v, want ErrConversationNotFound", err)
+		}
+	})
+}
+
+// RunExcludeExpiredConformance checks that a repository configured to hide
+// expired conversations leaves them out of reads before they are purged.
+// newRepo must return such a chathistory.ConversationExpirer.
+func RunExcludeExpiredConformance(t *testing.T, newRepo RepositoryFactory) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	createConversation(t, repo, "expired", nil)
+	createConversation(t, repo, "live", nil)
+	addMessages(t, repo, "expired")
+	addMessages(t, repo, "live")
+
+	expirer, ok := repo.(chathistory.ConversationExpirer)
+	if !ok {
+		t.Fatalf("%T does not implement chathistory.ConversationExpirer", repo)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := expirer.SetConversationExpiry(ctx, "expired", &past); err != nil {
+		t.Fatalf("SetConversationExpiry() error = %v", err)
+	}
+
+	conv, err := repo.GetConversation(ctx, "expired")
+	assertNotFound(t, conv, err)
+	if messages, err := repo.GetMessages(ctx, "expired", 0); err == nil && len(messages) > 0 {
+		t.Errorf("GetMessages() = %d messages of an expired conversation, want none", len(messages))
+	}
+	if messages, err := repo.GetMessagesByFilter(ctx, "expired", chathistory.Filter{Roles: []string{llm.UserRole}}, 0); err == nil && len(messages) > 0 {
+		t.Errorf("GetMessagesByFilter() = %d messages of an expired conversation, want none", len(messages))
+	}
+
+	listed, err := repo.ListConversations(ctx, chathistory.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListConversations() error = %v", err)
+	}
+	assertIDs(t, listed, "live")
+
+	live, err := repo.GetMessages(ctx, "live", 0)
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	assertContents(t, live, "hello", "hi there", "how are you", "fine")
+}
@@ -0,0 +1,135 @@
+package chathistory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// snippetRadius is how many characters MatchSnippet keeps on each side of
+// the match
+const snippetRadius = 60
+
+// SearchConversations returns the conversations with messages containing
+// query, ignoring case, newest match first, with how many messages match and
+// a snippet of the newest one. limit and offset page through the matches, a
+// limit of 0 or less returning all of them. An empty query matches nothing.
+//
+// Repositories implementing ConversationSearcher search themselves. Others
+// are asked about every conversation in turn, which reads the whole history.
+func (m *Memory) SearchConversations(ctx context.Context, query string, limit, offset int) ([]ConversationMatch, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	if searcher, ok := m.repo.(ConversationSearcher); ok {
+		return searcher.SearchConversations(ctx, query, limit, offset)
+	}
+
+	var matches []ConversationMatch
+	for listed := 0; ; listed += listPageSize {
+		conversations, err := m.repo.ListConversations(ctx, Filter{}, listPageSize, listed)
+		if err != nil {
+			return nil, err
+		}
+		for _, conv := range conversations {
+			match, ok, err := m.searchConversation(ctx, conv, query)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matches = append(matches, match)
+			}
+		}
+		if len(conversations) < listPageSize {
+			break
+		}
+	}
+
+	SortConversationMatches(matches)
+	if offset >= len(matches) {
+		return nil, nil
+	}
+	matches = matches[offset:]
+	if limit > 0 && limit < len(matches) {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// searchConversation counts the messages of conv containing query
+func (m *Memory) searchConversation(ctx context.Context, conv Conversation, query string) (ConversationMatch, bool, error) {
+	filter := Filter{Search: query}
+	count, err := m.repo.GetMessageCount(ctx, conv.ID, filter)
+	if err != nil || count == 0 {
+		return ConversationMatch{}, false, err
+	}
+	newest, err := m.repo.GetMessagesByFilter(ctx, conv.ID, filter, 1)
+	if err != nil || len(newest) == 0 {
+		return ConversationMatch{}, false, err
+	}
+
+	conv.Messages = nil
+	return ConversationMatch{
+		Conversation: conv,
+		Matches:      count,
+		Snippet:      MatchSnippet(newest[len(newest)-1].Content, query),
+		LastMatchAt:  newest[len(newest)-1].CreatedAt,
+	}, true, nil
+}
+
+// SortConversationMatches orders matches newest match first, then by
+// conversation ID, the order SearchConversations returns them in
+func SortConversationMatches(matches []ConversationMatch) {
+	slices.SortStableFunc(matches, func(a, b ConversationMatch) int {
+		if c := b.LastMatchAt.Compare(a.LastMatchAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Conversation.ID, b.Conversation.ID)
+	})
+}
+
+// MatchSnippet returns the text of content around the first occurrence of
+// query, ignoring case, with up to snippetRadius characters on each side. Ends cut from
+// content are marked with "…". Content without the query is returned from
+// its start.
+func MatchSnippet(content, query string) string {
+	text := []rune(content)
+	start := runeIndexFold(text, []rune(query))
+	end := start + len([]rune(query))
+	if start < 0 {
+		start, end = 0, 0
+	}
+
+	from := max(start-snippetRadius, 0)
+	to := min(end+snippetRadius, len(text))
+	snippet := strings.TrimSpace(string(text[from:to]))
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// runeIndexFold returns the index in text of the first occurrence of query,
+// ignoring case, or -1
+func runeIndexFold(text, query []rune) int {
+	if len(query) == 0 {
+		return -1
+	}
+	for i := 0; i+len(query) <= len(text); i++ {
+		matched := true
+		for j, r := range query {
+			if unicode.ToLower(text[i+j]) != unicode.ToLower(r) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+package chathistory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func TestMemory_SearchConversations(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeRepository()
+	start := time.Now().Add(-time.Hour)
+	for i, conv := range []struct {
+		id       string
+		messages []string
+	}{
+		{id: "lima", messages: []string{"I'm planning a trip to Lima", "Is LIMA warm in March?"}},
+		{id: "cusco", messages: []string{"How high is Cusco?"}},
+		{id: "recipes", messages: []string{"A recipe for lima beans, please"}},
+	} {
+		if err := repo.CreateConversation(ctx, Conversation{ID: conv.id}); err != nil {
+			t.Fatalf("CreateConversation() error = %v", err)
+		}
+		for j, content := range conv.messages {
+			msg := llm.Message{Role: llm.RoleUser, Content: content, CreatedAt: start.Add(time.Duration(i*10+j) * time.Minute)}
+			if err := repo.AddMessage(ctx, conv.id, msg); err != nil {
+				t.Fatalf("AddMessage() error = %v", err)
+			}
+		}
+	}
+	memory := New(repo)
+
+	matches, err := memory.SearchConversations(ctx, "lima", 0, 0)
+	if err != nil {
+		t.Fatalf("SearchConversations() error = %v", err)
+	}
+	if len(matches) != 2 || matches[0].Conversation.ID != "recipes" || matches[1].Conversation.ID != "lima" {
+		t.Fatalf("SearchConversations() = %+v, want recipes then lima", matches)
+	}
+	if matches[1].Matches != 2 || matches[1].Snippet != "Is LIMA warm in March?" || len(matches[1].Conversation.Messages) != 0 {
+		t.Errorf("lima match = %+v, want 2 matches, the newest as snippet and no messages", matches[1])
+	}
+
+	page, err := memory.SearchConversations(ctx, "lima", 1, 1)
+	if err != nil || len(page) != 1 || page[0].Conversation.ID != "lima" {
+		t.Errorf("second page = %+v, %v, want lima", page, err)
+	}
+	if empty, err := memory.SearchConversations(ctx, "  ", 0, 0); err != nil || empty != nil {
+		t.Errorf("SearchConversations() of a blank query = %+v, %v, want nothing", empty, err)
+	}
+}
+
+func TestMatchSnippet(t *testing.T) {
+	long := strings.Repeat("a", 100) + " Lima " + strings.Repeat("b", 100)
+
+	tests := []struct {
+		name    string
+		content string
+		query   string
+		want    string
+	}{
+		{name: "Short content", content: "A trip to Lima", query: "lima", want: "A trip to Lima"},
+		{name: "Both ends cut", content: long, query: "LIMA", want: "…" + strings.Repeat("a", 59) + " Lima " + strings.Repeat("b", 59) + "…"},
+		{name: "Multibyte runes", content: "¿Qué tal Líma?", query: "líma", want: "¿Qué tal Líma?"},
+		{name: "No match", content: strings.Repeat("c", 80), query: "lima", want: strings.Repeat("c", 60) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchSnippet(tt.content, tt.query); got != tt.want {
+				t.Errorf("MatchSnippet() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package chathistory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/llm/pricing"
+)
+
+// ModelMetadataKey is the message metadata key UsageSummary reads the model name from
+const ModelMetadataKey = "model"
+
+// UsageSummary aggregates the token usage recorded on a conversation's messages
+// with llm.Message.SetUsage. Messages without usage metadata are counted in
+// Messages but add no tokens.
+type UsageSummary struct {
+	ConversationID    string               `json:"conversation_id"`
+	Messages          int                  `json:"messages"`
+	MessagesWithUsage int                  `json:"messages_with_usage"`
+	Total             llm.Usage            `json:"total"`
+	ByRole            map[string]llm.Usage `json:"by_role,omitempty"`
+	ByModel           map[string]llm.Usage `json:"by_model,omitempty"` // Only messages with a model in their metadata
+
+	// EstimatedCost is the USD cost of the usage in ByModel, set when the Memory
+	// has a price table. Models without a price are listed in UnpricedModels.
+	EstimatedCost  *float64           `json:"estimated_cost,omitempty"`
+	CostByModel    map[string]float64 `json:"cost_by_model,omitempty"`
+	UnpricedModels []string           `json:"unpriced_models,omitempty"`
+}
+
+// NewUsageSummary returns an empty summary for a conversation
+func NewUsageSummary(conversationID string) *UsageSummary {
+	return &UsageSummary{
+		ConversationID: conversationID,
+		ByRole:         make(map[string]llm.Usage),
+		ByModel:        make(map[string]llm.Usage),
+	}
+}
+
+// AddMessage adds the usage recorded on msg to the summary
+func (s *UsageSummary) AddMessage(msg llm.Message) {
+	s.Messages++
+
+	usage := msg.GetUsage()
+	if usage == nil {
+		return
+	}
+
+	model, _ := msg.Metadata[ModelMetadataKey].(string)
+	s.MessagesWithUsage++
+	s.Add(msg.Role, model, *usage)
+}
+
+// Add adds usage to the totals for role and model without changing the message
+// counts. An empty model is left out of ByModel.
+func (s *UsageSummary) Add(role, model string, usage llm.Usage) {
+	s.Total = addUsage(s.Total, usage)
+	s.ByRole[role] = addUsage(s.ByRole[role], usage)
+	if model != "" {
+		s.ByModel[model] = addUsage(s.ByModel[model], usage)
+	}
+}
+
+// EstimateCost prices the usage of each model in ByModel with table. Usage of
+// messages without a model can't be priced and is left out.
+func (s *UsageSummary) EstimateCost(table *pricing.Table) {
+	models := make([]string, 0, len(s.ByModel))
+	for model := range s.ByModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	var total float64
+	s.CostByModel = make(map[string]float64, len(models))
+	s.UnpricedModels = nil
+	for _, model := range models {
+		cost, err := table.EstimateChatCost(model, s.ByModel[model])
+		if err != nil {
+			s.UnpricedModels = append(s.UnpricedModels, model)
+			continue
+		}
+		s.CostByModel[model] = cost
+		total += cost
+	}
+	s.EstimatedCost = &total
+}
+
+func addUsage(a, b llm.Usage) llm.Usage {
+	return llm.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// ConversationUsage pairs a conversation with its usage summary for reporting
+type ConversationUsage struct {
+	Conversation Conversation  `json:"conversation"`
+	Usage        *UsageSummary `json:"usage"`
+}
+
+// GetUsageSummary sums the token usage of the conversation's messages matching filter,
+// broken down by role and by model, and its estimated cost when a price table
+// is configured. Repositories implementing UsageAggregator compute
+// it themselves, others have their messages loaded and summed in memory.
+func (m *Memory) GetUsageSummary(ctx context.Context, conversationID string, filter Filter) (*UsageSummary, error) {
+	summary, err := m.usageSummary(ctx, conversationID, filter)
+	if err != nil {
+		return nil, err
+	}
+	if m.Opts.PriceTable != nil {
+		summary.EstimateCost(m.Opts.PriceTable)
+	}
+	return summary, nil
+}
+
+func (m *Memory) usageSummary(ctx context.Context, conversationID string, filter Filter) (*UsageSummary, error) {
+	if aggregator, ok := m.repo.(UsageAggregator); ok {
+		return aggregator.GetUsageSummary(ctx, conversationID, filter)
+	}
+
+	count, err := m.repo.GetMessageCount(ctx, conversationID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := NewUsageSummary(conversationID)
+	if count == 0 {
+		return summary, nil
+	}
+
+	messages, err := m.repo.GetMessagesByFilter(ctx, conversationID, filter, count)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		summary.AddMessage(msg)
+	}
+	return summary, nil
+}
+
+// ListConversationsWithUsage lists conversations like ListConversations and attaches
+// the usage summary of all their messages
+func (m *Memory) ListConversationsWithUsage(ctx context.Context, filter Filter, limit, offset int) ([]ConversationUsage, error) {
+	conversations, err := m.repo.ListConversations(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ConversationUsage, 0, len(conversations))
+	for _, conv := range conversations {
+		summary, err := m.GetUsageSummary(ctx, conv.ID, Filter{})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, ConversationUsage{Conversation: conv, Usage: summary})
+	}
+	return results, nil
+}
@@ -0,0 +1,39 @@
+package chathistory
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/llm/pricing"
+)
+
+func TestUsageSummary_EstimateCost(t *testing.T) {
+	summary := NewUsageSummary("conv-1")
+
+	priced := llm.Message{Role: llm.AssistantRole, Metadata: map[string]any{ModelMetadataKey: "gpt-4o"}}
+	priced.SetUsage(&llm.Usage{PromptTokens: 1000, CompletionTokens: 1000, TotalTokens: 2000})
+	unpriced := llm.Message{Role: llm.AssistantRole, Metadata: map[string]any{ModelMetadataKey: "mystery-model"}}
+	unpriced.SetUsage(&llm.Usage{PromptTokens: 10, TotalTokens: 10})
+	noModel := llm.Message{Role: llm.AssistantRole}
+	noModel.SetUsage(&llm.Usage{PromptTokens: 10, TotalTokens: 10})
+
+	for _, msg := range []llm.Message{priced, unpriced, noModel, {Role: llm.UserRole, Content: "no usage"}} {
+		summary.AddMessage(msg)
+	}
+	summary.EstimateCost(&pricing.Table{})
+
+	want := 0.0025 + 0.01
+	if summary.EstimatedCost == nil || math.Abs(*summary.EstimatedCost-want) > 1e-9 {
+		t.Fatalf("EstimatedCost = %v, want %v", summary.EstimatedCost, want)
+	}
+	if len(summary.CostByModel) != 1 {
+		t.Errorf("CostByModel = %v, want only gpt-4o", summary.CostByModel)
+	}
+	if len(summary.UnpricedModels) != 1 || summary.UnpricedModels[0] != "mystery-model" {
+		t.Errorf("UnpricedModels = %v, want [mystery-model]", summary.UnpricedModels)
+	}
+	if summary.Messages != 4 || summary.MessagesWithUsage != 3 {
+		t.Errorf("Messages = %d, MessagesWithUsage = %d, want 4 and 3", summary.Messages, summary.MessagesWithUsage)
+	}
+}
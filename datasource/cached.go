@@ -0,0 +1,225 @@
+package datasource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+// DefaultCachePrefix is the key prefix a CachedSource stores content under
+// unless set with WithCachePrefix
+const DefaultCachePrefix = "datasource-cache/"
+
+// CachedOption is a function type to modify CachedSource
+type CachedOption func(*CachedSource)
+
+// WithCachePrefix sets the key prefix cached content is stored under, so
+// several cached sources can share a store
+func WithCachePrefix(prefix string) CachedOption {
+	return func(c *CachedSource) {
+		c.prefix = prefix
+	}
+}
+
+// CachedSource wraps a data source, keeping the content of the documents it
+// streams in a storage.DataStore. Content is keyed by the document's source and
+// version, its "etag" metadata or else its "last_modified", so a document the
+// inner source reports unchanged is replayed from the cache instead of fetched
+// again.
+//
+// Only inner sources that implement ContentStreamer can list documents without
+// fetching them, so other sources and documents without a version are streamed
+// as usual. Entries for older versions stay in the cache until removed, e.g.
+// with DeletePrefix.
+//
+// CachedSource doesn't implement ContentStreamer itself, so kb.Sync reads
+// content through Stream, where the cache applies.
+type CachedSource struct {
+	inner  DataSource
+	cache  storage.DataStore
+	prefix string
+}
+
+// Cached returns inner with its content cached in cache
+func Cached(inner DataSource, cache storage.DataStore, opts ...CachedOption) *CachedSource {
+	c := &CachedSource{
+		inner:  inner,
+		cache:  cache,
+		prefix: DefaultCachePrefix,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *CachedSource) Load(ctx context.Context, opts ...Option) ([]Document, error) {
+	var documents []Document
+
+	docChan, errChan := c.Stream(ctx, opts...)
+	for doc := range docChan {
+		documents = append(documents, doc)
+	}
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func (c *CachedSource) Stream(ctx context.Context, opts ...Option) (<-chan Document, <-chan error) {
+	options := &LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	streamer, ok := c.inner.(ContentStreamer)
+	if !ok || options.SkipContent {
+		return c.inner.Stream(ctx, opts...)
+	}
+
+	docChan := make(chan Document, options.StreamBuffer)
+	errChan := make(chan error, 1)
+
+	inner := append(append([]Option(nil), opts...), WithSkipContent(true))
+	docs, errs := c.inner.Stream(ctx, inner...)
+
+	go func() {
+		defer close(docChan)
+		defer close(errChan)
+
+		for {
+			select {
+			case doc, ok := <-docs:
+				if !ok {
+					// An error sent before the inner source closed its channel
+					select {
+					case err, ok := <-errs:
+						if ok && err != nil {
+							errChan <- err
+						}
+					default:
+					}
+					return
+				}
+
+				content, err := c.content(ctx, streamer, doc)
+				if err != nil {
+					errChan <- err
+					return
+				}
+				doc.Content = content
+
+				select {
+				case docChan <- doc:
+				case <-ctx.Done():
+					errChan <- ctx.Err()
+					return
+				}
+			case err, ok := <-errs:
+				if ok && err != nil {
+					errChan <- err
+					return
+				}
+				if !ok {
+					errs = nil
+				}
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// content returns the document's content from the cache, fetching and caching
+// it on a miss
+func (c *CachedSource) content(ctx context.Context, streamer ContentStreamer, doc Document) (string, error) {
+	version := cacheVersion(doc.Metadata)
+	if version == "" {
+		return c.fetch(ctx, streamer, doc.Source)
+	}
+
+	key := c.key(doc.Source, version)
+	body, err := c.cache.Get(ctx, key)
+	if err == nil {
+		defer body.Close()
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return "", c.wrapError(err, "failed to read cached content of "+doc.Source)
+		}
+		return string(content), nil
+	}
+	var storageErr *storage.StorageError
+	if !errors.As(err, &storageErr) || storageErr.Code != storage.ErrCodeNotFound {
+		return "", c.wrapError(err, "failed to get cached content of "+doc.Source)
+	}
+
+	content, err := c.fetch(ctx, streamer, doc.Source)
+	if err != nil {
+		return "", err
+	}
+	if err := c.cache.Put(ctx, key, strings.NewReader(content)); err != nil {
+		return "", c.wrapError(err, "failed to cache content of "+doc.Source)
+	}
+	return content, nil
+}
+
+func (c *CachedSource) fetch(ctx context.Context, streamer ContentStreamer, source string) (string, error) {
+	body, err := streamer.StreamContent(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", c.wrapError(err, "failed to read content of "+source)
+	}
+	return string(content), nil
+}
+
+// key is the cache key of a version of a source. Sources are hashed since
+// they may be URLs or contain characters stores don't allow in keys.
+func (c *CachedSource) key(source, version string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + version))
+	return c.prefix + hex.EncodeToString(sum[:])
+}
+
+func (c *CachedSource) wrapError(err error, message string) error {
+	return &DataSourceError{
+		Source:  "cache",
+		Op:      "Stream",
+		Err:     err,
+		Code:    ErrCodeInternal,
+		Message: message,
+	}
+}
+
+// cacheVersion identifies the version of a document from its metadata, or
+// returns "" if the source reports none
+func cacheVersion(metadata map[string]interface{}) string {
+	if etag, ok := metadata["etag"].(string); ok && etag != "" {
+		return "etag:" + etag
+	}
+	switch modified := metadata["last_modified"].(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if modified.IsZero() {
+			return ""
+		}
+		return "modified:" + modified.UTC().Format(time.RFC3339Nano)
+	default:
+		return "modified:" + fmt.Sprint(modified)
+	}
+}
@@ -0,0 +1,118 @@
+package datasource
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+// countingStore counts the objects fetched from a store
+type countingStore struct {
+	storage.DataStore
+	mu   sync.Mutex
+	gets []string
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	s.gets = append(s.gets, key)
+	s.mu.Unlock()
+	return s.DataStore.Get(ctx, key)
+}
+
+func (s *countingStore) fetched() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gets := s.gets
+	s.gets = nil
+	sort.Strings(gets)
+	return gets
+}
+
+func loadContents(t *testing.T, source DataSource) map[string]string {
+	t.Helper()
+	docs, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	contents := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		contents[doc.Source] = doc.Content
+	}
+	return contents
+}
+
+func TestCachedSource_SkipsUnchangedDocuments(t *testing.T) {
+	ctx := context.Background()
+	objects := &countingStore{DataStore: newTestDataStore(t)}
+	source := Cached(NewDataStoreSource(objects, "docs/"), inmemory.NewInMemoryDataStore())
+
+	want := map[string]string{"docs/a.txt": "alpha", "docs/b.md": "bravo"}
+	if got := loadContents(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("first Load() = %v, want %v", got, want)
+	}
+	if got := objects.fetched(); len(got) != 2 {
+		t.Errorf("first Load() fetched %v, want both objects", got)
+	}
+
+	// Unchanged documents are replayed from the cache
+	if got := loadContents(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("second Load() = %v, want %v", got, want)
+	}
+	if got := objects.fetched(); len(got) != 0 {
+		t.Errorf("second Load() fetched %v, want nothing", got)
+	}
+
+	// Only the modified document is fetched again
+	if err := objects.Put(ctx, "docs/a.txt", strings.NewReader("alpha v2")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	want["docs/a.txt"] = "alpha v2"
+	if got := loadContents(t, source); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() after a change = %v, want %v", got, want)
+	}
+	if got := objects.fetched(); len(got) != 1 || got[0] != "docs/a.txt" {
+		t.Errorf("Load() after a change fetched %v, want only docs/a.txt", got)
+	}
+}
+
+func TestCachedSource_PassesThrough(t *testing.T) {
+	objects := &countingStore{DataStore: newTestDataStore(t)}
+	source := Cached(NewDataStoreSource(objects, "docs/"), inmemory.NewInMemoryDataStore())
+
+	docs, err := source.Load(context.Background(), WithSkipContent(true))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for _, doc := range docs {
+		if doc.Content != "" {
+			t.Errorf("content of %s = %q with SkipContent, want none", doc.Source, doc.Content)
+		}
+	}
+	if got := objects.fetched(); len(got) != 0 {
+		t.Errorf("Load() with SkipContent fetched %v, want nothing", got)
+	}
+}
+
+func TestCachedSource_ForwardsErrors(t *testing.T) {
+	source := Cached(NewDataStoreSource(&failingListStore{}, "docs/"), inmemory.NewInMemoryDataStore())
+	if _, err := source.Load(context.Background()); err == nil {
+		t.Error("Load() error = nil, want the inner source's error")
+	}
+}
+
+// failingListStore fails every List
+type failingListStore struct {
+	storage.DataStore
+}
+
+func (failingListStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	return nil, storage.NewStorageError("List", prefix, nil, storage.ErrCodeInternal, "unavailable")
+}
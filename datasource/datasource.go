@@ -1,6 +1,9 @@
 package datasource
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 // Document represents a document from a data source
 type Document struct {
@@ -17,3 +20,10 @@ type DataSource interface {
 	// Stream processes documents one at a time through the channel
 	Stream(ctx context.Context, opts ...Option) (<-chan Document, <-chan error)
 }
+
+// ContentStreamer is an optional capability for data sources that can open a
+// document's content as a stream instead of buffering it into Document.Content
+type ContentStreamer interface {
+	// StreamContent opens the content of the document identified by source
+	StreamContent(ctx context.Context, source string) (io.ReadCloser, error)
+}
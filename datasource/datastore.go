@@ -0,0 +1,225 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+// ContentExtractor turns the raw bytes of a stored object into document text.
+// Extractors handling several formats choose one from info.ContentType or the
+// extension of info.Key, which are the same whether the object is read by
+// Stream or StreamContent.
+type ContentExtractor func(info storage.ObjectInfo, r io.Reader) (string, error)
+
+// DataStoreSourceOption is a function type to modify DataStoreSource
+type DataStoreSourceOption func(*DataStoreSource)
+
+// WithContentExtractor sets how object content is turned into text.
+// By default objects are read as plain text.
+func WithContentExtractor(extractor ContentExtractor) DataStoreSourceOption {
+	return func(s *DataStoreSource) {
+		s.extractor = extractor
+	}
+}
+
+// DataStoreSource loads documents from any storage.DataStore.
+// Document sources are the object keys.
+type DataStoreSource struct {
+	store     storage.DataStore
+	prefix    string
+	extractor ContentExtractor
+}
+
+// NewDataStoreSource creates a data source for the objects under prefix in store
+func NewDataStoreSource(store storage.DataStore, prefix string, opts ...DataStoreSourceOption) *DataStoreSource {
+	s := &DataStoreSource{
+		store:  store,
+		prefix: prefix,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *DataStoreSource) Load(ctx context.Context, opts ...Option) ([]Document, error) {
+	var documents []Document
+
+	docChan, errChan := s.Stream(ctx, opts...)
+	for doc := range docChan {
+		documents = append(documents, doc)
+	}
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func (s *DataStoreSource) Stream(ctx context.Context, opts ...Option) (<-chan Document, <-chan error) {
+	options := &LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	docChan := make(chan Document, options.StreamBuffer)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(docChan)
+		defer close(errChan)
+
+		objects, err := s.store.List(ctx, s.prefix)
+		if err != nil {
+			errChan <- s.wrapError("Stream", err, "failed to list objects")
+			return
+		}
+
+		count := 0
+		for _, obj := range objects {
+			if options.MaxItems > 0 && count >= options.MaxItems {
+				return
+			}
+
+			if !options.Recursive && strings.Contains(strings.TrimPrefix(obj.Key, s.prefix), "/") {
+				continue
+			}
+
+			metadata := map[string]interface{}{
+				"key":           obj.Key,
+				"last_modified": obj.LastModified,
+				"size":          obj.Size,
+				"etag":          obj.ETag,
+			}
+			if obj.ContentType != "" {
+				metadata["content_type"] = obj.ContentType
+			}
+
+			options.ApplyStaticMetadata(metadata)
+
+			if options.Filter != nil && !options.Filter(metadata) {
+				continue
+			}
+
+			var content string
+			if !options.SkipContent {
+				content, err = s.readContent(ctx, "Stream", obj)
+				if err != nil {
+					errChan <- err
+					return
+				}
+			}
+
+			doc := Document{
+				Content:  content,
+				Metadata: metadata,
+				Source:   obj.Key,
+			}
+
+			select {
+			case docChan <- doc:
+				count++
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// StreamContent opens the object behind a document source. Objects are streamed
+// as-is unless a content extractor is set, in which case the extracted text is returned.
+func (s *DataStoreSource) StreamContent(ctx context.Context, source string) (io.ReadCloser, error) {
+	if s.extractor == nil {
+		body, err := s.store.Get(ctx, source)
+		if err != nil {
+			return nil, s.wrapError("StreamContent", err, "failed to get object")
+		}
+		return body, nil
+	}
+
+	info, err := s.objectInfo(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.readContent(ctx, "StreamContent", info)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+// objectInfo returns the listed ObjectInfo of key, so the extractor sees its
+// content type. Keys that aren't listed only get their key, leaving Get to
+// report them missing.
+func (s *DataStoreSource) objectInfo(ctx context.Context, key string) (storage.ObjectInfo, error) {
+	objects, err := s.store.List(ctx, key)
+	if err != nil {
+		return storage.ObjectInfo{}, s.wrapError("StreamContent", err, "failed to list object")
+	}
+	for _, obj := range objects {
+		if obj.Key == key {
+			return obj, nil
+		}
+	}
+	return storage.ObjectInfo{Key: key}, nil
+}
+
+func (s *DataStoreSource) readContent(ctx context.Context, op string, obj storage.ObjectInfo) (string, error) {
+	body, err := s.store.Get(ctx, obj.Key)
+	if err != nil {
+		return "", s.wrapError(op, err, "failed to get object")
+	}
+	defer body.Close()
+
+	if s.extractor != nil {
+		content, err := s.extractor(obj, body)
+		if err != nil {
+			return "", &DataSourceError{
+				Source:  "datastore",
+				Op:      op,
+				Err:     err,
+				Code:    ErrCodeInvalidFormat,
+				Message: "failed to extract content of " + obj.Key,
+			}
+		}
+		return content, nil
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", s.wrapError(op, err, "failed to read object content")
+	}
+	return string(content), nil
+}
+
+// wrapError converts a storage error into a DataSourceError with a matching code
+func (s *DataStoreSource) wrapError(op string, err error, message string) error {
+	code := ErrCodeInternal
+
+	var storageErr *storage.StorageError
+	if errors.As(err, &storageErr) {
+		switch storageErr.Code {
+		case storage.ErrCodeNotFound:
+			code = ErrCodeNotFound
+		case storage.ErrCodePermissionDenied, storage.ErrCodeUnauthenticated:
+			code = ErrCodeAccessDenied
+		case storage.ErrCodeInvalidArgument:
+			code = ErrCodeInvalidSource
+		}
+	}
+
+	return &DataSourceError{
+		Source:  "datastore",
+		Op:      op,
+		Err:     err,
+		Code:    code,
+		Message: message,
+	}
+}
@@ -0,0 +1,191 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+func newTestDataStore(t *testing.T) storage.DataStore {
+	t.Helper()
+
+	store := inmemory.NewInMemoryDataStore()
+	for key, content := range map[string]string{
+		"docs/a.txt":        "alpha",
+		"docs/b.md":         "bravo",
+		"docs/nested/c.txt": "charlie",
+		"other/d.txt":       "delta",
+	} {
+		if err := store.Put(context.Background(), key, strings.NewReader(content)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	return store
+}
+
+func TestDataStoreSource_Load(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantKeys []string
+	}{
+		{
+			name:     "Direct children only",
+			wantKeys: []string{"docs/a.txt", "docs/b.md"},
+		},
+		{
+			name:     "Recursive",
+			opts:     []Option{WithRecursive(true)},
+			wantKeys: []string{"docs/a.txt", "docs/b.md", "docs/nested/c.txt"},
+		},
+		{
+			name:     "Max items",
+			opts:     []Option{WithRecursive(true), WithMaxItems(1)},
+			wantKeys: []string{"docs/a.txt"},
+		},
+		{
+			name: "Filter",
+			opts: []Option{WithRecursive(true), WithFilter(func(metadata map[string]interface{}) bool {
+				return strings.HasSuffix(metadata["key"].(string), ".txt")
+			})},
+			wantKeys: []string{"docs/a.txt", "docs/nested/c.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewDataStoreSource(newTestDataStore(t), "docs/")
+
+			docs, err := source.Load(context.Background(), tt.opts...)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			var keys []string
+			for _, doc := range docs {
+				keys = append(keys, doc.Source)
+				if doc.Content == "" {
+					t.Errorf("document %s has no content", doc.Source)
+				}
+				if doc.Metadata["etag"] == "" || doc.Metadata["last_modified"] == nil {
+					t.Errorf("document %s is missing change detection metadata: %v", doc.Source, doc.Metadata)
+				}
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("Load() sources = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestDataStoreSource_ContentExtractor(t *testing.T) {
+	source := NewDataStoreSource(newTestDataStore(t), "docs/",
+		WithContentExtractor(func(info storage.ObjectInfo, r io.Reader) (string, error) {
+			if strings.HasSuffix(info.Key, ".md") {
+				return "", errors.New("unsupported format")
+			}
+			content, err := io.ReadAll(r)
+			return strings.ToUpper(string(content)), err
+		}),
+	)
+
+	body, err := source.StreamContent(context.Background(), "docs/a.txt")
+	if err != nil {
+		t.Fatalf("StreamContent() error = %v", err)
+	}
+	content, _ := io.ReadAll(body)
+	if string(content) != "ALPHA" {
+		t.Errorf("StreamContent() = %q, want %q", content, "ALPHA")
+	}
+
+	_, err = source.Load(context.Background())
+	var dsErr *DataSourceError
+	if !errors.As(err, &dsErr) || dsErr.Code != ErrCodeInvalidFormat {
+		t.Errorf("Load() error = %v, want %s", err, ErrCodeInvalidFormat)
+	}
+}
+
+func TestDataStoreSource_ContentExtractorSeesContentType(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewInMemoryDataStore()
+	if err := store.Put(ctx, "docs/page", strings.NewReader("<p>hi</p>"), storage.WithContentType("text/html")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	var contentTypes []string
+	source := NewDataStoreSource(store, "docs/",
+		WithContentExtractor(func(info storage.ObjectInfo, r io.Reader) (string, error) {
+			contentTypes = append(contentTypes, info.ContentType)
+			content, err := io.ReadAll(r)
+			return string(content), err
+		}),
+	)
+
+	if _, err := source.Load(ctx); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	body, err := source.StreamContent(ctx, "docs/page")
+	if err != nil {
+		t.Fatalf("StreamContent() error = %v", err)
+	}
+	body.Close()
+	if len(contentTypes) != 2 || contentTypes[0] != "text/html" || contentTypes[1] != "text/html" {
+		t.Errorf("extractor content types = %v, want text/html from Load and StreamContent", contentTypes)
+	}
+}
+
+func TestDataStoreSource_StreamContentNotFound(t *testing.T) {
+	source := NewDataStoreSource(newTestDataStore(t), "docs/")
+
+	_, err := source.StreamContent(context.Background(), "docs/missing.txt")
+	var dsErr *DataSourceError
+	if !errors.As(err, &dsErr) || dsErr.Code != ErrCodeNotFound {
+		t.Errorf("StreamContent() error = %v, want %s", err, ErrCodeNotFound)
+	}
+}
+
+func TestDataStoreSource_StaticMetadata(t *testing.T) {
+	static := map[string]interface{}{"team": "docs", "key": "static"}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantKeys bool
+	}{
+		{name: "Source keys take precedence", opts: []Option{WithStaticMetadata(static)}, wantKeys: true},
+		{name: "Override", opts: []Option{WithStaticMetadata(static), WithStaticMetadataOverride(true)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := NewDataStoreSource(newTestDataStore(t), "docs/")
+
+			// Filters see the static metadata
+			opts := append(tt.opts, WithFilter(func(metadata map[string]interface{}) bool {
+				return metadata["team"] == "docs"
+			}))
+			docChan, errChan := source.Stream(context.Background(), opts...)
+
+			count := 0
+			for doc := range docChan {
+				count++
+				if doc.Metadata["team"] != "docs" {
+					t.Errorf("document %s metadata = %v, want team docs", doc.Source, doc.Metadata)
+				}
+				if got := doc.Metadata["key"] == doc.Source; got != tt.wantKeys {
+					t.Errorf("document %s key = %v, want source key %v", doc.Source, doc.Metadata["key"], tt.wantKeys)
+				}
+			}
+			if err := <-errChan; err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if count != 2 {
+				t.Errorf("Stream() = %d documents, want 2", count)
+			}
+		})
+	}
+}
@@ -8,6 +8,26 @@ type LoadOptions struct {
 	Filter func(metadata map[string]interface{}) bool
 	// MaxItems is the maximum number of items to load (0 for no limit)
 	MaxItems int
+	// SkipContent leaves Document.Content empty so it can be read later with StreamContent
+	SkipContent bool
+	// StaticMetadata is added to the metadata of every document
+	StaticMetadata map[string]interface{}
+	// StaticMetadataOverride makes StaticMetadata replace metadata the source
+	// sets under the same keys, instead of only filling in missing keys
+	StaticMetadataOverride bool
+	// StreamBuffer is how many documents Stream fetches ahead of the consumer
+	StreamBuffer int
+}
+
+// ApplyStaticMetadata merges StaticMetadata into the metadata of a document.
+// Sources call it as they build each document, before Filter sees it.
+func (o *LoadOptions) ApplyStaticMetadata(metadata map[string]interface{}) {
+	for k, v := range o.StaticMetadata {
+		if _, exists := metadata[k]; exists && !o.StaticMetadataOverride {
+			continue
+		}
+		metadata[k] = v
+	}
 }
 
 // Option is a function type to modify LoadOptions
@@ -33,3 +53,38 @@ func WithMaxItems(max int) Option {
 		o.MaxItems = max
 	}
 }
+
+// WithSkipContent sets whether to skip reading document content
+func WithSkipContent(skip bool) Option {
+	return func(o *LoadOptions) {
+		o.SkipContent = skip
+	}
+}
+
+// WithStaticMetadata adds metadata to every document, such as a team or
+// collection name. Keys set by the source take precedence unless
+// WithStaticMetadataOverride is set.
+func WithStaticMetadata(metadata map[string]interface{}) Option {
+	return func(o *LoadOptions) {
+		o.StaticMetadata = metadata
+	}
+}
+
+// WithStaticMetadataOverride sets whether static metadata replaces metadata
+// the source sets under the same keys
+func WithStaticMetadataOverride(override bool) Option {
+	return func(o *LoadOptions) {
+		o.StaticMetadataOverride = override
+	}
+}
+
+// WithStreamBuffer makes Stream fetch up to n documents ahead of its
+// consumer, buffering them in the document channel, so fetching overlaps
+// with slow processing such as embedding. By default the channel is
+// unbuffered and the next document is only fetched once the last one was
+// received.
+func WithStreamBuffer(n int) Option {
+	return func(o *LoadOptions) {
+		o.StreamBuffer = max(n, 0)
+	}
+}
@@ -1,23 +1,70 @@
 package document
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
+
+// Tokenizer counts the tokens a model sees in text
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// TokenizerFunc adapts a function to a Tokenizer
+type TokenizerFunc func(text string) int
+
+// CountTokens returns f(text)
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
 
 type CharacterSplitter struct {
 	ChunkSize    int
 	ChunkOverlap int
 	Separator    string
+	// Tokenizer, when set, makes ChunkSize and ChunkOverlap count tokens instead of bytes
+	Tokenizer Tokenizer
+	// SeparatorRegex, when set, splits text on its matches instead of on
+	// Separator. Parts are still joined with Separator.
+	SeparatorRegex *regexp.Regexp
 }
 
-func NewCharacterSplitter(chunkSize int, chunkOverlap int, separator string) *CharacterSplitter {
+// CharacterSplitterOption is a function type to modify a CharacterSplitter
+type CharacterSplitterOption func(*CharacterSplitter)
+
+// WithChunkSizeByTokens measures chunk size and overlap in tokens counted by
+// tokenizer. Text is still only split on the separator, so a single part larger
+// than the chunk size becomes a chunk of its own.
+func WithChunkSizeByTokens(tokenizer Tokenizer) CharacterSplitterOption {
+	return func(cs *CharacterSplitter) {
+		cs.Tokenizer = tokenizer
+	}
+}
+
+// WithSeparatorRegex splits text on every match of re, such as `\n{2,}` for
+// paragraphs separated by any number of blank lines. Chunks join their parts
+// with the splitter's separator, so variable separators come out normalized.
+// SplitText fails for a regex that matches the empty string.
+func WithSeparatorRegex(re *regexp.Regexp) CharacterSplitterOption {
+	return func(cs *CharacterSplitter) {
+		cs.SeparatorRegex = re
+	}
+}
+
+func NewCharacterSplitter(chunkSize int, chunkOverlap int, separator string, opts ...CharacterSplitterOption) *CharacterSplitter {
 	if separator == "" {
 		separator = " "
 	}
 
-	return &CharacterSplitter{
+	cs := &CharacterSplitter{
 		ChunkSize:    chunkSize,
 		ChunkOverlap: chunkOverlap,
 		Separator:    separator,
 	}
+	for _, opt := range opts {
+		opt(cs)
+	}
+	return cs
 }
 
 func (cs *CharacterSplitter) SplitText(text string) ([]string, error) {
@@ -25,7 +72,14 @@ func (cs *CharacterSplitter) SplitText(text string) ([]string, error) {
 		return nil, nil
 	}
 
-	parts := strings.Split(text, cs.Separator)
+	parts, err := cs.parts(text)
+	if err != nil {
+		return nil, err
+	}
+	if cs.Tokenizer != nil {
+		return cs.splitByTokens(parts), nil
+	}
+
 	var chunks []string
 	currentChunk := strings.Builder{}
 
@@ -59,3 +113,62 @@ func (cs *CharacterSplitter) SplitText(text string) ([]string, error) {
 
 	return chunks, nil
 }
+
+// parts splits text on SeparatorRegex when set, and on Separator otherwise
+func (cs *CharacterSplitter) parts(text string) ([]string, error) {
+	if cs.SeparatorRegex == nil {
+		return strings.Split(text, cs.Separator), nil
+	}
+	// A regex matching nothing would split between every character
+	if cs.SeparatorRegex.MatchString("") {
+		return nil, &SplitterError{
+			Op:      "split_text",
+			Message: "separator regex " + cs.SeparatorRegex.String() + " matches the empty string",
+		}
+	}
+	return cs.SeparatorRegex.Split(text, -1), nil
+}
+
+// splitByTokens groups separator-delimited parts into chunks of at most
+// ChunkSize tokens. Overlap is made of whole trailing parts of the previous
+// chunk totalling at most ChunkOverlap tokens.
+func (cs *CharacterSplitter) splitByTokens(parts []string) []string {
+	var chunks []string
+	var current []string
+
+	for _, part := range parts {
+		if len(current) > 0 && cs.countTokens(append(current, part)) > cs.ChunkSize {
+			chunks = append(chunks, strings.TrimSpace(strings.Join(current, cs.Separator)))
+			current = cs.overlapParts(current, part)
+		}
+		current = append(current, part)
+	}
+
+	if len(current) > 0 {
+		chunks = append(chunks, strings.TrimSpace(strings.Join(current, cs.Separator)))
+	}
+
+	return chunks
+}
+
+// overlapParts returns the longest run of trailing parts of chunk that fits in
+// ChunkOverlap tokens and still leaves room for next
+func (cs *CharacterSplitter) overlapParts(chunk []string, next string) []string {
+	if cs.ChunkOverlap <= 0 {
+		return nil
+	}
+
+	start := len(chunk)
+	for start > 0 {
+		tail := chunk[start-1:]
+		if cs.countTokens(tail) > cs.ChunkOverlap || cs.countTokens(append(tail[:len(tail):len(tail)], next)) > cs.ChunkSize {
+			break
+		}
+		start--
+	}
+	return append([]string(nil), chunk[start:]...)
+}
+
+func (cs *CharacterSplitter) countTokens(parts []string) int {
+	return cs.Tokenizer.CountTokens(strings.Join(parts, cs.Separator))
+}
@@ -0,0 +1,153 @@
+package document
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// wordTokenizer counts whitespace separated words as tokens
+var wordTokenizer = TokenizerFunc(func(text string) int {
+	return len(strings.Fields(text))
+})
+
+func TestCharacterSplitter_ChunkSizeByTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenizer Tokenizer
+		size      int
+		overlap   int
+		separator string
+		text      string
+		want      []string
+	}{
+		{
+			name:      "Chunks fill the token budget",
+			tokenizer: wordTokenizer,
+			size:      3,
+			separator: " ",
+			text:      "one two three four five six seven",
+			want:      []string{"one two three", "four five six", "seven"},
+		},
+		{
+			name:      "Overlap is made of whole parts",
+			tokenizer: wordTokenizer,
+			size:      4,
+			overlap:   2,
+			separator: " ",
+			text:      "a b c d e f g h",
+			want:      []string{"a b c d", "c d e f", "e f g h"},
+		},
+		{
+			name:      "Oversized part is kept whole",
+			tokenizer: wordTokenizer,
+			size:      2,
+			separator: "\n",
+			text:      "short line\na much longer line here\nend",
+			want:      []string{"short line", "a much longer line here", "end"},
+		},
+		{
+			name:      "Non-English text is measured by tokens not bytes",
+			tokenizer: TokenizerFunc(utf8.RuneCountInString),
+			size:      8,
+			separator: "。",
+			text:      "今日は。晴れです。明日は雨。",
+			want:      []string{"今日は。晴れです", "明日は雨。"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splitter := NewCharacterSplitter(tt.size, tt.overlap, tt.separator, WithChunkSizeByTokens(tt.tokenizer))
+			got, err := splitter.SplitText(tt.text)
+			if err != nil {
+				t.Fatalf("SplitText() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCharacterSplitter_ChunksRespectTokenBudget(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog ", 50)
+	splitter := NewCharacterSplitter(16, 4, " ", WithChunkSizeByTokens(wordTokenizer))
+
+	chunks, err := splitter.SplitText(text)
+	if err != nil {
+		t.Fatalf("SplitText() error = %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("SplitText() returned %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if tokens := wordTokenizer.CountTokens(chunk); tokens > 16 {
+			t.Errorf("chunk %d has %d tokens, want at most 16", i, tokens)
+		}
+	}
+	if got := strings.Fields(chunks[0]); len(got) != 16 {
+		t.Errorf("first chunk has %d tokens, want a full budget of 16", len(got))
+	}
+}
+
+func TestCharacterSplitter_SeparatorRegex(t *testing.T) {
+	text := "First paragraph.\n\nSecond one.\n\n\n\nThird,\nwith a line break.\n\n\nFourth."
+	paragraphs := regexp.MustCompile(`\n{2,}`)
+
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		opts    []CharacterSplitterOption
+		want    []string
+	}{
+		{
+			name: "One paragraph per chunk",
+			size: 20,
+			want: []string{"First paragraph.", "Second one.", "Third,\nwith a line break.", "Fourth."},
+		},
+		{
+			name: "Paragraphs joined with the separator",
+			size: 30,
+			want: []string{"First paragraph.\n\nSecond one.", "Third,\nwith a line break.", "Fourth."},
+		},
+		{
+			name:    "Overlap",
+			size:    30,
+			overlap: 11,
+			want:    []string{"First paragraph.\n\nSecond one.", "Second one.\n\nThird,\nwith a line break.", "line break.\n\nFourth."},
+		},
+		{
+			name: "By tokens",
+			size: 4,
+			opts: []CharacterSplitterOption{WithChunkSizeByTokens(wordTokenizer)},
+			want: []string{"First paragraph.\n\nSecond one.", "Third,\nwith a line break.", "Fourth."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]CharacterSplitterOption{WithSeparatorRegex(paragraphs)}, tt.opts...)
+			got, err := NewCharacterSplitter(tt.size, tt.overlap, "\n\n", opts...).SplitText(text)
+			if err != nil {
+				t.Fatalf("SplitText() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCharacterSplitter_SeparatorRegexMatchingEmpty(t *testing.T) {
+	splitter := NewCharacterSplitter(10, 0, " ", WithSeparatorRegex(regexp.MustCompile(`\s*`)))
+	_, err := splitter.SplitText("a b c")
+	var splitErr *SplitterError
+	if !errors.As(err, &splitErr) {
+		t.Errorf("SplitText() error = %v, want a *SplitterError", err)
+	}
+}
@@ -16,9 +16,31 @@ func (e *SplitterError) Error() string {
 	return fmt.Sprintf("splitter.%s: %s", e.Op, e.Message)
 }
 
+func (e *SplitterError) Unwrap() error {
+	return e.Err
+}
+
 var (
 	ErrMetadataTextMismatch = &SplitterError{
 		Op:      "split_documents",
 		Message: "number of texts and metadata entries must match",
 	}
 )
+
+// TokenizerError represents errors that can occur loading a tokenizer
+type TokenizerError struct {
+	Op      string
+	Message string
+	Err     error
+}
+
+func (e *TokenizerError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("tokenizer.%s: %s: %v", e.Op, e.Message, e.Err)
+	}
+	return fmt.Sprintf("tokenizer.%s: %s", e.Op, e.Message)
+}
+
+func (e *TokenizerError) Unwrap() error {
+	return e.Err
+}
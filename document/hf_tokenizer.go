@@ -0,0 +1,1006 @@
+package document
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// HFTokenizer is a TokenEncoder loaded from a HuggingFace tokenizer.json, for
+// counting and splitting text by the tokens of models that don't use tiktoken,
+// such as Llama and Mistral. It supports BPE and Unigram models with the
+// normalizers, pre-tokenizers and decoders those models use; loading a file
+// that uses others fails rather than miscounting.
+//
+// Encode doesn't add the special tokens of the file's post-processor, such as
+// a beginning-of-sequence token, and Decode skips special tokens. Added tokens
+// are matched in the text before normalization.
+type HFTokenizer struct {
+	model         hfTokenModel
+	normalizers   []func(string) string
+	preTokenizers []hfPreTokenizer
+	decoders      []func([]string) []string
+
+	tokens  map[int]string // Token of every ID, added tokens included
+	special map[int]bool
+	added   map[string]int
+	addedRe *regexp.Regexp // Matches any added token, longest first
+}
+
+// hfTokenModel turns a pre-tokenized word into token IDs
+type hfTokenModel interface {
+	tokenize(word string) []int
+}
+
+// hfPreTokenizer splits normalized text into words. first is set for the text
+// before any added token.
+type hfPreTokenizer func(words []string, first bool) []string
+
+// LoadHFTokenizer reads a HuggingFace tokenizer.json file
+func LoadHFTokenizer(path string) (*HFTokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &TokenizerError{
+			Op:      "load_hf_tokenizer",
+			Message: "failed to open tokenizer file",
+			Err:     err,
+		}
+	}
+	defer f.Close()
+	return NewHFTokenizer(f)
+}
+
+// NewHFTokenizer reads a HuggingFace tokenizer.json from r
+func NewHFTokenizer(r io.Reader) (*HFTokenizer, error) {
+	var file hfFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, &TokenizerError{
+			Op:      "new_hf_tokenizer",
+			Message: "invalid tokenizer.json",
+			Err:     err,
+		}
+	}
+
+	t := &HFTokenizer{
+		tokens:  make(map[int]string),
+		special: make(map[int]bool),
+		added:   make(map[string]int),
+	}
+
+	var err error
+	if t.model, err = t.loadModel(file.Model); err != nil {
+		return nil, err
+	}
+	if file.Normalizer != nil {
+		if t.normalizers, err = loadNormalizer(*file.Normalizer); err != nil {
+			return nil, err
+		}
+	}
+	if file.PreTokenizer != nil {
+		if t.preTokenizers, err = loadPreTokenizer(*file.PreTokenizer); err != nil {
+			return nil, err
+		}
+	}
+	if file.Decoder != nil {
+		if t.decoders, err = loadDecoder(*file.Decoder); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(file.AddedTokens) > 0 {
+		contents := make([]string, 0, len(file.AddedTokens))
+		for _, token := range file.AddedTokens {
+			if token.Content == "" {
+				continue
+			}
+			t.tokens[token.ID] = token.Content
+			t.added[token.Content] = token.ID
+			t.special[token.ID] = token.Special
+			contents = append(contents, regexp.QuoteMeta(token.Content))
+		}
+		// Go's regexp prefers the first alternative, so longer tokens go first
+		sort.SliceStable(contents, func(i, j int) bool {
+			return len(contents[i]) > len(contents[j])
+		})
+		if len(contents) > 0 {
+			t.addedRe = regexp.MustCompile(strings.Join(contents, "|"))
+		}
+	}
+
+	return t, nil
+}
+
+// Encode returns the token IDs of text
+func (t *HFTokenizer) Encode(text string) []int {
+	var ids []int
+	first := true
+	encode := func(segment string) {
+		if segment == "" {
+			return
+		}
+		for _, normalize := range t.normalizers {
+			segment = normalize(segment)
+		}
+		words := []string{segment}
+		for _, preTokenize := range t.preTokenizers {
+			words = preTokenize(words, first)
+		}
+		for _, word := range words {
+			if word != "" {
+				ids = append(ids, t.model.tokenize(word)...)
+			}
+		}
+	}
+
+	if t.addedRe != nil {
+		start := 0
+		for _, match := range t.addedRe.FindAllStringIndex(text, -1) {
+			encode(text[start:match[0]])
+			ids = append(ids, t.added[text[match[0]:match[1]]])
+			first = false
+			start = match[1]
+		}
+		text = text[start:]
+	}
+	encode(text)
+
+	return ids
+}
+
+// Decode returns the text of tokens, skipping special tokens
+func (t *HFTokenizer) Decode(tokens []int) string {
+	words := make([]string, 0, len(tokens))
+	for _, id := range tokens {
+		if token, ok := t.tokens[id]; ok && !t.special[id] {
+			words = append(words, token)
+		}
+	}
+	for _, decode := range t.decoders {
+		words = decode(words)
+	}
+	return strings.Join(words, "")
+}
+
+// CountTokens returns the number of tokens in text
+func (t *HFTokenizer) CountTokens(text string) int {
+	return len(t.Encode(text))
+}
+
+// hfFile is the part of tokenizer.json the tokenizer is built from
+type hfFile struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+		Special bool   `json:"special"`
+	} `json:"added_tokens"`
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Decoder      *hfComponent `json:"decoder"`
+	Model        hfModel      `json:"model"`
+}
+
+// hfComponent is a normalizer, pre-tokenizer or decoder
+type hfComponent struct {
+	Type          string        `json:"type"`
+	Normalizers   []hfComponent `json:"normalizers"`
+	PreTokenizers []hfComponent `json:"pretokenizers"`
+	Decoders      []hfComponent `json:"decoders"`
+
+	Pattern struct {
+		String *string `json:"String"`
+		Regex  *string `json:"Regex"`
+	} `json:"pattern"`
+	Content          string `json:"content"`
+	Prepend          string `json:"prepend"`
+	Behavior         string `json:"behavior"`
+	Invert           bool   `json:"invert"`
+	AddPrefixSpace   *bool  `json:"add_prefix_space"`
+	UseRegex         *bool  `json:"use_regex"`
+	Replacement      string `json:"replacement"`
+	PrependScheme    string `json:"prepend_scheme"`
+	Split            *bool  `json:"split"`
+	IndividualDigits bool   `json:"individual_digits"`
+	StripLeft        bool   `json:"strip_left"`
+	StripRight       bool   `json:"strip_right"`
+	Start            int    `json:"start"`
+	Stop             int    `json:"stop"`
+}
+
+type hfModel struct {
+	Type                    string          `json:"type"`
+	Vocab                   json.RawMessage `json:"vocab"`
+	Merges                  json.RawMessage `json:"merges"`
+	UnkToken                *string         `json:"unk_token"`
+	UnkID                   *int            `json:"unk_id"`
+	ByteFallback            bool            `json:"byte_fallback"`
+	FuseUnk                 bool            `json:"fuse_unk"`
+	IgnoreMerges            bool            `json:"ignore_merges"`
+	ContinuingSubwordPrefix *string         `json:"continuing_subword_prefix"`
+	EndOfWordSuffix         *string         `json:"end_of_word_suffix"`
+}
+
+// unsupported returns the error for a component the tokenizer can't run
+func unsupported(kind, name string) error {
+	return &TokenizerError{
+		Op:      "new_hf_tokenizer",
+		Message: fmt.Sprintf("unsupported %s %q", kind, name),
+	}
+}
+
+func (t *HFTokenizer) loadModel(model hfModel) (hfTokenModel, error) {
+	modelType := model.Type
+	if modelType == "" && len(model.Merges) > 0 {
+		modelType = "BPE"
+	}
+
+	switch modelType {
+	case "BPE":
+		if (model.ContinuingSubwordPrefix != nil && *model.ContinuingSubwordPrefix != "") ||
+			(model.EndOfWordSuffix != nil && *model.EndOfWordSuffix != "") {
+			return nil, unsupported("BPE option", "continuing_subword_prefix/end_of_word_suffix")
+		}
+		bpe := &hfBPE{
+			unk:          -1,
+			byteFallback: model.ByteFallback,
+			fuseUnk:      model.FuseUnk,
+			ignoreMerges: model.IgnoreMerges,
+		}
+		if err := json.Unmarshal(model.Vocab, &bpe.vocab); err != nil {
+			return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "invalid BPE vocab", Err: err}
+		}
+		merges, err := parseMerges(model.Merges)
+		if err != nil {
+			return nil, err
+		}
+		bpe.ranks = make(map[[2]string]int, len(merges))
+		for rank, merge := range merges {
+			if _, ok := bpe.ranks[merge]; !ok {
+				bpe.ranks[merge] = rank
+			}
+		}
+		if model.UnkToken != nil {
+			if id, ok := bpe.vocab[*model.UnkToken]; ok {
+				bpe.unk = id
+			}
+		}
+		for token, id := range bpe.vocab {
+			t.tokens[id] = token
+		}
+		return bpe, nil
+
+	case "Unigram":
+		var vocab []unigramPiece
+		if err := json.Unmarshal(model.Vocab, &vocab); err != nil {
+			return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "invalid Unigram vocab", Err: err}
+		}
+
+		unigram := &hfUnigram{
+			vocab:        make(map[string]int, len(vocab)),
+			scores:       make([]float64, len(vocab)),
+			unk:          -1,
+			byteFallback: model.ByteFallback,
+		}
+		minScore := math.Inf(1)
+		for id, piece := range vocab {
+			unigram.vocab[piece.Token] = id
+			unigram.scores[id] = piece.Score
+			unigram.maxLen = max(unigram.maxLen, len(piece.Token))
+			minScore = min(minScore, piece.Score)
+			t.tokens[id] = piece.Token
+		}
+		// Like sentencepiece, unknown characters score below every piece
+		unigram.unkScore = minScore - 10
+		if model.UnkID != nil {
+			unigram.unk = *model.UnkID
+		}
+		return unigram, nil
+	}
+
+	return nil, unsupported("model", modelType)
+}
+
+// unigramPiece is a [token, score] entry of a Unigram vocab
+type unigramPiece struct {
+	Token string
+	Score float64
+}
+
+func (p *unigramPiece) UnmarshalJSON(data []byte) error {
+	var entry [2]json.RawMessage
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(entry[0], &p.Token); err != nil {
+		return err
+	}
+	return json.Unmarshal(entry[1], &p.Score)
+}
+
+// parseMerges reads BPE merges written as "a b" strings or as ["a", "b"] pairs
+func parseMerges(raw json.RawMessage) ([][2]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var pairs [][2]string
+	if err := json.Unmarshal(raw, &pairs); err == nil {
+		return pairs, nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "invalid BPE merges", Err: err}
+	}
+	pairs = make([][2]string, 0, len(lines))
+	for _, line := range lines {
+		left, right, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: fmt.Sprintf("invalid BPE merge %q", line)}
+		}
+		pairs = append(pairs, [2]string{left, right})
+	}
+	return pairs, nil
+}
+
+func loadNormalizer(c hfComponent) ([]func(string) string, error) {
+	switch c.Type {
+	case "Sequence":
+		var normalizers []func(string) string
+		for _, inner := range c.Normalizers {
+			loaded, err := loadNormalizer(inner)
+			if err != nil {
+				return nil, err
+			}
+			normalizers = append(normalizers, loaded...)
+		}
+		return normalizers, nil
+	case "Prepend":
+		return []func(string) string{func(s string) string {
+			if s == "" {
+				return s
+			}
+			return c.Prepend + s
+		}}, nil
+	case "Replace":
+		replace, err := replacer(c)
+		if err != nil {
+			return nil, err
+		}
+		return []func(string) string{replace}, nil
+	case "Lowercase":
+		return []func(string) string{strings.ToLower}, nil
+	case "Strip":
+		return []func(string) string{func(s string) string {
+			if c.StripLeft {
+				s = strings.TrimLeft(s, " \t\n\r\v\f")
+			}
+			if c.StripRight {
+				s = strings.TrimRight(s, " \t\n\r\v\f")
+			}
+			return s
+		}}, nil
+	case "NFC":
+		return []func(string) string{norm.NFC.String}, nil
+	case "NFD":
+		return []func(string) string{norm.NFD.String}, nil
+	case "NFKC", "Precompiled":
+		// Precompiled holds sentencepiece's character map, which is NFKC in
+		// the models that ship one
+		return []func(string) string{norm.NFKC.String}, nil
+	case "NFKD":
+		return []func(string) string{norm.NFKD.String}, nil
+	}
+	return nil, unsupported("normalizer", c.Type)
+}
+
+// replacer returns the replacement of a Replace normalizer or decoder
+func replacer(c hfComponent) (func(string) string, error) {
+	switch {
+	case c.Pattern.String != nil:
+		pattern := *c.Pattern.String
+		return func(s string) string {
+			return strings.ReplaceAll(s, pattern, c.Content)
+		}, nil
+	case c.Pattern.Regex != nil:
+		re, err := regexp.Compile(*c.Pattern.Regex)
+		if err != nil {
+			return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "unsupported Replace pattern", Err: err}
+		}
+		return func(s string) string {
+			return re.ReplaceAllLiteralString(s, c.Content)
+		}, nil
+	}
+	return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "Replace without a pattern"}
+}
+
+// gpt2Pattern is the pattern the ByteLevel pre-tokenizer splits words with
+const gpt2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+func loadPreTokenizer(c hfComponent) ([]hfPreTokenizer, error) {
+	switch c.Type {
+	case "Sequence":
+		var preTokenizers []hfPreTokenizer
+		for _, inner := range c.PreTokenizers {
+			loaded, err := loadPreTokenizer(inner)
+			if err != nil {
+				return nil, err
+			}
+			preTokenizers = append(preTokenizers, loaded...)
+		}
+		return preTokenizers, nil
+
+	case "ByteLevel":
+		addPrefixSpace := c.AddPrefixSpace != nil && *c.AddPrefixSpace
+		var split *splitPattern
+		if c.UseRegex == nil || *c.UseRegex {
+			var err error
+			if split, err = compileSplitPattern(gpt2Pattern); err != nil {
+				return nil, err
+			}
+		}
+		return []hfPreTokenizer{func(words []string, first bool) []string {
+			var out []string
+			for _, word := range words {
+				if addPrefixSpace && !strings.HasPrefix(word, " ") {
+					word = " " + word
+				}
+				pieces := []string{word}
+				if split != nil {
+					pieces = split.split(word, "Isolated")
+				}
+				for _, piece := range pieces {
+					out = append(out, byteLevelEncode(piece))
+				}
+			}
+			return out
+		}}, nil
+
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		scheme := c.PrependScheme
+		if scheme == "" {
+			scheme = "always"
+			if c.AddPrefixSpace != nil && !*c.AddPrefixSpace {
+				scheme = "never"
+			}
+		}
+		split := c.Split == nil || *c.Split
+		return []hfPreTokenizer{func(words []string, first bool) []string {
+			var out []string
+			for i, word := range words {
+				word = strings.ReplaceAll(word, " ", replacement)
+				prepend := scheme == "always" || (scheme == "first" && first && i == 0)
+				if prepend && !strings.HasPrefix(word, replacement) {
+					word = replacement + word
+				}
+				if !split {
+					out = append(out, word)
+					continue
+				}
+				out = append(out, splitBefore(word, replacement)...)
+			}
+			return out
+		}}, nil
+
+	case "Split":
+		if c.Invert {
+			return nil, unsupported("Split option", "invert")
+		}
+		var split *splitPattern
+		var err error
+		switch {
+		case c.Pattern.String != nil:
+			split, err = compileSplitPattern(regexp.QuoteMeta(*c.Pattern.String))
+		case c.Pattern.Regex != nil:
+			split, err = compileSplitPattern(*c.Pattern.Regex)
+		default:
+			err = &TokenizerError{Op: "new_hf_tokenizer", Message: "Split without a pattern"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch c.Behavior {
+		case "Isolated", "Removed", "MergedWithPrevious", "MergedWithNext", "Contiguous":
+		default:
+			return nil, unsupported("Split behavior", c.Behavior)
+		}
+		return []hfPreTokenizer{func(words []string, first bool) []string {
+			var out []string
+			for _, word := range words {
+				out = append(out, split.split(word, c.Behavior)...)
+			}
+			return out
+		}}, nil
+
+	case "Digits":
+		pattern := `\p{N}+`
+		if c.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		split, err := compileSplitPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return []hfPreTokenizer{func(words []string, first bool) []string {
+			var out []string
+			for _, word := range words {
+				out = append(out, split.split(word, "Isolated")...)
+			}
+			return out
+		}}, nil
+
+	case "WhitespaceSplit":
+		return []hfPreTokenizer{func(words []string, first bool) []string {
+			var out []string
+			for _, word := range words {
+				out = append(out, strings.Fields(word)...)
+			}
+			return out
+		}}, nil
+	}
+	return nil, unsupported("pre-tokenizer", c.Type)
+}
+
+// splitBefore splits s before every occurrence of sep
+func splitBefore(s, sep string) []string {
+	var out []string
+	for s != "" {
+		skip := len(sep)
+		if !strings.HasPrefix(s, sep) {
+			_, skip = utf8.DecodeRuneInString(s)
+		}
+		i := strings.Index(s[skip:], sep)
+		if i < 0 {
+			break
+		}
+		out = append(out, s[:skip+i])
+		s = s[skip+i:]
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// lookaheadWhitespace is the alternative of the GPT-2 style patterns that Go's
+// regexp, lacking lookaheads, can't compile
+const lookaheadWhitespace = `\s+(?!\S)`
+
+// splitPattern is a pre-tokenizer pattern compiled for Go's regexp
+type splitPattern struct {
+	re *regexp.Regexp
+	// ws is the group standing in for \s+(?!\S), or 0
+	ws int
+}
+
+// compileSplitPattern compiles pattern, emulating \s+(?!\S): matched as a
+// plain whitespace run, which then gives its last character up to the word
+// that follows
+func compileSplitPattern(pattern string) (*splitPattern, error) {
+	rewritten := strings.Replace(pattern, lookaheadWhitespace, `(?P<lookahead_ws>\s+)`, 1)
+	re, err := regexp.Compile(rewritten)
+	if err != nil {
+		return nil, &TokenizerError{Op: "new_hf_tokenizer", Message: "unsupported pre-tokenizer pattern", Err: err}
+	}
+	split := &splitPattern{re: re}
+	if rewritten != pattern {
+		split.ws = re.SubexpIndex("lookahead_ws")
+	}
+	return split, nil
+}
+
+// matches returns the start and end of every match of the pattern in s
+func (p *splitPattern) matches(s string) [][2]int {
+	var out [][2]int
+	for pos := 0; pos < len(s); {
+		loc := p.re.FindStringSubmatchIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if p.ws > 0 && loc[2*p.ws] >= 0 && end < len(s) {
+			if _, size := utf8.DecodeLastRuneInString(s[start:end]); end-size > start {
+				end -= size
+			}
+		}
+		if end == start {
+			_, size := utf8.DecodeRuneInString(s[start:])
+			pos = start + size
+			continue
+		}
+		out = append(out, [2]int{start, end})
+		pos = end
+	}
+	return out
+}
+
+// split splits s on the pattern's matches with one of the behaviors of the
+// Split pre-tokenizer
+func (p *splitPattern) split(s, behavior string) []string {
+	var out []string
+	add := func(piece string) {
+		if piece != "" {
+			out = append(out, piece)
+		}
+	}
+
+	prev := 0
+	pending := "" // Match waiting to be merged with the next piece
+	for _, m := range p.matches(s) {
+		gap, match := s[prev:m[0]], s[m[0]:m[1]]
+		prev = m[1]
+		switch behavior {
+		case "Isolated":
+			add(gap)
+			add(match)
+		case "Removed":
+			add(gap)
+		case "MergedWithPrevious":
+			add(gap + match)
+		case "MergedWithNext":
+			add(pending + gap)
+			pending = match
+		case "Contiguous":
+			// With no gap, the last piece is the previous match
+			if gap == "" && len(out) > 0 {
+				out[len(out)-1] += match
+			} else {
+				add(gap)
+				add(match)
+			}
+		}
+	}
+	add(pending + s[prev:])
+	return out
+}
+
+// byteToRune maps every byte to the printable character the ByteLevel
+// pre-tokenizer represents it with, as GPT-2's bytes_to_unicode does
+var byteToRune, runeToByte = byteLevelTables()
+
+func byteLevelTables() ([256]rune, map[rune]byte) {
+	var toRune [256]rune
+	toByte := make(map[rune]byte, 256)
+	next := rune(256)
+	for b := 0; b < 256; b++ {
+		printable := (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+		r := rune(b)
+		if !printable {
+			r = next
+			next++
+		}
+		toRune[b] = r
+		toByte[r] = byte(b)
+	}
+	return toRune, toByte
+}
+
+func byteLevelEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(byteToRune[s[i]])
+	}
+	return sb.String()
+}
+
+func loadDecoder(c hfComponent) ([]func([]string) []string, error) {
+	switch c.Type {
+	case "Sequence":
+		var decoders []func([]string) []string
+		for _, inner := range c.Decoders {
+			loaded, err := loadDecoder(inner)
+			if err != nil {
+				return nil, err
+			}
+			decoders = append(decoders, loaded...)
+		}
+		return decoders, nil
+
+	case "ByteLevel":
+		return []func([]string) []string{func(tokens []string) []string {
+			var bytes []byte
+			for _, token := range tokens {
+				for _, r := range token {
+					if b, ok := runeToByte[r]; ok {
+						bytes = append(bytes, b)
+					} else {
+						bytes = utf8.AppendRune(bytes, r)
+					}
+				}
+			}
+			return []string{strings.ToValidUTF8(string(bytes), "�")}
+		}}, nil
+
+	case "Replace":
+		replace, err := replacer(c)
+		if err != nil {
+			return nil, err
+		}
+		return []func([]string) []string{func(tokens []string) []string {
+			for i, token := range tokens {
+				tokens[i] = replace(token)
+			}
+			return tokens
+		}}, nil
+
+	case "ByteFallback":
+		return []func([]string) []string{decodeByteFallback}, nil
+
+	case "Fuse":
+		return []func([]string) []string{func(tokens []string) []string {
+			return []string{strings.Join(tokens, "")}
+		}}, nil
+
+	case "Strip":
+		content := c.Content
+		return []func([]string) []string{func(tokens []string) []string {
+			for i, token := range tokens {
+				for n := 0; n < c.Start && strings.HasPrefix(token, content); n++ {
+					token = token[len(content):]
+				}
+				for n := 0; n < c.Stop && strings.HasSuffix(token, content); n++ {
+					token = token[:len(token)-len(content)]
+				}
+				tokens[i] = token
+			}
+			return tokens
+		}}, nil
+
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		stripFirst := c.PrependScheme != "never" && (c.AddPrefixSpace == nil || *c.AddPrefixSpace)
+		return []func([]string) []string{func(tokens []string) []string {
+			for i, token := range tokens {
+				token = strings.ReplaceAll(token, replacement, " ")
+				if i == 0 && stripFirst {
+					token = strings.TrimPrefix(token, " ")
+				}
+				tokens[i] = token
+			}
+			return tokens
+		}}, nil
+	}
+	return nil, unsupported("decoder", c.Type)
+}
+
+// decodeByteFallback turns runs of <0xXX> tokens back into the text of their bytes
+func decodeByteFallback(tokens []string) []string {
+	var out []string
+	var bytes []byte
+	flush := func() {
+		if len(bytes) == 0 {
+			return
+		}
+		if utf8.Valid(bytes) {
+			out = append(out, string(bytes))
+		} else {
+			out = append(out, strings.Repeat("�", len(bytes)))
+		}
+		bytes = bytes[:0]
+	}
+	for _, token := range tokens {
+		if b, ok := fallbackByte(token); ok {
+			bytes = append(bytes, b)
+			continue
+		}
+		flush()
+		out = append(out, token)
+	}
+	flush()
+	return out
+}
+
+// fallbackByte parses a byte fallback token such as <0x0A>
+func fallbackByte(token string) (byte, bool) {
+	var b byte
+	if len(token) != 6 || !strings.HasPrefix(token, "<0x") || token[5] != '>' {
+		return 0, false
+	}
+	if _, err := fmt.Sscanf(token[3:5], "%02X", &b); err != nil {
+		return 0, false
+	}
+	return b, true
+}
+
+func fallbackToken(b byte) string {
+	return fmt.Sprintf("<0x%02X>", b)
+}
+
+// hfBPE is a byte-pair encoding model
+type hfBPE struct {
+	vocab        map[string]int
+	ranks        map[[2]string]int
+	unk          int
+	byteFallback bool
+	fuseUnk      bool
+	ignoreMerges bool
+}
+
+func (m *hfBPE) tokenize(word string) []int {
+	if id, ok := m.vocab[word]; ok && m.ignoreMerges {
+		return []int{id}
+	}
+
+	// Characters missing from the vocab become their bytes, which never merge
+	symbols := make([]string, 0, len(word))
+	for _, r := range word {
+		symbol := string(r)
+		if _, ok := m.vocab[symbol]; !ok && m.byteFallback {
+			if bytes := m.fallback(symbol); bytes != nil {
+				symbols = append(symbols, bytes...)
+				continue
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	// Merge the lowest ranked pair until no pair can be merged
+	for len(symbols) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+1 < len(symbols); i++ {
+			if rank, ok := m.ranks[[2]string{symbols[i], symbols[i+1]}]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		pair := [2]string{symbols[best], symbols[best+1]}
+		merged := symbols[:best]
+		for i := best; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == pair[0] && symbols[i+1] == pair[1] {
+				merged = append(merged, pair[0]+pair[1])
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+
+	ids := make([]int, 0, len(symbols))
+	lastUnk := false
+	for _, symbol := range symbols {
+		if id, ok := m.vocab[symbol]; ok {
+			ids = append(ids, id)
+			lastUnk = false
+			continue
+		}
+		if m.unk < 0 || (m.fuseUnk && lastUnk) {
+			continue
+		}
+		ids = append(ids, m.unk)
+		lastUnk = true
+	}
+	return ids
+}
+
+// fallback returns the byte tokens of symbol, or nil if the vocab lacks any
+func (m *hfBPE) fallback(symbol string) []string {
+	tokens := make([]string, 0, len(symbol))
+	for i := 0; i < len(symbol); i++ {
+		token := fallbackToken(symbol[i])
+		if _, ok := m.vocab[token]; !ok {
+			return nil
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// hfUnigram is a unigram language model, segmenting words into the pieces
+// with the highest total score
+type hfUnigram struct {
+	vocab        map[string]int
+	scores       []float64
+	unk          int
+	unkScore     float64
+	byteFallback bool
+	maxLen       int // Longest piece in bytes
+}
+
+func (m *hfUnigram) tokenize(word string) []int {
+	// best[i] is the best segmentation of word[:i], ending with a piece
+	// starting at from[i]; -1 pieces are unknown characters
+	type node struct {
+		score float64
+		from  int
+		id    int
+		set   bool
+	}
+	best := make([]node, len(word)+1)
+	best[0].set = true
+
+	for start := 0; start < len(word); {
+		_, size := utf8.DecodeRuneInString(word[start:])
+		if best[start].set {
+			covered := false
+			for end := start + size; end <= len(word) && end-start <= m.maxLen; {
+				if id, ok := m.vocab[word[start:end]]; ok {
+					score := best[start].score + m.scores[id]
+					if !best[end].set || score > best[end].score {
+						best[end] = node{score: score, from: start, id: id, set: true}
+					}
+					if end == start+size {
+						covered = true
+					}
+				}
+				if end == len(word) {
+					break
+				}
+				_, next := utf8.DecodeRuneInString(word[end:])
+				end += next
+			}
+			if !covered {
+				end := start + size
+				score := best[start].score + m.unkScore
+				if !best[end].set || score > best[end].score {
+					best[end] = node{score: score, from: start, id: -1, set: true}
+				}
+			}
+		}
+		start += size
+	}
+
+	// Pieces are collected from the end of the word
+	var pieces []node
+	for end := len(word); end > 0; end = best[end].from {
+		pieces = append(pieces, best[end])
+	}
+
+	var ids []int
+	lastUnk := false
+	for i := len(pieces) - 1; i >= 0; i-- {
+		piece := pieces[i]
+		if piece.id >= 0 {
+			ids = append(ids, piece.id)
+			lastUnk = false
+			continue
+		}
+
+		end := len(word)
+		if i > 0 {
+			end = pieces[i-1].from
+		}
+		if m.byteFallback {
+			if bytes, ok := m.fallback(word[piece.from:end]); ok {
+				ids = append(ids, bytes...)
+				lastUnk = false
+				continue
+			}
+		}
+		// Like sentencepiece, runs of unknown characters are one unknown token
+		if m.unk >= 0 && !lastUnk {
+			ids = append(ids, m.unk)
+		}
+		lastUnk = true
+	}
+	return ids
+}
+
+// fallback returns the IDs of the byte tokens of s
+func (m *hfUnigram) fallback(s string) ([]int, bool) {
+	ids := make([]int, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		id, ok := m.vocab[fallbackToken(s[i])]
+		if !ok {
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
@@ -0,0 +1,226 @@
+package document
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// llamaTokenizer is a tokenizer.json in the style of Llama 2 and Mistral:
+// sentencepiece BPE with byte fallback
+const llamaTokenizer = `{
+  "added_tokens": [
+    {"id": 0, "content": "<unk>", "special": true},
+    {"id": 1, "content": "<s>", "special": true},
+    {"id": 2, "content": "</s>", "special": true}
+  ],
+  "normalizer": {"type": "Sequence", "normalizers": [
+    {"type": "Prepend", "prepend": "▁"},
+    {"type": "Replace", "pattern": {"String": " "}, "content": "▁"}
+  ]},
+  "pre_tokenizer": null,
+  "post_processor": {"type": "TemplateProcessing"},
+  "decoder": {"type": "Sequence", "decoders": [
+    {"type": "Replace", "pattern": {"String": "▁"}, "content": " "},
+    {"type": "ByteFallback"},
+    {"type": "Fuse"},
+    {"type": "Strip", "content": " ", "start": 1, "stop": 0}
+  ]},
+  "model": {
+    "type": "BPE",
+    "unk_token": "<unk>",
+    "fuse_unk": true,
+    "byte_fallback": true,
+    "vocab": {
+      "<unk>": 0, "<s>": 1, "</s>": 2,
+      "<0xF0>": 3, "<0x9F>": 4, "<0x98>": 5, "<0x80>": 6,
+      "▁": 7, "h": 8, "e": 9, "l": 10, "o": 11, "w": 12, "r": 13, "d": 14,
+      "▁h": 15, "ll": 16, "▁he": 17, "▁hell": 18, "▁hello": 19,
+      "▁w": 20, "or": 21, "▁wor": 22, "ld": 23, "▁world": 24
+    },
+    "merges": ["▁ h", "l l", "▁h e", "▁he ll", "▁hell o", "▁ w", "o r", "▁w or", "l d", "▁wor ld"]
+  }
+}`
+
+func loadTokenizer(t *testing.T, tokenizerJSON string) *HFTokenizer {
+	t.Helper()
+	tokenizer, err := NewHFTokenizer(strings.NewReader(tokenizerJSON))
+	if err != nil {
+		t.Fatalf("NewHFTokenizer() error = %v", err)
+	}
+	return tokenizer
+}
+
+func TestHFTokenizer_SentencePieceBPE(t *testing.T) {
+	tokenizer := loadTokenizer(t, llamaTokenizer)
+
+	tests := []struct {
+		text string
+		want []int
+		// decoded is the text Decode returns, if not text
+		decoded string
+	}{
+		{text: "hello world", want: []int{19, 24}},
+		{text: "<s>hello 😀", want: []int{1, 19, 7, 3, 4, 5, 6}, decoded: "hello 😀"},
+		// Unknown characters decode to nothing, as <unk> is special
+		{text: "hellz", want: []int{18, 0}, decoded: "hell"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := tokenizer.Encode(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			if count := tokenizer.CountTokens(tt.text); count != len(tt.want) {
+				t.Errorf("CountTokens(%q) = %d, want %d", tt.text, count, len(tt.want))
+			}
+
+			want := tt.decoded
+			if want == "" {
+				want = tt.text
+			}
+			if decoded := tokenizer.Decode(got); decoded != want {
+				t.Errorf("Decode() = %q, want %q", decoded, want)
+			}
+		})
+	}
+}
+
+// gpt2Tokenizer returns a byte-level BPE tokenizer.json in the style of GPT-2
+// and Llama 3, with merges written as pairs
+func gpt2Tokenizer(t *testing.T) string {
+	t.Helper()
+	vocab := map[string]int{}
+	for b := 0; b < 256; b++ {
+		vocab[byteLevelEncode(string([]byte{byte(b)}))] = b
+	}
+	merges := [][2]string{{"h", "e"}, {"l", "l"}, {"he", "ll"}, {"hell", "o"}, {"Ġ", "w"}}
+	for _, merge := range merges {
+		vocab[merge[0]+merge[1]] = len(vocab)
+	}
+
+	file := map[string]any{
+		"pre_tokenizer": map[string]any{"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+		"decoder":       map[string]any{"type": "ByteLevel"},
+		"model":         map[string]any{"type": "BPE", "vocab": vocab, "merges": merges, "ignore_merges": false},
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	return string(data)
+}
+
+func TestHFTokenizer_ByteLevelBPE(t *testing.T) {
+	tokenizer := loadTokenizer(t, gpt2Tokenizer(t))
+
+	if got := tokenizer.Encode("hello"); !reflect.DeepEqual(got, []int{259}) {
+		t.Errorf("Encode(hello) = %v, want [259]", got)
+	}
+	// "Ġhello" isn't in the vocab, so the second word is a space and hello
+	if got := tokenizer.CountTokens("hello hello"); got != 3 {
+		t.Errorf("CountTokens(hello hello) = %d, want 3", got)
+	}
+
+	for _, text := range []string{"hello  world\n\ttabs", "naïve café 😀", "   "} {
+		if decoded := tokenizer.Decode(tokenizer.Encode(text)); decoded != text {
+			t.Errorf("Decode(Encode(%q)) = %q", text, decoded)
+		}
+	}
+}
+
+func TestHFTokenizer_Unigram(t *testing.T) {
+	tokenizer := loadTokenizer(t, `{
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always"},
+		"decoder": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always"},
+		"model": {"type": "Unigram", "unk_id": 0, "vocab": [
+			["<unk>", 0], ["▁", -2], ["▁hello", -4], ["▁he", -3], ["llo", -3],
+			["h", -6], ["e", -6], ["l", -6], ["o", -6]
+		]}
+	}`)
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{text: "hello", want: []int{2}},
+		{text: "hello hole", want: []int{2, 1, 5, 8, 7, 6}},
+		// Runs of unknown characters are a single unknown token
+		{text: "xyz", want: []int{1, 0}},
+	}
+	for _, tt := range tests {
+		if got := tokenizer.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if decoded := tokenizer.Decode([]int{2, 1, 5, 8, 7, 6}); decoded != "hello hole" {
+		t.Errorf("Decode() = %q, want %q", decoded, "hello hole")
+	}
+}
+
+func TestHFTokenizer_Unsupported(t *testing.T) {
+	tests := map[string]string{
+		"Model":         `{"model": {"type": "WordPiece", "vocab": {}}}`,
+		"Normalizer":    `{"normalizer": {"type": "BertNormalizer"}, "model": {"type": "BPE", "vocab": {}, "merges": []}}`,
+		"Pre-tokenizer": `{"pre_tokenizer": {"type": "Split", "pattern": {"Regex": "a(?=b)"}, "behavior": "Isolated"}, "model": {"type": "BPE", "vocab": {}, "merges": []}}`,
+		"Decoder":       `{"decoder": {"type": "WordPiece"}, "model": {"type": "BPE", "vocab": {}, "merges": []}}`,
+	}
+	for name, tokenizerJSON := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewHFTokenizer(strings.NewReader(tokenizerJSON))
+			var tokenizerErr *TokenizerError
+			if !errors.As(err, &tokenizerErr) {
+				t.Errorf("NewHFTokenizer() error = %v, want a *TokenizerError", err)
+			}
+		})
+	}
+}
+
+func TestSplitPattern_LookaheadWhitespace(t *testing.T) {
+	const llama3Pattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+
+	tests := []struct {
+		pattern string
+		text    string
+		want    []string
+	}{
+		{pattern: gpt2Pattern, text: "hello   world\n", want: []string{"hello", "  ", " world", "\n"}},
+		{pattern: gpt2Pattern, text: "it's 42", want: []string{"it", "'s", " 42"}},
+		{pattern: llama3Pattern, text: "Hello  world 12345!", want: []string{"Hello", " ", " world", " ", "123", "45", "!"}},
+	}
+	for _, tt := range tests {
+		split, err := compileSplitPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileSplitPattern() error = %v", err)
+		}
+		if got := split.split(tt.text, "Isolated"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("split(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenSplitter(t *testing.T) {
+	tokenizer := loadTokenizer(t, llamaTokenizer)
+
+	if _, err := NewTokenSplitter(nil, 2, 1); err == nil {
+		t.Error("NewTokenSplitter(nil) error = nil, want an error")
+	}
+	if _, err := NewTokenSplitter(tokenizer, 2, 2); err == nil {
+		t.Error("NewTokenSplitter() with overlap = chunk size error = nil, want an error")
+	}
+
+	splitter, err := NewTokenSplitter(tokenizer, 2, 1)
+	if err != nil {
+		t.Fatalf("NewTokenSplitter() error = %v", err)
+	}
+	chunks, err := splitter.SplitText("hello world hello world")
+	if err != nil {
+		t.Fatalf("SplitText() error = %v", err)
+	}
+	want := []string{"hello world", "world hello", "hello world"}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Errorf("SplitText() = %q, want %q", chunks, want)
+	}
+}
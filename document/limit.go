@@ -0,0 +1,96 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ErrDocumentTooLarge is wrapped by the errors returned for content over a
+// size limit
+var ErrDocumentTooLarge = errors.New("document too large")
+
+const (
+	// TruncatedMetadataKey is set to true on documents cut to a size limit
+	TruncatedMetadataKey = "truncated"
+	// OriginalBytesMetadataKey holds the size in bytes of a truncated
+	// document's content before it was cut, when it is known
+	OriginalBytesMetadataKey = "original_bytes"
+)
+
+// LimitSize guards against documents too large to split and embed. Content of
+// at most maxBytes is returned unchanged, as is any content when maxBytes is
+// 0 or less. Larger content fails with ErrDocumentTooLarge or, with truncate,
+// is cut to maxBytes without breaking a UTF-8 sequence and returned in a copy
+// of doc flagged with TruncatedMetadataKey and OriginalBytesMetadataKey.
+func LimitSize(doc Document, maxBytes int, truncate bool) (Document, error) {
+	if maxBytes <= 0 || len(doc.PageContent) <= maxBytes {
+		return doc, nil
+	}
+	if !truncate {
+		return doc, fmt.Errorf("%w: %d bytes, limit is %d", ErrDocumentTooLarge, len(doc.PageContent), maxBytes)
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(doc.PageContent[cut]) {
+		cut--
+	}
+	metadata := copyMetadata(doc.Metadata)
+	metadata[TruncatedMetadataKey] = true
+	metadata[OriginalBytesMetadataKey] = len(doc.PageContent)
+	return Document{PageContent: doc.PageContent[:cut], Metadata: metadata}, nil
+}
+
+// SizeLimitedReader reads at most Limit bytes from R, the streamed
+// counterpart of LimitSize. Content past the limit fails the read with
+// ErrDocumentTooLarge or, with Truncate, ends at the limit and sets Truncated.
+// Either happens on the read that returns the last bytes within the limit.
+type SizeLimitedReader struct {
+	R         io.Reader
+	Limit     int64
+	Truncate  bool
+	Truncated bool // Whether content past the limit was dropped
+
+	read int64
+	err  error // Returned by every read once the limit is reached
+}
+
+func (l *SizeLimitedReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.read >= l.Limit {
+		return 0, l.pastLimit()
+	}
+
+	if remaining := l.Limit - l.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.R.Read(p)
+	l.read += int64(n)
+	if err == nil && l.read >= l.Limit {
+		// Look for more content now, so the caller learns of it with these bytes
+		err = l.pastLimit()
+	}
+	return n, err
+}
+
+// pastLimit ends the content when R has none past the limit, and otherwise
+// truncates it or fails
+func (l *SizeLimitedReader) pastLimit() error {
+	var next [1]byte
+	n, err := io.ReadFull(l.R, next[:])
+	switch {
+	case n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF):
+		l.err = io.EOF
+	case n == 0:
+		return err
+	case l.Truncate:
+		l.Truncated = true
+		l.err = io.EOF
+	default:
+		l.err = fmt.Errorf("%w: more than %d bytes", ErrDocumentTooLarge, l.Limit)
+	}
+	return l.err
+}
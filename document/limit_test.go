@@ -0,0 +1,81 @@
+package document
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLimitSize(t *testing.T) {
+	doc := Document{PageContent: "héllo wörld", Metadata: map[string]interface{}{"source": "a.txt"}}
+
+	t.Run("Within the limit", func(t *testing.T) {
+		got, err := LimitSize(doc, len(doc.PageContent), false)
+		if err != nil || got.PageContent != doc.PageContent {
+			t.Errorf("LimitSize() = %q, %v, want the document unchanged", got.PageContent, err)
+		}
+		if got, err := LimitSize(doc, 0, false); err != nil || got.PageContent != doc.PageContent {
+			t.Errorf("LimitSize() without a limit = %q, %v", got.PageContent, err)
+		}
+	})
+
+	t.Run("Fails", func(t *testing.T) {
+		_, err := LimitSize(doc, 5, false)
+		if !errors.Is(err, ErrDocumentTooLarge) || !strings.Contains(err.Error(), "13 bytes, limit is 5") {
+			t.Errorf("LimitSize() error = %v, want ErrDocumentTooLarge with the sizes", err)
+		}
+	})
+
+	t.Run("Truncates", func(t *testing.T) {
+		// The limit falls inside the two bytes of "é"
+		got, err := LimitSize(doc, 2, true)
+		if err != nil {
+			t.Fatalf("LimitSize() error = %v", err)
+		}
+		if got.PageContent != "h" {
+			t.Errorf("PageContent = %q, want the content cut before the partial rune", got.PageContent)
+		}
+		if got.Metadata[TruncatedMetadataKey] != true || got.Metadata[OriginalBytesMetadataKey] != 13 || got.Metadata["source"] != "a.txt" {
+			t.Errorf("Metadata = %v, want it flagged as truncated", got.Metadata)
+		}
+		if _, ok := doc.Metadata[TruncatedMetadataKey]; ok {
+			t.Error("LimitSize() modified the metadata it was given")
+		}
+	})
+}
+
+func TestSizeLimitedReader(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		truncate      bool
+		want          string
+		wantErr       error
+		wantTruncated bool
+	}{
+		{name: "Within the limit", content: "abc", want: "abc"},
+		{name: "At the limit", content: "abcde", want: "abcde"},
+		{name: "Fails", content: "abcdef", wantErr: ErrDocumentTooLarge},
+		{name: "Truncates", content: "abcdef", truncate: true, want: "abcde", wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &SizeLimitedReader{R: strings.NewReader(tt.content), Limit: 5, Truncate: tt.truncate}
+			got, err := io.ReadAll(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ReadAll() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("ReadAll() = %q, %v, want %q", got, err, tt.want)
+			}
+			if r.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %v, want %v", r.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package document
+
+import "regexp"
+
+// RedactionsMetadataKey holds how many matches a Redactor replaced in a
+// document's content
+const RedactionsMetadataKey = "redactions"
+
+// RedactionRule replaces every match of Pattern with Replacement, which may
+// refer to submatches as in regexp.Regexp.ReplaceAllString
+type RedactionRule struct {
+	Name        string // The kind of entity matched, such as "email"
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+var (
+	// EmailRule masks email addresses
+	EmailRule = RedactionRule{
+		Name:        "email",
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+	}
+	// SSNRule masks US Social Security numbers written as 123-45-6789
+	SSNRule = RedactionRule{
+		Name:        "ssn",
+		Pattern:     regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		Replacement: "[SSN]",
+	}
+	// PhoneRule masks phone numbers of ten or more digits, optionally with a
+	// country code and separated by spaces, dots, dashes or parentheses
+	PhoneRule = RedactionRule{
+		Name:        "phone",
+		Pattern:     regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`),
+		Replacement: "[PHONE]",
+	}
+)
+
+// DefaultRedactionRules are the rules of a Redactor created without any
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{EmailRule, SSNRule, PhoneRule}
+}
+
+// Redactor masks personal data such as email addresses and phone numbers in
+// text, applying its rules in order
+type Redactor struct {
+	rules []RedactionRule
+}
+
+// NewRedactor creates a Redactor applying rules, or DefaultRedactionRules
+// when none are given
+func NewRedactor(rules ...RedactionRule) *Redactor {
+	if len(rules) == 0 {
+		rules = DefaultRedactionRules()
+	}
+	return &Redactor{rules: rules}
+}
+
+// Redact returns text with every match of the rules replaced, and the number
+// of matches replaced
+func (r *Redactor) Redact(text string) (string, int) {
+	count := 0
+	for _, rule := range r.rules {
+		matches := len(rule.Pattern.FindAllStringIndex(text, -1))
+		if matches == 0 {
+			continue
+		}
+		count += matches
+		text = rule.Pattern.ReplaceAllString(text, rule.Replacement)
+	}
+	return text, count
+}
+
+// RedactDocument returns a copy of doc with its content redacted and the
+// number of matches replaced under RedactionsMetadataKey
+func (r *Redactor) RedactDocument(doc Document) Document {
+	content, count := r.Redact(doc.PageContent)
+	metadata := copyMetadata(doc.Metadata)
+	metadata[RedactionsMetadataKey] = count
+	return Document{PageContent: content, Metadata: metadata}
+}
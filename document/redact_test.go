@@ -0,0 +1,50 @@
+package document
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		wantCount int
+	}{
+		{name: "Email", text: "Write to jane.doe+kb@example.co.uk today", want: "Write to [EMAIL] today", wantCount: 1},
+		{name: "Phone numbers", text: "Call (555) 123-4567 or +1 555.123.4567", want: "Call [PHONE] or [PHONE]", wantCount: 2},
+		{name: "SSN", text: "SSN 123-45-6789 on file", want: "SSN [SSN] on file", wantCount: 1},
+		{name: "Nothing to redact", text: "Order 42 shipped in 2024", want: "Order 42 shipped in 2024"},
+	}
+
+	redactor := NewRedactor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := redactor.Redact(tt.text)
+			if got != tt.want || count != tt.wantCount {
+				t.Errorf("Redact() = %q, %d, want %q, %d", got, count, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRedactor_CustomRules(t *testing.T) {
+	redactor := NewRedactor(RedactionRule{
+		Name:        "employee_id",
+		Pattern:     regexp.MustCompile(`EMP-(\d{2})\d+`),
+		Replacement: "EMP-${1}xx",
+	})
+
+	doc := Document{PageContent: "EMP-1234 and EMP-9876 emailed a@b.io", Metadata: map[string]interface{}{"source": "hr.txt"}}
+	got := redactor.RedactDocument(doc)
+	if got.PageContent != "EMP-12xx and EMP-98xx emailed a@b.io" {
+		t.Errorf("PageContent = %q, want only the custom rule applied", got.PageContent)
+	}
+	if got.Metadata[RedactionsMetadataKey] != 2 || got.Metadata["source"] != "hr.txt" {
+		t.Errorf("Metadata = %v, want the redaction count added", got.Metadata)
+	}
+	if _, ok := doc.Metadata[RedactionsMetadataKey]; ok {
+		t.Error("RedactDocument() modified the metadata it was given")
+	}
+}
@@ -0,0 +1,55 @@
+package document
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// SimHash returns a 64-bit locality-sensitive fingerprint of text: texts that
+// differ in a few words get fingerprints that differ in a few bits. Features are
+// overlapping pairs of lowercased words, so punctuation, case and whitespace
+// don't affect the result.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	addFeature := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := range weights {
+			if sum&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+
+	if len(words) == 1 {
+		addFeature(words[0])
+	}
+	for i := 1; i < len(words); i++ {
+		addFeature(words[i-1] + " " + words[i])
+	}
+
+	var hash uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of bits that differ between two SimHash fingerprints
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
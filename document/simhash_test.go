@@ -0,0 +1,46 @@
+package document
+
+import "testing"
+
+func TestSimHash(t *testing.T) {
+	const article = "The city council approved the new budget on Tuesday, allocating more funds to public transport and road maintenance. The mayor said the plan would reduce congestion over the next five years and improve air quality across the region."
+
+	tests := []struct {
+		name        string
+		other       string
+		maxDistance int
+		minDistance int
+	}{
+		{
+			name:        "Case, punctuation and whitespace are ignored",
+			other:       "the CITY council approved the new budget on tuesday allocating more funds to public transport and road maintenance   the mayor said the plan would reduce congestion over the next five years and improve air quality across the region",
+			maxDistance: 0,
+		},
+		{
+			name:        "Near duplicates are close",
+			other:       "The city council approved the new budget on Tuesday, allocating additional funds to public transport and road maintenance. The mayor said the plan will reduce congestion over the next five years and improve air quality across the region.",
+			maxDistance: 12,
+		},
+		{
+			name:        "Unrelated texts are far apart",
+			other:       "Researchers discovered a new species of frog in the rainforest, noting its unusual bright blue skin and a distinctive call that can be heard from far away at night during the rainy season.",
+			maxDistance: 64,
+			minDistance: 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := HammingDistance(SimHash(article), SimHash(tt.other))
+			if distance > tt.maxDistance || distance < tt.minDistance {
+				t.Errorf("HammingDistance() = %d, want between %d and %d", distance, tt.minDistance, tt.maxDistance)
+			}
+		})
+	}
+}
+
+func TestSimHash_Empty(t *testing.T) {
+	if got := SimHash(" \n\t.,"); got != 0 {
+		t.Errorf("SimHash() of text without words = %x, want 0", got)
+	}
+}
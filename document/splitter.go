@@ -1,5 +1,14 @@
 package document
 
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// DefaultReaderWindowSize is the number of bytes SplitReader buffers at a time
+const DefaultReaderWindowSize = 64 * 1024
+
 // Splitter interface defines methods for splitting text into chunks
 type Splitter interface {
 	SplitText(text string) ([]string, error)
@@ -58,3 +67,66 @@ func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
 	}
 	return copy
 }
+
+// SplitReader splits text read from r without loading it all into memory.
+// The text is read in windows of at most windowSize bytes, cut at the last
+// whitespace so words are not broken, and every chunk the splitter produces
+// for a window is passed to fn as a document carrying a copy of metadata.
+// Chunk overlap does not carry across window boundaries.
+func SplitReader(splitter Splitter, r io.Reader, metadata map[string]interface{}, windowSize int, fn func(Document) error) error {
+	if windowSize <= 0 {
+		windowSize = DefaultReaderWindowSize
+	}
+
+	buf := make([]byte, windowSize)
+	filled := 0
+	for {
+		n, err := io.ReadFull(r, buf[filled:])
+		filled += n
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return &SplitterError{
+				Op:      "split_reader",
+				Message: "failed to read content",
+				Err:     err,
+			}
+		}
+
+		cut := filled
+		if !eof {
+			cut = windowCut(buf[:filled])
+		}
+
+		chunks, err := splitter.SplitText(string(buf[:cut]))
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			if err := fn(Document{PageContent: chunk, Metadata: copyMetadata(metadata)}); err != nil {
+				return err
+			}
+		}
+
+		filled = copy(buf, buf[cut:filled])
+		if eof {
+			return nil
+		}
+	}
+}
+
+// windowCut returns where a full window should be cut: after the last
+// whitespace, or before a trailing partial UTF-8 sequence if there is none
+func windowCut(window []byte) int {
+	if i := bytes.LastIndexAny(window, " \t\r\n"); i >= 0 {
+		return i + 1
+	}
+
+	start := len(window) - 1
+	for start > 0 && !utf8.RuneStart(window[start]) {
+		start--
+	}
+	if start > 0 && !utf8.FullRune(window[start:]) {
+		return start
+	}
+	return len(window)
+}
@@ -0,0 +1,142 @@
+package document
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// countingReader generates size bytes of repeated text and counts how much has been read
+type countingReader struct {
+	size int
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	const text = "lorem ipsum dolor sit amet "
+	n := 0
+	for n < len(p) && r.read < r.size {
+		p[n] = text[r.read%len(text)]
+		n++
+		r.read++
+	}
+	return n, nil
+}
+
+// fixedSplitter cuts text into fixed-size chunks without dropping any bytes
+type fixedSplitter struct {
+	size int
+}
+
+func (s fixedSplitter) SplitText(text string) ([]string, error) {
+	var chunks []string
+	for len(text) > s.size {
+		chunks = append(chunks, text[:s.size])
+		text = text[s.size:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks, nil
+}
+
+func TestSplitReader_BoundedMemory(t *testing.T) {
+	const (
+		size       = 8 * 1024 * 1024
+		windowSize = 4 * 1024
+	)
+
+	reader := &countingReader{size: size}
+	metadata := map[string]interface{}{"source": "large"}
+
+	emitted := 0
+	maxAhead := 0
+	err := SplitReader(fixedSplitter{size: 500}, reader, metadata, windowSize, func(doc Document) error {
+		emitted += len(doc.PageContent)
+		if ahead := reader.read - emitted; ahead > maxAhead {
+			maxAhead = ahead
+		}
+		if doc.Metadata["source"] != "large" {
+			return errors.New("chunk metadata was not copied")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SplitReader() error = %v", err)
+	}
+
+	if reader.read != size || emitted != size {
+		t.Errorf("SplitReader() read %d and emitted %d bytes, want %d", reader.read, emitted, size)
+	}
+	// The reader must never get more than one window ahead of the emitted chunks
+	if maxAhead > windowSize {
+		t.Errorf("SplitReader() buffered %d bytes, want at most %d", maxAhead, windowSize)
+	}
+}
+
+func TestSplitReader_PreservesText(t *testing.T) {
+	text := strings.Repeat("héllo wörld ", 1000)
+
+	var got []string
+	err := SplitReader(NewCharacterSplitter(100, 0, " "), strings.NewReader(text), nil, 256, func(doc Document) error {
+		got = append(got, doc.PageContent)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SplitReader() error = %v", err)
+	}
+
+	if joined := strings.Join(got, " "); joined != strings.TrimSpace(text) {
+		t.Errorf("SplitReader() lost text: got %d bytes, want %d", len(joined), len(strings.TrimSpace(text)))
+	}
+}
+
+func TestWindowCut(t *testing.T) {
+	tests := []struct {
+		name   string
+		window string
+		want   int
+	}{
+		{
+			name:   "Cut after last space",
+			window: "hello world foo",
+			want:   12,
+		},
+		{
+			name:   "No whitespace",
+			window: "abcdef",
+			want:   6,
+		},
+		{
+			name:   "Trailing partial rune",
+			window: "abc" + string([]byte{0xc3}),
+			want:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := windowCut([]byte(tt.window)); got != tt.want {
+				t.Errorf("windowCut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitDocuments_NilMetadata(t *testing.T) {
+	chunks, err := SplitDocuments(NewCharacterSplitter(5, 0, " "), []Document{{PageContent: "one two three"}})
+	if err != nil {
+		t.Fatalf("SplitDocuments() error = %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("SplitDocuments() = %d chunks, want several", len(chunks))
+	}
+	chunks[0].Metadata["source"] = "a.txt"
+	if chunks[1].Metadata == nil || chunks[1].Metadata["source"] != nil {
+		t.Errorf("chunk metadata = %v, want a map of its own", chunks[1].Metadata)
+	}
+}
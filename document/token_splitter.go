@@ -3,17 +3,8 @@ package document
 import (
 	"fmt"
 	"strings"
-
-	"github.com/pkoukk/tiktoken-go"
 )
 
-type TiktokenSplitter struct {
-	TokensPerChunk int
-	ChunkOverlap   int
-	Model          string
-	encoding       *tiktoken.Tiktoken
-}
-
 // getEncodingForModel returns the appropriate encoding name for a given model
 func getEncodingForModel(model string) string {
 	// GPT-4 Preview models
@@ -56,57 +47,75 @@ func getEncodingForModel(model string) string {
 	return "cl100k_base"
 }
 
-func NewTiktokenSplitter(tokensPerChunk int, chunkOverlap int, model string) (*TiktokenSplitter, error) {
-	// Validate parameters
-	if tokensPerChunk <= 0 {
+// TokenSplitter splits text into chunks of a fixed number of tokens of any
+// TokenEncoder, such as an HFTokenizer for models that don't use tiktoken
+type TokenSplitter struct {
+	TokensPerChunk int
+	ChunkOverlap   int
+	Tokenizer      TokenEncoder
+}
+
+// NewTokenSplitter returns a splitter cutting text into chunks of
+// tokensPerChunk tokens of tokenizer, overlapping by chunkOverlap tokens
+func NewTokenSplitter(tokenizer TokenEncoder, tokensPerChunk int, chunkOverlap int) (*TokenSplitter, error) {
+	if tokenizer == nil {
 		return nil, &SplitterError{
-			Op:      "new_tiktoken_splitter",
+			Op:      "new_token_splitter",
+			Message: "tokenizer is required",
+		}
+	}
+	if err := validateTokenChunks("new_token_splitter", tokensPerChunk, chunkOverlap); err != nil {
+		return nil, err
+	}
+
+	return &TokenSplitter{
+		TokensPerChunk: tokensPerChunk,
+		ChunkOverlap:   chunkOverlap,
+		Tokenizer:      tokenizer,
+	}, nil
+}
+
+// validateTokenChunks checks the chunk size and overlap of a token splitter
+func validateTokenChunks(op string, tokensPerChunk int, chunkOverlap int) error {
+	if tokensPerChunk <= 0 {
+		return &SplitterError{
+			Op:      op,
 			Message: "tokensPerChunk must be positive",
 			Err:     fmt.Errorf("invalid tokensPerChunk: %d", tokensPerChunk),
 		}
 	}
 
 	if chunkOverlap < 0 {
-		return nil, &SplitterError{
-			Op:      "new_tiktoken_splitter",
+		return &SplitterError{
+			Op:      op,
 			Message: "chunkOverlap must be non-negative",
 			Err:     fmt.Errorf("invalid chunkOverlap: %d", chunkOverlap),
 		}
 	}
 
 	if chunkOverlap >= tokensPerChunk {
-		return nil, &SplitterError{
-			Op:      "new_tiktoken_splitter",
+		return &SplitterError{
+			Op:      op,
 			Message: "chunkOverlap must be less than tokensPerChunk",
 			Err:     fmt.Errorf("overlap %d >= chunk size %d", chunkOverlap, tokensPerChunk),
 		}
 	}
 
-	encodingName := getEncodingForModel(model)
-	encoding, err := tiktoken.GetEncoding(encodingName)
-	if err != nil {
-		return nil, &SplitterError{
-			Op:      "new_tiktoken_splitter",
-			Message: fmt.Sprintf("failed to get %s encoding for model %s", encodingName, model),
-			Err:     err,
-		}
-	}
+	return nil
+}
 
-	return &TiktokenSplitter{
-		TokensPerChunk: tokensPerChunk,
-		ChunkOverlap:   chunkOverlap,
-		Model:          model,
-		encoding:       encoding,
-	}, nil
+// CountTokens returns the number of tokens in text
+func (ts *TokenSplitter) CountTokens(text string) int {
+	return ts.Tokenizer.CountTokens(text)
 }
 
-func (ts *TiktokenSplitter) SplitText(text string) ([]string, error) {
+func (ts *TokenSplitter) SplitText(text string) ([]string, error) {
 	if text == "" {
 		return nil, nil
 	}
 
 	// Get tokens for the text
-	tokens := ts.encoding.Encode(text, nil, nil)
+	tokens := ts.Tokenizer.Encode(text)
 	if len(tokens) == 0 {
 		return nil, nil
 	}
@@ -137,7 +146,7 @@ func (ts *TiktokenSplitter) SplitText(text string) ([]string, error) {
 
 		// Create chunk
 		chunkTokens := tokens[start:end]
-		chunk := ts.encoding.Decode(chunkTokens)
+		chunk := ts.Tokenizer.Decode(chunkTokens)
 		chunks = append(chunks, chunk)
 
 		// Calculate next start position and ensure forward progress
@@ -150,7 +159,7 @@ func (ts *TiktokenSplitter) SplitText(text string) ([]string, error) {
 	return chunks, nil
 }
 
-func (ts *TiktokenSplitter) SplitDocuments(docs []Document) ([]Document, error) {
+func (ts *TokenSplitter) SplitDocuments(docs []Document) ([]Document, error) {
 	var result []Document
 
 	for _, doc := range docs {
@@ -164,10 +173,10 @@ func (ts *TiktokenSplitter) SplitDocuments(docs []Document) ([]Document, error)
 		}
 
 		for _, chunk := range chunks {
-			// Create a new document for each chunk with the same metadata
+			// Create a new document for each chunk with a copy of the metadata
 			newDoc := Document{
 				PageContent: chunk,
-				Metadata:    doc.Metadata,
+				Metadata:    copyMetadata(doc.Metadata),
 			}
 			result = append(result, newDoc)
 		}
@@ -175,3 +184,61 @@ func (ts *TiktokenSplitter) SplitDocuments(docs []Document) ([]Document, error)
 
 	return result, nil
 }
+
+// TiktokenSplitter is a TokenSplitter over the tiktoken encoding of an OpenAI model
+type TiktokenSplitter struct {
+	TokensPerChunk int
+	ChunkOverlap   int
+	Model          string
+	tokenizer      *TiktokenTokenizer
+}
+
+func NewTiktokenSplitter(tokensPerChunk int, chunkOverlap int, model string) (*TiktokenSplitter, error) {
+	if err := validateTokenChunks("new_tiktoken_splitter", tokensPerChunk, chunkOverlap); err != nil {
+		return nil, err
+	}
+
+	tokenizer, err := NewTiktokenTokenizer(model)
+	if err != nil {
+		return nil, &SplitterError{
+			Op:      "new_tiktoken_splitter",
+			Message: "failed to load tokenizer",
+			Err:     err,
+		}
+	}
+
+	return &TiktokenSplitter{
+		TokensPerChunk: tokensPerChunk,
+		ChunkOverlap:   chunkOverlap,
+		Model:          model,
+		tokenizer:      tokenizer,
+	}, nil
+}
+
+// Tokenizer returns the splitter's tiktoken tokenizer
+func (ts *TiktokenSplitter) Tokenizer() *TiktokenTokenizer {
+	return ts.tokenizer
+}
+
+// CountTokens returns the number of tokens in text, so the splitter's encoding
+// can be used as a Tokenizer
+func (ts *TiktokenSplitter) CountTokens(text string) int {
+	return ts.tokenizer.CountTokens(text)
+}
+
+func (ts *TiktokenSplitter) SplitText(text string) ([]string, error) {
+	return ts.splitter().SplitText(text)
+}
+
+func (ts *TiktokenSplitter) SplitDocuments(docs []Document) ([]Document, error) {
+	return ts.splitter().SplitDocuments(docs)
+}
+
+// splitter returns a TokenSplitter with the current chunk size and overlap
+func (ts *TiktokenSplitter) splitter() *TokenSplitter {
+	return &TokenSplitter{
+		TokensPerChunk: ts.TokensPerChunk,
+		ChunkOverlap:   ts.ChunkOverlap,
+		Tokenizer:      ts.tokenizer,
+	}
+}
@@ -0,0 +1,62 @@
+package document
+
+import (
+	"fmt"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// TokenEncoder is a Tokenizer that also converts text to token IDs and back,
+// which splitting text on token boundaries needs
+type TokenEncoder interface {
+	Tokenizer
+	Encode(text string) []int
+	Decode(tokens []int) string
+}
+
+var (
+	_ TokenEncoder = (*TiktokenTokenizer)(nil)
+	_ TokenEncoder = (*HFTokenizer)(nil)
+)
+
+// TiktokenTokenizer is the tiktoken encoding of an OpenAI model
+type TiktokenTokenizer struct {
+	Model    string
+	Encoding string
+	encoding *tiktoken.Tiktoken
+}
+
+// NewTiktokenTokenizer returns the tokenizer of model, falling back to
+// cl100k_base for models it doesn't know
+func NewTiktokenTokenizer(model string) (*TiktokenTokenizer, error) {
+	encodingName := getEncodingForModel(model)
+	encoding, err := tiktoken.GetEncoding(encodingName)
+	if err != nil {
+		return nil, &TokenizerError{
+			Op:      "new_tiktoken_tokenizer",
+			Message: fmt.Sprintf("failed to get %s encoding for model %s", encodingName, model),
+			Err:     err,
+		}
+	}
+
+	return &TiktokenTokenizer{
+		Model:    model,
+		Encoding: encodingName,
+		encoding: encoding,
+	}, nil
+}
+
+// Encode returns the token IDs of text
+func (t *TiktokenTokenizer) Encode(text string) []int {
+	return t.encoding.Encode(text, nil, nil)
+}
+
+// Decode returns the text of tokens
+func (t *TiktokenTokenizer) Decode(tokens []int) string {
+	return t.encoding.Decode(tokens)
+}
+
+// CountTokens returns the number of tokens in text
+func (t *TiktokenTokenizer) CountTokens(text string) int {
+	return len(t.Encode(text))
+}
@@ -0,0 +1,77 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// TokenBatches packs documents, in order, into batches of at most batchSize
+// documents and maxTokens tokens as counted by countTokens, and returns the
+// end index of each batch. A document over maxTokens on its own gets a batch
+// of its own, so the API reports it. A batchSize or maxTokens of 0 or less
+// doesn't limit the batches.
+func TokenBatches(documents []string, batchSize, maxTokens int, countTokens func(text string) int) []int {
+	var ends []int
+	count, tokens := 0, 0
+	for i, doc := range documents {
+		n := countTokens(doc)
+		full := batchSize > 0 && count >= batchSize
+		over := maxTokens > 0 && tokens+n > maxTokens
+		if count > 0 && (full || over) {
+			ends = append(ends, i)
+			count, tokens = 0, 0
+		}
+		count++
+		tokens += n
+	}
+	if count > 0 {
+		ends = append(ends, len(documents))
+	}
+	return ends
+}
+
+// EmbedBatches embeds documents with one request per batch ending at ends,
+// as returned by TokenBatches, keeping the vectors in the order of documents.
+// A batch failing with ErrCodeTokenLimitExceeded, as when token counts are
+// estimates, is split in halves that are retried until they fit; a single
+// document over the limit fails the call.
+func EmbedBatches(ctx context.Context, documents []string, ends []int, embed EmbedFunc) ([][]float32, error) {
+	vectors := make([][]float32, len(documents))
+	start := 0
+	for i, end := range ends {
+		if err := splitOnTokenLimit(ctx, documents, start, end, vectors, embed); err != nil {
+			return nil, fmt.Errorf("error processing batch %d: %w", i, err)
+		}
+		start = end
+	}
+	return vectors, nil
+}
+
+// splitOnTokenLimit embeds documents[start:end] into vectors, splitting the
+// range when it exceeds the API's token limit
+func splitOnTokenLimit(ctx context.Context, documents []string, start, end int, vectors [][]float32, embed EmbedFunc) error {
+	if err := ctx.Err(); err != nil {
+		return NewEmbeddingError("EmbedDocuments", err, ErrCodeContextCanceled, "context canceled")
+	}
+
+	batch, err := embed(ctx, documents[start:end])
+	if err == nil {
+		if len(batch) != end-start {
+			return NewEmbeddingError("EmbedDocuments", nil, ErrCodeAPIError,
+				fmt.Sprintf("got %d embeddings for %d inputs", len(batch), end-start))
+		}
+		copy(vectors[start:end], batch)
+		return nil
+	}
+
+	var embeddingErr *EmbeddingError
+	if end-start == 1 || !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeTokenLimitExceeded {
+		return err
+	}
+	mid := start + (end-start)/2
+	if err := splitOnTokenLimit(ctx, documents, start, mid, vectors, embed); err != nil {
+		return err
+	}
+	return splitOnTokenLimit(ctx, documents, mid, end, vectors, embed)
+}
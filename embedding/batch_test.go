@@ -0,0 +1,104 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wordCount counts a document's words as its tokens
+func wordCount(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestTokenBatches(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	short := "word"
+
+	tests := []struct {
+		name      string
+		documents []string
+		batchSize int
+		maxTokens int
+		want      []int
+	}{
+		{name: "Short documents share a batch", documents: []string{short, short, short, short}, batchSize: 100, maxTokens: 50, want: []int{4}},
+		{name: "Count limit", documents: []string{short, short, short, short, short}, batchSize: 2, maxTokens: 50, want: []int{2, 4, 5}},
+		{name: "Token limit", documents: []string{long, short, long, short, long}, batchSize: 100, maxTokens: 50, want: []int{2, 4, 5}},
+		{name: "Oversized document alone", documents: []string{short, long + long, short}, batchSize: 100, maxTokens: 50, want: []int{1, 2, 3}},
+		{name: "No limits", documents: []string{long, long}, want: []int{2}},
+		{name: "Empty", documents: nil, batchSize: 10, maxTokens: 10, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TokenBatches(tt.documents, tt.batchSize, tt.maxTokens, wordCount); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TokenBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// tokenLimitedEmbed embeds each document as its word count, rejecting
+// requests of more than limit words like a per-request token limit
+func tokenLimitedEmbed(limit int, requests *[]int) EmbedFunc {
+	return func(ctx context.Context, documents []string) ([][]float32, error) {
+		*requests = append(*requests, len(documents))
+		total := 0
+		vectors := make([][]float32, len(documents))
+		for i, doc := range documents {
+			total += wordCount(doc)
+			vectors[i] = []float32{float32(wordCount(doc))}
+		}
+		if total > limit {
+			return nil, ErrTokenLimitExceeded("EmbedDocuments", nil)
+		}
+		return vectors, nil
+	}
+}
+
+func TestEmbedBatches_SplitsOnTokenLimit(t *testing.T) {
+	// The estimate packs everything in one batch the API rejects
+	documents := []string{"a b c", "d e", "f", "g h i j", "k"}
+	var requests []int
+	vectors, err := EmbedBatches(context.Background(), documents, []int{5}, tokenLimitedEmbed(5, &requests))
+	if err != nil {
+		t.Fatalf("EmbedBatches() error = %v", err)
+	}
+
+	want := [][]float32{{3}, {2}, {1}, {4}, {1}}
+	if !reflect.DeepEqual(vectors, want) {
+		t.Errorf("EmbedBatches() = %v, want %v in document order", vectors, want)
+	}
+	// 5 rejected, then 2 fits and 3 is split into 1 and 2
+	if !reflect.DeepEqual(requests, []int{5, 2, 3, 1, 2}) {
+		t.Errorf("request sizes = %v, want the rejected batch bisected", requests)
+	}
+}
+
+func TestEmbedBatches_Errors(t *testing.T) {
+	t.Run("Single document over the limit", func(t *testing.T) {
+		var requests []int
+		_, err := EmbedBatches(context.Background(), []string{"a", "b c d e f g"}, []int{1, 2}, tokenLimitedEmbed(5, &requests))
+		var embeddingErr *EmbeddingError
+		if !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeTokenLimitExceeded {
+			t.Fatalf("EmbedBatches() error = %v, want ErrCodeTokenLimitExceeded", err)
+		}
+		if !strings.Contains(err.Error(), "batch 1") {
+			t.Errorf("error = %v, want it to name the batch", err)
+		}
+	})
+
+	t.Run("Other errors are not split", func(t *testing.T) {
+		calls := 0
+		_, err := EmbedBatches(context.Background(), []string{"a", "b"}, []int{2}, func(ctx context.Context, documents []string) ([][]float32, error) {
+			calls++
+			return nil, ErrRateLimitExceeded("EmbedDocuments", nil)
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("EmbedBatches() error = %v after %d calls, want the rate limit error after 1", err, calls)
+		}
+	})
+}
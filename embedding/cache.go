@@ -0,0 +1,252 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// CacheStats counts how a CachingEmbedder served the texts it was asked for
+type CacheStats struct {
+	Hits      int64 // Texts served from the cache
+	Misses    int64 // Texts sent to the wrapped embedder
+	Evictions int64 // Vectors dropped to make room for newer ones
+	Size      int   // Vectors currently cached
+}
+
+// HitRate returns the fraction of texts served from the cache, 0 before any
+// text was asked for
+func (s CacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// CacheOption configures a CachingEmbedder
+type CacheOption func(*CachingEmbedder)
+
+// WithEmbedCacheStats logs the cache's Stats at info level every interval,
+// until the CachingEmbedder is closed
+func WithEmbedCacheStats(logger *slog.Logger, interval time.Duration) CacheOption {
+	return func(c *CachingEmbedder) {
+		c.logger = logger
+		c.statsInterval = interval
+	}
+}
+
+// CachingEmbedder wraps an Embedder, keeping the vectors of the most recently
+// used texts in memory so they aren't embedded again. Documents and queries
+// are cached apart, since models may embed them differently. Failed calls
+// are not cached.
+type CachingEmbedder struct {
+	embedder  Embedder
+	capacity  int
+	model     string
+	dimension int
+
+	logger        *slog.Logger
+	statsInterval time.Duration
+	stop          chan struct{}
+	closeOnce     sync.Once
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	recency *list.List // Of *cacheEntry, most recently used first
+	stats   CacheStats
+}
+
+type cacheKey struct {
+	query bool
+	text  string
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	vector []float32
+}
+
+// NewCachingEmbedder creates a CachingEmbedder holding up to capacity
+// vectors, evicting the least recently used. A capacity of 0 or less caches
+// nothing.
+func NewCachingEmbedder(embedder Embedder, capacity int, opts ...CacheOption) *CachingEmbedder {
+	c := &CachingEmbedder{
+		embedder: embedder,
+		capacity: capacity,
+		entries:  make(map[cacheKey]*list.Element),
+		recency:  list.New(),
+	}
+	if modelProvider, ok := embedder.(ModelProvider); ok {
+		c.model = modelProvider.Model()
+	}
+	if dimensionProvider, ok := embedder.(DimensionProvider); ok {
+		c.dimension = dimensionProvider.Dimension()
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = logging.Discard()
+	}
+	if c.statsInterval > 0 {
+		c.stop = make(chan struct{})
+		go c.logStats()
+	}
+	return c
+}
+
+// Model returns the wrapped embedder's model, if it reports one
+func (c *CachingEmbedder) Model() string {
+	return c.model
+}
+
+// Dimension returns the wrapped embedder's configured vector size, if it reports one
+func (c *CachingEmbedder) Dimension() int {
+	return c.dimension
+}
+
+// Stats returns the cache's counters since it was created
+func (c *CachingEmbedder) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Size = c.recency.Len()
+	return stats
+}
+
+// Close stops logging the stats. The cache stays usable.
+func (c *CachingEmbedder) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+		}
+	})
+	return nil
+}
+
+// EmbedDocuments embeds the documents not cached in one call to the wrapped
+// embedder, each distinct text once
+func (c *CachingEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	vectors := make([][]float32, len(documents))
+	var missing []string
+	positions := make(map[string][]int)
+
+	c.mu.Lock()
+	for i, doc := range documents {
+		if vector, ok := c.get(cacheKey{text: doc}); ok {
+			vectors[i] = vector
+			continue
+		}
+		if _, seen := positions[doc]; !seen {
+			missing = append(missing, doc)
+			c.stats.Misses++
+		} else {
+			c.stats.Hits++ // Served by the same call as its first occurrence
+		}
+		positions[doc] = append(positions[doc], i)
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+	embedded, err := c.embedder.EmbedDocuments(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missing) {
+		return nil, NewEmbeddingError("EmbedDocuments", nil, ErrCodeAPIError,
+			fmt.Sprintf("got %d embeddings for %d inputs", len(embedded), len(missing)))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, doc := range missing {
+		for _, position := range positions[doc] {
+			vectors[position] = slices.Clone(embedded[i])
+		}
+		c.put(cacheKey{text: doc}, embedded[i])
+	}
+	return vectors, nil
+}
+
+func (c *CachingEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	key := cacheKey{query: true, text: text}
+	c.mu.Lock()
+	vector, ok := c.get(key)
+	if !ok {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+	if ok {
+		return vector, nil
+	}
+
+	vector, err := c.embedder.EmbedQuery(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.put(key, vector)
+	c.mu.Unlock()
+	return slices.Clone(vector), nil
+}
+
+// get returns a copy of the cached vector of key, counting a hit if there is
+// one. c.mu must be held.
+func (c *CachingEmbedder) get(key cacheKey) ([]float32, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.stats.Hits++
+	c.recency.MoveToFront(element)
+	return slices.Clone(element.Value.(*cacheEntry).vector), true
+}
+
+// put caches a copy of vector under key, evicting the least recently used
+// vectors beyond the capacity. c.mu must be held.
+func (c *CachingEmbedder) put(key cacheKey, vector []float32) {
+	if c.capacity <= 0 {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).vector = slices.Clone(vector)
+		c.recency.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recency.PushFront(&cacheEntry{key: key, vector: slices.Clone(vector)})
+	for c.recency.Len() > c.capacity {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// logStats logs the stats every statsInterval until Close
+func (c *CachingEmbedder) logStats() {
+	ticker := time.NewTicker(c.statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			stats := c.Stats()
+			c.logger.Info("embedding cache stats",
+				"hits", stats.Hits,
+				"misses", stats.Misses,
+				"evictions", stats.Evictions,
+				"size", stats.Size,
+				"hit_rate", stats.HitRate(),
+			)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lengthEmbedder embeds each text as its length, recording the texts of
+// every call
+type lengthEmbedder struct {
+	calls [][]string
+	err   error
+}
+
+func (e *lengthEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	e.calls = append(e.calls, documents)
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float32, len(documents))
+	for i, doc := range documents {
+		vectors[i] = []float32{float32(len(doc))}
+	}
+	return vectors, nil
+}
+
+func (e *lengthEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	e.calls = append(e.calls, []string{text})
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []float32{float32(len(text))}, nil
+}
+
+func TestCachingEmbedder_Stats(t *testing.T) {
+	ctx := context.Background()
+	inner := &lengthEmbedder{}
+	cache := NewCachingEmbedder(inner, 10)
+
+	vectors, err := cache.EmbedDocuments(ctx, []string{"a", "bb", "a"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if want := [][]float32{{1}, {2}, {1}}; !reflect.DeepEqual(vectors, want) {
+		t.Errorf("EmbedDocuments() = %v, want %v", vectors, want)
+	}
+	if _, err := cache.EmbedDocuments(ctx, []string{"bb", "ccc"}); err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	// Queries are cached apart from documents
+	for i := 0; i < 2; i++ {
+		if _, err := cache.EmbedQuery(ctx, "a"); err != nil {
+			t.Fatalf("EmbedQuery() error = %v", err)
+		}
+	}
+
+	if want := [][]string{{"a", "bb"}, {"ccc"}, {"a"}}; !reflect.DeepEqual(inner.calls, want) {
+		t.Errorf("embedded texts = %v, want only the misses", inner.calls)
+	}
+	want := CacheStats{Hits: 3, Misses: 4, Size: 4}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := cache.Stats().HitRate(); got != 3.0/7 {
+		t.Errorf("HitRate() = %v, want 3/7", got)
+	}
+}
+
+func TestCachingEmbedder_Evictions(t *testing.T) {
+	ctx := context.Background()
+	inner := &lengthEmbedder{}
+	cache := NewCachingEmbedder(inner, 2)
+
+	for _, text := range []string{"a", "bb", "a", "ccc", "bb"} {
+		if _, err := cache.EmbedDocuments(ctx, []string{text}); err != nil {
+			t.Fatalf("EmbedDocuments() error = %v", err)
+		}
+	}
+
+	// "a" was used more recently than "bb", so "ccc" evicts "bb"
+	want := CacheStats{Hits: 1, Misses: 4, Evictions: 2, Size: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCachingEmbedder_ErrorsNotCached(t *testing.T) {
+	ctx := context.Background()
+	inner := &lengthEmbedder{err: errors.New("boom")}
+	cache := NewCachingEmbedder(inner, 10)
+
+	if _, err := cache.EmbedDocuments(ctx, []string{"a"}); err == nil {
+		t.Fatal("EmbedDocuments() error = nil, want the embedder's error")
+	}
+	inner.err = nil
+	if _, err := cache.EmbedDocuments(ctx, []string{"a"}); err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if got := cache.Stats(); got.Hits != 0 || got.Misses != 2 || got.Size != 1 {
+		t.Errorf("Stats() = %+v, want 2 misses and the successful vector cached", got)
+	}
+}
+
+// shortEmbedder returns one vector fewer than it is asked for
+type shortEmbedder struct {
+	lengthEmbedder
+}
+
+func (e *shortEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	vectors, err := e.lengthEmbedder.EmbedDocuments(ctx, documents)
+	return vectors[:len(vectors)-1], err
+}
+
+func TestCachingEmbedder_EmbeddingCountMismatch(t *testing.T) {
+	cache := NewCachingEmbedder(&shortEmbedder{}, 10)
+
+	_, err := cache.EmbedDocuments(context.Background(), []string{"a", "bb"})
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeAPIError {
+		t.Fatalf("EmbedDocuments() error = %v, want %s", err, ErrCodeAPIError)
+	}
+	if got := cache.Stats(); got.Size != 0 {
+		t.Errorf("Stats() = %+v, want nothing cached", got)
+	}
+}
+
+func TestCachingEmbedder_ReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCachingEmbedder(&lengthEmbedder{}, 10)
+
+	vector, _ := cache.EmbedQuery(ctx, "abc")
+	vector[0] = 100
+	if cached, _ := cache.EmbedQuery(ctx, "abc"); cached[0] != 3 {
+		t.Errorf("EmbedQuery() = %v after the caller modified the first result, want [3]", cached)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for a logger writing from another goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCachingEmbedder_LogsStats(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	cache := NewCachingEmbedder(&lengthEmbedder{}, 10, WithEmbedCacheStats(logger, 5*time.Millisecond))
+	defer cache.Close()
+
+	if _, err := cache.EmbedQuery(context.Background(), "a"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "misses=1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("log = %q, want the stats logged", buf.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !strings.Contains(buf.String(), "embedding cache stats") {
+		t.Errorf("log = %q, want the stats message", buf.String())
+	}
+}
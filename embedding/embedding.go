@@ -12,3 +12,46 @@ type Embedder interface {
 	// EmbedQuery converts a single query text into a vector embedding
 	EmbedQuery(ctx context.Context, text string) ([]float32, error)
 }
+
+// ModelProvider is implemented by embedders that can report the model they use
+type ModelProvider interface {
+	Model() string
+}
+
+// DimensionProvider is implemented by embedders that can be configured to
+// produce vectors of a given size, which models such as text-embedding-3-* and
+// Titan v2 accept. Dimension returns 0 when the model's own size is used.
+type DimensionProvider interface {
+	Dimension() int
+}
+
+// modelDimensions maps well known embedding models to the size of the vectors
+// they produce by default
+var modelDimensions = map[string]int{
+	"text-embedding-ada-002":       1536,
+	"text-embedding-3-small":       1536,
+	"text-embedding-3-large":       3072,
+	"amazon.titan-embed-text-v1":   1536,
+	"amazon.titan-embed-text-v2:0": 1024,
+	"cohere.embed-english-v3":      1024,
+	"cohere.embed-multilingual-v3": 1024,
+}
+
+// ModelDimension returns the known default vector size for a model
+func ModelDimension(model string) (int, bool) {
+	dimension, ok := modelDimensions[model]
+	return dimension, ok
+}
+
+// Dimension returns the size of the vectors embedder produces when it is
+// known: the size it was configured with, or else the default size of the
+// model it reports
+func Dimension(embedder Embedder) (int, bool) {
+	if provider, ok := embedder.(DimensionProvider); ok && provider.Dimension() > 0 {
+		return provider.Dimension(), true
+	}
+	if provider, ok := embedder.(ModelProvider); ok {
+		return ModelDimension(provider.Model())
+	}
+	return 0, false
+}
@@ -0,0 +1,182 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// FallbackOption configures a FallbackEmbedder
+type FallbackOption func(*FallbackEmbedder)
+
+// WithFallbackLogger sets the logger failovers are logged to at warn level
+func WithFallbackLogger(logger *slog.Logger) FallbackOption {
+	return func(f *FallbackEmbedder) {
+		f.logger = logger
+	}
+}
+
+// FallbackEmbedder embeds with a primary embedder, failing over to a
+// secondary one when the primary fails for a reason other than its input,
+// such as an outage or a rate limit, so an ingest isn't lost to a provider
+// being down.
+//
+// Vectors of both embedders end up in the same store, so they must have the
+// same dimension, and should come from models trained to be compatible.
+// Dimensions are validated on first use: when both models report a known
+// dimension they must match, and every vector must have the dimension of the
+// first one returned, or the call fails with ErrCodeInvalidDimensions.
+type FallbackEmbedder struct {
+	primary   Embedder
+	secondary Embedder
+	logger    *slog.Logger
+	model     string
+	output    int // Vector size configured on the primary, 0 for its model's default
+
+	mu        sync.Mutex
+	dimension int // Of the first vector returned, 0 before
+}
+
+// NewFallback creates a FallbackEmbedder using secondary when primary fails
+func NewFallback(primary, secondary Embedder, opts ...FallbackOption) *FallbackEmbedder {
+	f := &FallbackEmbedder{
+		primary:   primary,
+		secondary: secondary,
+	}
+	if modelProvider, ok := primary.(ModelProvider); ok {
+		f.model = modelProvider.Model()
+	}
+	if dimensionProvider, ok := primary.(DimensionProvider); ok {
+		f.output = dimensionProvider.Dimension()
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.logger == nil {
+		f.logger = logging.Discard()
+	}
+	return f
+}
+
+// Model returns the primary embedder's model, if it reports one
+func (f *FallbackEmbedder) Model() string {
+	return f.model
+}
+
+// Dimension returns the primary embedder's configured vector size, if it reports one
+func (f *FallbackEmbedder) Dimension() int {
+	return f.output
+}
+
+func (f *FallbackEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	if err := f.checkModels(); err != nil {
+		return nil, err
+	}
+
+	vectors, err := f.primary.EmbedDocuments(ctx, documents)
+	if err != nil && shouldFailOver(ctx, err) {
+		f.logFailover(ctx, "EmbedDocuments", err)
+		vectors, err = f.secondary.EmbedDocuments(ctx, documents)
+	}
+	if err != nil {
+		return vectors, err
+	}
+	if err := f.checkDimensions("EmbedDocuments", vectors); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+func (f *FallbackEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if err := f.checkModels(); err != nil {
+		return nil, err
+	}
+
+	vector, err := f.primary.EmbedQuery(ctx, text)
+	if err != nil && shouldFailOver(ctx, err) {
+		f.logFailover(ctx, "EmbedQuery", err)
+		vector, err = f.secondary.EmbedQuery(ctx, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkDimensions("EmbedQuery", [][]float32{vector}); err != nil {
+		return nil, err
+	}
+	return vector, nil
+}
+
+// shouldFailOver reports whether the secondary may succeed where the primary
+// failed with err. Rejected inputs would be rejected again, and a canceled
+// call must not be retried.
+func shouldFailOver(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var partial *PartialEmbedError
+	if errors.As(err, &partial) {
+		return false
+	}
+	var embeddingErr *EmbeddingError
+	if errors.As(err, &embeddingErr) && embeddingErr.Code == ErrCodeContextCanceled {
+		return false
+	}
+	return !IsInputError(err)
+}
+
+// checkModels fails when both embedders report models of known, different
+// dimensions, before anything is embedded with either. A dimension configured
+// on an embedder is used instead of its model's default.
+func (f *FallbackEmbedder) checkModels() error {
+	primary, ok := f.primary.(ModelProvider)
+	if !ok {
+		return nil
+	}
+	secondary, ok := f.secondary.(ModelProvider)
+	if !ok {
+		return nil
+	}
+	primaryDim, ok := Dimension(f.primary)
+	if !ok {
+		return nil
+	}
+	if secondaryDim, ok := Dimension(f.secondary); ok && secondaryDim != primaryDim {
+		return NewEmbeddingError("NewFallback", nil, ErrCodeInvalidDimensions,
+			fmt.Sprintf("fallback model %s has %d dimensions, primary model %s has %d",
+				secondary.Model(), secondaryDim, primary.Model(), primaryDim))
+	}
+	return nil
+}
+
+// checkDimensions fails unless every vector has the dimension of the first
+// vector ever returned
+func (f *FallbackEmbedder) checkDimensions(op string, vectors [][]float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, vector := range vectors {
+		if vector == nil {
+			continue
+		}
+		if f.dimension == 0 {
+			f.dimension = len(vector)
+		}
+		if len(vector) != f.dimension {
+			return NewEmbeddingError(op, nil, ErrCodeInvalidDimensions,
+				fmt.Sprintf("got a vector of %d dimensions, want %d: primary and fallback embedders must match", len(vector), f.dimension))
+		}
+	}
+	return nil
+}
+
+func (f *FallbackEmbedder) logFailover(ctx context.Context, op string, err error) {
+	code := ""
+	var embeddingErr *EmbeddingError
+	if errors.As(err, &embeddingErr) {
+		code = embeddingErr.Code
+	}
+	f.logger.WarnContext(ctx, "primary embedder failed, using fallback", "operation", op, "code", code, "error", err)
+}
@@ -0,0 +1,132 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fixedEmbedder embeds every text as vector, or fails with err, counting its
+// calls
+type fixedEmbedder struct {
+	model     string
+	dimension int
+	vector    []float32
+	err       error
+	calls     int
+}
+
+func (e *fixedEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	vectors := make([][]float32, len(documents))
+	for i := range documents {
+		vectors[i] = e.vector
+	}
+	return vectors, nil
+}
+
+func (e *fixedEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	e.calls++
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.vector, nil
+}
+
+func (e *fixedEmbedder) Model() string {
+	return e.model
+}
+
+func (e *fixedEmbedder) Dimension() int {
+	return e.dimension
+}
+
+func TestFallbackEmbedder_FailsOver(t *testing.T) {
+	ctx := context.Background()
+	primary := &fixedEmbedder{err: ErrModelNotAvailable("EmbedDocuments", errors.New("503"))}
+	secondary := &fixedEmbedder{vector: []float32{1, 2}}
+	fallback := NewFallback(primary, secondary)
+
+	vectors, err := fallback.EmbedDocuments(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	if len(vectors) != 2 || len(vectors[0]) != 2 || secondary.calls != 1 {
+		t.Errorf("EmbedDocuments() = %v after %d fallback calls, want the fallback's vectors", vectors, secondary.calls)
+	}
+	if _, err := fallback.EmbedQuery(ctx, "a"); err != nil || secondary.calls != 2 {
+		t.Errorf("EmbedQuery() error = %v after %d fallback calls, want the fallback used", err, secondary.calls)
+	}
+
+	// Once the primary is back it is used again
+	primary.err, primary.vector = nil, []float32{3, 4}
+	if vector, err := fallback.EmbedQuery(ctx, "a"); err != nil || vector[0] != 3 {
+		t.Errorf("EmbedQuery() = %v, %v, want the primary's vector", vector, err)
+	}
+}
+
+func TestFallbackEmbedder_NoFailoverOnInputErrors(t *testing.T) {
+	errInput := ErrInvalidInput("EmbedDocuments", nil, "too long")
+	secondary := &fixedEmbedder{vector: []float32{1, 2}}
+	fallback := NewFallback(&fixedEmbedder{err: errInput}, secondary)
+
+	if _, err := fallback.EmbedDocuments(context.Background(), []string{"a"}); !errors.Is(err, errInput) {
+		t.Errorf("EmbedDocuments() error = %v, want the primary's input error", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fallback = NewFallback(&fixedEmbedder{err: context.Canceled}, secondary)
+	if _, err := fallback.EmbedQuery(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("EmbedQuery() error = %v, want context.Canceled", err)
+	}
+	if secondary.calls != 0 {
+		t.Errorf("fallback calls = %d, want 0", secondary.calls)
+	}
+}
+
+func TestFallbackEmbedder_DimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	primary := &fixedEmbedder{vector: []float32{1, 2, 3}}
+	secondary := &fixedEmbedder{vector: []float32{1, 2}}
+	fallback := NewFallback(primary, secondary)
+
+	if _, err := fallback.EmbedQuery(ctx, "a"); err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	primary.err = ErrRateLimitExceeded("EmbedQuery", nil)
+	_, err := fallback.EmbedQuery(ctx, "a")
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeInvalidDimensions {
+		t.Errorf("EmbedQuery() error = %v, want ErrCodeInvalidDimensions", err)
+	}
+}
+
+func TestFallbackEmbedder_ModelDimensionMismatch(t *testing.T) {
+	primary := &fixedEmbedder{model: "text-embedding-3-large", vector: []float32{1}}
+	secondary := &fixedEmbedder{model: "cohere.embed-english-v3", vector: []float32{1}}
+
+	_, err := NewFallback(primary, secondary).EmbedDocuments(context.Background(), []string{"a"})
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeInvalidDimensions {
+		t.Errorf("EmbedDocuments() error = %v, want ErrCodeInvalidDimensions", err)
+	}
+	if primary.calls != 0 {
+		t.Errorf("primary calls = %d, want none before the models are validated", primary.calls)
+	}
+}
+
+func TestFallbackEmbedder_ConfiguredDimension(t *testing.T) {
+	primary := &fixedEmbedder{model: "text-embedding-3-large", dimension: 1024, vector: []float32{1}}
+	secondary := &fixedEmbedder{model: "cohere.embed-english-v3", vector: []float32{1}}
+
+	fallback := NewLoggingEmbedder(NewFallback(primary, secondary), nil)
+	if got, ok := Dimension(fallback); !ok || got != 1024 {
+		t.Errorf("Dimension() = %d, %v, want the primary's configured 1024", got, ok)
+	}
+	if _, err := fallback.EmbedDocuments(context.Background(), []string{"a"}); err != nil {
+		t.Errorf("EmbedDocuments() error = %v, want the configured dimension to match the fallback model's", err)
+	}
+}
@@ -0,0 +1,112 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// EmbedFunc embeds a batch of documents in one request
+type EmbedFunc func(ctx context.Context, documents []string) ([][]float32, error)
+
+// PartialEmbedError is returned, together with the vectors, by embedders with
+// failure isolation when some inputs were rejected. The vectors of the
+// rejected inputs are nil; every other vector is valid.
+type PartialEmbedError struct {
+	Failed []int   // Indexes of the rejected inputs, ascending
+	Errs   []error // Error of each rejected input, in the order of Failed
+	Total  int     // Number of inputs in the request
+}
+
+// Error implements the error interface
+func (e *PartialEmbedError) Error() string {
+	return fmt.Sprintf("embedding.EmbedDocuments: %d of %d inputs failed: %v", len(e.Failed), e.Total, e.Errs[0])
+}
+
+// Unwrap returns the errors of the rejected inputs
+func (e *PartialEmbedError) Unwrap() []error {
+	return e.Errs
+}
+
+// EmbedIsolated embeds documents in batches of batchSize with embed. When a
+// batch fails because of its input, it is split in halves until the inputs
+// the API rejects are isolated, so they don't fail the rest of the batch.
+// Those are reported by a *PartialEmbedError returned along with the vectors
+// of the others. Errors not caused by the input, such as rate limits, are not
+// retried and fail the call.
+func EmbedIsolated(ctx context.Context, documents []string, batchSize int, embed EmbedFunc) ([][]float32, error) {
+	if batchSize <= 0 {
+		batchSize = len(documents)
+	}
+
+	var ends []int
+	for start := 0; start < len(documents); start += batchSize {
+		ends = append(ends, min(start+batchSize, len(documents)))
+	}
+	return EmbedIsolatedBatches(ctx, documents, ends, embed)
+}
+
+// EmbedIsolatedBatches is EmbedIsolated with one batch ending at each of
+// ends, such as those returned by TokenBatches
+func EmbedIsolatedBatches(ctx context.Context, documents []string, ends []int, embed EmbedFunc) ([][]float32, error) {
+	vectors := make([][]float32, len(documents))
+	partial := &PartialEmbedError{Total: len(documents)}
+	start := 0
+	for _, end := range ends {
+		if err := bisect(ctx, documents, start, end, vectors, partial, embed); err != nil {
+			return nil, err
+		}
+		start = end
+	}
+
+	if len(partial.Failed) > 0 {
+		return vectors, partial
+	}
+	return vectors, nil
+}
+
+// bisect embeds documents[start:end] into vectors, splitting the range when
+// it fails because of its input
+func bisect(ctx context.Context, documents []string, start, end int, vectors [][]float32, partial *PartialEmbedError, embed EmbedFunc) error {
+	if err := ctx.Err(); err != nil {
+		return NewEmbeddingError("EmbedDocuments", err, ErrCodeContextCanceled, "context canceled")
+	}
+
+	batch, err := embed(ctx, documents[start:end])
+	if err == nil {
+		if len(batch) != end-start {
+			return NewEmbeddingError("EmbedDocuments", nil, ErrCodeAPIError,
+				fmt.Sprintf("got %d embeddings for %d inputs", len(batch), end-start))
+		}
+		copy(vectors[start:end], batch)
+		return nil
+	}
+	if !IsInputError(err) {
+		return err
+	}
+
+	if end-start == 1 {
+		partial.Failed = append(partial.Failed, start)
+		partial.Errs = append(partial.Errs, err)
+		return nil
+	}
+	mid := start + (end-start)/2
+	if err := bisect(ctx, documents, start, mid, vectors, partial, embed); err != nil {
+		return err
+	}
+	return bisect(ctx, documents, mid, end, vectors, partial, embed)
+}
+
+// IsInputError reports whether err was caused by the input rather than the
+// API, so retrying with other inputs may succeed
+func IsInputError(err error) bool {
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) {
+		return false
+	}
+	switch embeddingErr.Code {
+	case ErrCodeInvalidInput, ErrCodeTokenLimitExceeded, ErrCodeEmptyInput:
+		return true
+	}
+	return false
+}
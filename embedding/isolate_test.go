@@ -0,0 +1,126 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// poisonedEmbed rejects every batch containing a "poison" input, like an API
+// rejecting a batch with one input over the token limit
+type poisonedEmbed struct {
+	calls int
+	err   error
+}
+
+func (p *poisonedEmbed) embed(ctx context.Context, documents []string) ([][]float32, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	vectors := make([][]float32, len(documents))
+	for i, doc := range documents {
+		if strings.HasPrefix(doc, "poison") {
+			return nil, ErrTokenLimitExceeded("EmbedDocuments", nil)
+		}
+		vectors[i] = []float32{float32(len(doc))}
+	}
+	return vectors, nil
+}
+
+func inputs(n int, poisoned ...int) []string {
+	documents := make([]string, n)
+	for i := range documents {
+		documents[i] = fmt.Sprintf("document %d", i)
+	}
+	for _, i := range poisoned {
+		documents[i] = "poison"
+	}
+	return documents
+}
+
+func TestEmbedIsolated_SkipsPoisonInput(t *testing.T) {
+	documents := inputs(50, 33)
+	embed := &poisonedEmbed{}
+
+	vectors, err := EmbedIsolated(context.Background(), documents, 20, embed.embed)
+
+	var partial *PartialEmbedError
+	if !errors.As(err, &partial) {
+		t.Fatalf("EmbedIsolated() error = %v, want a *PartialEmbedError", err)
+	}
+	if !reflect.DeepEqual(partial.Failed, []int{33}) || partial.Total != 50 {
+		t.Errorf("Failed = %v of %d, want [33] of 50", partial.Failed, partial.Total)
+	}
+	var embeddingErr *EmbeddingError
+	if !errors.As(err, &embeddingErr) || embeddingErr.Code != ErrCodeTokenLimitExceeded {
+		t.Errorf("error = %v, want it to wrap the input's error", err)
+	}
+
+	if len(vectors) != 50 {
+		t.Fatalf("vectors = %d, want 50", len(vectors))
+	}
+	for i, vector := range vectors {
+		if (vector == nil) != (i == 33) {
+			t.Errorf("vector %d = %v", i, vector)
+		}
+	}
+
+	// One request per batch, and two per level of bisecting the poisoned
+	// batch of 20 down to the poison input
+	if embed.calls > 3+2*5 {
+		t.Errorf("embed calls = %d, want the poisoned batch bisected", embed.calls)
+	}
+}
+
+func TestEmbedIsolated_SeveralPoisonInputs(t *testing.T) {
+	documents := inputs(16, 0, 7, 8, 15)
+
+	vectors, err := EmbedIsolated(context.Background(), documents, 0, (&poisonedEmbed{}).embed)
+
+	var partial *PartialEmbedError
+	if !errors.As(err, &partial) || !reflect.DeepEqual(partial.Failed, []int{0, 7, 8, 15}) {
+		t.Fatalf("EmbedIsolated() error = %v, want inputs 0, 7, 8 and 15 failed", err)
+	}
+	if len(partial.Errs) != len(partial.Failed) {
+		t.Errorf("Errs = %d, want one per failed input", len(partial.Errs))
+	}
+	embedded := 0
+	for _, vector := range vectors {
+		if vector != nil {
+			embedded++
+		}
+	}
+	if embedded != 12 {
+		t.Errorf("embedded = %d, want 12", embedded)
+	}
+}
+
+func TestEmbedIsolated_CleanBatch(t *testing.T) {
+	embed := &poisonedEmbed{}
+
+	vectors, err := EmbedIsolated(context.Background(), inputs(10), 4, embed.embed)
+	if err != nil {
+		t.Fatalf("EmbedIsolated() error = %v", err)
+	}
+	if len(vectors) != 10 || embed.calls != 3 {
+		t.Errorf("vectors = %d after %d calls, want 10 after 3", len(vectors), embed.calls)
+	}
+}
+
+func TestEmbedIsolated_DoesNotBisectOtherErrors(t *testing.T) {
+	embed := &poisonedEmbed{err: ErrRateLimitExceeded("EmbedDocuments", nil)}
+
+	vectors, err := EmbedIsolated(context.Background(), inputs(10, 3), 0, embed.embed)
+
+	var partial *PartialEmbedError
+	if err == nil || errors.As(err, &partial) || vectors != nil {
+		t.Errorf("EmbedIsolated() = %v, %v, want the rate limit error", vectors, err)
+	}
+	if embed.calls != 1 {
+		t.Errorf("embed calls = %d, want 1", embed.calls)
+	}
+}
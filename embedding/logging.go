@@ -0,0 +1,74 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// LoggingEmbedder wraps an Embedder, logging every call at debug level and
+// failures at warn level with their error code. Texts are never logged.
+type LoggingEmbedder struct {
+	embedder  Embedder
+	logger    *slog.Logger
+	model     string
+	dimension int
+}
+
+// NewLoggingEmbedder creates a LoggingEmbedder. A nil logger logs nothing.
+func NewLoggingEmbedder(embedder Embedder, logger *slog.Logger) *LoggingEmbedder {
+	if logger == nil {
+		logger = logging.Discard()
+	}
+	l := &LoggingEmbedder{
+		embedder: embedder,
+		logger:   logger,
+	}
+	if modelProvider, ok := embedder.(ModelProvider); ok {
+		l.model = modelProvider.Model()
+	}
+	if dimensionProvider, ok := embedder.(DimensionProvider); ok {
+		l.dimension = dimensionProvider.Dimension()
+	}
+	return l
+}
+
+// Model returns the wrapped embedder's model, if it reports one
+func (l *LoggingEmbedder) Model() string {
+	return l.model
+}
+
+// Dimension returns the wrapped embedder's configured vector size, if it reports one
+func (l *LoggingEmbedder) Dimension() int {
+	return l.dimension
+}
+
+func (l *LoggingEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	start := time.Now()
+	vectors, err := l.embedder.EmbedDocuments(ctx, documents)
+	l.log(ctx, "EmbedDocuments", len(documents), start, err)
+	return vectors, err
+}
+
+func (l *LoggingEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	start := time.Now()
+	vector, err := l.embedder.EmbedQuery(ctx, text)
+	l.log(ctx, "EmbedQuery", 1, start, err)
+	return vector, err
+}
+
+func (l *LoggingEmbedder) log(ctx context.Context, op string, count int, start time.Time, err error) {
+	if err != nil {
+		code := ""
+		var embeddingErr *EmbeddingError
+		if errors.As(err, &embeddingErr) {
+			code = embeddingErr.Code
+		}
+		l.logger.WarnContext(ctx, "embedding failed", "operation", op, "texts", count, "code", code, "error", err)
+		return
+	}
+	l.logger.DebugContext(ctx, "embedding", "operation", op, "texts", count, "duration", time.Since(start))
+}
@@ -0,0 +1,75 @@
+package embedding
+
+import (
+	"context"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
+// MetricsEmbedder wraps an Embedder, recording request counts, latency and batch sizes
+type MetricsEmbedder struct {
+	embedder  Embedder
+	recorder  metrics.Recorder
+	provider  string
+	model     string
+	dimension int
+}
+
+// NewMetricsEmbedder creates a MetricsEmbedder labeling its metrics with provider
+// and, when the embedder reports it, the model
+func NewMetricsEmbedder(embedder Embedder, recorder metrics.Recorder, provider string) *MetricsEmbedder {
+	m := &MetricsEmbedder{
+		embedder: embedder,
+		recorder: recorder,
+		provider: provider,
+	}
+	if modelProvider, ok := embedder.(ModelProvider); ok {
+		m.model = modelProvider.Model()
+	}
+	if dimensionProvider, ok := embedder.(DimensionProvider); ok {
+		m.dimension = dimensionProvider.Dimension()
+	}
+	return m
+}
+
+// Model returns the wrapped embedder's model, if it reports one
+func (m *MetricsEmbedder) Model() string {
+	return m.model
+}
+
+// Dimension returns the wrapped embedder's configured vector size, if it reports one
+func (m *MetricsEmbedder) Dimension() int {
+	return m.dimension
+}
+
+func (m *MetricsEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	start := time.Now()
+	vectors, err := m.embedder.EmbedDocuments(ctx, documents)
+	m.record("embed_documents", len(documents), start, err)
+	return vectors, err
+}
+
+func (m *MetricsEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	start := time.Now()
+	vector, err := m.embedder.EmbedQuery(ctx, text)
+	m.record("embed_query", 1, start, err)
+	return vector, err
+}
+
+func (m *MetricsEmbedder) record(operation string, batchSize int, start time.Time, err error) {
+	m.recorder.Histogram(metrics.EmbeddingBatchSize, float64(batchSize), metrics.Labels{
+		"provider":  m.provider,
+		"model":     m.model,
+		"operation": operation,
+	})
+
+	labels := metrics.Labels{
+		"provider":  m.provider,
+		"model":     m.model,
+		"operation": operation,
+		"status":    metrics.Status(err),
+	}
+	m.recorder.Counter(metrics.EmbeddingRequests, 1, labels)
+	m.recorder.Histogram(metrics.EmbeddingLatency, time.Since(start).Seconds(), labels)
+}
@@ -0,0 +1,63 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
+// stubEmbedder returns zero vectors, or err when set
+type stubEmbedder struct {
+	err error
+}
+
+func (s stubEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return make([][]float32, len(documents)), nil
+}
+
+func (s stubEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return nil, s.err
+}
+
+func (s stubEmbedder) Model() string {
+	return "stub-model"
+}
+
+func TestMetricsEmbedder(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+	}{
+		{name: "Success", wantStatus: metrics.StatusOK},
+		{name: "Error", err: errors.New("boom"), wantStatus: metrics.StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := metrics.NewInMemoryRecorder()
+			embedder := NewMetricsEmbedder(stubEmbedder{err: tt.err}, recorder, "stub")
+
+			embedder.EmbedDocuments(context.Background(), []string{"a", "b", "c"})
+			embedder.EmbedQuery(context.Background(), "q")
+
+			for _, operation := range []string{"embed_documents", "embed_query"} {
+				labels := metrics.Labels{"provider": "stub", "model": "stub-model", "operation": operation, "status": tt.wantStatus}
+				if got := recorder.Sum(metrics.EmbeddingRequests, labels); got != 1 {
+					t.Errorf("%s%v = %v, want 1", metrics.EmbeddingRequests, labels, got)
+				}
+			}
+			if got := recorder.Sum(metrics.EmbeddingBatchSize, metrics.Labels{"operation": "embed_documents"}); got != 3 {
+				t.Errorf("%s = %v, want 3", metrics.EmbeddingBatchSize, got)
+			}
+			if got := len(recorder.Observations(metrics.EmbeddingLatency)); got != 2 {
+				t.Errorf("%s observations = %d, want 2", metrics.EmbeddingLatency, got)
+			}
+		})
+	}
+}
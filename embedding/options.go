@@ -5,6 +5,10 @@ type EmbeddingOptions struct {
 	// Model specifies which embedding model to use
 	Model string
 
+	// Dimensions asks models that support it for vectors of this size
+	// instead of the model's default (0 keeps the default)
+	Dimensions int
+
 	// BatchSize specifies the maximum number of documents to embed in a single request
 	BatchSize int
 
@@ -13,6 +17,22 @@ type EmbeddingOptions struct {
 
 	// Truncate indicates whether to truncate text that exceeds token limits
 	Truncate bool
+
+	// MaxTokensPerBatch packs documents into requests by token count as well
+	// as BatchSize, see TokenBatches (0 disables it)
+	MaxTokensPerBatch int
+
+	// TokenCounter counts the tokens of a document for MaxTokensPerBatch.
+	// Nil uses the tokenizer of the model, for embedders that know it.
+	TokenCounter func(text string) int
+
+	// IsolateFailures makes a batch rejected because of one of its inputs be
+	// split until the rejected inputs are found, see EmbedIsolated
+	IsolateFailures bool
+
+	// ProviderOptions holds options of a specific embedder implementation,
+	// such as how its client connects, which other embedders ignore
+	ProviderOptions []any
 }
 
 // Option is a function type to modify EmbeddingOptions
@@ -25,6 +45,14 @@ func WithModel(model string) Option {
 	}
 }
 
+// WithDimensions asks the model for vectors of size n, for models that accept
+// an output size such as text-embedding-3-* and Titan v2
+func WithDimensions(n int) Option {
+	return func(o *EmbeddingOptions) {
+		o.Dimensions = n
+	}
+}
+
 // WithBatchSize sets the batch size for document embedding
 func WithBatchSize(size int) Option {
 	return func(o *EmbeddingOptions) {
@@ -45,3 +73,37 @@ func WithTruncation(truncate bool) Option {
 		o.Truncate = truncate
 	}
 }
+
+// WithBatchEmbedFailureIsolation sets whether inputs rejected by the API are
+// isolated and skipped instead of failing their whole batch. The skipped
+// inputs are reported by a *PartialEmbedError.
+func WithBatchEmbedFailureIsolation(isolate bool) Option {
+	return func(o *EmbeddingOptions) {
+		o.IsolateFailures = isolate
+	}
+}
+
+// WithMaxTokensPerBatch packs documents into requests of at most n tokens, as
+// well as at most BatchSize documents, so batches of long documents stay
+// under the API's per-request token limit and short ones share requests.
+// Batches the API still rejects for their size are split and retried.
+func WithMaxTokensPerBatch(n int) Option {
+	return func(o *EmbeddingOptions) {
+		o.MaxTokensPerBatch = n
+	}
+}
+
+// WithTokenCounter sets how tokens are counted for WithMaxTokensPerBatch
+func WithTokenCounter(count func(text string) int) Option {
+	return func(o *EmbeddingOptions) {
+		o.TokenCounter = count
+	}
+}
+
+// WithProviderOption adds an option of a specific embedder implementation,
+// see the embedder's own With functions
+func WithProviderOption(opt any) Option {
+	return func(o *EmbeddingOptions) {
+		o.ProviderOptions = append(o.ProviderOptions, opt)
+	}
+}
@@ -0,0 +1,58 @@
+package embedding
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Abraxas-365/kbservice/embedding"
+
+// TracingEmbedder wraps an Embedder, recording a span for every call
+type TracingEmbedder struct {
+	embedder Embedder
+	tracer   trace.Tracer
+	model    string
+}
+
+// NewTracingEmbedder creates a TracingEmbedder that records spans with tp
+func NewTracingEmbedder(embedder Embedder, tp trace.TracerProvider) *TracingEmbedder {
+	t := &TracingEmbedder{
+		embedder: embedder,
+		tracer:   tp.Tracer(tracerName),
+	}
+	if provider, ok := embedder.(ModelProvider); ok {
+		t.model = provider.Model()
+	}
+	return t
+}
+
+func (t *TracingEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	ctx, span := t.tracer.Start(ctx, "embedding.EmbedDocuments", trace.WithAttributes(
+		attribute.Int("embedding.documents", len(documents)),
+	))
+	defer span.End()
+	t.setModel(span)
+
+	vectors, err := t.embedder.EmbedDocuments(ctx, documents)
+	tracing.RecordError(span, err)
+	return vectors, err
+}
+
+func (t *TracingEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	ctx, span := t.tracer.Start(ctx, "embedding.EmbedQuery")
+	defer span.End()
+	t.setModel(span)
+
+	vector, err := t.embedder.EmbedQuery(ctx, text)
+	tracing.RecordError(span, err)
+	return vector, err
+}
+
+func (t *TracingEmbedder) setModel(span trace.Span) {
+	if t.model != "" {
+		span.SetAttributes(attribute.String("embedding.model", t.model))
+	}
+}
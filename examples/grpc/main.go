@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	kbservicev1 "github.com/Abraxas-365/kbservice/proto/kbservice/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// A client for a server that registers grpcserver.NewKnowledgeBaseServer and
+// grpcserver.NewChatHistoryServer
+func main() {
+	addr := flag.String("addr", "localhost:50051", "address of the kbservice gRPC server")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	kbClient := kbservicev1.NewKnowledgeBaseServiceClient(conn)
+	chatClient := kbservicev1.NewChatHistoryServiceClient(conn)
+
+	// Index a document
+	_, err = kbClient.Ingest(ctx, &kbservicev1.IngestRequest{
+		Source: "notes/go.md",
+		Text:   "Go is a statically typed, compiled language designed at Google.",
+	})
+	if err != nil {
+		log.Fatalf("Failed to ingest: %v", err)
+	}
+
+	// Search it
+	fmt.Println("=== Search ===")
+	results, err := kbClient.Search(ctx, &kbservicev1.SearchRequest{Query: "Who designed Go?", Limit: 3})
+	if err != nil {
+		log.Fatalf("Failed to search: %v", err)
+	}
+	for _, doc := range results.GetDocuments() {
+		fmt.Printf("%.2f %s\n", doc.GetScore(), doc.GetPageContent())
+	}
+
+	// Ask a question within a conversation, printing the answer as it streams
+	conv, err := chatClient.CreateConversation(ctx, &kbservicev1.CreateConversationRequest{})
+	if err != nil {
+		log.Fatalf("Failed to create conversation: %v", err)
+	}
+
+	fmt.Println("\n=== Query ===")
+	stream, err := kbClient.Query(ctx, &kbservicev1.QueryRequest{
+		Query:          "Who designed Go?",
+		ConversationId: conv.GetId(),
+	})
+	if err != nil {
+		log.Fatalf("Failed to query: %v", err)
+	}
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Query failed: %v", err)
+		}
+		switch event := resp.GetEvent().(type) {
+		case *kbservicev1.QueryResponse_Sources:
+			fmt.Printf("(%d sources)\n", len(event.Sources.GetDocuments()))
+		case *kbservicev1.QueryResponse_Delta:
+			fmt.Print(event.Delta.GetContent())
+		case *kbservicev1.QueryResponse_Answer:
+			fmt.Printf("\n(stop reason: %s)\n", event.Answer.GetStopReason())
+		}
+	}
+
+	// The question and answer were saved to the conversation
+	messages, err := chatClient.GetMessages(ctx, &kbservicev1.GetMessagesRequest{ConversationId: conv.GetId()})
+	if err != nil {
+		log.Fatalf("Failed to get messages: %v", err)
+	}
+	fmt.Printf("\nConversation %s has %d messages\n", conv.GetId(), len(messages.GetMessages()))
+}
@@ -88,6 +88,34 @@ func main() {
 		},
 	}
 
+	// Run the tools the model calls
+	tools := map[string]llm.ToolFunc{
+		"send_user_data": func(ctx context.Context, call llm.FunctionCall) (string, error) {
+			var userData UserData
+			if err := json.Unmarshal([]byte(call.Arguments), &userData); err != nil {
+				return "", fmt.Errorf("invalid user data: %w", err)
+			}
+
+			// Update conversation metadata with user data
+			err := memory.UpdateConversationMetadata(ctx, conv.ID, map[string]any{
+				"user_data": userData,
+			})
+			if err != nil {
+				return "", err
+			}
+			return "User data saved successfully", nil
+		},
+		"ask_human": func(ctx context.Context, call llm.FunctionCall) (string, error) {
+			var question struct {
+				Question string `json:"question"`
+			}
+			if err := json.Unmarshal([]byte(call.Arguments), &question); err != nil {
+				return "", fmt.Errorf("invalid question: %w", err)
+			}
+			return "Ask the user this question in your reply: " + question.Question, nil
+		},
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println("Welcome to Apple Store Assistant! Type 'exit' to quit.")
 	fmt.Print("You: ")
@@ -115,86 +143,50 @@ func main() {
 			continue
 		}
 
-		// Get AI response
-		response, err := llmClient.Chat(ctx, messages,
-			llm.WithFunctions([]llm.Function{userDataTool, humanTool}),
+		// Stream the AI response, running the tools it calls
+		stream, err := llm.RunToolsStream(ctx, llmClient, messages, tools,
+			llm.WithTools(llm.FunctionTools(userDataTool, humanTool)...),
 		)
 		if err != nil {
 			log.Printf("Error: %v\n", err)
 			continue
 		}
 
-		// Handle function calls
-		if response.FuncCall != nil {
-			switch response.FuncCall.Name {
-			case "send_user_data":
-				var userData UserData
-				if err := json.Unmarshal([]byte(response.FuncCall.Arguments), &userData); err != nil {
-					log.Printf("Error parsing user data: %v\n", err)
-					continue
-				}
-
-				// Update conversation metadata with user data
-				err = memory.UpdateConversationMetadata(ctx, conv.ID, map[string]any{
-					"user_data": userData,
-				})
-				if err != nil {
-					log.Printf("Error updating metadata: %v\n", err)
-				}
-
-				// Add assistant's function call to history
-				err = memory.AddMessage(ctx, conv.ID, *response)
-				if err != nil {
-					log.Printf("Error adding message: %v\n", err)
-				}
-
-				// Add function result to history
-				err = memory.AddMessage(ctx, conv.ID, llm.Message{
-					Role:    llm.RoleFunction,
-					Name:    "send_user_data",
-					Content: "User data saved successfully",
-				})
-				if err != nil {
-					log.Printf("Error adding message: %v\n", err)
-				}
-
-				fmt.Printf("Assistant: Thank you! I've saved your information.\n")
+		fmt.Print("Assistant: ")
+		var reply strings.Builder
+		for resp := range stream {
+			if resp.Error != nil {
+				log.Printf("\nError: %v\n", resp.Error)
+				break
+			}
 
-			case "ask_human":
-				var question struct {
-					Question string `json:"question"`
+			switch {
+			case resp.ToolCallDelta != nil:
+				// The name comes with the first fragment of each call
+				if resp.ToolCallDelta.Name != "" {
+					fmt.Printf("[calling %s...] ", resp.ToolCallDelta.Name)
 				}
-				if err := json.Unmarshal([]byte(response.FuncCall.Arguments), &question); err != nil {
-					log.Printf("Error parsing question: %v\n", err)
-					continue
-				}
-
-				// Add assistant's function call to history
-				err = memory.AddMessage(ctx, conv.ID, *response)
-				if err != nil {
+			case resp.ToolMessage != nil:
+				// Add the tool round to history: the model's calls, then their results
+				if err := memory.AddMessage(ctx, conv.ID, *resp.ToolMessage); err != nil {
 					log.Printf("Error adding message: %v\n", err)
 				}
-
-				fmt.Printf("Assistant: %s\n", question.Question)
-
-				// Add question as assistant message
-				err = memory.AddMessage(ctx, conv.ID, llm.Message{
+				reply.Reset()
+			case resp.Done:
+				// Add assistant's response to history
+				err := memory.AddMessage(ctx, conv.ID, llm.Message{
 					Role:    llm.RoleAssistant,
-					Content: question.Question,
+					Content: reply.String(),
 				})
 				if err != nil {
 					log.Printf("Error adding message: %v\n", err)
 				}
-			}
-		} else if response.Content != "" {
-			fmt.Printf("Assistant: %s\n", response.Content)
-
-			// Add assistant's response to history
-			err = memory.AddMessage(ctx, conv.ID, *response)
-			if err != nil {
-				log.Printf("Error adding message: %v\n", err)
+			default:
+				fmt.Print(resp.Message.Content)
+				reply.WriteString(resp.Message.Content)
 			}
 		}
+		fmt.Println()
 
 		fmt.Print("You: ")
 	}
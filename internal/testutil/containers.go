@@ -0,0 +1,112 @@
+//go:build integration
+
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	// PGVectorImage is the image used for vector store tests, matching docker-compose.yaml
+	PGVectorImage = "ankane/pgvector:v0.5.1"
+	// PostgresImage is the image used for plain Postgres tests
+	PostgresImage = "postgres:16-alpine"
+
+	startupTimeout = 2 * time.Minute
+)
+
+// StartPostgresContainer starts a Postgres container from image and returns its
+// connection string. The container is terminated when the test finishes.
+func StartPostgresContainer(t *testing.T, image string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := postgres.Run(ctx, image,
+		postgres.WithDatabase("kbservice"),
+		postgres.WithUsername("postgres"),
+		postgres.WithPassword("postgres"),
+		testcontainers.WithWaitStrategy(
+			// Postgres restarts once after running init scripts, so wait for the second ready log
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(startupTimeout),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to start %s container: %v", image, err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(context.Background()); err != nil {
+			t.Logf("failed to terminate %s container: %v", image, err)
+		}
+	})
+
+	connString, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("failed to get connection string: %v", err)
+	}
+	return connString
+}
+
+// StartPGVector starts a pgvector container with the vector extension enabled and
+// returns its connection string
+func StartPGVector(t *testing.T) string {
+	t.Helper()
+	connString := StartPostgresContainer(t, PGVectorImage)
+	ApplySchema(t, OpenDB(t, connString), "CREATE EXTENSION IF NOT EXISTS vector")
+	return connString
+}
+
+// PGVectorPool starts a pgvector container and returns a pool connected to it
+func PGVectorPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	pool, err := pgxpool.New(context.Background(), StartPGVector(t))
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// PostgresDB starts a plain Postgres container, applies schema and returns a
+// database handle connected to it
+func PostgresDB(t *testing.T, schema ...string) *sql.DB {
+	t.Helper()
+	db := OpenDB(t, StartPostgresContainer(t, PostgresImage))
+	ApplySchema(t, db, schema...)
+	return db
+}
+
+// OpenDB opens and pings a database/sql handle that is closed when the test finishes
+func OpenDB(t *testing.T, connString string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", connString)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("failed to ping database: %v", err)
+	}
+	return db
+}
+
+// ApplySchema executes each statement in order, failing the test on the first error
+func ApplySchema(t *testing.T, db *sql.DB, schema ...string) {
+	t.Helper()
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(context.Background(), stmt); err != nil {
+			t.Fatalf("failed to apply schema: %v", err)
+		}
+	}
+}
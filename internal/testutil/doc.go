@@ -0,0 +1,9 @@
+// Package testutil holds helpers shared by adapter tests.
+//
+// The container helpers start real databases with testcontainers and only build
+// with the integration tag:
+//
+//	go test -tags integration ./...
+//
+// The conformance suites build without it so in-memory adapters can run them too.
+package testutil
@@ -0,0 +1,172 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// The atomicity check keeps replacing the source until it has done so
+// replaceRounds times and readers have searched it checkReads times
+const (
+	replaceRounds = 100
+	checkReads    = 1000
+)
+
+// StoreFactory returns an empty, initialized store with 3-dimensional vectors
+// for a single conformance test
+type StoreFactory func(t *testing.T) vectorstore.Store
+
+// RunReplaceSourceConformance checks that a store's native ReplaceSource
+// replaces a source atomically. newStore must return a vectorstore.SourceReplacer.
+func RunReplaceSourceConformance(t *testing.T, newStore StoreFactory) {
+	replacer := func(t *testing.T) (vectorstore.Store, vectorstore.SourceReplacer) {
+		t.Helper()
+		store := newStore(t)
+		r, ok := store.(vectorstore.SourceReplacer)
+		if !ok {
+			t.Fatalf("%T does not implement vectorstore.SourceReplacer", store)
+		}
+		return store, r
+	}
+
+	t.Run("Replaces only the given source", func(t *testing.T) {
+		ctx := context.Background()
+		store, r := replacer(t)
+		addGeneration(t, store, "a.txt", "old", 2)
+		addGeneration(t, store, "b.txt", "old", 2)
+
+		docs, vectors := generation("a.txt", "new", 3)
+		if err := r.ReplaceSource(ctx, "a.txt", docs, vectors); err != nil {
+			t.Fatalf("ReplaceSource() error = %v", err)
+		}
+
+		if got := searchSource(t, store, "a.txt"); len(got) != 3 || got[0].Metadata["gen"] != "new" {
+			t.Errorf("a.txt = %v, want 3 new chunks", got)
+		}
+		if got := searchSource(t, store, "b.txt"); len(got) != 2 {
+			t.Errorf("b.txt = %v, want its 2 chunks untouched", got)
+		}
+	})
+
+	t.Run("Replacing with no documents removes the source", func(t *testing.T) {
+		store, r := replacer(t)
+		addGeneration(t, store, "a.txt", "old", 2)
+
+		if err := r.ReplaceSource(context.Background(), "a.txt", nil, nil); err != nil {
+			t.Fatalf("ReplaceSource() error = %v", err)
+		}
+		if got := searchSource(t, store, "a.txt"); len(got) != 0 {
+			t.Errorf("a.txt = %v, want no chunks", got)
+		}
+	})
+
+	t.Run("Readers never see a source half replaced", func(t *testing.T) {
+		ctx := context.Background()
+		store, r := replacer(t)
+		sizes := map[string]int{"even": 4, "odd": 6}
+		addGeneration(t, store, "a.txt", "even", sizes["even"])
+
+		done := make(chan struct{})
+		var reads atomic.Int64
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					docs, err := store.SimilaritySearch(ctx, []float32{1, 0, 0}, 100, vectorstore.Filter{"source": "a.txt"})
+					reads.Add(1)
+					if err == nil {
+						err = checkGeneration(docs, sizes)
+					}
+					if err != nil {
+						select {
+						case errs <- err:
+						default:
+						}
+						return
+					}
+				}
+			}()
+		}
+
+		for i := 0; i < replaceRounds || (reads.Load() < checkReads && len(errs) == 0); i++ {
+			gen := "even"
+			if i%2 == 0 {
+				gen = "odd"
+			}
+			docs, vectors := generation("a.txt", gen, sizes[gen])
+			if err := r.ReplaceSource(ctx, "a.txt", docs, vectors); err != nil {
+				t.Errorf("ReplaceSource() error = %v", err)
+				break
+			}
+		}
+		close(done)
+		wg.Wait()
+
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		default:
+		}
+	})
+}
+
+// generation returns n chunks of source tagged with gen
+func generation(source, gen string, n int) ([]vectorstore.Document, [][]float32) {
+	docs := make([]vectorstore.Document, n)
+	vectors := make([][]float32, n)
+	for i := range docs {
+		docs[i] = vectorstore.Document{
+			PageContent: fmt.Sprintf("%s chunk %d", gen, i),
+			Metadata:    map[string]interface{}{"source": source, "gen": gen},
+		}
+		vectors[i] = []float32{1, 0, 0}
+	}
+	return docs, vectors
+}
+
+func addGeneration(t *testing.T, store vectorstore.Store, source, gen string, n int) {
+	t.Helper()
+	docs, vectors := generation(source, gen, n)
+	if err := store.AddDocuments(context.Background(), docs, vectors); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+}
+
+func searchSource(t *testing.T, store vectorstore.Store, source string) []vectorstore.Document {
+	t.Helper()
+	docs, err := store.SimilaritySearch(context.Background(), []float32{1, 0, 0}, 100, vectorstore.Filter{"source": source})
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	return docs
+}
+
+// checkGeneration reports an error unless docs are exactly one complete generation
+func checkGeneration(docs []vectorstore.Document, sizes map[string]int) error {
+	if len(docs) == 0 {
+		return fmt.Errorf("search found no chunks while the source was being replaced")
+	}
+	gen, _ := docs[0].Metadata["gen"].(string)
+	for _, doc := range docs {
+		if doc.Metadata["gen"] != gen {
+			return fmt.Errorf("search mixed chunks of generations %v and %v", gen, doc.Metadata["gen"])
+		}
+	}
+	if len(docs) != sizes[gen] {
+		return fmt.Errorf("search found %d chunks of generation %s, want %d", len(docs), gen, sizes[gen])
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// Package tracing holds OpenTelemetry helpers shared by the instrumented
+// packages.
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RecordError records err on span and marks the span failed. A nil err
+// leaves the span unchanged.
+func RecordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,171 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// DefaultGroundingPrompt is the system prompt used to check which sentences of
+// an answer are supported by the retrieved documents
+const DefaultGroundingPrompt = "You check answers against the context below. For each numbered sentence of the answer, decide whether the context supports it. Reply with a JSON object of the form {\"verdicts\": [{\"sentence\": 1, \"supported\": true}]}, with one verdict per sentence.\n\nContext:\n"
+
+// DefaultGroundingRevisionPrompt asks the LLM to answer again without the
+// unsupported sentences listed after it
+const DefaultGroundingRevisionPrompt = "Some sentences of your answer are not supported by the context. Answer again using only the context, leaving out these claims:"
+
+// SentenceVerdict is whether a sentence of an answer is supported by the
+// documents it was generated from
+type SentenceVerdict struct {
+	Sentence  string `json:"sentence"`
+	Supported bool   `json:"supported"`
+}
+
+// Grounding is the result of checking an answer against its sources, see
+// WithGroundingCheck
+type Grounding struct {
+	Verdicts []SentenceVerdict `json:"verdicts"`
+	// Score is the fraction of sentences supported, 1 for an empty answer
+	Score float64 `json:"score"`
+	// Regenerated is set when the answer was generated again because the
+	// first one scored below the GroundingThreshold
+	Regenerated bool `json:"regenerated"`
+}
+
+// Unsupported returns the sentences not supported by the sources
+func (g *Grounding) Unsupported() []string {
+	var sentences []string
+	for _, verdict := range g.Verdicts {
+		if !verdict.Supported {
+			sentences = append(sentences, verdict.Sentence)
+		}
+	}
+	return sentences
+}
+
+// groundAnswer checks answer against its sources and, when it scores below the
+// GroundingThreshold, generates it again once from messages without the
+// unsupported sentences, with the options it was first generated with
+func (kb *KnowledgeBase) groundAnswer(ctx context.Context, model llm.LLM, messages []llm.Message, answerOpts []llm.Option, answer *Answer) error {
+	grounding, err := kb.checkGrounding(ctx, model, answer.Sources, answer.Message.Content, &answer.Usage)
+	if err != nil {
+		return err
+	}
+	if grounding.Score >= kb.opts.GroundingThreshold {
+		answer.Grounding = grounding
+		return nil
+	}
+
+	unsupported := grounding.Unsupported()
+	kb.logger.DebugContext(ctx, "regenerating ungrounded answer",
+		"score", grounding.Score,
+		"unsupported", len(unsupported),
+	)
+	revision := append(messages[:len(messages):len(messages)],
+		answer.Message,
+		llm.Message{Role: llm.RoleUser, Content: DefaultGroundingRevisionPrompt + "\n- " + strings.Join(unsupported, "\n- ")},
+	)
+	regenerated, err := model.Chat(ctx, revision, answerOpts...)
+	if err != nil {
+		return err
+	}
+	addUsage(&answer.Usage, regenerated)
+	answer.Message = *regenerated
+	answer.Warning = AnswerWarning(*regenerated)
+
+	// The verdicts describe the answer returned
+	grounding, err = kb.checkGrounding(ctx, model, answer.Sources, regenerated.Content, &answer.Usage)
+	if err != nil {
+		return err
+	}
+	grounding.Regenerated = true
+	answer.Grounding = grounding
+	return nil
+}
+
+// checkGrounding asks model which sentences of answer docs support
+func (kb *KnowledgeBase) checkGrounding(ctx context.Context, model llm.LLM, docs []vectorstore.Document, answer string, usage *llm.Usage) (*Grounding, error) {
+	sentences := splitSentences(answer)
+	if len(sentences) == 0 {
+		return &Grounding{Score: 1}, nil
+	}
+
+	var numbered strings.Builder
+	for i, sentence := range sentences {
+		fmt.Fprintf(&numbered, "%d. %s\n", i+1, sentence)
+	}
+	reply, err := model.Chat(ctx, RAGMessages(DefaultGroundingPrompt, docs, nil, numbered.String()),
+		llm.WithJSONObjectFormat(), llm.WithTemperature(0))
+	if err != nil {
+		return nil, err
+	}
+	addUsage(usage, reply)
+
+	var result struct {
+		Verdicts []struct {
+			Sentence  int  `json:"sentence"`
+			Supported bool `json:"supported"`
+		} `json:"verdicts"`
+	}
+	if err := json.Unmarshal([]byte(reply.Content), &result); err != nil {
+		return nil, fmt.Errorf("grounding check: invalid verdicts: %w", err)
+	}
+
+	// Sentences the model gave no verdict for count as unsupported
+	grounding := &Grounding{Verdicts: make([]SentenceVerdict, len(sentences))}
+	for i, sentence := range sentences {
+		grounding.Verdicts[i].Sentence = sentence
+	}
+	for _, verdict := range result.Verdicts {
+		if verdict.Sentence >= 1 && verdict.Sentence <= len(sentences) {
+			grounding.Verdicts[verdict.Sentence-1].Supported = verdict.Supported
+		}
+	}
+	supported := 0
+	for _, verdict := range grounding.Verdicts {
+		if verdict.Supported {
+			supported++
+		}
+	}
+	grounding.Score = float64(supported) / float64(len(sentences))
+	return grounding, nil
+}
+
+// splitSentences splits text after sentence-ending punctuation followed by
+// whitespace, and at line breaks
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		end := r == '\n' ||
+			(strings.ContainsRune(".!?", r) && (i+1 == len(runes) || unicode.IsSpace(runes[i+1])))
+		if !end {
+			continue
+		}
+		if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i + 1
+	}
+	if sentence := strings.TrimSpace(string(runes[start:])); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// addUsage adds the usage message reports, if any, to total
+func addUsage(total *llm.Usage, message *llm.Message) {
+	usage := message.GetUsage()
+	if usage == nil {
+		return
+	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
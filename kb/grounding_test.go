@@ -0,0 +1,136 @@
+package kb
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+// groundingLLM returns a mock LLM that answers with answers in turn, reporting
+// the sentences containing "mouse" as unsupported when asked to check them.
+// Every reply reports the same usage.
+func groundingLLM(answers ...string) *mocks.LLM {
+	model := mocks.NewLLM("")
+	model.ChatFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+		reply := &llm.Message{Role: llm.RoleAssistant, StopReason: llm.StopReasonStop}
+		reply.SetUsage(&llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+		if !strings.HasPrefix(messages[0].Content, DefaultGroundingPrompt) {
+			reply.Content, answers = answers[0], answers[1:]
+			return reply, nil
+		}
+
+		var verdicts []string
+		for i, line := range strings.Split(strings.TrimSpace(messages[len(messages)-1].Content), "\n") {
+			supported := "true"
+			if strings.Contains(line, "mouse") {
+				supported = "false"
+			}
+			verdicts = append(verdicts, `{"sentence":`+strconv.Itoa(i+1)+`,"supported":`+supported+`}`)
+		}
+		reply.Content = `{"verdicts":[` + strings.Join(verdicts, ",") + `]}`
+		return reply, nil
+	}
+	return model
+}
+
+func TestKnowledgeBase_GroundingCheck(t *testing.T) {
+	ctx := context.Background()
+	const ungrounded = "The X200 costs $499. It ships with a free mouse!"
+	const grounded = "The X200 costs $499."
+
+	newKB := func(t *testing.T, model *mocks.LLM, opts ...Option) *KnowledgeBase {
+		t.Helper()
+		var chat llm.LLM = model
+		knowledgeBase, err := New(mocks.NewEmbedder(16), mocks.NewStore(), fixedSplitter{size: 100}, append([]Option{WithLLM(&chat)}, opts...)...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := knowledgeBase.AddText(ctx, "x200.md", "The Acme X200 price is $499", nil); err != nil {
+			t.Fatalf("AddText() error = %v", err)
+		}
+		return knowledgeBase
+	}
+
+	t.Run("Attaches verdicts", func(t *testing.T) {
+		model := groundingLLM(ungrounded)
+		answer, err := newKB(t, model, WithGroundingCheck()).QueryWithHistory(ctx, nil, "How much is the X200?", 3, nil)
+		if err != nil {
+			t.Fatalf("QueryWithHistory() error = %v", err)
+		}
+
+		want := &Grounding{
+			Verdicts: []SentenceVerdict{
+				{Sentence: "The X200 costs $499.", Supported: true},
+				{Sentence: "It ships with a free mouse!", Supported: false},
+			},
+			Score: 0.5,
+		}
+		if !reflect.DeepEqual(answer.Grounding, want) {
+			t.Errorf("Grounding = %+v, want %+v", answer.Grounding, want)
+		}
+		if answer.Message.Content != ungrounded {
+			t.Errorf("answer = %q, want it kept without a threshold", answer.Message.Content)
+		}
+		if answer.Usage.TotalTokens != 30 {
+			t.Errorf("Usage = %+v, want the answer and the check counted", answer.Usage)
+		}
+		calls := model.Calls("Chat")
+		if len(calls) != 2 || !strings.Contains(calls[1].Args[0].([]llm.Message)[0].Content, "$499") {
+			t.Errorf("Chat calls = %d, want the check given the retrieved documents", len(calls))
+		}
+	})
+
+	t.Run("Regenerates below the threshold", func(t *testing.T) {
+		model := groundingLLM(ungrounded, grounded)
+		answer, err := newKB(t, model, WithGroundingCheck(), WithGroundingThreshold(0.8)).QueryWithHistory(ctx, nil, "How much is the X200?", 3, nil)
+		if err != nil {
+			t.Fatalf("QueryWithHistory() error = %v", err)
+		}
+
+		if answer.Message.Content != grounded {
+			t.Errorf("answer = %q, want the regenerated answer", answer.Message.Content)
+		}
+		if g := answer.Grounding; !g.Regenerated || g.Score != 1 || len(g.Verdicts) != 1 {
+			t.Errorf("Grounding = %+v, want the regenerated answer's verdicts", g)
+		}
+		// Answer, check, regeneration and check of the regenerated answer
+		if want := (llm.Usage{PromptTokens: 40, CompletionTokens: 20, TotalTokens: 60}); answer.Usage != want {
+			t.Errorf("Usage = %+v, want %+v", answer.Usage, want)
+		}
+
+		calls := model.Calls("Chat")
+		if len(calls) != 4 {
+			t.Fatalf("Chat calls = %d, want 4", len(calls))
+		}
+		revision := calls[2].Args[0].([]llm.Message)
+		last := revision[len(revision)-1]
+		if revision[len(revision)-2].Content != ungrounded || !strings.Contains(last.Content, "- It ships with a free mouse!") ||
+			strings.Contains(last.Content, "costs") {
+			t.Errorf("revision messages = %+v, want the first answer then the unsupported claims", revision[len(revision)-2:])
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		model := groundingLLM(ungrounded)
+		answer, err := newKB(t, model).QueryWithHistory(ctx, nil, "How much is the X200?", 3, nil)
+		if err != nil {
+			t.Fatalf("QueryWithHistory() error = %v", err)
+		}
+		if answer.Grounding != nil || model.CallCount("Chat") != 1 || answer.Usage.TotalTokens != 15 {
+			t.Errorf("QueryWithHistory() = %+v after %d calls, want no check", answer, model.CallCount("Chat"))
+		}
+	})
+}
+
+func TestSplitSentences(t *testing.T) {
+	got := splitSentences("It costs $4.99. Really? Yes!\nShips in 2 days")
+	want := []string{"It costs $4.99.", "Really?", "Yes!", "Ships in 2 days"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitSentences() = %q, want %q", got, want)
+	}
+}
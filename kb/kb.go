@@ -2,21 +2,68 @@ package kb
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Abraxas-365/kbservice/datasource"
 	"github.com/Abraxas-365/kbservice/document"
 	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/internal/tracing"
 	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/moderation"
 	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+const tracerName = "github.com/Abraxas-365/kbservice/kb"
+
 // KnowledgeBase represents the main knowledge base system
 type KnowledgeBase struct {
+	// mu guards embedder and vStore, which ReEmbed swaps while searches and
+	// syncs may be running
+	mu       sync.RWMutex
 	embedder embedding.Embedder
 	vStore   *vectorstore.VectorStore
 	store    vectorstore.Store
 	splitter document.Splitter
+	tracer   trace.Tracer
 	opts     *Options
+	// logger is opts.Logger, tagged with trace IDs when TraceIDKey is set
+	logger *slog.Logger
+
+	// tenant is the tenant a view returned by ForTenant is scoped to
+	tenant string
+
+	// syncs is the number of running Sync calls, shared with tenant views
+	syncs *atomic.Int64
+
+	// simhashes holds the SimHash of every document indexed with its content
+	// loaded, for near-duplicate detection. It is shared with tenant views.
+	simhashes *simhashIndex
+}
+
+// simhashIndex holds SimHashes by tenant and source
+type simhashIndex struct {
+	mu     sync.Mutex
+	hashes map[simhashKey]uint64
+	// loaded holds the tenants whose SimHashes were read back from the store
+	loaded map[string]bool
+}
+
+type simhashKey struct {
+	tenant string
+	source string
 }
 
 // New creates a new KnowledgeBase instance with the provided options
@@ -34,25 +81,128 @@ func New(
 		opt(options)
 	}
 
-	// Create vector store with options
-	vStore := vectorstore.New(
-		store,
-		embedder,
-		vectorstore.WithScoreThreshold(options.ScoreThreshold),
-		vectorstore.WithFilters(options.Filters),
-	)
+	if err := validateDimensions(embedder, store, options.ModelDimensions); err != nil {
+		return nil, err
+	}
+	if err := vectorstore.RequireCapabilities(store, options.RequiredCapabilities...); err != nil {
+		return nil, err
+	}
+
+	// Tracing wrappers hide the optional interfaces, so they go on after validation
+	var tp trace.TracerProvider = noop.NewTracerProvider()
+	if options.TracerProvider != nil {
+		tp = options.TracerProvider
+		embedder = embedding.NewTracingEmbedder(embedder, tp)
+		store = vectorstore.NewTracingStore(store, tp)
+	}
 
 	kb := &KnowledgeBase{
-		embedder: embedder,
-		vStore:   vStore,
-		store:    store,
-		splitter: splitter,
-		opts:     options,
+		embedder:  embedder,
+		store:     store,
+		splitter:  splitter,
+		tracer:    tp.Tracer(tracerName),
+		opts:      options,
+		syncs:     new(atomic.Int64),
+		simhashes: &simhashIndex{hashes: make(map[simhashKey]uint64), loaded: make(map[string]bool)},
 	}
+	kb.configure()
 
 	return kb, nil
 }
 
+// configure builds the logger and vector store from the current options
+func (kb *KnowledgeBase) configure() {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	kb.configureLocked()
+}
+
+// configureLocked is configure with kb.mu held
+func (kb *KnowledgeBase) configureLocked() {
+	kb.logger = kb.opts.Logger
+	if kb.opts.TraceIDKey != nil {
+		kb.logger = logging.WithTraceID(kb.logger, kb.opts.TraceIDKey)
+	}
+
+	opts := []vectorstore.Option{
+		vectorstore.WithScoreThreshold(kb.opts.ScoreThreshold),
+		vectorstore.WithFilters(kb.opts.Filters),
+		vectorstore.WithRecorder(kb.opts.Recorder),
+		vectorstore.WithLogger(kb.logger),
+		vectorstore.WithRedactor(kb.opts.Redactor),
+		vectorstore.WithEmbeddingTemplate(kb.opts.EmbeddingTemplate),
+		vectorstore.WithQueryTemplate(kb.opts.QueryTemplate),
+		vectorstore.WithInputTrim(kb.opts.InputTrim),
+	}
+	// Tenant views report metrics under the name of the store they scope
+	if scoped, ok := kb.store.(*tenantStore); ok {
+		opts = append(opts, vectorstore.WithStoreName(scoped.name()))
+	}
+
+	kb.vStore = vectorstore.New(kb.store, kb.embedder, opts...)
+}
+
+// vectorStore returns the vector store built for the current embedder
+func (kb *KnowledgeBase) vectorStore() *vectorstore.VectorStore {
+	kb.mu.RLock()
+	defer kb.mu.RUnlock()
+	return kb.vStore
+}
+
+// currentEmbedder returns the embedder, which ReEmbed may replace
+func (kb *KnowledgeBase) currentEmbedder() embedding.Embedder {
+	kb.mu.RLock()
+	defer kb.mu.RUnlock()
+	return kb.embedder
+}
+
+// validateDimensions checks that the embedder's model produces vectors of the size
+// the store expects. Embedders or stores that don't report a model or dimension,
+// and models without a known dimension, are not checked. A dimension configured
+// on the embedder is checked instead of its model's default.
+func validateDimensions(embedder embedding.Embedder, store vectorstore.Store, overrides map[string]int) error {
+	modelProvider, ok := embedder.(embedding.ModelProvider)
+	if !ok {
+		return nil
+	}
+	dimensionProvider, ok := store.(vectorstore.DimensionProvider)
+	if !ok {
+		return nil
+	}
+
+	model := modelProvider.Model()
+	expected, known := expectedDimension(embedder, overrides)
+	if !known {
+		return nil
+	}
+
+	if got := dimensionProvider.Dimension(); got != expected {
+		return &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeInvalidDimensions,
+			Op:      "New",
+			Store:   "kb",
+			Message: fmt.Sprintf("embedding model %s produces %d dimensions but the store expects %d", model, expected, got),
+		}
+	}
+
+	return nil
+}
+
+// expectedDimension returns the size of the vectors embedder produces when it
+// is known: the size configured on it, else the size overrides or
+// embedding.ModelDimension give for its model
+func expectedDimension(embedder embedding.Embedder, overrides map[string]int) (int, bool) {
+	if provider, ok := embedder.(embedding.DimensionProvider); ok && provider.Dimension() > 0 {
+		return provider.Dimension(), true
+	}
+	if provider, ok := embedder.(embedding.ModelProvider); ok {
+		if dimension, known := overrides[provider.Model()]; known {
+			return dimension, true
+		}
+	}
+	return embedding.Dimension(embedder)
+}
+
 // GetOptions returns a copy of the current options
 func (kb *KnowledgeBase) GetOptions() Options {
 	return *kb.opts
@@ -64,13 +214,7 @@ func (kb *KnowledgeBase) UpdateOptions(opts ...Option) {
 		opt(kb.opts)
 	}
 
-	// Update vector store options
-	kb.vStore = vectorstore.New(
-		kb.store,
-		kb.embedder,
-		vectorstore.WithScoreThreshold(kb.opts.ScoreThreshold),
-		vectorstore.WithFilters(kb.opts.Filters),
-	)
+	kb.configure()
 }
 
 // HasLLM returns whether the knowledge base has an LLM configured
@@ -93,29 +237,154 @@ func (kb *KnowledgeBase) InitStore(ctx context.Context, forceRecreate bool) erro
 	return kb.store.InitDB(ctx, forceRecreate)
 }
 
+// Sync indexes every document from the data source. Sources that implement
+// datasource.ContentStreamer are read as streams and split incrementally, so
+// large documents are never held in memory in full, unless WithMultiLevelSplit
+// is set.
+//
+// A streamed document keeps its old chunks while it is re-indexed when the
+// store matches vectorstore.Conditions: searches find the old chunks, and
+// then the new ones as well, until every new chunk is stored and the old
+// ones are deleted. If reading or embedding it fails, the new chunks are
+// deleted and the old ones stay. Other stores have the old chunks deleted
+// before the stream is read, so searches miss the document until its new
+// chunks are added, and a failure leaves it with no chunks, to be indexed
+// again by the next Sync. Turning WithDeletePartialStreams off keeps the
+// chunks added before the failure instead. Documents that aren't streamed
+// keep their old chunks until the new ones are embedded, see
+// vectorstore.ReplaceSource.
 // TODO: think if we should add filters
-func (kb *KnowledgeBase) Sync(ctx context.Context, ds datasource.DataSource) error {
-	docChan, errChan := ds.Stream(ctx)
+func (kb *KnowledgeBase) Sync(ctx context.Context, ds datasource.DataSource) (err error) {
+	ctx, span := kb.tracer.Start(ctx, "kb.Sync")
+	defer func() {
+		err = kb.withTraceID(ctx, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	kb.opts.Recorder.Gauge(metrics.SyncInProgress, float64(kb.syncs.Add(1)), nil)
+	defer func() {
+		kb.opts.Recorder.Gauge(metrics.SyncInProgress, float64(kb.syncs.Add(-1)), nil)
+	}()
+
+	if err := kb.loadSimHashes(ctx); err != nil {
+		return err
+	}
+
+	streamer, canStream := kb.streamerFor(ds)
+
+	docChan, errChan := ds.Stream(ctx, kb.loadOptions(canStream)...)
 	for {
 		select {
 		case doc, ok := <-docChan:
 			if !ok {
 				return nil
 			}
-			if err := kb.processData(ctx, doc); err != nil {
+
+			// If document exists with same metadata, skip processing
+			upToDate, err := kb.isUpToDate(ctx, doc)
+			if err != nil {
+				kb.recordSyncDocument(ctx, doc, "error", err)
+				return err
+			}
+			if upToDate {
+				kb.recordSyncDocument(ctx, doc, "skipped", nil)
+				continue
+			}
+
+			// A document with no content only clears chunks indexed for it before
+			if !(canStream && doc.Content == "") && kb.isEmpty(doc.Content) {
+				if err := kb.processData(ctx, doc); err != nil {
+					kb.recordSyncDocument(ctx, doc, "error", err)
+					return err
+				}
+				kb.recordSyncDocument(ctx, doc, "empty", nil)
+				continue
+			}
+
+			// Streamed content isn't loaded yet, so only loaded documents are checked
+			if original, distance, ok := kb.nearDuplicate(doc); ok {
+				kb.logger.DebugContext(ctx, "near duplicate",
+					"source", doc.Source,
+					"duplicate_of", original,
+					"distance", distance,
+				)
+				kb.recordSyncDocument(ctx, doc, "duplicate", nil)
+				continue
+			}
+
+			if canStream && doc.Content == "" {
+				err = kb.processStream(ctx, streamer, doc)
+			} else {
+				err = kb.processData(ctx, doc)
+			}
+			if err != nil {
+				kb.recordSyncDocument(ctx, doc, "error", err)
 				return err
 			}
+			kb.recordSyncDocument(ctx, doc, "indexed", nil)
 		case err := <-errChan:
+			if err != nil {
+				kb.logger.ErrorContext(ctx, "sync failed", "code", errorCode(err), "error", err)
+			}
 			return err
 		}
 	}
 }
 
-func (kb *KnowledgeBase) processData(ctx context.Context, doc datasource.Document) error {
-	// Add source to metadata
-	doc.Metadata["source"] = doc.Source
+// loadOptions returns the options Sync and Rebuild stream a data source with
+func (kb *KnowledgeBase) loadOptions(canStream bool) []datasource.Option {
+	var opts []datasource.Option
+	if canStream {
+		opts = append(opts, datasource.WithSkipContent(true))
+	}
+	if len(kb.opts.SyncMetadata) > 0 {
+		opts = append(opts,
+			datasource.WithStaticMetadata(kb.opts.SyncMetadata),
+			datasource.WithStaticMetadataOverride(kb.opts.SyncMetadataOverride),
+		)
+	}
+	return opts
+}
+
+// recordSyncDocument reports what Sync decided to do with a document
+func (kb *KnowledgeBase) recordSyncDocument(ctx context.Context, doc datasource.Document, status string, err error) {
+	kb.opts.Recorder.Counter(metrics.SyncDocuments, 1, metrics.Labels{"status": status})
+
+	if err != nil {
+		kb.logger.ErrorContext(ctx, "sync document failed",
+			"source", doc.Source,
+			"code", errorCode(err),
+			"error", err,
+		)
+		return
+	}
+	kb.logger.DebugContext(ctx, "sync document",
+		"source", doc.Source,
+		"decision", status,
+		"last_modified", doc.Metadata["last_modified"],
+	)
+}
+
+// errorCode returns the code of the library's typed errors
+func errorCode(err error) string {
+	var vsErr *vectorstore.VectorStoreError
+	if errors.As(err, &vsErr) {
+		return string(vsErr.Code)
+	}
+	var embeddingErr *embedding.EmbeddingError
+	if errors.As(err, &embeddingErr) {
+		return embeddingErr.Code
+	}
+	var dsErr *datasource.DataSourceError
+	if errors.As(err, &dsErr) {
+		return dsErr.Code
+	}
+	return ""
+}
 
-	// Check if document exists and needs update
+// isUpToDate reports whether the document is already indexed with the same last_modified
+func (kb *KnowledgeBase) isUpToDate(ctx context.Context, doc datasource.Document) (bool, error) {
 	checkDoc := document.Document{
 		Metadata: map[string]interface{}{
 			"source":        doc.Source,
@@ -123,15 +392,137 @@ func (kb *KnowledgeBase) processData(ctx context.Context, doc datasource.Documen
 		},
 	}
 
-	exists, err := kb.vStore.DocumentExists(ctx, []document.Document{checkDoc})
+	exists, err := kb.vectorStore().DocumentExists(ctx, []document.Document{checkDoc})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// If document exists with same metadata, skip processing
-	if exists[0] {
+	return exists[0], nil
+}
+
+// loadSimHashes reads back the SimHashes stored with the chunks of the
+// tenant's sources the first time it is called for the tenant, so documents
+// indexed by an earlier process are checked for near duplicates too. Stores
+// that can't list sources and get documents leave only the SimHashes of
+// documents indexed since the process started.
+func (kb *KnowledgeBase) loadSimHashes(ctx context.Context) error {
+	if kb.opts.NearDupThreshold <= 0 {
 		return nil
 	}
+	kb.simhashes.mu.Lock()
+	loaded := kb.simhashes.loaded[kb.tenant]
+	kb.simhashes.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	store := vectorstore.Unwrap(kb.store)
+	lister, canList := store.(vectorstore.SourceLister)
+	getter, canGet := store.(vectorstore.DocumentGetter)
+	hashes := make(map[string]uint64)
+	if canList && canGet {
+		sources, err := lister.ListSources(ctx)
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			docs, err := getter.GetDocuments(ctx, vectorstore.Filter{"source": source}, 1)
+			if err != nil {
+				return err
+			}
+			if len(docs) == 0 {
+				continue
+			}
+			// Tenant views keep their own SimHashes
+			if kb.tenant == "" && kb.opts.TenantKey != "" && docs[0].Metadata[kb.opts.TenantKey] != nil {
+				continue
+			}
+			stored, _ := docs[0].Metadata["simhash"].(string)
+			if hash, err := strconv.ParseUint(stored, 16, 64); err == nil {
+				hashes[source] = hash
+			}
+		}
+	}
+
+	kb.simhashes.mu.Lock()
+	defer kb.simhashes.mu.Unlock()
+	for source, hash := range hashes {
+		// SimHashes recorded while loading are newer than the stored ones
+		key := simhashKey{kb.tenant, source}
+		if _, ok := kb.simhashes.hashes[key]; !ok {
+			kb.simhashes.hashes[key] = hash
+		}
+	}
+	kb.simhashes.loaded[kb.tenant] = true
+	return nil
+}
+
+// nearDuplicate reports which indexed source, if any, the document's content is
+// within NearDupThreshold of
+func (kb *KnowledgeBase) nearDuplicate(doc datasource.Document) (string, int, bool) {
+	if kb.opts.NearDupThreshold <= 0 || doc.Content == "" {
+		return "", 0, false
+	}
+
+	hash := document.SimHash(doc.Content)
+
+	kb.simhashes.mu.Lock()
+	defer kb.simhashes.mu.Unlock()
+	for key, indexed := range kb.simhashes.hashes {
+		if key.tenant != kb.tenant || key.source == doc.Source {
+			continue
+		}
+		if distance := document.HammingDistance(hash, indexed); distance <= kb.opts.NearDupThreshold {
+			return key.source, distance, true
+		}
+	}
+	return "", 0, false
+}
+
+// isEmpty reports whether InputTrim drops content
+func (kb *KnowledgeBase) isEmpty(content string) bool {
+	return kb.opts.InputTrim && strings.TrimSpace(content) == ""
+}
+
+// filterContent redacts chunk with the ContentFilter, if one is set
+func (kb *KnowledgeBase) filterContent(chunk document.Document) document.Document {
+	if kb.opts.ContentFilter == nil {
+		return chunk
+	}
+	return kb.opts.ContentFilter.RedactDocument(chunk)
+}
+
+func (kb *KnowledgeBase) processData(ctx context.Context, doc datasource.Document) error {
+	// Add source to metadata, custom sources may leave it nil
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]interface{})
+	}
+	doc.Metadata["source"] = doc.Source
+	if id := kb.traceID(ctx); id != "" {
+		doc.Metadata[TraceIDMetadataKey] = id
+	}
+
+	limited, err := document.LimitSize(document.Document{PageContent: doc.Content, Metadata: doc.Metadata},
+		kb.opts.MaxDocumentBytes, kb.opts.TruncateOversized)
+	if err != nil {
+		return fmt.Errorf("source %s: %w", doc.Source, err)
+	}
+	if len(limited.PageContent) < len(doc.Content) {
+		kb.logger.WarnContext(ctx, "truncated oversized document",
+			"source", doc.Source,
+			"bytes", len(doc.Content),
+			"limit", kb.opts.MaxDocumentBytes,
+		)
+	}
+	doc.Content, doc.Metadata = limited.PageContent, limited.Metadata
+
+	// The fingerprint is stored with the chunks; JSON numbers can't hold all 64 bits
+	trackSimHash := kb.opts.NearDupThreshold > 0 && !kb.isEmpty(doc.Content)
+	var hash uint64
+	if trackSimHash {
+		hash = document.SimHash(doc.Content)
+		doc.Metadata["simhash"] = strconv.FormatUint(hash, 16)
+	}
 
 	// Create document for splitting
 	docu := document.Document{
@@ -140,23 +531,143 @@ func (kb *KnowledgeBase) processData(ctx context.Context, doc datasource.Documen
 	}
 
 	// Split document into chunks
-	chunks, err := document.SplitDocuments(kb.splitter, []document.Document{docu})
+	chunks, err := kb.splitDocument(doc, docu)
 	if err != nil {
 		return err
 	}
+	for i, chunk := range chunks {
+		chunk.Metadata[ParentIDMetadataKey] = doc.Source
+		chunks[i] = kb.filterContent(chunk)
+	}
 
-	// Delete existing document chunks if any (regardless of last_modified)
-	filter := vectorstore.Filter{
-		"source": doc.Source,
+	// Replace existing document chunks if any (regardless of last_modified),
+	// atomically when the store supports it
+	if err := kb.vectorStore().ReplaceSource(ctx, doc.Source, chunks); err != nil {
+		return err
+	}
+
+	if trackSimHash {
+		kb.simhashes.mu.Lock()
+		kb.simhashes.hashes[simhashKey{kb.tenant, doc.Source}] = hash
+		kb.simhashes.mu.Unlock()
+	}
+
+	return nil
+}
+
+// IndexRunMetadataKey holds the ID of the run that indexed a streamed chunk,
+// telling the chunks of a re-index apart from the ones they replace
+const IndexRunMetadataKey = "index_run"
+
+// processStream indexes a document whose content is read from the data source
+// as a stream, embedding chunks in batches as they are split. With a store
+// that matches Conditions, the new chunks are tagged with IndexRunMetadataKey
+// and added next to the old ones, which are deleted once every new chunk is
+// stored; if indexing fails, the new chunks are deleted instead. Other stores
+// have the old chunks deleted first.
+func (kb *KnowledgeBase) processStream(ctx context.Context, streamer datasource.ContentStreamer, doc datasource.Document) error {
+	// Add source to metadata, custom sources may leave it nil
+	if doc.Metadata == nil {
+		doc.Metadata = make(map[string]interface{})
 	}
-	if err := kb.vStore.Delete(ctx, filter); err != nil {
+	doc.Metadata["source"] = doc.Source
+	if id := kb.traceID(ctx); id != "" {
+		doc.Metadata[TraceIDMetadataKey] = id
+	}
+
+	content, err := streamer.StreamContent(ctx, doc.Source)
+	if err != nil {
 		return err
 	}
+	defer content.Close()
+
+	var reader io.Reader = content
+	var limited *document.SizeLimitedReader
+	if kb.opts.MaxDocumentBytes > 0 {
+		limited = &document.SizeLimitedReader{
+			R:        content,
+			Limit:    int64(kb.opts.MaxDocumentBytes),
+			Truncate: kb.opts.TruncateOversized,
+		}
+		reader = limited
+	}
 
-	// Add new chunks
-	if err := kb.vStore.AddDocuments(ctx, chunks); err != nil {
+	// added selects the chunks this run adds, which are all of the source's
+	// chunks once the old ones are deleted up front
+	added := vectorstore.Filter{
+		"source": doc.Source,
+	}
+	run := ""
+	if vectorstore.Capabilities(kb.store).Conditions {
+		run = uuid.NewString()
+		added[IndexRunMetadataKey] = run
+	} else {
+		if err := kb.vectorStore().Delete(ctx, added); err != nil {
+			return err
+		}
+		kb.forgetSimHash(doc.Source)
+	}
+
+	batchSize := kb.opts.StreamBatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	batch := make([]document.Document, 0, batchSize)
+	index := 0
+	err = document.SplitReader(kb.splitterFor(doc), reader, doc.Metadata, kb.opts.StreamWindowSize, func(chunk document.Document) error {
+		// Truncation is only known once the limit is read, so earlier chunks aren't flagged
+		if limited != nil && limited.Truncated {
+			chunk.Metadata[document.TruncatedMetadataKey] = true
+		}
+		chunk.Metadata[ChunkIndexMetadataKey] = index
+		chunk.Metadata[ParentIDMetadataKey] = doc.Source
+		if run != "" {
+			chunk.Metadata[IndexRunMetadataKey] = run
+		}
+		index++
+		batch = append(batch, kb.filterContent(chunk))
+		if len(batch) < batchSize {
+			return nil
+		}
+		if err := kb.vectorStore().AddDocuments(ctx, batch); err != nil {
+			return err
+		}
+		batch = make([]document.Document, 0, batchSize)
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = kb.vectorStore().AddDocuments(ctx, batch)
+	}
+	if err == nil && run != "" {
+		// Every new chunk is stored, so the ones of earlier runs can go
+		stale := vectorstore.NewFilter().Eq("source", doc.Source).Ne(IndexRunMetadataKey, run).Build()
+		err = kb.vectorStore().Delete(ctx, stale)
+	}
+	tooLarge := errors.Is(err, document.ErrDocumentTooLarge)
+	if tooLarge {
+		err = fmt.Errorf("source %s: %w", doc.Source, err)
+	}
+	if err != nil {
+		if run == "" && !tooLarge && !kb.opts.DeletePartialStreams {
+			return err
+		}
+		// Don't leave the chunks added before the failure, or before the limit
+		// was reached. They go even when ctx is why indexing failed.
+		if deleteErr := kb.vectorStore().Delete(context.WithoutCancel(ctx), added); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
 		return err
 	}
+	if run != "" {
+		kb.forgetSimHash(doc.Source)
+	}
+	if limited != nil && limited.Truncated {
+		kb.logger.WarnContext(ctx, "truncated oversized document",
+			"source", doc.Source,
+			"limit", kb.opts.MaxDocumentBytes,
+		)
+	}
 
 	return nil
 }
@@ -167,5 +678,168 @@ func (kb *KnowledgeBase) SimilaritySearch(
 	limit int,
 	filter vectorstore.Filter,
 ) ([]vectorstore.Document, error) {
-	return kb.vStore.SimilaritySearch(ctx, query, limit, filter)
+	ctx, span := kb.tracer.Start(ctx, "kb.SimilaritySearch", trace.WithAttributes(
+		attribute.Int("kb.limit", limit),
+	))
+	defer span.End()
+
+	result, err := kb.search(ctx, query, limit, filter)
+	err = kb.withTraceID(ctx, err)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("kb.results", len(result.Documents)))
+	return result.Documents, nil
+}
+
+// Retrieve searches the documents to answer query from. With
+// RefuseWithoutContext set, a search that finds nothing scoring at least the
+// score threshold fails with a *NoContextError, which matches
+// ErrNoRelevantContext and holds the best score the threshold rejected.
+func (kb *KnowledgeBase) Retrieve(
+	ctx context.Context,
+	query string,
+	limit int,
+	filter vectorstore.Filter,
+) ([]vectorstore.Document, error) {
+	ctx, span := kb.tracer.Start(ctx, "kb.Retrieve", trace.WithAttributes(
+		attribute.Int("kb.limit", limit),
+	))
+	defer span.End()
+
+	result, err := kb.search(ctx, query, limit, filter)
+	if err == nil && len(result.Documents) == 0 && kb.opts.RefuseWithoutContext {
+		err = &NoContextError{
+			Rejected:  result.Rejected,
+			BestScore: result.BestRejectedScore,
+			Threshold: kb.opts.ScoreThreshold,
+		}
+	}
+	err = kb.withTraceID(ctx, err)
+	tracing.RecordError(span, err)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("kb.results", len(result.Documents)))
+	return result.Documents, nil
+}
+
+// search screens query with the Moderator, if any, and searches the store
+func (kb *KnowledgeBase) search(ctx context.Context, query string, limit int, filter vectorstore.Filter) (*vectorstore.SearchResult, error) {
+	if kb.opts.Moderator != nil {
+		if err := moderation.Screen(ctx, kb.opts.Moderator, query, kb.opts.ModerationFailOpen); err != nil {
+			return nil, err
+		}
+	}
+	return kb.vectorStore().Search(ctx, query, limit, filter)
+}
+
+// EmbedQuery returns the configured embedder's vector for a query
+func (kb *KnowledgeBase) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vector, err := kb.currentEmbedder().EmbedQuery(ctx, text)
+	return vector, kb.withTraceID(ctx, err)
+}
+
+// EmbedDocuments returns the configured embedder's vectors for texts, in order
+func (kb *KnowledgeBase) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors, err := kb.currentEmbedder().EmbedDocuments(ctx, texts)
+	return vectors, kb.withTraceID(ctx, err)
+}
+
+// AddText indexes text under the given source, replacing any chunks already
+// indexed for it
+func (kb *KnowledgeBase) AddText(ctx context.Context, source, text string, metadata map[string]interface{}) (err error) {
+	ctx, span := kb.tracer.Start(ctx, "kb.AddText")
+	defer func() {
+		err = kb.withTraceID(ctx, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if source == "" {
+		return &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeAddFailed,
+			Op:      "AddText",
+			Store:   "kb",
+			Message: "source is required",
+		}
+	}
+
+	docMetadata := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		docMetadata[k] = v
+	}
+
+	return kb.processData(ctx, datasource.Document{
+		Content:  text,
+		Metadata: docMetadata,
+		Source:   source,
+	})
+}
+
+// DeleteSource removes every chunk indexed for the source
+func (kb *KnowledgeBase) DeleteSource(ctx context.Context, source string) error {
+	if err := kb.vectorStore().Delete(ctx, vectorstore.Filter{"source": source}); err != nil {
+		return kb.withTraceID(ctx, err)
+	}
+	kb.forgetSimHash(source)
+	return nil
+}
+
+// DeleteByMetadata removes every chunk whose metadata matches filter. It
+// returns the number of chunks removed, or -1 when the store can't count them
+// (see vectorstore.CountingDeleter). An empty filter is rejected rather than
+// deleting everything.
+func (kb *KnowledgeBase) DeleteByMetadata(ctx context.Context, filter vectorstore.Filter) (int, error) {
+	if len(filter) == 0 {
+		return 0, vectorstore.NewInvalidFilterError("kb", "empty filter")
+	}
+
+	removed, err := kb.vectorStore().DeleteCount(ctx, filter)
+	if err != nil {
+		return 0, kb.withTraceID(ctx, err)
+	}
+	if source, ok := filter["source"].(string); ok {
+		kb.forgetSimHash(source)
+	} else if removed != 0 {
+		// The removed sources aren't known, so the tenant's SimHashes are
+		// loaded again from what is left
+		kb.reloadSimHashes()
+	}
+	return removed, nil
+}
+
+func (kb *KnowledgeBase) forgetSimHash(source string) {
+	kb.simhashes.mu.Lock()
+	delete(kb.simhashes.hashes, simhashKey{kb.tenant, source})
+	kb.simhashes.mu.Unlock()
+}
+
+// reloadSimHashes drops the tenant's SimHashes so the next Sync loads them
+// from the store
+func (kb *KnowledgeBase) reloadSimHashes() {
+	kb.simhashes.mu.Lock()
+	defer kb.simhashes.mu.Unlock()
+	for key := range kb.simhashes.hashes {
+		if key.tenant == kb.tenant {
+			delete(kb.simhashes.hashes, key)
+		}
+	}
+	delete(kb.simhashes.loaded, kb.tenant)
+}
+
+// ListSources returns the sources with indexed documents. The store must
+// implement vectorstore.SourceLister.
+func (kb *KnowledgeBase) ListSources(ctx context.Context) ([]string, error) {
+	lister, ok := vectorstore.Unwrap(kb.store).(vectorstore.SourceLister)
+	if !ok {
+		return nil, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "ListSources",
+			Store:   "kb",
+			Message: "store does not support listing sources",
+		}
+	}
+	return lister.ListSources(ctx)
 }
@@ -0,0 +1,930 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	vectors := make([][]float32, len(documents))
+	for i := range documents {
+		vectors[i] = []float32{1, 0, 0}
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0, 0}, nil
+}
+
+// fakeStore records added documents and calls onAdd after every batch
+type fakeStore struct {
+	docs    []vectorstore.Document
+	deletes []vectorstore.Filter
+	onAdd   func(batch []vectorstore.Document)
+}
+
+func (s *fakeStore) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
+	s.docs = append(s.docs, docs...)
+	if s.onAdd != nil {
+		s.onAdd(docs)
+	}
+	return nil
+}
+
+func (s *fakeStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	s.deletes = append(s.deletes, filter)
+	return nil
+}
+
+func (s *fakeStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return nil
+}
+
+func (s *fakeStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	return make([]bool, len(docs)), nil
+}
+
+// countingReader generates size bytes of text and counts how much has been read
+type countingReader struct {
+	size int
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && r.read < r.size {
+		p[n] = 'a' + byte(r.read%26)
+		n++
+		r.read++
+	}
+	return n, nil
+}
+
+func (r *countingReader) Close() error {
+	return nil
+}
+
+// streamingSource serves a single large document through StreamContent
+type streamingSource struct {
+	reader      *countingReader
+	skipContent bool
+}
+
+func (s *streamingSource) Load(ctx context.Context, opts ...datasource.Option) ([]datasource.Document, error) {
+	return nil, nil
+}
+
+func (s *streamingSource) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
+	options := &datasource.LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	s.skipContent = options.SkipContent
+
+	docChan := make(chan datasource.Document, 1)
+	errChan := make(chan error, 1)
+	docChan <- datasource.Document{
+		Source:   "mem://large",
+		Metadata: map[string]interface{}{"last_modified": "2024-01-01T00:00:00Z"},
+	}
+	close(docChan)
+	return docChan, errChan
+}
+
+func (s *streamingSource) StreamContent(ctx context.Context, source string) (io.ReadCloser, error) {
+	return s.reader, nil
+}
+
+// fixedSplitter cuts text into fixed-size chunks without dropping any bytes
+type fixedSplitter struct {
+	size int
+}
+
+func (s fixedSplitter) SplitText(text string) ([]string, error) {
+	var chunks []string
+	for len(text) > s.size {
+		chunks = append(chunks, text[:s.size])
+		text = text[s.size:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks, nil
+}
+
+func TestKnowledgeBase_SyncStreamsContent(t *testing.T) {
+	const (
+		size       = 4 * 1024 * 1024
+		windowSize = 8 * 1024
+		chunkSize  = 1000
+		batchSize  = 10
+	)
+
+	source := &streamingSource{reader: &countingReader{size: size}}
+	store := &fakeStore{}
+
+	stored := 0
+	maxAhead := 0
+	store.onAdd = func(batch []vectorstore.Document) {
+		if len(batch) > batchSize {
+			t.Errorf("AddDocuments() batch of %d, want at most %d", len(batch), batchSize)
+		}
+		for _, doc := range batch {
+			stored += len(doc.PageContent)
+		}
+		if ahead := source.reader.read - stored; ahead > maxAhead {
+			maxAhead = ahead
+		}
+	}
+
+	knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: chunkSize},
+		WithStreamWindowSize(windowSize),
+		WithStreamBatchSize(batchSize),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(context.Background(), source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if !source.skipContent {
+		t.Error("Sync() did not ask the source to skip content")
+	}
+	if stored != size {
+		t.Errorf("Sync() stored %d bytes, want %d", stored, size)
+	}
+	if len(store.deletes) != 1 || store.deletes[0]["source"] != "mem://large" {
+		t.Errorf("Sync() deletes = %v, want one delete for mem://large", store.deletes)
+	}
+	for _, doc := range store.docs {
+		if doc.Metadata["source"] != "mem://large" {
+			t.Fatalf("chunk metadata = %v, want source mem://large", doc.Metadata)
+		}
+	}
+	// Only the current window and one pending batch may be held in memory
+	if limit := windowSize + batchSize*chunkSize; maxAhead > limit {
+		t.Errorf("Sync() buffered %d bytes, want at most %d", maxAhead, limit)
+	}
+}
+
+// modelEmbedder reports the embedding model it uses and the vector size it
+// is configured with
+type modelEmbedder struct {
+	fakeEmbedder
+	model     string
+	dimension int
+}
+
+func (e modelEmbedder) Model() string {
+	return e.model
+}
+
+func (e modelEmbedder) Dimension() int {
+	return e.dimension
+}
+
+// dimensionStore reports a fixed vector dimension
+type dimensionStore struct {
+	fakeStore
+	dimension int
+}
+
+func (s *dimensionStore) Dimension() int {
+	return s.dimension
+}
+
+func TestNew_ValidatesModelDimension(t *testing.T) {
+	tests := []struct {
+		name       string
+		model      string
+		configured int
+		dimension  int
+		overrides  map[string]int
+		wantErr    bool
+	}{
+		{
+			name:      "Matching model and dimension",
+			model:     "text-embedding-3-large",
+			dimension: 3072,
+			wantErr:   false,
+		},
+		{
+			name:      "Mismatching model and dimension",
+			model:     "text-embedding-ada-002",
+			dimension: 3072,
+			wantErr:   true,
+		},
+		{
+			name:       "Configured dimension replaces the model's",
+			model:      "text-embedding-3-small",
+			configured: 256,
+			dimension:  256,
+			wantErr:    false,
+		},
+		{
+			name:       "Mismatching configured dimension",
+			model:      "text-embedding-3-small",
+			configured: 256,
+			dimension:  1536,
+			wantErr:    true,
+		},
+		{
+			name:      "Unknown model is not checked",
+			model:     "my-custom-model",
+			dimension: 42,
+			wantErr:   false,
+		},
+		{
+			name:      "Override for custom model",
+			model:     "my-custom-model",
+			dimension: 42,
+			overrides: map[string]int{"my-custom-model": 768},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(
+				modelEmbedder{model: tt.model, dimension: tt.configured},
+				&dimensionStore{dimension: tt.dimension},
+				fixedSplitter{size: 100},
+				WithEmbeddingModelDimensionMap(tt.overrides),
+			)
+			if tt.wantErr {
+				var vsErr *vectorstore.VectorStoreError
+				if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeInvalidDimensions {
+					t.Errorf("New() error = %v, want invalid dimensions error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("New() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_SyncFromDataStore(t *testing.T) {
+	ctx := context.Background()
+	objects := inmemory.NewInMemoryDataStore()
+	for _, key := range []string{"docs/a.txt", "docs/b.txt"} {
+		if err := objects.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	store := &fakeStore{}
+	knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 1000})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(ctx, datasource.NewDataStoreSource(objects, "docs/")); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(store.docs) != 2 {
+		t.Fatalf("Sync() stored %d chunks, want 2", len(store.docs))
+	}
+	for _, doc := range store.docs {
+		if doc.PageContent != "content of "+doc.Metadata["source"].(string) {
+			t.Errorf("chunk %q does not match source %v", doc.PageContent, doc.Metadata["source"])
+		}
+	}
+}
+
+// upToDateStore reports every document as already indexed
+type upToDateStore struct {
+	fakeStore
+}
+
+func (s *upToDateStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	exists := make([]bool, len(docs))
+	for i := range exists {
+		exists[i] = true
+	}
+	return exists, nil
+}
+
+func TestKnowledgeBase_SyncRecordsMetrics(t *testing.T) {
+	ctx := context.Background()
+	objects := inmemory.NewInMemoryDataStore()
+	for _, key := range []string{"docs/a.txt", "docs/b.txt"} {
+		if err := objects.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		store      vectorstore.Store
+		wantStatus string
+	}{
+		{name: "New documents are indexed", store: &fakeStore{}, wantStatus: "indexed"},
+		{name: "Unchanged documents are skipped", store: &upToDateStore{}, wantStatus: "skipped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := metrics.NewInMemoryRecorder()
+			knowledgeBase, err := New(fakeEmbedder{}, tt.store, fixedSplitter{size: 1000}, WithRecorder(recorder))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if err := knowledgeBase.Sync(ctx, datasource.NewDataStoreSource(objects, "docs/")); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+
+			if got := recorder.Sum(metrics.SyncDocuments, metrics.Labels{"status": tt.wantStatus}); got != 2 {
+				t.Errorf("%s{status=%s} = %v, want 2", metrics.SyncDocuments, tt.wantStatus, got)
+			}
+			gauges := recorder.Observations(metrics.SyncInProgress)
+			if len(gauges) != 2 || gauges[0].Value != 1 || gauges[1].Value != 0 {
+				t.Errorf("%s = %v, want 1 then 0", metrics.SyncInProgress, gauges)
+			}
+			if len(recorder.Observations(metrics.VectorStoreLatency)) == 0 {
+				t.Errorf("no %s observations", metrics.VectorStoreLatency)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_SyncLogsDecisions(t *testing.T) {
+	ctx := context.Background()
+	objects := inmemory.NewInMemoryDataStore()
+	if err := objects.Put(ctx, "docs/a.txt", strings.NewReader("content")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	knowledgeBase, err := New(fakeEmbedder{}, &upToDateStore{}, fixedSplitter{size: 1000}, WithLogger(logger))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(ctx, datasource.NewDataStoreSource(objects, "docs/")); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if want := "source=docs/a.txt decision=skipped"; !strings.Contains(buf.String(), want) {
+		t.Errorf("log output %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestKnowledgeBase_AddText(t *testing.T) {
+	store := &fakeStore{}
+	knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 4})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	metadata := map[string]interface{}{"lang": "en"}
+	if err := knowledgeBase.AddText(context.Background(), "notes/1", "abcdefgh", metadata); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	if len(store.docs) != 2 {
+		t.Fatalf("indexed %d chunks, want 2", len(store.docs))
+	}
+	for _, doc := range store.docs {
+		if doc.Metadata["source"] != "notes/1" || doc.Metadata["lang"] != "en" {
+			t.Errorf("chunk metadata = %v, want source and lang", doc.Metadata)
+		}
+	}
+	if len(store.deletes) != 1 || store.deletes[0]["source"] != "notes/1" {
+		t.Errorf("deletes = %v, want previous chunks of notes/1 removed", store.deletes)
+	}
+	if _, ok := metadata["source"]; ok {
+		t.Error("AddText() modified the caller's metadata")
+	}
+
+	var vsErr *vectorstore.VectorStoreError
+	if err := knowledgeBase.AddText(context.Background(), "", "text", nil); !errors.As(err, &vsErr) {
+		t.Errorf("AddText() without source error = %v, want VectorStoreError", err)
+	}
+}
+
+func TestKnowledgeBase_ListSourcesNotSupported(t *testing.T) {
+	knowledgeBase, err := New(fakeEmbedder{}, &fakeStore{}, fixedSplitter{size: 4})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	_, err = knowledgeBase.ListSources(context.Background())
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("ListSources() error = %v, want %s", err, vectorstore.ErrCodeNotSupported)
+	}
+}
+
+// sliceSource serves documents with their content loaded
+type sliceSource struct {
+	docs []datasource.Document
+}
+
+func (s sliceSource) Load(ctx context.Context, opts ...datasource.Option) ([]datasource.Document, error) {
+	return s.docs, nil
+}
+
+func (s sliceSource) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
+	docChan := make(chan datasource.Document, len(s.docs))
+	errChan := make(chan error, 1)
+	for _, doc := range s.docs {
+		docChan <- doc
+	}
+	close(docChan)
+	return docChan, errChan
+}
+
+func TestKnowledgeBase_SyncSkipsNearDuplicates(t *testing.T) {
+	source := sliceSource{docs: []datasource.Document{
+		{
+			Source:   "news/a",
+			Content:  "The city council approved the new budget on Tuesday, allocating more funds to public transport and road maintenance. The mayor said the plan would reduce congestion over the next five years and improve air quality across the region.",
+			Metadata: map[string]interface{}{},
+		},
+		{
+			Source:   "mirror/a",
+			Content:  "The city council approved the new budget on Tuesday, allocating additional funds to public transport and road maintenance. The mayor said the plan will reduce congestion over the next five years and improve air quality across the region.",
+			Metadata: map[string]interface{}{},
+		},
+		{
+			Source:   "news/b",
+			Content:  "Researchers discovered a new species of frog in the rainforest, noting its unusual bright blue skin and a distinctive call that can be heard from far away at night during the rainy season.",
+			Metadata: map[string]interface{}{},
+		},
+	}}
+
+	store := &fakeStore{}
+	recorder := metrics.NewInMemoryRecorder()
+	knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 1000}, WithNearDupThreshold(12), WithRecorder(recorder))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(context.Background(), source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	var sources []string
+	for _, doc := range store.docs {
+		sources = append(sources, doc.Metadata["source"].(string))
+		if _, ok := doc.Metadata["simhash"].(string); !ok {
+			t.Errorf("chunk of %v has no stored simhash", doc.Metadata["source"])
+		}
+	}
+	if got := strings.Join(sources, ","); got != "news/a,news/b" {
+		t.Errorf("indexed sources = %s, want news/a,news/b", got)
+	}
+	if got := recorder.Sum(metrics.SyncDocuments, metrics.Labels{"status": "duplicate"}); got != 1 {
+		t.Errorf("%s{status=duplicate} = %v, want 1", metrics.SyncDocuments, got)
+	}
+}
+
+// listingStore is a mocks.Store that lists the sources it holds
+type listingStore struct {
+	*mocks.Store
+}
+
+func (s listingStore) ListSources(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	var sources []string
+	for _, doc := range s.Documents() {
+		if source := doc.Metadata["source"].(string); !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+func TestKnowledgeBase_SyncLoadsStoredSimHashes(t *testing.T) {
+	original := datasource.Document{
+		Source:   "news/a",
+		Content:  "The city council approved the new budget on Tuesday, allocating more funds to public transport and road maintenance. The mayor said the plan would reduce congestion over the next five years and improve air quality across the region.",
+		Metadata: map[string]interface{}{},
+	}
+	mirror := datasource.Document{
+		Source:   "mirror/a",
+		Content:  "The city council approved the new budget on Tuesday, allocating additional funds to public transport and road maintenance. The mayor said the plan will reduce congestion over the next five years and improve air quality across the region.",
+		Metadata: map[string]interface{}{},
+	}
+	store := listingStore{mocks.NewStore()}
+
+	first, err := New(fakeEmbedder{}, store, fixedSplitter{size: 1000}, WithNearDupThreshold(12))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := first.Sync(context.Background(), sliceSource{docs: []datasource.Document{original}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	// A knowledge base started later only knows the SimHashes from the store
+	recorder := metrics.NewInMemoryRecorder()
+	second, err := New(fakeEmbedder{}, store, fixedSplitter{size: 1000}, WithNearDupThreshold(12), WithRecorder(recorder))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := second.Sync(context.Background(), sliceSource{docs: []datasource.Document{mirror}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if got := recorder.Sum(metrics.SyncDocuments, metrics.Labels{"status": "duplicate"}); got != 1 {
+		t.Errorf("%s{status=duplicate} = %v, want 1", metrics.SyncDocuments, got)
+	}
+	if docs := store.Documents(); len(docs) != 1 || docs[0].Metadata["source"] != "news/a" {
+		t.Errorf("stored documents = %v, want only news/a", docs)
+	}
+}
+
+func TestKnowledgeBase_EmbedPassthrough(t *testing.T) {
+	ctx := context.Background()
+	embedder := mocks.NewEmbedder(8)
+	knowledgeBase, err := New(embedder, mocks.NewStore(), fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := knowledgeBase.EmbedQuery(ctx, "goroutines")
+	if err != nil {
+		t.Fatalf("EmbedQuery() error = %v", err)
+	}
+	want, _ := embedder.EmbedQuery(ctx, "goroutines")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("EmbedQuery() = %v, want the embedder's vector %v", got, want)
+	}
+
+	texts := []string{"goroutines", "channels"}
+	gotDocs, err := knowledgeBase.EmbedDocuments(ctx, texts)
+	if err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+	wantDocs, _ := embedder.EmbedDocuments(ctx, texts)
+	if !reflect.DeepEqual(gotDocs, wantDocs) {
+		t.Errorf("EmbedDocuments() = %v, want the embedder's vectors %v", gotDocs, wantDocs)
+	}
+
+	errInjected := errors.New("injected")
+	embedder.FailNext("EmbedQuery", errInjected)
+	if _, err := knowledgeBase.EmbedQuery(ctx, "goroutines"); !errors.Is(err, errInjected) {
+		t.Errorf("EmbedQuery() error = %v, want %v", err, errInjected)
+	}
+}
+
+func TestKnowledgeBase_DeleteByMetadata(t *testing.T) {
+	ctx := context.Background()
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for source, owner := range map[string]string{"a.txt": "alice", "b.txt": "alice", "c.txt": "bob"} {
+		if err := knowledgeBase.AddText(ctx, source, "notes", map[string]interface{}{"owner": owner}); err != nil {
+			t.Fatalf("AddText() error = %v", err)
+		}
+	}
+
+	removed, err := knowledgeBase.DeleteByMetadata(ctx, vectorstore.Filter{"owner": "alice"})
+	if err != nil {
+		t.Fatalf("DeleteByMetadata() error = %v", err)
+	}
+	if removed != 2 || len(store.Documents()) != 1 {
+		t.Errorf("DeleteByMetadata() = %d with %d chunks left, want 2 and 1", removed, len(store.Documents()))
+	}
+
+	if _, err := knowledgeBase.DeleteByMetadata(ctx, nil); err == nil {
+		t.Error("DeleteByMetadata() with empty filter error = nil")
+	}
+	if len(store.Documents()) != 1 {
+		t.Errorf("empty filter deleted chunks, %d left", len(store.Documents()))
+	}
+}
+
+func TestKnowledgeBase_DeleteByMetadataForgetsSimHashes(t *testing.T) {
+	ctx := context.Background()
+	original := datasource.Document{
+		Source:   "news/a",
+		Content:  "The city council approved the new budget on Tuesday, allocating more funds to public transport and road maintenance. The mayor said the plan would reduce congestion over the next five years and improve air quality across the region.",
+		Metadata: map[string]interface{}{"owner": "alice"},
+	}
+	mirror := datasource.Document{
+		Source:   "mirror/a",
+		Content:  "The city council approved the new budget on Tuesday, allocating additional funds to public transport and road maintenance. The mayor said the plan will reduce congestion over the next five years and improve air quality across the region.",
+		Metadata: map[string]interface{}{"owner": "bob"},
+	}
+	store := mocks.NewStore()
+	recorder := metrics.NewInMemoryRecorder()
+	knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 1000}, WithNearDupThreshold(12), WithRecorder(recorder))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.Sync(ctx, sliceSource{docs: []datasource.Document{original}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if _, err := knowledgeBase.DeleteByMetadata(ctx, vectorstore.Filter{"owner": "alice"}); err != nil {
+		t.Fatalf("DeleteByMetadata() error = %v", err)
+	}
+	var recorded bool
+	for _, observation := range recorder.Observations(metrics.VectorStoreLatency) {
+		recorded = recorded || observation.Labels["operation"] == "delete"
+	}
+	if !recorded {
+		t.Errorf("no %s observation of the delete", metrics.VectorStoreLatency)
+	}
+
+	// The deleted document no longer makes its copy a duplicate
+	if err := knowledgeBase.Sync(ctx, sliceSource{docs: []datasource.Document{mirror}}); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if docs := store.Documents(); len(docs) != 1 || docs[0].Metadata["source"] != "mirror/a" {
+		t.Errorf("stored documents = %v, want only mirror/a", docs)
+	}
+}
+
+func TestKnowledgeBase_EmbeddingTemplate(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, fixedSplitter{size: 100},
+		WithEmbeddingTemplate(func(chunk document.Document) string {
+			return chunk.Metadata["source"].(string) + ": " + chunk.PageContent
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.AddText(ctx, "guide.md", "install with go get", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+	calls := embedder.Calls("EmbedDocuments")
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0].Args[0], []string{"guide.md: install with go get"}) {
+		t.Errorf("EmbedDocuments calls = %v, want the templated chunk", calls)
+	}
+	if stored := store.Documents(); len(stored) != 1 || stored[0].PageContent != "install with go get" {
+		t.Errorf("stored chunks = %v, want the original content", stored)
+	}
+}
+
+func TestKnowledgeBase_RetrieveRefusesWithoutContext(t *testing.T) {
+	ctx := context.Background()
+	newKB := func(t *testing.T, opts ...Option) *KnowledgeBase {
+		t.Helper()
+		opts = append([]Option{WithScoreThreshold(0.99)}, opts...)
+		knowledgeBase, err := New(mocks.NewEmbedder(64), mocks.NewStore(), fixedSplitter{size: 100}, opts...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return knowledgeBase
+	}
+
+	t.Run("Empty store", func(t *testing.T) {
+		knowledgeBase := newKB(t, WithRefuseWithoutContext(true))
+
+		_, err := knowledgeBase.Retrieve(ctx, "capital of France", 5, nil)
+		var noContext *NoContextError
+		if !errors.Is(err, ErrNoRelevantContext) || !errors.As(err, &noContext) {
+			t.Fatalf("Retrieve() error = %v, want a *NoContextError", err)
+		}
+		if noContext.Rejected != 0 || noContext.BestScore != 0 {
+			t.Errorf("error = %+v, want no rejected documents", noContext)
+		}
+	})
+
+	t.Run("Below threshold", func(t *testing.T) {
+		knowledgeBase := newKB(t, WithRefuseWithoutContext(true))
+		if err := knowledgeBase.AddText(ctx, "france.md", "Paris is the capital of France", nil); err != nil {
+			t.Fatalf("AddText() error = %v", err)
+		}
+
+		_, err := knowledgeBase.Retrieve(ctx, "what is the capital of Spain", 5, nil)
+		var noContext *NoContextError
+		if !errors.As(err, &noContext) {
+			t.Fatalf("Retrieve() error = %v, want a *NoContextError", err)
+		}
+		if noContext.Rejected != 1 || noContext.BestScore <= 0 || noContext.BestScore >= 0.99 || noContext.Threshold != 0.99 {
+			t.Errorf("error = %+v, want the one document's score below 0.99", noContext)
+		}
+		if !strings.Contains(err.Error(), "below the threshold") {
+			t.Errorf("error message = %q, want the rejected score", err)
+		}
+
+		docs, err := knowledgeBase.Retrieve(ctx, "Paris is the capital of France", 5, nil)
+		if err != nil || len(docs) != 1 {
+			t.Errorf("Retrieve() of a relevant query = %v, %v, want the document", docs, err)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		knowledgeBase := newKB(t)
+		docs, err := knowledgeBase.Retrieve(ctx, "capital of France", 5, nil)
+		if err != nil || len(docs) != 0 {
+			t.Errorf("Retrieve() = %v, %v, want no documents and no error", docs, err)
+		}
+	})
+}
+
+func TestNew_RequiredCapabilities(t *testing.T) {
+	store := mocks.NewStore()
+	if _, err := New(fakeEmbedder{}, store, fixedSplitter{size: 4}, WithRequiredCapabilities(vectorstore.CapabilityReplaceSource)); err != nil {
+		t.Errorf("New() with a supported capability error = %v", err)
+	}
+
+	_, err := New(fakeEmbedder{}, store, fixedSplitter{size: 4}, WithRequiredCapabilities(vectorstore.CapabilityListSources))
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Fatalf("New() error = %v, want ErrCodeNotSupported", err)
+	}
+	if vsErr.Message != "mocks.Store does not support ListSources" {
+		t.Errorf("message = %q, want the store and the missing capability", vsErr.Message)
+	}
+}
+
+func TestKnowledgeBase_ContentFilter(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, fixedSplitter{size: 100},
+		WithContentFilter(document.NewRedactor()),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	text := "Contact ana@example.com or 555-123-4567"
+	if err := knowledgeBase.AddText(ctx, "contacts.txt", text, nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	want := "Contact [EMAIL] or [PHONE]"
+	calls := embedder.Calls("EmbedDocuments")
+	if len(calls) != 1 || !reflect.DeepEqual(calls[0].Args[0], []string{want}) {
+		t.Errorf("EmbedDocuments calls = %v, want the redacted chunk embedded", calls)
+	}
+	stored := store.Documents()
+	if len(stored) != 1 || stored[0].PageContent != want {
+		t.Fatalf("stored chunks = %v, want the redacted content", stored)
+	}
+	if stored[0].Metadata[document.RedactionsMetadataKey] != 2 {
+		t.Errorf("metadata = %v, want 2 redactions recorded", stored[0].Metadata)
+	}
+}
+
+func TestKnowledgeBase_FailedIndexLeavesNoPartialChunks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("AddText", func(t *testing.T) {
+		store := mocks.NewPartialStore(3)
+		knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 2})
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		if err := knowledgeBase.AddText(ctx, "a.txt", "aabb", nil); err != nil {
+			t.Fatalf("AddText() error = %v", err)
+		}
+		if err := knowledgeBase.AddText(ctx, "b.txt", "ccddeeff", nil); err == nil {
+			t.Fatal("AddText() error = nil, want the store's failure")
+		}
+		if docs := store.Documents(); len(docs) != 2 || docs[0].Metadata["source"] != "a.txt" {
+			t.Errorf("store holds %v, want only the chunks of a.txt", docs)
+		}
+	})
+
+	for name, deletePartial := range map[string]bool{"Streamed": true, "Streamed without deleting partial chunks": false} {
+		t.Run(name, func(t *testing.T) {
+			store := mocks.NewPartialStore(25)
+			source := &streamingSource{reader: &countingReader{size: 100}}
+			knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 2},
+				WithStreamBatchSize(10),
+				WithDeletePartialStreams(deletePartial),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if err := knowledgeBase.Sync(ctx, source); err == nil {
+				t.Fatal("Sync() error = nil, want the store's failure")
+			}
+			if want := map[bool]int{true: 0, false: 25}[deletePartial]; len(store.Documents()) != want {
+				t.Errorf("store holds %d chunks after the failure, want %d", len(store.Documents()), want)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_SyncStreamKeepsOldChunksUntilIndexed(t *testing.T) {
+	ctx := context.Background()
+	old := []vectorstore.Document{
+		{PageContent: "old 1", Metadata: map[string]interface{}{"source": "mem://large"}},
+		{PageContent: "old 2", Metadata: map[string]interface{}{"source": "mem://large"}},
+		{PageContent: "other", Metadata: map[string]interface{}{"source": "mem://other"}},
+	}
+	newKB := func(t *testing.T) (*KnowledgeBase, *mocks.Store) {
+		t.Helper()
+		store := mocks.NewStore()
+		if err := store.AddDocuments(ctx, old, [][]float32{{1}, {1}, {1}}); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 10}, WithStreamBatchSize(2))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return knowledgeBase, store
+	}
+	contents := func(docs []vectorstore.Document) map[string]int {
+		counts := make(map[string]int)
+		for _, doc := range docs {
+			if doc.Metadata[IndexRunMetadataKey] != nil {
+				counts["new"]++
+			} else {
+				counts[doc.PageContent]++
+			}
+		}
+		return counts
+	}
+
+	t.Run("Failure", func(t *testing.T) {
+		knowledgeBase, store := newKB(t)
+		store.FailNext("AddDocuments", nil, errors.New("store down"))
+		if err := knowledgeBase.Sync(ctx, &streamingSource{reader: &countingReader{size: 100}}); err == nil {
+			t.Fatal("Sync() error = nil, want the store's failure")
+		}
+		want := map[string]int{"old 1": 1, "old 2": 1, "other": 1}
+		if got := contents(store.Documents()); !reflect.DeepEqual(got, want) {
+			t.Errorf("store holds %v after the failure, want the old chunks only", got)
+		}
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		knowledgeBase, store := newKB(t)
+		if err := knowledgeBase.Sync(ctx, &streamingSource{reader: &countingReader{size: 100}}); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		want := map[string]int{"new": 10, "other": 1}
+		if got := contents(store.Documents()); !reflect.DeepEqual(got, want) {
+			t.Errorf("store holds %v, want the new chunks and the other source", got)
+		}
+
+		// The old chunks are deleted only once every batch is added
+		calls := store.Calls("")
+		if last := calls[len(calls)-1]; last.Method != "Delete" || store.CallCount("Delete") != 1 {
+			t.Errorf("calls = %v, want a single Delete after the last AddDocuments", calls)
+		}
+	})
+}
+
+func TestKnowledgeBase_SyncNilMetadata(t *testing.T) {
+	ctx := context.Background()
+	source := mocks.NewDataSource()
+	source.StreamFunc = func(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
+		docChan := make(chan datasource.Document, 1)
+		errChan := make(chan error, 1)
+		docChan <- datasource.Document{Source: "custom://a", Content: "hello world"}
+		close(docChan)
+		return docChan, errChan
+	}
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(16), store, fixedSplitter{size: 5})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(ctx, source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	chunks, err := store.GetDocuments(ctx, vectorstore.Filter{"source": "custom://a"}, 0)
+	if err != nil {
+		t.Fatalf("GetDocuments() error = %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Errorf("indexed %d chunks with the source set, want 3", len(chunks))
+	}
+}
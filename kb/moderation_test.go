@@ -0,0 +1,65 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/moderation"
+)
+
+func TestKnowledgeBase_SimilaritySearchModeration(t *testing.T) {
+	errUnavailable := errors.New("moderation API unavailable")
+	moderator := moderation.ModeratorFunc(func(ctx context.Context, text string) (moderation.Result, error) {
+		switch text {
+		case "bad":
+			return moderation.Result{Flagged: true, Categories: map[string]bool{"violence": true}}, nil
+		case "error":
+			return moderation.Result{}, errUnavailable
+		}
+		return moderation.Result{}, nil
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		failOpen bool
+		wantErr  error
+	}{
+		{name: "Clean query is searched", query: "goroutines"},
+		{name: "Flagged query is rejected", query: "bad", wantErr: moderation.ErrFlagged},
+		{name: "API failure fails closed", query: "error", wantErr: errUnavailable},
+		{name: "API failure fails open", query: "error", failOpen: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+			knowledgeBase, err := New(embedder, store, fixedSplitter{size: 10},
+				WithModerator(moderator),
+				WithModerationFailOpen(tt.failOpen),
+			)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			_, err = knowledgeBase.SimilaritySearch(context.Background(), tt.query, 3, nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SimilaritySearch() error = %v, want %v", err, tt.wantErr)
+				}
+				if got := embedder.CallCount("EmbedQuery"); got != 0 {
+					t.Errorf("EmbedQuery calls = %d, want 0 for a rejected query", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SimilaritySearch() error = %v", err)
+			}
+			if got := store.CallCount("SimilaritySearch"); got != 1 {
+				t.Errorf("store SimilaritySearch calls = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metadata keys under which indexed chunks carry their position in the
+// document they were split from
+const (
+	ChunkIndexMetadataKey = "chunk_index" // Position of the chunk in its document, from 0
+	ParentIDMetadataKey   = "parent_id"   // Source of the document the chunk was split from
+	// ChunkCountMetadataKey holds how many chunks a document returned by
+	// QueryWithNeighbors was stitched from
+	ChunkCountMetadataKey = "chunk_count"
+)
+
+// QueryWithNeighbors retrieves up to k documents for question like Retrieve,
+// then widens each to the neighbors chunks before and after it in the same
+// document, fetched from the store by ParentIDMetadataKey and
+// ChunkIndexMetadataKey. Hits whose windows touch or overlap are stitched
+// into one document, so no chunk is returned twice.
+//
+// Each returned document holds its chunks' content in document order, the
+// score and metadata of its best hit, the index of its first chunk and the
+// number of chunks under ChunkCountMetadataKey. Documents are ordered by
+// score. Hits indexed without position metadata are returned as they are.
+// The store must implement vectorstore.DocumentGetter.
+func (kb *KnowledgeBase) QueryWithNeighbors(
+	ctx context.Context,
+	question string,
+	k int,
+	filter vectorstore.Filter,
+	neighbors int,
+) (_ []vectorstore.Document, err error) {
+	ctx, span := kb.tracer.Start(ctx, "kb.QueryWithNeighbors", trace.WithAttributes(
+		attribute.Int("kb.limit", k),
+		attribute.Int("kb.neighbors", neighbors),
+	))
+	defer func() {
+		err = kb.withTraceID(ctx, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	docs, err := kb.Retrieve(ctx, question, k, filter)
+	if err != nil {
+		return nil, err
+	}
+	docs, err = kb.expandNeighbors(ctx, docs, neighbors)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("kb.results", len(docs)))
+	return docs, nil
+}
+
+// chunkPosition returns the parent and index of an indexed chunk. Indexes
+// read back from JSON metadata are float64 or json.Number.
+func chunkPosition(metadata map[string]interface{}) (string, int, bool) {
+	parent, ok := metadata[ParentIDMetadataKey].(string)
+	if !ok || parent == "" {
+		return "", 0, false
+	}
+	switch index := metadata[ChunkIndexMetadataKey].(type) {
+	case int:
+		return parent, index, true
+	case int64:
+		return parent, int(index), true
+	case float64:
+		return parent, int(index), true
+	case json.Number:
+		i, err := index.Int64()
+		return parent, int(i), err == nil
+	case string:
+		i, err := strconv.Atoi(index)
+		return parent, i, err == nil
+	}
+	return "", 0, false
+}
+
+// expandNeighbors widens hits to their neighbors, see QueryWithNeighbors
+func (kb *KnowledgeBase) expandNeighbors(ctx context.Context, hits []vectorstore.Document, neighbors int) ([]vectorstore.Document, error) {
+	if neighbors <= 0 {
+		return hits, nil
+	}
+	// Checked even without hits, so a store without it always fails
+	getter, ok := vectorstore.Unwrap(kb.store).(vectorstore.DocumentGetter)
+	if !ok {
+		return nil, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "QueryWithNeighbors",
+			Store:   "kb",
+			Message: "store does not support getting documents",
+		}
+	}
+
+	// The chunks known for each parent, starting with the hits, in the order
+	// the parents were first hit. Levels of multi-level splitting are
+	// numbered apart, so each is its own parent.
+	type parentChunks struct {
+		parent string
+		level  string // Empty for chunks without a level
+		chunks map[int]vectorstore.Document
+		hits   map[int]bool
+	}
+	parents := make(map[string]*parentChunks)
+	var order []string
+	var results []vectorstore.Document
+	for _, hit := range hits {
+		parent, index, ok := chunkPosition(hit.Metadata)
+		if !ok {
+			results = append(results, hit)
+			continue
+		}
+		key, level := parent, ""
+		if value, ok := hit.Metadata[LevelMetadataKey]; ok {
+			level = fmt.Sprint(value)
+			key += "\x00" + level
+		}
+		p, seen := parents[key]
+		if !seen {
+			p = &parentChunks{parent: parent, level: level, chunks: make(map[int]vectorstore.Document), hits: make(map[int]bool)}
+			parents[key] = p
+			order = append(order, key)
+		}
+		if !p.hits[index] {
+			p.chunks[index] = hit
+			p.hits[index] = true
+		}
+	}
+
+	for _, key := range order {
+		p := parents[key]
+		hitIndexes := make([]int, 0, len(p.hits))
+		for index := range p.hits {
+			hitIndexes = append(hitIndexes, index)
+		}
+		sort.Ints(hitIndexes)
+
+		for _, hit := range hitIndexes {
+			for index := max(hit-neighbors, 0); index <= hit+neighbors; index++ {
+				if _, ok := p.chunks[index]; ok {
+					continue
+				}
+				filter := vectorstore.Filter{
+					ParentIDMetadataKey:   p.parent,
+					ChunkIndexMetadataKey: strconv.Itoa(index),
+				}
+				if p.level != "" {
+					filter[LevelMetadataKey] = p.level
+				}
+				found, err := getter.GetDocuments(ctx, filter, 1)
+				if err != nil {
+					return nil, err
+				}
+				if len(found) > 0 {
+					p.chunks[index] = found[0]
+				}
+			}
+		}
+		results = append(results, stitchChunks(p.chunks, p.hits)...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results, nil
+}
+
+// stitchChunks joins each run of consecutive chunks that holds a hit into one
+// document, in index order
+func stitchChunks(chunks map[int]vectorstore.Document, hits map[int]bool) []vectorstore.Document {
+	indexes := make([]int, 0, len(chunks))
+	for index := range chunks {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var docs []vectorstore.Document
+	for start := 0; start < len(indexes); {
+		end := start + 1
+		for end < len(indexes) && indexes[end] == indexes[end-1]+1 {
+			end++
+		}
+		run := indexes[start:end]
+		start = end
+
+		best := -1
+		for _, index := range run {
+			if hits[index] && (best < 0 || chunks[index].Score > chunks[best].Score) {
+				best = index
+			}
+		}
+		if best < 0 {
+			continue
+		}
+
+		contents := make([]string, len(run))
+		for i, index := range run {
+			contents[i] = chunks[index].PageContent
+		}
+		metadata := make(map[string]interface{}, len(chunks[best].Metadata)+2)
+		for k, v := range chunks[best].Metadata {
+			metadata[k] = v
+		}
+		metadata[ChunkIndexMetadataKey] = run[0]
+		metadata[ChunkCountMetadataKey] = len(run)
+		docs = append(docs, vectorstore.Document{
+			PageContent: strings.Join(contents, "\n"),
+			Metadata:    metadata,
+			Score:       chunks[best].Score,
+		})
+	}
+	return docs
+}
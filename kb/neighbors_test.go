@@ -0,0 +1,136 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// newNeighborsKB indexes "aabbccddeeff" in chunks of two letters and makes
+// searches return the chunks at hits, with the first scoring highest
+func newNeighborsKB(t *testing.T, hits ...int) (*KnowledgeBase, *mocks.Store) {
+	t.Helper()
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 2})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.AddText(context.Background(), "letters.txt", "aabbccddeeff", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	stored := store.Documents()
+	store.SimilaritySearchFunc = func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+		var docs []vectorstore.Document
+		for i, hit := range hits {
+			doc := stored[hit]
+			doc.Score = 1 - float32(i)/10
+			docs = append(docs, doc)
+		}
+		return docs, nil
+	}
+	return knowledgeBase, store
+}
+
+func TestKnowledgeBase_IndexesChunkPositions(t *testing.T) {
+	_, store := newNeighborsKB(t)
+	for i, doc := range store.Documents() {
+		if doc.Metadata[ChunkIndexMetadataKey] != i || doc.Metadata[ParentIDMetadataKey] != "letters.txt" {
+			t.Errorf("chunk %d metadata = %v, want its index and parent", i, doc.Metadata)
+		}
+	}
+}
+
+func TestKnowledgeBase_QueryWithNeighbors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		hits      []int
+		neighbors int
+		want      []string
+		counts    []int
+	}{
+		{name: "Neighbors included", hits: []int{2}, neighbors: 1, want: []string{"bb\ncc\ndd"}, counts: []int{3}},
+		{name: "Clipped at the document edges", hits: []int{0, 5}, neighbors: 1, want: []string{"aa\nbb", "ee\nff"}, counts: []int{2, 2}},
+		{name: "Overlapping windows stitched once", hits: []int{3, 1}, neighbors: 1, want: []string{"aa\nbb\ncc\ndd\nee"}, counts: []int{5}},
+		{name: "Adjacent windows stitched once", hits: []int{4, 1}, neighbors: 1, want: []string{"aa\nbb\ncc\ndd\nee\nff"}, counts: []int{6}},
+		{name: "Separate windows ordered by score", hits: []int{5, 0}, neighbors: 0, want: []string{"ff", "aa"}, counts: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knowledgeBase, _ := newNeighborsKB(t, tt.hits...)
+			docs, err := knowledgeBase.QueryWithNeighbors(ctx, "letters", len(tt.hits), nil, tt.neighbors)
+			if err != nil {
+				t.Fatalf("QueryWithNeighbors() error = %v", err)
+			}
+			if len(docs) != len(tt.want) {
+				t.Fatalf("QueryWithNeighbors() = %v, want %d documents", docs, len(tt.want))
+			}
+			for i, doc := range docs {
+				if doc.PageContent != tt.want[i] {
+					t.Errorf("document %d = %q, want %q", i, doc.PageContent, tt.want[i])
+				}
+				if tt.counts != nil && doc.Metadata[ChunkCountMetadataKey] != tt.counts[i] {
+					t.Errorf("document %d chunk count = %v, want %d", i, doc.Metadata[ChunkCountMetadataKey], tt.counts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_QueryWithNeighborsKeepsBestHit(t *testing.T) {
+	knowledgeBase, store := newNeighborsKB(t, 3, 2)
+	docs, err := knowledgeBase.QueryWithNeighbors(context.Background(), "letters", 2, nil, 1)
+	if err != nil {
+		t.Fatalf("QueryWithNeighbors() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].Score != 1 || docs[0].Metadata[ChunkIndexMetadataKey] != 1 {
+		t.Fatalf("QueryWithNeighbors() = %v, want one document scored as the best hit starting at chunk 1", docs)
+	}
+	// Only the chunks outside both hits are fetched
+	if gets := store.Calls("GetDocuments"); len(gets) != 2 {
+		t.Errorf("GetDocuments calls = %d, want 2", len(gets))
+	}
+}
+
+func TestKnowledgeBase_QueryWithNeighborsNotSupported(t *testing.T) {
+	knowledgeBase, err := New(fakeEmbedder{}, &fakeStore{}, fixedSplitter{size: 2})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.AddText(context.Background(), "letters.txt", "aabb", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	_, err = knowledgeBase.QueryWithNeighbors(context.Background(), "letters", 1, nil, 1)
+	var storeErr *vectorstore.VectorStoreError
+	if !errors.As(err, &storeErr) || storeErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("QueryWithNeighbors() error = %v, want ErrCodeNotSupported", err)
+	}
+}
+
+func TestKnowledgeBase_ResultContextExpansion(t *testing.T) {
+	knowledgeBase, _ := newNeighborsKB(t, 2)
+	model := mocks.NewLLM("answer")
+	var chat llm.LLM = model
+	knowledgeBase.UpdateOptions(WithLLM(&chat), WithResultContextExpansion(1))
+
+	answer, err := knowledgeBase.QueryWithHistory(context.Background(), nil, "letters?", 1, nil)
+	if err != nil {
+		t.Fatalf("QueryWithHistory() error = %v", err)
+	}
+	if len(answer.Sources) != 1 || answer.Sources[0].PageContent != "bb\ncc\ndd" {
+		t.Fatalf("sources = %v, want the hit with its neighbors", answer.Sources)
+	}
+	calls := model.Calls("Chat")
+	if len(calls) != 1 || !strings.Contains(calls[0].Args[0].([]llm.Message)[0].Content, "bb\ncc\ndd") {
+		t.Errorf("Chat calls = %v, want the stitched chunks in the prompt", calls)
+	}
+}
@@ -1,8 +1,16 @@
 package kb
 
 import (
+	"log/slog"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
 	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/moderation"
 	"github.com/Abraxas-365/kbservice/vectorstore"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Options contains configuration for the knowledge base
@@ -11,6 +19,130 @@ type Options struct {
 	ScoreThreshold float32
 	Filters        vectorstore.Filter
 	LLM            *llm.LLM // Optional LLM
+
+	// StreamWindowSize is how many bytes of streamed content are split at a time
+	StreamWindowSize int
+	// StreamBatchSize is how many chunks of streamed content are embedded per batch
+	StreamBatchSize int
+	// DeletePartialStreams deletes the chunks a streamed document had added
+	// when indexing it fails partway, on stores that don't match Conditions.
+	// It is a cleanup, not a transaction: searches may see the partial chunks
+	// until it runs, and they stay if the delete fails too. Stores that match
+	// Conditions always delete the chunks of a failed run and keep the old
+	// ones. Documents that aren't streamed are replaced with
+	// vectorstore.ReplaceSource either way.
+	DeletePartialStreams bool
+
+	// ModelDimensions extends or overrides the sizes embedding.ModelDimension
+	// knows when validating that the embedder and the store agree on vector
+	// size. A size configured on the embedder takes precedence over both.
+	ModelDimensions map[string]int
+
+	// TracerProvider enables OpenTelemetry spans for syncs, searches, embedding
+	// and vector store calls (nil disables tracing)
+	TracerProvider trace.TracerProvider
+
+	// Recorder receives sync and vector store metrics
+	Recorder metrics.Recorder
+
+	// Logger receives debug logs for sync decisions and searches, and errors for failures
+	Logger *slog.Logger
+	// Redactor rewrites query text before it is logged
+	Redactor logging.Redactor
+
+	// TraceIDKey is the context key holding a request or trace ID. When set, the
+	// ID is added to log records, returned errors and indexed chunk metadata.
+	TraceIDKey any
+
+	// Moderator, when set, checks every query before it is searched. Flagged
+	// queries fail with a *moderation.FlaggedError.
+	Moderator moderation.Moderator
+	// ModerationFailOpen lets queries through when the Moderator fails
+	ModerationFailOpen bool
+
+	// NearDupThreshold is the largest SimHash Hamming distance at which Sync
+	// treats a document as a copy of one already indexed from another source
+	// and skips it (0 disables the check)
+	NearDupThreshold int
+
+	// EmbeddingTemplate returns the text embedded for a chunk in place of its
+	// content, which is still what gets stored and returned by searches.
+	// Splitters copy the document's metadata onto every chunk, so the template
+	// can use "source", "last_modified" and any metadata from the data source
+	// or AddText, but not the text of other chunks. Nil embeds the content.
+	EmbeddingTemplate func(chunk document.Document) string
+	// QueryTemplate returns the text embedded for a search query. Nil embeds
+	// the query unchanged.
+	QueryTemplate func(query string) string
+
+	// SplitterRouter picks the splitter for each synced document, such as by
+	// its file extension or content type. Nil, or a nil result, uses the
+	// splitter the knowledge base was created with.
+	SplitterRouter func(doc datasource.Document) document.Splitter
+	// SplitLevels indexes every document once per splitter, such as from the
+	// finest granularity to the coarsest, tagging each chunk with the
+	// position of its splitter under LevelMetadataKey. When set, it takes the place of
+	// the splitter and SplitterRouter.
+	SplitLevels []document.Splitter
+
+	// InputTrim drops chunks with empty or whitespace-only content before they
+	// are embedded. Sync reports documents with no content as "empty".
+	InputTrim bool
+
+	// TenantKey is the metadata key views returned by ForTenant store their
+	// tenant under and filter on
+	TenantKey string
+
+	// RefuseWithoutContext makes Retrieve fail with a *NoContextError instead
+	// of returning no documents, so no answer is generated from an empty context
+	RefuseWithoutContext bool
+
+	// QueryRewrite makes QueryWithHistory have the LLM rewrite follow-up
+	// questions into standalone queries before retrieving
+	QueryRewrite bool
+
+	// GroundingCheck makes QueryWithHistory have the LLM classify each
+	// sentence of an answer as supported or not by the retrieved documents,
+	// see Answer.Grounding
+	GroundingCheck bool
+	// GroundingThreshold is the grounding score below which an answer is
+	// generated once more without its unsupported sentences (0 never does)
+	GroundingThreshold float64
+
+	// ContextExpansion is how many chunks before and after each retrieved
+	// chunk of a document QueryWithHistory answers from, see
+	// QueryWithNeighbors (0 answers from the retrieved chunks alone)
+	ContextExpansion int
+	// ContextTokenizer counts the tokens of the context reported in
+	// Answer.ContextTokens. Nil estimates four characters per token.
+	ContextTokenizer document.Tokenizer
+	// ModelRouter picks the options each question is answered with, such
+	// as a model by its length (nil uses the LLM's defaults)
+	ModelRouter ModelRouter
+
+	// SyncMetadata is added to the metadata of every document Sync and Rebuild
+	// load, see datasource.WithStaticMetadata
+	SyncMetadata map[string]interface{}
+	// SyncMetadataOverride makes SyncMetadata replace metadata the data source
+	// sets under the same keys
+	SyncMetadataOverride bool
+
+	// MaxDocumentBytes is the largest content Sync, Rebuild and AddText index
+	// for a document (0 disables the limit). Larger documents fail with an
+	// error wrapping document.ErrDocumentTooLarge unless TruncateOversized is set.
+	MaxDocumentBytes int
+	// TruncateOversized indexes the first MaxDocumentBytes of larger documents
+	// instead, flagging their chunks with document.TruncatedMetadataKey
+	TruncateOversized bool
+
+	// RequiredCapabilities are the optional store interfaces New fails
+	// without, see vectorstore.RequireCapabilities
+	RequiredCapabilities []vectorstore.Capability
+
+	// ContentFilter, when set, redacts personal data from every chunk before
+	// it is embedded and stored, so it can't be retrieved. Chunks record the
+	// number of redactions under document.RedactionsMetadataKey.
+	ContentFilter *document.Redactor
 }
 
 // Option is a function type to modify Options
@@ -19,8 +151,27 @@ type Option func(*Options)
 // Default options
 func defaultOptions() *Options {
 	return &Options{
-		ScoreThreshold: 0.0,
-		LLM:            nil, // Default to no LLM
+		ScoreThreshold:       0.0,
+		LLM:                  nil, // Default to no LLM
+		StreamWindowSize:     document.DefaultReaderWindowSize,
+		StreamBatchSize:      100,
+		Recorder:             metrics.NopRecorder{},
+		Logger:               logging.Discard(),
+		InputTrim:            true,
+		QueryRewrite:         true,
+		DeletePartialStreams: true,
+	}
+}
+
+// WithNearDupThreshold makes Sync skip documents whose SimHash is within hamming
+// bits of a document already indexed from another source. The SimHashes are
+// stored with the chunks and read back on the first Sync, one GetDocuments
+// per source, when the store implements vectorstore.SourceLister and
+// vectorstore.DocumentGetter. With other stores only documents indexed by
+// the running process are compared.
+func WithNearDupThreshold(hamming int) Option {
+	return func(o *Options) {
+		o.NearDupThreshold = hamming
 	}
 }
 
@@ -31,6 +182,78 @@ func WithScoreThreshold(threshold float32) Option {
 	}
 }
 
+// WithRefuseWithoutContext makes Retrieve fail with a *NoContextError when no
+// document scores at least the score threshold
+func WithRefuseWithoutContext(refuse bool) Option {
+	return func(o *Options) {
+		o.RefuseWithoutContext = refuse
+	}
+}
+
+// WithQueryRewrite sets whether QueryWithHistory rewrites follow-up questions
+// into standalone queries using the conversation history
+func WithQueryRewrite(rewrite bool) Option {
+	return func(o *Options) {
+		o.QueryRewrite = rewrite
+	}
+}
+
+// WithGroundingCheck makes QueryWithHistory check answers against the
+// retrieved documents, at the cost of an extra LLM call per answer
+func WithGroundingCheck() Option {
+	return func(o *Options) {
+		o.GroundingCheck = true
+	}
+}
+
+// WithGroundingThreshold sets the grounding score, from 0 to 1, below which a
+// checked answer is regenerated once without its unsupported sentences
+func WithGroundingThreshold(threshold float64) Option {
+	return func(o *Options) {
+		o.GroundingThreshold = threshold
+	}
+}
+
+// WithRequiredCapabilities makes New fail when the store lacks any of caps,
+// instead of the first call that needs one failing or falling back
+func WithRequiredCapabilities(caps ...vectorstore.Capability) Option {
+	return func(o *Options) {
+		o.RequiredCapabilities = append(o.RequiredCapabilities, caps...)
+	}
+}
+
+// WithSyncMetadata adds metadata to every document Sync and Rebuild index.
+// Keys the data source sets take precedence unless WithSyncMetadataOverride is set.
+func WithSyncMetadata(metadata map[string]interface{}) Option {
+	return func(o *Options) {
+		o.SyncMetadata = metadata
+	}
+}
+
+// WithSyncMetadataOverride sets whether sync metadata replaces metadata the
+// data source sets under the same keys
+func WithSyncMetadataOverride(override bool) Option {
+	return func(o *Options) {
+		o.SyncMetadataOverride = override
+	}
+}
+
+// WithMaxDocumentBytes sets the largest content indexed for a document, so a
+// single huge document, such as a log file, can't exhaust memory or tokens
+func WithMaxDocumentBytes(limit int) Option {
+	return func(o *Options) {
+		o.MaxDocumentBytes = limit
+	}
+}
+
+// WithTruncateOversized sets whether documents over the MaxDocumentBytes
+// limit are truncated to it instead of failing
+func WithTruncateOversized(truncate bool) Option {
+	return func(o *Options) {
+		o.TruncateOversized = truncate
+	}
+}
+
 // WithFilters sets default filters for queries
 func WithFilters(filters vectorstore.Filter) Option {
 	return func(o *Options) {
@@ -44,3 +267,172 @@ func WithLLM(llm *llm.LLM) Option {
 		o.LLM = llm
 	}
 }
+
+// WithStreamWindowSize sets how many bytes of streamed content are split at a time
+func WithStreamWindowSize(size int) Option {
+	return func(o *Options) {
+		o.StreamWindowSize = size
+	}
+}
+
+// WithDeletePartialStreams sets whether the chunks of a streamed document that
+// fails to be indexed partway are deleted afterwards, on stores that don't
+// match Conditions. It is on by default; see Options.DeletePartialStreams.
+func WithDeletePartialStreams(deletePartial bool) Option {
+	return func(o *Options) {
+		o.DeletePartialStreams = deletePartial
+	}
+}
+
+// WithStreamBatchSize sets how many chunks of streamed content are embedded per batch
+func WithStreamBatchSize(size int) Option {
+	return func(o *Options) {
+		o.StreamBatchSize = size
+	}
+}
+
+// WithEmbeddingModelDimensionMap sets expected vector sizes for custom or unknown embedding models
+func WithEmbeddingModelDimensionMap(dimensions map[string]int) Option {
+	return func(o *Options) {
+		o.ModelDimensions = dimensions
+	}
+}
+
+// WithTracerProvider enables OpenTelemetry tracing with the given provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithRecorder sets the recorder for sync and vector store metrics, or discards them when recorder is nil
+func WithRecorder(recorder metrics.Recorder) Option {
+	return func(o *Options) {
+		if recorder == nil {
+			recorder = metrics.NopRecorder{}
+		}
+		o.Recorder = recorder
+	}
+}
+
+// WithLogger sets the logger for sync decisions, searches and failures. A nil logger discards the records.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		if logger == nil {
+			logger = logging.Discard()
+		}
+		o.Logger = logger
+	}
+}
+
+// WithRedactor sets how query text is rewritten before it is logged
+func WithRedactor(redactor logging.Redactor) Option {
+	return func(o *Options) {
+		o.Redactor = redactor
+	}
+}
+
+// WithTraceIDKey sets the context key a request or trace ID is read from, to be
+// attached to logs, errors and indexed documents
+func WithTraceIDKey(key any) Option {
+	return func(o *Options) {
+		o.TraceIDKey = key
+	}
+}
+
+// WithModerator checks every query with moderator before it is searched
+func WithModerator(moderator moderation.Moderator) Option {
+	return func(o *Options) {
+		o.Moderator = moderator
+	}
+}
+
+// WithModerationFailOpen sets whether queries are searched when the moderator fails
+func WithModerationFailOpen(failOpen bool) Option {
+	return func(o *Options) {
+		o.ModerationFailOpen = failOpen
+	}
+}
+
+// WithResultContextExpansion makes QueryWithHistory answer from the n chunks
+// before and after each retrieved chunk too, stitched in document order. The
+// store must implement vectorstore.DocumentGetter.
+func WithResultContextExpansion(n int) Option {
+	return func(o *Options) {
+		o.ContextExpansion = n
+	}
+}
+
+// WithContextTokenizer counts the context tokens reported by answers with
+// tokenizer, such as the answering model's own
+func WithContextTokenizer(tokenizer document.Tokenizer) Option {
+	return func(o *Options) {
+		o.ContextTokenizer = tokenizer
+	}
+}
+
+// WithModelRouter answers each question with the options router picks for
+// it, such as a cheaper model for simple questions, see NewLengthRouter
+func WithModelRouter(router ModelRouter) Option {
+	return func(o *Options) {
+		o.ModelRouter = router
+	}
+}
+
+// WithContentFilter redacts the content of chunks with redactor before they
+// are indexed, see document.NewRedactor
+func WithContentFilter(redactor *document.Redactor) Option {
+	return func(o *Options) {
+		o.ContentFilter = redactor
+	}
+}
+
+// WithEmbeddingTemplate sets the text embedded for each chunk in place of its
+// content, for example to prefix the document title
+func WithEmbeddingTemplate(template func(chunk document.Document) string) Option {
+	return func(o *Options) {
+		o.EmbeddingTemplate = template
+	}
+}
+
+// WithQueryTemplate sets the text embedded for each search query
+func WithQueryTemplate(template func(query string) string) Option {
+	return func(o *Options) {
+		o.QueryTemplate = template
+	}
+}
+
+// WithSplitterRouter sets how the splitter of each synced document is picked,
+// see SplitterByExtension
+func WithSplitterRouter(router func(doc datasource.Document) document.Splitter) Option {
+	return func(o *Options) {
+		o.SplitterRouter = router
+	}
+}
+
+// WithMultiLevelSplit indexes documents at several granularities, such as
+// paragraph, section and whole document, for coarse-to-fine retrieval. Each
+// splitter's chunks are tagged with its position in splitters under
+// LevelMetadataKey, so searches can be filtered to one level. Documents are
+// loaded in full instead of streamed, since each level splits them again.
+func WithMultiLevelSplit(splitters []document.Splitter) Option {
+	return func(o *Options) {
+		o.SplitLevels = splitters
+	}
+}
+
+// WithInputTrim sets whether chunks with empty or whitespace-only content are
+// dropped before embedding (enabled by default)
+func WithInputTrim(enabled bool) Option {
+	return func(o *Options) {
+		o.InputTrim = enabled
+	}
+}
+
+// WithTenantKey sets the metadata key tenant views returned by ForTenant tag
+// documents with and filter on
+func WithTenantKey(key string) Option {
+	return func(o *Options) {
+		o.TenantKey = key
+	}
+}
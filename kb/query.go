@@ -0,0 +1,162 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoLLM is returned by methods that need the LLM set with WithLLM when none is
+var ErrNoLLM = errors.New("no LLM configured")
+
+// DefaultQueryRewritePrompt is the system prompt used to turn a follow-up
+// question into a standalone search query
+const DefaultQueryRewritePrompt = "Rewrite the last question of the conversation below into a standalone search query that can be understood without the conversation, resolving pronouns and references to earlier turns. Reply with the query only."
+
+// Answer is an answer generated from the knowledge base
+type Answer struct {
+	Message llm.Message            // The model's answer
+	Sources []vectorstore.Document // Documents the answer was generated from
+	Query   string                 // Query the documents were retrieved with
+	Warning string                 // Set when the answer may be incomplete, see AnswerWarning
+	// Usage is the token usage of every LLM call made for the answer, as far
+	// as the LLM reports it
+	Usage llm.Usage
+	// ContextTokens is the size of the retrieved documents as placed in the
+	// prompt, counted by ContextTokenizer
+	ContextTokens int
+	// Retrieved is how many documents retrieval returned, and Used how many
+	// the answer was generated from, after neighbors were stitched in
+	Retrieved int
+	Used      int
+	// Grounding holds how well the sources support the answer when
+	// GroundingCheck is set, and is nil otherwise
+	Grounding *Grounding
+}
+
+// Query answers question from up to k documents retrieved with Retrieve, as
+// QueryWithHistory does for the first turn of a conversation. The Answer
+// reports the token usage, the size of the context and how many documents
+// were retrieved and used.
+func (kb *KnowledgeBase) Query(ctx context.Context, question string, k int, filter vectorstore.Filter) (*Answer, error) {
+	return kb.QueryWithHistory(ctx, nil, question, k, filter)
+}
+
+// QueryWithHistory answers question as the next turn of a conversation. With
+// QueryRewrite set and a history, the LLM first rewrites the question into a
+// standalone query, so follow-ups such as "what about its price?" retrieve
+// the right documents. Up to k documents are retrieved with Retrieve and
+// widened by ContextExpansion chunks, and the LLM answers the original
+// question from them and the history, with the options ModelRouter picks.
+// With GroundingCheck set, the answer is then checked against the documents.
+func (kb *KnowledgeBase) QueryWithHistory(
+	ctx context.Context,
+	history []llm.Message,
+	question string,
+	k int,
+	filter vectorstore.Filter,
+) (_ *Answer, err error) {
+	ctx, span := kb.tracer.Start(ctx, "kb.QueryWithHistory", trace.WithAttributes(
+		attribute.Int("kb.limit", k),
+		attribute.Int("kb.history", len(history)),
+	))
+	defer func() {
+		err = kb.withTraceID(ctx, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if kb.opts.LLM == nil || *kb.opts.LLM == nil {
+		return nil, ErrNoLLM
+	}
+	model := *kb.opts.LLM
+
+	var usage llm.Usage
+	query := question
+	if kb.opts.QueryRewrite && len(history) > 0 {
+		query, err = kb.rewriteQuery(ctx, model, history, question, &usage)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hits, err := kb.Retrieve(ctx, query, k, filter)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := kb.expandNeighbors(ctx, hits, kb.opts.ContextExpansion)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := RAGMessages(DefaultRAGPrompt, docs, history, question)
+	answerOpts := kb.routeOptions(question)
+	answer, err := model.Chat(ctx, messages, answerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	addUsage(&usage, answer)
+	span.SetAttributes(attribute.Int("kb.results", len(docs)))
+
+	result := &Answer{
+		Message:       *answer,
+		Sources:       docs,
+		Query:         query,
+		Warning:       AnswerWarning(*answer),
+		Usage:         usage,
+		ContextTokens: kb.contextTokens(docs),
+		Retrieved:     len(hits),
+		Used:          len(docs),
+	}
+	if kb.opts.GroundingCheck {
+		if err := kb.groundAnswer(ctx, model, messages, answerOpts, result); err != nil {
+			return nil, err
+		}
+		span.SetAttributes(attribute.Float64("kb.grounding_score", result.Grounding.Score))
+	}
+	return result, nil
+}
+
+// rewriteQuery asks model for a standalone version of question, falling back
+// to question itself when the model replies with nothing
+func (kb *KnowledgeBase) rewriteQuery(ctx context.Context, model llm.LLM, history []llm.Message, question string, usage *llm.Usage) (string, error) {
+	conversation := llm.MessagesToString(append(history[:len(history):len(history)], llm.Message{
+		Role:    llm.RoleUser,
+		Content: question,
+	}))
+	reply, err := model.Chat(ctx, []llm.Message{
+		{Role: llm.RoleSystem, Content: DefaultQueryRewritePrompt},
+		{Role: llm.RoleUser, Content: conversation},
+	}, llm.WithTemperature(0))
+	if err != nil {
+		return "", err
+	}
+	addUsage(usage, reply)
+
+	query := strings.TrimSpace(reply.Content)
+	if query == "" {
+		return question, nil
+	}
+	kb.logger.DebugContext(ctx, "rewrote query",
+		"question", logging.Redact(kb.opts.Redactor, question),
+		"query", logging.Redact(kb.opts.Redactor, query),
+	)
+	return query, nil
+}
+
+// contextTokens counts the tokens of docs as RAGMessages places them in the
+// prompt, estimating four characters per token without a ContextTokenizer
+func (kb *KnowledgeBase) contextTokens(docs []vectorstore.Document) int {
+	text := ragContext(docs)
+	if kb.opts.ContextTokenizer == nil {
+		return (len(text) + 3) / 4
+	}
+	return kb.opts.ContextTokenizer.CountTokens(text)
+}
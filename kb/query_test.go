@@ -0,0 +1,162 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+// rewritingLLM returns a mock LLM that answers rewrite requests with query and
+// anything else with an answer
+func rewritingLLM(query string) *mocks.LLM {
+	model := mocks.NewLLM("It costs $499")
+	model.ChatFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+		if messages[0].Content == DefaultQueryRewritePrompt {
+			return &llm.Message{Role: llm.RoleAssistant, Content: " " + query + "\n"}, nil
+		}
+		return &llm.Message{Role: llm.RoleAssistant, Content: model.Response, StopReason: llm.StopReasonStop}, nil
+	}
+	return model
+}
+
+func TestKnowledgeBase_QueryWithHistory(t *testing.T) {
+	ctx := context.Background()
+	history := []llm.Message{
+		{Role: llm.RoleUser, Content: "Tell me about the Acme X200"},
+		{Role: llm.RoleAssistant, Content: "The X200 is a laptop"},
+	}
+	const question = "what about its price?"
+	const rewritten = "Acme X200 price"
+
+	for name, test := range map[string]struct {
+		opts      []Option
+		history   []llm.Message
+		wantQuery string
+		wantChats int
+	}{
+		"Rewrites follow-ups": {history: history, wantQuery: rewritten, wantChats: 2},
+		"No history":          {wantQuery: question, wantChats: 1},
+		"Disabled":            {opts: []Option{WithQueryRewrite(false)}, history: history, wantQuery: question, wantChats: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			embedder, model := mocks.NewEmbedder(16), rewritingLLM(rewritten)
+			var chat llm.LLM = model
+			knowledgeBase, err := New(embedder, mocks.NewStore(), fixedSplitter{size: 100}, append([]Option{WithLLM(&chat)}, test.opts...)...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := knowledgeBase.AddText(ctx, "x200.md", "The Acme X200 price is $499", nil); err != nil {
+				t.Fatalf("AddText() error = %v", err)
+			}
+
+			answer, err := knowledgeBase.QueryWithHistory(ctx, test.history, question, 3, nil)
+			if err != nil {
+				t.Fatalf("QueryWithHistory() error = %v", err)
+			}
+
+			queries := embedder.Calls("EmbedQuery")
+			if len(queries) != 1 || queries[0].Args[0] != test.wantQuery {
+				t.Errorf("retrieved with %v, want %q", queries, test.wantQuery)
+			}
+			if answer.Query != test.wantQuery || answer.Message.Content != "It costs $499" || len(answer.Sources) != 1 {
+				t.Errorf("QueryWithHistory() = %+v, want the answer from x200.md", answer)
+			}
+			if got := model.CallCount("Chat"); got != test.wantChats {
+				t.Errorf("Chat calls = %d, want %d", got, test.wantChats)
+			}
+
+			// The answer is generated for the original question, after the history
+			calls := model.Calls("Chat")
+			messages := calls[len(calls)-1].Args[0].([]llm.Message)
+			if last := messages[len(messages)-1]; last.Content != question || len(messages) != len(test.history)+2 {
+				t.Errorf("answer messages = %+v, want the history then the question", messages)
+			}
+			if !strings.Contains(messages[0].Content, "$499") {
+				t.Errorf("system prompt = %q, want the retrieved document", messages[0].Content)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_QueryWithHistoryWithoutLLM(t *testing.T) {
+	knowledgeBase, err := New(mocks.NewEmbedder(16), mocks.NewStore(), fixedSplitter{size: 100})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := knowledgeBase.QueryWithHistory(context.Background(), nil, "question", 3, nil); !errors.Is(err, ErrNoLLM) {
+		t.Errorf("QueryWithHistory() error = %v, want ErrNoLLM", err)
+	}
+}
+
+func TestKnowledgeBase_QueryReport(t *testing.T) {
+	knowledgeBase, _ := newNeighborsKB(t, 1, 2)
+	model := mocks.NewLLM("")
+	model.ChatFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+		reply := &llm.Message{Role: llm.RoleAssistant, Content: "letters", StopReason: llm.StopReasonStop}
+		reply.SetUsage(&llm.Usage{PromptTokens: 40, CompletionTokens: 2, TotalTokens: 42})
+		return reply, nil
+	}
+	var chat llm.LLM = model
+	words := document.TokenizerFunc(func(text string) int { return len(strings.Fields(text)) })
+	knowledgeBase.UpdateOptions(WithLLM(&chat), WithResultContextExpansion(1), WithContextTokenizer(words))
+
+	answer, err := knowledgeBase.Query(context.Background(), "letters?", 2, nil)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if want := (llm.Usage{PromptTokens: 40, CompletionTokens: 2, TotalTokens: 42}); answer.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", answer.Usage, want)
+	}
+	// Both hits are stitched with their neighbors into one document
+	if answer.Retrieved != 2 || answer.Used != 1 {
+		t.Errorf("Retrieved, Used = %d, %d, want 2, 1", answer.Retrieved, answer.Used)
+	}
+	// "Source: letters.txt" and the four chunks
+	if answer.ContextTokens != 6 {
+		t.Errorf("ContextTokens = %d, want 6", answer.ContextTokens)
+	}
+}
+
+func TestKnowledgeBase_ModelRouter(t *testing.T) {
+	ctx := context.Background()
+	for name, test := range map[string]struct {
+		router    ModelRouter
+		question  string
+		wantModel string
+	}{
+		"Short question":  {router: NewLengthRouter("mini", "large", 8), question: "What is the X200 price?", wantModel: "mini"},
+		"Long question":   {router: NewLengthRouter("mini", "large", 8), question: "How does the X200 price compare with the X100 once shipping and taxes are added?", wantModel: "large"},
+		"Router declines": {router: func(string) llm.Option { return nil }, question: "What is the X200 price?"},
+		"No router":       {question: "What is the X200 price?"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			model := mocks.NewLLM("It costs $499")
+			var gotModel string
+			model.ChatFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+				options := &llm.ChatOptions{}
+				for _, opt := range opts {
+					opt(options)
+				}
+				gotModel = options.Model
+				return &llm.Message{Role: llm.RoleAssistant, Content: model.Response}, nil
+			}
+			var chat llm.LLM = model
+			knowledgeBase, err := New(mocks.NewEmbedder(16), mocks.NewStore(), fixedSplitter{size: 100}, WithLLM(&chat), WithModelRouter(test.router))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if _, err := knowledgeBase.Query(ctx, test.question, 3, nil); err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if gotModel != test.wantModel {
+				t.Errorf("answered with model %q, want %q", gotModel, test.wantModel)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// DefaultRAGPrompt is the system prompt used to answer questions from retrieved documents
+const DefaultRAGPrompt = "Answer the question using only the context below. If the context does not contain the answer, say that you don't know.\n\nContext:\n"
+
+// TruncatedAnswerWarning is the warning for an answer cut off by the token limit
+const TruncatedAnswerWarning = "the answer was cut off by the token limit; retry with a larger max tokens budget"
+
+// ErrNoRelevantContext is matched by the *NoContextError Retrieve returns when
+// RefuseWithoutContext is set and nothing relevant was found
+var ErrNoRelevantContext = errors.New("no relevant context")
+
+// NoContextError reports a retrieval that found no document scoring at least
+// the score threshold. Rejected is 0 when the search found no documents at
+// all; otherwise BestScore is the best score the threshold rejected.
+type NoContextError struct {
+	Rejected  int
+	BestScore float32
+	Threshold float32
+}
+
+func (e *NoContextError) Error() string {
+	if e.Rejected == 0 {
+		return "no relevant context: no documents found"
+	}
+	return fmt.Sprintf("no relevant context: %d documents found, the best scoring %.4f below the threshold %.4f",
+		e.Rejected, e.BestScore, e.Threshold)
+}
+
+func (e *NoContextError) Unwrap() error {
+	return ErrNoRelevantContext
+}
+
+// AnswerWarning returns a warning for the caller about a generated answer, or
+// "" if there is nothing to warn about
+func AnswerWarning(answer llm.Message) string {
+	if answer.StopReason == llm.StopReasonLength {
+		return TruncatedAnswerWarning
+	}
+	return ""
+}
+
+// RAGMessages builds the messages for answering query from docs: a system prompt
+// with the documents appended, then the conversation history, then the query
+func RAGMessages(prompt string, docs []vectorstore.Document, history []llm.Message, query string) []llm.Message {
+	messages := make([]llm.Message, 0, len(history)+2)
+	messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: prompt + ragContext(docs)})
+	messages = append(messages, history...)
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: query})
+}
+
+// ragContext renders docs as the context RAGMessages appends to the prompt,
+// each with its source
+func ragContext(docs []vectorstore.Document) string {
+	var context strings.Builder
+	for i, doc := range docs {
+		if i > 0 {
+			context.WriteString("\n\n---\n\n")
+		}
+		if source, ok := doc.Metadata["source"].(string); ok {
+			fmt.Fprintf(&context, "Source: %s\n", source)
+		}
+		context.WriteString(doc.PageContent)
+	}
+	return context.String()
+}
@@ -0,0 +1,216 @@
+package kb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultRebuildConcurrency is the number of documents Rebuild indexes at once
+const DefaultRebuildConcurrency = 4
+
+// RebuildProgress reports a document Rebuild is done with
+type RebuildProgress struct {
+	Source    string // Source of the document
+	Status    string // "indexed", "empty" or "duplicate", as recorded by Sync
+	Processed int    // Documents processed so far, including this one
+	Indexed   int    // Documents indexed so far
+}
+
+// RebuildOptions configures Rebuild
+type RebuildOptions struct {
+	Concurrency int                   // Documents indexed at once
+	Progress    func(RebuildProgress) // Called after each document, one call at a time
+}
+
+// RebuildOption configures Rebuild
+type RebuildOption func(*RebuildOptions)
+
+// WithRebuildConcurrency sets how many documents Rebuild indexes at once
+func WithRebuildConcurrency(n int) RebuildOption {
+	return func(o *RebuildOptions) {
+		o.Concurrency = n
+	}
+}
+
+// WithRebuildProgress sets a function called after each document Rebuild
+// processes. Calls never overlap, so fn needn't be safe for concurrent use.
+func WithRebuildProgress(fn func(RebuildProgress)) RebuildOption {
+	return func(o *RebuildOptions) {
+		o.Progress = fn
+	}
+}
+
+// Rebuild clears the index and indexes every document from the data source,
+// without comparing last_modified values as Sync does. It is meant for
+// rebuilding the index from the original documents, for example with
+// datasource.NewDataStoreSource over a storage prefix, after changing the
+// embedding model or splitter. On a view returned by ForTenant only the
+// tenant's documents are cleared. Documents are indexed concurrently; the
+// first error stops the rebuild, leaving the index partially rebuilt.
+func (kb *KnowledgeBase) Rebuild(ctx context.Context, ds datasource.DataSource, opts ...RebuildOption) (err error) {
+	options := RebuildOptions{Concurrency: DefaultRebuildConcurrency}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+
+	ctx, span := kb.tracer.Start(ctx, "kb.Rebuild", trace.WithAttributes(
+		attribute.Int("kb.concurrency", options.Concurrency),
+	))
+	defer func() {
+		err = kb.withTraceID(ctx, err)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	kb.opts.Recorder.Gauge(metrics.SyncInProgress, float64(kb.syncs.Add(1)), nil)
+	defer func() {
+		kb.opts.Recorder.Gauge(metrics.SyncInProgress, float64(kb.syncs.Add(-1)), nil)
+	}()
+
+	// An empty filter matches every document, or every document of the tenant
+	if err := kb.vectorStore().Delete(ctx, vectorstore.Filter{}); err != nil {
+		return err
+	}
+	kb.forgetTenantSimHashes()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	streamer, canStream := kb.streamerFor(ds)
+
+	streamOpts := kb.loadOptions(canStream)
+
+	var (
+		mu       sync.Mutex
+		progress RebuildProgress
+	)
+	report := func(doc datasource.Document, status string) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Source = doc.Source
+		progress.Status = status
+		progress.Processed++
+		if status == "indexed" {
+			progress.Indexed++
+		}
+		if options.Progress != nil {
+			options.Progress(progress)
+		}
+	}
+
+	work := make(chan datasource.Document)
+	var wg sync.WaitGroup
+	for range options.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for doc := range work {
+				status, err := kb.rebuildDocument(ctx, streamer, doc)
+				kb.recordSyncDocument(ctx, doc, status, err)
+				if err != nil {
+					cancel(err)
+					continue
+				}
+				report(doc, status)
+			}
+		}()
+	}
+
+	err = kb.feedRebuild(ctx, ds, streamOpts, work)
+	close(work)
+	wg.Wait()
+
+	if cause := context.Cause(ctx); cause != nil && err == nil {
+		err = cause
+	}
+	if err != nil {
+		kb.logger.ErrorContext(ctx, "rebuild failed", "code", errorCode(err), "error", err)
+		return err
+	}
+
+	span.SetAttributes(
+		attribute.Int("kb.processed", progress.Processed),
+		attribute.Int("kb.indexed", progress.Indexed),
+	)
+	return nil
+}
+
+// feedRebuild sends the documents of the data source to work until the data
+// source is done or ctx is canceled
+func (kb *KnowledgeBase) feedRebuild(
+	ctx context.Context,
+	ds datasource.DataSource,
+	opts []datasource.Option,
+	work chan<- datasource.Document,
+) error {
+	docChan, errChan := ds.Stream(ctx, opts...)
+	for {
+		select {
+		case doc, ok := <-docChan:
+			if !ok {
+				return nil
+			}
+			select {
+			case work <- doc:
+			case <-ctx.Done():
+				return nil
+			}
+		case err := <-errChan:
+			if err != nil {
+				return err
+			}
+			// A closed error channel only means no error; documents may remain
+			errChan = nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// rebuildDocument indexes a document into the cleared index, returning the
+// status recorded for it
+func (kb *KnowledgeBase) rebuildDocument(ctx context.Context, streamer datasource.ContentStreamer, doc datasource.Document) (string, error) {
+	streamed := streamer != nil && doc.Content == ""
+	if !streamed && kb.isEmpty(doc.Content) {
+		return "empty", nil
+	}
+
+	if original, distance, ok := kb.nearDuplicate(doc); ok {
+		kb.logger.DebugContext(ctx, "near duplicate",
+			"source", doc.Source,
+			"duplicate_of", original,
+			"distance", distance,
+		)
+		return "duplicate", nil
+	}
+
+	var err error
+	if streamed {
+		err = kb.processStream(ctx, streamer, doc)
+	} else {
+		err = kb.processData(ctx, doc)
+	}
+	if err != nil {
+		return "error", err
+	}
+	return "indexed", nil
+}
+
+// forgetTenantSimHashes drops the SimHashes of every source of the tenant,
+// whose index was cleared, so none are left to load from the store
+func (kb *KnowledgeBase) forgetTenantSimHashes() {
+	kb.reloadSimHashes()
+	kb.simhashes.mu.Lock()
+	kb.simhashes.loaded[kb.tenant] = true
+	kb.simhashes.mu.Unlock()
+}
@@ -0,0 +1,143 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// storedSources returns the sorted distinct sources of the store's chunks
+func storedSources(store *mocks.Store) []string {
+	seen := map[string]bool{}
+	var sources []string
+	for _, doc := range store.Documents() {
+		source := doc.Metadata["source"].(string)
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+func TestKnowledgeBase_RebuildFromDataStore(t *testing.T) {
+	ctx := context.Background()
+	objects := inmemory.NewInMemoryDataStore()
+	var want []string
+	for i := range 10 {
+		key := fmt.Sprintf("docs/%02d.txt", i)
+		if err := objects.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		want = append(want, key)
+	}
+
+	knowledgeBase, _, store := newSyncKB(t)
+	if err := knowledgeBase.AddText(ctx, "stale.txt", "no longer in storage", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	var progress []RebuildProgress
+	err := knowledgeBase.Rebuild(ctx, datasource.NewDataStoreSource(objects, "docs/"),
+		WithRebuildConcurrency(3),
+		WithRebuildProgress(func(p RebuildProgress) {
+			progress = append(progress, p)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+
+	if got := storedSources(store); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("sources after Rebuild() = %v, want %v", got, want)
+	}
+
+	if len(progress) != len(want) {
+		t.Fatalf("progress calls = %d, want one per document", len(progress))
+	}
+	for i, p := range progress {
+		if p.Processed != i+1 || p.Indexed != i+1 || p.Status != "indexed" {
+			t.Errorf("progress[%d] = %+v, want %d processed and indexed", i, p, i+1)
+		}
+	}
+}
+
+func TestKnowledgeBase_RebuildSkipsEmptyDocuments(t *testing.T) {
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10}, WithInputTrim(true))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	docs := append(syncDocs(), datasource.Document{Source: "blank.txt", Content: " \n", Metadata: map[string]interface{}{}})
+
+	var last RebuildProgress
+	err = knowledgeBase.Rebuild(context.Background(), mocks.NewDataSource(docs...), WithRebuildProgress(func(p RebuildProgress) {
+		last = p
+	}))
+	if err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+	if last.Processed != 3 || last.Indexed != 2 {
+		t.Errorf("last progress = %+v, want 3 processed and 2 indexed", last)
+	}
+	if got := storedSources(store); strings.Join(got, ",") != "a.txt,b.txt" {
+		t.Errorf("sources after Rebuild() = %v, want a.txt and b.txt", got)
+	}
+}
+
+func TestKnowledgeBase_RebuildStopsOnError(t *testing.T) {
+	knowledgeBase, _, store := newSyncKB(t)
+	failure := errors.New("store unavailable")
+	store.ReplaceSourceFunc = func(ctx context.Context, source string, docs []vectorstore.Document, vectors [][]float32) error {
+		return failure
+	}
+
+	var docs []datasource.Document
+	for i := range 50 {
+		docs = append(docs, datasource.Document{
+			Source:   fmt.Sprintf("%d.txt", i),
+			Content:  "some content",
+			Metadata: map[string]interface{}{},
+		})
+	}
+
+	err := knowledgeBase.Rebuild(context.Background(), mocks.NewDataSource(docs...), WithRebuildConcurrency(2))
+	if !errors.Is(err, failure) {
+		t.Fatalf("Rebuild() error = %v, want %v", err, failure)
+	}
+	if got := store.CallCount("ReplaceSource"); got >= len(docs) {
+		t.Errorf("ReplaceSource calls = %d, want the rebuild stopped early", got)
+	}
+}
+
+func TestKnowledgeBase_RebuildTenant(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, store := newTenantKB(t)
+	acme, globex := knowledgeBase.ForTenant("acme"), knowledgeBase.ForTenant("globex")
+
+	if err := acme.AddText(ctx, "stale.txt", "old acme notes", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+	if err := globex.AddText(ctx, "plans.txt", "globex plans", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+
+	if err := acme.Rebuild(ctx, mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Rebuild() error = %v", err)
+	}
+
+	// Sources are stored prefixed with the tenant
+	want := "acme/a.txt,acme/b.txt,globex/plans.txt"
+	if got := storedSources(store); strings.Join(got, ",") != want {
+		t.Errorf("sources after Rebuild() = %v, want %s", got, want)
+	}
+}
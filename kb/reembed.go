@@ -0,0 +1,304 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultReEmbedBatchSize is the number of documents ReEmbed embeds per request
+const DefaultReEmbedBatchSize = 100
+
+// ErrReEmbedFailures is wrapped by the error ReEmbed returns instead of
+// switching when more documents failed to re-embed than allowed
+var ErrReEmbedFailures = errors.New("too many documents failed to re-embed")
+
+// ReEmbedCheckpoint records how far a ReEmbed got. Pass the last one reported
+// to WithReEmbedResume to continue an interrupted migration.
+type ReEmbedCheckpoint struct {
+	Target    string `json:"target"`    // Table or collection the vectors are written to
+	Dimension int    `json:"dimension"` // Dimension of the new vectors
+	Cursor    string `json:"cursor"`    // Cursor of the last document written
+	Migrated  int    `json:"migrated"`  // Documents written so far
+	Failed    int    `json:"failed"`    // Documents the new embedder rejected so far
+}
+
+// MigrationFailure is a document the new embedder rejected
+type MigrationFailure struct {
+	ID     string // ID of the document in the store
+	Source string // Source of the document, if it has one
+	Err    error
+}
+
+// MigrationReport is the outcome of a ReEmbed. Counts include the documents
+// of the run a resumed migration continues.
+type MigrationReport struct {
+	Target    string
+	Dimension int
+	Migrated  int                // Documents written with new vectors
+	Failed    int                // Documents left out because the new embedder rejected them
+	Failures  []MigrationFailure // Failures of this run
+	Batches   int                // Batches embedded in this run
+	Duration  time.Duration      // Duration of this run
+	Resumed   bool               // Whether the run continued from a checkpoint
+	Switched  bool               // Whether the store now holds the new vectors
+}
+
+// ReEmbedOptions configures ReEmbed
+type ReEmbedOptions struct {
+	Target      string                  // Table or collection written to, "" for the store's default
+	BatchSize   int                     // Documents embedded per request
+	Dimension   int                     // Dimension of the new vectors, 0 to infer it
+	MaxFailures int                     // Rejected documents tolerated before refusing to switch
+	Resume      *ReEmbedCheckpoint      // Checkpoint to continue from
+	Checkpoint  func(ReEmbedCheckpoint) // Called after every batch is written
+}
+
+// ReEmbedOption configures ReEmbed
+type ReEmbedOption func(*ReEmbedOptions)
+
+// WithReEmbedTarget sets the table or collection the new vectors are written
+// to before they are switched in
+func WithReEmbedTarget(target string) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.Target = target
+	}
+}
+
+// WithReEmbedBatchSize sets how many documents are embedded per request
+func WithReEmbedBatchSize(n int) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.BatchSize = n
+	}
+}
+
+// WithReEmbedDimension sets the dimension of the new embedder's vectors. By
+// default it is looked up from the embedder's model, like New does, or else
+// measured by embedding a probe query.
+func WithReEmbedDimension(dimension int) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.Dimension = dimension
+	}
+}
+
+// WithReEmbedMaxFailures sets how many documents the new embedder may reject
+// before ReEmbed refuses to switch. Rejected documents are left out of the
+// new vectors, so the default is 0.
+func WithReEmbedMaxFailures(n int) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.MaxFailures = n
+	}
+}
+
+// WithReEmbedResume continues the migration recorded by checkpoint, keeping
+// the vectors already written to its target
+func WithReEmbedResume(checkpoint ReEmbedCheckpoint) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.Resume = &checkpoint
+	}
+}
+
+// WithReEmbedCheckpoint sets a function called after every batch is written,
+// to persist the checkpoint a failed migration resumes from
+func WithReEmbedCheckpoint(fn func(ReEmbedCheckpoint)) ReEmbedOption {
+	return func(o *ReEmbedOptions) {
+		o.Checkpoint = fn
+	}
+}
+
+// ReEmbed migrates the knowledge base to newEmbedder without re-reading its
+// data sources, such as when switching embedding models. It pages through the
+// stored chunks, embeds their content in batches with newEmbedder and writes
+// the vectors to a target table or collection, which then replaces the
+// store's in one step; after that the knowledge base searches and indexes
+// with newEmbedder. The store must implement vectorstore.DocumentLister and
+// vectorstore.VectorMigrator, so it fails with ErrCodeNotSupported on other
+// stores and on views returned by ForTenant.
+//
+// Chunks written to the store while ReEmbed runs may be left out, so it
+// shouldn't run alongside Sync. Views returned by ForTenant before the switch
+// keep the old embedder. The report is returned with any error, and the last
+// checkpoint resumes the migration.
+func (kb *KnowledgeBase) ReEmbed(ctx context.Context, newEmbedder embedding.Embedder, opts ...ReEmbedOption) (report *MigrationReport, err error) {
+	options := ReEmbedOptions{BatchSize: DefaultReEmbedBatchSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultReEmbedBatchSize
+	}
+
+	ctx, span := kb.tracer.Start(ctx, "kb.ReEmbed")
+	start := time.Now()
+	report = &MigrationReport{Target: options.Target, Resumed: options.Resume != nil}
+	defer func() {
+		report.Duration = time.Since(start)
+		err = kb.withTraceID(ctx, err)
+		if err != nil {
+			kb.logger.ErrorContext(ctx, "re-embed failed", "code", errorCode(err), "error", err)
+		}
+		span.SetAttributes(
+			attribute.Int("kb.migrated", report.Migrated),
+			attribute.Int("kb.failed", report.Failed),
+			attribute.Bool("kb.switched", report.Switched),
+		)
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if err := vectorstore.RequireCapabilities(kb.store, vectorstore.CapabilityListDocuments, vectorstore.CapabilityMigrate); err != nil {
+		return report, err
+	}
+	lister, canList := vectorstore.Unwrap(kb.store).(vectorstore.DocumentLister)
+	migrator, canMigrate := vectorstore.Unwrap(kb.store).(vectorstore.VectorMigrator)
+	if !canList || !canMigrate {
+		return report, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "ReEmbed",
+			Store:   "kb",
+			Message: "store does not support listing and migrating documents",
+		}
+	}
+
+	checkpoint := ReEmbedCheckpoint{Target: options.Target, Dimension: options.Dimension}
+	if options.Resume != nil {
+		checkpoint = *options.Resume
+		if options.Dimension > 0 {
+			checkpoint.Dimension = options.Dimension
+		}
+	}
+	if checkpoint.Dimension == 0 {
+		if checkpoint.Dimension, err = kb.embedderDimension(ctx, newEmbedder); err != nil {
+			return report, err
+		}
+	}
+	report.Target, report.Dimension = checkpoint.Target, checkpoint.Dimension
+	report.Migrated, report.Failed = checkpoint.Migrated, checkpoint.Failed
+
+	if err := migrator.PrepareMigration(ctx, checkpoint.Target, checkpoint.Dimension, options.Resume != nil); err != nil {
+		return report, err
+	}
+
+	for {
+		docs, next, err := lister.ListDocuments(ctx, checkpoint.Cursor, options.BatchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+
+		ids, vectors, failures, err := kb.reEmbedBatch(ctx, newEmbedder, docs, checkpoint.Dimension)
+		if err != nil {
+			return report, err
+		}
+		if err := migrator.WriteVectors(ctx, checkpoint.Target, ids, vectors); err != nil {
+			return report, err
+		}
+
+		checkpoint.Cursor = next
+		checkpoint.Migrated += len(ids)
+		checkpoint.Failed += len(failures)
+		report.Migrated, report.Failed = checkpoint.Migrated, checkpoint.Failed
+		report.Failures = append(report.Failures, failures...)
+		report.Batches++
+		if options.Checkpoint != nil {
+			options.Checkpoint(checkpoint)
+		}
+	}
+
+	if checkpoint.Failed > options.MaxFailures {
+		return report, fmt.Errorf("%w: %d of %d documents, %d allowed",
+			ErrReEmbedFailures, checkpoint.Failed, checkpoint.Migrated+checkpoint.Failed, options.MaxFailures)
+	}
+	if err := migrator.SwitchMigration(ctx, checkpoint.Target, checkpoint.Dimension); err != nil {
+		return report, err
+	}
+	report.Switched = true
+
+	if kb.opts.TracerProvider != nil {
+		newEmbedder = embedding.NewTracingEmbedder(newEmbedder, kb.opts.TracerProvider)
+	}
+	kb.mu.Lock()
+	kb.embedder = newEmbedder
+	kb.configureLocked()
+	kb.mu.Unlock()
+
+	kb.logger.InfoContext(ctx, "re-embedded knowledge base",
+		"target", report.Target,
+		"dimension", report.Dimension,
+		"migrated", report.Migrated,
+		"failed", report.Failed,
+		"duration", time.Since(start),
+	)
+	return report, nil
+}
+
+// reEmbedBatch embeds the content of docs, returning the IDs and vectors of
+// the documents embedded and the documents embedder rejected
+func (kb *KnowledgeBase) reEmbedBatch(
+	ctx context.Context,
+	embedder embedding.Embedder,
+	docs []vectorstore.StoredDocument,
+	dimension int,
+) ([]string, [][]float32, []MigrationFailure, error) {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+		if kb.opts.EmbeddingTemplate != nil {
+			texts[i] = kb.opts.EmbeddingTemplate(doc.ToDocument())
+		}
+	}
+
+	vectors, err := embedder.EmbedDocuments(ctx, texts)
+	rejected := make(map[int]error)
+	if err != nil {
+		var partial *embedding.PartialEmbedError
+		if !errors.As(err, &partial) || len(vectors) != len(docs) {
+			return nil, nil, nil, err
+		}
+		for i, index := range partial.Failed {
+			rejected[index] = partial.Errs[i]
+		}
+	}
+	if len(vectors) != len(docs) {
+		return nil, nil, nil, fmt.Errorf("embedder returned %d vectors for %d documents", len(vectors), len(docs))
+	}
+
+	ids := make([]string, 0, len(docs))
+	kept := make([][]float32, 0, len(docs))
+	var failures []MigrationFailure
+	for i, doc := range docs {
+		if err, ok := rejected[i]; ok {
+			source, _ := doc.Metadata["source"].(string)
+			failures = append(failures, MigrationFailure{ID: doc.ID, Source: source, Err: err})
+			continue
+		}
+		if len(vectors[i]) != dimension {
+			return nil, nil, nil, vectorstore.NewInvalidDimensionsError("kb", dimension, len(vectors[i]))
+		}
+		ids = append(ids, doc.ID)
+		kept = append(kept, vectors[i])
+	}
+	return ids, kept, failures, nil
+}
+
+// embedderDimension returns the dimension of the vectors embedder produces,
+// known from its configuration or model as in validateDimensions or else measured
+func (kb *KnowledgeBase) embedderDimension(ctx context.Context, embedder embedding.Embedder) (int, error) {
+	if dimension, known := expectedDimension(embedder, kb.opts.ModelDimensions); known {
+		return dimension, nil
+	}
+
+	vector, err := embedder.EmbedQuery(ctx, "dimension probe")
+	if err != nil {
+		return 0, err
+	}
+	return len(vector), nil
+}
@@ -0,0 +1,259 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// migratingStore adds DocumentLister and VectorMigrator to mocks.Store.
+// Documents are listed by their position, which is their ID.
+type migratingStore struct {
+	*mocks.Store
+
+	mu        sync.Mutex
+	target    string
+	written   map[string][]float32
+	dimension int
+}
+
+func (s *migratingStore) ListDocuments(ctx context.Context, cursor string, limit int) ([]vectorstore.StoredDocument, string, error) {
+	start := 0
+	if cursor != "" {
+		start, _ = strconv.Atoi(cursor)
+	}
+	docs := s.Documents()
+	var page []vectorstore.StoredDocument
+	for i := start; i < len(docs) && len(page) < limit; i++ {
+		page = append(page, vectorstore.StoredDocument{ID: strconv.Itoa(i), Document: docs[i]})
+		cursor = strconv.Itoa(i + 1)
+	}
+	return page, cursor, nil
+}
+
+func (s *migratingStore) PrepareMigration(ctx context.Context, target string, dimension int, resume bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !resume || s.written == nil || s.target != target {
+		s.written = make(map[string][]float32)
+	}
+	s.target = target
+	return nil
+}
+
+func (s *migratingStore) WriteVectors(ctx context.Context, target string, ids []string, vectors [][]float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if target != s.target {
+		return fmt.Errorf("target %q was not prepared", target)
+	}
+	for i, id := range ids {
+		s.written[id] = vectors[i]
+	}
+	return nil
+}
+
+func (s *migratingStore) SwitchMigration(ctx context.Context, target string, dimension int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := s.Documents()
+	var kept []vectorstore.Document
+	var vectors [][]float32
+	for i, doc := range docs {
+		if vector, ok := s.written[strconv.Itoa(i)]; ok {
+			kept = append(kept, doc)
+			vectors = append(vectors, vector)
+		}
+	}
+	if err := s.Store.InitDB(ctx, true); err != nil {
+		return err
+	}
+	s.dimension = dimension
+	return s.Store.AddDocuments(ctx, kept, vectors)
+}
+
+// newMigratingKB returns a knowledge base with syncDocs indexed with 8
+// dimensional vectors
+func newMigratingKB(t *testing.T) (*KnowledgeBase, *migratingStore) {
+	t.Helper()
+	store := &migratingStore{Store: mocks.NewStore()}
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.Sync(context.Background(), mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	return knowledgeBase, store
+}
+
+func TestKnowledgeBase_ReEmbed(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, store := newMigratingKB(t)
+	chunks := len(store.Documents())
+
+	newEmbedder := mocks.NewEmbedder(4)
+	var checkpoints []ReEmbedCheckpoint
+	report, err := knowledgeBase.ReEmbed(ctx, newEmbedder,
+		WithReEmbedBatchSize(4),
+		WithReEmbedTarget("docs_v2"),
+		WithReEmbedCheckpoint(func(c ReEmbedCheckpoint) { checkpoints = append(checkpoints, c) }),
+	)
+	if err != nil {
+		t.Fatalf("ReEmbed() error = %v", err)
+	}
+
+	if !report.Switched || report.Migrated != chunks || report.Failed != 0 || report.Batches != 2 {
+		t.Errorf("report = %+v, want %d chunks migrated in 2 batches and switched", report, chunks)
+	}
+	if report.Target != "docs_v2" || report.Dimension != 4 || report.Duration <= 0 {
+		t.Errorf("report = %+v, want target docs_v2 of dimension 4 and a duration", report)
+	}
+	if len(checkpoints) != 2 || checkpoints[1].Migrated != chunks || checkpoints[1].Target != "docs_v2" {
+		t.Errorf("checkpoints = %+v, want one per batch", checkpoints)
+	}
+	if store.dimension != 4 || len(store.Documents()) != chunks {
+		t.Errorf("store has %d chunks of dimension %d, want %d of dimension 4", len(store.Documents()), store.dimension, chunks)
+	}
+
+	// Searches now embed queries with the new embedder
+	results, err := knowledgeBase.SimilaritySearch(ctx, "goroutines", 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Metadata["source"] != "a.txt" {
+		t.Errorf("SimilaritySearch() = %v, want a chunk of a.txt", results)
+	}
+	// One query probed the dimension, the other was the search
+	if got := newEmbedder.CallCount("EmbedQuery"); got != 2 {
+		t.Errorf("new embedder EmbedQuery calls = %d, want 2", got)
+	}
+}
+
+func TestKnowledgeBase_ReEmbedResume(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, store := newMigratingKB(t)
+	chunks := len(store.Documents())
+
+	// The second batch fails, leaving the first written
+	failing := mocks.NewEmbedder(4)
+	failing.FailNext("EmbedDocuments", nil, errors.New("rate limited"))
+	var last ReEmbedCheckpoint
+	report, err := knowledgeBase.ReEmbed(ctx, failing,
+		WithReEmbedBatchSize(4),
+		WithReEmbedDimension(4),
+		WithReEmbedCheckpoint(func(c ReEmbedCheckpoint) { last = c }),
+	)
+	if err == nil || report.Switched {
+		t.Fatalf("ReEmbed() error = %v, switched = %v, want the failed batch to stop it", err, report.Switched)
+	}
+	if last.Migrated != 4 || report.Migrated != 4 {
+		t.Fatalf("checkpoint = %+v, report = %+v, want the first batch recorded", last, report)
+	}
+
+	newEmbedder := mocks.NewEmbedder(4)
+	report, err = knowledgeBase.ReEmbed(ctx, newEmbedder, WithReEmbedBatchSize(4), WithReEmbedResume(last))
+	if err != nil {
+		t.Fatalf("resumed ReEmbed() error = %v", err)
+	}
+	if !report.Resumed || !report.Switched || report.Migrated != chunks || report.Batches != 1 {
+		t.Errorf("report = %+v, want the remaining batch migrated and switched", report)
+	}
+	embedded := 0
+	for _, call := range newEmbedder.Calls("EmbedDocuments") {
+		embedded += len(call.Args[0].([]string))
+	}
+	if embedded != chunks-4 {
+		t.Errorf("resumed run embedded %d chunks, want %d", embedded, chunks-4)
+	}
+	if len(store.Documents()) != chunks {
+		t.Errorf("store has %d chunks after the switch, want %d", len(store.Documents()), chunks)
+	}
+}
+
+func TestKnowledgeBase_ReEmbedFailures(t *testing.T) {
+	// rejectFirst makes the embedder reject the first text of every batch
+	rejectFirst := func(e *mocks.Embedder) {
+		e.EmbedDocumentsFunc = func(ctx context.Context, texts []string) ([][]float32, error) {
+			vectors := make([][]float32, len(texts))
+			for i := 1; i < len(texts); i++ {
+				vectors[i] = mocks.HashVector(texts[i], 4)
+			}
+			return vectors, &embedding.PartialEmbedError{Failed: []int{0}, Errs: []error{errors.New("too long")}, Total: len(texts)}
+		}
+	}
+
+	t.Run("Refuses to switch", func(t *testing.T) {
+		knowledgeBase, store := newMigratingKB(t)
+		chunks := len(store.Documents())
+		newEmbedder := mocks.NewEmbedder(4)
+		rejectFirst(newEmbedder)
+
+		report, err := knowledgeBase.ReEmbed(context.Background(), newEmbedder, WithReEmbedDimension(4))
+		if !errors.Is(err, ErrReEmbedFailures) {
+			t.Fatalf("ReEmbed() error = %v, want ErrReEmbedFailures", err)
+		}
+		if report.Switched || report.Failed != 1 || report.Migrated != chunks-1 {
+			t.Errorf("report = %+v, want one failure and no switch", report)
+		}
+		if len(report.Failures) != 1 || report.Failures[0].ID != "0" || report.Failures[0].Source != "a.txt" {
+			t.Errorf("failures = %+v, want the first chunk of a.txt", report.Failures)
+		}
+		if store.dimension != 0 {
+			t.Error("store was switched")
+		}
+	})
+
+	t.Run("Within the limit", func(t *testing.T) {
+		knowledgeBase, store := newMigratingKB(t)
+		chunks := len(store.Documents())
+		newEmbedder := mocks.NewEmbedder(4)
+		rejectFirst(newEmbedder)
+
+		report, err := knowledgeBase.ReEmbed(context.Background(), newEmbedder,
+			WithReEmbedDimension(4),
+			WithReEmbedMaxFailures(1),
+		)
+		if err != nil {
+			t.Fatalf("ReEmbed() error = %v", err)
+		}
+		if !report.Switched || len(store.Documents()) != chunks-1 {
+			t.Errorf("report = %+v, store has %d chunks, want the rejected chunk left out", report, len(store.Documents()))
+		}
+	})
+}
+
+func TestKnowledgeBase_ReEmbedNotSupported(t *testing.T) {
+	knowledgeBase, _, _ := newSyncKB(t)
+
+	_, err := knowledgeBase.ReEmbed(context.Background(), mocks.NewEmbedder(4))
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("ReEmbed() error = %v, want ErrCodeNotSupported", err)
+	}
+}
+
+func TestKnowledgeBase_ReEmbedTenantView(t *testing.T) {
+	knowledgeBase, store := newMigratingKB(t)
+	knowledgeBase.UpdateOptions(WithTenantKey("tenant"))
+	view := knowledgeBase.ForTenant("acme")
+
+	if caps := vectorstore.Capabilities(view.store); caps.ListDocuments || caps.Migrate || caps.VectorColumns {
+		t.Errorf("view capabilities = %+v, want no listing, migration or vector columns", caps)
+	}
+	_, err := view.ReEmbed(context.Background(), mocks.NewEmbedder(4))
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("ReEmbed() on a tenant view error = %v, want ErrCodeNotSupported", err)
+	}
+	if store.written != nil {
+		t.Error("migration prepared through a tenant view")
+	}
+}
@@ -0,0 +1,35 @@
+package kb
+
+import (
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// ModelRouter picks the LLM options Query and QueryWithHistory answer a
+// question with, such as llm.WithModel, so simple questions can go to a
+// cheaper model than complex ones. A nil option keeps the LLM's defaults.
+type ModelRouter func(question string) llm.Option
+
+// NewLengthRouter returns a ModelRouter sending questions of more than
+// maxWords words to strongModel and shorter ones to cheapModel, on the
+// assumption that longer questions ask for more reasoning
+func NewLengthRouter(cheapModel, strongModel string, maxWords int) ModelRouter {
+	return func(question string) llm.Option {
+		if len(strings.Fields(question)) > maxWords {
+			return llm.WithModel(strongModel)
+		}
+		return llm.WithModel(cheapModel)
+	}
+}
+
+// routeOptions returns the options the ModelRouter picks for question
+func (kb *KnowledgeBase) routeOptions(question string) []llm.Option {
+	if kb.opts.ModelRouter == nil {
+		return nil
+	}
+	if opt := kb.opts.ModelRouter(question); opt != nil {
+		return []llm.Option{opt}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package kb
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
+)
+
+// LevelMetadataKey is the metadata key chunks indexed with
+// WithMultiLevelSplit carry their level under, the position of the splitter
+// that produced them
+const LevelMetadataKey = "level"
+
+// streamerFor returns ds as a ContentStreamer if its documents are read as
+// streams. Multi-level splitting reads a document once per level, so its
+// documents are loaded in full.
+func (kb *KnowledgeBase) streamerFor(ds datasource.DataSource) (datasource.ContentStreamer, bool) {
+	if len(kb.opts.SplitLevels) > 0 {
+		return nil, false
+	}
+	streamer, ok := ds.(datasource.ContentStreamer)
+	return streamer, ok
+}
+
+// splitDocument splits docu into the chunks indexed for doc, numbering them
+// from 0. With multi-level splitting, chunks of every level are returned in
+// order, each level numbered from 0 and tagged with LevelMetadataKey.
+func (kb *KnowledgeBase) splitDocument(doc datasource.Document, docu document.Document) ([]document.Document, error) {
+	if len(kb.opts.SplitLevels) == 0 {
+		chunks, err := document.SplitDocuments(kb.splitterFor(doc), []document.Document{docu})
+		if err != nil {
+			return nil, err
+		}
+		for i, chunk := range chunks {
+			chunk.Metadata[ChunkIndexMetadataKey] = i
+		}
+		return chunks, nil
+	}
+
+	var chunks []document.Document
+	for level, splitter := range kb.opts.SplitLevels {
+		levelChunks, err := document.SplitDocuments(splitter, []document.Document{docu})
+		if err != nil {
+			return nil, fmt.Errorf("level %d: %w", level, err)
+		}
+		for i, chunk := range levelChunks {
+			chunk.Metadata[ChunkIndexMetadataKey] = i
+			chunk.Metadata[LevelMetadataKey] = level
+		}
+		chunks = append(chunks, levelChunks...)
+	}
+	return chunks, nil
+}
+
+// splitterFor returns the splitter SplitterRouter picks for doc, or the
+// default splitter
+func (kb *KnowledgeBase) splitterFor(doc datasource.Document) document.Splitter {
+	if kb.opts.SplitterRouter != nil {
+		if splitter := kb.opts.SplitterRouter(doc); splitter != nil {
+			return splitter
+		}
+	}
+	return kb.splitter
+}
+
+// SplitterByExtension returns a router for WithSplitterRouter that picks a
+// splitter by the file extension of the document's source, such as ".md" or
+// ".go". Extensions are matched without case, and sources that are URLs are
+// matched by their path. Other documents use the default splitter.
+func SplitterByExtension(splitters map[string]document.Splitter) func(doc datasource.Document) document.Splitter {
+	byExt := make(map[string]document.Splitter, len(splitters))
+	for ext, splitter := range splitters {
+		byExt["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = splitter
+	}
+
+	return func(doc datasource.Document) document.Splitter {
+		source := doc.Source
+		if u, err := url.Parse(source); err == nil && u.Scheme != "" {
+			source = u.Path
+		}
+		return byExt[strings.ToLower(path.Ext(source))]
+	}
+}
@@ -0,0 +1,145 @@
+package kb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// taggingSplitter returns the text as one chunk prefixed with its name, so
+// stored chunks show which splitter produced them
+type taggingSplitter struct {
+	name string
+}
+
+func (s taggingSplitter) SplitText(text string) ([]string, error) {
+	return []string{s.name + ": " + text}, nil
+}
+
+func TestKnowledgeBase_SplitterRouter(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, taggingSplitter{name: "default"},
+		WithSplitterRouter(SplitterByExtension(map[string]document.Splitter{
+			"md":  taggingSplitter{name: "markdown"},
+			".go": taggingSplitter{name: "code"},
+		})),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	docs := []datasource.Document{
+		{Source: "docs/README.md", Content: "# Title", Metadata: map[string]interface{}{"last_modified": "1"}},
+		{Source: "main.go", Content: "package main", Metadata: map[string]interface{}{"last_modified": "1"}},
+		{Source: "https://example.com/guide.MD?raw=1", Content: "## Guide", Metadata: map[string]interface{}{"last_modified": "1"}},
+		{Source: "notes.txt", Content: "plain text", Metadata: map[string]interface{}{"last_modified": "1"}},
+	}
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(docs...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	want := map[string]string{
+		"docs/README.md":                     "markdown",
+		"main.go":                            "code",
+		"https://example.com/guide.MD?raw=1": "markdown",
+		"notes.txt":                          "default",
+	}
+	stored := store.Documents()
+	if len(stored) != len(want) {
+		t.Fatalf("stored %d chunks, want %d", len(stored), len(want))
+	}
+	for _, chunk := range stored {
+		source := chunk.Metadata["source"].(string)
+		if splitter, _, _ := strings.Cut(chunk.PageContent, ":"); splitter != want[source] {
+			t.Errorf("%s was split by the %s splitter, want %s", source, splitter, want[source])
+		}
+	}
+}
+
+func newMultiLevelKB(t *testing.T) (*KnowledgeBase, *mocks.Store) {
+	t.Helper()
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, taggingSplitter{name: "default"},
+		WithMultiLevelSplit([]document.Splitter{fixedSplitter{size: 2}, fixedSplitter{size: 4}, fixedSplitter{size: 100}}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.AddText(context.Background(), "letters.txt", "aabbccddeeff", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+	return knowledgeBase, store
+}
+
+func TestKnowledgeBase_MultiLevelSplit(t *testing.T) {
+	_, store := newMultiLevelKB(t)
+
+	perLevel := make(map[int][]string)
+	for _, chunk := range store.Documents() {
+		level, ok := chunk.Metadata[LevelMetadataKey].(int)
+		if !ok {
+			t.Fatalf("chunk %q has level %v, want an int", chunk.PageContent, chunk.Metadata[LevelMetadataKey])
+		}
+		if chunk.Metadata[ChunkIndexMetadataKey] != len(perLevel[level]) || chunk.Metadata[ParentIDMetadataKey] != "letters.txt" {
+			t.Errorf("chunk %q metadata = %v, want it numbered within its level", chunk.PageContent, chunk.Metadata)
+		}
+		perLevel[level] = append(perLevel[level], chunk.PageContent)
+	}
+
+	want := map[int][]string{
+		0: {"aa", "bb", "cc", "dd", "ee", "ff"},
+		1: {"aabb", "ccdd", "eeff"},
+		2: {"aabbccddeeff"},
+	}
+	if len(perLevel) != len(want) {
+		t.Fatalf("chunks at %d levels, want %d: %v", len(perLevel), len(want), perLevel)
+	}
+	for level, chunks := range want {
+		if strings.Join(perLevel[level], ",") != strings.Join(chunks, ",") {
+			t.Errorf("level %d chunks = %v, want %v", level, perLevel[level], chunks)
+		}
+	}
+}
+
+func TestKnowledgeBase_MultiLevelSplitNeighbors(t *testing.T) {
+	knowledgeBase, store := newMultiLevelKB(t)
+	var hit vectorstore.Document
+	for _, chunk := range store.Documents() {
+		if chunk.PageContent == "ccdd" {
+			hit = chunk
+		}
+	}
+	store.SimilaritySearchFunc = func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+		return []vectorstore.Document{hit}, nil
+	}
+
+	docs, err := knowledgeBase.QueryWithNeighbors(context.Background(), "letters", 1, vectorstore.Filter{LevelMetadataKey: 1}, 1)
+	if err != nil {
+		t.Fatalf("QueryWithNeighbors() error = %v", err)
+	}
+	if len(docs) != 1 || docs[0].PageContent != "aabb\nccdd\neeff" {
+		t.Errorf("QueryWithNeighbors() = %v, want the neighbors from the hit's level", docs)
+	}
+}
+
+func TestKnowledgeBase_MultiLevelSplitLoadsContent(t *testing.T) {
+	source := &streamingSource{reader: &countingReader{size: 10}}
+	knowledgeBase, err := New(mocks.NewEmbedder(8), mocks.NewStore(), fixedSplitter{size: 5},
+		WithMultiLevelSplit([]document.Splitter{fixedSplitter{size: 5}, fixedSplitter{size: 10}}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.Sync(context.Background(), source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if source.skipContent || source.reader.read != 0 {
+		t.Errorf("content skipped = %v with %d bytes streamed, want documents loaded in full", source.skipContent, source.reader.read)
+	}
+}
@@ -0,0 +1,378 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+func syncDocs() []datasource.Document {
+	return []datasource.Document{
+		{Source: "a.txt", Content: "goroutines and channels", Metadata: map[string]interface{}{"last_modified": "1"}},
+		{Source: "b.txt", Content: "ownership and borrowing", Metadata: map[string]interface{}{"last_modified": "1"}},
+	}
+}
+
+func newSyncKB(t *testing.T) (*KnowledgeBase, *mocks.Embedder, *mocks.Store) {
+	t.Helper()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return knowledgeBase, embedder, store
+}
+
+func TestKnowledgeBase_SyncIndexesAndSkipsUpToDate(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, embedder, store := newSyncKB(t)
+	source := mocks.NewDataSource(syncDocs()...)
+
+	if err := knowledgeBase.Sync(ctx, source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	indexed := len(store.Documents())
+	if indexed == 0 {
+		t.Fatal("Sync() stored no chunks")
+	}
+	if got := store.CallCount("ReplaceSource"); got != 2 {
+		t.Errorf("ReplaceSource calls = %d, want one per source", got)
+	}
+
+	results, err := knowledgeBase.SimilaritySearch(ctx, "goroutines", 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Metadata["source"] != "a.txt" {
+		t.Errorf("SimilaritySearch() = %v, want a chunk of a.txt", results)
+	}
+
+	// A second sync with unchanged last_modified values embeds nothing
+	embedCalls := embedder.CallCount("EmbedDocuments")
+	if err := knowledgeBase.Sync(ctx, source); err != nil {
+		t.Fatalf("second Sync() error = %v", err)
+	}
+	if got := embedder.CallCount("EmbedDocuments"); got != embedCalls {
+		t.Errorf("EmbedDocuments calls = %d after an up-to-date sync, want %d", got, embedCalls)
+	}
+	if got := len(store.Documents()); got != indexed {
+		t.Errorf("stored %d chunks after an up-to-date sync, want %d", got, indexed)
+	}
+}
+
+func TestKnowledgeBase_SyncReplacesModifiedDocuments(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, _, store := newSyncKB(t)
+
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	modified := syncDocs()[:1]
+	modified[0].Content = "select"
+	modified[0].Metadata["last_modified"] = "2"
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(modified...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	var chunks []string
+	for _, doc := range store.Documents() {
+		if doc.Metadata["source"] == "a.txt" {
+			chunks = append(chunks, doc.PageContent)
+		}
+	}
+	if len(chunks) != 1 || chunks[0] != "select" {
+		t.Errorf("chunks of a.txt = %v, want only the modified content", chunks)
+	}
+}
+
+func TestKnowledgeBase_SyncErrors(t *testing.T) {
+	errInjected := errors.New("injected")
+
+	tests := []struct {
+		name  string
+		setup func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource)
+	}{
+		{
+			name: "Source stream fails",
+			setup: func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource) {
+				source.FailNext("Stream", errInjected)
+			},
+		},
+		{
+			name: "Source fails mid stream",
+			setup: func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource) {
+				source.FailNext("StreamDocument", nil, errInjected)
+			},
+		},
+		{
+			name: "Up-to-date check fails",
+			setup: func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource) {
+				store.FailNext("DocumentExists", errInjected)
+			},
+		},
+		{
+			name: "Replacing old chunks fails",
+			setup: func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource) {
+				store.FailWith("ReplaceSource", errInjected)
+			},
+		},
+		{
+			name: "Embedding fails",
+			setup: func(embedder *mocks.Embedder, store *mocks.Store, source *mocks.DataSource) {
+				embedder.FailNext("EmbedDocuments", nil, errInjected)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knowledgeBase, embedder, store := newSyncKB(t)
+			source := mocks.NewDataSource(syncDocs()...)
+			tt.setup(embedder, store, source)
+
+			err := knowledgeBase.Sync(context.Background(), source)
+			if !errors.Is(err, errInjected) {
+				t.Errorf("Sync() error = %v, want %v", err, errInjected)
+			}
+		})
+	}
+}
+
+func TestKnowledgeBase_SyncCanceled(t *testing.T) {
+	knowledgeBase, embedder, _ := newSyncKB(t)
+	embedder.SetLatency(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()...))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Sync() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestKnowledgeBase_SyncReplacesBySource(t *testing.T) {
+	knowledgeBase, _, store := newSyncKB(t)
+
+	if err := knowledgeBase.Sync(context.Background(), mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for i, call := range store.Calls("ReplaceSource") {
+		if want := syncDocs()[i].Source; call.Args[0] != want {
+			t.Errorf("ReplaceSource call %d source = %v, want %s", i, call.Args[0], want)
+		}
+	}
+	if got := store.CallCount("Delete"); got != 0 {
+		t.Errorf("Delete calls = %d, want none with a native ReplaceSource", got)
+	}
+}
+
+func TestKnowledgeBase_SyncFallsBackToDeleteThenAdd(t *testing.T) {
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), deleteAddStore{store}, fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(context.Background(), mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for i, call := range store.Calls("Delete") {
+		filter := call.Args[0].(vectorstore.Filter)
+		if want := syncDocs()[i].Source; len(filter) != 1 || filter["source"] != want {
+			t.Errorf("Delete call %d filter = %v, want source=%s", i, filter, want)
+		}
+	}
+	if got := store.CallCount("AddDocuments"); got != 2 {
+		t.Errorf("AddDocuments calls = %d, want one per source", got)
+	}
+}
+
+// deleteAddStore hides the native ReplaceSource of the store it wraps
+type deleteAddStore struct {
+	vectorstore.Store
+}
+
+func TestKnowledgeBase_SyncSkipsEmptyContent(t *testing.T) {
+	ctx := context.Background()
+	recorder := metrics.NewInMemoryRecorder()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, fixedSplitter{size: 10}, WithRecorder(recorder))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	docs := []datasource.Document{
+		// The second chunk of a.txt is only whitespace
+		{Source: "a.txt", Content: "goroutines          ", Metadata: map[string]interface{}{"last_modified": "1"}},
+		{Source: "b.txt", Content: " \n\n\t ", Metadata: map[string]interface{}{"last_modified": "1"}},
+	}
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(docs...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, call := range embedder.Calls("EmbedDocuments") {
+		for _, text := range call.Args[0].([]string) {
+			if strings.TrimSpace(text) == "" {
+				t.Errorf("embedded texts = %q, want no empty text", call.Args[0])
+			}
+		}
+	}
+	if stored := store.Documents(); len(stored) != 1 || stored[0].PageContent != "goroutines" {
+		t.Errorf("stored chunks = %v, want only the non-empty chunk of a.txt", stored)
+	}
+	for status, want := range map[string]float64{"indexed": 1, "empty": 1} {
+		if got := recorder.Sum(metrics.SyncDocuments, metrics.Labels{"status": status}); got != want {
+			t.Errorf("%s{status=%s} = %v, want %v", metrics.SyncDocuments, status, got, want)
+		}
+	}
+}
+
+func TestKnowledgeBase_SyncMetadata(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(8), mocks.NewStore()
+	knowledgeBase, err := New(embedder, store, fixedSplitter{size: 10},
+		WithSyncMetadata(map[string]interface{}{"collection": "handbook", "last_modified": "0"}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	stored := store.Documents()
+	if len(stored) == 0 {
+		t.Fatal("Sync() stored no chunks")
+	}
+	for _, chunk := range stored {
+		if chunk.Metadata["collection"] != "handbook" || chunk.Metadata["last_modified"] != "1" {
+			t.Errorf("chunk metadata = %v, want the sync metadata without the source's replaced", chunk.Metadata)
+		}
+	}
+}
+
+func TestKnowledgeBase_SyncMaxDocumentBytes(t *testing.T) {
+	ctx := context.Background()
+	oversized := datasource.Document{
+		Source:   "huge.log",
+		Content:  strings.Repeat("log line\n", 100),
+		Metadata: map[string]interface{}{"last_modified": "1"},
+	}
+
+	t.Run("Fails", func(t *testing.T) {
+		store := mocks.NewStore()
+		knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10}, WithMaxDocumentBytes(100))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		err = knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()[0], oversized))
+		if !errors.Is(err, document.ErrDocumentTooLarge) || !strings.Contains(err.Error(), "huge.log: document too large: 900 bytes, limit is 100") {
+			t.Fatalf("Sync() error = %v, want ErrDocumentTooLarge naming the source and sizes", err)
+		}
+		for _, chunk := range store.Documents() {
+			if chunk.Metadata["source"] == "huge.log" {
+				t.Fatal("oversized document was indexed")
+			}
+		}
+	})
+
+	t.Run("Truncates", func(t *testing.T) {
+		store := mocks.NewStore()
+		knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10},
+			WithMaxDocumentBytes(100),
+			WithTruncateOversized(true),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()[0], oversized)); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		indexed := 0
+		for _, chunk := range store.Documents() {
+			truncated := chunk.Metadata[document.TruncatedMetadataKey] == true
+			if chunk.Metadata["source"] != "huge.log" {
+				if truncated {
+					t.Errorf("chunk of %v flagged as truncated", chunk.Metadata["source"])
+				}
+				continue
+			}
+			indexed += len(chunk.PageContent)
+			if !truncated || chunk.Metadata[document.OriginalBytesMetadataKey] != 900 {
+				t.Errorf("chunk metadata = %v, want it flagged as truncated from 900 bytes", chunk.Metadata)
+			}
+		}
+		if indexed != 100 {
+			t.Errorf("indexed %d bytes of huge.log, want 100", indexed)
+		}
+	})
+}
+
+func TestKnowledgeBase_SyncMaxDocumentBytesStreamed(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Fails", func(t *testing.T) {
+		store := &fakeStore{}
+		knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 100},
+			WithStreamWindowSize(1000),
+			WithStreamBatchSize(1),
+			WithMaxDocumentBytes(5000),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		source := &streamingSource{reader: &countingReader{size: 10000}}
+		if err := knowledgeBase.Sync(ctx, source); !errors.Is(err, document.ErrDocumentTooLarge) {
+			t.Fatalf("Sync() error = %v, want ErrDocumentTooLarge", err)
+		}
+		if source.reader.read > 5001 {
+			t.Errorf("read %d bytes, want reading to stop at the limit", source.reader.read)
+		}
+		// Chunks added before the limit was reached are removed
+		if len(store.deletes) != 2 || store.deletes[1]["source"] != "mem://large" {
+			t.Errorf("deletes = %v, want the chunks of mem://large deleted again", store.deletes)
+		}
+	})
+
+	t.Run("Truncates", func(t *testing.T) {
+		store := &fakeStore{}
+		knowledgeBase, err := New(fakeEmbedder{}, store, fixedSplitter{size: 100},
+			WithStreamWindowSize(1000),
+			WithMaxDocumentBytes(5000),
+			WithTruncateOversized(true),
+		)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		if err := knowledgeBase.Sync(ctx, &streamingSource{reader: &countingReader{size: 10000}}); err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		stored := 0
+		for _, doc := range store.docs {
+			stored += len(doc.PageContent)
+		}
+		if stored != 5000 {
+			t.Errorf("stored %d bytes, want 5000", stored)
+		}
+		if last := store.docs[len(store.docs)-1]; last.Metadata[document.TruncatedMetadataKey] != true {
+			t.Errorf("last chunk metadata = %v, want it flagged as truncated", last.Metadata)
+		}
+	})
+}
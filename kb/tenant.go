@@ -0,0 +1,286 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// ErrNoTenant is wrapped by the errors of a tenant view created with an empty
+// tenant ID or without WithTenantKey
+var ErrNoTenant = errors.New("tenant is required")
+
+// ForTenant returns a view of the knowledge base scoped to one tenant. Every
+// document the view indexes is tagged with the tenant under the TenantKey
+// metadata key, and every search, delete and Sync decision is limited to the
+// tenant's documents, overriding any filter on TenantKey the caller passes.
+//
+// Sources are stored qualified with the tenant, as "<tenant>/<source>" with
+// the tenant path-escaped, so two tenants can index the same source without
+// replacing each other's chunks. The view adds and strips the prefix, so its
+// callers only see their own source names.
+//
+// The view shares the store, embedder and splitter with kb and is safe for
+// concurrent use. It starts with a copy of kb's options; updating the options
+// of either afterwards doesn't affect the other. If id is empty or no
+// TenantKey is set, every operation of the view fails with ErrNoTenant.
+func (kb *KnowledgeBase) ForTenant(id string) *KnowledgeBase {
+	opts := *kb.opts
+	view := &KnowledgeBase{
+		embedder:  kb.currentEmbedder(),
+		store:     newTenantStore(kb.store, opts.TenantKey, id),
+		splitter:  kb.splitter,
+		tracer:    kb.tracer,
+		opts:      &opts,
+		tenant:    id,
+		syncs:     kb.syncs,
+		simhashes: kb.simhashes,
+	}
+	view.configure()
+	return view
+}
+
+// Tenant returns the tenant the knowledge base is scoped to, or "" if it isn't
+// a tenant view
+func (kb *KnowledgeBase) Tenant() string {
+	return kb.tenant
+}
+
+// tenantStore scopes a store to one tenant. It deliberately has no Unwrap
+// method, so optional interfaces are never reached around it.
+type tenantStore struct {
+	store  vectorstore.Store
+	key    string
+	tenant string
+	prefix string
+}
+
+func newTenantStore(store vectorstore.Store, key, tenant string) *tenantStore {
+	return &tenantStore{
+		store:  store,
+		key:    key,
+		tenant: tenant,
+		prefix: url.PathEscape(tenant) + "/",
+	}
+}
+
+// name is the metrics name of the scoped store
+func (s *tenantStore) name() string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", vectorstore.Unwrap(s.store)), "*")
+}
+
+// check refuses operations for a view without a tenant
+func (s *tenantStore) check(op string) error {
+	if s.tenant != "" && s.key != "" {
+		return nil
+	}
+	message := "tenant ID is empty"
+	if s.key == "" {
+		message = "no tenant key configured"
+	}
+	return &vectorstore.VectorStoreError{
+		Code:    vectorstore.ErrCodeInvalidFilter,
+		Op:      op,
+		Store:   "kb",
+		Message: message,
+		Err:     ErrNoTenant,
+	}
+}
+
+func (s *tenantStore) qualify(source string) string {
+	return s.prefix + source
+}
+
+// scopeMetadata returns a copy of metadata tagged with the tenant and with its
+// source qualified
+func (s *tenantStore) scopeMetadata(metadata map[string]interface{}) map[string]interface{} {
+	scoped := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		scoped[k] = v
+	}
+	if source, ok := scoped["source"]; ok {
+		scoped["source"] = s.qualify(fmt.Sprint(source))
+	}
+	scoped[s.key] = s.tenant
+	return scoped
+}
+
+// scopeFilter returns a copy of filter limited to the tenant
+func (s *tenantStore) scopeFilter(filter vectorstore.Filter) vectorstore.Filter {
+	return vectorstore.Filter(s.scopeMetadata(filter))
+}
+
+func (s *tenantStore) scopeDocuments(docs []vectorstore.Document) []vectorstore.Document {
+	scoped := make([]vectorstore.Document, len(docs))
+	for i, doc := range docs {
+		doc.Metadata = s.scopeMetadata(doc.Metadata)
+		scoped[i] = doc
+	}
+	return scoped
+}
+
+// unscope strips the tenant prefix from the sources of docs found by a search
+func (s *tenantStore) unscope(docs []vectorstore.Document) {
+	for i, doc := range docs {
+		source, ok := doc.Metadata["source"].(string)
+		if !ok || !strings.HasPrefix(source, s.prefix) {
+			continue
+		}
+		metadata := make(map[string]interface{}, len(doc.Metadata))
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		metadata["source"] = strings.TrimPrefix(source, s.prefix)
+		docs[i].Metadata = metadata
+	}
+}
+
+// Capabilities reports the optional interfaces of the scoped store that the
+// view forwards. The dimension is validated on the unscoped store, streamed
+// searches couldn't be scoped, and listing, migrating and named vector
+// columns would reach every tenant's documents, so the view has none of them.
+func (s *tenantStore) Capabilities() vectorstore.CapabilitySet {
+	caps := vectorstore.Capabilities(s.store)
+	caps.Dimension = false
+	caps.SearchStream = false
+	caps.ListDocuments = false
+	caps.Migrate = false
+	caps.VectorColumns = false
+	return caps
+}
+
+func (s *tenantStore) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := s.check("AddDocuments"); err != nil {
+		return err
+	}
+	return s.store.AddDocuments(ctx, s.scopeDocuments(docs), vectors)
+}
+
+func (s *tenantStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	if err := s.check("SimilaritySearch"); err != nil {
+		return nil, err
+	}
+	docs, err := s.store.SimilaritySearch(ctx, vector, limit, s.scopeFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+	s.unscope(docs)
+	return docs, nil
+}
+
+func (s *tenantStore) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	if err := s.check("Delete"); err != nil {
+		return err
+	}
+	return s.store.Delete(ctx, s.scopeFilter(filter))
+}
+
+// DeleteCount deletes the tenant's documents matching filter, returning -1
+// when the scoped store can't count them
+func (s *tenantStore) DeleteCount(ctx context.Context, filter vectorstore.Filter) (int, error) {
+	if err := s.check("DeleteCount"); err != nil {
+		return 0, err
+	}
+	if deleter, ok := vectorstore.Unwrap(s.store).(vectorstore.CountingDeleter); ok {
+		return deleter.DeleteCount(ctx, s.scopeFilter(filter))
+	}
+	if err := s.store.Delete(ctx, s.scopeFilter(filter)); err != nil {
+		return 0, err
+	}
+	return -1, nil
+}
+
+// InitDB initializes the shared store. Recreating it would drop every
+// tenant's documents, so a view refuses to.
+func (s *tenantStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	if err := s.check("InitDB"); err != nil {
+		return err
+	}
+	if forceRecreate {
+		return &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "InitDB",
+			Store:   "kb",
+			Message: "a tenant view can't recreate the shared store",
+		}
+	}
+	return s.store.InitDB(ctx, false)
+}
+
+func (s *tenantStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	if err := s.check("DocumentExists"); err != nil {
+		return nil, err
+	}
+	scoped := make([]document.Document, len(docs))
+	for i, doc := range docs {
+		doc.Metadata = s.scopeMetadata(doc.Metadata)
+		scoped[i] = doc
+	}
+	return s.store.DocumentExists(ctx, scoped)
+}
+
+// ReplaceSource replaces the tenant's chunks of source. Sources are qualified
+// with the tenant, so this stays atomic when the scoped store is a
+// vectorstore.SourceReplacer.
+func (s *tenantStore) ReplaceSource(ctx context.Context, source string, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := s.check("ReplaceSource"); err != nil {
+		return err
+	}
+	return vectorstore.ReplaceSource(ctx, s.store, s.qualify(source), s.scopeDocuments(docs), vectors)
+}
+
+// ListSources returns the tenant's sources, without the tenant prefix. Sources
+// are matched on the prefix alone, since stores list sources without metadata.
+func (s *tenantStore) ListSources(ctx context.Context) ([]string, error) {
+	if err := s.check("ListSources"); err != nil {
+		return nil, err
+	}
+	lister, ok := vectorstore.Unwrap(s.store).(vectorstore.SourceLister)
+	if !ok {
+		return nil, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "ListSources",
+			Store:   "kb",
+			Message: "store does not support listing sources",
+		}
+	}
+
+	all, err := lister.ListSources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	for _, source := range all {
+		if strings.HasPrefix(source, s.prefix) {
+			sources = append(sources, strings.TrimPrefix(source, s.prefix))
+		}
+	}
+	return sources, nil
+}
+
+// GetDocuments returns the tenant's documents matching filter
+func (s *tenantStore) GetDocuments(ctx context.Context, filter vectorstore.Filter, limit int) ([]vectorstore.Document, error) {
+	if err := s.check("GetDocuments"); err != nil {
+		return nil, err
+	}
+	getter, ok := vectorstore.Unwrap(s.store).(vectorstore.DocumentGetter)
+	if !ok {
+		return nil, &vectorstore.VectorStoreError{
+			Code:    vectorstore.ErrCodeNotSupported,
+			Op:      "GetDocuments",
+			Store:   "kb",
+			Message: "store does not support getting documents",
+		}
+	}
+	docs, err := getter.GetDocuments(ctx, s.scopeFilter(filter), limit)
+	if err != nil {
+		return nil, err
+	}
+	s.unscope(docs)
+	return docs, nil
+}
@@ -0,0 +1,173 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+func newTenantKB(t *testing.T) (*KnowledgeBase, *mocks.Store) {
+	t.Helper()
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10}, WithTenantKey("tenant_id"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return knowledgeBase, store
+}
+
+func TestKnowledgeBase_ForTenantIsolatesSearches(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, store := newTenantKB(t)
+	acme, globex := knowledgeBase.ForTenant("acme"), knowledgeBase.ForTenant("globex")
+
+	if err := acme.AddText(ctx, "plans.txt", "acme launch plans", nil); err != nil {
+		t.Fatalf("AddText() error = %v", err)
+	}
+	for _, doc := range store.Documents() {
+		if doc.Metadata["tenant_id"] != "acme" {
+			t.Errorf("stored chunk metadata = %v, want tenant_id acme", doc.Metadata)
+		}
+	}
+
+	results, err := acme.SimilaritySearch(ctx, "launch plans", 10, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(results) == 0 || results[0].Metadata["source"] != "plans.txt" {
+		t.Errorf("own SimilaritySearch() = %v, want chunks of plans.txt", results)
+	}
+
+	filters := []vectorstore.Filter{
+		nil,
+		{"tenant_id": "acme"},
+		{"source": "plans.txt"},
+		{"source": "acme/plans.txt", "tenant_id": "acme"},
+	}
+	for _, filter := range filters {
+		results, err := globex.SimilaritySearch(ctx, "launch plans", 10, filter)
+		if err != nil {
+			t.Fatalf("SimilaritySearch(%v) error = %v", filter, err)
+		}
+		if len(results) != 0 {
+			t.Errorf("other tenant's SimilaritySearch(%v) = %v, want nothing", filter, results)
+		}
+	}
+
+	if removed, err := globex.DeleteByMetadata(ctx, vectorstore.Filter{"tenant_id": "acme"}); err != nil || removed != 0 {
+		t.Errorf("other tenant's DeleteByMetadata() = %d, %v, want 0", removed, err)
+	}
+	if err := globex.DeleteSource(ctx, "plans.txt"); err != nil {
+		t.Fatalf("DeleteSource() error = %v", err)
+	}
+	if len(store.Documents()) == 0 {
+		t.Error("other tenant deleted acme's chunks")
+	}
+}
+
+func TestKnowledgeBase_ForTenantKeepsSameSourceApart(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, _ := newTenantKB(t)
+	acme, globex := knowledgeBase.ForTenant("acme"), knowledgeBase.ForTenant("globex")
+
+	source := mocks.NewDataSource(syncDocs()...)
+	if err := acme.Sync(ctx, source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	// The same documents are new to another tenant, and indexing them must
+	// not replace the first tenant's chunks
+	if err := globex.Sync(ctx, source); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, view := range []*KnowledgeBase{acme, globex} {
+		results, err := view.SimilaritySearch(ctx, "goroutines", 100, vectorstore.Filter{"source": "a.txt"})
+		if err != nil {
+			t.Fatalf("SimilaritySearch() error = %v", err)
+		}
+		if len(results) == 0 {
+			t.Errorf("tenant %s lost its chunks of a.txt", view.Tenant())
+		}
+		for _, doc := range results {
+			if doc.Metadata["tenant_id"] != view.Tenant() {
+				t.Errorf("tenant %s found %v", view.Tenant(), doc.Metadata)
+			}
+		}
+	}
+}
+
+func TestKnowledgeBase_ForTenantRefusesEmptyTenant(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, store := newTenantKB(t)
+	unkeyed, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for name, view := range map[string]*KnowledgeBase{
+		"empty tenant":  knowledgeBase.ForTenant(""),
+		"no tenant key": unkeyed.ForTenant("acme"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := view.AddText(ctx, "plans.txt", "launch plans", nil); !errors.Is(err, ErrNoTenant) {
+				t.Errorf("AddText() error = %v, want ErrNoTenant", err)
+			}
+			if _, err := view.SimilaritySearch(ctx, "plans", 10, nil); !errors.Is(err, ErrNoTenant) {
+				t.Errorf("SimilaritySearch() error = %v, want ErrNoTenant", err)
+			}
+			if err := view.DeleteSource(ctx, "plans.txt"); !errors.Is(err, ErrNoTenant) {
+				t.Errorf("DeleteSource() error = %v, want ErrNoTenant", err)
+			}
+			if err := view.Sync(ctx, mocks.NewDataSource(syncDocs()...)); !errors.Is(err, ErrNoTenant) {
+				t.Errorf("Sync() error = %v, want ErrNoTenant", err)
+			}
+		})
+	}
+	if len(store.Documents()) != 0 {
+		t.Errorf("views without a tenant stored %d chunks", len(store.Documents()))
+	}
+}
+
+func TestKnowledgeBase_ForTenantConcurrent(t *testing.T) {
+	ctx := context.Background()
+	knowledgeBase, _ := newTenantKB(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view := knowledgeBase.ForTenant(tenant)
+			if err := view.AddText(ctx, "notes.txt", "notes of "+tenant, nil); err != nil {
+				t.Errorf("AddText() error = %v", err)
+				return
+			}
+			results, err := view.SimilaritySearch(ctx, "notes", 100, nil)
+			if err != nil {
+				t.Errorf("SimilaritySearch() error = %v", err)
+				return
+			}
+			for _, doc := range results {
+				if doc.Metadata["tenant_id"] != tenant {
+					t.Errorf("tenant %s found %v", tenant, doc.Metadata)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestKnowledgeBase_ForTenantCapabilities(t *testing.T) {
+	knowledgeBase, _ := newTenantKB(t)
+	view := knowledgeBase.ForTenant("acme")
+	want := vectorstore.CapabilitySet{ReplaceSource: true, DeleteCount: true, GetDocuments: true, Conditions: true}
+	if got := vectorstore.Capabilities(view.store); got != want {
+		t.Errorf("Capabilities() = %+v, want %+v", got, want)
+	}
+}
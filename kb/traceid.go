@@ -0,0 +1,48 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// TraceIDMetadataKey is the metadata key indexed chunks carry the trace ID under
+const TraceIDMetadataKey = "trace_id"
+
+// TraceError wraps an error returned by a call whose context carried a trace ID.
+// The wrapped error is still reachable with errors.Is and errors.As.
+type TraceError struct {
+	TraceID string
+	Err     error
+}
+
+func (e *TraceError) Error() string {
+	return fmt.Sprintf("trace_id=%s: %v", e.TraceID, e.Err)
+}
+
+func (e *TraceError) Unwrap() error {
+	return e.Err
+}
+
+// traceID returns the trace ID in ctx under the configured TraceIDKey
+func (kb *KnowledgeBase) traceID(ctx context.Context) string {
+	return logging.TraceID(ctx, kb.opts.TraceIDKey)
+}
+
+// withTraceID wraps err in a TraceError if ctx carries a trace ID
+func (kb *KnowledgeBase) withTraceID(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	id := kb.traceID(ctx)
+	if id == "" {
+		return err
+	}
+	var traceErr *TraceError
+	if errors.As(err, &traceErr) {
+		return err
+	}
+	return &TraceError{TraceID: id, Err: err}
+}
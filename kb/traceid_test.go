@@ -0,0 +1,92 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+type traceKey struct{}
+
+func newTraceKB(t *testing.T, buf *bytes.Buffer) (*KnowledgeBase, *mocks.Store) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	store := mocks.NewStore()
+	knowledgeBase, err := New(mocks.NewEmbedder(8), store, fixedSplitter{size: 10},
+		WithLogger(logger),
+		WithTraceIDKey(traceKey{}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return knowledgeBase, store
+}
+
+func TestKnowledgeBase_TraceIDInLogsAndDocuments(t *testing.T) {
+	var buf bytes.Buffer
+	knowledgeBase, store := newTraceKB(t, &buf)
+	ctx := context.WithValue(context.Background(), traceKey{}, "req-42")
+
+	if err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()...)); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if _, err := knowledgeBase.SimilaritySearch(ctx, "goroutines", 1, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, "trace_id=req-42") {
+			t.Errorf("log line %q has no trace ID", line)
+		}
+	}
+	if !strings.Contains(buf.String(), `msg="similarity search"`) {
+		t.Errorf("log output %q has no vector store search log", buf.String())
+	}
+
+	docs := store.Documents()
+	if len(docs) == 0 {
+		t.Fatal("Sync() stored no chunks")
+	}
+	for _, doc := range docs {
+		if doc.Metadata[TraceIDMetadataKey] != "req-42" {
+			t.Errorf("chunk metadata = %v, want trace_id=req-42", doc.Metadata)
+		}
+	}
+}
+
+func TestKnowledgeBase_TraceIDInErrors(t *testing.T) {
+	errInjected := errors.New("injected")
+	var buf bytes.Buffer
+	knowledgeBase, store := newTraceKB(t, &buf)
+	store.FailWith("ReplaceSource", errInjected)
+	ctx := context.WithValue(context.Background(), traceKey{}, "req-42")
+
+	err := knowledgeBase.Sync(ctx, mocks.NewDataSource(syncDocs()...))
+	var traceErr *TraceError
+	if !errors.As(err, &traceErr) {
+		t.Fatalf("Sync() error = %v, want *TraceError", err)
+	}
+	if traceErr.TraceID != "req-42" {
+		t.Errorf("TraceID = %q, want req-42", traceErr.TraceID)
+	}
+	if !errors.Is(err, errInjected) {
+		t.Errorf("Sync() error = %v, want it to wrap %v", err, errInjected)
+	}
+	if !strings.Contains(err.Error(), "trace_id=req-42") {
+		t.Errorf("Error() = %q, want the trace ID", err.Error())
+	}
+	if want := `msg="sync document failed"`; !strings.Contains(buf.String(), want) || !strings.Contains(buf.String(), "trace_id=req-42") {
+		t.Errorf("log output %q does not contain a traced %s record", buf.String(), want)
+	}
+
+	// Without a trace ID in the context errors are returned unchanged
+	err = knowledgeBase.Sync(context.Background(), mocks.NewDataSource(syncDocs()...))
+	if errors.As(err, &traceErr) {
+		t.Errorf("Sync() error = %v, want no TraceError without a trace ID", err)
+	}
+}
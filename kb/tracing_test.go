@@ -0,0 +1,65 @@
+package kb
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestKnowledgeBase_Tracing(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	objects := inmemory.NewInMemoryDataStore()
+	if err := objects.Put(ctx, "docs/a.txt", strings.NewReader("alpha")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	knowledgeBase, err := New(fakeEmbedder{}, &fakeStore{}, fixedSplitter{size: 100}, WithTracerProvider(tp))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := knowledgeBase.Sync(ctx, datasource.NewDataStoreSource(objects, "docs/")); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if _, err := knowledgeBase.SimilaritySearch(ctx, "alpha", 5, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	wantParents := map[string]string{
+		"embedding.EmbedDocuments":     "kb.Sync",
+		"vectorstore.AddDocuments":     "kb.Sync",
+		"embedding.EmbedQuery":         "kb.SimilaritySearch",
+		"vectorstore.SimilaritySearch": "kb.SimilaritySearch",
+	}
+	for child, parent := range wantParents {
+		childSpan, ok := byName[child]
+		if !ok {
+			t.Errorf("missing span %s", child)
+			continue
+		}
+		if childSpan.Parent.SpanID() != byName[parent].SpanContext.SpanID() {
+			t.Errorf("span %s is not a child of %s", child, parent)
+		}
+	}
+
+	attrs := make(map[string]int64)
+	for _, attr := range byName["vectorstore.SimilaritySearch"].Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInt64()
+	}
+	if attrs["vectorstore.limit"] != 5 {
+		t.Errorf("vectorstore.limit = %d, want 5", attrs["vectorstore.limit"])
+	}
+}
@@ -0,0 +1,68 @@
+package llm
+
+import "github.com/Abraxas-365/kbservice/document"
+
+// MessageTokenOverhead is the number of tokens TrimToTokenBudget counts for
+// each message's role and formatting, on top of its text
+const MessageTokenOverhead = 4
+
+// TrimToTokenBudget returns the leading system messages and the longest run
+// of the latest messages that fit in budget tokens counted by tokenizer,
+// dropping the oldest turns first. A tool or function result is never kept
+// without the call it answers. System messages are always kept, even when
+// they alone exceed the budget. A nil tokenizer estimates four characters per
+// token; pass the model's own, such as a document.HFTokenizer, for models
+// that don't tokenize like OpenAI's.
+func TrimToTokenBudget(messages []Message, budget int, tokenizer document.Tokenizer) []Message {
+	if tokenizer == nil {
+		tokenizer = document.TokenizerFunc(func(text string) int {
+			return (len(text) + 3) / 4
+		})
+	}
+
+	system := 0
+	used := 0
+	for system < len(messages) && messages[system].Role == SystemRole {
+		used += messageTokens(messages[system], tokenizer)
+		system++
+	}
+
+	start := len(messages)
+	for start > system {
+		cost := messageTokens(messages[start-1], tokenizer)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	// Results whose call was dropped would be rejected by the provider
+	for start < len(messages) && isResult(messages[start]) {
+		start++
+	}
+
+	trimmed := make([]Message, 0, system+len(messages)-start)
+	trimmed = append(trimmed, messages[:system]...)
+	return append(trimmed, messages[start:]...)
+}
+
+// messageTokens counts the tokens of a message's text and calls
+func messageTokens(m Message, tokenizer document.Tokenizer) int {
+	tokens := MessageTokenOverhead + tokenizer.CountTokens(m.Content)
+	if m.Name != "" {
+		tokens += tokenizer.CountTokens(m.Name)
+	}
+	if m.FuncCall != nil {
+		tokens += tokenizer.CountTokens(m.FuncCall.Name) + tokenizer.CountTokens(m.FuncCall.Arguments)
+	}
+	for _, call := range m.ToolCalls {
+		tokens += tokenizer.CountTokens(call.Function.Name) + tokenizer.CountTokens(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// isResult reports whether m answers a tool or function call
+func isResult(m Message) bool {
+	return m.Role == FunctionRole || m.ToolCallID != ""
+}
@@ -0,0 +1,56 @@
+package llm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+)
+
+func TestTrimToTokenBudget(t *testing.T) {
+	// Every word is a token, so each message below costs 4 + 2 tokens
+	words := document.TokenizerFunc(func(text string) int {
+		return len(strings.Fields(text))
+	})
+	system := Message{Role: SystemRole, Content: "be brief"}
+	call := Message{Role: AssistantRole, ToolCalls: []ToolCall{{ID: "call_1", Function: FunctionCall{Name: "lookup", Arguments: "x"}}}}
+	result := Message{Role: "tool", Content: "found it", ToolCallID: "call_1"}
+	messages := []Message{
+		system,
+		{Role: UserRole, Content: "first question"},
+		{Role: AssistantRole, Content: "first answer"},
+		call,
+		result,
+		{Role: UserRole, Content: "last question"},
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		want   []Message
+	}{
+		{name: "Everything fits", budget: 100, want: messages},
+		{name: "Oldest turns go first", budget: 6 * 5, want: []Message{system, messages[2], call, result, messages[5]}},
+		{name: "Results don't outlive their call", budget: 6 * 3, want: []Message{system, messages[5]}},
+		{name: "System messages are kept", budget: 1, want: []Message{system}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimToTokenBudget(messages, tt.budget, words); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TrimToTokenBudget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimToTokenBudget_EstimatesWithoutTokenizer(t *testing.T) {
+	messages := []Message{
+		{Role: UserRole, Content: strings.Repeat("a", 400)},
+		{Role: UserRole, Content: strings.Repeat("b", 40)},
+	}
+	got := TrimToTokenBudget(messages, 50, nil)
+	if len(got) != 1 || got[0].Content != messages[1].Content {
+		t.Errorf("TrimToTokenBudget() = %d messages, want only the last", len(got))
+	}
+}
@@ -1,6 +1,9 @@
 package llm
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // LLMError represents errors that can occur during LLM operations
 type LLMError struct {
@@ -30,3 +33,7 @@ const (
 	ErrAPIError           = "APIError"
 	ErrInternal           = "Internal"
 )
+
+// ErrStreamIdleTimeout is wrapped by the LLMError a stream ends with when the
+// provider sends nothing for longer than the adapter's idle timeout
+var ErrStreamIdleTimeout = errors.New("stream idle timeout")
@@ -6,9 +6,67 @@ type FunctionCall struct {
 	Arguments string `json:"arguments"`
 }
 
+// FunctionCallDelta is a fragment of a tool call streamed by ChatStream. The
+// first fragment of a call carries its ID and name and later ones only pieces
+// of its arguments. Index tells apart the calls of a response.
+type FunctionCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
 // Function represents a function that can be called by the LLM
 type Function struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Parameters  any    `json:"parameters"` // JSON Schema object
 }
+
+// FunctionMessageStrategy controls how function results are represented for
+// providers without a native function or tool role
+type FunctionMessageStrategy int
+
+const (
+	// InlineAsUser sends function results as user messages labeled with the function name
+	InlineAsUser FunctionMessageStrategy = iota
+	// InlineAsAssistantWithLabel sends function results as labeled assistant messages
+	InlineAsAssistantWithLabel
+	// DropFunctionMessages removes function results from the conversation
+	DropFunctionMessages
+)
+
+// ConvertFunctionMessages rewrites function messages according to strategy.
+// Other messages are returned unchanged.
+func ConvertFunctionMessages(messages []Message, strategy FunctionMessageStrategy) []Message {
+	converted := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		if message.Role != RoleFunction {
+			converted = append(converted, message)
+			continue
+		}
+
+		switch strategy {
+		case DropFunctionMessages:
+			continue
+		case InlineAsAssistantWithLabel:
+			converted = append(converted, Message{
+				Role:    RoleAssistant,
+				Content: "[" + functionLabel(message) + "]\n" + message.Content,
+			})
+		default:
+			converted = append(converted, Message{
+				Role:    RoleUser,
+				Content: functionLabel(message) + ":\n" + message.Content,
+			})
+		}
+	}
+	return converted
+}
+
+func functionLabel(message Message) string {
+	if message.Name == "" {
+		return "Function result"
+	}
+	return "Result of function " + message.Name
+}
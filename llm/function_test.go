@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertFunctionMessages(t *testing.T) {
+	messages := []Message{
+		{Role: RoleUser, Content: "What's the weather in Lima?"},
+		{Role: RoleAssistant, FuncCall: &FunctionCall{Name: "get_weather", Arguments: `{"city":"Lima"}`}},
+		{Role: RoleFunction, Name: "get_weather", Content: `{"temp":22}`},
+	}
+
+	tests := []struct {
+		name     string
+		strategy FunctionMessageStrategy
+		want     Message
+		wantLen  int
+	}{
+		{
+			name:     "Inline as user",
+			strategy: InlineAsUser,
+			want:     Message{Role: RoleUser, Content: "Result of function get_weather:\n{\"temp\":22}"},
+			wantLen:  3,
+		},
+		{
+			name:     "Inline as assistant with label",
+			strategy: InlineAsAssistantWithLabel,
+			want:     Message{Role: RoleAssistant, Content: "[Result of function get_weather]\n{\"temp\":22}"},
+			wantLen:  3,
+		},
+		{
+			name:     "Drop function messages",
+			strategy: DropFunctionMessages,
+			wantLen:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertFunctionMessages(messages, tt.strategy)
+			if len(got) != tt.wantLen {
+				t.Fatalf("ConvertFunctionMessages() returned %d messages, want %d", len(got), tt.wantLen)
+			}
+			if !reflect.DeepEqual(got[:2], messages[:2]) {
+				t.Errorf("ConvertFunctionMessages() changed non-function messages: %+v", got[:2])
+			}
+			if tt.wantLen == 3 && !reflect.DeepEqual(got[2], tt.want) {
+				t.Errorf("ConvertFunctionMessages() function message = %+v, want %+v", got[2], tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,18 @@ type StreamResponse struct {
 	Message Message
 	Error   error
 	Done    bool
+
+	// ToolCallDelta is set on responses streaming a fragment of a tool call,
+	// for adapters that support it
+	ToolCallDelta *FunctionCallDelta
+	// ToolCalls are the complete tool calls of the response, set on the Done
+	// response along with Message.ToolCalls
+	ToolCalls []FunctionCall
+	// ToolMessage is set by RunToolsStream on responses reporting a message
+	// of a tool round: the assistant message calling tools, then a RoleTool
+	// message per result. Message is left empty, so the round isn't taken as
+	// part of the answer.
+	ToolMessage *Message
 }
 
 const (
@@ -28,4 +40,5 @@ const (
 	RoleUser      = "user"
 	RoleAssistant = "assistant"
 	RoleFunction  = "function"
+	RoleTool      = "tool"
 )
@@ -0,0 +1,140 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// LoggingOptions contains configuration for LoggingLLM
+type LoggingOptions struct {
+	Logger   *slog.Logger
+	Redactor logging.Redactor // Rewrites message content before it is logged
+}
+
+// LoggingOption is a function type to modify LoggingOptions
+type LoggingOption func(*LoggingOptions)
+
+// WithLogger sets the logger calls are logged to. A nil logger discards the records.
+func WithLogger(logger *slog.Logger) LoggingOption {
+	return func(o *LoggingOptions) {
+		if logger == nil {
+			logger = logging.Discard()
+		}
+		o.Logger = logger
+	}
+}
+
+// WithRedactor sets how message content is rewritten before it is logged
+func WithRedactor(redactor logging.Redactor) LoggingOption {
+	return func(o *LoggingOptions) {
+		o.Redactor = redactor
+	}
+}
+
+// LoggingLLM wraps an LLM, logging every call at debug level and failures at error level
+type LoggingLLM struct {
+	llm  LLM
+	opts *LoggingOptions
+}
+
+// NewLoggingLLM creates a LoggingLLM. Without WithLogger nothing is logged.
+func NewLoggingLLM(llm LLM, opts ...LoggingOption) *LoggingLLM {
+	options := &LoggingOptions{
+		Logger: logging.Discard(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &LoggingLLM{
+		llm:  llm,
+		opts: options,
+	}
+}
+
+func (l *LoggingLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	start := time.Now()
+	message, err := l.llm.Chat(ctx, messages, opts...)
+	if err != nil {
+		l.logError(ctx, "Chat", err)
+		return nil, err
+	}
+
+	attrs := []any{
+		"messages", len(messages),
+		"last_message", l.lastContent(messages),
+		"response", logging.Redact(l.opts.Redactor, message.Content),
+		"tool_calls", len(message.ToolCalls),
+		"duration", time.Since(start),
+	}
+	if usage := message.GetUsage(); usage != nil {
+		attrs = append(attrs, "prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
+	}
+	l.opts.Logger.DebugContext(ctx, "llm chat", attrs...)
+
+	return message, nil
+}
+
+func (l *LoggingLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	stream, err := l.llm.ChatStream(ctx, messages, opts...)
+	if err != nil {
+		l.logError(ctx, "ChatStream", err)
+		return nil, err
+	}
+
+	l.opts.Logger.DebugContext(ctx, "llm chat stream",
+		"messages", len(messages),
+		"last_message", l.lastContent(messages),
+	)
+
+	writer, out := NewRelayStreamWriter(ctx, opts...)
+	go func() {
+		defer writer.Close()
+		for resp := range stream {
+			if resp.Error != nil {
+				l.logError(ctx, "ChatStream", resp.Error)
+			}
+			if !writer.Send(resp) {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (l *LoggingLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	start := time.Now()
+	completion, err := l.llm.Complete(ctx, prompt, opts...)
+	if err != nil {
+		l.logError(ctx, "Complete", err)
+		return "", err
+	}
+
+	l.opts.Logger.DebugContext(ctx, "llm complete",
+		"prompt", logging.Redact(l.opts.Redactor, prompt),
+		"response", logging.Redact(l.opts.Redactor, completion),
+		"duration", time.Since(start),
+	)
+	return completion, nil
+}
+
+func (l *LoggingLLM) lastContent(messages []Message) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	return logging.Redact(l.opts.Redactor, messages[len(messages)-1].Content)
+}
+
+func (l *LoggingLLM) logError(ctx context.Context, op string, err error) {
+	attrs := []any{"operation", op, "error", err}
+	var llmErr *LLMError
+	if errors.As(err, &llmErr) {
+		attrs = append(attrs, "reason", llmErr.Message)
+	}
+	l.opts.Logger.ErrorContext(ctx, "llm call failed", attrs...)
+}
@@ -0,0 +1,65 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+func TestLoggingLLM_Chat(t *testing.T) {
+	tests := []struct {
+		name     string
+		llm      stubLLM
+		redactor logging.Redactor
+		want     []string
+		wantNot  []string
+	}{
+		{
+			name: "Content is logged by default",
+			llm:  stubLLM{},
+			want: []string{"level=DEBUG", "msg=\"llm chat\"", "last_message=secret", "prompt_tokens=10"},
+		},
+		{
+			name:     "Redactor strips content",
+			llm:      stubLLM{},
+			redactor: logging.RedactContent,
+			want:     []string{"last_message=\"[redacted 6 bytes]\""},
+			wantNot:  []string{"secret"},
+		},
+		{
+			name: "Failures are logged with the error message",
+			llm:  stubLLM{err: &LLMError{Op: "Chat", Message: "rate limited"}},
+			want: []string{"level=ERROR", "operation=Chat", "reason=\"rate limited\""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			l := NewLoggingLLM(tt.llm, WithLogger(logger), WithRedactor(tt.redactor))
+
+			_, err := l.Chat(context.Background(), []Message{{Role: RoleUser, Content: "secret"}})
+			if tt.llm.err != nil && !errors.Is(err, tt.llm.err) {
+				t.Errorf("Chat() error = %v, want %v", err, tt.llm.err)
+			}
+
+			output := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("log output %q does not contain %q", output, want)
+				}
+			}
+			for _, wantNot := range tt.wantNot {
+				if strings.Contains(output, wantNot) {
+					t.Errorf("log output %q contains %q", output, wantNot)
+				}
+			}
+		})
+	}
+}
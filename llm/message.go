@@ -1,6 +1,9 @@
 package llm
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 const (
 	// SystemRole represents a system message
@@ -20,6 +23,20 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// StopReason is why a model stopped generating, normalized across providers
+type StopReason string
+
+const (
+	// StopReasonStop means the model finished its turn or hit a stop sequence
+	StopReasonStop StopReason = "stop"
+	// StopReasonLength means the response was cut off by the token limit
+	StopReasonLength StopReason = "length"
+	// StopReasonToolCalls means the model stopped to call a tool or function
+	StopReasonToolCalls StopReason = "tool_calls"
+	// StopReasonContentFilter means the response was withheld by a content filter
+	StopReasonContentFilter StopReason = "content_filter"
+)
+
 // Message represents a chat message
 
 type Message struct {
@@ -29,7 +46,11 @@ type Message struct {
 	FuncCall   *FunctionCall          `json:"function_call,omitempty"`
 	ToolCalls  []ToolCall             `json:"tool_calls,omitempty"`
 	ToolCallID string                 `json:"tool_call_id,omitempty"` // Add this field
+	StopReason StopReason             `json:"stop_reason,omitempty"`  // Set on responses; empty if the provider didn't report one
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	// CreatedAt is when the message was added to a conversation, stamped by
+	// chathistory.Memory when zero. Zero for messages never stored.
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type ToolCall struct {
@@ -45,24 +66,30 @@ func (m *Message) GetUsage() *Usage {
 	}
 
 	if usageMap, ok := m.Metadata["usage"].(map[string]interface{}); ok {
-		usage := &Usage{}
-
-		if promptTokens, ok := usageMap["prompt_tokens"].(int); ok {
-			usage.PromptTokens = promptTokens
+		return &Usage{
+			PromptTokens:     usageInt(usageMap["prompt_tokens"]),
+			CompletionTokens: usageInt(usageMap["completion_tokens"]),
+			TotalTokens:      usageInt(usageMap["total_tokens"]),
 		}
-		if completionTokens, ok := usageMap["completion_tokens"].(int); ok {
-			usage.CompletionTokens = completionTokens
-		}
-		if totalTokens, ok := usageMap["total_tokens"].(int); ok {
-			usage.TotalTokens = totalTokens
-		}
-
-		return usage
 	}
 
 	return nil
 }
 
+// usageInt reads a token count set by SetUsage, or decoded from JSON as float64
+// when the message was loaded from storage
+func usageInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
 // SetUsage sets the usage statistics in the message metadata
 func (m *Message) SetUsage(usage *Usage) {
 	if usage == nil {
@@ -80,6 +107,41 @@ func (m *Message) SetUsage(usage *Usage) {
 	}
 }
 
+// FinishReason returns the finish reason the provider reported, as the provider
+// names it, or "" if it reported none. StopReason holds the normalized reason.
+func (m *Message) FinishReason() string {
+	reason, _ := m.Metadata["finish_reason"].(string)
+	return reason
+}
+
+// SetFinishReason sets the finish reason in the message metadata
+func (m *Message) SetFinishReason(reason string) {
+	m.setMetadata("finish_reason", reason)
+}
+
+// Model returns the model that served the request, which may differ from the
+// requested one when the provider resolves aliases, or "" if unknown
+func (m *Message) Model() string {
+	model, _ := m.Metadata["model"].(string)
+	return model
+}
+
+// SetModel sets the model in the message metadata
+func (m *Message) SetModel(model string) {
+	m.setMetadata("model", model)
+}
+
+// setMetadata sets a metadata value, leaving the metadata untouched for empty values
+func (m *Message) setMetadata(key, value string) {
+	if value == "" {
+		return
+	}
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]interface{})
+	}
+	m.Metadata[key] = value
+}
+
 func MessagesToString(messages []Message) string {
 	var sb strings.Builder
 	for _, message := range messages {
@@ -93,3 +155,63 @@ func MessagesToString(messages []Message) string {
 	}
 	return sb.String()
 }
+
+// NormalizeAlternation returns a copy of messages that strictly alternates between
+// user and assistant turns, for providers that reject consecutive messages with the
+// same role. Leading system messages are kept, consecutive messages with the same
+// role are merged, and an empty turn is inserted where two same-role messages can't
+// be merged because they carry function or tool calls. A conversation that starts
+// with an assistant message gets an empty user turn in front.
+func NormalizeAlternation(messages []Message) []Message {
+	normalized := make([]Message, 0, len(messages))
+
+	for _, message := range messages {
+		if len(normalized) == 0 {
+			if message.Role == AssistantRole {
+				normalized = append(normalized, Message{Role: UserRole})
+			}
+			normalized = append(normalized, message)
+			continue
+		}
+
+		last := &normalized[len(normalized)-1]
+		if last.Role != message.Role {
+			if last.Role == SystemRole && message.Role == AssistantRole {
+				normalized = append(normalized, Message{Role: UserRole})
+			}
+			normalized = append(normalized, message)
+			continue
+		}
+
+		if mergeable(*last) && mergeable(message) {
+			last.Content = joinContent(last.Content, message.Content)
+			continue
+		}
+
+		switch message.Role {
+		case UserRole:
+			normalized = append(normalized, Message{Role: AssistantRole})
+		case AssistantRole:
+			normalized = append(normalized, Message{Role: UserRole})
+		}
+		normalized = append(normalized, message)
+	}
+
+	return normalized
+}
+
+// mergeable reports whether a message carries only text content
+func mergeable(message Message) bool {
+	return message.FuncCall == nil && len(message.ToolCalls) == 0 && message.ToolCallID == "" && message.Name == ""
+}
+
+func joinContent(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "\n\n" + b
+	}
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// MessageSchemaVersion is the version written in the "version" field of every
+// encoded Message.
+//
+// The JSON encoding of Message is stable: fields are only ever added, never
+// renamed or removed, and a field's meaning doesn't change between versions.
+// UnmarshalJSON decodes every earlier shape, so stored messages stay readable,
+// and ignores fields it doesn't know, so messages written by a newer version
+// decode with the fields this version supports. Adapters should persist
+// messages through json.Marshal and json.Unmarshal rather than their own
+// encoding to keep these guarantees.
+//
+// Versions:
+//
+//	0: no version field. "content" is a string, null, or an array of content
+//	   parts of which the "text" parts are kept; a list of calls may be stored
+//	   as "function_calls".
+//	1: adds "version". "content" is always a string.
+//	2: adds "created_at", omitted when the message has no CreatedAt.
+const MessageSchemaVersion = 2
+
+// messageFields has Message's fields without its methods, to avoid recursing
+// into MarshalJSON and UnmarshalJSON
+type messageFields Message
+
+// MarshalJSON encodes m at MessageSchemaVersion
+func (m Message) MarshalJSON() ([]byte, error) {
+	var createdAt *time.Time
+	if !m.CreatedAt.IsZero() {
+		createdAt = &m.CreatedAt
+	}
+	return json.Marshal(struct {
+		Version int `json:"version"`
+		messageFields
+		// Shadow CreatedAt so it's omitted when unset
+		CreatedAt *time.Time `json:"created_at,omitempty"`
+	}{
+		Version:       MessageSchemaVersion,
+		messageFields: messageFields(m),
+		CreatedAt:     createdAt,
+	})
+}
+
+// UnmarshalJSON decodes a message of any schema version
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var wire struct {
+		Version int `json:"version"`
+		// Shadow the fields whose shape changed between versions
+		Content   json.RawMessage `json:"content"`
+		FuncCalls []FunctionCall  `json:"function_calls"`
+		messageFields
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	content, err := decodeContent(wire.Content)
+	if err != nil {
+		return fmt.Errorf("llm: decoding message content: %w", err)
+	}
+
+	*m = Message(wire.messageFields)
+	m.Content = content
+
+	switch {
+	case len(wire.FuncCalls) == 0:
+	case len(wire.FuncCalls) == 1 && m.FuncCall == nil:
+		m.FuncCall = &wire.FuncCalls[0]
+	case len(m.ToolCalls) == 0:
+		// Several calls are only representable as tool calls
+		for _, call := range wire.FuncCalls {
+			m.ToolCalls = append(m.ToolCalls, ToolCall{Type: string(ToolTypeFunction), Function: call})
+		}
+	}
+	return nil
+}
+
+// contentPart is an entry of a content array, as stored before version 1
+type contentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// decodeContent reads content stored as a string, null or an array of parts.
+// Text parts are joined; other parts, such as images, are dropped.
+func decodeContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	var content string
+	if err := json.Unmarshal(raw, &content); err == nil {
+		return content, nil
+	}
+
+	var parts []contentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("content is neither a string nor an array of parts")
+	}
+	for _, part := range parts {
+		if part.Type == "text" || part.Type == "" {
+			content = joinContent(content, part.Text)
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,220 @@
+package llm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAlternation(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		want     []Message
+	}{
+		{
+			name: "Consecutive user messages are merged",
+			messages: []Message{
+				{Role: UserRole, Content: "Hello"},
+				{Role: UserRole, Content: "Are you there?"},
+				{Role: AssistantRole, Content: "Yes"},
+			},
+			want: []Message{
+				{Role: UserRole, Content: "Hello\n\nAre you there?"},
+				{Role: AssistantRole, Content: "Yes"},
+			},
+		},
+		{
+			name: "System prompt is kept and assistant opening gets a user turn",
+			messages: []Message{
+				{Role: SystemRole, Content: "Be brief"},
+				{Role: AssistantRole, Content: "Hi"},
+				{Role: AssistantRole, Content: "How can I help?"},
+			},
+			want: []Message{
+				{Role: SystemRole, Content: "Be brief"},
+				{Role: UserRole},
+				{Role: AssistantRole, Content: "Hi\n\nHow can I help?"},
+			},
+		},
+		{
+			name: "Tool calls are not merged",
+			messages: []Message{
+				{Role: UserRole, Content: "Weather?"},
+				{Role: AssistantRole, ToolCalls: []ToolCall{{ID: "1", Type: "function"}}},
+				{Role: AssistantRole, Content: "Checking"},
+			},
+			want: []Message{
+				{Role: UserRole, Content: "Weather?"},
+				{Role: AssistantRole, ToolCalls: []ToolCall{{ID: "1", Type: "function"}}},
+				{Role: UserRole},
+				{Role: AssistantRole, Content: "Checking"},
+			},
+		},
+		{
+			name:     "Empty input",
+			messages: nil,
+			want:     []Message{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeAlternation(tt.messages)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeAlternation() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAlternation_DoesNotModifyInput(t *testing.T) {
+	messages := []Message{
+		{Role: UserRole, Content: "a"},
+		{Role: UserRole, Content: "b"},
+	}
+
+	NormalizeAlternation(messages)
+
+	if messages[0].Content != "a" || messages[1].Content != "b" {
+		t.Errorf("NormalizeAlternation() modified its input: %+v", messages)
+	}
+}
+
+func TestMessage_GetUsageAfterJSONRoundTrip(t *testing.T) {
+	msg := Message{Role: AssistantRole, Content: "Hi"}
+	msg.SetUsage(&Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15})
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	want := &Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}
+	if got := decoded.GetUsage(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMessage_JSONVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    Message
+	}{
+		{
+			name:    "v0 string content",
+			fixture: `{"role":"user","content":"Hello"}`,
+			want:    Message{Role: UserRole, Content: "Hello"},
+		},
+		{
+			name:    "v0 null content with function call",
+			fixture: `{"role":"assistant","content":null,"function_call":{"name":"lookup","arguments":"{}"}}`,
+			want:    Message{Role: AssistantRole, FuncCall: &FunctionCall{Name: "lookup", Arguments: "{}"}},
+		},
+		{
+			name:    "v0 content parts",
+			fixture: `{"role":"user","content":[{"type":"text","text":"Describe this"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},{"type":"text","text":"briefly"}]}`,
+			want:    Message{Role: UserRole, Content: "Describe this\n\nbriefly"},
+		},
+		{
+			name:    "v0 single function call list",
+			fixture: `{"role":"assistant","content":"","function_calls":[{"name":"lookup","arguments":"{\"id\":1}"}]}`,
+			want:    Message{Role: AssistantRole, FuncCall: &FunctionCall{Name: "lookup", Arguments: `{"id":1}`}},
+		},
+		{
+			name:    "v0 function call list",
+			fixture: `{"role":"assistant","content":"","function_calls":[{"name":"a","arguments":"{}"},{"name":"b","arguments":"{}"}]}`,
+			want: Message{Role: AssistantRole, ToolCalls: []ToolCall{
+				{Type: "function", Function: FunctionCall{Name: "a", Arguments: "{}"}},
+				{Type: "function", Function: FunctionCall{Name: "b", Arguments: "{}"}},
+			}},
+		},
+		{
+			name:    "v1 tool result",
+			fixture: `{"version":1,"role":"tool","content":"42","tool_call_id":"call_1","stop_reason":"stop","metadata":{"source":"calc"}}`,
+			want:    Message{Role: "tool", Content: "42", ToolCallID: "call_1", StopReason: StopReasonStop, Metadata: map[string]interface{}{"source": "calc"}},
+		},
+		{
+			name:    "v2 creation time",
+			fixture: `{"version":2,"role":"user","content":"Hi","created_at":"2024-01-01T10:30:00.123456Z"}`,
+			want:    Message{Role: UserRole, Content: "Hi", CreatedAt: time.Date(2024, 1, 1, 10, 30, 0, 123456000, time.UTC)},
+		},
+		{
+			name:    "newer version with unknown fields",
+			fixture: `{"version":99,"role":"user","content":"Hi","edited_at":"2024-01-01T00:00:00Z"}`,
+			want:    Message{Role: UserRole, Content: "Hi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded Message
+			if err := json.Unmarshal([]byte(tt.fixture), &decoded); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.want) {
+				t.Fatalf("decoded = %+v, want %+v", decoded, tt.want)
+			}
+
+			// Re-encoding upgrades the message to the current version without losing anything
+			data, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if fields["version"] != float64(MessageSchemaVersion) {
+				t.Errorf("version = %v, want %d", fields["version"], MessageSchemaVersion)
+			}
+			if _, ok := fields["created_at"]; ok == decoded.CreatedAt.IsZero() {
+				t.Errorf("created_at = %v, want it only for messages with a CreatedAt", fields["created_at"])
+			}
+
+			var roundTripped Message
+			if err := json.Unmarshal(data, &roundTripped); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(roundTripped, decoded) {
+				t.Errorf("round trip = %+v, want %+v", roundTripped, decoded)
+			}
+		})
+	}
+}
+
+func TestMessage_UnmarshalInvalidContent(t *testing.T) {
+	var decoded Message
+	if err := json.Unmarshal([]byte(`{"role":"user","content":42}`), &decoded); err == nil {
+		t.Error("json.Unmarshal() accepted numeric content")
+	}
+}
+
+func TestMessage_FinishReasonAndModel(t *testing.T) {
+	var message Message
+	if message.FinishReason() != "" || message.Model() != "" {
+		t.Errorf("empty message = %q, %q, want no finish reason or model", message.FinishReason(), message.Model())
+	}
+
+	message.SetFinishReason("max_tokens")
+	message.SetModel("gpt-4o-2024-08-06")
+	message.SetModel("")
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.FinishReason() != "max_tokens" || decoded.Model() != "gpt-4o-2024-08-06" {
+		t.Errorf("decoded = %q, %q, want max_tokens from gpt-4o-2024-08-06", decoded.FinishReason(), decoded.Model())
+	}
+}
@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
+// MetricsLLM wraps an LLM, recording request counts, latency and token usage
+type MetricsLLM struct {
+	llm      LLM
+	recorder metrics.Recorder
+	provider string
+	model    string
+}
+
+// NewMetricsLLM creates a MetricsLLM labeling its metrics with provider and model
+func NewMetricsLLM(llm LLM, recorder metrics.Recorder, provider, model string) *MetricsLLM {
+	return &MetricsLLM{
+		llm:      llm,
+		recorder: recorder,
+		provider: provider,
+		model:    model,
+	}
+}
+
+func (m *MetricsLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	start := time.Now()
+	message, err := m.llm.Chat(ctx, messages, opts...)
+	m.recordRequest("chat", start, err)
+	if message != nil {
+		m.recordTokens(message.GetUsage())
+	}
+	return message, err
+}
+
+// ChatStream records its metrics once the stream is done
+func (m *MetricsLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	start := time.Now()
+	stream, err := m.llm.ChatStream(ctx, messages, opts...)
+	if err != nil {
+		m.recordRequest("chat_stream", start, err)
+		return nil, err
+	}
+
+	writer, out := NewRelayStreamWriter(ctx, opts...)
+	go func() {
+		defer writer.Close()
+
+		var streamErr error
+		var usage *Usage
+		for resp := range stream {
+			if resp.Error != nil {
+				streamErr = resp.Error
+			}
+			// Providers report cumulative usage, so only the last value counts
+			if u := resp.Message.GetUsage(); u != nil {
+				usage = u
+			}
+			if !writer.Send(resp) {
+				streamErr = ctx.Err()
+				break
+			}
+		}
+
+		m.recordRequest("chat_stream", start, streamErr)
+		m.recordTokens(usage)
+	}()
+
+	return out, nil
+}
+
+func (m *MetricsLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	start := time.Now()
+	completion, err := m.llm.Complete(ctx, prompt, opts...)
+	m.recordRequest("complete", start, err)
+	return completion, err
+}
+
+func (m *MetricsLLM) recordRequest(operation string, start time.Time, err error) {
+	labels := metrics.Labels{
+		"provider":  m.provider,
+		"model":     m.model,
+		"operation": operation,
+		"status":    metrics.Status(err),
+	}
+	m.recorder.Counter(metrics.LLMRequests, 1, labels)
+	m.recorder.Histogram(metrics.LLMLatency, time.Since(start).Seconds(), labels)
+}
+
+func (m *MetricsLLM) recordTokens(usage *Usage) {
+	if usage == nil {
+		return
+	}
+	m.recorder.Counter(metrics.LLMTokens, float64(usage.PromptTokens), metrics.Labels{
+		"provider": m.provider,
+		"model":    m.model,
+		"type":     "prompt",
+	})
+	m.recorder.Counter(metrics.LLMTokens, float64(usage.CompletionTokens), metrics.Labels{
+		"provider": m.provider,
+		"model":    m.model,
+		"type":     "completion",
+	})
+}
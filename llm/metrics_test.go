@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
+func TestMetricsLLM(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+		wantTokens float64
+	}{
+		{
+			name:       "Success",
+			wantStatus: metrics.StatusOK,
+			wantTokens: 12,
+		},
+		{
+			name:       "Error",
+			err:        errors.New("boom"),
+			wantStatus: metrics.StatusError,
+			wantTokens: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := metrics.NewInMemoryRecorder()
+			wrapped := NewMetricsLLM(stubLLM{err: tt.err}, recorder, "stub", "stub-1")
+
+			wrapped.Chat(context.Background(), []Message{{Role: RoleUser, Content: "hello"}})
+
+			labels := metrics.Labels{"provider": "stub", "model": "stub-1", "operation": "chat", "status": tt.wantStatus}
+			if got := recorder.Sum(metrics.LLMRequests, labels); got != 1 {
+				t.Errorf("%s%v = %v, want 1", metrics.LLMRequests, labels, got)
+			}
+			if got := len(recorder.Observations(metrics.LLMLatency)); got != 1 {
+				t.Errorf("%s observations = %d, want 1", metrics.LLMLatency, got)
+			}
+			if got := recorder.Sum(metrics.LLMTokens, nil); got != tt.wantTokens {
+				t.Errorf("%s = %v, want %v", metrics.LLMTokens, got, tt.wantTokens)
+			}
+		})
+	}
+}
+
+func TestMetricsLLM_ChatStream(t *testing.T) {
+	recorder := metrics.NewInMemoryRecorder()
+	wrapped := NewMetricsLLM(stubLLM{}, recorder, "stub", "stub-1")
+
+	stream, err := wrapped.ChatStream(context.Background(), []Message{{Role: RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	for range stream {
+	}
+
+	if got := recorder.Sum(metrics.LLMRequests, metrics.Labels{"operation": "chat_stream", "status": metrics.StatusOK}); got != 1 {
+		t.Errorf("%s = %v, want 1", metrics.LLMRequests, got)
+	}
+	if got := recorder.Sum(metrics.LLMTokens, metrics.Labels{"type": "prompt"}); got != 10 {
+		t.Errorf("%s prompt = %v, want 10", metrics.LLMTokens, got)
+	}
+}
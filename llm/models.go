@@ -0,0 +1,45 @@
+package llm
+
+// modelMaxTokens maps well known chat models to the most tokens they can
+// generate in one completion
+var modelMaxTokens = map[string]int{
+	"gpt-4o":                      16384,
+	"gpt-4o-mini":                 16384,
+	"gpt-4-turbo":                 4096,
+	"gpt-4-turbo-preview":         4096,
+	"gpt-4":                       8192,
+	"gpt-3.5-turbo":               4096,
+	"anthropic.claude-v2":         4096,
+	"anthropic.claude-instant-v1": 4096,
+	"anthropic.claude-3-sonnet-20240229-v1:0": 4096,
+	"amazon.titan-text-express-v1":            8192,
+	"meta.llama2-13b-chat-v1":                 2048,
+	"meta.llama2-70b-chat-v1":                 2048,
+}
+
+// ModelMaxTokensFor returns the known completion token limit of a model
+func ModelMaxTokensFor(model string) (int, bool) {
+	limit, ok := modelMaxTokens[model]
+	return limit, ok
+}
+
+// ModelOr returns the model adapters should request, Model when it is set
+// and their own model otherwise
+func (o *ChatOptions) ModelOr(model string) string {
+	if o.Model != "" {
+		return o.Model
+	}
+	return model
+}
+
+// MaxTokensFor returns the MaxTokens adapters should request from model. With
+// ModelClamp set, it is lowered to the model's limit when that is known.
+func (o *ChatOptions) MaxTokensFor(model string) int {
+	if !o.ModelClamp {
+		return o.MaxTokens
+	}
+	if limit, ok := ModelMaxTokensFor(model); ok && o.MaxTokens > limit {
+		return limit
+	}
+	return o.MaxTokens
+}
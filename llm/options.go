@@ -1,6 +1,9 @@
 package llm
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ResponseFormatType represents the type of response format
 type ResponseFormatType string
@@ -18,16 +21,24 @@ type ResponseFormat struct {
 
 // Add to ChatOptions struct:
 type ChatOptions struct {
-	Temperature      float32         // Controls randomness (0.0 to 2.0)
-	TopP             float32         // Controls diversity (0.0 to 1.0)
-	MaxTokens        int             // Maximum number of tokens to generate
-	Stop             []string        // Stop sequences
-	Functions        []Function      // Available functions
-	FunctionCall     string          // Force specific function call
-	PresencePenalty  float32         // Penalty for new tokens based on presence in text
-	FrequencyPenalty float32         // Penalty for new tokens based on frequency in text
-	Stream           bool            // Whether to stream the response
-	ResponseFormat   *ResponseFormat // Response format specification
+	Model              string              // Model requested instead of the adapter's own (empty keeps it)
+	Temperature        float32             // Controls randomness (0.0 to 2.0)
+	TopP               float32             // Controls diversity (0.0 to 1.0)
+	MaxTokens          int                 // Maximum number of tokens to generate
+	ModelClamp         bool                // Lowers MaxTokens to the model's limit, see ModelMaxTokensFor
+	Stop               []string            // Stop sequences
+	Tools              []Tool              // Tools the model may call
+	ToolChoice         *ToolChoice         // How the model uses Tools (nil leaves it to the provider)
+	Functions          []Function          // Deprecated: use Tools
+	FunctionCall       string              // Deprecated: use ToolChoice
+	PresencePenalty    float32             // Penalty for new tokens based on presence in text
+	FrequencyPenalty   float32             // Penalty for new tokens based on frequency in text
+	Stream             bool                // Whether to stream the response
+	ResponseFormat     *ResponseFormat     // Response format specification
+	ResponseValidation *ResponseValidation // Checks responses against ResponseFormat, see ValidatingLLM
+	RawResponse        *json.RawMessage    // Receives the unmodified provider response, for debugging
+	StreamBuffer       int                 // Capacity of the ChatStream channel (0 is unbuffered)
+	StreamCoalesce     time.Duration       // Window within which ChatStream content deltas are merged (0 disables it)
 }
 
 // Option is a function type to modify ChatOptions
@@ -68,6 +79,16 @@ func WithResponseFormat(format *ResponseFormat) Option {
 	}
 }
 
+// WithModel requests model instead of the model the adapter was created
+// with, for this call only. The OpenAI and Bedrock adapters honor it; Bedrock
+// builds the request for the model's family and rejects models it doesn't
+// know as unsupported.
+func WithModel(model string) Option {
+	return func(o *ChatOptions) {
+		o.Model = model
+	}
+}
+
 // Common option functions
 func WithTemperature(temp float32) Option {
 	return func(o *ChatOptions) {
@@ -87,21 +108,51 @@ func WithMaxTokens(tokens int) Option {
 	}
 }
 
+// WithModelClamp lowers MaxTokens to the model's completion token limit when
+// ModelMaxTokensFor knows it, instead of letting the provider reject the
+// request. Unknown models get MaxTokens unchanged.
+func WithModelClamp() Option {
+	return func(o *ChatOptions) {
+		o.ModelClamp = true
+	}
+}
+
 func WithStop(stop []string) Option {
 	return func(o *ChatOptions) {
 		o.Stop = stop
 	}
 }
 
+// WithTools sets the tools the model may call
+func WithTools(tools ...Tool) Option {
+	return func(o *ChatOptions) {
+		o.Tools = tools
+	}
+}
+
+// WithToolChoice sets how the model uses its tools
+func WithToolChoice(choice *ToolChoice) Option {
+	return func(o *ChatOptions) {
+		o.ToolChoice = choice
+	}
+}
+
+// WithFunctions offers functions to the model as function tools.
+//
+// Deprecated: use WithTools with FunctionTools.
 func WithFunctions(functions []Function) Option {
 	return func(o *ChatOptions) {
-		o.Functions = functions
+		o.Tools = FunctionTools(functions...)
 	}
 }
 
+// WithFunctionCall sets the tool choice from a legacy function_call value:
+// "auto", "none" or the name of the function to call.
+//
+// Deprecated: use WithToolChoice.
 func WithFunctionCall(functionCall string) Option {
 	return func(o *ChatOptions) {
-		o.FunctionCall = functionCall
+		o.ToolChoice = functionCallChoice(functionCall)
 	}
 }
 
@@ -110,3 +161,28 @@ func WithStream(stream bool) Option {
 		o.Stream = stream
 	}
 }
+
+// WithCaptureRaw stores the unmodified provider response body in dst, including
+// fields the library doesn't model. Adapters that can't capture it leave dst untouched.
+func WithCaptureRaw(dst *json.RawMessage) Option {
+	return func(o *ChatOptions) {
+		o.RawResponse = dst
+	}
+}
+
+// WithStreamBuffer makes ChatStream return a channel buffered for n responses,
+// so the adapter keeps reading from the provider while the consumer lags
+func WithStreamBuffer(n int) Option {
+	return func(o *ChatOptions) {
+		o.StreamBuffer = n
+	}
+}
+
+// WithStreamCoalesce makes ChatStream merge the content deltas produced within
+// d of the first one into a single response, so slow consumers receive fewer,
+// larger messages. Tool calls, stop reasons and errors are never merged.
+func WithStreamCoalesce(d time.Duration) Option {
+	return func(o *ChatOptions) {
+		o.StreamCoalesce = d
+	}
+}
@@ -0,0 +1,134 @@
+// Package pricing estimates the USD cost of chat and embedding calls from
+// token counts.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// Price is what a chat model charges in USD per 1K tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// chatPrices maps well known chat models to their list prices, which a Table
+// overrides
+var chatPrices = map[string]Price{
+	"gpt-4o":        {Prompt: 0.0025, Completion: 0.01},
+	"gpt-4o-mini":   {Prompt: 0.00015, Completion: 0.0006},
+	"gpt-4-turbo":   {Prompt: 0.01, Completion: 0.03},
+	"gpt-4":         {Prompt: 0.03, Completion: 0.06},
+	"gpt-3.5-turbo": {Prompt: 0.0005, Completion: 0.0015},
+	"o1":            {Prompt: 0.015, Completion: 0.06},
+	"o1-mini":       {Prompt: 0.0011, Completion: 0.0044},
+	"o3-mini":       {Prompt: 0.0011, Completion: 0.0044},
+}
+
+// embeddingPrices maps well known embedding models to their USD price per 1K
+// tokens, which a Table overrides
+var embeddingPrices = map[string]float64{
+	"text-embedding-3-small": 0.00002,
+	"text-embedding-3-large": 0.00013,
+	"text-embedding-ada-002": 0.0001,
+}
+
+// ErrPriceUnknown is matched by PriceUnknownError with errors.Is
+var ErrPriceUnknown = errors.New("price unknown")
+
+// PriceUnknownError is returned when a model has no price, so unpriced calls
+// are not mistaken for free ones
+type PriceUnknownError struct {
+	Kind  string // "chat" or "embedding"
+	Model string
+}
+
+func (e *PriceUnknownError) Error() string {
+	return fmt.Sprintf("pricing: no %s price for model %q", e.Kind, e.Model)
+}
+
+func (e *PriceUnknownError) Is(target error) bool {
+	return target == ErrPriceUnknown
+}
+
+// Table extends or overrides the built-in prices. A nil Table uses only the
+// built-in prices.
+type Table struct {
+	Chat      map[string]Price
+	Embedding map[string]float64
+}
+
+// ChatPrice returns the price of a chat model. Dated model versions such as
+// gpt-4o-2024-08-06 fall back to the price of their base model.
+func (t *Table) ChatPrice(model string) (Price, bool) {
+	var overrides map[string]Price
+	if t != nil {
+		overrides = t.Chat
+	}
+	return lookup(model, overrides, chatPrices)
+}
+
+// EmbeddingPrice returns the per 1K token price of an embedding model
+func (t *Table) EmbeddingPrice(model string) (float64, bool) {
+	var overrides map[string]float64
+	if t != nil {
+		overrides = t.Embedding
+	}
+	return lookup(model, overrides, embeddingPrices)
+}
+
+// EstimateChatCost returns the USD cost of a chat call with the given usage
+func (t *Table) EstimateChatCost(model string, usage llm.Usage) (float64, error) {
+	price, ok := t.ChatPrice(model)
+	if !ok {
+		return 0, &PriceUnknownError{Kind: "chat", Model: model}
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1000, nil
+}
+
+// EstimateEmbeddingCost returns the USD cost of embedding the given number of tokens
+func (t *Table) EstimateEmbeddingCost(model string, tokens int) (float64, error) {
+	price, ok := t.EmbeddingPrice(model)
+	if !ok {
+		return 0, &PriceUnknownError{Kind: "embedding", Model: model}
+	}
+	return float64(tokens) * price / 1000, nil
+}
+
+// EstimateChatCost returns the USD cost of a chat call using the built-in prices
+func EstimateChatCost(model string, usage llm.Usage) (float64, error) {
+	return (*Table)(nil).EstimateChatCost(model, usage)
+}
+
+// EstimateEmbeddingCost returns the USD cost of embedding tokens using the built-in prices
+func EstimateEmbeddingCost(model string, tokens int) (float64, error) {
+	return (*Table)(nil).EstimateEmbeddingCost(model, tokens)
+}
+
+// lookup finds model in overrides, then builtins, trying the model itself before
+// the longest known name it extends with a "-" suffix
+func lookup[V any](model string, overrides, builtins map[string]V) (V, bool) {
+	for _, prices := range []map[string]V{overrides, builtins} {
+		if v, ok := prices[model]; ok {
+			return v, true
+		}
+	}
+
+	var best string
+	var found V
+	for _, prices := range []map[string]V{overrides, builtins} {
+		for name, v := range prices {
+			if len(name) > len(best) && strings.HasPrefix(model, name+"-") {
+				best, found = name, v
+			}
+		}
+		if best != "" {
+			return found, true
+		}
+	}
+	return found, false
+}
@@ -0,0 +1,83 @@
+package pricing
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+func TestEstimateChatCost(t *testing.T) {
+	usage := llm.Usage{PromptTokens: 2000, CompletionTokens: 500, TotalTokens: 2500}
+
+	tests := []struct {
+		name  string
+		table *Table
+		model string
+		want  float64
+	}{
+		{
+			name:  "Built-in price",
+			model: "gpt-4o",
+			want:  2*0.0025 + 0.5*0.01,
+		},
+		{
+			name:  "Dated version uses its base model",
+			model: "gpt-4o-mini-2024-07-18",
+			want:  2*0.00015 + 0.5*0.0006,
+		},
+		{
+			name:  "Override replaces the built-in price",
+			table: &Table{Chat: map[string]Price{"gpt-4o": {Prompt: 1, Completion: 2}}},
+			model: "gpt-4o",
+			want:  2*1 + 0.5*2,
+		},
+		{
+			name:  "Custom model",
+			table: &Table{Chat: map[string]Price{"my-finetune": {Prompt: 0.1, Completion: 0.2}}},
+			model: "my-finetune",
+			want:  2*0.1 + 0.5*0.2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.table.EstimateChatCost(tt.model, usage)
+			if err != nil {
+				t.Fatalf("EstimateChatCost() error = %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("EstimateChatCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateCost_UnknownModel(t *testing.T) {
+	cost, err := EstimateChatCost("mystery-model", llm.Usage{PromptTokens: 10})
+	var unknown *PriceUnknownError
+	if !errors.As(err, &unknown) || unknown.Model != "mystery-model" || unknown.Kind != "chat" {
+		t.Errorf("EstimateChatCost() error = %v, want chat PriceUnknownError for mystery-model", err)
+	}
+	if !errors.Is(err, ErrPriceUnknown) {
+		t.Errorf("EstimateChatCost() error = %v, want ErrPriceUnknown", err)
+	}
+	if cost != 0 {
+		t.Errorf("EstimateChatCost() = %v, want 0 with an error", cost)
+	}
+
+	if _, err := EstimateEmbeddingCost("gpt-4o", 100); !errors.Is(err, ErrPriceUnknown) {
+		t.Errorf("EstimateEmbeddingCost() error = %v, want ErrPriceUnknown for a chat model", err)
+	}
+}
+
+func TestEstimateEmbeddingCost(t *testing.T) {
+	got, err := EstimateEmbeddingCost("text-embedding-3-small", 50000)
+	if err != nil {
+		t.Fatalf("EstimateEmbeddingCost() error = %v", err)
+	}
+	if want := 50 * 0.00002; math.Abs(got-want) > 1e-12 {
+		t.Errorf("EstimateEmbeddingCost() = %v, want %v", got, want)
+	}
+}
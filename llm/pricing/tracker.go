@@ -0,0 +1,309 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
+// TokenCounter returns the number of tokens in text
+type TokenCounter func(text string) int
+
+// EstimateTokens approximates the token count of English text at four characters per token
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Spend is the accumulated cost of the calls recorded with one set of labels
+type Spend struct {
+	Labels           metrics.Labels `json:"labels,omitempty"`
+	Cost             float64        `json:"cost"`
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	EmbeddingTokens  int            `json:"embedding_tokens"`
+	// UnpricedCalls counts calls to models without a price, which add no cost
+	UnpricedCalls int `json:"unpriced_calls"`
+}
+
+// TrackerOptions contains configuration for a CostTracker
+type TrackerOptions struct {
+	Table *Table
+	// TokenCounter counts embedded tokens, since embedders don't report usage
+	TokenCounter TokenCounter
+}
+
+// TrackerOption is a function type to modify TrackerOptions
+type TrackerOption func(*TrackerOptions)
+
+// WithTable sets the prices used instead of only the built-in ones
+func WithTable(table *Table) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.Table = table
+	}
+}
+
+// WithTokenCounter sets how embedded text is counted in tokens
+func WithTokenCounter(counter TokenCounter) TrackerOption {
+	return func(o *TrackerOptions) {
+		o.TokenCounter = counter
+	}
+}
+
+// CostTracker accumulates estimated spend per label set. It is safe for
+// concurrent use.
+type CostTracker struct {
+	opts  TrackerOptions
+	mu    sync.Mutex
+	spend map[string]*Spend
+}
+
+// NewCostTracker creates an empty CostTracker
+func NewCostTracker(opts ...TrackerOption) *CostTracker {
+	options := TrackerOptions{TokenCounter: EstimateTokens}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &CostTracker{
+		opts:  options,
+		spend: make(map[string]*Spend),
+	}
+}
+
+// RecordChat adds the cost of a chat call. Calls to unpriced models are counted
+// in UnpricedCalls and return a PriceUnknownError.
+func (t *CostTracker) RecordChat(model string, usage llm.Usage, labels metrics.Labels) error {
+	cost, err := t.opts.Table.EstimateChatCost(model, usage)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spend := t.entry(labels)
+	spend.PromptTokens += usage.PromptTokens
+	spend.CompletionTokens += usage.CompletionTokens
+	if err != nil {
+		spend.UnpricedCalls++
+		return err
+	}
+	spend.Cost += cost
+	return nil
+}
+
+// RecordEmbedding adds the cost of embedding tokens
+func (t *CostTracker) RecordEmbedding(model string, tokens int, labels metrics.Labels) error {
+	cost, err := t.opts.Table.EstimateEmbeddingCost(model, tokens)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spend := t.entry(labels)
+	spend.EmbeddingTokens += tokens
+	if err != nil {
+		spend.UnpricedCalls++
+		return err
+	}
+	spend.Cost += cost
+	return nil
+}
+
+// Total returns the cost recorded across all labels
+func (t *CostTracker) Total() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total float64
+	for _, spend := range t.spend {
+		total += spend.Cost
+	}
+	return total
+}
+
+// Spend returns the accumulated spend per label set, ordered by labels
+func (t *CostTracker) Spend() []Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.spend))
+	for key := range t.spend {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]Spend, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *t.spend[key])
+	}
+	return result
+}
+
+// Reset clears everything recorded so far
+func (t *CostTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spend = make(map[string]*Spend)
+}
+
+// entry returns the spend for labels, creating it if needed. t.mu must be held.
+func (t *CostTracker) entry(labels metrics.Labels) *Spend {
+	key := labelKey(labels)
+	spend, ok := t.spend[key]
+	if !ok {
+		copied := make(metrics.Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		spend = &Spend{Labels: copied}
+		t.spend[key] = spend
+	}
+	return spend
+}
+
+func labelKey(labels metrics.Labels) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// CostLLM wraps an LLM, recording the cost of the usage its responses report
+type CostLLM struct {
+	llm     llm.LLM
+	tracker *CostTracker
+	model   string
+	labels  metrics.Labels
+}
+
+// NewCostLLM creates a CostLLM pricing calls as model and recording them under labels
+func NewCostLLM(l llm.LLM, tracker *CostTracker, model string, labels metrics.Labels) *CostLLM {
+	return &CostLLM{
+		llm:     l,
+		tracker: tracker,
+		model:   model,
+		labels:  labels,
+	}
+}
+
+func (c *CostLLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	message, err := c.llm.Chat(ctx, messages, opts...)
+	if message != nil {
+		c.record(message.GetUsage())
+	}
+	return message, err
+}
+
+// ChatStream records the cost once the stream is done
+func (c *CostLLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+	stream, err := c.llm.ChatStream(ctx, messages, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, out := llm.NewRelayStreamWriter(ctx, opts...)
+	go func() {
+		defer writer.Close()
+
+		var usage *llm.Usage
+		for resp := range stream {
+			// Providers report cumulative usage, so only the last value counts
+			if u := resp.Message.GetUsage(); u != nil {
+				usage = u
+			}
+			if !writer.Send(resp) {
+				break
+			}
+		}
+		c.record(usage)
+	}()
+
+	return out, nil
+}
+
+// Complete is passed through; completions don't report usage
+func (c *CostLLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
+	return c.llm.Complete(ctx, prompt, opts...)
+}
+
+func (c *CostLLM) record(usage *llm.Usage) {
+	if usage == nil {
+		return
+	}
+	// Unpriced calls are counted by the tracker
+	_ = c.tracker.RecordChat(c.model, *usage, c.labels)
+}
+
+// CostEmbedder wraps an Embedder, recording the estimated cost of the text it embeds
+type CostEmbedder struct {
+	embedder  embedding.Embedder
+	tracker   *CostTracker
+	model     string
+	dimension int
+	labels    metrics.Labels
+}
+
+// NewCostEmbedder creates a CostEmbedder recording calls under labels. The
+// model is taken from the embedder when it reports one.
+func NewCostEmbedder(embedder embedding.Embedder, tracker *CostTracker, labels metrics.Labels) *CostEmbedder {
+	c := &CostEmbedder{
+		embedder: embedder,
+		tracker:  tracker,
+		labels:   labels,
+	}
+	if modelProvider, ok := embedder.(embedding.ModelProvider); ok {
+		c.model = modelProvider.Model()
+	}
+	if dimensionProvider, ok := embedder.(embedding.DimensionProvider); ok {
+		c.dimension = dimensionProvider.Dimension()
+	}
+	return c
+}
+
+// Model returns the wrapped embedder's model, if it reports one
+func (c *CostEmbedder) Model() string {
+	return c.model
+}
+
+// Dimension returns the wrapped embedder's configured vector size, if it reports one
+func (c *CostEmbedder) Dimension() int {
+	return c.dimension
+}
+
+func (c *CostEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	vectors, err := c.embedder.EmbedDocuments(ctx, documents)
+	var partial *embedding.PartialEmbedError
+	switch {
+	case err == nil:
+		c.record(documents...)
+	case errors.As(err, &partial) && len(vectors) == len(documents):
+		// Only the inputs that were embedded are billed
+		var embedded []string
+		for i, vector := range vectors {
+			if vector != nil {
+				embedded = append(embedded, documents[i])
+			}
+		}
+		c.record(embedded...)
+	}
+	return vectors, err
+}
+
+func (c *CostEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	vector, err := c.embedder.EmbedQuery(ctx, text)
+	if err == nil {
+		c.record(text)
+	}
+	return vector, err
+}
+
+func (c *CostEmbedder) record(texts ...string) {
+	tokens := 0
+	for _, text := range texts {
+		tokens += c.tracker.opts.TokenCounter(text)
+	}
+	// Unpriced calls are counted by the tracker
+	_ = c.tracker.RecordEmbedding(c.model, tokens, c.labels)
+}
@@ -0,0 +1,105 @@
+package pricing_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/llm/pricing"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+func usageReply(prompt, completion int) func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	return func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+		reply := &llm.Message{Role: llm.RoleAssistant, Content: "ok"}
+		reply.SetUsage(&llm.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion})
+		return reply, nil
+	}
+}
+
+func TestCostTracker_LLMAndEmbedder(t *testing.T) {
+	ctx := context.Background()
+	table := &pricing.Table{
+		Chat:      map[string]pricing.Price{"chat-model": {Prompt: 1, Completion: 2}},
+		Embedding: map[string]float64{"embed-model": 0.5},
+	}
+	tracker := pricing.NewCostTracker(
+		pricing.WithTable(table),
+		pricing.WithTokenCounter(func(text string) int { return len(text) }),
+	)
+
+	model := mocks.NewLLM("")
+	model.ChatFunc = usageReply(1000, 500)
+	tenantA := pricing.NewCostLLM(model, tracker, "chat-model", metrics.Labels{"tenant": "a"})
+	tenantB := pricing.NewCostLLM(model, tracker, "chat-model", metrics.Labels{"tenant": "b"})
+	for _, l := range []llm.LLM{tenantA, tenantA, tenantB} {
+		if _, err := l.Chat(ctx, []llm.Message{{Role: llm.RoleUser, Content: "hi"}}); err != nil {
+			t.Fatalf("Chat() error = %v", err)
+		}
+	}
+
+	embedder := pricing.NewCostEmbedder(mocks.NewEmbedder(4), tracker, metrics.Labels{"tenant": "a"})
+	if _, err := embedder.EmbedDocuments(ctx, []string{"abcd", "ef"}); err != nil {
+		t.Fatalf("EmbedDocuments() error = %v", err)
+	}
+
+	spend := tracker.Spend()
+	if len(spend) != 2 {
+		t.Fatalf("Spend() = %+v, want one entry per tenant", spend)
+	}
+	// A chat costs 1*1 + 0.5*2 = 2
+	if spend[0].Labels["tenant"] != "a" || spend[0].Cost != 4 {
+		t.Errorf("tenant a spend = %+v, want cost 4 with no embedding price for the mock model", spend[0])
+	}
+	if spend[0].EmbeddingTokens != 6 || spend[0].UnpricedCalls != 1 {
+		t.Errorf("tenant a spend = %+v, want 6 embedding tokens from one unpriced call", spend[0])
+	}
+	if spend[1].Labels["tenant"] != "b" || spend[1].Cost != 2 || spend[1].PromptTokens != 1000 {
+		t.Errorf("tenant b spend = %+v, want cost 2 for 1000 prompt tokens", spend[1])
+	}
+	if got := tracker.Total(); math.Abs(got-6) > 1e-9 {
+		t.Errorf("Total() = %v, want 6", got)
+	}
+}
+
+func TestCostTracker_ChatStream(t *testing.T) {
+	tracker := pricing.NewCostTracker()
+	model := mocks.NewLLM("one two three")
+	model.ChatStreamFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+		out := make(chan llm.StreamResponse, 2)
+		first := llm.Message{Content: "one "}
+		first.SetUsage(&llm.Usage{PromptTokens: 1000, CompletionTokens: 1})
+		last := llm.Message{Content: "two"}
+		last.SetUsage(&llm.Usage{PromptTokens: 1000, CompletionTokens: 1000})
+		out <- llm.StreamResponse{Message: first}
+		out <- llm.StreamResponse{Message: last, Done: true}
+		close(out)
+		return out, nil
+	}
+
+	stream, err := pricing.NewCostLLM(model, tracker, "gpt-4o", nil).ChatStream(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	for range stream {
+	}
+
+	// Only the final cumulative usage is priced
+	if got, want := tracker.Total(), 0.0025+0.01; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Total() = %v, want %v", got, want)
+	}
+}
+
+func TestCostTracker_UnknownModel(t *testing.T) {
+	tracker := pricing.NewCostTracker()
+	err := tracker.RecordChat("mystery-model", llm.Usage{PromptTokens: 10}, nil)
+	if err == nil {
+		t.Fatal("RecordChat() error = nil, want PriceUnknownError")
+	}
+	spend := tracker.Spend()
+	if len(spend) != 1 || spend[0].UnpricedCalls != 1 || spend[0].Cost != 0 {
+		t.Errorf("Spend() = %+v, want one unpriced call", spend)
+	}
+}
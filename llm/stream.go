@@ -0,0 +1,88 @@
+package llm
+
+import "strings"
+
+// CollectStream reads a ChatStream response to the end and assembles the deltas
+// into one message: content is concatenated, function and tool call fragments are
+// joined into complete calls, and the last reported usage is kept. If the stream
+// reports an error, CollectStream returns it instead of a message. ToolCallDelta
+// fragments are skipped, since the Done response repeats the complete calls.
+func CollectStream(ch <-chan StreamResponse) (*Message, error) {
+	var content strings.Builder
+	var toolCalls []ToolCall
+	var usage *Usage
+	var finishReason, model string
+	message := &Message{}
+
+	for resp := range ch {
+		if resp.Error != nil {
+			// Drain the stream so the producer can exit
+			for range ch {
+			}
+			return nil, resp.Error
+		}
+
+		delta := resp.Message
+		if message.Role == "" && delta.Role != "" {
+			message.Role = delta.Role
+		}
+		if message.Name == "" && delta.Name != "" {
+			message.Name = delta.Name
+		}
+		content.WriteString(delta.Content)
+		if delta.StopReason != "" {
+			message.StopReason = delta.StopReason
+		}
+		if reason := delta.FinishReason(); reason != "" {
+			finishReason = reason
+		}
+		if m := delta.Model(); m != "" {
+			model = m
+		}
+
+		// Providers report cumulative usage, so only the last value counts
+		if u := delta.GetUsage(); u != nil {
+			usage = u
+		}
+
+		for _, tc := range delta.ToolCalls {
+			last := len(toolCalls) - 1
+			if last < 0 || (tc.ID != "" && tc.ID != toolCalls[last].ID) {
+				toolCalls = append(toolCalls, tc)
+				continue
+			}
+			toolCalls[last].Function.Arguments += tc.Function.Arguments
+			if toolCalls[last].Function.Name == "" {
+				toolCalls[last].Function.Name = tc.Function.Name
+			}
+		}
+
+		// Adapters without tool call IDs stream function calls instead; a name
+		// starts a new call and later fragments carry only arguments
+		if fc := delta.FuncCall; fc != nil && len(delta.ToolCalls) == 0 {
+			last := len(toolCalls) - 1
+			if last < 0 || fc.Name != "" {
+				toolCalls = append(toolCalls, ToolCall{Type: "function", Function: *fc})
+				continue
+			}
+			toolCalls[last].Function.Arguments += fc.Arguments
+		}
+	}
+
+	if message.Role == "" {
+		message.Role = RoleAssistant
+	}
+	message.Content = content.String()
+
+	if len(toolCalls) > 0 {
+		message.ToolCalls = toolCalls
+		// Keep backward compatibility with single FuncCall
+		message.FuncCall = &toolCalls[0].Function
+	}
+
+	message.SetUsage(usage)
+	message.SetFinishReason(finishReason)
+	message.SetModel(model)
+
+	return message, nil
+}
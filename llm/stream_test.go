@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// feed returns a closed channel holding responses
+func feed(responses ...StreamResponse) <-chan StreamResponse {
+	ch := make(chan StreamResponse, len(responses))
+	for _, resp := range responses {
+		ch <- resp
+	}
+	close(ch)
+	return ch
+}
+
+func withUsage(message Message, prompt, completion int) Message {
+	message.SetUsage(&Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion})
+	return message
+}
+
+func TestCollectStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     []StreamResponse
+		wantContent   string
+		wantToolCalls []ToolCall
+		wantUsage     *Usage
+	}{
+		{
+			name: "Content deltas",
+			responses: []StreamResponse{
+				{Message: withUsage(Message{Role: RoleAssistant, Content: "Hel"}, 5, 1)},
+				{Message: withUsage(Message{Content: "lo, "}, 5, 2)},
+				{Message: withUsage(Message{Content: "world"}, 5, 3)},
+				{Message: withUsage(Message{}, 5, 3), Done: true},
+			},
+			wantContent: "Hello, world",
+			wantUsage:   &Usage{PromptTokens: 5, CompletionTokens: 3, TotalTokens: 8},
+		},
+		{
+			name: "Function call fragments",
+			responses: []StreamResponse{
+				{Message: Message{Role: RoleAssistant, FuncCall: &FunctionCall{Name: "get_weather"}}},
+				{Message: Message{FuncCall: &FunctionCall{Arguments: `{"city":`}}},
+				{Message: Message{FuncCall: &FunctionCall{Arguments: `"Lima"}`}}},
+				{Done: true},
+			},
+			wantToolCalls: []ToolCall{
+				{Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Lima"}`}},
+			},
+		},
+		{
+			name: "Parallel tool calls",
+			responses: []StreamResponse{
+				{Message: Message{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "a"}}}}},
+				{Message: Message{ToolCalls: []ToolCall{{Function: FunctionCall{Arguments: `{"x":1}`}}}}},
+				{Message: Message{ToolCalls: []ToolCall{{ID: "call_2", Type: "function", Function: FunctionCall{Name: "b", Arguments: `{}`}}}}},
+				{Done: true},
+			},
+			wantToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: FunctionCall{Name: "a", Arguments: `{"x":1}`}},
+				{ID: "call_2", Type: "function", Function: FunctionCall{Name: "b", Arguments: `{}`}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := CollectStream(feed(tt.responses...))
+			if err != nil {
+				t.Fatalf("CollectStream() error = %v", err)
+			}
+			if message.Role != RoleAssistant {
+				t.Errorf("Role = %q, want %q", message.Role, RoleAssistant)
+			}
+			if message.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", message.Content, tt.wantContent)
+			}
+			if !reflect.DeepEqual(message.ToolCalls, tt.wantToolCalls) {
+				t.Errorf("ToolCalls = %+v, want %+v", message.ToolCalls, tt.wantToolCalls)
+			}
+			if len(tt.wantToolCalls) > 0 && (message.FuncCall == nil || message.FuncCall.Name != tt.wantToolCalls[0].Function.Name) {
+				t.Errorf("FuncCall = %+v, want first tool call", message.FuncCall)
+			}
+			if !reflect.DeepEqual(message.GetUsage(), tt.wantUsage) {
+				t.Errorf("GetUsage() = %+v, want %+v", message.GetUsage(), tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestCollectStream_Error(t *testing.T) {
+	streamErr := errors.New("stream broke")
+	message, err := CollectStream(feed(
+		StreamResponse{Message: Message{Role: RoleAssistant, Content: "partial"}},
+		StreamResponse{Error: streamErr, Done: true},
+	))
+	if !errors.Is(err, streamErr) {
+		t.Errorf("CollectStream() error = %v, want %v", err, streamErr)
+	}
+	if message != nil {
+		t.Errorf("CollectStream() message = %+v, want nil", message)
+	}
+}
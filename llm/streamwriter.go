@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// StreamWriter is how adapters deliver ChatStream responses. It applies the
+// WithStreamBuffer and WithStreamCoalesce options and stops blocking as soon
+// as the context is done, so an adapter goroutine whose consumer abandoned the
+// stream can exit and close the provider stream.
+type StreamWriter struct {
+	ctx context.Context
+	in  chan StreamResponse
+}
+
+// NewStreamWriter returns a writer and the channel ChatStream should return.
+// The adapter must call Close when it is done sending.
+func NewStreamWriter(ctx context.Context, options *ChatOptions) (*StreamWriter, <-chan StreamResponse) {
+	buffer := options.StreamBuffer
+	if buffer < 0 {
+		buffer = 0
+	}
+	out := make(chan StreamResponse, buffer)
+
+	if options.StreamCoalesce <= 0 {
+		return &StreamWriter{ctx: ctx, in: out}, out
+	}
+
+	in := make(chan StreamResponse)
+	go coalesce(ctx, in, out, options.StreamCoalesce)
+	return &StreamWriter{ctx: ctx, in: in}, out
+}
+
+// NewRelayStreamWriter returns a StreamWriter for a wrapper that forwards the
+// stream of the LLM it wraps. Its channel is buffered like the inner one, but
+// deltas the inner LLM already coalesced are not coalesced again.
+func NewRelayStreamWriter(ctx context.Context, opts ...Option) (*StreamWriter, <-chan StreamResponse) {
+	options := &ChatOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return NewStreamWriter(ctx, &ChatOptions{StreamBuffer: options.StreamBuffer})
+}
+
+// Send delivers resp, blocking while the channel is full. It returns false
+// when the context is done and no consumer is ready to take resp, after which
+// the adapter should stop streaming.
+func (w *StreamWriter) Send(resp StreamResponse) bool {
+	return send(w.ctx, w.in, resp)
+}
+
+// Close ends the stream, closing the channel returned to the consumer once
+// every response sent has been delivered
+func (w *StreamWriter) Close() {
+	close(w.in)
+}
+
+// coalesce forwards responses from in to out, merging content deltas that
+// arrive within window of the first pending one. It returns when in is closed
+// or when out can't be written because the context is done, in which case the
+// writer's sends fail too and the adapter doesn't block.
+func coalesce(ctx context.Context, in <-chan StreamResponse, out chan<- StreamResponse, window time.Duration) {
+	defer close(out)
+
+	timer := time.NewTimer(window)
+	timer.Stop()
+	defer timer.Stop()
+
+	var pending *StreamResponse
+	flush := func() bool {
+		if pending == nil {
+			return true
+		}
+		resp := *pending
+		pending = nil
+		timer.Stop()
+		return send(ctx, out, resp)
+	}
+
+	for {
+		select {
+		case resp, ok := <-in:
+			if !ok {
+				flush()
+				return
+			}
+			if !isContentDelta(resp) {
+				if !flush() || !send(ctx, out, resp) {
+					return
+				}
+				continue
+			}
+			if pending == nil {
+				pending = &resp
+				timer.Reset(window)
+				continue
+			}
+			mergeDelta(&pending.Message, resp.Message)
+		case <-timer.C:
+			if !flush() {
+				return
+			}
+		}
+	}
+}
+
+// send delivers resp on ch unless ctx is done. A consumer still reading after
+// the cancellation gets resp, typically the error reporting it, if it is
+// already waiting.
+func send(ctx context.Context, ch chan<- StreamResponse, resp StreamResponse) bool {
+	select {
+	case ch <- resp:
+		return true
+	case <-ctx.Done():
+		select {
+		case ch <- resp:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// isContentDelta reports whether resp only carries content that can be merged
+// with the deltas around it
+func isContentDelta(resp StreamResponse) bool {
+	msg := resp.Message
+	return resp.Error == nil && !resp.Done && resp.ToolCallDelta == nil &&
+		len(msg.ToolCalls) == 0 && msg.FuncCall == nil && msg.StopReason == ""
+}
+
+// mergeDelta appends the content of delta to dst, keeping the latest usage
+func mergeDelta(dst *Message, delta Message) {
+	if dst.Role == "" {
+		dst.Role = delta.Role
+	}
+	dst.Content += delta.Content
+	if usage := delta.GetUsage(); usage != nil {
+		dst.SetUsage(usage)
+	}
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitGoroutines fails the test unless the goroutine count drops back to want
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines = %d, want %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamWriter_Buffer(t *testing.T) {
+	writer, ch := NewStreamWriter(context.Background(), &ChatOptions{StreamBuffer: 3})
+
+	// Nothing reads yet, so only the buffer keeps the sends from blocking
+	for _, content := range []string{"a", "b", "c"} {
+		if !writer.Send(StreamResponse{Message: Message{Content: content}}) {
+			t.Fatalf("Send(%q) = false", content)
+		}
+	}
+	writer.Close()
+
+	var got string
+	for resp := range ch {
+		got += resp.Message.Content
+	}
+	if got != "abc" {
+		t.Errorf("content = %q, want %q", got, "abc")
+	}
+}
+
+func TestStreamWriter_Coalesce(t *testing.T) {
+	writer, ch := NewStreamWriter(context.Background(), &ChatOptions{StreamCoalesce: time.Hour})
+
+	go func() {
+		defer writer.Close()
+		writer.Send(StreamResponse{Message: Message{Role: RoleAssistant, Content: "Hel"}})
+		writer.Send(StreamResponse{Message: Message{Content: "lo, "}})
+		writer.Send(StreamResponse{Message: withUsage(Message{Content: "world"}, 5, 3)})
+		writer.Send(StreamResponse{Message: Message{ToolCalls: []ToolCall{{ID: "call_1"}}}})
+		writer.Send(StreamResponse{ToolCallDelta: &FunctionCallDelta{Arguments: "{}"}})
+		writer.Send(StreamResponse{Message: Message{Content: "!"}})
+		writer.Send(StreamResponse{Done: true})
+	}()
+
+	var got []StreamResponse
+	for resp := range ch {
+		got = append(got, resp)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("responses = %d (%v), want 5", len(got), got)
+	}
+	if got[0].Message.Content != "Hello, world" || got[0].Message.Role != RoleAssistant {
+		t.Errorf("merged delta = %+v, want assistant \"Hello, world\"", got[0].Message)
+	}
+	if usage := got[0].Message.GetUsage(); usage == nil || usage.CompletionTokens != 3 {
+		t.Errorf("merged usage = %+v, want the latest", usage)
+	}
+	if len(got[1].Message.ToolCalls) != 1 {
+		t.Errorf("responses[1] = %+v, want the tool call", got[1])
+	}
+	if got[2].ToolCallDelta == nil {
+		t.Errorf("responses[2] = %+v, want the tool call delta", got[2])
+	}
+	if got[3].Message.Content != "!" || !got[4].Done {
+		t.Errorf("responses[3:] = %+v, want \"!\" then Done", got[3:])
+	}
+}
+
+func TestStreamWriter_CoalesceFlushesAfterWindow(t *testing.T) {
+	writer, ch := NewStreamWriter(context.Background(), &ChatOptions{StreamCoalesce: 10 * time.Millisecond})
+	defer writer.Close()
+
+	writer.Send(StreamResponse{Message: Message{Content: "partial"}})
+	select {
+	case resp := <-ch:
+		if resp.Message.Content != "partial" {
+			t.Errorf("content = %q, want %q", resp.Message.Content, "partial")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending delta was not flushed after the window")
+	}
+}
+
+func TestStreamWriter_AbandonedStream(t *testing.T) {
+	for name, options := range map[string]*ChatOptions{
+		"unbuffered": {},
+		"buffered":   {StreamBuffer: 2},
+		"coalesced":  {StreamCoalesce: time.Millisecond},
+	} {
+		t.Run(name, func(t *testing.T) {
+			baseline := runtime.NumGoroutine()
+			ctx, cancel := context.WithCancel(context.Background())
+			writer, ch := NewStreamWriter(ctx, options)
+
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				defer writer.Close()
+				for writer.Send(StreamResponse{Message: Message{Content: "token "}}) {
+				}
+			}()
+
+			<-ch
+			cancel()
+
+			select {
+			case <-stopped:
+			case <-time.After(2 * time.Second):
+				t.Fatal("producer kept sending after the consumer cancelled")
+			}
+			waitGoroutines(t, baseline)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package llm
+
+// ToolType is the kind of tool a model can call
+type ToolType string
+
+const (
+	// ToolTypeFunction is a function the model calls with JSON arguments
+	ToolTypeFunction ToolType = "function"
+)
+
+// Tool is a tool the model may call
+type Tool struct {
+	Type     ToolType  `json:"type"`
+	Function *Function `json:"function,omitempty"` // Set for ToolTypeFunction
+}
+
+// FunctionTool returns a tool for calling function
+func FunctionTool(function Function) Tool {
+	return Tool{Type: ToolTypeFunction, Function: &function}
+}
+
+// FunctionTools returns a function tool for each of functions
+func FunctionTools(functions ...Function) []Tool {
+	tools := make([]Tool, len(functions))
+	for i, function := range functions {
+		tools[i] = FunctionTool(function)
+	}
+	return tools
+}
+
+// ToolChoiceMode controls whether and which tool the model calls
+type ToolChoiceMode string
+
+const (
+	// ToolChoiceAuto lets the model decide whether to call a tool
+	ToolChoiceAuto ToolChoiceMode = "auto"
+	// ToolChoiceNone keeps the model from calling tools
+	ToolChoiceNone ToolChoiceMode = "none"
+	// ToolChoiceRequired makes the model call at least one tool
+	ToolChoiceRequired ToolChoiceMode = "required"
+	// ToolChoiceFunction makes the model call the function named in ToolChoice.Name
+	ToolChoiceFunction ToolChoiceMode = "function"
+)
+
+// ToolChoice tells the model how to use the tools it is given
+type ToolChoice struct {
+	Mode ToolChoiceMode `json:"mode"`
+	Name string         `json:"name,omitempty"` // Function to call with ToolChoiceFunction
+}
+
+// ForceFunction returns a ToolChoice making the model call the named function
+func ForceFunction(name string) *ToolChoice {
+	return &ToolChoice{Mode: ToolChoiceFunction, Name: name}
+}
+
+// ResolveTools returns the tools and tool choice requested by the options,
+// including those set through the deprecated Functions and FunctionCall
+// fields. Adapters should read tools through it.
+func (o *ChatOptions) ResolveTools() ([]Tool, *ToolChoice) {
+	tools := o.Tools
+	if len(o.Functions) > 0 {
+		tools = append(append([]Tool(nil), tools...), FunctionTools(o.Functions...)...)
+	}
+
+	choice := o.ToolChoice
+	if choice == nil {
+		choice = functionCallChoice(o.FunctionCall)
+	}
+	return tools, choice
+}
+
+// functionCallChoice translates the legacy function_call values
+func functionCallChoice(functionCall string) *ToolChoice {
+	switch functionCall {
+	case "":
+		return nil
+	case string(ToolChoiceAuto), string(ToolChoiceNone):
+		return &ToolChoice{Mode: ToolChoiceMode(functionCall)}
+	default:
+		return ForceFunction(functionCall)
+	}
+}
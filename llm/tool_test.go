@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChatOptions_ResolveTools(t *testing.T) {
+	weather := Function{Name: "get_weather", Parameters: map[string]any{"type": "object"}}
+	search := Function{Name: "search"}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		direct     ChatOptions
+		wantTools  []Tool
+		wantChoice *ToolChoice
+	}{
+		{
+			name:       "Tools and choice",
+			opts:       []Option{WithTools(FunctionTool(weather)), WithToolChoice(&ToolChoice{Mode: ToolChoiceRequired})},
+			wantTools:  []Tool{{Type: ToolTypeFunction, Function: &weather}},
+			wantChoice: &ToolChoice{Mode: ToolChoiceRequired},
+		},
+		{
+			name:       "Deprecated options translate",
+			opts:       []Option{WithFunctions([]Function{weather, search}), WithFunctionCall("search")},
+			wantTools:  FunctionTools(weather, search),
+			wantChoice: ForceFunction("search"),
+		},
+		{
+			name:       "Legacy none",
+			opts:       []Option{WithFunctions([]Function{weather}), WithFunctionCall("none")},
+			wantTools:  FunctionTools(weather),
+			wantChoice: &ToolChoice{Mode: ToolChoiceNone},
+		},
+		{
+			name:       "Deprecated fields set directly",
+			direct:     ChatOptions{Functions: []Function{weather}, FunctionCall: "auto"},
+			wantTools:  FunctionTools(weather),
+			wantChoice: &ToolChoice{Mode: ToolChoiceAuto},
+		},
+		{
+			name: "No tools",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.direct
+			for _, opt := range tt.opts {
+				opt(&options)
+			}
+
+			tools, choice := options.ResolveTools()
+			if !reflect.DeepEqual(tools, tt.wantTools) {
+				t.Errorf("ResolveTools() tools = %+v, want %+v", tools, tt.wantTools)
+			}
+			if !reflect.DeepEqual(choice, tt.wantChoice) {
+				t.Errorf("ResolveTools() choice = %+v, want %+v", choice, tt.wantChoice)
+			}
+		})
+	}
+}
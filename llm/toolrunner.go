@@ -0,0 +1,138 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MaxToolRounds is how many responses calling tools RunToolsStream accepts
+// before failing with ErrTooManyToolRounds
+const MaxToolRounds = 10
+
+// ErrTooManyToolRounds is wrapped by the error RunToolsStream ends with when
+// the model keeps calling tools past MaxToolRounds
+var ErrTooManyToolRounds = errors.New("too many tool rounds")
+
+// ToolFunc runs a call of a tool and returns the result reported to the model
+type ToolFunc func(ctx context.Context, call FunctionCall) (string, error)
+
+// RunToolsStream streams a chat in which the model may call tools, running
+// the calls with the matching tools and streaming the model's next response
+// until one calls none. The content and tool call fragments of every round
+// are relayed. A round calling tools ends with a response whose ToolMessage
+// is the assistant message with its calls, and ToolCalls the calls, followed
+// by one per call whose ToolMessage is the RoleTool message with its result;
+// only the last round ends with Done. CollectStream of the stream returns the
+// answer without tool calls or results. A tool's error, or a call of an
+// unknown tool, is reported to the model as the result. Tools should be
+// passed to the model in opts, e.g. with WithTools.
+func RunToolsStream(ctx context.Context, model LLM, messages []Message, tools map[string]ToolFunc, opts ...Option) (<-chan StreamResponse, error) {
+	// Canceled once the run ends, so a provider stream abandoned when the
+	// consumer goes away stops producing
+	runCtx, cancel := context.WithCancel(ctx)
+	stream, err := model.ChatStream(runCtx, messages, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	writer, out := NewRelayStreamWriter(ctx, opts...)
+
+	go func() {
+		defer writer.Close()
+		defer cancel()
+
+		conversation := slices.Clone(messages)
+		for round := 1; ; round++ {
+			final, content, ok := relayRound(stream, writer, cancel)
+			if !ok {
+				return
+			}
+			if len(final.Message.ToolCalls) == 0 {
+				writer.Send(final)
+				return
+			}
+			if round > MaxToolRounds {
+				writer.Send(StreamResponse{
+					Error: &LLMError{Op: "RunToolsStream", Message: fmt.Sprintf("model still calling tools after %d rounds", MaxToolRounds), Err: ErrTooManyToolRounds},
+					Done:  true,
+				})
+				return
+			}
+
+			// Content sent with the calls is still part of the answer
+			if final.Message.Content != "" && !writer.Send(StreamResponse{Message: Message{Content: final.Message.Content}}) {
+				return
+			}
+			call := Message{
+				Role:      RoleAssistant,
+				Content:   content,
+				ToolCalls: final.Message.ToolCalls,
+			}
+			conversation = append(conversation, call)
+			if !writer.Send(StreamResponse{ToolMessage: &call, ToolCalls: final.ToolCalls}) {
+				return
+			}
+			for _, toolCall := range call.ToolCalls {
+				result := Message{Role: RoleTool, Content: runTool(runCtx, tools, toolCall.Function), ToolCallID: toolCall.ID}
+				conversation = append(conversation, result)
+				if !writer.Send(StreamResponse{ToolMessage: &result}) {
+					return
+				}
+			}
+
+			if stream, err = model.ChatStream(runCtx, conversation, opts...); err != nil {
+				writer.Send(StreamResponse{Error: err, Done: true})
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// relayRound forwards the responses of stream up to its Done response, which
+// it returns along with the streamed content. It returns false once the
+// stream failed, after forwarding the error, or the consumer went away, after
+// canceling the stream with cancel. Either way the stream is drained, so its
+// producer can exit.
+func relayRound(stream <-chan StreamResponse, writer *StreamWriter, cancel context.CancelFunc) (StreamResponse, string, bool) {
+	var content strings.Builder
+	for resp := range stream {
+		if resp.Error != nil {
+			writer.Send(resp)
+			for range stream {
+			}
+			return resp, "", false
+		}
+		content.WriteString(resp.Message.Content)
+		if resp.Done {
+			return resp, content.String(), true
+		}
+		if !writer.Send(resp) {
+			cancel()
+			for range stream {
+			}
+			return resp, "", false
+		}
+	}
+
+	// The stream ended without a Done response
+	return StreamResponse{Message: Message{Role: RoleAssistant}, Done: true}, content.String(), true
+}
+
+// runTool runs call with its tool and returns the result for the model
+func runTool(ctx context.Context, tools map[string]ToolFunc, call FunctionCall) string {
+	tool, ok := tools[call.Name]
+	if !ok {
+		return fmt.Sprintf("Error: unknown tool %q", call.Name)
+	}
+	result, err := tool(ctx, call)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return result
+}
@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamScriptLLM streams one scripted round of responses per ChatStream call
+// and records the messages of each call
+type streamScriptLLM struct {
+	rounds [][]StreamResponse
+	calls  [][]Message
+}
+
+func (s *streamScriptLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *streamScriptLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	s.calls = append(s.calls, messages)
+	round := s.rounds[0]
+	if len(s.rounds) > 1 {
+		s.rounds = s.rounds[1:]
+	}
+	return feed(round...), nil
+}
+
+func (s *streamScriptLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+// toolRound is a round streaming content interleaved with a call of name
+func toolRound(id, name, arguments string) []StreamResponse {
+	call := ToolCall{ID: id, Type: "function", Function: FunctionCall{Name: name, Arguments: arguments}}
+	return []StreamResponse{
+		{Message: Message{Role: RoleAssistant, Content: "Let me "}},
+		{ToolCallDelta: &FunctionCallDelta{ID: id, Name: name}},
+		{Message: Message{Content: "check."}},
+		{ToolCallDelta: &FunctionCallDelta{Arguments: arguments}},
+		{
+			Message:   Message{StopReason: StopReasonToolCalls, ToolCalls: []ToolCall{call}},
+			ToolCalls: []FunctionCall{call.Function},
+			Done:      true,
+		},
+	}
+}
+
+func TestRunToolsStream(t *testing.T) {
+	model := &streamScriptLLM{rounds: [][]StreamResponse{
+		toolRound("call_1", "get_weather", `{"city":"Lima"}`),
+		{
+			{Message: Message{Role: RoleAssistant, Content: "Sunny in Lima."}},
+			{Message: Message{StopReason: StopReasonStop}, Done: true},
+		},
+	}}
+	var called FunctionCall
+	tools := map[string]ToolFunc{
+		"get_weather": func(ctx context.Context, call FunctionCall) (string, error) {
+			called = call
+			return "sunny", nil
+		},
+	}
+
+	stream, err := RunToolsStream(context.Background(), model, []Message{{Role: RoleUser, Content: "Weather in Lima?"}}, tools)
+	if err != nil {
+		t.Fatalf("RunToolsStream() error = %v", err)
+	}
+
+	var content strings.Builder
+	var name, arguments string
+	var got []StreamResponse
+	var toolMessages []*Message
+	for resp := range stream {
+		got = append(got, resp)
+		content.WriteString(resp.Message.Content)
+		if delta := resp.ToolCallDelta; delta != nil {
+			name += delta.Name
+			arguments += delta.Arguments
+		}
+		if resp.ToolMessage != nil {
+			toolMessages = append(toolMessages, resp.ToolMessage)
+		}
+	}
+
+	if name != "get_weather" || arguments != `{"city":"Lima"}` {
+		t.Errorf("tool call deltas = %q %q, want the relayed fragments", name, arguments)
+	}
+	if called.Name != "get_weather" || called.Arguments != `{"city":"Lima"}` {
+		t.Errorf("tool called with %+v", called)
+	}
+	if content.String() != "Let me check.Sunny in Lima." {
+		t.Errorf("content = %q, want both rounds without the tool result", content.String())
+	}
+
+	// The tool round is reported apart from the content
+	if len(toolMessages) != 2 {
+		t.Fatalf("tool messages = %+v, want the call and its result", toolMessages)
+	}
+	if call := toolMessages[0]; call.Role != RoleAssistant || call.Content != "Let me check." || len(call.ToolCalls) != 1 {
+		t.Errorf("call message = %+v, want the streamed content and the tool call", call)
+	}
+	if result := toolMessages[1]; result.Role != RoleTool || result.Content != "sunny" || result.ToolCallID != "call_1" {
+		t.Errorf("result message = %+v, want the result for call_1", result)
+	}
+
+	var doneCount, toolCallResponses int
+	for _, resp := range got {
+		if resp.Done {
+			doneCount++
+		}
+		if len(resp.ToolCalls) > 0 {
+			toolCallResponses++
+		}
+		if len(resp.Message.ToolCalls) > 0 || (resp.ToolMessage != nil && resp.Message.Role != "") {
+			t.Errorf("response %+v carries the tool round in its message", resp)
+		}
+	}
+	if doneCount != 1 || !got[len(got)-1].Done || got[len(got)-1].Message.StopReason != StopReasonStop {
+		t.Errorf("responses = %+v, want a single Done response ending the run", got)
+	}
+	if toolCallResponses != 1 {
+		t.Errorf("got %d responses with tool calls, want 1", toolCallResponses)
+	}
+
+	if len(model.calls) != 2 {
+		t.Fatalf("ChatStream called %d times, want 2", len(model.calls))
+	}
+	second := model.calls[1]
+	if len(second) != 3 {
+		t.Fatalf("second round messages = %+v, want the question, the call and its result", second)
+	}
+	if second[1].Role != RoleAssistant || second[1].Content != "Let me check." || len(second[1].ToolCalls) != 1 {
+		t.Errorf("assistant message = %+v, want the streamed content and the tool call", second[1])
+	}
+	if second[2].Role != RoleTool || second[2].Content != "sunny" || second[2].ToolCallID != "call_1" {
+		t.Errorf("tool message = %+v, want the result for call_1", second[2])
+	}
+}
+
+func TestRunToolsStream_Collect(t *testing.T) {
+	model := &streamScriptLLM{rounds: [][]StreamResponse{
+		toolRound("call_1", "get_weather", `{"city":"Lima"}`),
+		{
+			{Message: Message{Role: RoleAssistant, Content: "Sunny in Lima."}},
+			{Message: Message{StopReason: StopReasonStop}, Done: true},
+		},
+	}}
+	tools := map[string]ToolFunc{
+		"get_weather": func(ctx context.Context, call FunctionCall) (string, error) { return "sunny", nil },
+	}
+
+	stream, err := RunToolsStream(context.Background(), model, []Message{{Role: RoleUser, Content: "Weather in Lima?"}}, tools)
+	if err != nil {
+		t.Fatalf("RunToolsStream() error = %v", err)
+	}
+	answer, err := CollectStream(stream)
+	if err != nil {
+		t.Fatalf("CollectStream() error = %v", err)
+	}
+	if answer.Role != RoleAssistant || answer.Content != "Let me check.Sunny in Lima." || len(answer.ToolCalls) != 0 || answer.StopReason != StopReasonStop {
+		t.Errorf("collected answer = %+v, want the assistant's text without the tool round", answer)
+	}
+}
+
+// blockingLLM streams content until its context is canceled, then sends the
+// cancellation as an error before reporting on stopped that its producer
+// exited, as adapters do
+type blockingLLM struct {
+	streamScriptLLM
+	stopped chan struct{}
+}
+
+func (b *blockingLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	ch := make(chan StreamResponse)
+	go func() {
+		defer close(b.stopped)
+		defer close(ch)
+		for {
+			select {
+			case ch <- StreamResponse{Message: Message{Content: "."}}:
+			case <-ctx.Done():
+				ch <- StreamResponse{Error: ctx.Err(), Done: true}
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestRunToolsStream_AbandonedStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	model := &blockingLLM{stopped: make(chan struct{})}
+
+	stream, err := RunToolsStream(ctx, model, nil, nil)
+	if err != nil {
+		t.Fatalf("RunToolsStream() error = %v", err)
+	}
+	<-stream
+	cancel()
+
+	select {
+	case <-model.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("provider stream still producing after the consumer went away")
+	}
+}
+
+func TestRunToolsStream_ToolErrors(t *testing.T) {
+	model := &streamScriptLLM{rounds: [][]StreamResponse{
+		toolRound("call_1", "lookup", `{}`),
+		toolRound("call_2", "missing", `{}`),
+		{{Message: Message{Content: "Sorry."}, Done: true}},
+	}}
+	tools := map[string]ToolFunc{
+		"lookup": func(ctx context.Context, call FunctionCall) (string, error) {
+			return "", errors.New("database offline")
+		},
+	}
+
+	stream, err := RunToolsStream(context.Background(), model, []Message{{Role: RoleUser, Content: "Find it"}}, tools)
+	if err != nil {
+		t.Fatalf("RunToolsStream() error = %v", err)
+	}
+	if _, err := CollectStream(stream); err != nil {
+		t.Fatalf("stream error = %v, want the errors reported to the model", err)
+	}
+
+	last := model.calls[2]
+	if got := last[2].Content; got != "Error: database offline" {
+		t.Errorf("failed tool result = %q", got)
+	}
+	if got := last[4].Content; got != `Error: unknown tool "missing"` {
+		t.Errorf("unknown tool result = %q", got)
+	}
+}
+
+func TestRunToolsStream_TooManyRounds(t *testing.T) {
+	model := &streamScriptLLM{rounds: [][]StreamResponse{toolRound("call_1", "again", `{}`)}}
+	tools := map[string]ToolFunc{
+		"again": func(ctx context.Context, call FunctionCall) (string, error) { return "ok", nil },
+	}
+
+	stream, err := RunToolsStream(context.Background(), model, nil, tools)
+	if err != nil {
+		t.Fatalf("RunToolsStream() error = %v", err)
+	}
+	if _, err := CollectStream(stream); !errors.Is(err, ErrTooManyToolRounds) {
+		t.Errorf("stream error = %v, want ErrTooManyToolRounds", err)
+	}
+	if len(model.calls) != MaxToolRounds+1 {
+		t.Errorf("ChatStream called %d times, want %d", len(model.calls), MaxToolRounds+1)
+	}
+}
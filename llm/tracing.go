@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Abraxas-365/kbservice/llm"
+
+// TracingLLM wraps an LLM, recording a span for every call with token usage
+// as attributes when the provider reports it
+type TracingLLM struct {
+	llm    LLM
+	tracer trace.Tracer
+}
+
+// NewTracingLLM creates a TracingLLM that records spans with tp
+func NewTracingLLM(llm LLM, tp trace.TracerProvider) *TracingLLM {
+	return &TracingLLM{
+		llm:    llm,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+func (t *TracingLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	ctx, span := t.tracer.Start(ctx, "llm.Chat", trace.WithAttributes(
+		attribute.Int("llm.messages", len(messages)),
+	))
+	defer span.End()
+
+	message, err := t.llm.Chat(ctx, messages, opts...)
+	tracing.RecordError(span, err)
+	if message != nil {
+		setUsage(span, message.GetUsage())
+	}
+	return message, err
+}
+
+// ChatStream ends its span once the stream is done
+func (t *TracingLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	ctx, span := t.tracer.Start(ctx, "llm.ChatStream", trace.WithAttributes(
+		attribute.Int("llm.messages", len(messages)),
+	))
+
+	stream, err := t.llm.ChatStream(ctx, messages, opts...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		span.End()
+		return nil, err
+	}
+
+	writer, out := NewRelayStreamWriter(ctx, opts...)
+	go func() {
+		defer writer.Close()
+		defer span.End()
+
+		for resp := range stream {
+			if resp.Error != nil {
+				tracing.RecordError(span, resp.Error)
+			}
+			setUsage(span, resp.Message.GetUsage())
+			if !writer.Send(resp) {
+				tracing.RecordError(span, ctx.Err())
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (t *TracingLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	ctx, span := t.tracer.Start(ctx, "llm.Complete")
+	defer span.End()
+
+	completion, err := t.llm.Complete(ctx, prompt, opts...)
+	tracing.RecordError(span, err)
+	return completion, err
+}
+
+func setUsage(span trace.Span, usage *Usage) {
+	if usage == nil {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("llm.usage.prompt_tokens", usage.PromptTokens),
+		attribute.Int("llm.usage.completion_tokens", usage.CompletionTokens),
+		attribute.Int("llm.usage.total_tokens", usage.TotalTokens),
+	)
+}
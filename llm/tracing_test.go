@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stubLLM answers every call with a fixed message
+type stubLLM struct {
+	err error
+}
+
+func (s stubLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	message := &Message{Role: RoleAssistant, Content: "hi"}
+	message.SetUsage(&Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12})
+	return message, nil
+}
+
+func (s stubLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	stream := make(chan StreamResponse, 2)
+	message, _ := s.Chat(ctx, messages, opts...)
+	stream <- StreamResponse{Message: *message}
+	stream <- StreamResponse{Done: true}
+	close(stream)
+	return stream, nil
+}
+
+func (s stubLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	return "hi", s.err
+}
+
+func spanAttributes(span tracetest.SpanStub) map[string]int64 {
+	attrs := make(map[string]int64)
+	for _, attr := range span.Attributes {
+		attrs[string(attr.Key)] = attr.Value.AsInt64()
+	}
+	return attrs
+}
+
+func TestTracingLLM(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ctx := context.Background()
+
+	traced := NewTracingLLM(stubLLM{}, tp)
+	if _, err := traced.Chat(ctx, []Message{{Role: RoleUser, Content: "hello"}}); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	stream, err := traced.ChatStream(ctx, []Message{{Role: RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	for range stream {
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	for i, name := range []string{"llm.Chat", "llm.ChatStream"} {
+		if spans[i].Name != name {
+			t.Errorf("span %d = %s, want %s", i, spans[i].Name, name)
+		}
+		attrs := spanAttributes(spans[i])
+		if attrs["llm.usage.prompt_tokens"] != 10 || attrs["llm.usage.total_tokens"] != 12 {
+			t.Errorf("span %s attributes = %v, want token counts", name, attrs)
+		}
+	}
+}
+
+func TestTracingLLM_RecordsErrors(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	traced := NewTracingLLM(stubLLM{err: errors.New("boom")}, tp)
+	if _, err := traced.Chat(context.Background(), nil); err == nil {
+		t.Fatal("Chat() error = nil, want error")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Status.Code != otelcodes.Error {
+		t.Errorf("spans = %+v, want one span with error status", spans)
+	}
+}
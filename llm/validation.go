@@ -0,0 +1,289 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ResponseValidation configures how ValidatingLLM checks JSON-mode responses
+type ResponseValidation struct {
+	// MaxRetries is how many times a response that fails validation is re-requested
+	MaxRetries int
+	// ValidateSchema also checks responses against the JSONSchema of the ResponseFormat
+	ValidateSchema bool
+}
+
+// WithResponseValidation makes a ValidatingLLM check that responses to a chat
+// with a ResponseFormat parse as JSON, and match its schema when validateSchema
+// is set, re-requesting up to maxRetries times with a corrective message.
+// LLMs that aren't wrapped in a ValidatingLLM ignore it.
+func WithResponseValidation(maxRetries int, validateSchema bool) Option {
+	return func(o *ChatOptions) {
+		o.ResponseValidation = &ResponseValidation{
+			MaxRetries:     maxRetries,
+			ValidateSchema: validateSchema,
+		}
+	}
+}
+
+// ErrInvalidResponse is matched by ValidationError with errors.Is
+var ErrInvalidResponse = errors.New("response does not match the requested format")
+
+// ValidationError is returned when a response doesn't match its ResponseFormat
+type ValidationError struct {
+	Content string // The rejected response
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrInvalidResponse, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidResponse
+}
+
+// ValidateResponse checks that content is valid JSON for format and, when
+// validateSchema is set, that it matches format's JSONSchema. The supported
+// schema keywords are type, enum, properties, required, additionalProperties
+// and items. Without a format any content is valid.
+func ValidateResponse(content string, format *ResponseFormat, validateSchema bool) error {
+	if format == nil {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return &ValidationError{Content: content, Err: fmt.Errorf("invalid JSON: %w", err)}
+	}
+	if format.Type == JSONObject {
+		if _, ok := value.(map[string]any); !ok {
+			return &ValidationError{Content: content, Err: errors.New("expected a JSON object")}
+		}
+	}
+
+	if !validateSchema || format.Type != JSONSchema || format.JSONSchema == nil {
+		return nil
+	}
+	schema, err := schemaMap(format.JSONSchema)
+	if err != nil {
+		return fmt.Errorf("reading response schema: %w", err)
+	}
+	if err := validateValue(value, schema, "$"); err != nil {
+		return &ValidationError{Content: content, Err: err}
+	}
+	return nil
+}
+
+// ValidatingLLM wraps an LLM, re-requesting chat responses that fail
+// WithResponseValidation. Streams and completions are passed through.
+type ValidatingLLM struct {
+	llm LLM
+}
+
+// NewValidatingLLM creates a ValidatingLLM
+func NewValidatingLLM(llm LLM) *ValidatingLLM {
+	return &ValidatingLLM{llm: llm}
+}
+
+func (v *ValidatingLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	options := &ChatOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	validation := options.ResponseValidation
+	if validation == nil || options.ResponseFormat == nil {
+		return v.llm.Chat(ctx, messages, opts...)
+	}
+
+	// Copy so the corrections don't leak into the caller's messages
+	attempt := append([]Message(nil), messages...)
+	var lastErr error
+	for i := 0; i <= validation.MaxRetries; i++ {
+		message, err := v.llm.Chat(ctx, attempt, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		lastErr = ValidateResponse(message.Content, options.ResponseFormat, validation.ValidateSchema)
+		if lastErr == nil {
+			return message, nil
+		}
+		if !errors.Is(lastErr, ErrInvalidResponse) {
+			// The schema itself is unusable; retrying can't help
+			return nil, &LLMError{Op: "Chat", Message: "response validation failed", Err: lastErr}
+		}
+
+		attempt = append(attempt, *message, Message{
+			Role:    RoleUser,
+			Content: correctionPrompt(lastErr),
+		})
+	}
+
+	return nil, &LLMError{
+		Op:      "Chat",
+		Message: fmt.Sprintf("response invalid after %d attempts", validation.MaxRetries+1),
+		Err:     lastErr,
+	}
+}
+
+func (v *ValidatingLLM) ChatStream(ctx context.Context, messages []Message, opts ...Option) (<-chan StreamResponse, error) {
+	return v.llm.ChatStream(ctx, messages, opts...)
+}
+
+func (v *ValidatingLLM) Complete(ctx context.Context, prompt string, opts ...Option) (string, error) {
+	return v.llm.Complete(ctx, prompt, opts...)
+}
+
+func correctionPrompt(err error) string {
+	var validationErr *ValidationError
+	reason := err.Error()
+	if errors.As(err, &validationErr) {
+		reason = validationErr.Err.Error()
+	}
+	return fmt.Sprintf("Your previous response was rejected: %s. Reply again with only valid JSON in the requested format, without any other text.", reason)
+}
+
+// schemaMap normalizes a schema, which may be a map, a struct or a json.Marshaler
+func schemaMap(schema any) (map[string]any, error) {
+	if m, ok := schema.(map[string]any); ok {
+		return m, nil
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func validateValue(value any, schema map[string]any, path string) error {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateObject(v, schema, path)
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		for i, item := range v {
+			if err := validateValue(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateObject(object map[string]any, schema map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, ok := object[key]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertySchema, ok := properties[key].(map[string]any)
+		if !ok {
+			if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				return fmt.Errorf("%s: unexpected property %q", path, key)
+			}
+			continue
+		}
+		if err := validateValue(object[key], propertySchema, path+"."+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(value any, t string) bool {
+	if t == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return jsonType(value) == t
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
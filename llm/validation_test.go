@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedLLM answers chats with its replies in turn, recording what it was sent
+type scriptedLLM struct {
+	stubLLM
+	replies []string
+	calls   [][]Message
+}
+
+func (s *scriptedLLM) Chat(ctx context.Context, messages []Message, opts ...Option) (*Message, error) {
+	s.calls = append(s.calls, messages)
+	reply := s.replies[0]
+	if len(s.replies) > 1 {
+		s.replies = s.replies[1:]
+	}
+	return &Message{Role: RoleAssistant, Content: reply}, nil
+}
+
+func TestValidatingLLM_RetriesInvalidJSON(t *testing.T) {
+	stub := &scriptedLLM{replies: []string{`{"name": "Ada"`, `{"name": "Ada"}`}}
+	v := NewValidatingLLM(stub)
+	messages := []Message{{Role: RoleUser, Content: "Who wrote the first program?"}}
+
+	message, err := v.Chat(context.Background(), messages, WithJSONObjectFormat(), WithResponseValidation(2, false))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if message.Content != `{"name": "Ada"}` {
+		t.Errorf("Content = %q", message.Content)
+	}
+	if len(stub.calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(stub.calls))
+	}
+
+	retry := stub.calls[1]
+	if len(retry) != 3 {
+		t.Fatalf("retry sent %d messages, want 3", len(retry))
+	}
+	if retry[1].Role != RoleAssistant || retry[1].Content != `{"name": "Ada"` {
+		t.Errorf("retry[1] = %+v, want the rejected response", retry[1])
+	}
+	if retry[2].Role != RoleUser || !strings.Contains(retry[2].Content, "invalid JSON") {
+		t.Errorf("retry[2] = %+v, want a correction", retry[2])
+	}
+	if len(messages) != 1 {
+		t.Errorf("caller's messages were modified: %+v", messages)
+	}
+}
+
+func TestValidatingLLM_GivesUp(t *testing.T) {
+	stub := &scriptedLLM{replies: []string{"not json"}}
+	v := NewValidatingLLM(stub)
+
+	_, err := v.Chat(context.Background(), nil, WithJSONObjectFormat(), WithResponseValidation(1, false))
+	if !errors.Is(err, ErrInvalidResponse) {
+		t.Fatalf("Chat() error = %v, want ErrInvalidResponse", err)
+	}
+	var llmErr *LLMError
+	if !errors.As(err, &llmErr) {
+		t.Errorf("Chat() error = %T, want *LLMError", err)
+	}
+	if len(stub.calls) != 2 {
+		t.Errorf("calls = %d, want 2", len(stub.calls))
+	}
+}
+
+func TestValidatingLLM_PassesThroughWithoutValidation(t *testing.T) {
+	stub := &scriptedLLM{replies: []string{"not json"}}
+	v := NewValidatingLLM(stub)
+
+	for name, opts := range map[string][]Option{
+		"no validation": {WithJSONObjectFormat()},
+		"no format":     {WithResponseValidation(3, false)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stub.calls = nil
+			if _, err := v.Chat(context.Background(), nil, opts...); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if len(stub.calls) != 1 {
+				t.Errorf("calls = %d, want 1", len(stub.calls))
+			}
+		})
+	}
+}
+
+func TestValidatingLLM_Schema(t *testing.T) {
+	schema := JSONSchemaMarshaler{Schema: map[string]any{
+		"type":     "object",
+		"required": []string{"name", "age"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"age":  map[string]any{"type": "integer"},
+		},
+	}}
+	stub := &scriptedLLM{replies: []string{`{"name": "Ada"}`, `{"name": "Ada", "age": 36}`}}
+	v := NewValidatingLLM(stub)
+
+	message, err := v.Chat(context.Background(), nil, WithJSONSchemaFormat(schema), WithResponseValidation(1, true))
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if message.Content != `{"name": "Ada", "age": 36}` {
+		t.Errorf("Content = %q", message.Content)
+	}
+	if !strings.Contains(stub.calls[1][1].Content, `missing required property "age"`) {
+		t.Errorf("correction = %q", stub.calls[1][1].Content)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties": map[string]any{
+			"tags":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"status": map[string]any{"enum": []any{"open", "closed"}},
+			"score":  map[string]any{"type": []any{"number", "null"}},
+		},
+	}
+	format := &ResponseFormat{Type: JSONSchema, JSONSchema: schema}
+
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"tags": ["a"], "status": "open", "score": null}`, ""},
+		{`{"tags": ["a", 1]}`, "$.tags[1]: expected string, got number"},
+		{`{"status": "pending"}`, "$.status: value is not one of the allowed values"},
+		{`{"score": "high"}`, "$.score: expected number or null, got string"},
+		{`{"extra": true}`, `$: unexpected property "extra"`},
+		{`[]`, "$: expected object, got array"},
+	}
+	for _, tt := range tests {
+		err := ValidateResponse(tt.content, format, true)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("ValidateResponse(%s) error = %v", tt.content, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ValidateResponse(%s) error = %v, want %q", tt.content, err, tt.wantErr)
+		}
+	}
+
+	if err := ValidateResponse(`{"extra": true}`, format, false); err != nil {
+		t.Errorf("ValidateResponse() without schema validation error = %v", err)
+	}
+	if err := ValidateResponse(`[1]`, &ResponseFormat{Type: JSONObject}, false); err == nil {
+		t.Error("ValidateResponse() accepted an array in JSON object mode")
+	}
+}
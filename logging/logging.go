@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Redactor rewrites message content before it is logged, e.g. to strip user data
+type Redactor func(content string) string
+
+// RedactContent is a Redactor that replaces content with its length
+func RedactContent(content string) string {
+	return fmt.Sprintf("[redacted %d bytes]", len(content))
+}
+
+// Redact applies redactor to content, returning content unchanged if redactor is nil
+func Redact(redactor Redactor, content string) string {
+	if redactor == nil {
+		return content
+	}
+	return redactor(content)
+}
+
+// Discard returns a logger that drops every record
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
+
+// TraceIDAttr is the attribute WithTraceID logs trace IDs under
+const TraceIDAttr = "trace_id"
+
+// TraceID returns the trace ID stored in ctx under key, or "" if there is none.
+// The value may be a string or a fmt.Stringer.
+func TraceID(ctx context.Context, key any) string {
+	if ctx == nil || key == nil {
+		return ""
+	}
+	switch id := ctx.Value(key).(type) {
+	case string:
+		return id
+	case fmt.Stringer:
+		return id.String()
+	}
+	return ""
+}
+
+// WithTraceID returns a logger that adds the trace ID found under key in the
+// context of each record, for use with the *Context logging methods
+func WithTraceID(logger *slog.Logger, key any) *slog.Logger {
+	return slog.New(traceHandler{handler: logger.Handler(), key: key})
+}
+
+type traceHandler struct {
+	handler slog.Handler
+	key     any
+}
+
+func (h traceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := TraceID(ctx, h.key); id != "" {
+		r = r.Clone()
+		r.AddAttrs(slog.String(TraceIDAttr, id))
+	}
+	return h.handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{handler: h.handler.WithAttrs(attrs), key: h.key}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{handler: h.handler.WithGroup(name), key: h.key}
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Observation is a single value recorded by InMemoryRecorder
+type Observation struct {
+	Type   Type
+	Name   string
+	Value  float64
+	Labels Labels
+}
+
+// InMemoryRecorder keeps every observation in memory, mainly for tests
+type InMemoryRecorder struct {
+	mu           sync.Mutex
+	observations []Observation
+}
+
+// NewInMemoryRecorder creates a new in-memory recorder
+func NewInMemoryRecorder() *InMemoryRecorder {
+	return &InMemoryRecorder{}
+}
+
+func (r *InMemoryRecorder) Counter(name string, value float64, labels Labels) {
+	r.record(TypeCounter, name, value, labels)
+}
+
+func (r *InMemoryRecorder) Histogram(name string, value float64, labels Labels) {
+	r.record(TypeHistogram, name, value, labels)
+}
+
+func (r *InMemoryRecorder) Gauge(name string, value float64, labels Labels) {
+	r.record(TypeGauge, name, value, labels)
+}
+
+func (r *InMemoryRecorder) record(t Type, name string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.observations = append(r.observations, Observation{Type: t, Name: name, Value: value, Labels: labels})
+}
+
+// Observations returns the observations recorded under name
+func (r *InMemoryRecorder) Observations(name string) []Observation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var observations []Observation
+	for _, o := range r.observations {
+		if o.Name == name {
+			observations = append(observations, o)
+		}
+	}
+	return observations
+}
+
+// Sum adds up the values recorded under name whose labels include match
+func (r *InMemoryRecorder) Sum(name string, match Labels) float64 {
+	sum := 0.0
+	for _, o := range r.Observations(name) {
+		if matches(o.Labels, match) {
+			sum += o.Value
+		}
+	}
+	return sum
+}
+
+func matches(labels, match Labels) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats labels as sorted key=value pairs
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
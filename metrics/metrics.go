@@ -0,0 +1,91 @@
+package metrics
+
+// Labels are the label values of a single observation
+type Labels map[string]string
+
+// Recorder receives metric observations. Implementations must be safe for concurrent use.
+type Recorder interface {
+	// Counter adds value to a counter
+	Counter(name string, value float64, labels Labels)
+	// Histogram records value in a histogram
+	Histogram(name string, value float64, labels Labels)
+	// Gauge sets a gauge to value
+	Gauge(name string, value float64, labels Labels)
+}
+
+// Type is the kind of a metric
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeHistogram Type = "histogram"
+	TypeGauge     Type = "gauge"
+)
+
+// Status label values
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Metric names emitted by the library. Names and label sets are stable.
+const (
+	// LLMRequests counts LLM calls. Labels: provider, model, operation, status
+	LLMRequests = "kbservice_llm_requests_total"
+	// LLMLatency is the LLM call duration in seconds. Labels: provider, model, operation, status
+	LLMLatency = "kbservice_llm_latency_seconds"
+	// LLMTokens counts tokens reported by the provider. Labels: provider, model, type (prompt or completion)
+	LLMTokens = "kbservice_llm_tokens_total"
+
+	// EmbeddingRequests counts embedding calls. Labels: provider, model, operation, status
+	EmbeddingRequests = "kbservice_embedding_requests_total"
+	// EmbeddingLatency is the embedding call duration in seconds. Labels: provider, model, operation, status
+	EmbeddingLatency = "kbservice_embedding_latency_seconds"
+	// EmbeddingBatchSize is the number of texts per embedding call. Labels: provider, model, operation
+	EmbeddingBatchSize = "kbservice_embedding_batch_size"
+
+	// VectorStoreLatency is the vector store call duration in seconds. Labels: store, operation, status
+	VectorStoreLatency = "kbservice_vectorstore_latency_seconds"
+
+	// SyncDocuments counts documents seen by kb.Sync. Labels: status (indexed, skipped, duplicate, empty or error)
+	SyncDocuments = "kbservice_sync_documents_total"
+	// SyncInProgress is the number of running kb.Sync calls. No labels.
+	SyncInProgress = "kbservice_sync_in_progress"
+)
+
+// Definition describes a metric emitted by the library
+type Definition struct {
+	Name   string
+	Help   string
+	Type   Type
+	Labels []string
+}
+
+// Definitions lists every metric the library emits, for recorders that have to
+// register metrics up front
+var Definitions = []Definition{
+	{Name: LLMRequests, Help: "Number of LLM calls.", Type: TypeCounter, Labels: []string{"provider", "model", "operation", "status"}},
+	{Name: LLMLatency, Help: "LLM call duration in seconds.", Type: TypeHistogram, Labels: []string{"provider", "model", "operation", "status"}},
+	{Name: LLMTokens, Help: "Tokens reported by the LLM provider.", Type: TypeCounter, Labels: []string{"provider", "model", "type"}},
+	{Name: EmbeddingRequests, Help: "Number of embedding calls.", Type: TypeCounter, Labels: []string{"provider", "model", "operation", "status"}},
+	{Name: EmbeddingLatency, Help: "Embedding call duration in seconds.", Type: TypeHistogram, Labels: []string{"provider", "model", "operation", "status"}},
+	{Name: EmbeddingBatchSize, Help: "Number of texts per embedding call.", Type: TypeHistogram, Labels: []string{"provider", "model", "operation"}},
+	{Name: VectorStoreLatency, Help: "Vector store call duration in seconds.", Type: TypeHistogram, Labels: []string{"store", "operation", "status"}},
+	{Name: SyncDocuments, Help: "Documents seen by knowledge base syncs.", Type: TypeCounter, Labels: []string{"status"}},
+	{Name: SyncInProgress, Help: "Number of running knowledge base syncs.", Type: TypeGauge, Labels: []string{}},
+}
+
+// Status returns the status label value for err
+func Status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
+
+// NopRecorder discards every observation
+type NopRecorder struct{}
+
+func (NopRecorder) Counter(name string, value float64, labels Labels)   {}
+func (NopRecorder) Histogram(name string, value float64, labels Labels) {}
+func (NopRecorder) Gauge(name string, value float64, labels Labels)     {}
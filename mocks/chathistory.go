@@ -0,0 +1,341 @@
+package mocks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+var _ chathistory.ChatHistoryRepository = (*ChatHistoryRepository)(nil)
+
+// ChatHistoryRepository is a programmable chathistory.ChatHistoryRepository.
+// By default it keeps conversations in memory and matches filters on roles,
+// time range, search text and metadata.
+type ChatHistoryRepository struct {
+	Recorder
+
+	AddMessageFunc                 func(ctx context.Context, conversationID string, message llm.Message) error
+	GetMessagesFunc                func(ctx context.Context, conversationID string, limit int) ([]llm.Message, error)
+	GetMessagesByFilterFunc        func(ctx context.Context, conversationID string, filter chathistory.Filter, limit int) ([]llm.Message, error)
+	DeleteMessagesFunc             func(ctx context.Context, conversationID string, filter chathistory.Filter) error
+	ClearHistoryFunc               func(ctx context.Context, conversationID string) error
+	DeleteConversationFunc         func(ctx context.Context, conversationID string) error
+	CreateConversationFunc         func(ctx context.Context, conv chathistory.Conversation) error
+	GetConversationFunc            func(ctx context.Context, conversationID string) (*chathistory.Conversation, error)
+	ListConversationsFunc          func(ctx context.Context, filter chathistory.Filter, limit, offset int) ([]chathistory.Conversation, error)
+	UpdateConversationMetadataFunc func(ctx context.Context, conversationID string, metadata map[string]any) error
+	GetMessageCountFunc            func(ctx context.Context, conversationID string, filter chathistory.Filter) (int, error)
+
+	mu            sync.Mutex
+	conversations map[string]chathistory.Conversation
+}
+
+// NewChatHistoryRepository returns an empty ChatHistoryRepository
+func NewChatHistoryRepository() *ChatHistoryRepository {
+	return &ChatHistoryRepository{}
+}
+
+func (r *ChatHistoryRepository) AddMessage(ctx context.Context, conversationID string, message llm.Message) error {
+	if err := r.begin(ctx, "AddMessage", conversationID, message); err != nil {
+		return err
+	}
+	if r.AddMessageFunc != nil {
+		return r.AddMessageFunc(ctx, conversationID, message)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return err
+	}
+	conv.UpdatedAt = time.Now()
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = conv.UpdatedAt
+	}
+	conv.Messages = append(conv.Messages, message)
+	r.conversations[conversationID] = conv
+	return nil
+}
+
+func (r *ChatHistoryRepository) GetMessages(ctx context.Context, conversationID string, limit int) ([]llm.Message, error) {
+	if err := r.begin(ctx, "GetMessages", conversationID, limit); err != nil {
+		return nil, err
+	}
+	if r.GetMessagesFunc != nil {
+		return r.GetMessagesFunc(ctx, conversationID, limit)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return lastMessages(conv.Messages, limit), nil
+}
+
+func (r *ChatHistoryRepository) GetMessagesByFilter(ctx context.Context, conversationID string, filter chathistory.Filter, limit int) ([]llm.Message, error) {
+	if err := r.begin(ctx, "GetMessagesByFilter", conversationID, filter, limit); err != nil {
+		return nil, err
+	}
+	if r.GetMessagesByFilterFunc != nil {
+		return r.GetMessagesByFilterFunc(ctx, conversationID, filter, limit)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []llm.Message
+	for _, msg := range conv.Messages {
+		if messageMatches(msg, filter) {
+			filtered = append(filtered, msg)
+		}
+	}
+	return lastMessages(filtered, limit), nil
+}
+
+func (r *ChatHistoryRepository) DeleteMessages(ctx context.Context, conversationID string, filter chathistory.Filter) error {
+	if err := r.begin(ctx, "DeleteMessages", conversationID, filter); err != nil {
+		return err
+	}
+	if r.DeleteMessagesFunc != nil {
+		return r.DeleteMessagesFunc(ctx, conversationID, filter)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return err
+	}
+	var remaining []llm.Message
+	for _, msg := range conv.Messages {
+		if !messageMatches(msg, filter) {
+			remaining = append(remaining, msg)
+		}
+	}
+	conv.Messages = remaining
+	conv.UpdatedAt = time.Now()
+	r.conversations[conversationID] = conv
+	return nil
+}
+
+func (r *ChatHistoryRepository) ClearHistory(ctx context.Context, conversationID string) error {
+	if err := r.begin(ctx, "ClearHistory", conversationID); err != nil {
+		return err
+	}
+	if r.ClearHistoryFunc != nil {
+		return r.ClearHistoryFunc(ctx, conversationID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return err
+	}
+	conv.Messages = []llm.Message{}
+	conv.UpdatedAt = time.Now()
+	r.conversations[conversationID] = conv
+	return nil
+}
+
+func (r *ChatHistoryRepository) DeleteConversation(ctx context.Context, conversationID string) error {
+	if err := r.begin(ctx, "DeleteConversation", conversationID); err != nil {
+		return err
+	}
+	if r.DeleteConversationFunc != nil {
+		return r.DeleteConversationFunc(ctx, conversationID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.conversation(conversationID); err != nil {
+		return err
+	}
+	delete(r.conversations, conversationID)
+	return nil
+}
+
+func (r *ChatHistoryRepository) CreateConversation(ctx context.Context, conv chathistory.Conversation) error {
+	if err := r.begin(ctx, "CreateConversation", conv); err != nil {
+		return err
+	}
+	if r.CreateConversationFunc != nil {
+		return r.CreateConversationFunc(ctx, conv)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.conversations[conv.ID]; exists {
+		return fmt.Errorf("conversation already exists: %s", conv.ID)
+	}
+	if r.conversations == nil {
+		r.conversations = make(map[string]chathistory.Conversation)
+	}
+	r.conversations[conv.ID] = conv
+	return nil
+}
+
+func (r *ChatHistoryRepository) GetConversation(ctx context.Context, conversationID string) (*chathistory.Conversation, error) {
+	if err := r.begin(ctx, "GetConversation", conversationID); err != nil {
+		return nil, err
+	}
+	if r.GetConversationFunc != nil {
+		return r.GetConversationFunc(ctx, conversationID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (r *ChatHistoryRepository) ListConversations(ctx context.Context, filter chathistory.Filter, limit, offset int) ([]chathistory.Conversation, error) {
+	if err := r.begin(ctx, "ListConversations", filter, limit, offset); err != nil {
+		return nil, err
+	}
+	if r.ListConversationsFunc != nil {
+		return r.ListConversationsFunc(ctx, filter, limit, offset)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var conversations []chathistory.Conversation
+	for _, conv := range r.conversations {
+		if inTimeRange(conv.CreatedAt, filter) && metadataMatches(conv.Metadata, filter.Metadata) {
+			conversations = append(conversations, conv)
+		}
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].UpdatedAt.After(conversations[j].UpdatedAt)
+	})
+
+	if offset >= len(conversations) {
+		return []chathistory.Conversation{}, nil
+	}
+	end := offset + limit
+	if end > len(conversations) {
+		end = len(conversations)
+	}
+	return conversations[offset:end], nil
+}
+
+func (r *ChatHistoryRepository) UpdateConversationMetadata(ctx context.Context, conversationID string, metadata map[string]any) error {
+	if err := r.begin(ctx, "UpdateConversationMetadata", conversationID, metadata); err != nil {
+		return err
+	}
+	if r.UpdateConversationMetadataFunc != nil {
+		return r.UpdateConversationMetadataFunc(ctx, conversationID, metadata)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return err
+	}
+	conv.Metadata = metadata
+	conv.UpdatedAt = time.Now()
+	r.conversations[conversationID] = conv
+	return nil
+}
+
+func (r *ChatHistoryRepository) GetMessageCount(ctx context.Context, conversationID string, filter chathistory.Filter) (int, error) {
+	if err := r.begin(ctx, "GetMessageCount", conversationID, filter); err != nil {
+		return 0, err
+	}
+	if r.GetMessageCountFunc != nil {
+		return r.GetMessageCountFunc(ctx, conversationID, filter)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conv, err := r.conversation(conversationID)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, msg := range conv.Messages {
+		if messageMatches(msg, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// conversation returns the stored conversation, or ErrConversationNotFound.
+// The caller holds r.mu.
+func (r *ChatHistoryRepository) conversation(conversationID string) (chathistory.Conversation, error) {
+	conv, exists := r.conversations[conversationID]
+	if !exists {
+		return chathistory.Conversation{}, fmt.Errorf("%w: %s", chathistory.ErrConversationNotFound, conversationID)
+	}
+	return conv, nil
+}
+
+// lastMessages returns the newest limit messages, or all of them when limit
+// is not positive
+func lastMessages(messages []llm.Message, limit int) []llm.Message {
+	if limit <= 0 || limit > len(messages) {
+		return messages
+	}
+	return messages[len(messages)-limit:]
+}
+
+// messageMatches reports whether msg passes the roles, time range, search and
+// metadata of filter
+func messageMatches(msg llm.Message, filter chathistory.Filter) bool {
+	if !inTimeRange(msg.CreatedAt, filter) {
+		return false
+	}
+	if len(filter.Roles) > 0 {
+		roleMatch := false
+		for _, role := range filter.Roles {
+			if msg.Role == role {
+				roleMatch = true
+				break
+			}
+		}
+		if !roleMatch {
+			return false
+		}
+	}
+	if filter.Search != "" && !strings.Contains(strings.ToLower(msg.Content), strings.ToLower(filter.Search)) {
+		return false
+	}
+	return metadataMatches(msg.Metadata, filter.Metadata)
+}
+
+// inTimeRange reports whether t falls within the time range of filter
+func inTimeRange(t time.Time, filter chathistory.Filter) bool {
+	if filter.StartTime != nil && t.Before(*filter.StartTime) {
+		return false
+	}
+	return filter.EndTime == nil || !t.After(*filter.EndTime)
+}
+
+// metadataMatches reports whether metadata holds every key of want with a
+// deeply equal value
+func metadataMatches(metadata, want map[string]any) bool {
+	for k, v := range want {
+		if value, exists := metadata[k]; !exists || !reflect.DeepEqual(value, v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/datasource"
+)
+
+var _ datasource.DataSource = (*DataSource)(nil)
+
+// DataSource is a programmable datasource.DataSource serving Documents. An error
+// injected for "Stream" is sent on the error channel before the document channel
+// is closed; one injected for "StreamDocument" ends the stream at that document.
+type DataSource struct {
+	Recorder
+
+	Documents []datasource.Document
+
+	LoadFunc   func(ctx context.Context, opts ...datasource.Option) ([]datasource.Document, error)
+	StreamFunc func(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error)
+}
+
+// NewDataSource returns a DataSource serving docs
+func NewDataSource(docs ...datasource.Document) *DataSource {
+	return &DataSource{Documents: docs}
+}
+
+func (s *DataSource) Load(ctx context.Context, opts ...datasource.Option) ([]datasource.Document, error) {
+	if err := s.begin(ctx, "Load", opts); err != nil {
+		return nil, err
+	}
+	if s.LoadFunc != nil {
+		return s.LoadFunc(ctx, opts...)
+	}
+	return s.documents(opts), nil
+}
+
+func (s *DataSource) Stream(ctx context.Context, opts ...datasource.Option) (<-chan datasource.Document, <-chan error) {
+	if s.StreamFunc != nil {
+		if err := s.begin(ctx, "Stream", opts); err != nil {
+			return s.stream(ctx, nil, err)
+		}
+		return s.StreamFunc(ctx, opts...)
+	}
+	return s.stream(ctx, opts, s.begin(ctx, "Stream", opts))
+}
+
+// stream serves the documents, or only err when it isn't nil
+func (s *DataSource) stream(ctx context.Context, opts []datasource.Option, err error) (<-chan datasource.Document, <-chan error) {
+	docChan := make(chan datasource.Document)
+	// Unbuffered so the consumer sees the error before the closed document channel
+	errChan := make(chan error)
+
+	go func() {
+		defer close(docChan)
+
+		fail := func(err error) {
+			select {
+			case errChan <- err:
+			case <-ctx.Done():
+			}
+		}
+
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for _, doc := range s.documents(opts) {
+			if err := s.begin(ctx, "StreamDocument", doc); err != nil {
+				fail(err)
+				return
+			}
+			select {
+			case docChan <- doc:
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// documents returns copies of Documents with the load options applied, so
+// callers can modify their metadata
+func (s *DataSource) documents(opts []datasource.Option) []datasource.Document {
+	options := &datasource.LoadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	docs := make([]datasource.Document, 0, len(s.Documents))
+	for _, doc := range s.Documents {
+		if options.MaxItems > 0 && len(docs) >= options.MaxItems {
+			break
+		}
+		metadata := make(map[string]interface{}, len(doc.Metadata))
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		options.ApplyStaticMetadata(metadata)
+		if options.Filter != nil && !options.Filter(metadata) {
+			continue
+		}
+		doc.Metadata = metadata
+		docs = append(docs, doc)
+	}
+	return docs
+}
@@ -0,0 +1,210 @@
+package mocks
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/storage"
+)
+
+var _ storage.DataStore = (*DataStore)(nil)
+
+// DataStore is a programmable storage.DataStore. By default it keeps objects
+// in memory and reports presigned URLs as unsupported.
+type DataStore struct {
+	Recorder
+
+	PutFunc                func(ctx context.Context, key string, data io.Reader, options ...storage.PutOption) error
+	GetFunc                func(ctx context.Context, key string) (io.ReadCloser, error)
+	DeleteFunc             func(ctx context.Context, key string) error
+	DeleteManyFunc         func(ctx context.Context, keys []string) error
+	DeletePrefixFunc       func(ctx context.Context, prefix string) (int, error)
+	ListFunc               func(ctx context.Context, prefix string) ([]storage.ObjectInfo, error)
+	ExistsFunc             func(ctx context.Context, key string) (bool, error)
+	GetPresignedPutURLFunc func(ctx context.Context, key string, expires time.Duration, options ...storage.PresignedPutOption) (storage.PresignedURL, error)
+	GetPresignedGetURLFunc func(ctx context.Context, key string, expires time.Duration) (storage.PresignedURL, error)
+
+	mu      sync.Mutex
+	objects map[string]dataObject
+}
+
+// dataObject is an object held by the default behaviour
+type dataObject struct {
+	data []byte
+	info storage.ObjectInfo
+}
+
+// NewDataStore returns an empty DataStore
+func NewDataStore() *DataStore {
+	return &DataStore{}
+}
+
+func (s *DataStore) Put(ctx context.Context, key string, data io.Reader, options ...storage.PutOption) error {
+	if err := s.begin(ctx, "Put", key, options); err != nil {
+		return err
+	}
+	if s.PutFunc != nil {
+		return s.PutFunc(ctx, key, data, options...)
+	}
+
+	opts := &storage.PutOptions{}
+	for _, opt := range options {
+		opt(opts)
+	}
+	data, err := opts.ResolveContentType(key, data)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return storage.NewStorageError("Put", key, err, storage.ErrCodeInternal, "failed to read data")
+	}
+	if err := opts.VerifyChecksums("Put", key, bytes.NewReader(content)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.objects == nil {
+		s.objects = make(map[string]dataObject)
+	}
+	s.objects[key] = dataObject{
+		data: content,
+		info: storage.ObjectInfo{
+			Key:          key,
+			Size:         int64(len(content)),
+			LastModified: time.Now(),
+			ContentType:  opts.ContentType,
+			Metadata:     opts.Metadata,
+		},
+	}
+	return nil
+}
+
+func (s *DataStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := s.begin(ctx, "Get", key); err != nil {
+		return nil, err
+	}
+	if s.GetFunc != nil {
+		return s.GetFunc(ctx, key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, exists := s.objects[key]
+	if !exists {
+		return nil, storage.NewStorageError("Get", key, nil, storage.ErrCodeNotFound, "object not found")
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (s *DataStore) Delete(ctx context.Context, key string) error {
+	if err := s.begin(ctx, "Delete", key); err != nil {
+		return err
+	}
+	if s.DeleteFunc != nil {
+		return s.DeleteFunc(ctx, key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *DataStore) DeleteMany(ctx context.Context, keys []string) error {
+	if err := s.begin(ctx, "DeleteMany", keys); err != nil {
+		return err
+	}
+	if s.DeleteManyFunc != nil {
+		return s.DeleteManyFunc(ctx, keys)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.objects, key)
+	}
+	return nil
+}
+
+func (s *DataStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if err := s.begin(ctx, "DeletePrefix", prefix); err != nil {
+		return 0, err
+	}
+	if s.DeletePrefixFunc != nil {
+		return s.DeletePrefixFunc(ctx, prefix)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.objects, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *DataStore) List(ctx context.Context, prefix string) ([]storage.ObjectInfo, error) {
+	if err := s.begin(ctx, "List", prefix); err != nil {
+		return nil, err
+	}
+	if s.ListFunc != nil {
+		return s.ListFunc(ctx, prefix)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []storage.ObjectInfo
+	for key, obj := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (s *DataStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := s.begin(ctx, "Exists", key); err != nil {
+		return false, err
+	}
+	if s.ExistsFunc != nil {
+		return s.ExistsFunc(ctx, key)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, exists := s.objects[key]
+	return exists, nil
+}
+
+func (s *DataStore) GetPresignedPutURL(ctx context.Context, key string, expires time.Duration, options ...storage.PresignedPutOption) (storage.PresignedURL, error) {
+	if err := s.begin(ctx, "GetPresignedPutURL", key, expires, options); err != nil {
+		return storage.PresignedURL{}, err
+	}
+	if s.GetPresignedPutURLFunc != nil {
+		return s.GetPresignedPutURLFunc(ctx, key, expires, options...)
+	}
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedPutURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the mock store")
+}
+
+func (s *DataStore) GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (storage.PresignedURL, error) {
+	if err := s.begin(ctx, "GetPresignedGetURL", key, expires); err != nil {
+		return storage.PresignedURL{}, err
+	}
+	if s.GetPresignedGetURLFunc != nil {
+		return s.GetPresignedGetURLFunc(ctx, key, expires)
+	}
+	return storage.PresignedURL{}, storage.NewStorageError("GetPresignedGetURL", key, nil, storage.ErrCodeUnsupported, "presigned URLs are not supported by the mock store")
+}
@@ -0,0 +1,88 @@
+package mocks
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+)
+
+var _ embedding.Embedder = (*Embedder)(nil)
+
+// DefaultDimension is the vector size of mocks that aren't given one
+const DefaultDimension = 8
+
+// Embedder is a programmable embedding.Embedder. By default it returns
+// HashVector embeddings, so texts sharing words get similar vectors.
+type Embedder struct {
+	Recorder
+
+	// Dimension is the size of default vectors (DefaultDimension when 0)
+	Dimension int
+
+	EmbedDocumentsFunc func(ctx context.Context, documents []string) ([][]float32, error)
+	EmbedQueryFunc     func(ctx context.Context, text string) ([]float32, error)
+}
+
+// NewEmbedder returns an Embedder producing vectors of the given dimension
+func NewEmbedder(dimension int) *Embedder {
+	return &Embedder{Dimension: dimension}
+}
+
+func (e *Embedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	if err := e.begin(ctx, "EmbedDocuments", documents); err != nil {
+		return nil, err
+	}
+	if e.EmbedDocumentsFunc != nil {
+		return e.EmbedDocumentsFunc(ctx, documents)
+	}
+
+	vectors := make([][]float32, len(documents))
+	for i, doc := range documents {
+		vectors[i] = HashVector(doc, e.dimension())
+	}
+	return vectors, nil
+}
+
+func (e *Embedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	if err := e.begin(ctx, "EmbedQuery", text); err != nil {
+		return nil, err
+	}
+	if e.EmbedQueryFunc != nil {
+		return e.EmbedQueryFunc(ctx, text)
+	}
+	return HashVector(text, e.dimension()), nil
+}
+
+func (e *Embedder) dimension() int {
+	if e.Dimension <= 0 {
+		return DefaultDimension
+	}
+	return e.Dimension
+}
+
+// HashVector deterministically embeds text as a normalized bag of hashed,
+// lower-cased words
+func HashVector(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vector[h.Sum32()%uint32(dimension)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
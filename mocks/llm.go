@@ -0,0 +1,103 @@
+package mocks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+var _ llm.LLM = (*LLM)(nil)
+
+// DefaultResponse is the reply of an LLM without a Response
+const DefaultResponse = "mock response"
+
+// LLM is a programmable llm.LLM. By default every call answers with Response,
+// streamed word by word by ChatStream.
+type LLM struct {
+	Recorder
+
+	// Response is the content of default replies (DefaultResponse when empty)
+	Response string
+
+	ChatFunc       func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error)
+	ChatStreamFunc func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error)
+	CompleteFunc   func(ctx context.Context, prompt string, opts ...llm.Option) (string, error)
+}
+
+// NewLLM returns an LLM that answers every call with response
+func NewLLM(response string) *LLM {
+	return &LLM{Response: response}
+}
+
+func (m *LLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	if err := m.begin(ctx, "Chat", messages); err != nil {
+		return nil, err
+	}
+	if m.ChatFunc != nil {
+		return m.ChatFunc(ctx, messages, opts...)
+	}
+	return &llm.Message{
+		Role:       llm.RoleAssistant,
+		Content:    m.response(),
+		StopReason: llm.StopReasonStop,
+	}, nil
+}
+
+func (m *LLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+	if err := m.begin(ctx, "ChatStream", messages); err != nil {
+		return nil, err
+	}
+	if m.ChatStreamFunc != nil {
+		return m.ChatStreamFunc(ctx, messages, opts...)
+	}
+
+	options := &llm.ChatOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	words := strings.SplitAfter(m.response(), " ")
+	writer, responseChan := llm.NewStreamWriter(ctx, options)
+	go func() {
+		defer writer.Close()
+
+		for i, word := range words {
+			delta := llm.Message{Content: word}
+			if i == 0 {
+				delta.Role = llm.RoleAssistant
+			}
+			if ctx.Err() != nil {
+				writer.Send(llm.StreamResponse{Error: ctx.Err(), Done: true})
+				return
+			}
+			if !writer.Send(llm.StreamResponse{Message: delta}) {
+				return
+			}
+		}
+
+		writer.Send(llm.StreamResponse{
+			Message: llm.Message{StopReason: llm.StopReasonStop},
+			Done:    true,
+		})
+	}()
+
+	return responseChan, nil
+}
+
+func (m *LLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
+	if err := m.begin(ctx, "Complete", prompt); err != nil {
+		return "", err
+	}
+	if m.CompleteFunc != nil {
+		return m.CompleteFunc(ctx, prompt, opts...)
+	}
+	return m.response(), nil
+}
+
+func (m *LLM) response() string {
+	if m.Response == "" {
+		return DefaultResponse
+	}
+	return m.Response
+}
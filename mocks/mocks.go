@@ -0,0 +1,127 @@
+// Package mocks provides programmable fakes for the library's core interfaces.
+//
+// Every mock works out of the box with an in-memory default behaviour, records
+// its calls, and embeds a Recorder for injecting errors and latency. Set a
+// mock's ...Func fields to script return values per call.
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Call is one recorded call to a mock method
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Recorder records calls and injects errors and latency. It is embedded in
+// every mock, is safe for concurrent use, and its zero value is ready to use.
+type Recorder struct {
+	mu      sync.Mutex
+	calls   []Call
+	latency map[string]time.Duration
+	errs    map[string]error
+	queued  map[string][]error
+}
+
+// allMethods is the latency key applied to every method
+const allMethods = ""
+
+// SetLatency delays every call by d. Calls return the context's error if it
+// is done before the delay ends.
+func (r *Recorder) SetLatency(d time.Duration) {
+	r.SetMethodLatency(allMethods, d)
+}
+
+// SetMethodLatency delays calls to method by d, overriding SetLatency
+func (r *Recorder) SetMethodLatency(method string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.latency == nil {
+		r.latency = make(map[string]time.Duration)
+	}
+	r.latency[method] = d
+}
+
+// FailWith makes every call to method return err. A nil err stops the failures.
+func (r *Recorder) FailWith(method string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errs == nil {
+		r.errs = make(map[string]error)
+	}
+	r.errs[method] = err
+}
+
+// FailNext scripts the results of the next len(errs) calls to method, in order.
+// A nil entry lets that call succeed. Scripted errors take precedence over FailWith.
+func (r *Recorder) FailNext(method string, errs ...error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queued == nil {
+		r.queued = make(map[string][]error)
+	}
+	r.queued[method] = append(r.queued[method], errs...)
+}
+
+// Calls returns the recorded calls to method, or every call when method is empty
+func (r *Recorder) Calls(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []Call
+	for _, call := range r.calls {
+		if method == allMethods || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallCount returns how many times method was called, or all calls when method is empty
+func (r *Recorder) CallCount(method string) int {
+	return len(r.Calls(method))
+}
+
+// Reset forgets recorded calls, injected errors and latency
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+	r.latency = nil
+	r.errs = nil
+	r.queued = nil
+}
+
+// begin records a call, waits out its latency and returns the error injected for it
+func (r *Recorder) begin(ctx context.Context, method string, args ...any) error {
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+
+	latency, ok := r.latency[method]
+	if !ok {
+		latency = r.latency[allMethods]
+	}
+
+	err := r.errs[method]
+	if queued := r.queued[method]; len(queued) > 0 {
+		err = queued[0]
+		r.queued[method] = queued[1:]
+	}
+	r.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
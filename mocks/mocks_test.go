@@ -0,0 +1,363 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/internal/testutil"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/storage"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	"github.com/Abraxas-365/kbservice/vectorstore/storetest"
+)
+
+func TestRecorder_FailNextThenFailWith(t *testing.T) {
+	ctx := context.Background()
+	errFirst, errSticky := errors.New("first"), errors.New("sticky")
+
+	embedder := NewEmbedder(4)
+	embedder.FailWith("EmbedQuery", errSticky)
+	embedder.FailNext("EmbedQuery", errFirst, nil)
+
+	want := []error{errFirst, nil, errSticky}
+	for i, wantErr := range want {
+		_, err := embedder.EmbedQuery(ctx, "query")
+		if !errors.Is(err, wantErr) || (wantErr == nil && err != nil) {
+			t.Errorf("call %d error = %v, want %v", i, err, wantErr)
+		}
+	}
+
+	embedder.FailWith("EmbedQuery", nil)
+	if _, err := embedder.EmbedQuery(ctx, "query"); err != nil {
+		t.Errorf("EmbedQuery() after clearing error = %v", err)
+	}
+
+	calls := embedder.Calls("EmbedQuery")
+	if len(calls) != 4 || calls[0].Args[0] != "query" {
+		t.Errorf("Calls() = %v, want 4 calls with the query", calls)
+	}
+}
+
+func TestRecorder_LatencyRespectsContext(t *testing.T) {
+	store := NewStore()
+	store.SetLatency(time.Hour)
+	store.SetMethodLatency("InitDB", 0)
+
+	if err := store.InitDB(context.Background(), false); err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := store.Delete(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Delete() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRecorder_ConcurrentCalls(t *testing.T) {
+	const workers = 50
+	embedder := &Embedder{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			embedder.EmbedDocuments(context.Background(), []string{"a"})
+			embedder.EmbedQuery(context.Background(), "b")
+		}()
+	}
+	wg.Wait()
+
+	if got := embedder.CallCount("EmbedDocuments"); got != workers {
+		t.Errorf("CallCount(EmbedDocuments) = %d, want %d", got, workers)
+	}
+	if got := embedder.CallCount(""); got != 2*workers {
+		t.Errorf("CallCount() = %d, want %d", got, 2*workers)
+	}
+
+	embedder.Reset()
+	if got := embedder.CallCount(""); got != 0 {
+		t.Errorf("CallCount() after Reset = %d, want 0", got)
+	}
+}
+
+func TestStore_DefaultBehaviour(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	docs := []vectorstore.Document{
+		{PageContent: "go channels", Metadata: map[string]interface{}{"source": "a", "last_modified": "1"}},
+		{PageContent: "rust ownership", Metadata: map[string]interface{}{"source": "b", "last_modified": "1"}},
+	}
+	vectors := [][]float32{HashVector("go channels", 8), HashVector("rust ownership", 8)}
+	if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	results, err := store.SimilaritySearch(ctx, HashVector("go channels", 8), 1, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(results) != 1 || results[0].PageContent != "go channels" {
+		t.Errorf("SimilaritySearch() = %v, want the matching document first", results)
+	}
+
+	filtered, err := store.SimilaritySearch(ctx, HashVector("go channels", 8), 10, vectorstore.Filter{"source": "b"})
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].PageContent != "rust ownership" {
+		t.Errorf("SimilaritySearch() with filter = %v, want only source b", filtered)
+	}
+
+	exists, err := store.DocumentExists(ctx, []document.Document{
+		{Metadata: map[string]interface{}{"source": "a", "last_modified": "1"}},
+		{Metadata: map[string]interface{}{"source": "a", "last_modified": "2"}},
+		{Metadata: map[string]interface{}{"source": "a"}},
+	})
+	if err != nil {
+		t.Fatalf("DocumentExists() error = %v", err)
+	}
+	if !exists[0] || exists[1] || exists[2] {
+		t.Errorf("DocumentExists() = %v, want [true false false]", exists)
+	}
+
+	if err := store.Delete(ctx, vectorstore.Filter{"source": "a"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if remaining := store.Documents(); len(remaining) != 1 || remaining[0].PageContent != "rust ownership" {
+		t.Errorf("Documents() after Delete = %v, want only source b", remaining)
+	}
+}
+
+func TestStore_FilterConditions(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	docs := []vectorstore.Document{
+		{PageContent: "old", Metadata: map[string]interface{}{"type": "guide", "views": 5, "date": since.Add(-time.Hour)}},
+		{PageContent: "new", Metadata: map[string]interface{}{"type": "faq", "views": 50, "date": since.Format(time.RFC3339)}},
+		{PageContent: "untyped", Metadata: map[string]interface{}{"type": "faq", "views": "many", "date": "soon"}},
+	}
+	if err := store.AddDocuments(ctx, docs, [][]float32{{1, 0}, {0, 1}, {1, 1}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter vectorstore.Filter
+		want   []string
+	}{
+		{name: "In", filter: vectorstore.NewFilter().In("type", []string{"guide", "faq"}).Build(), want: []string{"old", "new", "untyped"}},
+		{name: "Number", filter: vectorstore.NewFilter().Gte("views", 10).Build(), want: []string{"new"}},
+		{name: "Time", filter: vectorstore.NewFilter().Gte("date", since).Build(), want: []string{"new"}},
+		{name: "Ne and Lt", filter: vectorstore.NewFilter().Ne("type", "faq").Lt("views", 10).Build(), want: []string{"old"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetDocuments(ctx, tt.filter, 0)
+			if err != nil {
+				t.Fatalf("GetDocuments() error = %v", err)
+			}
+			var contents []string
+			for _, doc := range got {
+				contents = append(contents, doc.PageContent)
+			}
+			if !reflect.DeepEqual(contents, tt.want) {
+				t.Errorf("GetDocuments() = %v, want %v", contents, tt.want)
+			}
+		})
+	}
+
+	_, err := store.GetDocuments(ctx, vectorstore.Filter{"views": vectorstore.Condition{"$near": 5}}, 0)
+	var storeErr *vectorstore.VectorStoreError
+	if !errors.As(err, &storeErr) || storeErr.Code != vectorstore.ErrCodeInvalidFilter {
+		t.Errorf("GetDocuments() with an unknown operator error = %v, want %s", err, vectorstore.ErrCodeInvalidFilter)
+	}
+}
+
+func TestStore_ScoreFunc(t *testing.T) {
+	ctx := context.Background()
+	docs := []vectorstore.Document{{PageContent: "far, same direction"}, {PageContent: "near, other direction"}}
+	vectors := [][]float32{{10, 10}, {1, 0}}
+	query := []float32{1, 1}
+
+	tests := []struct {
+		name  string
+		score ScoreFunc
+		want  []string
+	}{
+		{name: "Cosine by default", want: []string{"far, same direction", "near, other direction"}},
+		{name: "Manhattan", score: ManhattanScore, want: []string{"near, other direction", "far, same direction"}},
+		{name: "Jaccard", score: JaccardScore, want: []string{"near, other direction", "far, same direction"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore()
+			store.ScoreFunc = tt.score
+			if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+				t.Fatalf("AddDocuments() error = %v", err)
+			}
+
+			results, err := store.SimilaritySearch(ctx, query, 0, nil)
+			if err != nil {
+				t.Fatalf("SimilaritySearch() error = %v", err)
+			}
+			var got []string
+			for _, doc := range results {
+				got = append(got, doc.PageContent)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SimilaritySearch() order = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatHistoryRepository_DefaultBehaviour(t *testing.T) {
+	ctx := context.Background()
+	repo := NewChatHistoryRepository()
+
+	if err := repo.AddMessage(ctx, "missing", llm.Message{Role: llm.RoleUser}); !errors.Is(err, chathistory.ErrConversationNotFound) {
+		t.Fatalf("AddMessage() on unknown conversation error = %v, want ErrConversationNotFound", err)
+	}
+	if err := repo.CreateConversation(ctx, chathistory.Conversation{ID: "c1", Metadata: map[string]any{"user_id": "alice"}}); err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	for _, msg := range []llm.Message{
+		{Role: llm.RoleUser, Content: "Hello there"},
+		{Role: llm.RoleAssistant, Content: "Hi"},
+		{Role: llm.RoleUser, Content: "Bye"},
+	} {
+		if err := repo.AddMessage(ctx, "c1", msg); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+
+	got, err := repo.GetMessagesByFilter(ctx, "c1", chathistory.Filter{Roles: []string{llm.RoleUser}}, 0)
+	if err != nil || len(got) != 2 || got[1].Content != "Bye" {
+		t.Fatalf("GetMessagesByFilter() = %v, %v, want the two user messages", got, err)
+	}
+	if got[0].CreatedAt.IsZero() {
+		t.Error("AddMessage() did not stamp CreatedAt")
+	}
+	if count, _ := repo.GetMessageCount(ctx, "c1", chathistory.Filter{Search: "hello"}); count != 1 {
+		t.Errorf("GetMessageCount() = %d, want 1", count)
+	}
+	convs, err := repo.ListConversations(ctx, chathistory.Filter{Metadata: map[string]any{"user_id": "alice"}}, 10, 0)
+	if err != nil || len(convs) != 1 {
+		t.Errorf("ListConversations() = %v, %v, want c1", convs, err)
+	}
+}
+
+func TestDataStore_DefaultBehaviour(t *testing.T) {
+	ctx := context.Background()
+	store := NewDataStore()
+
+	for _, key := range []string{"docs/b.txt", "docs/a.txt", "other.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader("content of "+key)); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	rc, err := store.Get(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "content of docs/a.txt" {
+		t.Errorf("Get() = %q", data)
+	}
+
+	objects, err := store.List(ctx, "docs/")
+	if err != nil || len(objects) != 2 || objects[0].Key != "docs/a.txt" {
+		t.Fatalf("List() = %v, %v, want docs/a.txt and docs/b.txt in order", objects, err)
+	}
+	if deleted, _ := store.DeletePrefix(ctx, "docs/"); deleted != 2 {
+		t.Errorf("DeletePrefix() = %d, want 2", deleted)
+	}
+	var storageErr *storage.StorageError
+	if _, err := store.Get(ctx, "docs/a.txt"); !errors.As(err, &storageErr) || storageErr.Code != storage.ErrCodeNotFound {
+		t.Errorf("Get() after delete error = %v, want not found", err)
+	}
+	if _, err := store.GetPresignedGetURL(ctx, "other.txt", time.Minute); err == nil {
+		t.Error("GetPresignedGetURL() error = nil, want unsupported")
+	}
+}
+
+func TestDataSource_StreamErrorsReachConsumer(t *testing.T) {
+	errBroken := errors.New("broken")
+	source := NewDataSource(
+		datasource.Document{Source: "a", Metadata: map[string]interface{}{}},
+		datasource.Document{Source: "b", Metadata: map[string]interface{}{}},
+	)
+	source.FailNext("StreamDocument", nil, errBroken)
+
+	docChan, errChan := source.Stream(context.Background())
+	var received []string
+	for {
+		select {
+		case doc, ok := <-docChan:
+			if !ok {
+				t.Fatal("document channel closed before the error was delivered")
+			}
+			received = append(received, doc.Source)
+			continue
+		case err := <-errChan:
+			if !errors.Is(err, errBroken) {
+				t.Errorf("Stream() error = %v, want %v", err, errBroken)
+			}
+		}
+		break
+	}
+
+	if len(received) != 1 || received[0] != "a" {
+		t.Errorf("received %v before the error, want [a]", received)
+	}
+}
+
+func TestLLM_ChatStreamAssemblesResponse(t *testing.T) {
+	model := NewLLM("hello from the mock")
+
+	stream, err := model.ChatStream(context.Background(), []llm.Message{{Role: llm.RoleUser, Content: "hi"}})
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	msg, err := llm.CollectStream(stream)
+	if err != nil {
+		t.Fatalf("CollectStream() error = %v", err)
+	}
+	if msg.Content != "hello from the mock" || msg.StopReason != llm.StopReasonStop {
+		t.Errorf("CollectStream() = %+v, want the scripted response", msg)
+	}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) vectorstore.Store {
+		return NewStore()
+	})
+}
+
+func TestStore_ReplaceSourceConformance(t *testing.T) {
+	testutil.RunReplaceSourceConformance(t, func(t *testing.T) vectorstore.Store {
+		return NewStore()
+	})
+}
+
+func TestStore_Capabilities(t *testing.T) {
+	want := vectorstore.CapabilitySet{ReplaceSource: true, DeleteCount: true, GetDocuments: true, Conditions: true}
+	if got := vectorstore.Capabilities(NewStore()); got != want {
+		t.Errorf("Capabilities() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package mocks
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// PartialStore is a vectorstore.Store without transactions: it adds documents
+// one at a time and fails once it holds Limit, keeping the documents added
+// before the failure. It implements none of the optional interfaces, so
+// callers fall back to their plain Store code paths.
+type PartialStore struct {
+	Recorder
+
+	Limit int
+
+	mu   sync.Mutex
+	docs []vectorstore.Document
+}
+
+// NewPartialStore returns an empty PartialStore holding up to limit documents
+func NewPartialStore(limit int) *PartialStore {
+	return &PartialStore{Limit: limit}
+}
+
+// Documents returns the documents the store holds
+func (s *PartialStore) Documents() []vectorstore.Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]vectorstore.Document(nil), s.docs...)
+}
+
+func (s *PartialStore) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := s.begin(ctx, "AddDocuments", docs, vectors); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		if len(s.docs) >= s.Limit {
+			return vectorstore.NewAddFailedError("partial", errors.New("store full"))
+		}
+		s.docs = append(s.docs, doc)
+	}
+	return nil
+}
+
+func (s *PartialStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	return nil, s.begin(ctx, "SimilaritySearch", vector, limit, filter)
+}
+
+func (s *PartialStore) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	if err := s.begin(ctx, "Delete", filter); err != nil {
+		return err
+	}
+	if err := checkFilter(filter); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.docs[:0]
+	for _, doc := range s.docs {
+		if !matchesFilter(doc.Metadata, filter) {
+			kept = append(kept, doc)
+		}
+	}
+	s.docs = kept
+	return nil
+}
+
+func (s *PartialStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return s.begin(ctx, "InitDB", forceRecreate)
+}
+
+func (s *PartialStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	if err := s.begin(ctx, "DocumentExists", docs); err != nil {
+		return nil, err
+	}
+	return make([]bool, len(docs)), nil
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import "math"
+
+// ScoreFunc scores how similar a stored vector is to a query vector, higher
+// being more similar
+type ScoreFunc func(query, stored []float32) float32
+
+// CosineScore is the cosine similarity of a and b, or 0 when they differ in
+// length or either is all zeros
+func CosineScore(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+// ManhattanScore is the negated Manhattan (L1) distance between a and b, so
+// closer vectors score higher. Vectors of different lengths score -Inf.
+func ManhattanScore(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return float32(math.Inf(-1))
+	}
+	var distance float64
+	for i := range a {
+		distance += math.Abs(float64(a[i]) - float64(b[i]))
+	}
+	return float32(-distance)
+}
+
+// JaccardScore is the weighted Jaccard similarity of a and b as sparse
+// features, the sum of their element-wise minimums over the sum of their
+// maximums. Negative weights count as 0.
+func JaccardScore(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var minSum, maxSum float64
+	for i := range a {
+		x, y := math.Max(float64(a[i]), 0), math.Max(float64(b[i]), 0)
+		minSum += math.Min(x, y)
+		maxSum += math.Max(x, y)
+	}
+	if maxSum == 0 {
+		return 0
+	}
+	return float32(minSum / maxSum)
+}
@@ -0,0 +1,412 @@
+package mocks
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+var (
+	_ vectorstore.Store            = (*Store)(nil)
+	_ vectorstore.CountingDeleter  = (*Store)(nil)
+	_ vectorstore.SourceReplacer   = (*Store)(nil)
+	_ vectorstore.DocumentGetter   = (*Store)(nil)
+	_ vectorstore.ConditionMatcher = (*Store)(nil)
+)
+
+// Store is a programmable vectorstore.Store. By default it keeps documents in
+// memory, scores them with ScoreFunc and matches filters, Conditions
+// included, and DocumentExists checks on metadata values. Of the optional interfaces it implements
+// ReplaceSource, DeleteCount, GetDocuments and ConditionMatcher.
+type Store struct {
+	Recorder
+
+	// ScoreFunc scores stored vectors against the query vector of the default
+	// SimilaritySearch, higher scores ranking first. Nil uses CosineScore.
+	ScoreFunc ScoreFunc
+
+	AddDocumentsFunc     func(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error
+	SimilaritySearchFunc func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error)
+	DeleteFunc           func(ctx context.Context, filter vectorstore.Filter) error
+	ReplaceSourceFunc    func(ctx context.Context, source string, docs []vectorstore.Document, vectors [][]float32) error
+	InitDBFunc           func(ctx context.Context, forceRecreate bool) error
+	DocumentExistsFunc   func(ctx context.Context, docs []document.Document) ([]bool, error)
+	GetDocumentsFunc     func(ctx context.Context, filter vectorstore.Filter, limit int) ([]vectorstore.Document, error)
+
+	mu      sync.Mutex
+	docs    []vectorstore.Document
+	vectors [][]float32
+}
+
+// NewStore returns an empty Store
+func NewStore() *Store {
+	return &Store{}
+}
+
+// Documents returns the documents currently held by the default behaviour
+func (s *Store) Documents() []vectorstore.Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]vectorstore.Document(nil), s.docs...)
+}
+
+func (s *Store) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := s.begin(ctx, "AddDocuments", docs, vectors); err != nil {
+		return err
+	}
+	if s.AddDocumentsFunc != nil {
+		return s.AddDocumentsFunc(ctx, docs, vectors)
+	}
+	if len(docs) != len(vectors) {
+		return vectorstore.NewAddFailedError("mock", fmt.Errorf("%d documents but %d vectors", len(docs), len(vectors)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = append(s.docs, docs...)
+	s.vectors = append(s.vectors, vectors...)
+	return nil
+}
+
+func (s *Store) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	if err := s.begin(ctx, "SimilaritySearch", vector, limit, filter); err != nil {
+		return nil, err
+	}
+	if s.SimilaritySearchFunc != nil {
+		return s.SimilaritySearchFunc(ctx, vector, limit, filter)
+	}
+	if err := checkFilter(filter); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	score := s.ScoreFunc
+	if score == nil {
+		score = CosineScore
+	}
+	results := make([]vectorstore.Document, 0, len(s.docs))
+	for i, doc := range s.docs {
+		if !matchesFilter(doc.Metadata, filter) {
+			continue
+		}
+		doc.Score = score(vector, s.vectors[i])
+		results = append(results, doc)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *Store) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	if err := s.begin(ctx, "Delete", filter); err != nil {
+		return err
+	}
+	if s.DeleteFunc != nil {
+		return s.DeleteFunc(ctx, filter)
+	}
+	if err := checkFilter(filter); err != nil {
+		return err
+	}
+
+	s.deleteMatching(filter)
+	return nil
+}
+
+// DeleteCount is Delete reporting how many documents were removed. When
+// DeleteFunc is set it is called instead and the count is 0.
+func (s *Store) DeleteCount(ctx context.Context, filter vectorstore.Filter) (int, error) {
+	if err := s.begin(ctx, "DeleteCount", filter); err != nil {
+		return 0, err
+	}
+	if s.DeleteFunc != nil {
+		return 0, s.DeleteFunc(ctx, filter)
+	}
+	if err := checkFilter(filter); err != nil {
+		return 0, err
+	}
+
+	return s.deleteMatching(filter), nil
+}
+
+// GetDocuments returns up to limit stored documents matching filter, in the
+// order they were added
+func (s *Store) GetDocuments(ctx context.Context, filter vectorstore.Filter, limit int) ([]vectorstore.Document, error) {
+	if err := s.begin(ctx, "GetDocuments", filter, limit); err != nil {
+		return nil, err
+	}
+	if s.GetDocumentsFunc != nil {
+		return s.GetDocumentsFunc(ctx, filter, limit)
+	}
+	if err := checkFilter(filter); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var docs []vectorstore.Document
+	for _, doc := range s.docs {
+		if limit > 0 && len(docs) == limit {
+			break
+		}
+		if matchesFilter(doc.Metadata, filter) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// ReplaceSource swaps the documents of source for docs under one lock, so
+// concurrent searches never see the source half replaced
+func (s *Store) ReplaceSource(ctx context.Context, source string, docs []vectorstore.Document, vectors [][]float32) error {
+	if err := s.begin(ctx, "ReplaceSource", source, docs, vectors); err != nil {
+		return err
+	}
+	if s.ReplaceSourceFunc != nil {
+		return s.ReplaceSourceFunc(ctx, source, docs, vectors)
+	}
+	if len(docs) != len(vectors) {
+		return vectorstore.NewAddFailedError("mock", fmt.Errorf("%d documents but %d vectors", len(docs), len(vectors)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeMatching(vectorstore.Filter{"source": source})
+	s.docs = append(s.docs, docs...)
+	s.vectors = append(s.vectors, vectors...)
+	return nil
+}
+
+func (s *Store) deleteMatching(filter vectorstore.Filter) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeMatching(filter)
+}
+
+// removeMatching removes the documents matching filter. s.mu must be held.
+func (s *Store) removeMatching(filter vectorstore.Filter) int {
+	docs := s.docs[:0]
+	vectors := s.vectors[:0]
+	for i, doc := range s.docs {
+		if !matchesFilter(doc.Metadata, filter) {
+			docs = append(docs, doc)
+			vectors = append(vectors, s.vectors[i])
+		}
+	}
+	removed := len(s.docs) - len(docs)
+	s.docs, s.vectors = docs, vectors
+	return removed
+}
+
+// MatchesConditions marks that the default behaviour matches Conditions
+func (s *Store) MatchesConditions() {}
+
+func (s *Store) InitDB(ctx context.Context, forceRecreate bool) error {
+	if err := s.begin(ctx, "InitDB", forceRecreate); err != nil {
+		return err
+	}
+	if s.InitDBFunc != nil {
+		return s.InitDBFunc(ctx, forceRecreate)
+	}
+
+	if forceRecreate {
+		s.mu.Lock()
+		s.docs, s.vectors = nil, nil
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// DocumentExists reports whether a document with the same source and a
+// last_modified value is stored, like the database adapters
+func (s *Store) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	if err := s.begin(ctx, "DocumentExists", docs); err != nil {
+		return nil, err
+	}
+	if s.DocumentExistsFunc != nil {
+		return s.DocumentExistsFunc(ctx, docs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists := make([]bool, len(docs))
+	for i, doc := range docs {
+		if doc.Metadata["last_modified"] == nil {
+			continue
+		}
+		filter := vectorstore.Filter{
+			"source":        doc.Metadata["source"],
+			"last_modified": doc.Metadata["last_modified"],
+		}
+		for _, stored := range s.docs {
+			if matchesFilter(stored.Metadata, filter) {
+				exists[i] = true
+				break
+			}
+		}
+	}
+	return exists, nil
+}
+
+// matchesFilter compares values as text, the way the database adapters compare
+// metadata->>'key' with their arguments, and evaluates Conditions
+func matchesFilter(metadata map[string]interface{}, filter vectorstore.Filter) bool {
+	for key, want := range filter {
+		got, ok := metadata[key]
+		if cond, isCondition := want.(vectorstore.Condition); isCondition {
+			if !matchesCondition(got, ok, cond) {
+				return false
+			}
+			continue
+		}
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCondition reports whether every operator of cond holds for got.
+// Like pgvector, ordering compares times with a time.Time, numbers with a
+// number and text otherwise, and values of another type never match.
+func matchesCondition(got interface{}, present bool, cond vectorstore.Condition) bool {
+	for op, want := range cond {
+		switch op {
+		case vectorstore.OpEq:
+			if !present || fmt.Sprint(got) != fmt.Sprint(want) {
+				return false
+			}
+		case vectorstore.OpNe:
+			if present && fmt.Sprint(got) == fmt.Sprint(want) {
+				return false
+			}
+		case vectorstore.OpIn:
+			if !present || !containsText(want, fmt.Sprint(got)) {
+				return false
+			}
+		default:
+			if !present {
+				return false
+			}
+			order, ok := compareOrdered(got, want)
+			if !ok {
+				return false
+			}
+			switch op {
+			case vectorstore.OpGt:
+				ok = order > 0
+			case vectorstore.OpGte:
+				ok = order >= 0
+			case vectorstore.OpLt:
+				ok = order < 0
+			case vectorstore.OpLte:
+				ok = order <= 0
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareOrdered compares got with want as want is ordered, reporting false
+// when got can't be ordered that way
+func compareOrdered(got, want interface{}) (int, bool) {
+	switch want := want.(type) {
+	case time.Time:
+		var t time.Time
+		switch got := got.(type) {
+		case time.Time:
+			t = got
+		case string:
+			parsed, err := time.Parse(time.RFC3339Nano, got)
+			if err != nil {
+				return 0, false
+			}
+			t = parsed
+		default:
+			return 0, false
+		}
+		return t.Compare(want), true
+	default:
+		w, wantNumber := number(want)
+		if !wantNumber {
+			return strings.Compare(fmt.Sprint(got), fmt.Sprint(want)), true
+		}
+		g, ok := number(got)
+		if !ok {
+			return 0, false
+		}
+		return cmp.Compare(g, w), true
+	}
+}
+
+// number returns v as a float64 if it is a number
+func number(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// containsText reports whether an element of the slice values has text
+func containsText(values interface{}, text string) bool {
+	v := reflect.ValueOf(values)
+	for i := 0; i < v.Len(); i++ {
+		if fmt.Sprint(v.Index(i).Interface()) == text {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFilter rejects the Conditions of filter the store can't evaluate, the
+// way the database adapters do
+func checkFilter(filter vectorstore.Filter) error {
+	for key, value := range filter {
+		cond, ok := value.(vectorstore.Condition)
+		if !ok {
+			continue
+		}
+		if len(cond) == 0 {
+			return vectorstore.NewInvalidFilterError("mock", fmt.Sprintf("empty condition for key %s", key))
+		}
+		for op, operand := range cond {
+			if operand == nil {
+				return vectorstore.NewInvalidFilterError("mock", fmt.Sprintf("nil value for %s of key %s", op, key))
+			}
+			switch op {
+			case vectorstore.OpIn:
+				if kind := reflect.ValueOf(operand).Kind(); kind != reflect.Slice && kind != reflect.Array {
+					return vectorstore.NewInvalidFilterError("mock", fmt.Sprintf("%s of key %s must be a slice, got %T", op, key, operand))
+				}
+			case vectorstore.OpEq, vectorstore.OpNe, vectorstore.OpGt, vectorstore.OpGte, vectorstore.OpLt, vectorstore.OpLte:
+			default:
+				return vectorstore.NewInvalidFilterError("mock", fmt.Sprintf("unknown operator %s for key %s", op, key))
+			}
+		}
+	}
+	return nil
+}
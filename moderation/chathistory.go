@@ -0,0 +1,42 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// NewMessageHook returns a chathistory.MessageHook that checks messages with
+// one of the given roles, or every message when no roles are given, before they
+// are stored. Flagged messages are rejected with a *FlaggedError or redacted
+// when WithRedaction is set.
+func NewMessageHook(moderator Moderator, roles []string, opts ...Option) chathistory.MessageHook {
+	options := applyOptions(opts)
+
+	return func(ctx context.Context, conversationID string, msg *llm.Message) error {
+		if !hasRole(roles, msg.Role) || msg.Content == "" {
+			return nil
+		}
+
+		err := Screen(ctx, moderator, msg.Content, options.FailOpen)
+		if errors.Is(err, ErrFlagged) && options.Redact {
+			msg.Content = options.Redaction
+			return nil
+		}
+		return err
+	}
+}
+
+func hasRole(roles []string, role string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
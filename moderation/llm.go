@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Abraxas-365/kbservice/llm"
+)
+
+// ModeratedLLM wraps an LLM, checking the latest user message of every chat and
+// every completion prompt before it is sent. Flagged input is rejected with an
+// *llm.LLMError wrapping a *FlaggedError, or redacted when WithRedaction is set.
+type ModeratedLLM struct {
+	llm       llm.LLM
+	moderator Moderator
+	opts      *Options
+}
+
+// NewModeratedLLM creates a ModeratedLLM
+func NewModeratedLLM(l llm.LLM, moderator Moderator, opts ...Option) *ModeratedLLM {
+	return &ModeratedLLM{
+		llm:       l,
+		moderator: moderator,
+		opts:      applyOptions(opts),
+	}
+}
+
+func (m *ModeratedLLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	messages, err := m.screenMessages(ctx, "Chat", messages)
+	if err != nil {
+		return nil, err
+	}
+	return m.llm.Chat(ctx, messages, opts...)
+}
+
+func (m *ModeratedLLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+	messages, err := m.screenMessages(ctx, "ChatStream", messages)
+	if err != nil {
+		return nil, err
+	}
+	return m.llm.ChatStream(ctx, messages, opts...)
+}
+
+func (m *ModeratedLLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
+	prompt, err := m.screen(ctx, "Complete", prompt)
+	if err != nil {
+		return "", err
+	}
+	return m.llm.Complete(ctx, prompt, opts...)
+}
+
+// screenMessages checks the latest user message. Earlier messages were checked
+// when they were new, so the history is not sent to the moderator again.
+func (m *ModeratedLLM) screenMessages(ctx context.Context, op string, messages []llm.Message) ([]llm.Message, error) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != llm.RoleUser {
+			continue
+		}
+
+		content, err := m.screen(ctx, op, messages[i].Content)
+		if err != nil {
+			return nil, err
+		}
+		if content != messages[i].Content {
+			// Copy so the caller's messages are left untouched
+			messages = append([]llm.Message(nil), messages...)
+			messages[i].Content = content
+		}
+		break
+	}
+	return messages, nil
+}
+
+// screen returns the text to send, which is the redaction for flagged text when redacting
+func (m *ModeratedLLM) screen(ctx context.Context, op, text string) (string, error) {
+	err := Screen(ctx, m.moderator, text, m.opts.FailOpen)
+	if err == nil {
+		return text, nil
+	}
+
+	if errors.Is(err, ErrFlagged) {
+		if m.opts.Redact {
+			return m.opts.Redaction, nil
+		}
+		return "", &llm.LLMError{Op: op, Message: "input rejected by moderation", Err: err}
+	}
+	return "", &llm.LLMError{Op: op, Message: "moderation unavailable", Err: err}
+}
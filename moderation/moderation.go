@@ -0,0 +1,131 @@
+// Package moderation checks text against a content policy before it reaches
+// an LLM or is stored.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of checking a piece of text
+type Result struct {
+	Flagged bool `json:"flagged"`
+	// Categories holds the policy categories the text was flagged for
+	Categories map[string]bool `json:"categories,omitempty"`
+	// CategoryScores holds the provider's confidence per category, from 0 to 1
+	CategoryScores map[string]float64 `json:"category_scores,omitempty"`
+}
+
+// FlaggedCategories returns the sorted names of the categories the text was flagged for
+func (r Result) FlaggedCategories() []string {
+	var categories []string
+	for category, flagged := range r.Categories {
+		if flagged {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Moderator checks text against a content policy
+type Moderator interface {
+	Check(ctx context.Context, text string) (Result, error)
+}
+
+// ModeratorFunc adapts a function to a Moderator
+type ModeratorFunc func(ctx context.Context, text string) (Result, error)
+
+// Check returns f(ctx, text)
+func (f ModeratorFunc) Check(ctx context.Context, text string) (Result, error) {
+	return f(ctx, text)
+}
+
+// ErrFlagged is matched by FlaggedError with errors.Is
+var ErrFlagged = errors.New("content flagged by moderation")
+
+// FlaggedError is returned when text is rejected by a Moderator
+type FlaggedError struct {
+	Result Result
+}
+
+func (e *FlaggedError) Error() string {
+	categories := e.Result.FlaggedCategories()
+	if len(categories) == 0 {
+		return ErrFlagged.Error()
+	}
+	return fmt.Sprintf("%s: %s", ErrFlagged, strings.Join(categories, ", "))
+}
+
+func (e *FlaggedError) Is(target error) bool {
+	return target == ErrFlagged
+}
+
+// Screen checks text with m. It returns a *FlaggedError for flagged text, and
+// the check's error if it failed, unless failOpen lets text through when the
+// moderator is unavailable.
+func Screen(ctx context.Context, m Moderator, text string, failOpen bool) error {
+	result, err := m.Check(ctx, text)
+	if err != nil {
+		if failOpen {
+			return nil
+		}
+		return fmt.Errorf("moderation check failed: %w", err)
+	}
+	if result.Flagged {
+		return &FlaggedError{Result: result}
+	}
+	return nil
+}
+
+// DefaultRedaction replaces flagged content when redacting
+const DefaultRedaction = "[content removed by moderation]"
+
+// Options contains configuration for the moderation middleware and hooks
+type Options struct {
+	// FailOpen lets content through when the moderator returns an error.
+	// By default a failed check rejects the content.
+	FailOpen bool
+	// Redact replaces flagged content with Redaction instead of rejecting it
+	Redact    bool
+	Redaction string
+}
+
+// Option is a function type to modify Options
+type Option func(*Options)
+
+// WithFailOpen sets whether content is let through when the moderator fails
+func WithFailOpen(failOpen bool) Option {
+	return func(o *Options) {
+		o.FailOpen = failOpen
+	}
+}
+
+// WithRedaction replaces flagged content with replacement instead of rejecting
+// it. An empty replacement uses DefaultRedaction.
+func WithRedaction(replacement string) Option {
+	return func(o *Options) {
+		if replacement == "" {
+			replacement = DefaultRedaction
+		}
+		o.Redact = true
+		o.Redaction = replacement
+	}
+}
+
+func defaultOptions() *Options {
+	return &Options{
+		Redaction: DefaultRedaction,
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
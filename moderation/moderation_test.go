@@ -0,0 +1,181 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+var errUnavailable = errors.New("moderation API unavailable")
+
+// stubModerator flags text equal to "bad" and fails on "error"
+var stubModerator = ModeratorFunc(func(ctx context.Context, text string) (Result, error) {
+	switch text {
+	case "bad":
+		return Result{
+			Flagged:        true,
+			Categories:     map[string]bool{"violence": true, "hate": false},
+			CategoryScores: map[string]float64{"violence": 0.98, "hate": 0.01},
+		}, nil
+	case "error":
+		return Result{}, errUnavailable
+	}
+	return Result{CategoryScores: map[string]float64{"violence": 0.01}}, nil
+})
+
+func TestModeratedLLM(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		opts       []Option
+		wantErr    error
+		wantSent   string
+		wantCalled bool
+	}{
+		{
+			name:       "Clean input is sent",
+			input:      "hello",
+			wantSent:   "hello",
+			wantCalled: true,
+		},
+		{
+			name:    "Flagged input is rejected",
+			input:   "bad",
+			wantErr: ErrFlagged,
+		},
+		{
+			name:       "Flagged input is redacted",
+			input:      "bad",
+			opts:       []Option{WithRedaction("")},
+			wantSent:   DefaultRedaction,
+			wantCalled: true,
+		},
+		{
+			name:    "API failure fails closed by default",
+			input:   "error",
+			wantErr: errUnavailable,
+		},
+		{
+			name:       "API failure fails open when configured",
+			input:      "error",
+			opts:       []Option{WithFailOpen(true)},
+			wantSent:   "error",
+			wantCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent string
+			model := mocks.NewLLM("ok")
+			model.ChatFunc = func(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+				sent = messages[len(messages)-1].Content
+				return &llm.Message{Role: llm.RoleAssistant, Content: "ok"}, nil
+			}
+
+			messages := []llm.Message{
+				{Role: llm.RoleSystem, Content: "be nice"},
+				{Role: llm.RoleUser, Content: tt.input},
+			}
+			_, err := NewModeratedLLM(model, stubModerator, tt.opts...).Chat(context.Background(), messages)
+
+			if tt.wantErr != nil {
+				var llmErr *llm.LLMError
+				if !errors.As(err, &llmErr) {
+					t.Fatalf("Chat() error = %v, want *llm.LLMError", err)
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Chat() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+
+			if called := model.CallCount("Chat") > 0; called != tt.wantCalled {
+				t.Errorf("LLM called = %v, want %v", called, tt.wantCalled)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("LLM received %q, want %q", sent, tt.wantSent)
+			}
+			if messages[1].Content != tt.input {
+				t.Errorf("caller's message was modified to %q", messages[1].Content)
+			}
+		})
+	}
+}
+
+func TestModeratedLLM_FlaggedErrorCarriesResult(t *testing.T) {
+	_, err := NewModeratedLLM(mocks.NewLLM(""), stubModerator).Complete(context.Background(), "bad")
+
+	var flagged *FlaggedError
+	if !errors.As(err, &flagged) {
+		t.Fatalf("Complete() error = %v, want *FlaggedError", err)
+	}
+	if got := flagged.Result.FlaggedCategories(); len(got) != 1 || got[0] != "violence" {
+		t.Errorf("FlaggedCategories() = %v, want [violence]", got)
+	}
+	if flagged.Result.CategoryScores["violence"] != 0.98 {
+		t.Errorf("CategoryScores = %v, want violence=0.98", flagged.Result.CategoryScores)
+	}
+}
+
+func TestMessageHook(t *testing.T) {
+	ctx := context.Background()
+	newMemory := func(opts ...Option) *chathistory.Memory {
+		memory := chathistory.New(inmemory.NewInMemoryRepository(),
+			chathistory.WithMessageHook(NewMessageHook(stubModerator, []string{llm.RoleAssistant}, opts...)),
+		)
+		if _, err := memory.CreateConversationWithID(ctx, nil, "conv-1"); err != nil {
+			t.Fatalf("CreateConversationWithID() error = %v", err)
+		}
+		return memory
+	}
+
+	t.Run("Flagged assistant reply is not stored", func(t *testing.T) {
+		memory := newMemory()
+		err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleAssistant, Content: "bad"})
+		if !errors.Is(err, ErrFlagged) {
+			t.Fatalf("AddMessage() error = %v, want ErrFlagged", err)
+		}
+		if count, _ := memory.GetMessageCount(ctx, "conv-1", chathistory.Filter{}); count != 0 {
+			t.Errorf("stored %d messages, want 0", count)
+		}
+	})
+
+	t.Run("Other roles are not checked", func(t *testing.T) {
+		memory := newMemory()
+		if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleUser, Content: "bad"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	})
+
+	t.Run("Flagged reply is redacted", func(t *testing.T) {
+		memory := newMemory(WithRedaction("[removed]"))
+		if err := memory.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleAssistant, Content: "bad"}); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+		messages, err := memory.GetMessages(ctx, "conv-1", 10)
+		if err != nil {
+			t.Fatalf("GetMessages() error = %v", err)
+		}
+		if len(messages) != 1 || messages[0].Content != "[removed]" {
+			t.Errorf("GetMessages() = %v, want the redacted reply", messages)
+		}
+	})
+
+	t.Run("API failure", func(t *testing.T) {
+		closed := newMemory()
+		if err := closed.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleAssistant, Content: "error"}); !errors.Is(err, errUnavailable) {
+			t.Errorf("fail-closed AddMessage() error = %v, want %v", err, errUnavailable)
+		}
+		open := newMemory(WithFailOpen(true))
+		if err := open.AddMessage(ctx, "conv-1", llm.Message{Role: llm.RoleAssistant, Content: "error"}); err != nil {
+			t.Errorf("fail-open AddMessage() error = %v", err)
+		}
+	})
+}
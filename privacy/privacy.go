@@ -0,0 +1,245 @@
+// Package privacy erases a user's data from the chat history and the
+// knowledge base in one call, for data subject erasure requests.
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+const (
+	// TargetConversations is the report target for chat history conversations
+	TargetConversations = "conversations"
+	// TargetKnowledgeBase is the report target for knowledge base chunks
+	TargetKnowledgeBase = "knowledge_base"
+
+	// DefaultUserKey is the metadata key identifying a user in both stores
+	DefaultUserKey = "user_id"
+
+	// conversationBatchSize is how many conversations are listed at a time
+	conversationBatchSize = 100
+)
+
+// TargetReport is the outcome of erasing the user from one target
+type TargetReport struct {
+	Target string
+	// Key is the metadata key that was matched against the user ID
+	Key string
+	// Deleted is the number of conversations or chunks removed, or -1 when the
+	// store can't count them
+	Deleted int
+	// Err is set when the target was not fully erased. Running EraseUser again
+	// retries it; targets that succeeded have nothing left to delete.
+	Err error
+}
+
+// EraseReport lists what EraseUser removed from each target
+type EraseReport struct {
+	UserID  string
+	Targets []TargetReport
+}
+
+// Deleted returns the total removed from target, or -1 if a store couldn't count
+func (r *EraseReport) Deleted(target string) int {
+	total := 0
+	for _, t := range r.Targets {
+		if t.Target != target {
+			continue
+		}
+		if t.Deleted < 0 {
+			return -1
+		}
+		total += t.Deleted
+	}
+	return total
+}
+
+// Failed returns the targets that were not fully erased
+func (r *EraseReport) Failed() []TargetReport {
+	var failed []TargetReport
+	for _, t := range r.Targets {
+		if t.Err != nil {
+			failed = append(failed, t)
+		}
+	}
+	return failed
+}
+
+// EraseError is returned when some targets were not fully erased. The report
+// returned alongside it holds what was deleted.
+type EraseError struct {
+	Failed []TargetReport
+}
+
+func (e *EraseError) Error() string {
+	parts := make([]string, len(e.Failed))
+	for i, t := range e.Failed {
+		parts[i] = fmt.Sprintf("%s (%s): %v", t.Target, t.Key, t.Err)
+	}
+	return "privacy: erase incomplete: " + strings.Join(parts, "; ")
+}
+
+func (e *EraseError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, t := range e.Failed {
+		errs[i] = t.Err
+	}
+	return errs
+}
+
+// AuditEntry records an erasure of one target. It holds IDs and counts but
+// never the erased content.
+type AuditEntry struct {
+	UserID  string
+	Target  string
+	Key     string
+	Deleted int
+	// ConversationIDs lists the conversations removed, for TargetConversations
+	ConversationIDs []string
+	Err             error
+	Time            time.Time
+}
+
+// AuditFunc receives an AuditEntry for every target EraseUser processes
+type AuditFunc func(ctx context.Context, entry AuditEntry)
+
+// Options contains configuration for EraseUser
+type Options struct {
+	// ConversationKey is the conversation metadata key holding the user ID
+	ConversationKey string
+	// ChunkKeys are the chunk metadata keys that identify a user; a chunk
+	// matching any of them is deleted
+	ChunkKeys []string
+	Audit     AuditFunc
+}
+
+// Option is a function type to modify Options
+type Option func(*Options)
+
+// WithConversationKey sets the conversation metadata key holding the user ID
+func WithConversationKey(key string) Option {
+	return func(o *Options) {
+		o.ConversationKey = key
+	}
+}
+
+// WithChunkKeys sets the chunk metadata keys that identify a user
+func WithChunkKeys(keys ...string) Option {
+	return func(o *Options) {
+		o.ChunkKeys = keys
+	}
+}
+
+// WithAuditLog sets the callback recording what was erased
+func WithAuditLog(audit AuditFunc) Option {
+	return func(o *Options) {
+		o.Audit = audit
+	}
+}
+
+// EraseUser deletes the user's conversations from mem and the chunks in
+// knowledgeBase whose metadata identifies the user. Either store may be nil to
+// skip it. Every target is attempted even when another fails; failures are
+// reported per target in the report and returned as an *EraseError. Erasure
+// is idempotent, so a failed call can simply be repeated.
+func EraseUser(ctx context.Context, userID string, mem *chathistory.Memory, knowledgeBase *kb.KnowledgeBase, opts ...Option) (*EraseReport, error) {
+	if userID == "" {
+		return nil, errors.New("privacy: empty user ID")
+	}
+
+	options := &Options{
+		ConversationKey: DefaultUserKey,
+		ChunkKeys:       []string{DefaultUserKey},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	report := &EraseReport{UserID: userID}
+
+	if mem != nil {
+		target, ids := eraseConversations(ctx, userID, mem, options.ConversationKey)
+		report.Targets = append(report.Targets, target)
+		audit(ctx, options, userID, target, ids)
+	}
+
+	if knowledgeBase != nil {
+		for _, key := range options.ChunkKeys {
+			target := TargetReport{Target: TargetKnowledgeBase, Key: key}
+			target.Deleted, target.Err = knowledgeBase.DeleteByMetadata(ctx, vectorstore.Filter{key: userID})
+			report.Targets = append(report.Targets, target)
+			audit(ctx, options, userID, target, nil)
+		}
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return report, &EraseError{Failed: failed}
+	}
+	return report, nil
+}
+
+// eraseConversations deletes every conversation whose metadata names the user.
+// Conversations that fail to delete are skipped so the rest are still erased.
+func eraseConversations(ctx context.Context, userID string, mem *chathistory.Memory, key string) (TargetReport, []string) {
+	target := TargetReport{Target: TargetConversations, Key: key}
+	filter := chathistory.Filter{Metadata: map[string]any{key: userID}}
+
+	var deleted []string
+	var errs []error
+	// Deleted conversations drop out of the listing, so only failures move the offset
+	offset := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		convs, err := mem.ListConversations(ctx, filter, conversationBatchSize, offset)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing conversations: %w", err))
+			break
+		}
+		if len(convs) == 0 {
+			break
+		}
+
+		for _, conv := range convs {
+			err := mem.DeleteConversation(ctx, conv.ID)
+			switch {
+			case err == nil:
+				deleted = append(deleted, conv.ID)
+			case errors.Is(err, chathistory.ErrConversationNotFound):
+				// Deleted concurrently; nothing left to erase
+			default:
+				errs = append(errs, fmt.Errorf("conversation %s: %w", conv.ID, err))
+				offset++
+			}
+		}
+	}
+
+	target.Deleted = len(deleted)
+	target.Err = errors.Join(errs...)
+	return target, deleted
+}
+
+func audit(ctx context.Context, options *Options, userID string, target TargetReport, conversationIDs []string) {
+	if options.Audit == nil {
+		return
+	}
+	options.Audit(ctx, AuditEntry{
+		UserID:          userID,
+		Target:          target.Target,
+		Key:             target.Key,
+		Deleted:         target.Deleted,
+		ConversationIDs: conversationIDs,
+		Err:             target.Err,
+		Time:            time.Now(),
+	})
+}
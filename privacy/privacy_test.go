@@ -0,0 +1,152 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/mocks"
+)
+
+func setup(t *testing.T) (*chathistory.Memory, *mocks.ChatHistoryRepository, *kb.KnowledgeBase, *mocks.Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	repo := mocks.NewChatHistoryRepository()
+	mem := chathistory.New(repo)
+	for _, user := range []string{"alice", "alice", "alice", "bob"} {
+		if _, err := mem.CreateConversation(ctx, map[string]any{"user_id": user}); err != nil {
+			t.Fatalf("CreateConversation() error = %v", err)
+		}
+	}
+
+	store := mocks.NewStore()
+	knowledgeBase, err := kb.New(mocks.NewEmbedder(8), store, document.NewCharacterSplitter(1000, 0, "\n"))
+	if err != nil {
+		t.Fatalf("kb.New() error = %v", err)
+	}
+	texts := []struct {
+		source   string
+		metadata map[string]interface{}
+	}{
+		{"alice-notes.txt", map[string]interface{}{"user_id": "alice"}},
+		{"shared.txt", map[string]interface{}{"uploaded_by": "alice"}},
+		{"bob-notes.txt", map[string]interface{}{"user_id": "bob"}},
+	}
+	for _, text := range texts {
+		if err := knowledgeBase.AddText(ctx, text.source, "notes for "+text.source, text.metadata); err != nil {
+			t.Fatalf("AddText() error = %v", err)
+		}
+	}
+
+	return mem, repo, knowledgeBase, store
+}
+
+func TestEraseUser(t *testing.T) {
+	ctx := context.Background()
+	mem, _, knowledgeBase, store := setup(t)
+
+	var entries []AuditEntry
+	report, err := EraseUser(ctx, "alice", mem, knowledgeBase,
+		WithChunkKeys("user_id", "uploaded_by"),
+		WithAuditLog(func(ctx context.Context, entry AuditEntry) {
+			entries = append(entries, entry)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+
+	if got := report.Deleted(TargetConversations); got != 3 {
+		t.Errorf("Deleted(conversations) = %d, want 3", got)
+	}
+	if got := report.Deleted(TargetKnowledgeBase); got != 2 {
+		t.Errorf("Deleted(knowledge_base) = %d, want 2", got)
+	}
+
+	remaining, err := mem.ListConversations(ctx, chathistory.Filter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("ListConversations() error = %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].Metadata["user_id"] != "bob" {
+		t.Errorf("remaining conversations = %+v, want only bob's", remaining)
+	}
+	if docs := store.Documents(); len(docs) != 1 || docs[0].Metadata["source"] != "bob-notes.txt" {
+		t.Errorf("remaining chunks = %+v, want only bob's", docs)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("audit entries = %d, want 3", len(entries))
+	}
+	if entries[0].Target != TargetConversations || len(entries[0].ConversationIDs) != 3 {
+		t.Errorf("conversation audit entry = %+v", entries[0])
+	}
+	for _, entry := range entries {
+		if entry.UserID != "alice" || entry.Time.IsZero() {
+			t.Errorf("audit entry = %+v", entry)
+		}
+	}
+}
+
+func TestEraseUser_PartialFailure(t *testing.T) {
+	ctx := context.Background()
+	mem, repo, knowledgeBase, store := setup(t)
+
+	deleteErr := errors.New("connection reset")
+	repo.FailNext("DeleteConversation", deleteErr)
+	store.FailNext("DeleteCount", deleteErr)
+
+	report, err := EraseUser(ctx, "alice", mem, knowledgeBase)
+	var eraseErr *EraseError
+	if !errors.As(err, &eraseErr) {
+		t.Fatalf("EraseUser() error = %v, want *EraseError", err)
+	}
+	if !errors.Is(err, deleteErr) {
+		t.Errorf("EraseUser() error = %v, want it to wrap %v", err, deleteErr)
+	}
+	if len(report.Failed()) != 2 {
+		t.Errorf("Failed() = %+v, want both targets", report.Failed())
+	}
+	// The conversations that could be deleted were
+	if got := report.Deleted(TargetConversations); got != 2 {
+		t.Errorf("Deleted(conversations) = %d, want 2", got)
+	}
+
+	// Retrying erases what is left
+	report, err = EraseUser(ctx, "alice", mem, knowledgeBase)
+	if err != nil {
+		t.Fatalf("EraseUser() retry error = %v", err)
+	}
+	if got := report.Deleted(TargetConversations); got != 1 {
+		t.Errorf("retry Deleted(conversations) = %d, want 1", got)
+	}
+	if got := report.Deleted(TargetKnowledgeBase); got != 1 {
+		t.Errorf("retry Deleted(knowledge_base) = %d, want 1", got)
+	}
+
+	// Erasing again finds nothing
+	report, err = EraseUser(ctx, "alice", mem, knowledgeBase)
+	if err != nil {
+		t.Fatalf("EraseUser() repeat error = %v", err)
+	}
+	if report.Deleted(TargetConversations) != 0 || report.Deleted(TargetKnowledgeBase) != 0 {
+		t.Errorf("repeat report = %+v, want nothing deleted", report)
+	}
+}
+
+func TestEraseUser_SkipsNilStores(t *testing.T) {
+	report, err := EraseUser(context.Background(), "alice", nil, nil)
+	if err != nil {
+		t.Fatalf("EraseUser() error = %v", err)
+	}
+	if len(report.Targets) != 0 {
+		t.Errorf("Targets = %+v, want none", report.Targets)
+	}
+
+	if _, err := EraseUser(context.Background(), "", nil, nil); err == nil {
+		t.Error("EraseUser() with empty user ID error = nil")
+	}
+}
@@ -0,0 +1,625 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: kbservice/v1/kbservice.proto
+
+package kbservicev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	KnowledgeBaseService_Search_FullMethodName       = "/kbservice.v1.KnowledgeBaseService/Search"
+	KnowledgeBaseService_Query_FullMethodName        = "/kbservice.v1.KnowledgeBaseService/Query"
+	KnowledgeBaseService_Ingest_FullMethodName       = "/kbservice.v1.KnowledgeBaseService/Ingest"
+	KnowledgeBaseService_DeleteSource_FullMethodName = "/kbservice.v1.KnowledgeBaseService/DeleteSource"
+)
+
+// KnowledgeBaseServiceClient is the client API for KnowledgeBaseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// KnowledgeBaseService searches and maintains a knowledge base
+type KnowledgeBaseServiceClient interface {
+	// Search returns the documents most similar to a query
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error)
+	// Query answers a question from retrieved documents. The stream starts with the
+	// sources, continues with answer deltas and ends with the assembled answer.
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error)
+	// Ingest indexes text under a source, replacing what was indexed for it before
+	Ingest(ctx context.Context, in *IngestRequest, opts ...grpc.CallOption) (*IngestResponse, error)
+	// DeleteSource removes every document indexed for a source
+	DeleteSource(ctx context.Context, in *DeleteSourceRequest, opts ...grpc.CallOption) (*DeleteSourceResponse, error)
+}
+
+type knowledgeBaseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKnowledgeBaseServiceClient(cc grpc.ClientConnInterface) KnowledgeBaseServiceClient {
+	return &knowledgeBaseServiceClient{cc}
+}
+
+func (c *knowledgeBaseServiceClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*SearchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchResponse)
+	err := c.cc.Invoke(ctx, KnowledgeBaseService_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *knowledgeBaseServiceClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[QueryResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &KnowledgeBaseService_ServiceDesc.Streams[0], KnowledgeBaseService_Query_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, QueryResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KnowledgeBaseService_QueryClient = grpc.ServerStreamingClient[QueryResponse]
+
+func (c *knowledgeBaseServiceClient) Ingest(ctx context.Context, in *IngestRequest, opts ...grpc.CallOption) (*IngestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IngestResponse)
+	err := c.cc.Invoke(ctx, KnowledgeBaseService_Ingest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *knowledgeBaseServiceClient) DeleteSource(ctx context.Context, in *DeleteSourceRequest, opts ...grpc.CallOption) (*DeleteSourceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSourceResponse)
+	err := c.cc.Invoke(ctx, KnowledgeBaseService_DeleteSource_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KnowledgeBaseServiceServer is the server API for KnowledgeBaseService service.
+// All implementations must embed UnimplementedKnowledgeBaseServiceServer
+// for forward compatibility.
+//
+// KnowledgeBaseService searches and maintains a knowledge base
+type KnowledgeBaseServiceServer interface {
+	// Search returns the documents most similar to a query
+	Search(context.Context, *SearchRequest) (*SearchResponse, error)
+	// Query answers a question from retrieved documents. The stream starts with the
+	// sources, continues with answer deltas and ends with the assembled answer.
+	Query(*QueryRequest, grpc.ServerStreamingServer[QueryResponse]) error
+	// Ingest indexes text under a source, replacing what was indexed for it before
+	Ingest(context.Context, *IngestRequest) (*IngestResponse, error)
+	// DeleteSource removes every document indexed for a source
+	DeleteSource(context.Context, *DeleteSourceRequest) (*DeleteSourceResponse, error)
+	mustEmbedUnimplementedKnowledgeBaseServiceServer()
+}
+
+// UnimplementedKnowledgeBaseServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedKnowledgeBaseServiceServer struct{}
+
+func (UnimplementedKnowledgeBaseServiceServer) Search(context.Context, *SearchRequest) (*SearchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedKnowledgeBaseServiceServer) Query(*QueryRequest, grpc.ServerStreamingServer[QueryResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedKnowledgeBaseServiceServer) Ingest(context.Context, *IngestRequest) (*IngestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedKnowledgeBaseServiceServer) DeleteSource(context.Context, *DeleteSourceRequest) (*DeleteSourceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSource not implemented")
+}
+func (UnimplementedKnowledgeBaseServiceServer) mustEmbedUnimplementedKnowledgeBaseServiceServer() {}
+func (UnimplementedKnowledgeBaseServiceServer) testEmbeddedByValue()                              {}
+
+// UnsafeKnowledgeBaseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KnowledgeBaseServiceServer will
+// result in compilation errors.
+type UnsafeKnowledgeBaseServiceServer interface {
+	mustEmbedUnimplementedKnowledgeBaseServiceServer()
+}
+
+func RegisterKnowledgeBaseServiceServer(s grpc.ServiceRegistrar, srv KnowledgeBaseServiceServer) {
+	// If the following call pancis, it indicates UnimplementedKnowledgeBaseServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&KnowledgeBaseService_ServiceDesc, srv)
+}
+
+func _KnowledgeBaseService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KnowledgeBaseServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KnowledgeBaseService_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KnowledgeBaseServiceServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KnowledgeBaseService_Query_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KnowledgeBaseServiceServer).Query(m, &grpc.GenericServerStream[QueryRequest, QueryResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KnowledgeBaseService_QueryServer = grpc.ServerStreamingServer[QueryResponse]
+
+func _KnowledgeBaseService_Ingest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IngestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KnowledgeBaseServiceServer).Ingest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KnowledgeBaseService_Ingest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KnowledgeBaseServiceServer).Ingest(ctx, req.(*IngestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KnowledgeBaseService_DeleteSource_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSourceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KnowledgeBaseServiceServer).DeleteSource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KnowledgeBaseService_DeleteSource_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KnowledgeBaseServiceServer).DeleteSource(ctx, req.(*DeleteSourceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KnowledgeBaseService_ServiceDesc is the grpc.ServiceDesc for KnowledgeBaseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KnowledgeBaseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kbservice.v1.KnowledgeBaseService",
+	HandlerType: (*KnowledgeBaseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    _KnowledgeBaseService_Search_Handler,
+		},
+		{
+			MethodName: "Ingest",
+			Handler:    _KnowledgeBaseService_Ingest_Handler,
+		},
+		{
+			MethodName: "DeleteSource",
+			Handler:    _KnowledgeBaseService_DeleteSource_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Query",
+			Handler:       _KnowledgeBaseService_Query_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kbservice/v1/kbservice.proto",
+}
+
+const (
+	ChatHistoryService_CreateConversation_FullMethodName         = "/kbservice.v1.ChatHistoryService/CreateConversation"
+	ChatHistoryService_GetConversation_FullMethodName            = "/kbservice.v1.ChatHistoryService/GetConversation"
+	ChatHistoryService_ListConversations_FullMethodName          = "/kbservice.v1.ChatHistoryService/ListConversations"
+	ChatHistoryService_UpdateConversationMetadata_FullMethodName = "/kbservice.v1.ChatHistoryService/UpdateConversationMetadata"
+	ChatHistoryService_DeleteConversation_FullMethodName         = "/kbservice.v1.ChatHistoryService/DeleteConversation"
+	ChatHistoryService_AddMessage_FullMethodName                 = "/kbservice.v1.ChatHistoryService/AddMessage"
+	ChatHistoryService_GetMessages_FullMethodName                = "/kbservice.v1.ChatHistoryService/GetMessages"
+	ChatHistoryService_ClearHistory_FullMethodName               = "/kbservice.v1.ChatHistoryService/ClearHistory"
+)
+
+// ChatHistoryServiceClient is the client API for ChatHistoryService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ChatHistoryService stores conversations and their messages
+type ChatHistoryServiceClient interface {
+	CreateConversation(ctx context.Context, in *CreateConversationRequest, opts ...grpc.CallOption) (*Conversation, error)
+	GetConversation(ctx context.Context, in *GetConversationRequest, opts ...grpc.CallOption) (*Conversation, error)
+	ListConversations(ctx context.Context, in *ListConversationsRequest, opts ...grpc.CallOption) (*ListConversationsResponse, error)
+	UpdateConversationMetadata(ctx context.Context, in *UpdateConversationMetadataRequest, opts ...grpc.CallOption) (*UpdateConversationMetadataResponse, error)
+	DeleteConversation(ctx context.Context, in *DeleteConversationRequest, opts ...grpc.CallOption) (*DeleteConversationResponse, error)
+	AddMessage(ctx context.Context, in *AddMessageRequest, opts ...grpc.CallOption) (*AddMessageResponse, error)
+	GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (*GetMessagesResponse, error)
+	ClearHistory(ctx context.Context, in *ClearHistoryRequest, opts ...grpc.CallOption) (*ClearHistoryResponse, error)
+}
+
+type chatHistoryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChatHistoryServiceClient(cc grpc.ClientConnInterface) ChatHistoryServiceClient {
+	return &chatHistoryServiceClient{cc}
+}
+
+func (c *chatHistoryServiceClient) CreateConversation(ctx context.Context, in *CreateConversationRequest, opts ...grpc.CallOption) (*Conversation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conversation)
+	err := c.cc.Invoke(ctx, ChatHistoryService_CreateConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) GetConversation(ctx context.Context, in *GetConversationRequest, opts ...grpc.CallOption) (*Conversation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Conversation)
+	err := c.cc.Invoke(ctx, ChatHistoryService_GetConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) ListConversations(ctx context.Context, in *ListConversationsRequest, opts ...grpc.CallOption) (*ListConversationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConversationsResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_ListConversations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) UpdateConversationMetadata(ctx context.Context, in *UpdateConversationMetadataRequest, opts ...grpc.CallOption) (*UpdateConversationMetadataResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateConversationMetadataResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_UpdateConversationMetadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) DeleteConversation(ctx context.Context, in *DeleteConversationRequest, opts ...grpc.CallOption) (*DeleteConversationResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteConversationResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_DeleteConversation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) AddMessage(ctx context.Context, in *AddMessageRequest, opts ...grpc.CallOption) (*AddMessageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddMessageResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_AddMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (*GetMessagesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetMessagesResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_GetMessages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatHistoryServiceClient) ClearHistory(ctx context.Context, in *ClearHistoryRequest, opts ...grpc.CallOption) (*ClearHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClearHistoryResponse)
+	err := c.cc.Invoke(ctx, ChatHistoryService_ClearHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChatHistoryServiceServer is the server API for ChatHistoryService service.
+// All implementations must embed UnimplementedChatHistoryServiceServer
+// for forward compatibility.
+//
+// ChatHistoryService stores conversations and their messages
+type ChatHistoryServiceServer interface {
+	CreateConversation(context.Context, *CreateConversationRequest) (*Conversation, error)
+	GetConversation(context.Context, *GetConversationRequest) (*Conversation, error)
+	ListConversations(context.Context, *ListConversationsRequest) (*ListConversationsResponse, error)
+	UpdateConversationMetadata(context.Context, *UpdateConversationMetadataRequest) (*UpdateConversationMetadataResponse, error)
+	DeleteConversation(context.Context, *DeleteConversationRequest) (*DeleteConversationResponse, error)
+	AddMessage(context.Context, *AddMessageRequest) (*AddMessageResponse, error)
+	GetMessages(context.Context, *GetMessagesRequest) (*GetMessagesResponse, error)
+	ClearHistory(context.Context, *ClearHistoryRequest) (*ClearHistoryResponse, error)
+	mustEmbedUnimplementedChatHistoryServiceServer()
+}
+
+// UnimplementedChatHistoryServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChatHistoryServiceServer struct{}
+
+func (UnimplementedChatHistoryServiceServer) CreateConversation(context.Context, *CreateConversationRequest) (*Conversation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateConversation not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) GetConversation(context.Context, *GetConversationRequest) (*Conversation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConversation not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) ListConversations(context.Context, *ListConversationsRequest) (*ListConversationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConversations not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) UpdateConversationMetadata(context.Context, *UpdateConversationMetadataRequest) (*UpdateConversationMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateConversationMetadata not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) DeleteConversation(context.Context, *DeleteConversationRequest) (*DeleteConversationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteConversation not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) AddMessage(context.Context, *AddMessageRequest) (*AddMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddMessage not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) GetMessages(context.Context, *GetMessagesRequest) (*GetMessagesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMessages not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) ClearHistory(context.Context, *ClearHistoryRequest) (*ClearHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ClearHistory not implemented")
+}
+func (UnimplementedChatHistoryServiceServer) mustEmbedUnimplementedChatHistoryServiceServer() {}
+func (UnimplementedChatHistoryServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeChatHistoryServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChatHistoryServiceServer will
+// result in compilation errors.
+type UnsafeChatHistoryServiceServer interface {
+	mustEmbedUnimplementedChatHistoryServiceServer()
+}
+
+func RegisterChatHistoryServiceServer(s grpc.ServiceRegistrar, srv ChatHistoryServiceServer) {
+	// If the following call pancis, it indicates UnimplementedChatHistoryServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChatHistoryService_ServiceDesc, srv)
+}
+
+func _ChatHistoryService_CreateConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).CreateConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_CreateConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).CreateConversation(ctx, req.(*CreateConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_GetConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).GetConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_GetConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).GetConversation(ctx, req.(*GetConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_ListConversations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConversationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).ListConversations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_ListConversations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).ListConversations(ctx, req.(*ListConversationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_UpdateConversationMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateConversationMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).UpdateConversationMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_UpdateConversationMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).UpdateConversationMetadata(ctx, req.(*UpdateConversationMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_DeleteConversation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteConversationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).DeleteConversation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_DeleteConversation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).DeleteConversation(ctx, req.(*DeleteConversationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_AddMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).AddMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_AddMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).AddMessage(ctx, req.(*AddMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_GetMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).GetMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_GetMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).GetMessages(ctx, req.(*GetMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChatHistoryService_ClearHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ClearHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChatHistoryServiceServer).ClearHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChatHistoryService_ClearHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChatHistoryServiceServer).ClearHistory(ctx, req.(*ClearHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChatHistoryService_ServiceDesc is the grpc.ServiceDesc for ChatHistoryService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChatHistoryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kbservice.v1.ChatHistoryService",
+	HandlerType: (*ChatHistoryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateConversation",
+			Handler:    _ChatHistoryService_CreateConversation_Handler,
+		},
+		{
+			MethodName: "GetConversation",
+			Handler:    _ChatHistoryService_GetConversation_Handler,
+		},
+		{
+			MethodName: "ListConversations",
+			Handler:    _ChatHistoryService_ListConversations_Handler,
+		},
+		{
+			MethodName: "UpdateConversationMetadata",
+			Handler:    _ChatHistoryService_UpdateConversationMetadata_Handler,
+		},
+		{
+			MethodName: "DeleteConversation",
+			Handler:    _ChatHistoryService_DeleteConversation_Handler,
+		},
+		{
+			MethodName: "AddMessage",
+			Handler:    _ChatHistoryService_AddMessage_Handler,
+		},
+		{
+			MethodName: "GetMessages",
+			Handler:    _ChatHistoryService_GetMessages_Handler,
+		},
+		{
+			MethodName: "ClearHistory",
+			Handler:    _ChatHistoryService_ClearHistory_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "kbservice/v1/kbservice.proto",
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/datasource"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// Error codes set by the server itself. Errors from the library keep their own codes.
+const (
+	ErrCodeInvalidRequest       = "INVALID_REQUEST"
+	ErrCodeConversationNotFound = "CONVERSATION_NOT_FOUND"
+	ErrCodeNoRelevantContext    = "NO_RELEVANT_CONTEXT"
+	ErrCodeLLM                  = "LLM_ERROR"
+	ErrCodeTimeout              = "TIMEOUT"
+	ErrCodeCanceled             = "CANCELED"
+	ErrCodeInternal             = "INTERNAL"
+)
+
+// statusClientClosedRequest is reported when the client went away before the response
+const statusClientClosedRequest = 499
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes what went wrong
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// requestError is a client error detected by the server
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func invalidRequest(message string) error {
+	return &requestError{message: message}
+}
+
+// classify maps an error to an HTTP status and envelope. Only the messages of
+// typed errors are exposed; anything else is reported as an internal error.
+func classify(err error) (int, ErrorBody) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return http.StatusBadRequest, ErrorBody{Code: ErrCodeInvalidRequest, Message: reqErr.message}
+	}
+
+	if errors.Is(err, chathistory.ErrConversationNotFound) {
+		return http.StatusNotFound, ErrorBody{Code: ErrCodeConversationNotFound, Message: "conversation not found"}
+	}
+
+	var noContextErr *kb.NoContextError
+	if errors.As(err, &noContextErr) {
+		return http.StatusUnprocessableEntity, ErrorBody{Code: ErrCodeNoRelevantContext, Message: noContextErr.Error()}
+	}
+
+	var vsErr *vectorstore.VectorStoreError
+	if errors.As(err, &vsErr) {
+		status := http.StatusInternalServerError
+		switch vsErr.Code {
+		case vectorstore.ErrCodeInvalidFilter, vectorstore.ErrCodeInvalidDimensions:
+			status = http.StatusBadRequest
+		case vectorstore.ErrCodeNotSupported:
+			status = http.StatusNotImplemented
+		case vectorstore.ErrCodeTimeout:
+			status = http.StatusGatewayTimeout
+		case vectorstore.ErrCodeEmbeddingFailed:
+			status = http.StatusBadGateway
+		}
+		return status, ErrorBody{Code: string(vsErr.Code), Message: vsErr.Message}
+	}
+
+	var embeddingErr *embedding.EmbeddingError
+	if errors.As(err, &embeddingErr) {
+		status := http.StatusBadGateway
+		switch embeddingErr.Code {
+		case embedding.ErrCodeInvalidInput, embedding.ErrCodeEmptyInput, embedding.ErrCodeTokenLimitExceeded:
+			status = http.StatusBadRequest
+		case embedding.ErrCodeRateLimitExceeded:
+			status = http.StatusTooManyRequests
+		case embedding.ErrCodeContextCanceled:
+			status = statusClientClosedRequest
+		case embedding.ErrCodeInternal:
+			status = http.StatusInternalServerError
+		}
+		return status, ErrorBody{Code: embeddingErr.Code, Message: embeddingErr.Message}
+	}
+
+	var dsErr *datasource.DataSourceError
+	if errors.As(err, &dsErr) {
+		status := http.StatusInternalServerError
+		switch dsErr.Code {
+		case datasource.ErrCodeNotFound:
+			status = http.StatusNotFound
+		case datasource.ErrCodeInvalidSource, datasource.ErrCodeInvalidFormat:
+			status = http.StatusBadRequest
+		case datasource.ErrCodeAccessDenied:
+			status = http.StatusForbidden
+		case datasource.ErrCodeRateLimitExceeded:
+			status = http.StatusTooManyRequests
+		}
+		return status, ErrorBody{Code: dsErr.Code, Message: dsErr.Message}
+	}
+
+	var llmErr *llm.LLMError
+	if errors.As(err, &llmErr) {
+		return http.StatusBadGateway, ErrorBody{Code: ErrCodeLLM, Message: llmErr.Message}
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, ErrorBody{Code: ErrCodeTimeout, Message: "request timed out"}
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, ErrorBody{Code: ErrCodeCanceled, Message: "request canceled"}
+	}
+
+	return http.StatusInternalServerError, ErrorBody{Code: ErrCodeInternal, Message: "internal error"}
+}
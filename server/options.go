@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/logging"
+)
+
+// DefaultRAGPrompt is the system prompt used to answer queries from retrieved
+// context, the knowledge base's kb.DefaultRAGPrompt
+const DefaultRAGPrompt = kb.DefaultRAGPrompt
+
+// Middleware wraps the server's handler, e.g. to authenticate requests
+type Middleware func(http.Handler) http.Handler
+
+// Options contains configuration for the HTTP server
+type Options struct {
+	Middleware   []Middleware // Applied in order, the first one outermost
+	SearchLimit  int          // Number of documents retrieved when a request sets no limit
+	RAGPrompt    string       // System prompt the retrieved context is appended to
+	MaxBodyBytes int64        // Maximum size of a request body
+	Logger       *slog.Logger // Receives server errors
+}
+
+// Option is a function type to modify Options
+type Option func(*Options)
+
+func defaultOptions() *Options {
+	return &Options{
+		SearchLimit:  4,
+		RAGPrompt:    DefaultRAGPrompt,
+		MaxBodyBytes: 1 << 20,
+		Logger:       logging.Discard(),
+	}
+}
+
+// WithMiddleware adds middleware around every route, e.g. for authentication
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(o *Options) {
+		o.Middleware = append(o.Middleware, middleware...)
+	}
+}
+
+// WithSearchLimit sets the number of documents retrieved when a request sets no limit
+func WithSearchLimit(limit int) Option {
+	return func(o *Options) {
+		o.SearchLimit = limit
+	}
+}
+
+// WithRAGPrompt sets the system prompt the retrieved context is appended to
+func WithRAGPrompt(prompt string) Option {
+	return func(o *Options) {
+		o.RAGPrompt = prompt
+	}
+}
+
+// WithMaxBodyBytes sets the maximum size of a request body
+func WithMaxBodyBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxBodyBytes = n
+	}
+}
+
+// WithLogger sets the logger server errors are reported to. A nil logger
+// discards them.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		if logger == nil {
+			logger = logging.Discard()
+		}
+		o.Logger = logger
+	}
+}
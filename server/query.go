@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// QueryRequest is the body of POST /query. With a conversation ID the
+// conversation's history is sent to the model, and the question and answer are
+// added to it.
+type QueryRequest struct {
+	Query          string             `json:"query"`
+	Limit          int                `json:"limit,omitempty"`
+	Filter         vectorstore.Filter `json:"filter,omitempty"`
+	ConversationID string             `json:"conversation_id,omitempty"`
+	Stream         bool               `json:"stream,omitempty"`
+}
+
+// QueryResponse is the body returned by POST /query without streaming
+type QueryResponse struct {
+	Answer  llm.Message            `json:"answer"`
+	Sources []vectorstore.Document `json:"sources"`
+	Warning string                 `json:"warning,omitempty"` // Set when the answer was truncated
+}
+
+// Server-sent events emitted by a streaming query, in order: one sources event,
+// any number of message events, a warning event if the answer was truncated,
+// then a done or error event
+const (
+	EventSources = "sources" // data: the retrieved documents
+	EventMessage = "message" // data: a message delta
+	EventWarning = "warning" // data: the warning, as a JSON string
+	EventDone    = "done"    // data: the assembled answer
+	EventError   = "error"   // data: an ErrorResponse
+)
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req QueryRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if req.Query == "" {
+		s.writeError(w, r, invalidRequest("query is required"))
+		return
+	}
+	if req.ConversationID != "" && s.mem == nil {
+		s.writeError(w, r, invalidRequest("conversations are not enabled"))
+		return
+	}
+
+	docs, err := s.kb.Retrieve(ctx, req.Query, s.limit(req.Limit), req.Filter)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	docs = nonNil(docs)
+
+	messages, err := s.buildMessages(ctx, req, docs)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if req.Stream {
+		s.streamQuery(w, r, req, messages, docs)
+		return
+	}
+
+	answer, err := s.llm.Chat(ctx, messages)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if err := s.saveExchange(ctx, req, *answer); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, QueryResponse{
+		Answer:  *answer,
+		Sources: docs,
+		Warning: kb.AnswerWarning(*answer),
+	})
+}
+
+// buildMessages puts the retrieved documents in a system prompt, followed by the
+// conversation history and the question
+func (s *Server) buildMessages(ctx context.Context, req QueryRequest, docs []vectorstore.Document) ([]llm.Message, error) {
+	var history []llm.Message
+	if req.ConversationID != "" {
+		var err error
+		history, err = s.mem.GetMessages(ctx, req.ConversationID, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return kb.RAGMessages(s.opts.RAGPrompt, docs, history, req.Query), nil
+}
+
+// saveExchange adds the question and answer to the request's conversation, if any
+func (s *Server) saveExchange(ctx context.Context, req QueryRequest, answer llm.Message) error {
+	if req.ConversationID == "" {
+		return nil
+	}
+	if err := s.mem.AddMessage(ctx, req.ConversationID, llm.Message{Role: llm.RoleUser, Content: req.Query}); err != nil {
+		return err
+	}
+	return s.mem.AddMessage(ctx, req.ConversationID, answer)
+}
+
+func (s *Server) streamQuery(w http.ResponseWriter, r *http.Request, req QueryRequest, messages []llm.Message, docs []vectorstore.Document) {
+	ctx := r.Context()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, r, fmt.Errorf("response writer does not support streaming"))
+		return
+	}
+
+	stream, err := s.llm.ChatStream(ctx, messages)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data any) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+	sendError := func(err error) {
+		_, body := classify(err)
+		send(EventError, ErrorResponse{Error: body})
+	}
+
+	send(EventSources, docs)
+
+	// Deltas are forwarded as they arrive and collected for the final event
+	collected := make(chan llm.StreamResponse)
+	result := make(chan collectResult, 1)
+	go func() {
+		answer, err := llm.CollectStream(collected)
+		result <- collectResult{answer, err}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(collected)
+			// Let the adapter finish sending so its goroutine can exit
+			go func() {
+				for range stream {
+				}
+			}()
+			return
+		case resp, ok := <-stream:
+			if !ok {
+				close(collected)
+				res := <-result
+				if res.err != nil {
+					sendError(res.err)
+					return
+				}
+				if err := s.saveExchange(ctx, req, *res.answer); err != nil {
+					sendError(err)
+					return
+				}
+				if warning := kb.AnswerWarning(*res.answer); warning != "" {
+					send(EventWarning, warning)
+				}
+				send(EventDone, res.answer)
+				return
+			}
+			collected <- resp
+			if resp.Error != nil {
+				continue
+			}
+			if resp.Message.Content != "" || resp.Message.FuncCall != nil || len(resp.Message.ToolCalls) > 0 {
+				send(EventMessage, resp.Message)
+			}
+		}
+	}
+}
+
+type collectResult struct {
+	answer *llm.Message
+	err    error
+}
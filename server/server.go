@@ -0,0 +1,346 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// Server exposes a knowledge base and chat history over JSON HTTP endpoints
+type Server struct {
+	kb   *kb.KnowledgeBase
+	mem  *chathistory.Memory
+	llm  llm.LLM
+	opts *Options
+}
+
+// NewHTTPServer creates the HTTP handler. Routes are only registered for the
+// components given: without an LLM there is no /query, and without memory there
+// are no /conversations routes.
+//
+//	POST   /search                       similarity search
+//	POST   /query                        answer a question from retrieved documents, optionally as SSE
+//	POST   /documents                    index text under a source
+//	GET    /sources                      list indexed sources
+//	DELETE /sources/{source...}          remove a source's documents
+//	POST   /conversations                create a conversation
+//	GET    /conversations                list conversations
+//	GET    /conversations/{id}           get a conversation
+//	PATCH  /conversations/{id}           replace a conversation's metadata
+//	DELETE /conversations/{id}           delete a conversation
+//	GET    /conversations/{id}/messages  get a conversation's messages
+//	POST   /conversations/{id}/messages  add a message to a conversation
+//	DELETE /conversations/{id}/messages  clear a conversation's messages
+func NewHTTPServer(knowledgeBase *kb.KnowledgeBase, mem *chathistory.Memory, model llm.LLM, opts ...Option) http.Handler {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	s := &Server{
+		kb:   knowledgeBase,
+		mem:  mem,
+		llm:  model,
+		opts: options,
+	}
+
+	mux := http.NewServeMux()
+	if knowledgeBase != nil {
+		mux.HandleFunc("POST /search", s.handleSearch)
+		mux.HandleFunc("POST /documents", s.handleAddDocument)
+		mux.HandleFunc("GET /sources", s.handleListSources)
+		mux.HandleFunc("DELETE /sources/{source...}", s.handleDeleteSource)
+		if model != nil {
+			mux.HandleFunc("POST /query", s.handleQuery)
+		}
+	}
+	if mem != nil {
+		mux.HandleFunc("POST /conversations", s.handleCreateConversation)
+		mux.HandleFunc("GET /conversations", s.handleListConversations)
+		mux.HandleFunc("GET /conversations/{id}", s.handleGetConversation)
+		mux.HandleFunc("PATCH /conversations/{id}", s.handleUpdateConversation)
+		mux.HandleFunc("DELETE /conversations/{id}", s.handleDeleteConversation)
+		mux.HandleFunc("GET /conversations/{id}/messages", s.handleGetMessages)
+		mux.HandleFunc("POST /conversations/{id}/messages", s.handleAddMessage)
+		mux.HandleFunc("DELETE /conversations/{id}/messages", s.handleClearMessages)
+	}
+
+	var handler http.Handler = mux
+	for i := len(options.Middleware) - 1; i >= 0; i-- {
+		handler = options.Middleware[i](handler)
+	}
+	return handler
+}
+
+// SearchRequest is the body of POST /search
+type SearchRequest struct {
+	Query  string             `json:"query"`
+	Limit  int                `json:"limit,omitempty"`
+	Filter vectorstore.Filter `json:"filter,omitempty"`
+}
+
+// SearchResponse is the body returned by POST /search
+type SearchResponse struct {
+	Documents []vectorstore.Document `json:"documents"`
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req SearchRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if req.Query == "" {
+		s.writeError(w, r, invalidRequest("query is required"))
+		return
+	}
+
+	docs, err := s.kb.SimilaritySearch(r.Context(), req.Query, s.limit(req.Limit), req.Filter)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SearchResponse{Documents: nonNil(docs)})
+}
+
+// AddDocumentRequest is the body of POST /documents
+type AddDocumentRequest struct {
+	Source   string                 `json:"source"`
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+func (s *Server) handleAddDocument(w http.ResponseWriter, r *http.Request) {
+	var req AddDocumentRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if req.Source == "" {
+		s.writeError(w, r, invalidRequest("source is required"))
+		return
+	}
+	if req.Text == "" {
+		s.writeError(w, r, invalidRequest("text is required"))
+		return
+	}
+
+	if err := s.kb.AddText(r.Context(), req.Source, req.Text, req.Metadata); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"source": req.Source})
+}
+
+// SourcesResponse is the body returned by GET /sources
+type SourcesResponse struct {
+	Sources []string `json:"sources"`
+}
+
+func (s *Server) handleListSources(w http.ResponseWriter, r *http.Request) {
+	sources, err := s.kb.ListSources(r.Context())
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SourcesResponse{Sources: nonNil(sources)})
+}
+
+func (s *Server) handleDeleteSource(w http.ResponseWriter, r *http.Request) {
+	if err := s.kb.DeleteSource(r.Context(), r.PathValue("source")); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ConversationRequest is the body of POST and PATCH /conversations
+type ConversationRequest struct {
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// ConversationsResponse is the body returned by GET /conversations
+type ConversationsResponse struct {
+	Conversations []chathistory.Conversation `json:"conversations"`
+}
+
+// MessagesResponse is the body returned by GET /conversations/{id}/messages
+type MessagesResponse struct {
+	Messages []llm.Message `json:"messages"`
+}
+
+func (s *Server) handleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	var req ConversationRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	conv, err := s.mem.CreateConversation(r.Context(), req.Metadata)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, conv)
+}
+
+func (s *Server) handleListConversations(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	convs, err := s.mem.ListConversations(r.Context(), chathistory.Filter{}, limit, offset)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ConversationsResponse{Conversations: nonNil(convs)})
+}
+
+func (s *Server) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	conv, err := s.mem.GetConversation(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, conv)
+}
+
+func (s *Server) handleUpdateConversation(w http.ResponseWriter, r *http.Request) {
+	var req ConversationRequest
+	if err := s.decode(w, r, &req); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if err := s.mem.UpdateConversationMetadata(r.Context(), r.PathValue("id"), req.Metadata); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	if err := s.mem.DeleteConversation(r.Context(), r.PathValue("id")); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetMessages(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	messages, err := s.mem.GetMessages(r.Context(), r.PathValue("id"), limit)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, MessagesResponse{Messages: nonNil(messages)})
+}
+
+func (s *Server) handleAddMessage(w http.ResponseWriter, r *http.Request) {
+	var msg llm.Message
+	if err := s.decode(w, r, &msg); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	if msg.Role == "" {
+		msg.Role = llm.RoleUser
+	}
+
+	if err := s.mem.AddMessage(r.Context(), r.PathValue("id"), msg); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, msg)
+}
+
+func (s *Server) handleClearMessages(w http.ResponseWriter, r *http.Request) {
+	if err := s.mem.ClearHistory(r.Context(), r.PathValue("id")); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// limit returns the requested number of documents, or the configured default
+func (s *Server) limit(requested int) int {
+	if requested > 0 {
+		return requested
+	}
+	return s.opts.SearchLimit
+}
+
+// decode reads a JSON request body into v. An empty body leaves v unchanged.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any) error {
+	body := http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes)
+	if err := json.NewDecoder(body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return invalidRequest("request body too large")
+		}
+		return invalidRequest("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, body := classify(err)
+	if status >= http.StatusInternalServerError {
+		s.opts.Logger.ErrorContext(r.Context(), "request failed",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"code", body.Code,
+			"error", err,
+		)
+	}
+	writeJSON(w, status, ErrorResponse{Error: body})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// queryInt parses an optional integer query parameter
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, invalidRequest(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// nonNil makes empty results encode as [] rather than null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,568 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/adapters/inmemory"
+	"github.com/Abraxas-365/kbservice/chathistory"
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/kb"
+	"github.com/Abraxas-365/kbservice/llm"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	vectors := make([][]float32, len(documents))
+	for i := range documents {
+		vectors[i] = []float32{1, 0}
+	}
+	return vectors, nil
+}
+
+func (fakeEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0}, nil
+}
+
+// fakeStore keeps documents in memory and returns all of them from every search
+type fakeStore struct {
+	mu   sync.Mutex
+	docs []vectorstore.Document
+}
+
+func (s *fakeStore) AddDocuments(ctx context.Context, docs []vectorstore.Document, vectors [][]float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		doc.Score = 0.9
+		s.docs = append(s.docs, doc)
+	}
+	return nil
+}
+
+func (s *fakeStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.docs) < limit {
+		limit = len(s.docs)
+	}
+	return append([]vectorstore.Document(nil), s.docs[:limit]...), nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, filter vectorstore.Filter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.docs[:0]
+	for _, doc := range s.docs {
+		if doc.Metadata["source"] != filter["source"] {
+			kept = append(kept, doc)
+		}
+	}
+	s.docs = kept
+	return nil
+}
+
+func (s *fakeStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return nil
+}
+
+func (s *fakeStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	return make([]bool, len(docs)), nil
+}
+
+func (s *fakeStore) ListSources(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[string]bool{}
+	var sources []string
+	for _, doc := range s.docs {
+		source := doc.Metadata["source"].(string)
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
+
+// plainStore is a fakeStore that can't list sources
+type plainStore struct {
+	vectorstore.Store
+}
+
+type wholeSplitter struct{}
+
+func (wholeSplitter) SplitText(text string) ([]string, error) {
+	return []string{text}, nil
+}
+
+// fakeLLM answers with a fixed reply and remembers the last messages it was sent
+type fakeLLM struct {
+	reply    string
+	err      error
+	messages []llm.Message
+	// block makes ChatStream wait for the request to be canceled after the first delta
+	block    bool
+	canceled chan struct{}
+	// truncated makes answers stop at the token limit
+	truncated bool
+}
+
+func (f *fakeLLM) stopReason() llm.StopReason {
+	if f.truncated {
+		return llm.StopReasonLength
+	}
+	return llm.StopReasonStop
+}
+
+func (f *fakeLLM) Chat(ctx context.Context, messages []llm.Message, opts ...llm.Option) (*llm.Message, error) {
+	f.messages = messages
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &llm.Message{Role: llm.RoleAssistant, Content: f.reply, StopReason: f.stopReason()}, nil
+}
+
+func (f *fakeLLM) ChatStream(ctx context.Context, messages []llm.Message, opts ...llm.Option) (<-chan llm.StreamResponse, error) {
+	f.messages = messages
+	stream := make(chan llm.StreamResponse)
+	go func() {
+		defer close(stream)
+		for _, word := range strings.SplitAfter(f.reply, " ") {
+			stream <- llm.StreamResponse{Message: llm.Message{Role: llm.RoleAssistant, Content: word}}
+			if f.block {
+				<-ctx.Done()
+				close(f.canceled)
+				stream <- llm.StreamResponse{Error: ctx.Err(), Done: true}
+				return
+			}
+		}
+		if f.err != nil {
+			stream <- llm.StreamResponse{Error: f.err, Done: true}
+			return
+		}
+		stream <- llm.StreamResponse{Message: llm.Message{StopReason: f.stopReason()}, Done: true}
+	}()
+	return stream, nil
+}
+
+func (f *fakeLLM) Complete(ctx context.Context, prompt string, opts ...llm.Option) (string, error) {
+	return f.reply, f.err
+}
+
+type testServer struct {
+	handler http.Handler
+	store   *fakeStore
+	mem     *chathistory.Memory
+	llm     *fakeLLM
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	t.Helper()
+	store := &fakeStore{}
+	knowledgeBase, err := kb.New(fakeEmbedder{}, store, wholeSplitter{})
+	if err != nil {
+		t.Fatalf("kb.New() error = %v", err)
+	}
+	mem := chathistory.New(inmemory.NewInMemoryRepository())
+	model := &fakeLLM{reply: "Paris is the capital"}
+	return &testServer{
+		handler: NewHTTPServer(knowledgeBase, mem, model, opts...),
+		store:   store,
+		mem:     mem,
+		llm:     model,
+	}
+}
+
+func (s *testServer) do(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestServer_DocumentsAndSources(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, http.MethodPost, "/documents", `{"source":"docs/france.md","text":"Paris is the capital of France","metadata":{"lang":"en"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /documents status = %d, body = %s", rec.Code, rec.Body)
+	}
+	s.do(t, http.MethodPost, "/documents", `{"source":"docs/spain.md","text":"Madrid is the capital of Spain"}`)
+
+	rec = s.do(t, http.MethodGet, "/sources", "")
+	sources := decodeBody[SourcesResponse](t, rec)
+	if rec.Code != http.StatusOK || strings.Join(sources.Sources, ",") != "docs/france.md,docs/spain.md" {
+		t.Fatalf("GET /sources = %d %v", rec.Code, sources.Sources)
+	}
+
+	rec = s.do(t, http.MethodDelete, "/sources/docs/france.md", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /sources status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	sources = decodeBody[SourcesResponse](t, s.do(t, http.MethodGet, "/sources", ""))
+	if strings.Join(sources.Sources, ",") != "docs/spain.md" {
+		t.Errorf("sources after delete = %v, want [docs/spain.md]", sources.Sources)
+	}
+
+	rec = s.do(t, http.MethodPost, "/documents", `{"text":"no source"}`)
+	if body := decodeBody[ErrorResponse](t, rec); rec.Code != http.StatusBadRequest || body.Error.Code != ErrCodeInvalidRequest {
+		t.Errorf("POST /documents without source = %d %+v", rec.Code, body)
+	}
+}
+
+func TestServer_ListSourcesNotSupported(t *testing.T) {
+	knowledgeBase, err := kb.New(fakeEmbedder{}, plainStore{&fakeStore{}}, wholeSplitter{})
+	if err != nil {
+		t.Fatalf("kb.New() error = %v", err)
+	}
+	handler := NewHTTPServer(knowledgeBase, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sources", nil))
+
+	body := decodeBody[ErrorResponse](t, rec)
+	if rec.Code != http.StatusNotImplemented || body.Error.Code != string(vectorstore.ErrCodeNotSupported) {
+		t.Errorf("GET /sources = %d %+v, want 501 %s", rec.Code, body, vectorstore.ErrCodeNotSupported)
+	}
+}
+
+func TestServer_Search(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, http.MethodPost, "/documents", `{"source":"a","text":"first"}`)
+	s.do(t, http.MethodPost, "/documents", `{"source":"b","text":"second"}`)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantDocs   int
+	}{
+		{name: "Default limit", body: `{"query":"capital"}`, wantStatus: http.StatusOK, wantDocs: 2},
+		{name: "Explicit limit", body: `{"query":"capital","limit":1}`, wantStatus: http.StatusOK, wantDocs: 1},
+		{name: "Missing query", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", body: `{"query":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodPost, "/search", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("POST /search status = %d, want %d, body = %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			resp := decodeBody[SearchResponse](t, rec)
+			if len(resp.Documents) != tt.wantDocs {
+				t.Errorf("got %d documents, want %d", len(resp.Documents), tt.wantDocs)
+			}
+		})
+	}
+}
+
+func TestServer_Query(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, http.MethodPost, "/documents", `{"source":"docs/france.md","text":"Paris is the capital of France"}`)
+	conv := decodeBody[chathistory.Conversation](t, s.do(t, http.MethodPost, "/conversations", `{}`))
+
+	rec := s.do(t, http.MethodPost, "/query", `{"query":"What is the capital of France?","conversation_id":"`+conv.ID+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /query status = %d, body = %s", rec.Code, rec.Body)
+	}
+	resp := decodeBody[QueryResponse](t, rec)
+	if resp.Answer.Content != "Paris is the capital" || len(resp.Sources) != 1 {
+		t.Errorf("POST /query = %+v", resp)
+	}
+
+	system := s.llm.messages[0]
+	if system.Role != llm.RoleSystem || !strings.Contains(system.Content, "Source: docs/france.md\nParis is the capital of France") {
+		t.Errorf("system prompt = %q, want retrieved context", system.Content)
+	}
+
+	messages, err := s.mem.GetMessages(context.Background(), conv.ID, 0)
+	if err != nil {
+		t.Fatalf("GetMessages() error = %v", err)
+	}
+	if len(messages) != 2 || messages[0].Role != llm.RoleUser || messages[1].Content != "Paris is the capital" {
+		t.Errorf("conversation = %+v, want question and answer", messages)
+	}
+
+	s.llm.err = &llm.LLMError{Op: "Chat", Message: "rate limit exceeded"}
+	rec = s.do(t, http.MethodPost, "/query", `{"query":"again"}`)
+	body := decodeBody[ErrorResponse](t, rec)
+	if rec.Code != http.StatusBadGateway || body.Error.Code != ErrCodeLLM || body.Error.Message != "rate limit exceeded" {
+		t.Errorf("POST /query with LLM error = %d %+v", rec.Code, body)
+	}
+}
+
+// sseEvent is one parsed server-sent event
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var event sseEvent
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, event)
+			event = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestServer_QueryStream(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, http.MethodPost, "/documents", `{"source":"docs/france.md","text":"Paris is the capital of France"}`)
+
+	rec := s.do(t, http.MethodPost, "/query", `{"query":"What is the capital of France?","stream":true}`)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("POST /query status = %d, content type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	events := readEvents(t, bufio.NewScanner(rec.Body), 100)
+	var names []string
+	for _, event := range events {
+		names = append(names, event.name)
+	}
+	if got := strings.Join(names, ","); got != "sources,message,message,message,message,done" {
+		t.Fatalf("events = %s", got)
+	}
+
+	var answer llm.Message
+	if err := json.Unmarshal([]byte(events[len(events)-1].data), &answer); err != nil {
+		t.Fatalf("invalid done event %q: %v", events[len(events)-1].data, err)
+	}
+	if answer.Content != "Paris is the capital" || answer.StopReason != llm.StopReasonStop {
+		t.Errorf("done event = %+v", answer)
+	}
+
+	s.llm.err = &llm.LLMError{Op: "ChatStream", Message: "stream error"}
+	rec = s.do(t, http.MethodPost, "/query", `{"query":"again","stream":true}`)
+	events = readEvents(t, bufio.NewScanner(rec.Body), 100)
+	last := events[len(events)-1]
+	if last.name != EventError || !strings.Contains(last.data, ErrCodeLLM) {
+		t.Errorf("last event = %+v, want %s with %s", last, EventError, ErrCodeLLM)
+	}
+}
+
+func TestServer_QueryWarnsWhenTruncated(t *testing.T) {
+	s := newTestServer(t)
+	s.do(t, http.MethodPost, "/documents", `{"source":"docs/france.md","text":"Paris is the capital of France"}`)
+
+	resp := decodeBody[QueryResponse](t, s.do(t, http.MethodPost, "/query", `{"query":"capital?"}`))
+	if resp.Warning != "" {
+		t.Errorf("warning = %q for a complete answer, want none", resp.Warning)
+	}
+
+	s.llm.truncated = true
+	resp = decodeBody[QueryResponse](t, s.do(t, http.MethodPost, "/query", `{"query":"capital?"}`))
+	if resp.Warning != kb.TruncatedAnswerWarning {
+		t.Errorf("warning = %q, want %q", resp.Warning, kb.TruncatedAnswerWarning)
+	}
+
+	rec := s.do(t, http.MethodPost, "/query", `{"query":"capital?","stream":true}`)
+	events := readEvents(t, bufio.NewScanner(rec.Body), 100)
+	if len(events) < 2 || events[len(events)-2].name != EventWarning {
+		t.Fatalf("events = %+v, want a warning before done", events)
+	}
+	var warning string
+	if err := json.Unmarshal([]byte(events[len(events)-2].data), &warning); err != nil || warning != kb.TruncatedAnswerWarning {
+		t.Errorf("warning event = %q, want %q", events[len(events)-2].data, kb.TruncatedAnswerWarning)
+	}
+}
+
+func TestServer_QueryRefusesWithoutContext(t *testing.T) {
+	knowledgeBase, err := kb.New(fakeEmbedder{}, &fakeStore{}, wholeSplitter{}, kb.WithRefuseWithoutContext(true))
+	if err != nil {
+		t.Fatalf("kb.New() error = %v", err)
+	}
+	model := &fakeLLM{reply: "made up"}
+	handler := NewHTTPServer(knowledgeBase, nil, model)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query":"capital?"}`)))
+	body := decodeBody[ErrorResponse](t, rec)
+	if rec.Code != http.StatusUnprocessableEntity || body.Error.Code != ErrCodeNoRelevantContext {
+		t.Errorf("POST /query status = %d, body = %+v, want 422 %s", rec.Code, body, ErrCodeNoRelevantContext)
+	}
+	if model.messages != nil {
+		t.Error("the LLM was asked to answer without context")
+	}
+}
+
+func TestServer_QueryStreamHonorsCancellation(t *testing.T) {
+	s := newTestServer(t)
+	s.llm.block = true
+	s.llm.canceled = make(chan struct{})
+	server := httptest.NewServer(s.handler)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/query", strings.NewReader(`{"query":"q","stream":true}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST /query error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	events := readEvents(t, bufio.NewScanner(resp.Body), 2)
+	if len(events) != 2 || events[1].name != EventMessage {
+		t.Fatalf("events = %+v, want sources and a message", events)
+	}
+
+	cancel()
+	<-s.llm.canceled
+}
+
+func TestServer_Conversations(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(t, http.MethodPost, "/conversations", `{"metadata":{"user":"u1"}}`)
+	conv := decodeBody[chathistory.Conversation](t, rec)
+	if rec.Code != http.StatusCreated || conv.ID == "" {
+		t.Fatalf("POST /conversations = %d %+v", rec.Code, conv)
+	}
+	path := "/conversations/" + conv.ID
+
+	if rec := s.do(t, http.MethodPost, path+"/messages", `{"content":"hello"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST messages status = %d, body = %s", rec.Code, rec.Body)
+	}
+	messages := decodeBody[MessagesResponse](t, s.do(t, http.MethodGet, path+"/messages", ""))
+	if len(messages.Messages) != 1 || messages.Messages[0].Role != llm.RoleUser {
+		t.Errorf("GET messages = %+v, want one user message", messages.Messages)
+	}
+
+	if rec := s.do(t, http.MethodPatch, path, `{"metadata":{"user":"u2"}}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("PATCH conversation status = %d, body = %s", rec.Code, rec.Body)
+	}
+	got := decodeBody[chathistory.Conversation](t, s.do(t, http.MethodGet, path, ""))
+	if got.Metadata["user"] != "u2" {
+		t.Errorf("GET conversation metadata = %v, want user u2", got.Metadata)
+	}
+
+	list := decodeBody[ConversationsResponse](t, s.do(t, http.MethodGet, "/conversations?limit=10", ""))
+	if len(list.Conversations) != 1 {
+		t.Errorf("GET /conversations = %d conversations, want 1", len(list.Conversations))
+	}
+
+	if rec := s.do(t, http.MethodDelete, path+"/messages", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE messages status = %d", rec.Code)
+	}
+	if rec := s.do(t, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE conversation status = %d", rec.Code)
+	}
+
+	rec = s.do(t, http.MethodGet, path, "")
+	body := decodeBody[ErrorResponse](t, rec)
+	if rec.Code != http.StatusNotFound || body.Error.Code != ErrCodeConversationNotFound {
+		t.Errorf("GET deleted conversation = %d %+v", rec.Code, body)
+	}
+
+	if rec := s.do(t, http.MethodGet, "/conversations?limit=x", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /conversations?limit=x status = %d, want 400", rec.Code)
+	}
+}
+
+func TestServer_Middleware(t *testing.T) {
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	s := newTestServer(t, WithMiddleware(auth))
+
+	if rec := s.do(t, http.MethodGet, "/conversations", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want 401", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/conversations", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("authenticated status = %d, want 200", rec.Code)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "Invalid filter",
+			err:        vectorstore.NewInvalidFilterError("pg", "bad key"),
+			wantStatus: http.StatusBadRequest,
+			wantCode:   string(vectorstore.ErrCodeInvalidFilter),
+		},
+		{
+			name:       "Embedding rate limit",
+			err:        &embedding.EmbeddingError{Op: "EmbedQuery", Code: embedding.ErrCodeRateLimitExceeded},
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   embedding.ErrCodeRateLimitExceeded,
+		},
+		{
+			name:       "Deadline exceeded",
+			err:        context.DeadlineExceeded,
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   ErrCodeTimeout,
+		},
+		{
+			name:       "Untyped errors are not exposed",
+			err:        errors.New("connection string with password"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := classify(tt.err)
+			if status != tt.wantStatus || body.Code != tt.wantCode {
+				t.Errorf("classify() = %d %s, want %d %s", status, body.Code, tt.wantStatus, tt.wantCode)
+			}
+			if strings.Contains(body.Message, "password") {
+				t.Errorf("classify() exposed the error: %q", body.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+)
+
+// sniffLen is how much content http.DetectContentType looks at
+const sniffLen = 512
+
+// WithAutoContentType infers the content type when none is set with
+// WithContentType: from the key's extension, or else by sniffing the first
+// 512 bytes of the data. Without it stores apply their own default, such as
+// binary/octet-stream on S3.
+func WithAutoContentType() PutOption {
+	return func(o *PutOptions) {
+		o.AutoContentType = true
+	}
+}
+
+// WithPresignedAutoContentType infers the content type from the key's
+// extension when none is set with WithPresignedContentType
+func WithPresignedAutoContentType() PresignedPutOption {
+	return func(o *PresignedPutOptions) {
+		o.AutoContentType = true
+	}
+}
+
+// ContentTypeByExtension returns the MIME type registered for the key's
+// extension, or "" if it has none or the extension is unknown
+func ContentTypeByExtension(key string) string {
+	ext := path.Ext(key)
+	if ext == "" {
+		return ""
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// ResolveContentType applies WithAutoContentType, setting ContentType when it
+// is empty. Sniffing reads the start of data, so stores must upload the
+// returned reader instead of data.
+func (o *PutOptions) ResolveContentType(key string, data io.Reader) (io.Reader, error) {
+	if o.ContentType != "" || !o.AutoContentType {
+		return data, nil
+	}
+
+	if contentType := ContentTypeByExtension(key); contentType != "" {
+		o.ContentType = contentType
+		return data, nil
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(data, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, NewStorageError("Put", key, err, ErrCodeInternal, "failed to read data")
+	}
+	head = head[:n]
+
+	o.ContentType = http.DetectContentType(head)
+	return io.MultiReader(bytes.NewReader(head), data), nil
+}
+
+// ResolveContentType applies WithPresignedAutoContentType, setting ContentType
+// from the key's extension when it is empty
+func (o *PresignedPutOptions) ResolveContentType(key string) {
+	if o.ContentType == "" && o.AutoContentType {
+		o.ContentType = ContentTypeByExtension(key)
+	}
+}
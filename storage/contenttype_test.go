@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"io"
+	"mime"
+	"strings"
+	"testing"
+)
+
+// mediaType strips parameters such as charset, which depend on the system's MIME tables
+func mediaType(t *testing.T, contentType string) string {
+	t.Helper()
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("mime.ParseMediaType(%q) error = %v", contentType, err)
+	}
+	return mediaType
+}
+
+func TestPutOptions_ResolveContentType(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n"
+
+	tests := []struct {
+		name string
+		key  string
+		data string
+		opts []PutOption
+		want string
+	}{
+		{name: "html extension", key: "site/index.html", data: "<p>hi</p>", opts: []PutOption{WithAutoContentType()}, want: "text/html"},
+		{name: "json extension", key: "data/report.json", data: "{}", opts: []PutOption{WithAutoContentType()}, want: "application/json"},
+		{name: "png extension", key: "images/logo.png", data: pngHeader, opts: []PutOption{WithAutoContentType()}, want: "image/png"},
+		{name: "sniffed png", key: "images/logo", data: pngHeader + "rest", opts: []PutOption{WithAutoContentType()}, want: "image/png"},
+		{name: "sniffed html", key: "uploads/page", data: "<!DOCTYPE html><html></html>", opts: []PutOption{WithAutoContentType()}, want: "text/html"},
+		{name: "explicit type wins", key: "data/report.json", data: "{}", opts: []PutOption{WithContentType("text/plain"), WithAutoContentType()}, want: "text/plain"},
+		{name: "disabled", key: "data/report.json", data: "{}", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PutOptions{}
+			for _, opt := range tt.opts {
+				opt(opts)
+			}
+
+			data, err := opts.ResolveContentType(tt.key, strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("ResolveContentType() error = %v", err)
+			}
+
+			got := opts.ContentType
+			if got != "" {
+				got = mediaType(t, got)
+			}
+			if got != tt.want {
+				t.Errorf("ContentType = %q, want %q", got, tt.want)
+			}
+
+			// Sniffing must not consume the data
+			content, err := io.ReadAll(data)
+			if err != nil {
+				t.Fatalf("io.ReadAll() error = %v", err)
+			}
+			if string(content) != tt.data {
+				t.Errorf("data = %q, want %q", content, tt.data)
+			}
+		})
+	}
+}
+
+func TestPresignedPutOptions_ResolveContentType(t *testing.T) {
+	opts := &PresignedPutOptions{}
+	WithPresignedAutoContentType()(opts)
+	opts.ResolveContentType("uploads/photo.png")
+	if opts.ContentType != "image/png" {
+		t.Errorf("ContentType = %q, want image/png", opts.ContentType)
+	}
+
+	opts = &PresignedPutOptions{}
+	opts.ResolveContentType("uploads/photo.png")
+	if opts.ContentType != "" {
+		t.Errorf("ContentType without auto detection = %q, want empty", opts.ContentType)
+	}
+}
@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"fmt"
+	"strings"
+)
+
 // StorageError represents errors that can occur during storage operations
 type StorageError struct {
 	Op      string
@@ -30,6 +35,8 @@ const (
 	ErrCodePermissionDenied = "PermissionDenied"
 	ErrCodeUnauthenticated  = "Unauthenticated"
 	ErrCodeInternal         = "Internal"
+	ErrCodeUnsupported      = "Unsupported"
+	ErrCodeIntegrity        = "Integrity"
 )
 
 // NewStorageError creates a new StorageError
@@ -42,3 +49,27 @@ func NewStorageError(op, key string, err error, code, message string) *StorageEr
 		Message: message,
 	}
 }
+
+// MultiDeleteError reports the keys a bulk delete failed to remove
+type MultiDeleteError struct {
+	Op     string
+	Errors []*StorageError
+}
+
+// Error implements the error interface
+func (e *MultiDeleteError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		keys = append(keys, err.Key)
+	}
+	return fmt.Sprintf("storage.%s: failed to delete %d objects: %s", e.Op, len(e.Errors), strings.Join(keys, ", "))
+}
+
+// Unwrap returns the per-key errors
+func (e *MultiDeleteError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// EnforceAllowedExtensions applies WithPresignedAllowedExtensions before a
+// URL is presigned. It returns an ErrCodeInvalidArgument error when the key's
+// extension isn't allowed, including keys without one. When a content type
+// can be inferred from the extension, it becomes the signed ContentType, and a
+// ContentType set with WithPresignedContentType must agree with it, so the
+// upload can't be served as something else, e.g. HTML uploaded as a .pdf.
+//
+// A presigned PUT URL is only valid for the key it was signed for, but its
+// body isn't checked: this guards the key and content type, not the bytes a
+// client uploads.
+func (o *PresignedPutOptions) EnforceAllowedExtensions(op, key string) error {
+	if len(o.AllowedExtensions) == 0 {
+		return nil
+	}
+
+	ext, ok := matchExtension(key, o.AllowedExtensions)
+	if !ok {
+		return NewStorageError(op, key, nil, ErrCodeInvalidArgument,
+			fmt.Sprintf("extension not allowed, want one of %s", strings.Join(o.AllowedExtensions, ", ")))
+	}
+
+	inferred := mime.TypeByExtension(path.Ext(ext))
+	if inferred == "" {
+		return nil
+	}
+	if o.ContentType == "" {
+		o.ContentType = inferred
+		return nil
+	}
+	if !sameMediaType(o.ContentType, inferred) {
+		return NewStorageError(op, key, nil, ErrCodeInvalidArgument,
+			fmt.Sprintf("content type %s does not match extension %s", o.ContentType, ext))
+	}
+	return nil
+}
+
+// matchExtension returns the allowed extension key ends with, compared
+// without case. Extensions may be given with or without the leading dot and
+// may have several parts, such as "tar.gz".
+func matchExtension(key string, allowed []string) (string, bool) {
+	name := strings.ToLower(path.Base(key))
+	for _, ext := range allowed {
+		ext = "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+		if ext != "." && len(name) > len(ext) && strings.HasSuffix(name, ext) {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// sameMediaType reports whether two content types name the same media type,
+// ignoring parameters such as charset
+func sameMediaType(a, b string) bool {
+	aType, _, errA := mime.ParseMediaType(a)
+	bType, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && aType == bType
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPresignedPutOptions_EnforceAllowedExtensions(t *testing.T) {
+	tests := []struct {
+		name            string
+		key             string
+		allowed         []string
+		contentType     string
+		wantErr         bool
+		wantContentType string
+	}{
+		{name: "No allow-list", key: "uploads/run.exe", wantContentType: ""},
+		{name: "Allowed", key: "uploads/report.pdf", allowed: []string{"pdf", "docx"}, wantContentType: "application/pdf"},
+		{name: "Leading dot and case are ignored", key: "uploads/REPORT.PDF", allowed: []string{".Pdf"}, wantContentType: "application/pdf"},
+		{name: "Several parts", key: "static/app.min.js", allowed: []string{"min.js"}, wantContentType: "text/javascript"},
+		{name: "Unknown type is not constrained", key: "notes/todo.kbnote", allowed: []string{"kbnote"}, wantContentType: ""},
+		{name: "Matching content type", key: "data/rows.json", allowed: []string{"json"}, contentType: "application/json; charset=utf-8", wantContentType: "application/json"},
+		{name: "Disallowed", key: "uploads/run.exe", allowed: []string{"pdf"}, wantErr: true},
+		{name: "Extension-less", key: "uploads/pdf", allowed: []string{"pdf"}, wantErr: true},
+		{name: "Dotfile", key: "uploads/.pdf", allowed: []string{"pdf"}, wantErr: true},
+		{name: "Extension in a directory", key: "uploads.pdf/run.exe", allowed: []string{"pdf"}, wantErr: true},
+		{name: "Conflicting content type", key: "uploads/report.pdf", allowed: []string{"pdf"}, contentType: "text/html", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &PresignedPutOptions{}
+			WithPresignedAllowedExtensions(tt.allowed)(opts)
+			if tt.contentType != "" {
+				WithPresignedContentType(tt.contentType)(opts)
+			}
+
+			err := opts.EnforceAllowedExtensions("GetPresignedPutURL", tt.key)
+			if tt.wantErr {
+				var storageErr *StorageError
+				if !errors.As(err, &storageErr) || storageErr.Code != ErrCodeInvalidArgument || storageErr.Key != tt.key {
+					t.Errorf("EnforceAllowedExtensions() error = %v, want %s for %s", err, ErrCodeInvalidArgument, tt.key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnforceAllowedExtensions() error = %v", err)
+			}
+			got := opts.ContentType
+			if got != "" {
+				got = mediaType(t, got)
+			}
+			if got != tt.wantContentType {
+				t.Errorf("ContentType = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+)
+
+// PutVerified uploads data with its MD5 digest and SHA-256 checksum, so the
+// store rejects the upload with ErrCodeIntegrity if it was corrupted in transit
+func PutVerified(ctx context.Context, store DataStore, key string, data io.ReadSeeker, options ...PutOption) error {
+	start, err := data.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return NewStorageError("PutVerified", key, err, ErrCodeInvalidArgument, "failed to read data position")
+	}
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), data); err != nil {
+		return NewStorageError("PutVerified", key, err, ErrCodeInternal, "failed to compute checksum")
+	}
+
+	if _, err := data.Seek(start, io.SeekStart); err != nil {
+		return NewStorageError("PutVerified", key, err, ErrCodeInternal, "failed to rewind data")
+	}
+
+	options = append(options,
+		WithContentMD5(md5Hash.Sum(nil)),
+		WithChecksumSHA256(base64.StdEncoding.EncodeToString(sha256Hash.Sum(nil))),
+	)
+
+	return store.Put(ctx, key, data, options...)
+}
+
+// VerifyChecksums checks content against the checksums set in the options.
+// It's meant for stores that can't have the backend verify uploads for them.
+func (o *PutOptions) VerifyChecksums(op, key string, content io.Reader) error {
+	if o.ContentMD5 == nil && o.ChecksumSHA256 == "" {
+		return nil
+	}
+
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), content); err != nil {
+		return NewStorageError(op, key, err, ErrCodeInternal, "failed to compute checksum")
+	}
+
+	if o.ContentMD5 != nil && !bytes.Equal(o.ContentMD5, md5Hash.Sum(nil)) {
+		return NewStorageError(op, key, nil, ErrCodeIntegrity, "content MD5 mismatch")
+	}
+
+	if o.ChecksumSHA256 != "" && o.ChecksumSHA256 != base64.StdEncoding.EncodeToString(sha256Hash.Sum(nil)) {
+		return NewStorageError(op, key, nil, ErrCodeIntegrity, "SHA-256 checksum mismatch")
+	}
+
+	return nil
+}
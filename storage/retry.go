@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// RetryOptions contains configuration for RetryStore
+type RetryOptions struct {
+	// MaxRetries is how many times a failed operation is retried
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled on every further retry
+	Backoff time.Duration
+	// Timeout bounds every attempt of an operation (0 for no timeout)
+	Timeout time.Duration
+	// OnRetry is called before every retry, e.g. to count retries in metrics
+	OnRetry func(op string, attempt int, err error)
+}
+
+// RetryOption is a function type to modify RetryOptions
+type RetryOption func(*RetryOptions)
+
+// WithMaxRetries sets how many times a failed operation is retried
+func WithMaxRetries(retries int) RetryOption {
+	return func(o *RetryOptions) {
+		o.MaxRetries = retries
+	}
+}
+
+// WithBackoff sets the delay before the first retry
+func WithBackoff(backoff time.Duration) RetryOption {
+	return func(o *RetryOptions) {
+		o.Backoff = backoff
+	}
+}
+
+// WithTimeout sets the timeout applied to every attempt of an operation
+func WithTimeout(timeout time.Duration) RetryOption {
+	return func(o *RetryOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// WithRetryHook sets a function called before every retry
+func WithRetryHook(hook func(op string, attempt int, err error)) RetryOption {
+	return func(o *RetryOptions) {
+		o.OnRetry = hook
+	}
+}
+
+// RetryStore wraps a DataStore, retrying operations that fail with transient errors
+type RetryStore struct {
+	inner DataStore
+	opts  *RetryOptions
+}
+
+// NewRetryStore creates a RetryStore around inner
+func NewRetryStore(inner DataStore, opts ...RetryOption) *RetryStore {
+	options := &RetryOptions{
+		MaxRetries: 3,
+		Backoff:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	return &RetryStore{
+		inner: inner,
+		opts:  options,
+	}
+}
+
+// isRetryable reports whether err is a transient failure. Only internal errors
+// are retried; bulk delete failures are reported per key and never retried.
+func isRetryable(err error) bool {
+	var multiErr *MultiDeleteError
+	if errors.As(err, &multiErr) {
+		return false
+	}
+
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.Code == ErrCodeInternal
+	}
+
+	return !errors.Is(err, context.Canceled)
+}
+
+// attemptContext derives the context for a single attempt
+func (r *RetryStore) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.opts.Timeout > 0 {
+		return context.WithTimeout(ctx, r.opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// retry runs fn until it succeeds, fails with a permanent error, or runs out of retries.
+// before is called ahead of every retry and may abort it by returning an error.
+func (r *RetryStore) retry(ctx context.Context, op string, fn func(ctx context.Context) error, before func() error) error {
+	return r.retryAttempts(ctx, op, func(ctx context.Context, cancel context.CancelFunc) error {
+		defer cancel()
+		return fn(ctx)
+	}, before)
+}
+
+// retryAttempts is retry for attempts that own their context: fn must call
+// cancel once it no longer needs the context, which may be after it returns.
+func (r *RetryStore) retryAttempts(ctx context.Context, op string, fn func(ctx context.Context, cancel context.CancelFunc) error, before func() error) error {
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		err := fn(attemptCtx, cancel)
+
+		if err == nil || attempt >= r.opts.MaxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		if before != nil {
+			if beforeErr := before(); beforeErr != nil {
+				return beforeErr
+			}
+		}
+
+		if r.opts.OnRetry != nil {
+			r.opts.OnRetry(op, attempt+1, err)
+		}
+
+		timer := time.NewTimer(r.opts.Backoff << attempt)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Put retries only when data is an io.ReadSeeker, rewinding it before every retry.
+// Other readers are uploaded once, since a partially consumed body can't be resent.
+func (r *RetryStore) Put(ctx context.Context, key string, data io.Reader, options ...PutOption) error {
+	seeker, ok := data.(io.ReadSeeker)
+	if !ok {
+		attemptCtx, cancel := r.attemptContext(ctx)
+		defer cancel()
+
+		err := r.inner.Put(attemptCtx, key, data, options...)
+		if err != nil && isRetryable(err) {
+			return NewStorageError("Put", key, err, ErrCodeInternal,
+				"put failed and was not retried because the data is not an io.ReadSeeker")
+		}
+		return err
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return NewStorageError("Put", key, err, ErrCodeInvalidArgument, "failed to read data position")
+	}
+
+	return r.retry(ctx, "Put", func(ctx context.Context) error {
+		return r.inner.Put(ctx, key, seeker, options...)
+	}, func() error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return NewStorageError("Put", key, err, ErrCodeInternal, "failed to rewind data for retry")
+		}
+		return nil
+	})
+}
+
+// cancelOnClose releases an attempt's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// Get keeps the attempt's context alive until the returned body is closed,
+// so the timeout also covers reading the object.
+func (r *RetryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := r.retryAttempts(ctx, "Get", func(ctx context.Context, cancel context.CancelFunc) error {
+		rc, err := r.inner.Get(ctx, key)
+		if err != nil {
+			cancel()
+			return err
+		}
+		body = &cancelOnClose{ReadCloser: rc, cancel: cancel}
+		return nil
+	}, nil)
+	return body, err
+}
+
+func (r *RetryStore) Delete(ctx context.Context, key string) error {
+	return r.retry(ctx, "Delete", func(ctx context.Context) error {
+		return r.inner.Delete(ctx, key)
+	}, nil)
+}
+
+func (r *RetryStore) DeleteMany(ctx context.Context, keys []string) error {
+	return r.retry(ctx, "DeleteMany", func(ctx context.Context) error {
+		return r.inner.DeleteMany(ctx, keys)
+	}, nil)
+}
+
+func (r *RetryStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	deleted := 0
+	err := r.retry(ctx, "DeletePrefix", func(ctx context.Context) error {
+		n, err := r.inner.DeletePrefix(ctx, prefix)
+		deleted += n
+		return err
+	}, nil)
+	return deleted, err
+}
+
+func (r *RetryStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := r.retry(ctx, "List", func(ctx context.Context) error {
+		var err error
+		objects, err = r.inner.List(ctx, prefix)
+		return err
+	}, nil)
+	return objects, err
+}
+
+func (r *RetryStore) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := r.retry(ctx, "Exists", func(ctx context.Context) error {
+		var err error
+		exists, err = r.inner.Exists(ctx, key)
+		return err
+	}, nil)
+	return exists, err
+}
+
+func (r *RetryStore) GetPresignedPutURL(ctx context.Context, key string, expires time.Duration, options ...PresignedPutOption) (PresignedURL, error) {
+	var presigned PresignedURL
+	err := r.retry(ctx, "GetPresignedPutURL", func(ctx context.Context) error {
+		var err error
+		presigned, err = r.inner.GetPresignedPutURL(ctx, key, expires, options...)
+		return err
+	}, nil)
+	return presigned, err
+}
+
+func (r *RetryStore) GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (PresignedURL, error) {
+	var presigned PresignedURL
+	err := r.retry(ctx, "GetPresignedGetURL", func(ctx context.Context) error {
+		var err error
+		presigned, err = r.inner.GetPresignedGetURL(ctx, key, expires)
+		return err
+	}, nil)
+	return presigned, err
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyStore fails the first failures calls of every operation with err
+type flakyStore struct {
+	DataStore
+	failures int
+	err      error
+	calls    int
+	puts     []string
+	ctxs     []context.Context
+}
+
+func (s *flakyStore) fail(ctx context.Context) error {
+	s.calls++
+	s.ctxs = append(s.ctxs, ctx)
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyStore) Put(ctx context.Context, key string, data io.Reader, options ...PutOption) error {
+	content, _ := io.ReadAll(data)
+	s.puts = append(s.puts, string(content))
+	return s.fail(ctx)
+}
+
+func (s *flakyStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := s.fail(ctx); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func (s *flakyStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := s.fail(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *flakyStore) DeleteMany(ctx context.Context, keys []string) error {
+	return s.fail(ctx)
+}
+
+func (s *flakyStore) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if err := s.fail(ctx); err != nil {
+		return 1, err
+	}
+	return 2, nil
+}
+
+func TestRetryStore_Exists(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "Transient error is retried",
+			failures:  2,
+			err:       NewStorageError("Exists", "key", nil, ErrCodeInternal, "boom"),
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "Retries are exhausted",
+			failures:  10,
+			err:       NewStorageError("Exists", "key", nil, ErrCodeInternal, "boom"),
+			wantCalls: 4,
+			wantErr:   true,
+		},
+		{
+			name:      "Not found is not retried",
+			failures:  10,
+			err:       NewStorageError("Exists", "key", nil, ErrCodeNotFound, "missing"),
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "Invalid argument is not retried",
+			failures:  10,
+			err:       NewStorageError("Exists", "key", nil, ErrCodeInvalidArgument, "bad key"),
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &flakyStore{failures: tt.failures, err: tt.err}
+			var retries []int
+			store := NewRetryStore(inner,
+				WithMaxRetries(3),
+				WithBackoff(time.Millisecond),
+				WithRetryHook(func(op string, attempt int, err error) {
+					if op != "Exists" {
+						t.Errorf("retry hook op = %q, want Exists", op)
+					}
+					retries = append(retries, attempt)
+				}),
+			)
+
+			_, err := store.Exists(context.Background(), "key")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Exists() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if inner.calls != tt.wantCalls {
+				t.Errorf("Exists() made %d calls, want %d", inner.calls, tt.wantCalls)
+			}
+			if len(retries) != tt.wantCalls-1 {
+				t.Errorf("retry hook called %d times, want %d", len(retries), tt.wantCalls-1)
+			}
+		})
+	}
+}
+
+func TestRetryStore_PutRewindsSeeker(t *testing.T) {
+	inner := &flakyStore{failures: 2, err: NewStorageError("Put", "key", nil, ErrCodeInternal, "boom")}
+	store := NewRetryStore(inner, WithBackoff(time.Millisecond))
+
+	if err := store.Put(context.Background(), "key", bytes.NewReader([]byte("payload"))); err != nil {
+		t.Fatalf("Put() unexpected error = %v", err)
+	}
+	if len(inner.puts) != 3 {
+		t.Fatalf("Put() made %d calls, want 3", len(inner.puts))
+	}
+	for i, body := range inner.puts {
+		if body != "payload" {
+			t.Errorf("attempt %d uploaded %q, want %q", i, body, "payload")
+		}
+	}
+}
+
+func TestRetryStore_PutFailsFastWithoutSeeker(t *testing.T) {
+	inner := &flakyStore{failures: 2, err: NewStorageError("Put", "key", nil, ErrCodeInternal, "boom")}
+	store := NewRetryStore(inner, WithBackoff(time.Millisecond))
+
+	err := store.Put(context.Background(), "key", io.NopCloser(strings.NewReader("payload")))
+	if err == nil {
+		t.Fatal("Put() error = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "io.ReadSeeker") {
+		t.Errorf("Put() error = %v, want it to mention io.ReadSeeker", err)
+	}
+	if len(inner.puts) != 1 {
+		t.Errorf("Put() made %d calls, want 1", len(inner.puts))
+	}
+}
+
+func TestRetryStore_GetKeepsContextUntilClose(t *testing.T) {
+	inner := &flakyStore{}
+	store := NewRetryStore(inner, WithTimeout(time.Minute))
+
+	body, err := store.Get(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("Get() unexpected error = %v", err)
+	}
+
+	ctx := inner.ctxs[0]
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("Get() attempt context has no deadline")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("Get() canceled the context before the body was closed: %v", ctx.Err())
+	}
+	body.Close()
+	if ctx.Err() == nil {
+		t.Error("Get() body Close did not release the context")
+	}
+}
+
+func TestRetryStore_GetRetriesWithAttemptContext(t *testing.T) {
+	inner := &flakyStore{failures: 1, err: NewStorageError("Get", "key", nil, ErrCodeInternal, "boom")}
+	store := NewRetryStore(inner, WithTimeout(time.Minute), WithBackoff(time.Millisecond))
+
+	body, err := store.Get(context.Background(), "key")
+	if err != nil {
+		t.Fatalf("Get() unexpected error = %v", err)
+	}
+	defer body.Close()
+
+	if len(inner.ctxs) != 2 {
+		t.Fatalf("Get() made %d attempts, want 2", len(inner.ctxs))
+	}
+	for i, ctx := range inner.ctxs {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("Get() attempt %d context has no deadline", i)
+		}
+	}
+	if inner.ctxs[0].Err() == nil {
+		t.Error("Get() did not release the failed attempt's context")
+	}
+	if inner.ctxs[1].Err() != nil {
+		t.Errorf("Get() canceled the successful attempt's context: %v", inner.ctxs[1].Err())
+	}
+}
+
+func TestRetryStore_Deletes(t *testing.T) {
+	transient := NewStorageError("DeletePrefix", "tenant/", nil, ErrCodeInternal, "boom")
+
+	inner := &flakyStore{failures: 1, err: transient}
+	store := NewRetryStore(inner, WithBackoff(time.Millisecond))
+	count, err := store.DeletePrefix(context.Background(), "tenant/")
+	if err != nil {
+		t.Fatalf("DeletePrefix() unexpected error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("DeletePrefix() = %d, want 3 across attempts", count)
+	}
+
+	// Per-key failures are reported as-is rather than retried
+	multiErr := &MultiDeleteError{Op: "DeleteMany", Errors: []*StorageError{
+		NewStorageError("DeleteMany", "a", nil, ErrCodeInternal, "boom"),
+	}}
+	inner = &flakyStore{failures: 10, err: multiErr}
+	store = NewRetryStore(inner, WithBackoff(time.Millisecond))
+	err = store.DeleteMany(context.Background(), []string{"a", "b"})
+	if !errors.Is(err, multiErr) {
+		t.Errorf("DeleteMany() error = %v, want %v", err, multiErr)
+	}
+	if inner.calls != 1 {
+		t.Errorf("DeleteMany() made %d calls, want 1", inner.calls)
+	}
+}
+
+func TestRetryStore_StopsOnCancel(t *testing.T) {
+	inner := &flakyStore{failures: 10, err: NewStorageError("Exists", "key", nil, ErrCodeInternal, "boom")}
+	store := NewRetryStore(inner, WithBackoff(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store.opts.OnRetry = func(string, int, error) { cancel() }
+
+	if _, err := store.Exists(ctx, "key"); err == nil {
+		t.Fatal("Exists() error = nil, want error")
+	}
+	if inner.calls != 1 {
+		t.Errorf("Exists() made %d calls, want 1", inner.calls)
+	}
+}
@@ -14,6 +14,8 @@ type ObjectInfo struct {
 	ETag         string
 	ContentType  string
 	Metadata     map[string]string
+	VersionID    string // Set by stores with object versioning
+	IsLatest     bool   // Whether VersionID is the current version of the object
 }
 
 // DataStore represents a generic interface for object storage operations
@@ -21,6 +23,10 @@ type DataStore interface {
 	Put(ctx context.Context, key string, data io.Reader, options ...PutOption) error
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
+	// DeleteMany removes all keys, returning a *MultiDeleteError listing the keys that failed
+	DeleteMany(ctx context.Context, keys []string) error
+	// DeletePrefix removes every object under prefix and returns how many were removed
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
 	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
 	Exists(ctx context.Context, key string) (bool, error)
 
@@ -28,6 +34,15 @@ type DataStore interface {
 	GetPresignedGetURL(ctx context.Context, key string, expires time.Duration) (PresignedURL, error)
 }
 
+// VersionedStore is implemented by stores that keep every version of an object.
+// An empty versionID refers to the latest version.
+type VersionedStore interface {
+	GetVersion(ctx context.Context, key, versionID string) (io.ReadCloser, error)
+	DeleteVersion(ctx context.Context, key, versionID string) error
+	// ListVersions returns one ObjectInfo per stored version, with VersionID set
+	ListVersions(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
 // PutOption allows customizing Put operations
 type PutOption func(*PutOptions)
 
@@ -38,6 +53,12 @@ type PutOptions struct {
 	CacheControl       string
 	ContentEncoding    string
 	ContentDisposition string
+	SSEKMSKeyID        string
+	StorageClass       string
+	ContentMD5         []byte
+	ChecksumSHA256     string
+	Gzip               bool
+	AutoContentType    bool // Infer ContentType when it is empty, see WithAutoContentType
 }
 
 // WithContentType sets the content type for the object
@@ -75,6 +96,48 @@ func WithContentDisposition(contentDisposition string) PutOption {
 	}
 }
 
+// WithSSE requests server-side encryption with the given KMS key.
+// Stores without server-side encryption support ignore it.
+func WithSSE(kmsKeyID string) PutOption {
+	return func(o *PutOptions) {
+		o.SSEKMSKeyID = kmsKeyID
+	}
+}
+
+// WithStorageClass sets the storage class for the object (e.g. "STANDARD_IA").
+// Stores without storage classes ignore it.
+func WithStorageClass(storageClass string) PutOption {
+	return func(o *PutOptions) {
+		o.StorageClass = storageClass
+	}
+}
+
+// WithContentMD5 sets the expected MD5 digest of the data.
+// The store rejects the upload with ErrCodeIntegrity if it doesn't match.
+func WithContentMD5(md5 []byte) PutOption {
+	return func(o *PutOptions) {
+		o.ContentMD5 = md5
+	}
+}
+
+// WithChecksumSHA256 sets the expected base64-encoded SHA-256 checksum of the data.
+// The store rejects the upload with ErrCodeIntegrity if it doesn't match.
+func WithChecksumSHA256(b64 string) PutOption {
+	return func(o *PutOptions) {
+		o.ChecksumSHA256 = b64
+	}
+}
+
+// WithGzip compresses the data before storing it and sets Content-Encoding to gzip.
+// Get decompresses such objects transparently. Checksums set with WithContentMD5 or
+// WithChecksumSHA256 still describe the uncompressed data.
+// Stores without compression support ignore it.
+func WithGzip() PutOption {
+	return func(o *PutOptions) {
+		o.Gzip = true
+	}
+}
+
 // PresignedURL represents a presigned URL with its associated metadata
 type PresignedURL struct {
 	URL     string
@@ -94,6 +157,9 @@ type PresignedPutOptions struct {
 	CacheControl       string
 	ContentEncoding    string
 	ContentDisposition string
+	SSEKMSKeyID        string
+	StorageClass       string
+	AutoContentType    bool // Infer ContentType when it is empty, see WithPresignedAutoContentType
 }
 
 // WithPresignedContentType sets the content type for the presigned URL
@@ -117,7 +183,10 @@ func WithPresignedMetadata(metadata map[string]string) PresignedPutOption {
 	}
 }
 
-// WithPresignedAllowedExtensions sets the allowed file extensions for upload
+// WithPresignedAllowedExtensions restricts presigned uploads to keys ending
+// in one of extensions, such as "pdf" or ".tar.gz", and signs the content type
+// the extension implies. Other keys are rejected with ErrCodeInvalidArgument
+// when the URL is generated; see PresignedPutOptions.EnforceAllowedExtensions.
 func WithPresignedAllowedExtensions(extensions []string) PresignedPutOption {
 	return func(o *PresignedPutOptions) {
 		o.AllowedExtensions = extensions
@@ -144,3 +213,18 @@ func WithPresignedContentDisposition(contentDisposition string) PresignedPutOpti
 		o.ContentDisposition = contentDisposition
 	}
 }
+
+// WithPresignedSSE requires the upload to use server-side encryption with the given KMS key.
+// The encryption headers are signed, so the client must send them as returned in PresignedURL.Headers.
+func WithPresignedSSE(kmsKeyID string) PresignedPutOption {
+	return func(o *PresignedPutOptions) {
+		o.SSEKMSKeyID = kmsKeyID
+	}
+}
+
+// WithPresignedStorageClass sets the storage class for the uploaded object
+func WithPresignedStorageClass(storageClass string) PresignedPutOption {
+	return func(o *PresignedPutOptions) {
+		o.StorageClass = storageClass
+	}
+}
@@ -0,0 +1,521 @@
+// Package vcr records the HTTP interactions of a test into a fixture file and
+// replays them, so adapter tests run against provider responses without
+// network access or API keys.
+//
+// Tests replay by default and fail on requests their fixture doesn't have:
+//
+//	rec := vcr.New(t, "chat")
+//	config := openai.DefaultConfig(rec.Credential("OPENAI_API_KEY"))
+//	config.HTTPClient = rec.Client()
+//
+// To refresh fixtures after an API or adapter change, run the tests with
+// VCR_MODE=record and real credentials. Requests then go to the provider and
+// each passing test rewrites its fixture, with credentials scrubbed:
+//
+//	VCR_MODE=record OPENAI_API_KEY=sk-... go test ./adapters/openai
+//
+// Review the fixture diff before committing it. The fixtures checked in under
+// adapters/openai/testdata were written by hand in the shape of the API's
+// responses, not recorded; re-recording replaces them with real interactions.
+package vcr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// ModeEnv is the environment variable that selects the Mode of recorders
+// created without WithMode
+const ModeEnv = "VCR_MODE"
+
+// Mode is whether a Recorder calls the real API or replays its fixture
+type Mode string
+
+const (
+	// ModeReplay serves responses from the fixture and never touches the network
+	ModeReplay Mode = "replay"
+	// ModeRecord sends requests to the real API and rewrites the fixture
+	ModeRecord Mode = "record"
+)
+
+// Scrubbed replaces credentials in recorded interactions
+const Scrubbed = "REDACTED"
+
+// scrubbedHeaders carry credentials in requests or responses of the APIs the
+// adapters call
+var scrubbedHeaders = []string{
+	"Authorization",
+	"Api-Key",
+	"X-Api-Key",
+	"X-Goog-Api-Key",
+	"X-Amz-Security-Token",
+	"Openai-Organization",
+	"Openai-Project",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// scrubbedParams carry credentials in request URLs
+var scrubbedParams = []string{"key", "api-key", "api_key"}
+
+// Fixture is the content of a fixture file
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and the response it got
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request. Body is base64 encoded when Encoding is
+// "base64".
+type Request struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     string      `json:"body,omitempty"`
+	Encoding string      `json:"encoding,omitempty"`
+}
+
+// Response is a recorded response. Streamed (text/event-stream) bodies are
+// kept as the Chunks they arrived in and replayed one chunk per read, so SSE
+// parsers see events split the way the provider sent them. Other bodies are
+// in Body, base64 encoded when Encoding is "base64".
+type Response struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Body     string      `json:"body,omitempty"`
+	Chunks   []string    `json:"chunks,omitempty"`
+	Encoding string      `json:"encoding,omitempty"`
+}
+
+// Matcher reports whether a request with body matches a recorded one
+type Matcher func(req *http.Request, body []byte, recorded Request) bool
+
+// Recorder is an http.RoundTripper that records interactions into a fixture
+// or replays them from it
+type Recorder struct {
+	t         testing.TB
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	matcher   Matcher
+	scrubbers []func(*Interaction)
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Option configures a Recorder
+type Option func(*Recorder)
+
+// WithMode overrides the mode selected by ModeEnv
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// WithTransport sets the transport requests are sent with when recording,
+// http.DefaultTransport by default
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithDir sets the directory of the fixture file, testdata/fixtures by default
+func WithDir(dir string) Option {
+	return func(r *Recorder) {
+		r.path = filepath.Join(dir, filepath.Base(r.path))
+	}
+}
+
+// WithMatcher sets how replayed requests are matched to recorded ones,
+// DefaultMatcher by default
+func WithMatcher(matcher Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = matcher
+	}
+}
+
+// WithScrubber adds a function that removes secrets the default scrubbing
+// misses, such as credentials in request bodies, from each interaction before
+// it is saved
+func WithScrubber(scrub func(*Interaction)) Option {
+	return func(r *Recorder) {
+		r.scrubbers = append(r.scrubbers, scrub)
+	}
+}
+
+// New returns a Recorder for the fixture testdata/fixtures/<name>.json. In
+// replay mode the fixture must exist; in record mode it is written when the
+// test passes.
+func New(t testing.TB, name string, opts ...Option) *Recorder {
+	t.Helper()
+	r := &Recorder{
+		t:         t,
+		path:      filepath.Join("testdata", "fixtures", name+".json"),
+		mode:      ModeReplay,
+		transport: http.DefaultTransport,
+		matcher:   DefaultMatcher,
+	}
+	if os.Getenv(ModeEnv) == string(ModeRecord) {
+		r.mode = ModeRecord
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	switch r.mode {
+	case ModeReplay:
+		data, err := os.ReadFile(r.path)
+		if err != nil {
+			t.Fatalf("vcr: %v; record the fixture with %s=%s", err, ModeEnv, ModeRecord)
+		}
+		var fixture Fixture
+		if err := json.Unmarshal(data, &fixture); err != nil {
+			t.Fatalf("vcr: failed to parse %s: %v", r.path, err)
+		}
+		r.interactions = fixture.Interactions
+		r.used = make([]bool, len(fixture.Interactions))
+		t.Cleanup(r.checkUsed)
+	case ModeRecord:
+		t.Cleanup(r.save)
+	default:
+		t.Fatalf("vcr: unknown mode %q", r.mode)
+	}
+	return r
+}
+
+// Mode returns whether r records or replays
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Client returns an HTTP client that sends its requests through r
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Credential returns the value of the environment variable env when
+// recording, failing the test if it is unset, and a placeholder when
+// replaying, where requests never reach the API
+func (r *Recorder) Credential(env string) string {
+	r.t.Helper()
+	if r.mode == ModeReplay {
+		return "test-" + strings.ToLower(env)
+	}
+	value := os.Getenv(env)
+	if value == "" {
+		r.t.Fatalf("vcr: %s must be set to record %s", env, r.path)
+	}
+	return value
+}
+
+// Interactions returns the interactions recorded or replayed so far
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == ModeRecord {
+		return append([]Interaction(nil), r.interactions...)
+	}
+	var replayed []Interaction
+	for i, used := range r.used {
+		if used {
+			replayed = append(replayed, r.interactions[i])
+		}
+	}
+	return replayed
+}
+
+// RoundTrip records or replays req
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Keep the chunks a streamed body arrives in
+	var chunks [][]byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			chunks = append(chunks, append([]byte(nil), buf[:n]...))
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+		},
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: resp.Header.Clone(),
+		},
+	}
+	interaction.Request.Body, interaction.Request.Encoding = encode(body)
+	if isStream(resp.Header) {
+		for _, chunk := range chunks {
+			interaction.Response.Chunks = append(interaction.Response.Chunks, string(chunk))
+		}
+	} else {
+		interaction.Response.Body, interaction.Response.Encoding = encode(bytes.Join(chunks, nil))
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+
+	return newResponse(req, interaction.Response, chunks), nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.used[i] || !r.matcher(req, body, interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+
+		recorded := interaction.Response
+		var chunks [][]byte
+		for _, chunk := range recorded.Chunks {
+			chunks = append(chunks, []byte(chunk))
+		}
+		if recorded.Body != "" {
+			decoded, err := decode(recorded.Body, recorded.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("vcr: %s: %w", r.path, err)
+			}
+			chunks = append(chunks, decoded)
+		}
+		return newResponse(req, recorded, chunks), nil
+	}
+
+	r.t.Errorf("vcr: %s has no recorded interaction for %s %s", r.path, req.Method, req.URL)
+	return nil, fmt.Errorf("vcr: no recorded interaction for %s %s", req.Method, req.URL)
+}
+
+// DefaultMatcher matches requests with the same method, URL path and query,
+// and body. JSON bodies match when they are equal as JSON. The host is not
+// compared, so a fixture serves any base URL.
+func DefaultMatcher(req *http.Request, body []byte, recorded Request) bool {
+	if req.Method != recorded.Method {
+		return false
+	}
+
+	recordedURL, err := req.URL.Parse(recorded.URL)
+	if err != nil || recordedURL.Path != req.URL.Path {
+		return false
+	}
+	query := req.URL.Query()
+	scrubQuery(query)
+	if query.Encode() != recordedURL.Query().Encode() {
+		return false
+	}
+
+	recordedBody, err := decode(recorded.Body, recorded.Encoding)
+	if err != nil {
+		return false
+	}
+	return equalBodies(body, recordedBody)
+}
+
+func equalBodies(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var aJSON, bJSON any
+	if json.Unmarshal(a, &aJSON) != nil || json.Unmarshal(b, &bJSON) != nil {
+		return false
+	}
+	aNormal, _ := json.Marshal(aJSON)
+	bNormal, _ := json.Marshal(bJSON)
+	return bytes.Equal(aNormal, bNormal)
+}
+
+// checkUsed fails replaying tests that didn't make every recorded request,
+// which means the fixture no longer matches the adapter
+func (r *Recorder) checkUsed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, used := range r.used {
+		if !used {
+			request := r.interactions[i].Request
+			r.t.Errorf("vcr: recorded interaction %s %s in %s was not replayed", request.Method, request.URL, r.path)
+		}
+	}
+}
+
+// save writes the interactions of a passing test to the fixture
+func (r *Recorder) save() {
+	if r.t.Failed() {
+		r.t.Logf("vcr: test failed, not rewriting %s", r.path)
+		return
+	}
+
+	r.mu.Lock()
+	fixture := Fixture{Interactions: r.interactions}
+	r.mu.Unlock()
+	for i := range fixture.Interactions {
+		r.scrub(&fixture.Interactions[i])
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		r.t.Errorf("vcr: failed to encode %s: %v", r.path, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		r.t.Errorf("vcr: %v", err)
+		return
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		r.t.Errorf("vcr: %v", err)
+	}
+}
+
+func (r *Recorder) scrub(interaction *Interaction) {
+	for _, name := range scrubbedHeaders {
+		for _, header := range []http.Header{interaction.Request.Header, interaction.Response.Header} {
+			if header.Get(name) != "" {
+				header.Set(name, Scrubbed)
+			}
+		}
+	}
+
+	// AWS signatures are derived from the secret key and change every request
+	for _, name := range []string{"X-Amz-Date", "Amz-Sdk-Invocation-Id", "Amz-Sdk-Request"} {
+		interaction.Request.Header.Del(name)
+	}
+
+	if u, err := url.Parse(interaction.Request.URL); err == nil {
+		query := u.Query()
+		if scrubQuery(query) {
+			u.RawQuery = query.Encode()
+			interaction.Request.URL = u.String()
+		}
+	}
+
+	for _, scrub := range r.scrubbers {
+		scrub(interaction)
+	}
+}
+
+// scrubQuery replaces credentials in query and reports whether there were any
+func scrubQuery(query url.Values) bool {
+	scrubbed := false
+	for _, name := range scrubbedParams {
+		if query.Has(name) {
+			query.Set(name, Scrubbed)
+			scrubbed = true
+		}
+	}
+	return scrubbed
+}
+
+func newResponse(req *http.Request, recorded Response, chunks [][]byte) *http.Response {
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode: recorded.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       &chunkReader{chunks: chunks},
+		Request:    req,
+	}
+}
+
+// chunkReader returns at most one chunk per Read
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.chunks) > 0 && len(c.chunks[0]) == 0 {
+		c.chunks = c.chunks[1:]
+	}
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, c.chunks[0])
+	c.chunks[0] = c.chunks[0][n:]
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	return nil
+}
+
+func isStream(header http.Header) bool {
+	return strings.HasPrefix(header.Get("Content-Type"), "text/event-stream")
+}
+
+func encode(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decode(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", encoding)
+	}
+}
@@ -0,0 +1,152 @@
+package vcr
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeAPI answers every request with its method, path and body, streamed in
+// two chunks
+type fakeAPI struct {
+	calls int
+}
+
+func (f *fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	body, _ := io.ReadAll(req.Body)
+	header := http.Header{}
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Set-Cookie", "session=secret")
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body: &chunkReader{chunks: [][]byte{
+			[]byte(fmt.Sprintf("data: %s %s", req.Method, req.URL.Path)),
+			[]byte(fmt.Sprintf(" %s\n\n", body)),
+		}},
+	}, nil
+}
+
+// recordingTB captures the failures of a Recorder under test
+type recordingTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingTB) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func post(t *testing.T, client *http.Client, url, body string) []string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	var reads []string
+	buf := make([]byte, 1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			reads = append(reads, string(buf[:n]))
+		}
+		if err != nil {
+			return reads
+		}
+	}
+}
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	api := &fakeAPI{}
+
+	t.Run("Record", func(t *testing.T) {
+		rec := New(t, "stream", WithMode(ModeRecord), WithDir(dir), WithTransport(api))
+		reads := post(t, rec.Client(), "https://api.example.com/v1/chat?key=secret", `{"q":1}`)
+		if strings.Join(reads, "") != "data: POST /v1/chat {\"q\":1}\n\n" {
+			t.Errorf("recorded response = %q", reads)
+		}
+	})
+
+	data, err := os.ReadFile(filepath.Join(dir, "stream.json"))
+	if err != nil {
+		t.Fatalf("fixture not written: %v", err)
+	}
+	for _, secret := range []string{"sk-secret", "session=secret", "key=secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("fixture contains %q:\n%s", secret, data)
+		}
+	}
+
+	rec := New(t, "stream", WithMode(ModeReplay), WithDir(dir), WithTransport(api))
+	// JSON bodies match regardless of formatting, and hosts are not compared
+	reads := post(t, rec.Client(), "http://localhost/v1/chat?key=other", `{ "q": 1 }`)
+	if len(reads) != 2 || reads[0] != "data: POST /v1/chat" {
+		t.Errorf("replayed reads = %q, want the two recorded chunks", reads)
+	}
+	if api.calls != 1 {
+		t.Errorf("API called %d times, want only while recording", api.calls)
+	}
+}
+
+func TestRecorder_ReplayMismatch(t *testing.T) {
+	dir := t.TempDir()
+	t.Run("Record", func(t *testing.T) {
+		rec := New(t, "fixture", WithMode(ModeRecord), WithDir(dir), WithTransport(&fakeAPI{}))
+		post(t, rec.Client(), "https://api.example.com/v1/chat", `{"q":1}`)
+	})
+
+	tb := &recordingTB{TB: t}
+	rec := New(tb, "fixture", WithMode(ModeReplay), WithDir(dir))
+	req, _ := http.NewRequest(http.MethodPost, "https://api.example.com/v1/chat", strings.NewReader(`{"q":2}`))
+	if _, err := rec.Client().Do(req); err == nil {
+		t.Error("Do() of an unrecorded request succeeded")
+	}
+	tb.finish()
+
+	if len(tb.errors) != 2 ||
+		!strings.Contains(tb.errors[0], "no recorded interaction") ||
+		!strings.Contains(tb.errors[1], "was not replayed") {
+		t.Errorf("errors = %q, want the unrecorded request and the unused interaction", tb.errors)
+	}
+}
+
+func TestRecorder_Credential(t *testing.T) {
+	t.Setenv("VCR_TEST_KEY", "sk-real")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{"interactions":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := New(t, "empty", WithMode(ModeReplay), WithDir(dir)).Credential("VCR_TEST_KEY"); got == "sk-real" {
+		t.Error("Credential() returned the real key while replaying")
+	}
+	if got := New(t, "unused", WithMode(ModeRecord), WithDir(t.TempDir())).Credential("VCR_TEST_KEY"); got != "sk-real" {
+		t.Errorf("Credential() = %q while recording, want the real key", got)
+	}
+}
@@ -0,0 +1,126 @@
+package vectorstore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capability names an optional interface a Store may implement
+type Capability string
+
+const (
+	CapabilityReplaceSource Capability = "ReplaceSource" // SourceReplacer
+	CapabilityListSources   Capability = "ListSources"   // SourceLister
+	CapabilityDeleteCount   Capability = "DeleteCount"   // CountingDeleter
+	CapabilityDimension     Capability = "Dimension"     // DimensionProvider
+	CapabilityListDocuments Capability = "ListDocuments" // DocumentLister
+	CapabilityMigrate       Capability = "Migrate"       // VectorMigrator
+	CapabilityVectorColumns Capability = "VectorColumns" // VectorColumnStore
+	CapabilityGetDocuments  Capability = "GetDocuments"  // DocumentGetter
+	CapabilitySearchStream  Capability = "SearchStream"  // StreamingSearcher
+	CapabilityConditions    Capability = "Conditions"    // ConditionMatcher
+)
+
+// CapabilitySet reports which optional interfaces a store supports
+type CapabilitySet struct {
+	ReplaceSource bool // Replaces the chunks of a source atomically
+	ListSources   bool // Lists the sources it holds documents for
+	DeleteCount   bool // Reports how many documents a delete removed
+	Dimension     bool // Has a fixed vector dimension
+	ListDocuments bool // Pages through every document it holds
+	Migrate       bool // Swaps in re-embedded vectors atomically
+	VectorColumns bool // Holds and searches several named vectors per document
+	GetDocuments  bool // Fetches documents by metadata without a vector
+	SearchStream  bool // Sends search results as they are read
+	Conditions    bool // Matches Conditions in filters
+}
+
+// Has reports whether the set includes capability
+func (c CapabilitySet) Has(capability Capability) bool {
+	switch capability {
+	case CapabilityReplaceSource:
+		return c.ReplaceSource
+	case CapabilityListSources:
+		return c.ListSources
+	case CapabilityDeleteCount:
+		return c.DeleteCount
+	case CapabilityDimension:
+		return c.Dimension
+	case CapabilityListDocuments:
+		return c.ListDocuments
+	case CapabilityMigrate:
+		return c.Migrate
+	case CapabilityVectorColumns:
+		return c.VectorColumns
+	case CapabilityGetDocuments:
+		return c.GetDocuments
+	case CapabilitySearchStream:
+		return c.SearchStream
+	case CapabilityConditions:
+		return c.Conditions
+	}
+	return false
+}
+
+// CapabilityReporter is implemented by stores whose optional methods depend on
+// the stores they wrap, so their capabilities can't be told from their type
+type CapabilityReporter interface {
+	Capabilities() CapabilitySet
+}
+
+// Capabilities probes the optional interfaces of store, looking through
+// wrappers such as TracingStore
+func Capabilities(store Store) CapabilitySet {
+	if reporter, ok := store.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	if inner := Unwrap(store); inner != store {
+		return Capabilities(inner)
+	}
+
+	_, replacer := store.(SourceReplacer)
+	_, lister := store.(SourceLister)
+	_, deleter := store.(CountingDeleter)
+	_, dimension := store.(DimensionProvider)
+	_, documents := store.(DocumentLister)
+	_, migrator := store.(VectorMigrator)
+	_, columns := store.(VectorColumnStore)
+	_, getter := store.(DocumentGetter)
+	_, streamer := store.(StreamingSearcher)
+	_, conditions := store.(ConditionMatcher)
+	return CapabilitySet{
+		ReplaceSource: replacer,
+		ListSources:   lister,
+		DeleteCount:   deleter,
+		Dimension:     dimension,
+		ListDocuments: documents,
+		Migrate:       migrator,
+		VectorColumns: columns,
+		GetDocuments:  getter,
+		SearchStream:  streamer,
+		Conditions:    conditions,
+	}
+}
+
+// RequireCapabilities returns an ErrCodeNotSupported error naming the store
+// and every capability in caps it lacks, or nil if it supports them all
+func RequireCapabilities(store Store, caps ...Capability) error {
+	supported := Capabilities(store)
+	var missing []string
+	for _, capability := range caps {
+		if !supported.Has(capability) {
+			missing = append(missing, string(capability))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	name := storeName(store)
+	return &VectorStoreError{
+		Code:    ErrCodeNotSupported,
+		Op:      "RequireCapabilities",
+		Store:   name,
+		Message: fmt.Sprintf("%s does not support %s", name, strings.Join(missing, ", ")),
+	}
+}
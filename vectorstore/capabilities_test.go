@@ -0,0 +1,71 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// listingStore adds SourceLister and SourceReplacer to stubStore
+type listingStore struct {
+	stubStore
+}
+
+func (s *listingStore) ListSources(ctx context.Context) ([]string, error) {
+	return nil, s.err
+}
+
+func (s *listingStore) ReplaceSource(ctx context.Context, source string, docs []Document, vectors [][]float32) error {
+	return s.err
+}
+
+// conditionStore adds ConditionMatcher to stubStore
+type conditionStore struct {
+	stubStore
+}
+
+func (s *conditionStore) MatchesConditions() {}
+
+func TestCapabilities(t *testing.T) {
+	listing := CapabilitySet{ReplaceSource: true, ListSources: true}
+	for name, test := range map[string]struct {
+		store Store
+		want  CapabilitySet
+	}{
+		"Plain store":      {store: &stubStore{}},
+		"Optional":         {store: &listingStore{}, want: listing},
+		"Tracing":          {store: NewTracingStore(&listingStore{}, noop.NewTracerProvider()), want: listing},
+		"Tracing plain":    {store: NewTracingStore(&stubStore{}, noop.NewTracerProvider())},
+		"MultiStore":       {store: NewMultiStore([]Store{&listingStore{}, &listingStore{}}), want: CapabilitySet{ReplaceSource: true}},
+		"Mixed shards":     {store: NewMultiStore([]Store{&listingStore{}, &stubStore{}})},
+		"Empty shard set":  {store: NewMultiStore(nil)},
+		"Conditions":       {store: &conditionStore{}, want: CapabilitySet{Conditions: true}},
+		"Condition shards": {store: NewMultiStore([]Store{&conditionStore{}, &conditionStore{}}), want: CapabilitySet{Conditions: true}},
+		"Mixed conditions": {store: NewMultiStore([]Store{&conditionStore{}, &listingStore{}})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := Capabilities(test.store); got != test.want {
+				t.Errorf("Capabilities() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRequireCapabilities(t *testing.T) {
+	store := NewTracingStore(&listingStore{}, noop.NewTracerProvider())
+	if err := RequireCapabilities(store, CapabilityReplaceSource, CapabilityListSources); err != nil {
+		t.Errorf("RequireCapabilities() of supported capabilities error = %v", err)
+	}
+
+	err := RequireCapabilities(store, CapabilityListSources, CapabilityDeleteCount, CapabilityDimension)
+	var vsErr *VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != ErrCodeNotSupported {
+		t.Fatalf("RequireCapabilities() error = %v, want ErrCodeNotSupported", err)
+	}
+	if !strings.Contains(vsErr.Message, "vectorstore.listingStore does not support DeleteCount, Dimension") {
+		t.Errorf("message = %q, want the store and the missing capabilities", vsErr.Message)
+	}
+}
@@ -0,0 +1,138 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Abraxas-365/kbservice/embedding"
+)
+
+// DefaultVectorColumn keys the vectors of a store's default column, the one
+// AddDocuments and SimilaritySearch use
+const DefaultVectorColumn = ""
+
+// VectorColumnStore is implemented by stores that can hold several named
+// vectors per document, such as one from a general-purpose embedder and one
+// from a code embedder, and search by any of them
+type VectorColumnStore interface {
+	// AddDocumentsWithVectors adds docs with a vector per document for every
+	// column in vectors. The DefaultVectorColumn key is required; columns left
+	// out have no vector for docs and never match searches of them.
+	AddDocumentsWithVectors(ctx context.Context, docs []Document, vectors map[string][][]float32) error
+
+	// ReplaceSourceWithVectors is ReplaceSource with vectors as in
+	// AddDocumentsWithVectors
+	ReplaceSourceWithVectors(ctx context.Context, source string, docs []Document, vectors map[string][][]float32) error
+
+	// SimilaritySearchWithOptions is SimilaritySearch against the column
+	// selected by opts
+	SimilaritySearchWithOptions(ctx context.Context, vector []float32, limit int, filter Filter, opts SearchOptions) ([]Document, error)
+}
+
+// SearchOptions configures a single search
+type SearchOptions struct {
+	// Column is the vector column searched, DefaultVectorColumn for the default
+	Column string
+	// ReturnVectors sets the Vector of each result to its stored embedding
+	// in the searched column
+	ReturnVectors bool
+	// SnippetLength cuts the PageContent of each result to at most this
+	// many characters, see WithSnippetLength (0 returns it whole)
+	SnippetLength int
+}
+
+// SearchOption configures a single search
+type SearchOption func(*SearchOptions)
+
+// WithVectorColumn searches the named vector column instead of the default.
+// The query is embedded with the embedder set for the column by
+// WithColumnEmbedder, or the VectorStore's own if there is none.
+func WithVectorColumn(column string) SearchOption {
+	return func(o *SearchOptions) {
+		o.Column = column
+	}
+}
+
+// WithReturnVectors returns each result's stored embedding in its Vector,
+// for callers such as MMR or clustering that work on the vectors. It is off
+// by default since vectors make results much larger. The store must
+// implement VectorColumnStore.
+func WithReturnVectors() SearchOption {
+	return func(o *SearchOptions) {
+		o.ReturnVectors = true
+	}
+}
+
+// columnStore returns the store as a VectorColumnStore, or an
+// ErrCodeNotSupported error if it isn't one. Calls through a TracingStore
+// are traced like its other methods.
+func (vs *VectorStore) columnStore() (VectorColumnStore, error) {
+	if err := RequireCapabilities(vs.store, CapabilityVectorColumns); err != nil {
+		return nil, err
+	}
+	store, ok := Unwrap(vs.store).(VectorColumnStore)
+	if !ok {
+		name := storeName(vs.store)
+		return nil, &VectorStoreError{
+			Code:    ErrCodeNotSupported,
+			Op:      "VectorColumns",
+			Store:   name,
+			Message: name + " reports vector columns but does not implement them",
+		}
+	}
+	if tracing, ok := vs.store.(*TracingStore); ok {
+		return &tracingColumnStore{store: store, tracer: tracing.tracer}, nil
+	}
+	return store, nil
+}
+
+// embedColumns embeds texts with every embedder set by WithColumnEmbedder,
+// adding the vectors to columns. Partially embedded batches fail, since a
+// document can't be kept in one column and left out of another.
+func (vs *VectorStore) embedColumns(ctx context.Context, texts []string, columns map[string][][]float32) error {
+	names := make([]string, 0, len(vs.opts.ColumnEmbedders))
+	for name := range vs.opts.ColumnEmbedders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		vectors, err := vs.opts.ColumnEmbedders[name].EmbedDocuments(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed vector column %s: %w", name, err)
+		}
+		columns[name] = vectors
+	}
+	return nil
+}
+
+// queryEmbedder returns the embedder for queries of column
+func (vs *VectorStore) queryEmbedder(column string) embedding.Embedder {
+	if embedder, ok := vs.opts.ColumnEmbedders[column]; ok {
+		return embedder
+	}
+	return vs.embedder
+}
+
+// withColumns returns the store as a VectorColumnStore and vectors keyed by
+// DefaultVectorColumn, with the vectors of every column embedder for docs
+func (vs *VectorStore) withColumns(ctx context.Context, docs []Document, vectors [][]float32) (VectorColumnStore, map[string][][]float32, error) {
+	store, err := vs.columnStore()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := map[string][][]float32{DefaultVectorColumn: vectors}
+	if len(docs) == 0 {
+		return store, columns, nil
+	}
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = vs.embeddingText(doc.ToDocument())
+	}
+	if err := vs.embedColumns(ctx, texts, columns); err != nil {
+		return nil, nil, err
+	}
+	return store, columns, nil
+}
@@ -0,0 +1,179 @@
+package vectorstore_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// columnStore adds VectorColumnStore to mocks.Store, recording the vectors
+// of every column and the column searched
+type columnStore struct {
+	*mocks.Store
+
+	columns  map[string][][]float32
+	replaced string
+	searched vectorstore.SearchOptions
+	query    []float32
+}
+
+func (s *columnStore) AddDocumentsWithVectors(ctx context.Context, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	s.columns = vectors
+	return s.Store.AddDocuments(ctx, docs, vectors[vectorstore.DefaultVectorColumn])
+}
+
+func (s *columnStore) ReplaceSourceWithVectors(ctx context.Context, source string, docs []vectorstore.Document, vectors map[string][][]float32) error {
+	s.columns, s.replaced = vectors, source
+	return s.Store.ReplaceSource(ctx, source, docs, vectors[vectorstore.DefaultVectorColumn])
+}
+
+func (s *columnStore) SimilaritySearchWithOptions(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter, opts vectorstore.SearchOptions) ([]vectorstore.Document, error) {
+	s.searched, s.query = opts, vector
+	return s.Store.SimilaritySearch(ctx, make([]float32, 4), limit, filter)
+}
+
+func TestVectorStore_ColumnEmbedders(t *testing.T) {
+	ctx := context.Background()
+	store := &columnStore{Store: mocks.NewStore()}
+	embedder, codeEmbedder := mocks.NewEmbedder(4), mocks.NewEmbedder(2)
+	vs := vectorstore.New(store, embedder, vectorstore.WithColumnEmbedder("code", codeEmbedder))
+
+	docs := []document.Document{
+		{PageContent: "func main() {}", Metadata: map[string]interface{}{"source": "main.go"}},
+		{PageContent: "package main", Metadata: map[string]interface{}{"source": "main.go"}},
+	}
+	if err := vs.AddDocuments(ctx, docs); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+	if len(store.columns[""]) != 2 || len(store.columns["code"]) != 2 || len(store.columns["code"][0]) != 2 {
+		t.Errorf("columns = %v, want both columns embedded", store.columns)
+	}
+
+	if err := vs.ReplaceSource(ctx, "main.go", docs[:1]); err != nil {
+		t.Fatalf("ReplaceSource() error = %v", err)
+	}
+	if store.replaced != "main.go" || len(store.columns["code"]) != 1 {
+		t.Errorf("replaced %q with columns %v, want main.go replaced with both columns", store.replaced, store.columns)
+	}
+
+	// The default column is searched with the main embedder through SimilaritySearch
+	if _, err := vs.SimilaritySearch(ctx, "entry point", 1, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if store.query != nil || codeEmbedder.CallCount("EmbedQuery") != 0 {
+		t.Error("default search used the code column")
+	}
+
+	results, err := vs.SimilaritySearch(ctx, "entry point", 1, nil, vectorstore.WithVectorColumn("code"))
+	if err != nil {
+		t.Fatalf("SimilaritySearch() of the code column error = %v", err)
+	}
+	if store.searched.Column != "code" || len(store.query) != 2 || len(results) != 1 {
+		t.Errorf("searched %+v with %v, want the code column with the code embedder", store.searched, store.query)
+	}
+}
+
+func TestVectorStore_ColumnEmbedderEmbeddingError(t *testing.T) {
+	errEmbed := errors.New("embed failed")
+	store := &columnStore{Store: mocks.NewStore()}
+	codeEmbedder := mocks.NewEmbedder(2)
+	codeEmbedder.FailNext("EmbedDocuments", errEmbed)
+	vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithColumnEmbedder("code", codeEmbedder))
+
+	err := vs.AddDocuments(context.Background(), []document.Document{{PageContent: "a"}})
+	if !errors.Is(err, errEmbed) {
+		t.Errorf("AddDocuments() error = %v, want %v", err, errEmbed)
+	}
+	if len(store.Documents()) != 0 {
+		t.Error("documents were added without their code vectors")
+	}
+}
+
+func TestVectorStore_VectorColumnsNotSupported(t *testing.T) {
+	ctx := context.Background()
+	store := mocks.NewStore()
+
+	vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithColumnEmbedder("code", mocks.NewEmbedder(2)))
+	err := vs.AddDocuments(ctx, []document.Document{{PageContent: "a"}})
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("AddDocuments() error = %v, want ErrCodeNotSupported", err)
+	}
+
+	_, err = vectorstore.New(store, mocks.NewEmbedder(4)).Search(ctx, "a", 1, nil, vectorstore.WithVectorColumn("code"))
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("Search() error = %v, want ErrCodeNotSupported", err)
+	}
+}
+
+// misreportingStore claims vector columns without implementing them, like
+// a wrapper forwarding its inner store's capabilities
+type misreportingStore struct {
+	*mocks.Store
+}
+
+func (s misreportingStore) Capabilities() vectorstore.CapabilitySet {
+	return vectorstore.CapabilitySet{VectorColumns: true}
+}
+
+func TestVectorStore_VectorColumnsMisreported(t *testing.T) {
+	vs := vectorstore.New(misreportingStore{Store: mocks.NewStore()}, mocks.NewEmbedder(4))
+	_, err := vs.Search(context.Background(), "a", 1, nil, vectorstore.WithVectorColumn("code"))
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("Search() error = %v, want ErrCodeNotSupported", err)
+	}
+}
+
+func TestVectorStore_VectorColumnsTraced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	store := &columnStore{Store: mocks.NewStore()}
+	vs := vectorstore.New(vectorstore.NewTracingStore(store, tp), mocks.NewEmbedder(4))
+
+	if _, err := vs.Search(context.Background(), "a", 1, nil, vectorstore.WithReturnVectors()); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if !store.searched.ReturnVectors {
+		t.Fatalf("searched %+v, want the column store searched", store.searched)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "vectorstore.SimilaritySearch" {
+		t.Errorf("spans = %v, want the column search traced", spans)
+	}
+}
+
+func TestVectorStore_ReturnVectors(t *testing.T) {
+	ctx := context.Background()
+	store := &columnStore{Store: mocks.NewStore()}
+	vs := vectorstore.New(store, mocks.NewEmbedder(4))
+	if err := vs.AddDocuments(ctx, []document.Document{{PageContent: "a"}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	// Off by default, so searches of the default column skip the options
+	if _, err := vs.SimilaritySearch(ctx, "a", 1, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if store.query != nil {
+		t.Error("default search went through SimilaritySearchWithOptions")
+	}
+
+	if _, err := vs.SimilaritySearch(ctx, "a", 1, nil, vectorstore.WithReturnVectors()); err != nil {
+		t.Fatalf("SimilaritySearch() with vectors error = %v", err)
+	}
+	if !store.searched.ReturnVectors || store.searched.Column != vectorstore.DefaultVectorColumn {
+		t.Errorf("searched %+v, want the default column with its vectors", store.searched)
+	}
+
+	_, err := vectorstore.New(mocks.NewStore(), mocks.NewEmbedder(4)).Search(ctx, "a", 1, nil, vectorstore.WithReturnVectors())
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeNotSupported {
+		t.Errorf("Search() error = %v, want ErrCodeNotSupported", err)
+	}
+}
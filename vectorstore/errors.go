@@ -17,6 +17,9 @@ const (
 	ErrCodeInvalidDimensions ErrorCode = "INVALID_DIMENSIONS"
 	ErrCodeInvalidFilter     ErrorCode = "INVALID_FILTER"
 	ErrCodeEmbeddingFailed   ErrorCode = "EMBEDDING_FAILED"
+	ErrCodeTimeout           ErrorCode = "TIMEOUT"
+	ErrCodeNotSupported      ErrorCode = "NOT_SUPPORTED"
+	ErrCodeUpdateFailed      ErrorCode = "UPDATE_FAILED"
 )
 
 // VectorStoreError represents an error that occurred in vector store operations
@@ -129,3 +132,23 @@ func NewEmbeddingFailedError(store string, err error) error {
 		Err:     err,
 	}
 }
+
+func NewTimeoutError(store string, op string, err error) error {
+	return &VectorStoreError{
+		Code:    ErrCodeTimeout,
+		Op:      op,
+		Store:   store,
+		Message: "operation timed out",
+		Err:     err,
+	}
+}
+
+func NewUpdateFailedError(store string, op string, err error) error {
+	return &VectorStoreError{
+		Code:    ErrCodeUpdateFailed,
+		Op:      op,
+		Store:   store,
+		Message: "failed to update stored vectors",
+		Err:     err,
+	}
+}
@@ -0,0 +1,110 @@
+package vectorstore
+
+// Operators of a Condition
+const (
+	OpEq  = "$eq"  // Equal to the value
+	OpNe  = "$ne"  // Not equal to the value, or missing
+	OpIn  = "$in"  // Equal to one of the values of a slice
+	OpGt  = "$gt"  // Greater than the value
+	OpGte = "$gte" // Greater than or equal to the value
+	OpLt  = "$lt"  // Less than the value
+	OpLte = "$lte" // Less than or equal to the value
+)
+
+// Condition is a Filter value matching a metadata key with operators other
+// than equality, such as Condition{OpGte: since, OpLt: until}. Every operator
+// must hold. Stores that support conditions implement ConditionMatcher, and
+// stores that don't reject filters with them as invalid.
+type Condition map[string]interface{}
+
+// FilterBuilder builds a Filter one comparison at a time:
+//
+//	filter := vectorstore.NewFilter().
+//		Eq("tag", "x").
+//		In("type", []string{"guide", "faq"}).
+//		Gte("date", since).
+//		Build()
+//
+// Comparisons of different keys must all hold. Equality alone is written
+// as a plain value, the way Filter maps are written by hand, and any other
+// comparison as a Condition.
+type FilterBuilder struct {
+	filter Filter
+}
+
+// NewFilter starts an empty FilterBuilder
+func NewFilter() *FilterBuilder {
+	return &FilterBuilder{filter: make(Filter)}
+}
+
+// Eq keeps documents whose key equals value
+func (b *FilterBuilder) Eq(key string, value interface{}) *FilterBuilder {
+	if cond, ok := b.filter[key].(Condition); ok {
+		cond[OpEq] = value
+		return b
+	}
+	b.filter[key] = value
+	return b
+}
+
+// Ne keeps documents whose key doesn't equal value, or is missing
+func (b *FilterBuilder) Ne(key string, value interface{}) *FilterBuilder {
+	return b.add(key, OpNe, value)
+}
+
+// In keeps documents whose key equals one of values, a slice
+func (b *FilterBuilder) In(key string, values interface{}) *FilterBuilder {
+	return b.add(key, OpIn, values)
+}
+
+// Gt keeps documents whose key is greater than value
+func (b *FilterBuilder) Gt(key string, value interface{}) *FilterBuilder {
+	return b.add(key, OpGt, value)
+}
+
+// Gte keeps documents whose key is greater than or equal to value
+func (b *FilterBuilder) Gte(key string, value interface{}) *FilterBuilder {
+	return b.add(key, OpGte, value)
+}
+
+// Lt keeps documents whose key is less than value
+func (b *FilterBuilder) Lt(key string, value interface{}) *FilterBuilder {
+	return b.add(key, OpLt, value)
+}
+
+// Lte keeps documents whose key is less than or equal to value
+func (b *FilterBuilder) Lte(key string, value interface{}) *FilterBuilder {
+	return b.add(key, OpLte, value)
+}
+
+// Build returns the Filter. The builder can keep being used without
+// changing it.
+func (b *FilterBuilder) Build() Filter {
+	filter := make(Filter, len(b.filter))
+	for key, value := range b.filter {
+		if cond, ok := value.(Condition); ok {
+			copied := make(Condition, len(cond))
+			for op, operand := range cond {
+				copied[op] = operand
+			}
+			value = copied
+		}
+		filter[key] = value
+	}
+	return filter
+}
+
+// add sets the operator of the key's Condition, turning an equality set by
+// Eq into one
+func (b *FilterBuilder) add(key, op string, value interface{}) *FilterBuilder {
+	cond, ok := b.filter[key].(Condition)
+	if !ok {
+		cond = make(Condition)
+		if eq, set := b.filter[key]; set {
+			cond[OpEq] = eq
+		}
+		b.filter[key] = cond
+	}
+	cond[op] = value
+	return b
+}
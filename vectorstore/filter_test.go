@@ -0,0 +1,68 @@
+package vectorstore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFilterBuilder(t *testing.T) {
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 1, 0)
+
+	tests := []struct {
+		name    string
+		builder *FilterBuilder
+		want    Filter
+	}{
+		{name: "Empty", builder: NewFilter(), want: Filter{}},
+		{
+			name:    "Equality",
+			builder: NewFilter().Eq("tag", "x").Eq("source", "a.txt"),
+			want:    Filter{"tag": "x", "source": "a.txt"},
+		},
+		{
+			name: "Conditions",
+			builder: NewFilter().
+				Eq("tag", "x").
+				In("type", []string{"guide", "faq"}).
+				Gte("date", since),
+			want: Filter{
+				"tag":  "x",
+				"type": Condition{OpIn: []string{"guide", "faq"}},
+				"date": Condition{OpGte: since},
+			},
+		},
+		{
+			name:    "Range",
+			builder: NewFilter().Gte("date", since).Lt("date", until).Gt("views", 10).Lte("views", 100),
+			want: Filter{
+				"date":  Condition{OpGte: since, OpLt: until},
+				"views": Condition{OpGt: 10, OpLte: 100},
+			},
+		},
+		{
+			name:    "Equality with a condition",
+			builder: NewFilter().Eq("lang", "en").Ne("lang", "").Eq("status", "draft").Eq("status", "done"),
+			want:    Filter{"lang": Condition{OpEq: "en", OpNe: ""}, "status": "done"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.Build(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Build() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBuilder_BuildCopies(t *testing.T) {
+	builder := NewFilter().Gte("date", 1)
+	first := builder.Build()
+	builder.Lt("date", 5).Eq("tag", "x")
+
+	if want := (Filter{"date": Condition{OpGte: 1}}); !reflect.DeepEqual(first, want) {
+		t.Errorf("first Build() = %v after further use of the builder, want %v", first, want)
+	}
+}
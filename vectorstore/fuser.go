@@ -0,0 +1,36 @@
+package vectorstore
+
+import "context"
+
+// ResultFuser assembles the documents of a search from the candidates the
+// store found for each query vector. A single-vector search has one list of
+// candidates; multi-vector (late-interaction) scoring, where a query embeds
+// into several vectors, would fuse one list per vector. The fused documents
+// are best first and their Score is what the score threshold applies to.
+type ResultFuser interface {
+	Fuse(ctx context.Context, candidates [][]Document, limit int) ([]Document, error)
+}
+
+// ResultFuserFunc adapts a function to a ResultFuser
+type ResultFuserFunc func(ctx context.Context, candidates [][]Document, limit int) ([]Document, error)
+
+// Fuse returns f(ctx, candidates, limit)
+func (f ResultFuserFunc) Fuse(ctx context.Context, candidates [][]Document, limit int) ([]Document, error) {
+	return f(ctx, candidates, limit)
+}
+
+// SingleVectorFuser is the default ResultFuser. It keeps the candidates of
+// the first query vector in the store's order, up to limit.
+type SingleVectorFuser struct{}
+
+// Fuse returns the first list of candidates, cut to limit
+func (SingleVectorFuser) Fuse(ctx context.Context, candidates [][]Document, limit int) ([]Document, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	docs := candidates[0]
+	if limit > 0 && len(docs) > limit {
+		docs = docs[:limit]
+	}
+	return docs, nil
+}
@@ -0,0 +1,43 @@
+package vectorstore
+
+import "context"
+
+// StoredDocument is a document as held by a store, with the ID the store
+// keeps it under
+type StoredDocument struct {
+	ID string
+	Document
+}
+
+// DocumentLister is implemented by stores that can page through every
+// document they hold
+type DocumentLister interface {
+	// ListDocuments returns up to limit documents that come after cursor, in
+	// a stable order, and the cursor of the last one. An empty cursor starts
+	// at the first document and an empty page means there are no more.
+	// Cursors are opaque to callers.
+	ListDocuments(ctx context.Context, cursor string, limit int) ([]StoredDocument, string, error)
+}
+
+// VectorMigrator is implemented by stores that can give their documents new
+// vectors, such as from a different embedding model, without a window in
+// which searches see a mix of old and new vectors. Vectors are written into a
+// target table or collection that then replaces the store's own in one step.
+// An empty target names a default of the store's choosing.
+type VectorMigrator interface {
+	// PrepareMigration creates target for vectors of dimension. With resume
+	// the documents already written to an existing target are kept, so an
+	// interrupted migration can continue; otherwise target starts empty.
+	PrepareMigration(ctx context.Context, target string, dimension int, resume bool) error
+
+	// WriteVectors writes the stored documents with ids, as returned by
+	// ListDocuments, into target with vectors. Writing a document twice
+	// replaces its vector.
+	WriteVectors(ctx context.Context, target string, ids []string, vectors [][]float32) error
+
+	// SwitchMigration replaces the store's documents with those written to
+	// target, atomically, after which the store expects vectors of dimension.
+	// The documents it held before are kept under the target's name until
+	// the next PrepareMigration of it without resume.
+	SwitchMigration(ctx context.Context, target string, dimension int) error
+}
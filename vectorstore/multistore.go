@@ -0,0 +1,219 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/Abraxas-365/kbservice/document"
+)
+
+// ShardFunc picks the index of the store that holds documents with the given
+// metadata, or returns -1 if the metadata doesn't determine one
+type ShardFunc func(metadata map[string]interface{}) int
+
+// ShardBySource returns a ShardFunc that spreads sources over n stores by hash,
+// keeping all chunks of a source in the same store
+func ShardBySource(n int) ShardFunc {
+	return func(metadata map[string]interface{}) int {
+		source, ok := metadata["source"].(string)
+		if !ok || n <= 0 {
+			return -1
+		}
+		h := fnv.New32a()
+		h.Write([]byte(source))
+		return int(h.Sum32() % uint32(n))
+	}
+}
+
+// MultiStoreOption is a function type to modify MultiStore
+type MultiStoreOption func(*MultiStore)
+
+// WithShardFunc sets how documents are assigned to stores. Defaults to ShardBySource.
+func WithShardFunc(shard ShardFunc) MultiStoreOption {
+	return func(m *MultiStore) {
+		m.shard = shard
+	}
+}
+
+// MultiStore presents several stores, such as pgvector tables holding shards of
+// one corpus, as a single Store. Searches run on every store concurrently and
+// the results are merged by score; writes go to the store picked by the shard
+// function.
+type MultiStore struct {
+	stores []Store
+	shard  ShardFunc
+}
+
+// NewMultiStore creates a MultiStore over stores
+func NewMultiStore(stores []Store, opts ...MultiStoreOption) *MultiStore {
+	m := &MultiStore{
+		stores: stores,
+		shard:  ShardBySource(len(stores)),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Capabilities reports ReplaceSource when every store supports it, since a
+// source is replaced within the store that holds it, and Conditions when
+// every store matches them, since filters are passed on unchanged. The other
+// optional interfaces aren't implemented.
+func (m *MultiStore) Capabilities() CapabilitySet {
+	replace := len(m.stores) > 0
+	conditions := len(m.stores) > 0
+	for _, store := range m.stores {
+		caps := Capabilities(store)
+		replace = replace && caps.ReplaceSource
+		conditions = conditions && caps.Conditions
+	}
+	return CapabilitySet{ReplaceSource: replace, Conditions: conditions}
+}
+
+// AddDocuments adds each document to the store picked by the shard function
+func (m *MultiStore) AddDocuments(ctx context.Context, docs []Document, vectors [][]float32) error {
+	if len(docs) != len(vectors) {
+		return NewAddFailedError("multi", fmt.Errorf("%d documents but %d vectors", len(docs), len(vectors)))
+	}
+	shardDocs := make([][]Document, len(m.stores))
+	shardVectors := make([][][]float32, len(m.stores))
+	for i, doc := range docs {
+		shard, err := m.shardFor(doc.Metadata)
+		if err != nil {
+			return err
+		}
+		shardDocs[shard] = append(shardDocs[shard], doc)
+		shardVectors[shard] = append(shardVectors[shard], vectors[i])
+	}
+
+	return m.each(func(i int, store Store) error {
+		if len(shardDocs[i]) == 0 {
+			return nil
+		}
+		return store.AddDocuments(ctx, shardDocs[i], shardVectors[i])
+	})
+}
+
+// SimilaritySearch searches every store concurrently and returns the overall top
+// limit documents by score
+func (m *MultiStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter Filter) ([]Document, error) {
+	results := make([][]Document, len(m.stores))
+	err := m.each(func(i int, store Store) error {
+		docs, err := store.SimilaritySearch(ctx, vector, limit, filter)
+		results[i] = docs
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []Document
+	for _, docs := range results {
+		merged = append(merged, docs...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged, nil
+}
+
+// Delete removes matching documents from the store picked by the shard function,
+// or from every store if the filter doesn't determine one
+func (m *MultiStore) Delete(ctx context.Context, filter Filter) error {
+	if shard := m.shard(filter); shard >= 0 && shard < len(m.stores) {
+		return m.stores[shard].Delete(ctx, filter)
+	}
+	return m.each(func(i int, store Store) error {
+		return store.Delete(ctx, filter)
+	})
+}
+
+// InitDB initializes every store
+func (m *MultiStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return m.each(func(i int, store Store) error {
+		return store.InitDB(ctx, forceRecreate)
+	})
+}
+
+// DocumentExists checks each document in the store picked by the shard function,
+// or in every store if its metadata doesn't determine one
+func (m *MultiStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	// indices[i] lists the documents to check in store i
+	indices := make([][]int, len(m.stores))
+	for j, doc := range docs {
+		shard := m.shard(doc.Metadata)
+		for i := range m.stores {
+			if shard < 0 || shard >= len(m.stores) || shard == i {
+				indices[i] = append(indices[i], j)
+			}
+		}
+	}
+
+	results := make([][]bool, len(m.stores))
+	err := m.each(func(i int, store Store) error {
+		if len(indices[i]) == 0 {
+			return nil
+		}
+		check := make([]document.Document, len(indices[i]))
+		for n, j := range indices[i] {
+			check[n] = docs[j]
+		}
+		exists, err := store.DocumentExists(ctx, check)
+		results[i] = exists
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]bool, len(docs))
+	for i, storeResults := range results {
+		for n, found := range storeResults {
+			if found {
+				exists[indices[i][n]] = true
+			}
+		}
+	}
+	return exists, nil
+}
+
+func (m *MultiStore) shardFor(metadata map[string]interface{}) (int, error) {
+	shard := m.shard(metadata)
+	if shard < 0 || shard >= len(m.stores) {
+		return 0, &VectorStoreError{
+			Code:    ErrCodeAddFailed,
+			Op:      "AddDocuments",
+			Store:   "multi",
+			Message: fmt.Sprintf("no shard for document with metadata %v", metadata),
+		}
+	}
+	return shard, nil
+}
+
+// each calls fn for every store concurrently and returns the first error
+func (m *MultiStore) each(fn func(i int, store Store) error) error {
+	errs := make([]error, len(m.stores))
+	var wg sync.WaitGroup
+	for i, store := range m.stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i, store)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
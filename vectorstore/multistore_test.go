@@ -0,0 +1,190 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+)
+
+// memStore is an in-memory Store scoring documents by dot product
+type memStore struct {
+	docs    []Document
+	vectors [][]float32
+	deletes []Filter
+}
+
+func (s *memStore) AddDocuments(ctx context.Context, docs []Document, vectors [][]float32) error {
+	s.docs = append(s.docs, docs...)
+	s.vectors = append(s.vectors, vectors...)
+	return nil
+}
+
+func (s *memStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter Filter) ([]Document, error) {
+	results := make([]Document, len(s.docs))
+	for i, doc := range s.docs {
+		var score float32
+		for k := range vector {
+			score += vector[k] * s.vectors[i][k]
+		}
+		doc.Score = score
+		results[i] = doc
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *memStore) Delete(ctx context.Context, filter Filter) error {
+	s.deletes = append(s.deletes, filter)
+	return nil
+}
+
+func (s *memStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return nil
+}
+
+func (s *memStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	exists := make([]bool, len(docs))
+	for i, doc := range docs {
+		for _, stored := range s.docs {
+			if stored.Metadata["source"] == doc.Metadata["source"] {
+				exists[i] = true
+			}
+		}
+	}
+	return exists, nil
+}
+
+// shardByName sends source "a*" to store 0 and everything else to store 1
+func shardByName(metadata map[string]interface{}) int {
+	source, ok := metadata["source"].(string)
+	if !ok {
+		return -1
+	}
+	if source[0] == 'a' {
+		return 0
+	}
+	return 1
+}
+
+func TestMultiStore_SimilaritySearchMergesTopK(t *testing.T) {
+	ctx := context.Background()
+	first, second := &memStore{}, &memStore{}
+	multi := NewMultiStore([]Store{first, second}, WithShardFunc(shardByName))
+
+	docs := []Document{
+		{PageContent: "a1", Metadata: map[string]interface{}{"source": "a1"}},
+		{PageContent: "b1", Metadata: map[string]interface{}{"source": "b1"}},
+		{PageContent: "a2", Metadata: map[string]interface{}{"source": "a2"}},
+		{PageContent: "b2", Metadata: map[string]interface{}{"source": "b2"}},
+	}
+	vectors := [][]float32{{0.9}, {0.8}, {0.3}, {0.95}}
+	if err := multi.AddDocuments(ctx, docs, vectors); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	if len(first.docs) != 2 || len(second.docs) != 2 {
+		t.Fatalf("shards hold %d and %d documents, want 2 and 2", len(first.docs), len(second.docs))
+	}
+
+	results, err := multi.SimilaritySearch(ctx, []float32{1}, 3, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	var got []string
+	for _, doc := range results {
+		got = append(got, doc.PageContent)
+	}
+	want := []string{"b2", "a1", "b1"}
+	if len(got) != len(want) {
+		t.Fatalf("SimilaritySearch() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("SimilaritySearch() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMultiStore_DeleteRoutesByShard(t *testing.T) {
+	ctx := context.Background()
+	first, second := &memStore{}, &memStore{}
+	multi := NewMultiStore([]Store{first, second}, WithShardFunc(shardByName))
+
+	if err := multi.Delete(ctx, Filter{"source": "b1"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if len(first.deletes) != 0 || len(second.deletes) != 1 {
+		t.Errorf("deletes = %v and %v, want only the second store", first.deletes, second.deletes)
+	}
+
+	// Filters without a shard key go to every store
+	if err := multi.Delete(ctx, Filter{"lang": "en"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if len(first.deletes) != 1 || len(second.deletes) != 2 {
+		t.Errorf("deletes = %v and %v, want both stores", first.deletes, second.deletes)
+	}
+}
+
+func TestMultiStore_DocumentExists(t *testing.T) {
+	ctx := context.Background()
+	first, second := &memStore{}, &memStore{}
+	multi := NewMultiStore([]Store{first, second}, WithShardFunc(shardByName))
+
+	docs := []Document{{Metadata: map[string]interface{}{"source": "b1"}}}
+	if err := multi.AddDocuments(ctx, docs, [][]float32{{1}}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	exists, err := multi.DocumentExists(ctx, []document.Document{
+		{Metadata: map[string]interface{}{"source": "a1"}},
+		{Metadata: map[string]interface{}{"source": "b1"}},
+	})
+	if err != nil {
+		t.Fatalf("DocumentExists() error = %v", err)
+	}
+	if exists[0] || !exists[1] {
+		t.Errorf("DocumentExists() = %v, want [false true]", exists)
+	}
+}
+
+func TestMultiStore_AddDocumentsWithoutShard(t *testing.T) {
+	multi := NewMultiStore([]Store{&memStore{}, &memStore{}})
+
+	err := multi.AddDocuments(context.Background(), []Document{{PageContent: "no source"}}, [][]float32{{1}})
+	var vsErr *VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != ErrCodeAddFailed {
+		t.Errorf("AddDocuments() error = %v, want %s", err, ErrCodeAddFailed)
+	}
+}
+
+func TestMultiStore_AddDocumentsVectorMismatch(t *testing.T) {
+	store := &memStore{}
+	multi := NewMultiStore([]Store{store})
+
+	docs := []Document{{Metadata: map[string]interface{}{"source": "a"}}, {Metadata: map[string]interface{}{"source": "b"}}}
+	err := multi.AddDocuments(context.Background(), docs, [][]float32{{1}})
+	var vsErr *VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != ErrCodeAddFailed {
+		t.Errorf("AddDocuments() error = %v, want %s", err, ErrCodeAddFailed)
+	}
+	if len(store.docs) != 0 {
+		t.Errorf("AddDocuments() stored %d documents, want none", len(store.docs))
+	}
+}
+
+func TestMultiStore_SearchError(t *testing.T) {
+	wantErr := errors.New("shard down")
+	multi := NewMultiStore([]Store{&memStore{}, &stubStore{err: wantErr}})
+
+	if _, err := multi.SimilaritySearch(context.Background(), []float32{1}, 3, nil); !errors.Is(err, wantErr) {
+		t.Errorf("SimilaritySearch() error = %v, want %v", err, wantErr)
+	}
+}
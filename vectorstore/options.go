@@ -1,9 +1,42 @@
 package vectorstore
 
+import (
+	"log/slog"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/metrics"
+)
+
 // Options contains configuration for the vector store
 type Options struct {
 	ScoreThreshold float32
 	Filters        Filter
+	Recorder       metrics.Recorder // Receives store latency metrics
+	StoreName      string           // Value of the "store" metric label (defaults to the store's type)
+	Logger         *slog.Logger     // Receives debug logs for searches and warnings for failures
+	Redactor       logging.Redactor // Rewrites query text before it is logged
+
+	// EmbeddingTemplate returns the text embedded for a document, which may
+	// add context such as its title from the metadata. The document is stored
+	// with its PageContent unchanged. Nil embeds PageContent.
+	EmbeddingTemplate func(doc document.Document) string
+	// QueryTemplate returns the text embedded for a search query, so queries
+	// can be phrased like templated documents. Nil embeds the query unchanged.
+	QueryTemplate func(query string) string
+
+	// ColumnEmbedders embeds documents into named vector columns alongside
+	// the default one, and queries searching those columns. It requires a
+	// VectorColumnStore.
+	ColumnEmbedders map[string]embedding.Embedder
+
+	// Fuser assembles search results from the documents the store returns
+	Fuser ResultFuser
+
+	// InputTrim drops documents whose PageContent is empty or only whitespace
+	// before they are embedded, logging each one at debug level
+	InputTrim bool
 }
 
 // DistanceMetric represents the distance calculation method
@@ -31,3 +64,84 @@ func WithFilters(filters Filter) Option {
 		o.Filters = filters
 	}
 }
+
+// WithRecorder sets the recorder for store latency metrics, or discards them when recorder is nil
+func WithRecorder(recorder metrics.Recorder) Option {
+	return func(o *Options) {
+		if recorder == nil {
+			recorder = metrics.NopRecorder{}
+		}
+		o.Recorder = recorder
+	}
+}
+
+// WithStoreName sets the "store" label of the store's metrics
+func WithStoreName(name string) Option {
+	return func(o *Options) {
+		o.StoreName = name
+	}
+}
+
+// WithLogger sets the logger for searches and store failures. A nil logger discards the records.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		if logger == nil {
+			logger = logging.Discard()
+		}
+		o.Logger = logger
+	}
+}
+
+// WithRedactor sets how query text is rewritten before it is logged
+func WithRedactor(redactor logging.Redactor) Option {
+	return func(o *Options) {
+		o.Redactor = redactor
+	}
+}
+
+// WithEmbeddingTemplate sets the text embedded for each document in place of
+// its PageContent, which is still what gets stored
+func WithEmbeddingTemplate(template func(doc document.Document) string) Option {
+	return func(o *Options) {
+		o.EmbeddingTemplate = template
+	}
+}
+
+// WithQueryTemplate sets the text embedded for each search query
+func WithQueryTemplate(template func(query string) string) Option {
+	return func(o *Options) {
+		o.QueryTemplate = template
+	}
+}
+
+// WithInputTrim sets whether documents with empty or whitespace-only content
+// are dropped before embedding (enabled by default)
+func WithInputTrim(enabled bool) Option {
+	return func(o *Options) {
+		o.InputTrim = enabled
+	}
+}
+
+// WithResultFuser sets how search results are assembled from the documents
+// the store returns (SingleVectorFuser by default)
+func WithResultFuser(fuser ResultFuser) Option {
+	return func(o *Options) {
+		o.Fuser = fuser
+	}
+}
+
+// WithColumnEmbedder sets the embedder for the named vector column of a
+// VectorColumnStore. Documents are embedded into the column as they are added
+// and searches select it with WithVectorColumn. The default column always
+// uses the VectorStore's embedder, so DefaultVectorColumn is ignored.
+func WithColumnEmbedder(column string, embedder embedding.Embedder) Option {
+	return func(o *Options) {
+		if column == DefaultVectorColumn {
+			return
+		}
+		if o.ColumnEmbedders == nil {
+			o.ColumnEmbedders = make(map[string]embedding.Embedder)
+		}
+		o.ColumnEmbedders[column] = embedder
+	}
+}
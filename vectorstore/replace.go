@@ -0,0 +1,123 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SourceReplacer is implemented by stores that can replace every chunk of a
+// source atomically: concurrent searches see either all of the old chunks or
+// all of the new ones, never a mix or none.
+type SourceReplacer interface {
+	ReplaceSource(ctx context.Context, source string, docs []Document, vectors [][]float32) error
+}
+
+// ReplaceSource replaces every chunk of source in store with docs, natively
+// when the store is a SourceReplacer and with ReplaceSourceFallback otherwise
+func ReplaceSource(ctx context.Context, store Store, source string, docs []Document, vectors [][]float32) error {
+	if replacer, ok := store.(SourceReplacer); ok {
+		return replacer.ReplaceSource(ctx, source, docs, vectors)
+	}
+	return ReplaceSourceFallback(ctx, store, source, docs, vectors)
+}
+
+// ReplaceSourceFallback replaces the chunks of source by deleting them and then
+// adding docs with one AddDocuments call. It is not atomic: searches running
+// in between find no chunks for the source, and if the add fails the source
+// stays deleted. A store whose AddDocuments stores all of docs or none, such
+// as pgvector, never leaves part of docs. For other stores, the chunks a
+// failed add stored are deleted afterwards; searches may see them until then,
+// and they stay if that delete fails too.
+func ReplaceSourceFallback(ctx context.Context, store Store, source string, docs []Document, vectors [][]float32) error {
+	filter := Filter{"source": source}
+	if err := store.Delete(ctx, filter); err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+	if err := store.AddDocuments(ctx, docs, vectors); err != nil {
+		// Deleted even when ctx is why the add failed
+		if deleteErr := store.Delete(context.WithoutCancel(ctx), filter); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// ReplaceSource embeds docs and replaces every chunk of source with them. The
+// replacement is atomic when the store implements SourceReplacer. When
+// InputTrim drops every document, the source is removed.
+func (vs *VectorStore) ReplaceSource(ctx context.Context, source string, docs []document.Document) error {
+	docs = vs.trimInput(ctx, "replace_source", docs)
+	texts := make([]string, len(docs))
+	vsDocs := make([]Document, len(docs))
+	for i, doc := range docs {
+		texts[i] = vs.embeddingText(doc)
+		vsDocs[i] = FromDocument(doc)
+	}
+
+	// Embed first, so a failing embedder leaves the old chunks in place
+	var vectors [][]float32
+	if len(docs) > 0 {
+		var err error
+		vectors, err = vs.embedder.EmbedDocuments(ctx, texts)
+		if err != nil {
+			if vsDocs, vectors, err = vs.skipRejected(ctx, "replace_source", vsDocs, vectors, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(vs.opts.ColumnEmbedders) > 0 {
+		store, columns, err := vs.withColumns(ctx, vsDocs, vectors)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = store.ReplaceSourceWithVectors(ctx, source, vsDocs, columns)
+		vs.record(ctx, "replace_source", start, err)
+		return err
+	}
+
+	start := time.Now()
+	err := ReplaceSource(ctx, vs.store, source, vsDocs, vectors)
+	vs.record(ctx, "replace_source", start, err)
+	return err
+}
+
+// ReplaceSource replaces the source in the traced store, keeping it atomic if
+// the traced store is a SourceReplacer
+func (t *TracingStore) ReplaceSource(ctx context.Context, source string, docs []Document, vectors [][]float32) error {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.ReplaceSource", trace.WithAttributes(
+		attribute.Int("vectorstore.documents", len(docs)),
+	))
+	defer span.End()
+
+	err := ReplaceSource(ctx, t.store, source, docs, vectors)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// ReplaceSource replaces the source in the store picked by the shard function.
+// It falls back to ReplaceSourceFallback when the shard function doesn't put
+// the source and all of docs in one store.
+func (m *MultiStore) ReplaceSource(ctx context.Context, source string, docs []Document, vectors [][]float32) error {
+	shard := m.shard(map[string]interface{}{"source": source})
+	if shard < 0 || shard >= len(m.stores) {
+		return ReplaceSourceFallback(ctx, m, source, docs, vectors)
+	}
+	for _, doc := range docs {
+		if m.shard(doc.Metadata) != shard {
+			return ReplaceSourceFallback(ctx, m, source, docs, vectors)
+		}
+	}
+	return ReplaceSource(ctx, m.stores[shard], source, docs, vectors)
+}
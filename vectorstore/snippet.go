@@ -0,0 +1,51 @@
+package vectorstore
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/Abraxas-365/kbservice/document"
+)
+
+// WithSnippetLength cuts the PageContent of each result to at most length
+// characters, at the last word boundary within it, for previews that don't
+// need whole chunks. Cut results are flagged with
+// document.TruncatedMetadataKey. It works with every store.
+func WithSnippetLength(length int) SearchOption {
+	return func(o *SearchOptions) {
+		o.SnippetLength = length
+	}
+}
+
+// snippet returns doc with its content cut to at most length characters,
+// before the last whitespace within them when there is any, and flagged as
+// truncated in a copy of its metadata. Content no longer than length, or a
+// length of 0 or less, leaves doc unchanged.
+func snippet(doc Document, length int) Document {
+	if length <= 0 || len(doc.PageContent) <= length {
+		return doc
+	}
+	runes := []rune(doc.PageContent)
+	if len(runes) <= length {
+		return doc
+	}
+
+	cut := length
+	if !unicode.IsSpace(runes[length]) {
+		for i := length - 1; i > 0; i-- {
+			if unicode.IsSpace(runes[i]) {
+				cut = i
+				break
+			}
+		}
+	}
+	doc.PageContent = strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace)
+
+	metadata := make(map[string]interface{}, len(doc.Metadata)+1)
+	for k, v := range doc.Metadata {
+		metadata[k] = v
+	}
+	metadata[document.TruncatedMetadataKey] = true
+	doc.Metadata = metadata
+	return doc
+}
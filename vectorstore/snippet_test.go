@@ -0,0 +1,66 @@
+package vectorstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+func TestVectorStore_SnippetLength(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name          string
+		content       string
+		length        int
+		want          string
+		wantTruncated bool
+	}{
+		{name: "Short content", content: "Reset your password", length: 40, want: "Reset your password"},
+		{name: "Exact length", content: "Reset your password", length: 19, want: "Reset your password"},
+		{name: "Cut at a word boundary", content: "Reset your password from the settings page", length: 22, want: "Reset your password", wantTruncated: true},
+		{name: "Cut before a space", content: "Reset your password now", length: 19, want: "Reset your password", wantTruncated: true},
+		{name: "Single long word", content: "Supercalifragilistic", length: 5, want: "Super", wantTruncated: true},
+		{name: "Multibyte characters", content: "café crème brûlée", length: 12, want: "café crème", wantTruncated: true},
+		{name: "Disabled", content: "Reset your password from the settings page", want: "Reset your password from the settings page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := mocks.NewStore()
+			vs := vectorstore.New(store, mocks.NewEmbedder(4))
+			doc := document.Document{PageContent: tt.content, Metadata: map[string]interface{}{"source": "a.txt"}}
+			if err := vs.AddDocuments(ctx, []document.Document{doc}); err != nil {
+				t.Fatalf("AddDocuments() error = %v", err)
+			}
+
+			docs, err := vs.SimilaritySearch(ctx, "password", 1, nil, vectorstore.WithSnippetLength(tt.length))
+			if err != nil {
+				t.Fatalf("SimilaritySearch() error = %v", err)
+			}
+			if len(docs) != 1 {
+				t.Fatalf("SimilaritySearch() = %d documents, want 1", len(docs))
+			}
+			if docs[0].PageContent != tt.want {
+				t.Errorf("PageContent = %q, want %q", docs[0].PageContent, tt.want)
+			}
+			if truncated := docs[0].Metadata[document.TruncatedMetadataKey] == true; truncated != tt.wantTruncated {
+				t.Errorf("truncated flag = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if docs[0].Metadata["source"] != "a.txt" {
+				t.Errorf("metadata = %v, want the source kept", docs[0].Metadata)
+			}
+
+			// The stored document is left whole
+			stored, err := store.GetDocuments(ctx, nil, 0)
+			if err != nil {
+				t.Fatalf("GetDocuments() error = %v", err)
+			}
+			if stored[0].PageContent != tt.content || stored[0].Metadata[document.TruncatedMetadataKey] != nil {
+				t.Errorf("stored document = %+v, want it unchanged", stored[0])
+			}
+		})
+	}
+}
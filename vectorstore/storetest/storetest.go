@@ -0,0 +1,202 @@
+// Package storetest checks vectorstore.Store implementations against the
+// behavior the rest of the library relies on, so adapter authors can run the
+// same suite as the built-in stores:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.RunConformance(t, func(t *testing.T) vectorstore.Store {
+//			return newEmptyStore(t)
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// Dimension is the vector dimension of the stores the suite runs against
+const Dimension = 3
+
+// StoreFactory returns an empty, initialized store with Dimension-dimensional
+// vectors for a single conformance test
+type StoreFactory func(t *testing.T) vectorstore.Store
+
+// corpus is added to the store before most tests; vectors are chosen so the
+// order of results for the query vector [1, 0, 0] is unambiguous
+func corpus() ([]vectorstore.Document, [][]float32) {
+	docs := []vectorstore.Document{
+		{PageContent: "alpha", Metadata: map[string]interface{}{"source": "a.txt", "lang": "en", "last_modified": "2024-01-01T00:00:00Z"}},
+		{PageContent: "almost alpha", Metadata: map[string]interface{}{"source": "a.txt", "lang": "es", "last_modified": "2024-01-01T00:00:00Z"}},
+		{PageContent: "beta", Metadata: map[string]interface{}{"source": "b.txt", "lang": "en", "last_modified": "2024-01-01T00:00:00Z"}},
+	}
+	vectors := [][]float32{
+		{1, 0, 0},
+		{0.8, 0.6, 0},
+		{0, 0, 1},
+	}
+	return docs, vectors
+}
+
+// RunConformance checks the Store methods every adapter must implement:
+// results come back most similar first with higher scores meaning more
+// similar, filters match metadata values and combine with AND, and deletes
+// remove exactly what their filter matches. The dimension checks only run
+// for stores implementing vectorstore.DimensionProvider.
+func RunConformance(t *testing.T, newStore StoreFactory) {
+	filled := func(t *testing.T) vectorstore.Store {
+		t.Helper()
+		store := newStore(t)
+		docs, vectors := corpus()
+		if err := store.AddDocuments(context.Background(), docs, vectors); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		return store
+	}
+
+	t.Run("Search ranks the most similar first", func(t *testing.T) {
+		store := filled(t)
+		got := search(t, store, 3, nil)
+		if contents(got) != "alpha,almost alpha,beta" {
+			t.Fatalf("SimilaritySearch() = %q, want alpha, almost alpha, beta", contents(got))
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i].Score > got[i-1].Score {
+				t.Errorf("score %d = %v above score %d = %v, want higher scores for more similar documents",
+					i, got[i].Score, i-1, got[i-1].Score)
+			}
+		}
+		if got[0].Score <= got[2].Score {
+			t.Errorf("exact match score %v, want it above the orthogonal document's %v", got[0].Score, got[2].Score)
+		}
+	})
+
+	t.Run("Search returns at most limit documents", func(t *testing.T) {
+		store := filled(t)
+		if got := search(t, store, 2, nil); contents(got) != "alpha,almost alpha" {
+			t.Errorf("SimilaritySearch() = %q, want the 2 most similar", contents(got))
+		}
+	})
+
+	t.Run("Search returns content and metadata as added", func(t *testing.T) {
+		store := filled(t)
+		got := search(t, store, 1, nil)
+		if len(got) != 1 {
+			t.Fatalf("SimilaritySearch() = %d documents, want 1", len(got))
+		}
+		want := map[string]interface{}{"source": "a.txt", "lang": "en", "last_modified": "2024-01-01T00:00:00Z"}
+		for key, value := range want {
+			if got[0].Metadata[key] != value {
+				t.Errorf("metadata[%q] = %v, want %v", key, got[0].Metadata[key], value)
+			}
+		}
+		if got[0].PageContent != "alpha" {
+			t.Errorf("PageContent = %q, want alpha", got[0].PageContent)
+		}
+	})
+
+	t.Run("Filters match metadata values", func(t *testing.T) {
+		store := filled(t)
+		for _, test := range []struct {
+			filter vectorstore.Filter
+			want   string
+		}{
+			{filter: vectorstore.Filter{"source": "b.txt"}, want: "beta"},
+			{filter: vectorstore.Filter{"lang": "en"}, want: "alpha,beta"},
+			{filter: vectorstore.Filter{"source": "a.txt", "lang": "es"}, want: "almost alpha"},
+			{filter: vectorstore.Filter{"source": "c.txt"}, want: ""},
+		} {
+			if got := search(t, store, 10, test.filter); contents(got) != test.want {
+				t.Errorf("SimilaritySearch(%v) = %q, want %q", test.filter, contents(got), test.want)
+			}
+		}
+	})
+
+	t.Run("Delete removes only matching documents", func(t *testing.T) {
+		store := filled(t)
+		if err := store.Delete(context.Background(), vectorstore.Filter{"source": "a.txt", "lang": "en"}); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if got := search(t, store, 10, nil); contents(got) != "almost alpha,beta" {
+			t.Errorf("after Delete() = %q, want almost alpha and beta", contents(got))
+		}
+	})
+
+	t.Run("Delete with an empty filter removes everything", func(t *testing.T) {
+		store := filled(t)
+		if err := store.Delete(context.Background(), vectorstore.Filter{}); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if got := search(t, store, 10, nil); len(got) != 0 {
+			t.Errorf("after Delete() = %q, want nothing", contents(got))
+		}
+	})
+
+	t.Run("DocumentExists matches source and last_modified", func(t *testing.T) {
+		store := filled(t)
+		check := func(source, lastModified string) document.Document {
+			return document.Document{Metadata: map[string]interface{}{"source": source, "last_modified": lastModified}}
+		}
+		exists, err := store.DocumentExists(context.Background(), []document.Document{
+			check("a.txt", "2024-01-01T00:00:00Z"),
+			check("a.txt", "2024-02-01T00:00:00Z"),
+			check("c.txt", "2024-01-01T00:00:00Z"),
+		})
+		if err != nil {
+			t.Fatalf("DocumentExists() error = %v", err)
+		}
+		if len(exists) != 3 || !exists[0] || exists[1] || exists[2] {
+			t.Errorf("DocumentExists() = %v, want [true false false]", exists)
+		}
+	})
+
+	t.Run("Vectors of the wrong dimension are rejected", func(t *testing.T) {
+		store := newStore(t)
+		provider, ok := vectorstore.Unwrap(store).(vectorstore.DimensionProvider)
+		if !ok {
+			t.Skipf("%T has no fixed dimension", store)
+		}
+		if provider.Dimension() != Dimension {
+			t.Fatalf("Dimension() = %d, want %d", provider.Dimension(), Dimension)
+		}
+
+		ctx := context.Background()
+		doc := []vectorstore.Document{{PageContent: "short", Metadata: map[string]interface{}{"source": "a.txt"}}}
+		assertInvalidDimensions(t, "AddDocuments", store.AddDocuments(ctx, doc, [][]float32{{1, 0}}))
+		_, err := store.SimilaritySearch(ctx, []float32{1, 0}, 1, nil)
+		assertInvalidDimensions(t, "SimilaritySearch", err)
+	})
+}
+
+// search runs a similarity search for [1, 0, 0]
+func search(t *testing.T, store vectorstore.Store, limit int, filter vectorstore.Filter) []vectorstore.Document {
+	t.Helper()
+	docs, err := store.SimilaritySearch(context.Background(), []float32{1, 0, 0}, limit, filter)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	return docs
+}
+
+// contents joins the page contents of docs with commas
+func contents(docs []vectorstore.Document) string {
+	var joined string
+	for i, doc := range docs {
+		if i > 0 {
+			joined += ","
+		}
+		joined += doc.PageContent
+	}
+	return joined
+}
+
+func assertInvalidDimensions(t *testing.T, op string, err error) {
+	t.Helper()
+	var vsErr *vectorstore.VectorStoreError
+	if !errors.As(err, &vsErr) || vsErr.Code != vectorstore.ErrCodeInvalidDimensions {
+		t.Errorf("%s() with a 2-dimensional vector error = %v, want ErrCodeInvalidDimensions", op, err)
+	}
+}
@@ -0,0 +1,97 @@
+package vectorstore
+
+import (
+	"context"
+	"time"
+)
+
+// StreamingSearcher is implemented by stores that can send the results of a
+// similarity search as they read them, best first
+type StreamingSearcher interface {
+	// SimilaritySearchStream sends the documents of a similarity search on
+	// the first channel and closes both channels when the search ends. The
+	// error channel receives at most one error. Canceling ctx stops the
+	// search.
+	SimilaritySearchStream(ctx context.Context, vector []float32, limit int, filter Filter) (<-chan Document, <-chan error)
+}
+
+// SimilaritySearchStream is SimilaritySearch sending each document as soon
+// as the store reads it, for limits too large to collect into a slice.
+// Documents scoring below ScoreThreshold are skipped, and the results aren't
+// passed through the Fuser. Stores that aren't a StreamingSearcher are
+// searched with SimilaritySearch and their results sent once found.
+//
+// Both channels are closed when the search ends. The error channel receives
+// at most one error, after the last document. Canceling ctx stops the
+// search; callers that stop reading early must cancel it.
+func (vs *VectorStore) SimilaritySearchStream(ctx context.Context, query string, limit int, filter Filter) (<-chan Document, <-chan error) {
+	docChan := make(chan Document)
+	errChan := make(chan error, 1) // buffered channel for error
+
+	go func() {
+		defer close(docChan)
+		defer close(errChan)
+
+		vector, err := vs.embedder.EmbedQuery(ctx, vs.queryText(query))
+		if err != nil {
+			errChan <- err
+			return
+		}
+
+		start := time.Now()
+		sent := 0
+		err = vs.streamSearch(ctx, vector, limit, vs.mergeFilter(filter), func(doc Document) error {
+			if vs.opts.ScoreThreshold > 0 && doc.Score < vs.opts.ScoreThreshold {
+				return nil
+			}
+			select {
+			case docChan <- doc:
+				sent++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		vs.record(ctx, "similarity_search_stream", start, err)
+		vs.opts.Logger.DebugContext(ctx, "similarity search stream",
+			"store", vs.opts.StoreName,
+			"limit", limit,
+			"results", sent,
+		)
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	return docChan, errChan
+}
+
+// streamSearch calls fn with each document of a similarity search until fn
+// fails, streaming them from the store when it is a StreamingSearcher
+func (vs *VectorStore) streamSearch(ctx context.Context, vector []float32, limit int, filter Filter, fn func(Document) error) error {
+	streamer, ok := Unwrap(vs.store).(StreamingSearcher)
+	if !ok {
+		docs, err := vs.store.SimilaritySearch(ctx, vector, limit, filter)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The store stops when ctx is canceled, so canceling it here releases
+	// the store's goroutine if fn fails before the results are drained
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	docs, errs := streamer.SimilaritySearchStream(ctx, vector, limit, filter)
+	for doc := range docs {
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return <-errs
+}
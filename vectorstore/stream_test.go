@@ -0,0 +1,135 @@
+package vectorstore_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+// streamingStore streams n documents with descending scores, counting the
+// ones it scanned and closing done when it stops
+type streamingStore struct {
+	*mocks.Store
+	n       int
+	scanned atomic.Int64
+	filter  vectorstore.Filter
+	done    chan struct{}
+}
+
+func newStreamingStore(n int) *streamingStore {
+	return &streamingStore{Store: mocks.NewStore(), n: n, done: make(chan struct{})}
+}
+
+func (s *streamingStore) SimilaritySearchStream(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) (<-chan vectorstore.Document, <-chan error) {
+	s.filter = filter
+	docs := make(chan vectorstore.Document)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(s.done)
+		defer close(docs)
+		defer close(errs)
+		for i := 0; i < s.n && (limit <= 0 || i < limit); i++ {
+			s.scanned.Add(1)
+			doc := vectorstore.Document{PageContent: strconv.Itoa(i), Score: 1 - float32(i)/float32(s.n)}
+			select {
+			case docs <- doc:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return docs, errs
+}
+
+// collect reads a stream to its end
+func collect(docs <-chan vectorstore.Document, errs <-chan error) ([]string, error) {
+	var contents []string
+	for doc := range docs {
+		contents = append(contents, doc.PageContent)
+	}
+	return contents, <-errs
+}
+
+func TestVectorStore_SimilaritySearchStream(t *testing.T) {
+	store := newStreamingStore(10)
+	vs := vectorstore.New(store, mocks.NewEmbedder(4),
+		vectorstore.WithFilters(vectorstore.Filter{"tenant": "acme"}),
+		vectorstore.WithScoreThreshold(0.65),
+	)
+
+	got, err := collect(vs.SimilaritySearchStream(context.Background(), "query", 8, vectorstore.Filter{"lang": "en"}))
+	if err != nil {
+		t.Fatalf("SimilaritySearchStream() error = %v", err)
+	}
+	// Scores run from 1 down by 0.1, the last three of the eight fall below the threshold
+	if want := []string{"0", "1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SimilaritySearchStream() = %v, want %v", got, want)
+	}
+	if store.filter["tenant"] != "acme" || store.filter["lang"] != "en" {
+		t.Errorf("filter = %v, want the default and query filters merged", store.filter)
+	}
+	if calls := store.Calls("SimilaritySearch"); len(calls) != 0 {
+		t.Errorf("SimilaritySearch calls = %d, want the stream used", len(calls))
+	}
+}
+
+func TestVectorStore_SimilaritySearchStreamFallback(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+	var results []vectorstore.Document
+	for i := 0; i < 5; i++ {
+		results = append(results, vectorstore.Document{PageContent: strconv.Itoa(i), Score: 0.9})
+	}
+	store.SimilaritySearchFunc = func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+		return results, nil
+	}
+	vs := vectorstore.New(store, embedder)
+
+	got, err := collect(vs.SimilaritySearchStream(ctx, "query", 5, nil))
+	if err != nil {
+		t.Fatalf("SimilaritySearchStream() error = %v", err)
+	}
+	if len(got) != 5 || got[0] != "0" || got[4] != "4" {
+		t.Errorf("SimilaritySearchStream() = %v, want the five results in order", got)
+	}
+
+	store.SimilaritySearchFunc = nil
+	store.FailWith("SimilaritySearch", vectorstore.NewSearchFailedError("mock", errors.New("boom")))
+	if _, err := collect(vs.SimilaritySearchStream(ctx, "query", 5, nil)); err == nil {
+		t.Error("SimilaritySearchStream() error = nil, want the search error")
+	}
+}
+
+func TestVectorStore_SimilaritySearchStreamCancel(t *testing.T) {
+	store := newStreamingStore(1000)
+	vs := vectorstore.New(store, mocks.NewEmbedder(4))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, errs := vs.SimilaritySearchStream(ctx, "query", 0, nil)
+	for i := 0; i < 3; i++ {
+		<-docs
+	}
+	cancel()
+	for range docs {
+	}
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("SimilaritySearchStream() error = %v, want context.Canceled", err)
+	}
+	select {
+	case <-store.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("store still scanning after cancel")
+	}
+	if scanned := store.scanned.Load(); scanned >= 1000 {
+		t.Errorf("scanned %d documents, want the scan stopped early", scanned)
+	}
+}
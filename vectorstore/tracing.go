@@ -0,0 +1,110 @@
+package vectorstore
+
+import (
+	"context"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Abraxas-365/kbservice/vectorstore"
+
+// TracingStore wraps a Store, recording spans for searches and writes
+type TracingStore struct {
+	store  Store
+	tracer trace.Tracer
+}
+
+// NewTracingStore creates a TracingStore that records spans with tp
+func NewTracingStore(store Store, tp trace.TracerProvider) *TracingStore {
+	return &TracingStore{
+		store:  store,
+		tracer: tp.Tracer(tracerName),
+	}
+}
+
+// Unwrap returns the traced store
+func (t *TracingStore) Unwrap() Store {
+	return t.store
+}
+
+func (t *TracingStore) AddDocuments(ctx context.Context, docs []Document, vectors [][]float32) error {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.AddDocuments", trace.WithAttributes(
+		attribute.Int("vectorstore.documents", len(docs)),
+	))
+	defer span.End()
+
+	err := t.store.AddDocuments(ctx, docs, vectors)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (t *TracingStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter Filter) ([]Document, error) {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.SimilaritySearch", trace.WithAttributes(
+		attribute.Int("vectorstore.limit", limit),
+	))
+	defer span.End()
+
+	docs, err := t.store.SimilaritySearch(ctx, vector, limit, filter)
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int("vectorstore.results", len(docs)))
+	return docs, err
+}
+
+func (t *TracingStore) Delete(ctx context.Context, filter Filter) error {
+	return t.store.Delete(ctx, filter)
+}
+
+func (t *TracingStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return t.store.InitDB(ctx, forceRecreate)
+}
+
+func (t *TracingStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	return t.store.DocumentExists(ctx, docs)
+}
+
+// tracingColumnStore records spans for the VectorColumnStore of a
+// TracingStore
+type tracingColumnStore struct {
+	store  VectorColumnStore
+	tracer trace.Tracer
+}
+
+func (t *tracingColumnStore) AddDocumentsWithVectors(ctx context.Context, docs []Document, vectors map[string][][]float32) error {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.AddDocuments", trace.WithAttributes(
+		attribute.Int("vectorstore.documents", len(docs)),
+		attribute.Int("vectorstore.columns", len(vectors)),
+	))
+	defer span.End()
+
+	err := t.store.AddDocumentsWithVectors(ctx, docs, vectors)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (t *tracingColumnStore) ReplaceSourceWithVectors(ctx context.Context, source string, docs []Document, vectors map[string][][]float32) error {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.ReplaceSource", trace.WithAttributes(
+		attribute.Int("vectorstore.documents", len(docs)),
+		attribute.Int("vectorstore.columns", len(vectors)),
+	))
+	defer span.End()
+
+	err := t.store.ReplaceSourceWithVectors(ctx, source, docs, vectors)
+	tracing.RecordError(span, err)
+	return err
+}
+
+func (t *tracingColumnStore) SimilaritySearchWithOptions(ctx context.Context, vector []float32, limit int, filter Filter, opts SearchOptions) ([]Document, error) {
+	ctx, span := t.tracer.Start(ctx, "vectorstore.SimilaritySearch", trace.WithAttributes(
+		attribute.Int("vectorstore.limit", limit),
+		attribute.String("vectorstore.column", opts.Column),
+	))
+	defer span.End()
+
+	docs, err := t.store.SimilaritySearchWithOptions(ctx, vector, limit, filter, opts)
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int("vectorstore.results", len(docs)))
+	return docs, err
+}
@@ -2,9 +2,15 @@ package vectorstore
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Abraxas-365/kbservice/document"
 	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/logging"
+	"github.com/Abraxas-365/kbservice/metrics"
 )
 
 // Filter represents a query filter
@@ -15,6 +21,9 @@ type Document struct {
 	PageContent string                 `json:"page_content"`
 	Metadata    map[string]interface{} `json:"metadata"`
 	Score       float32                `json:"score"`
+	// Vector is the stored embedding, set only by searches with
+	// WithReturnVectors
+	Vector []float32 `json:"vector,omitempty"`
 }
 
 // ToDocument converts a vectorstore.Document to document.Document
@@ -35,7 +44,8 @@ func FromDocument(doc document.Document) Document {
 
 // Store interface defines the operations that any vector database adapter must implement
 type Store interface {
-	// AddDocuments adds documents to the vector store
+	// AddDocuments adds documents to the vector store. Stores should add all
+	// of them or, when it fails, none.
 	AddDocuments(ctx context.Context, docs []Document, vectors [][]float32) error
 
 	// SimilaritySearch performs a similarity search using the provided vector
@@ -49,6 +59,36 @@ type Store interface {
 	DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error)
 }
 
+// DimensionProvider is implemented by stores with a fixed vector dimension
+type DimensionProvider interface {
+	Dimension() int
+}
+
+// SourceLister is implemented by stores that can list the sources they hold documents for
+type SourceLister interface {
+	ListSources(ctx context.Context) ([]string, error)
+}
+
+// DocumentGetter is implemented by stores that can fetch documents by their
+// metadata alone, without a query vector
+type DocumentGetter interface {
+	// GetDocuments returns up to limit documents matching filter, in no
+	// particular order, or every match when limit is 0
+	GetDocuments(ctx context.Context, filter Filter, limit int) ([]Document, error)
+}
+
+// CountingDeleter is implemented by stores that can report how many documents a delete removed
+type CountingDeleter interface {
+	DeleteCount(ctx context.Context, filter Filter) (int, error)
+}
+
+// ConditionMatcher is implemented by stores whose filters match Conditions
+// wherever they take a Filter, Delete included. The method only marks
+// support; stores without it may reject filters with Conditions.
+type ConditionMatcher interface {
+	MatchesConditions()
+}
+
 // VectorStore is the main struct that combines the database adapter and embedder
 type VectorStore struct {
 	store    Store
@@ -60,12 +100,22 @@ type VectorStore struct {
 func New(store Store, embedder embedding.Embedder, opts ...Option) *VectorStore {
 	options := &Options{
 		ScoreThreshold: 0.0,
+		Recorder:       metrics.NopRecorder{},
+		Logger:         logging.Discard(),
+		InputTrim:      true,
 	}
 
 	for _, opt := range opts {
 		opt(options)
 	}
 
+	if options.StoreName == "" {
+		options.StoreName = storeName(store)
+	}
+	if options.Fuser == nil {
+		options.Fuser = SingleVectorFuser{}
+	}
+
 	return &VectorStore{
 		store:    store,
 		embedder: embedder,
@@ -73,64 +123,276 @@ func New(store Store, embedder embedding.Embedder, opts ...Option) *VectorStore
 	}
 }
 
+// Unwrap returns the innermost store behind wrappers such as TracingStore
+func Unwrap(store Store) Store {
+	for {
+		wrapper, ok := store.(interface{ Unwrap() Store })
+		if !ok {
+			return store
+		}
+		store = wrapper.Unwrap()
+	}
+}
+
+// storeName names a store after its type, looking through wrappers such as TracingStore
+func storeName(store Store) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", Unwrap(store)), "*")
+}
+
 // AddDocuments adds documents to the vector store
 func (vs *VectorStore) AddDocuments(ctx context.Context, docs []document.Document) error {
+	docs = vs.trimInput(ctx, "add_documents", docs)
+	if len(docs) == 0 {
+		return nil
+	}
+
 	texts := make([]string, len(docs))
 	vsDocs := make([]Document, len(docs))
 	for i, doc := range docs {
-		texts[i] = doc.PageContent
+		texts[i] = vs.embeddingText(doc)
 		vsDocs[i] = FromDocument(doc)
 	}
 
 	vectors, err := vs.embedder.EmbedDocuments(ctx, texts)
 	if err != nil {
+		if vsDocs, vectors, err = vs.skipRejected(ctx, "add_documents", vsDocs, vectors, err); err != nil {
+			return err
+		}
+	}
+
+	if len(vs.opts.ColumnEmbedders) > 0 {
+		store, columns, err := vs.withColumns(ctx, vsDocs, vectors)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = store.AddDocumentsWithVectors(ctx, vsDocs, columns)
+		vs.record(ctx, "add_documents", start, err)
 		return err
 	}
 
-	return vs.store.AddDocuments(ctx, vsDocs, vectors)
+	start := time.Now()
+	err = vs.store.AddDocuments(ctx, vsDocs, vectors)
+	vs.record(ctx, "add_documents", start, err)
+	return err
+}
+
+// SearchResult is the outcome of a Search
+type SearchResult struct {
+	Documents []Document // Documents scoring at least ScoreThreshold, best first
+	Rejected  int        // Documents found below ScoreThreshold
+	// BestRejectedScore is the best score below ScoreThreshold, for tuning
+	// the threshold. It is 0 when no document was rejected.
+	BestRejectedScore float32
 }
 
 // SimilaritySearch performs a similarity search using the query text
-func (vs *VectorStore) SimilaritySearch(ctx context.Context, query string, limit int, filter Filter) ([]Document, error) {
-	vector, err := vs.embedder.EmbedQuery(ctx, query)
+func (vs *VectorStore) SimilaritySearch(ctx context.Context, query string, limit int, filter Filter, opts ...SearchOption) ([]Document, error) {
+	result, err := vs.Search(ctx, query, limit, filter, opts...)
 	if err != nil {
 		return nil, err
 	}
+	return result.Documents, nil
+}
 
-	// Merge default filters with query filters
-	mergedFilter := make(Filter)
-	if vs.opts.Filters != nil {
-		for k, v := range vs.opts.Filters {
-			mergedFilter[k] = v
-		}
+// Search performs a similarity search like SimilaritySearch, also reporting
+// the documents the score threshold rejected, so an empty result can be told
+// apart from one where every document scored too low
+func (vs *VectorStore) Search(ctx context.Context, query string, limit int, filter Filter, opts ...SearchOption) (*SearchResult, error) {
+	var options SearchOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-	if filter != nil {
-		for k, v := range filter {
-			mergedFilter[k] = v
+	var columns VectorColumnStore
+	if options.Column != DefaultVectorColumn || options.ReturnVectors {
+		var err error
+		if columns, err = vs.columnStore(); err != nil {
+			return nil, err
 		}
 	}
 
-	vsDocs, err := vs.store.SimilaritySearch(ctx, vector, limit, mergedFilter)
+	vector, err := vs.queryEmbedder(options.Column).EmbedQuery(ctx, vs.queryText(query))
+	if err != nil {
+		return nil, err
+	}
+
+	mergedFilter := vs.mergeFilter(filter)
+
+	start := time.Now()
+	var vsDocs []Document
+	if columns != nil {
+		vsDocs, err = columns.SimilaritySearchWithOptions(ctx, vector, limit, mergedFilter, options)
+	} else {
+		vsDocs, err = vs.store.SimilaritySearch(ctx, vector, limit, mergedFilter)
+	}
+	vs.record(ctx, "similarity_search", start, err)
+	if err != nil {
+		return nil, err
+	}
+	fused, err := vs.opts.Fuser.Fuse(ctx, [][]Document{vsDocs}, limit)
 	if err != nil {
 		return nil, err
 	}
 
 	// Apply score threshold and convert to document.Document
-	docs := make([]Document, 0, len(vsDocs))
-	for _, vsDoc := range vsDocs {
+	result := &SearchResult{Documents: make([]Document, 0, len(fused))}
+	scores := make([]float32, 0, len(fused))
+	for _, vsDoc := range fused {
 		if vs.opts.ScoreThreshold <= 0 || vsDoc.Score >= vs.opts.ScoreThreshold {
-			docs = append(docs, vsDoc)
+			result.Documents = append(result.Documents, snippet(vsDoc, options.SnippetLength))
+			scores = append(scores, vsDoc.Score)
+			continue
+		}
+		if result.Rejected == 0 || vsDoc.Score > result.BestRejectedScore {
+			result.BestRejectedScore = vsDoc.Score
+		}
+		result.Rejected++
+	}
+
+	vs.opts.Logger.DebugContext(ctx, "similarity search",
+		"store", vs.opts.StoreName,
+		"query", logging.Redact(vs.opts.Redactor, query),
+		"column", options.Column,
+		"limit", limit,
+		"results", len(result.Documents),
+		"below_threshold", result.Rejected,
+		"best_rejected_score", result.BestRejectedScore,
+		"scores", scores,
+	)
+
+	return result, nil
+}
+
+// mergeFilter merges the default filters with the filter of a query, whose
+// values take precedence
+func (vs *VectorStore) mergeFilter(filter Filter) Filter {
+	merged := make(Filter)
+	for k, v := range vs.opts.Filters {
+		merged[k] = v
+	}
+	for k, v := range filter {
+		merged[k] = v
+	}
+	return merged
+}
+
+// trimInput drops the documents with no content to embed when InputTrim is set
+func (vs *VectorStore) trimInput(ctx context.Context, operation string, docs []document.Document) []document.Document {
+	if !vs.opts.InputTrim {
+		return docs
+	}
+
+	kept := docs[:0:0]
+	for i, doc := range docs {
+		if strings.TrimSpace(doc.PageContent) != "" {
+			kept = append(kept, doc)
+			continue
+		}
+		vs.opts.Logger.DebugContext(ctx, "skipped empty document",
+			"store", vs.opts.StoreName,
+			"operation", operation,
+			"source", doc.Metadata["source"],
+			"index", i,
+		)
+	}
+	return kept
+}
+
+// skipRejected drops the documents whose input an embedder with failure
+// isolation rejected, as reported by an *embedding.PartialEmbedError. Any
+// other error, or every input being rejected, is returned.
+func (vs *VectorStore) skipRejected(ctx context.Context, operation string, docs []Document, vectors [][]float32, err error) ([]Document, [][]float32, error) {
+	var partial *embedding.PartialEmbedError
+	if !errors.As(err, &partial) || len(vectors) != len(docs) || len(partial.Failed) == len(docs) {
+		return nil, nil, err
+	}
+
+	keptDocs := make([]Document, 0, len(docs)-len(partial.Failed))
+	keptVectors := make([][]float32, 0, len(docs)-len(partial.Failed))
+	for i, doc := range docs {
+		if vectors[i] != nil {
+			keptDocs = append(keptDocs, doc)
+			keptVectors = append(keptVectors, vectors[i])
 		}
 	}
+	for i, index := range partial.Failed {
+		vs.opts.Logger.WarnContext(ctx, "skipped document rejected by embedder",
+			"store", vs.opts.StoreName,
+			"operation", operation,
+			"source", docs[index].Metadata["source"],
+			"index", index,
+			"error", partial.Errs[i],
+		)
+	}
+	return keptDocs, keptVectors, nil
+}
+
+// embeddingText returns the text embedded for doc
+func (vs *VectorStore) embeddingText(doc document.Document) string {
+	if vs.opts.EmbeddingTemplate == nil {
+		return doc.PageContent
+	}
+	return vs.opts.EmbeddingTemplate(doc)
+}
 
-	return docs, nil
+// queryText returns the text embedded for a search query
+func (vs *VectorStore) queryText(query string) string {
+	if vs.opts.QueryTemplate == nil {
+		return query
+	}
+	return vs.opts.QueryTemplate(query)
 }
 
 func (vs *VectorStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
-	return vs.store.DocumentExists(ctx, docs)
+	start := time.Now()
+	exists, err := vs.store.DocumentExists(ctx, docs)
+	vs.record(ctx, "document_exists", start, err)
+	return exists, err
 }
 
 // Delete removes documents from the store
 func (vs *VectorStore) Delete(ctx context.Context, filter Filter) error {
-	return vs.store.Delete(ctx, filter)
+	start := time.Now()
+	err := vs.store.Delete(ctx, filter)
+	vs.record(ctx, "delete", start, err)
+	return err
+}
+
+// DeleteCount removes documents from the store and returns how many were
+// removed, or -1 when the store isn't a CountingDeleter
+func (vs *VectorStore) DeleteCount(ctx context.Context, filter Filter) (int, error) {
+	deleter, ok := Unwrap(vs.store).(CountingDeleter)
+	if !ok {
+		if err := vs.Delete(ctx, filter); err != nil {
+			return 0, err
+		}
+		return -1, nil
+	}
+	start := time.Now()
+	removed, err := deleter.DeleteCount(ctx, filter)
+	vs.record(ctx, "delete", start, err)
+	return removed, err
+}
+
+// record emits latency metrics for a store call and logs its failure
+func (vs *VectorStore) record(ctx context.Context, operation string, start time.Time, err error) {
+	vs.opts.Recorder.Histogram(metrics.VectorStoreLatency, time.Since(start).Seconds(), metrics.Labels{
+		"store":     vs.opts.StoreName,
+		"operation": operation,
+		"status":    metrics.Status(err),
+	})
+
+	if err != nil {
+		var code ErrorCode
+		var vsErr *VectorStoreError
+		if errors.As(err, &vsErr) {
+			code = vsErr.Code
+		}
+		vs.opts.Logger.WarnContext(ctx, "vector store operation failed",
+			"store", vs.opts.StoreName,
+			"operation", operation,
+			"code", string(code),
+			"error", err,
+		)
+	}
 }
@@ -0,0 +1,404 @@
+package vectorstore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/embedding"
+	"github.com/Abraxas-365/kbservice/mocks"
+	"github.com/Abraxas-365/kbservice/vectorstore"
+)
+
+func TestVectorStore_AddDocumentsEmbedsContent(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+	vs := vectorstore.New(store, embedder)
+
+	docs := []document.Document{
+		{PageContent: "first", Metadata: map[string]interface{}{"source": "a"}},
+		{PageContent: "second", Metadata: map[string]interface{}{"source": "a"}},
+	}
+	if err := vs.AddDocuments(ctx, docs); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	embedCalls := embedder.Calls("EmbedDocuments")
+	if len(embedCalls) != 1 {
+		t.Fatalf("EmbedDocuments calls = %d, want 1", len(embedCalls))
+	}
+	texts := embedCalls[0].Args[0].([]string)
+	if len(texts) != 2 || texts[0] != "first" || texts[1] != "second" {
+		t.Errorf("EmbedDocuments texts = %v, want the page contents", texts)
+	}
+
+	addCalls := store.Calls("AddDocuments")
+	if len(addCalls) != 1 {
+		t.Fatalf("AddDocuments calls = %d, want 1", len(addCalls))
+	}
+	vectors := addCalls[0].Args[1].([][]float32)
+	if len(vectors) != 2 || len(vectors[0]) != 4 {
+		t.Errorf("AddDocuments vectors = %v, want two 4-dimensional vectors", vectors)
+	}
+}
+
+func TestVectorStore_AddDocumentsEmbeddingError(t *testing.T) {
+	errEmbed := errors.New("embed failed")
+	embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+	embedder.FailNext("EmbedDocuments", errEmbed)
+	vs := vectorstore.New(store, embedder)
+
+	err := vs.AddDocuments(context.Background(), []document.Document{{PageContent: "a"}})
+	if !errors.Is(err, errEmbed) {
+		t.Errorf("AddDocuments() error = %v, want %v", err, errEmbed)
+	}
+	if got := store.CallCount("AddDocuments"); got != 0 {
+		t.Errorf("AddDocuments reached the store %d times after an embedding error", got)
+	}
+}
+
+func TestVectorStore_SimilaritySearchMergesFilters(t *testing.T) {
+	store := mocks.NewStore()
+	vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithFilters(vectorstore.Filter{
+		"tenant": "acme",
+		"lang":   "en",
+	}))
+
+	_, err := vs.SimilaritySearch(context.Background(), "query", 3, vectorstore.Filter{"lang": "es"})
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+
+	calls := store.Calls("SimilaritySearch")
+	if len(calls) != 1 {
+		t.Fatalf("SimilaritySearch calls = %d, want 1", len(calls))
+	}
+	filter := calls[0].Args[2].(vectorstore.Filter)
+	if len(filter) != 2 || filter["tenant"] != "acme" || filter["lang"] != "es" {
+		t.Errorf("store filter = %v, want default tenant with the query's lang", filter)
+	}
+	if limit := calls[0].Args[1].(int); limit != 3 {
+		t.Errorf("store limit = %d, want 3", limit)
+	}
+}
+
+func TestVectorStore_SimilaritySearchScoreThreshold(t *testing.T) {
+	store := mocks.NewStore()
+	store.SimilaritySearchFunc = func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+		return []vectorstore.Document{
+			{PageContent: "close", Score: 0.9},
+			{PageContent: "borderline", Score: 0.5},
+			{PageContent: "far", Score: 0.1},
+		}, nil
+	}
+	vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithScoreThreshold(0.5))
+
+	docs, err := vs.SimilaritySearch(context.Background(), "query", 10, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(docs) != 2 || docs[0].PageContent != "close" || docs[1].PageContent != "borderline" {
+		t.Errorf("SimilaritySearch() = %v, want documents scoring at least 0.5", docs)
+	}
+}
+
+func TestVectorStore_SimilaritySearchResultFuser(t *testing.T) {
+	store := mocks.NewStore()
+	store.SimilaritySearchFunc = func(ctx context.Context, vector []float32, limit int, filter vectorstore.Filter) ([]vectorstore.Document, error) {
+		return []vectorstore.Document{
+			{PageContent: "first", Score: 0.9},
+			{PageContent: "second", Score: 0.7},
+			{PageContent: "third", Score: 0.2},
+		}, nil
+	}
+
+	var gotCandidates [][]vectorstore.Document
+	var gotLimit int
+	// Reverse the store's order and boost the scores
+	reverse := vectorstore.ResultFuserFunc(func(ctx context.Context, candidates [][]vectorstore.Document, limit int) ([]vectorstore.Document, error) {
+		gotCandidates, gotLimit = candidates, limit
+		var fused []vectorstore.Document
+		for i := len(candidates[0]) - 1; i >= 0; i-- {
+			doc := candidates[0][i]
+			doc.Score += 0.1
+			fused = append(fused, doc)
+		}
+		return fused, nil
+	})
+	vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithResultFuser(reverse), vectorstore.WithScoreThreshold(0.5))
+
+	docs, err := vs.SimilaritySearch(context.Background(), "query", 3, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if len(gotCandidates) != 1 || len(gotCandidates[0]) != 3 || gotLimit != 3 {
+		t.Errorf("fuser got %d candidate lists with limit %d, want the store's documents and limit 3", len(gotCandidates), gotLimit)
+	}
+	if len(docs) != 2 || docs[0].PageContent != "second" || docs[1].PageContent != "first" || docs[0].Score != 0.8 {
+		t.Errorf("SimilaritySearch() = %v, want the fused order with the threshold applied to fused scores", docs)
+	}
+
+	t.Run("Fuser errors fail the search", func(t *testing.T) {
+		failing := vectorstore.ResultFuserFunc(func(ctx context.Context, candidates [][]vectorstore.Document, limit int) ([]vectorstore.Document, error) {
+			return nil, errors.New("fusion failed")
+		})
+		vs := vectorstore.New(store, mocks.NewEmbedder(4), vectorstore.WithResultFuser(failing))
+		if _, err := vs.SimilaritySearch(context.Background(), "query", 3, nil); err == nil || err.Error() != "fusion failed" {
+			t.Errorf("SimilaritySearch() error = %v, want the fuser's error", err)
+		}
+	})
+}
+
+func TestSingleVectorFuser(t *testing.T) {
+	candidates := [][]vectorstore.Document{{{PageContent: "a"}, {PageContent: "b"}, {PageContent: "c"}}}
+	docs, err := vectorstore.SingleVectorFuser{}.Fuse(context.Background(), candidates, 2)
+	if err != nil || len(docs) != 2 || docs[0].PageContent != "a" || docs[1].PageContent != "b" {
+		t.Errorf("Fuse() = %v, %v, want the first 2 candidates in order", docs, err)
+	}
+	if docs, _ := (vectorstore.SingleVectorFuser{}).Fuse(context.Background(), nil, 2); docs != nil {
+		t.Errorf("Fuse() without candidates = %v, want none", docs)
+	}
+}
+
+func TestVectorStore_SimilaritySearchErrors(t *testing.T) {
+	errInjected := errors.New("injected")
+
+	t.Run("Embedding error skips the store", func(t *testing.T) {
+		embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+		embedder.FailNext("EmbedQuery", errInjected)
+
+		_, err := vectorstore.New(store, embedder).SimilaritySearch(context.Background(), "query", 1, nil)
+		if !errors.Is(err, errInjected) {
+			t.Errorf("SimilaritySearch() error = %v, want %v", err, errInjected)
+		}
+		if got := store.CallCount("SimilaritySearch"); got != 0 {
+			t.Errorf("store searched %d times after an embedding error", got)
+		}
+	})
+
+	t.Run("Store error is returned", func(t *testing.T) {
+		store := mocks.NewStore()
+		store.FailNext("SimilaritySearch", errInjected)
+
+		_, err := vectorstore.New(store, mocks.NewEmbedder(4)).SimilaritySearch(context.Background(), "query", 1, nil)
+		if !errors.Is(err, errInjected) {
+			t.Errorf("SimilaritySearch() error = %v, want %v", err, errInjected)
+		}
+	})
+}
+
+func TestVectorStore_DeleteAndDocumentExistsPassThrough(t *testing.T) {
+	ctx := context.Background()
+	store := mocks.NewStore()
+	vs := vectorstore.New(store, mocks.NewEmbedder(4))
+
+	doc := document.Document{PageContent: "a", Metadata: map[string]interface{}{"source": "a", "last_modified": "1"}}
+	if err := vs.AddDocuments(ctx, []document.Document{doc}); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	exists, err := vs.DocumentExists(ctx, []document.Document{doc})
+	if err != nil || !exists[0] {
+		t.Errorf("DocumentExists() = %v, %v, want [true]", exists, err)
+	}
+
+	if err := vs.Delete(ctx, vectorstore.Filter{"source": "a"}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	exists, err = vs.DocumentExists(ctx, []document.Document{doc})
+	if err != nil || exists[0] {
+		t.Errorf("DocumentExists() after Delete = %v, %v, want [false]", exists, err)
+	}
+}
+
+func TestVectorStore_EmbeddingTemplates(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+	vs := vectorstore.New(store, embedder,
+		vectorstore.WithEmbeddingTemplate(func(doc document.Document) string {
+			return fmt.Sprintf("%s\n\n%s", doc.Metadata["title"], doc.PageContent)
+		}),
+		vectorstore.WithQueryTemplate(func(query string) string {
+			return "query: " + query
+		}),
+	)
+
+	docs := []document.Document{
+		{PageContent: "first", Metadata: map[string]interface{}{"source": "a", "title": "Guide"}},
+	}
+	if err := vs.AddDocuments(ctx, docs); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+	if err := vs.ReplaceSource(ctx, "a", docs); err != nil {
+		t.Fatalf("ReplaceSource() error = %v", err)
+	}
+	for _, call := range embedder.Calls("EmbedDocuments") {
+		if texts := call.Args[0].([]string); len(texts) != 1 || texts[0] != "Guide\n\nfirst" {
+			t.Errorf("embedded texts = %q, want the templated text", texts)
+		}
+	}
+	if stored := store.Documents(); len(stored) != 1 || stored[0].PageContent != "first" {
+		t.Errorf("stored documents = %v, want the original content", stored)
+	}
+
+	if _, err := vs.SimilaritySearch(ctx, "setup", 1, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+	if calls := embedder.Calls("EmbedQuery"); len(calls) != 1 || calls[0].Args[0] != "query: setup" {
+		t.Errorf("EmbedQuery calls = %v, want the templated query", calls)
+	}
+}
+
+func TestVectorStore_InputTrimSkipsEmptyDocuments(t *testing.T) {
+	ctx := context.Background()
+	docs := []document.Document{
+		{PageContent: "first", Metadata: map[string]interface{}{"source": "a"}},
+		{PageContent: " \n\t ", Metadata: map[string]interface{}{"source": "a"}},
+		{PageContent: "", Metadata: map[string]interface{}{"source": "a"}},
+	}
+
+	t.Run("Empty documents are not embedded or stored", func(t *testing.T) {
+		embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+		vs := vectorstore.New(store, embedder)
+
+		if err := vs.AddDocuments(ctx, docs); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		if err := vs.ReplaceSource(ctx, "a", docs); err != nil {
+			t.Fatalf("ReplaceSource() error = %v", err)
+		}
+		for _, call := range embedder.Calls("EmbedDocuments") {
+			if texts := call.Args[0].([]string); len(texts) != 1 || texts[0] != "first" {
+				t.Errorf("embedded texts = %q, want only the non-empty document", texts)
+			}
+		}
+		if stored := store.Documents(); len(stored) != 1 {
+			t.Errorf("stored documents = %v, want only the non-empty document", stored)
+		}
+	})
+
+	t.Run("Only empty documents", func(t *testing.T) {
+		embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+		vs := vectorstore.New(store, embedder)
+
+		if err := vs.AddDocuments(ctx, docs[1:]); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		if got := embedder.CallCount("EmbedDocuments"); got != 0 {
+			t.Errorf("EmbedDocuments calls = %d, want 0", got)
+		}
+		if got := store.CallCount("AddDocuments"); got != 0 {
+			t.Errorf("store AddDocuments calls = %d, want 0", got)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+		vs := vectorstore.New(store, embedder, vectorstore.WithInputTrim(false))
+
+		if err := vs.AddDocuments(ctx, docs); err != nil {
+			t.Fatalf("AddDocuments() error = %v", err)
+		}
+		if stored := store.Documents(); len(stored) != len(docs) {
+			t.Errorf("stored %d documents, want %d", len(stored), len(docs))
+		}
+	})
+}
+
+func TestVectorStore_SkipsDocumentsRejectedByEmbedder(t *testing.T) {
+	ctx := context.Background()
+	embedder, store := mocks.NewEmbedder(4), mocks.NewStore()
+	embedder.EmbedDocumentsFunc = func(ctx context.Context, documents []string) ([][]float32, error) {
+		return embedding.EmbedIsolated(ctx, documents, 0, func(ctx context.Context, batch []string) ([][]float32, error) {
+			vectors := make([][]float32, len(batch))
+			for i, text := range batch {
+				if text == "poison" {
+					return nil, embedding.ErrTokenLimitExceeded("EmbedDocuments", nil)
+				}
+				vectors[i] = mocks.HashVector(text, 4)
+			}
+			return vectors, nil
+		})
+	}
+	vs := vectorstore.New(store, embedder)
+
+	docs := make([]document.Document, 10)
+	for i := range docs {
+		docs[i] = document.Document{PageContent: fmt.Sprintf("chunk %d", i), Metadata: map[string]interface{}{"source": "a"}}
+	}
+	docs[6].PageContent = "poison"
+
+	if err := vs.AddDocuments(ctx, docs); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+	if err := vs.ReplaceSource(ctx, "a", docs); err != nil {
+		t.Fatalf("ReplaceSource() error = %v", err)
+	}
+	stored := store.Documents()
+	if len(stored) != 9 {
+		t.Errorf("stored %d documents, want the 9 the embedder accepted", len(stored))
+	}
+	for _, doc := range stored {
+		if doc.PageContent == "poison" {
+			t.Error("stored the rejected document")
+		}
+	}
+
+	// Nothing is stored and the error is returned when every input is rejected
+	var partial *embedding.PartialEmbedError
+	if err := vs.AddDocuments(ctx, docs[6:7]); !errors.As(err, &partial) {
+		t.Errorf("AddDocuments() of only rejected input error = %v, want a *PartialEmbedError", err)
+	}
+}
+
+func TestVectorStore_SearchReportsRejectedScores(t *testing.T) {
+	ctx := context.Background()
+	store := mocks.NewStore()
+	vs := vectorstore.New(store, mocks.NewEmbedder(64), vectorstore.WithScoreThreshold(0.99))
+
+	result, err := vs.Search(ctx, "capital of France", 5, nil)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(result.Documents) != 0 || result.Rejected != 0 || result.BestRejectedScore != 0 {
+		t.Errorf("Search() of an empty store = %+v, want nothing found", result)
+	}
+
+	docs := []document.Document{
+		{PageContent: "Paris is the capital of France", Metadata: map[string]interface{}{"source": "france.md"}},
+		{PageContent: "Madrid is the capital of Spain", Metadata: map[string]interface{}{"source": "spain.md"}},
+	}
+	if err := vs.AddDocuments(ctx, docs); err != nil {
+		t.Fatalf("AddDocuments() error = %v", err)
+	}
+
+	result, err = vs.Search(ctx, "the capital of Portugal", 5, nil)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	unfiltered, err := store.SimilaritySearch(ctx, mocks.HashVector("the capital of Portugal", 64), 5, nil)
+	if err != nil {
+		t.Fatalf("store SimilaritySearch() error = %v", err)
+	}
+	if len(result.Documents) != 0 || result.Rejected != 2 || result.BestRejectedScore != unfiltered[0].Score {
+		t.Errorf("Search() = %+v, want both rejected with best score %v", result, unfiltered[0].Score)
+	}
+}
+
+func TestReplaceSourceFallback_NoPartialSource(t *testing.T) {
+	store := mocks.NewPartialStore(2)
+	docs := make([]vectorstore.Document, 3)
+	for i := range docs {
+		docs[i] = vectorstore.Document{PageContent: "chunk", Metadata: map[string]interface{}{"source": "a.txt"}}
+	}
+
+	err := vectorstore.ReplaceSourceFallback(context.Background(), store, "a.txt", docs, make([][]float32, 3))
+	if err == nil {
+		t.Fatal("ReplaceSourceFallback() error = nil, want the add failure")
+	}
+	if len(store.Documents()) != 0 {
+		t.Errorf("store holds %d chunks after the failed add, want none", len(store.Documents()))
+	}
+}
@@ -0,0 +1,105 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Abraxas-365/kbservice/document"
+	"github.com/Abraxas-365/kbservice/metrics"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// stubStore fails every call with err when set
+type stubStore struct {
+	err error
+}
+
+func (s *stubStore) AddDocuments(ctx context.Context, docs []Document, vectors [][]float32) error {
+	return s.err
+}
+
+func (s *stubStore) SimilaritySearch(ctx context.Context, vector []float32, limit int, filter Filter) ([]Document, error) {
+	return nil, s.err
+}
+
+func (s *stubStore) Delete(ctx context.Context, filter Filter) error {
+	return s.err
+}
+
+func (s *stubStore) InitDB(ctx context.Context, forceRecreate bool) error {
+	return s.err
+}
+
+func (s *stubStore) DocumentExists(ctx context.Context, docs []document.Document) ([]bool, error) {
+	return make([]bool, len(docs)), s.err
+}
+
+type stubEmbedder struct{}
+
+func (stubEmbedder) EmbedDocuments(ctx context.Context, documents []string) ([][]float32, error) {
+	return make([][]float32, len(documents)), nil
+}
+
+func (stubEmbedder) EmbedQuery(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1}, nil
+}
+
+func TestVectorStore_RecordsLatency(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+	}{
+		{name: "Success", wantStatus: metrics.StatusOK},
+		{name: "Error", err: errors.New("boom"), wantStatus: metrics.StatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := metrics.NewInMemoryRecorder()
+			vs := New(&stubStore{err: tt.err}, stubEmbedder{}, WithRecorder(recorder))
+			ctx := context.Background()
+
+			vs.SimilaritySearch(ctx, "query", 5, nil)
+			vs.AddDocuments(ctx, []document.Document{{PageContent: "a"}})
+
+			for _, operation := range []string{"similarity_search", "add_documents"} {
+				observations := recorder.Observations(metrics.VectorStoreLatency)
+				found := false
+				for _, o := range observations {
+					if o.Labels["operation"] == operation {
+						found = true
+						if o.Labels["status"] != tt.wantStatus || o.Labels["store"] != "vectorstore.stubStore" {
+							t.Errorf("%s labels = %v, want status %s and store vectorstore.stubStore", operation, o.Labels, tt.wantStatus)
+						}
+					}
+				}
+				if !found {
+					t.Errorf("no %s observation for %s", metrics.VectorStoreLatency, operation)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorStore_NilRecorder(t *testing.T) {
+	vs := New(&stubStore{}, stubEmbedder{}, WithRecorder(nil))
+	if _, err := vs.SimilaritySearch(context.Background(), "query", 5, nil); err != nil {
+		t.Fatalf("SimilaritySearch() error = %v", err)
+	}
+}
+
+func TestVectorStore_NilLogger(t *testing.T) {
+	vs := New(&stubStore{err: errors.New("boom")}, stubEmbedder{}, WithLogger(nil))
+	if _, err := vs.SimilaritySearch(context.Background(), "query", 5, nil); err == nil {
+		t.Fatal("SimilaritySearch() error = nil, want the store's error")
+	}
+}
+
+func TestStoreName_LooksThroughWrappers(t *testing.T) {
+	store := NewTracingStore(&stubStore{}, noop.NewTracerProvider())
+	if got := storeName(store); got != "vectorstore.stubStore" {
+		t.Errorf("storeName() = %q, want vectorstore.stubStore", got)
+	}
+}